@@ -19,51 +19,136 @@ package common
 import "time"
 
 const (
-	DefaultAPIServerPort                = 6443
-	DrainTimeout                        = 5 * time.Minute
-	DrainGracePeriodSeconds             = -1
-	DrainDeleteLocalData                = false
-	DrainForce                          = false
-	MasterRole                          = "master"
-	NodeRole                            = "node"
-	DefaultSSHPort                      = 22
-	DefaultNamespace                    = "default"
-	DefaultClusterName                  = "cctl-cluster"
-	DefaultSSHCredentialSecretName      = "ssh-credential"
-	DefaultCommonCASecretName           = "common-ca"
-	DefaultEtcdCASecretName             = "etcd-ca"
-	DefaultAPIServerCASecretName        = "apiserver-ca"
-	DefaultFrontProxyCASecretName       = "front-proxy-ca"
-	DefaultServiceAccountKeySecretName  = "serviceaccount-key"
-	DefaultBootstrapTokenSecretName     = "bootstrap-token"
-	SystemUUIDFile                      = "/sys/class/dmi/id/product_uuid"
-	KubectlFile                         = "/opt/bin/kubectl"
-	AdminKubeconfig                     = "/etc/kubernetes/admin.conf"
-	KubeletKubeconfig                   = "/etc/kubernetes/kubelet.conf"
-	DefaultNodeadmVersion               = "v0.3.0"
-	DefaultEtcdadmVersion               = "v0.1.1"
-	DefaultKubernetesVersion            = "1.12.8"
-	DefaultCNIVersion                   = "v0.6.0"
-	DefaultFlannelVersion               = "v0.10.0"
-	DefaultKeepalivedVersion            = "v2.0.4"
-	DefaultEtcdVersion                  = "v3.3.8"
-	DockerKubeAPIServerNameFilter       = "name=k8s_kube-apiserver.*kube-system.*"
-	DockerRunningStatusFilter           = "status=running"
-	InstanceStatusAnnotationKey         = "instance-status"
-	KubeAPIServer                       = "kube-apiserver"
-	KubeControllerManager               = "kube-controller-manager"
-	KubeScheduler                       = "kube-scheduler"
-	KubeSystemNamespace                 = "kube-system"
-	MinimumControlPlaneVersion          = "v1.11.0"
-	TmpKubeConfigNamePrefix             = "kubeconfig"
-	DefaultAdminConfigSecretName        = "admin-kubeconfig"
-	DefaultAdminConfigSecretKey         = "data"
-	KubeAPIServerServiceNodePortRange   = "80-32767"
-	KubeControllerMgrPodEvictionTimeout = "20s"
-	DashcamBundleBaseDir                = "/var/tmp"
-	DashcamCommandPath                  = "/opt/bin/dashcam"
-	SupportBundleFileNamePrefix         = "cctl-bundle"
-	ClusterV1PrintTemplate              = `Cluster Information
+	DefaultAPIServerPort            = 6443
+	DrainTimeout                    = 5 * time.Minute
+	DrainGracePeriodSeconds         = -1
+	DrainDeleteLocalData            = false
+	DrainForce                      = false
+	DefaultCertificateExpiryWarning = 30 * 24 * time.Hour
+	DefaultStateLockTimeout         = 30 * time.Second
+	DefaultOperationLeaseTTL        = 2 * time.Minute
+	DefaultReplaceReadyTimeout      = 10 * time.Minute
+	DefaultWaitTimeout              = 15 * time.Minute
+	APIServerRestartTimeout         = 5 * time.Minute
+	DefaultWaitInterval             = 10 * time.Second
+	DefaultRemoteCommandTimeout     = 15 * time.Minute
+	ControlPlaneHookTimeout         = 2 * time.Minute
+	DNSRecordTimeout                = 2 * time.Minute
+	// The hardware check thresholds follow the etcd hardware
+	// recommendations.
+	DefaultMaxFsyncLatency = 10 * time.Millisecond
+	DefaultMaxNetworkRTT   = 50 * time.Millisecond
+	DefaultMinCPUs         = 2
+	DefaultMinMemoryGiB    = 2
+	// The preflight checks run before a machine is provisioned.
+	PreflightMinDiskGiB     = 10
+	PreflightMaxClockSkew   = 30 * time.Second
+	PreflightMinKernelMajor = 3
+	PreflightMinKernelMinor = 10
+	PreflightDialTimeout    = 5 * time.Second
+	// StateLockFileSuffix is appended to the state filename to name the
+	// file that locks it.
+	StateLockFileSuffix                    = ".lock"
+	OperationLeaseFileSuffix               = ".lease"
+	StateBackupDirSuffix                   = ".backups"
+	ServeTokenFileSuffix                   = ".serve-token"
+	DefaultStateBackups                    = 10
+	DefaultStateGitDir                     = ".cctl/git"
+	MasterRole                             = "master"
+	NodeRole                               = "node"
+	EtcdRole                               = "etcd"
+	DefaultSSHPort                         = 22
+	DefaultVIPNetworkInterface             = "eth0"
+	DefaultPodNetworkCIDR                  = "10.2.0.0/16"
+	DefaultServiceCIDR                     = "10.1.0.0/16"
+	DefaultClusterDNSDomain                = "cluster.local"
+	DefaultNamespace                       = "default"
+	DefaultStateFilename                   = "/etc/cctl-state.yaml"
+	DefaultClusterName                     = "cctl-cluster"
+	DefaultSSHCredentialSecretName         = "ssh-credential"
+	KeychainSSHKeyPassphraseAccount        = "ssh-key-passphrase"
+	SSHKeyPassphraseEnvVar                 = "CCTL_SSH_KEY_PASSPHRASE"
+	DefaultBastionSSHCredentialSecretName  = "bastion-ssh-credential"
+	KeychainBastionSSHKeyPassphraseAccount = "bastion-ssh-key-passphrase"
+	BastionSSHKeyPassphraseEnvVar          = "CCTL_BASTION_SSH_KEY_PASSPHRASE"
+	DefaultCommonCASecretName              = "common-ca"
+	DefaultEtcdCASecretName                = "etcd-ca"
+	DefaultAPIServerCASecretName           = "apiserver-ca"
+	DefaultFrontProxyCASecretName          = "front-proxy-ca"
+	DefaultServiceAccountKeySecretName     = "serviceaccount-key"
+	DefaultBootstrapTokenSecretName        = "bootstrap-token"
+	DefaultEncryptionKeysSecretName        = "encryption-keys"
+	DefaultKeepalivedSecretName            = "keepalived-auth"
+	SystemUUIDFile                         = "/sys/class/dmi/id/product_uuid"
+	KubeletKubeconfig                      = "/etc/kubernetes/kubelet.conf"
+	KubeletBootstrapKubeconfig             = "/etc/kubernetes/bootstrap-kubelet.conf"
+	KubeletConfigFile                      = "/var/lib/kubelet/config.yaml"
+	DefaultNodeadmVersion                  = "v0.3.0"
+	DefaultEtcdadmVersion                  = "v0.1.1"
+	DefaultKubernetesVersion               = "1.12.8"
+	DefaultCNIVersion                      = "v0.6.0"
+	DefaultFlannelVersion                  = "v0.10.0"
+	DefaultKeepalivedVersion               = "v2.0.4"
+	DefaultEtcdVersion                     = "v3.3.8"
+	DockerKubeAPIServerNameFilter          = "name=k8s_kube-apiserver.*kube-system.*"
+	DockerKubeControllerMgrNameFilter      = "name=k8s_kube-controller-manager.*kube-system.*"
+	DockerKubeSchedulerNameFilter          = "name=k8s_kube-scheduler.*kube-system.*"
+	DockerRunningStatusFilter              = "status=running"
+	InstanceStatusAnnotationKey            = "instance-status"
+	LastContactAnnotationKey               = "cctl.platform9.com/last-contact"
+	UnreachableSinceAnnotationKey          = "cctl.platform9.com/unreachable-since"
+	PhaseAnnotationKey                     = "cctl.platform9.com/phase"
+	CompletedCreateStepsAnnotationKey      = "cctl.platform9.com/completed-create-steps"
+	RuntimeVersionAnnotationKey            = "cctl.platform9.com/runtime-version"
+	KubeletConfigAnnotationKey             = "cctl.platform9.com/kubelet-config"
+	DefaultRuntimePackage                  = "docker-ce"
+	DefaultRuntimeService                  = "docker"
+	BastionAnnotationKey                   = "cctl.platform9.com/bastion"
+	BastionPublicKeysAnnotationKey         = "cctl.platform9.com/bastion-public-keys"
+	VaultPathAnnotationKey                 = "cctl.platform9.com/vault-path"
+	RemoteBinDirAnnotationKey              = "cctl.platform9.com/remote-bin-dir"
+	RemoteAdminKubeconfigAnnotationKey     = "cctl.platform9.com/remote-admin-kubeconfig"
+	ObjectLabelsAnnotationKey              = "cctl.platform9.com/object-labels"
+	ObjectAnnotationsAnnotationKey         = "cctl.platform9.com/object-annotations"
+	MachineDefaultsAnnotationKey           = "cctl.platform9.com/machine-defaults"
+	APIServerCertSANsAnnotationKey         = "cctl.platform9.com/apiserver-cert-sans"
+	HostOSAnnotationKey                    = "cctl.platform9.com/host-os"
+	AuditPolicyAnnotationKey               = "cctl.platform9.com/audit-policy"
+	AuditLogRotationAnnotationKey          = "cctl.platform9.com/audit-log-rotation"
+	ControlPlaneHookAnnotationKey          = "cctl.platform9.com/control-plane-hook"
+	CNIAnnotationKey                       = "cctl.platform9.com/cni"
+	CNIManifestAnnotationKey               = "cctl.platform9.com/cni-manifest"
+	KeepalivedAnnotationKey                = "cctl.platform9.com/keepalived"
+	KubeconfigPolicyAnnotationKey          = "cctl.platform9.com/kubeconfig-policy"
+	DNSRecordAnnotationKey                 = "cctl.platform9.com/dns-record"
+	DefaultAuditLogMaxAge                  = 30
+	DefaultAuditLogMaxBackup               = 10
+	DefaultAuditLogMaxSize                 = 100
+	KubeAPIServer                          = "kube-apiserver"
+	KubeControllerManager                  = "kube-controller-manager"
+	KubeScheduler                          = "kube-scheduler"
+	KubeSystemNamespace                    = "kube-system"
+	MinimumControlPlaneVersion             = "v1.11.0"
+	TmpKubeConfigNamePrefix                = "kubeconfig"
+	DefaultAdminConfigSecretName           = "admin-kubeconfig"
+	DefaultAdminConfigSecretKey            = "data"
+	KubeAPIServerServiceNodePortRange      = "80-32767"
+	KubeControllerMgrPodEvictionTimeout    = "20s"
+	DashcamBundleBaseDir                   = "/var/tmp"
+	DashcamCommandPath                     = ProvisionerBinDir + "/dashcam"
+	SupportBundleFileNamePrefix            = "cctl-bundle"
+	TimeoutBundleFileNamePrefix            = "cctl-timeout"
+	DiagnosticsFileNamePrefix              = "cctl-diagnostics"
+	StaticPodManifestsDir                  = "/etc/kubernetes/manifests"
+	KubernetesDir                          = "/etc/kubernetes"
+	KubernetesPKIDir                       = "/etc/kubernetes/pki"
+	EtcdPKIDir                             = "/etc/etcd/pki"
+	EtcdDataDir                            = "/var/lib/etcd"
+	EtcdService                            = "etcd"
+	KubeletService                         = "kubelet"
+	KeepalivedConfigFile                   = "/etc/keepalived/keepalived.conf"
+	KeepalivedService                      = "keepalived"
+	ClusterV1PrintTemplate                 = `Cluster Information
 ------- ------------
 Cluster Name       : {{ .Cluster.ObjectMeta.Name}}
 Creation Timestamp : {{ .Cluster.ObjectMeta.CreationTimestamp }}
@@ -81,10 +166,109 @@ Networking
 `
 	MachineV1PrintTemplate = `Machine Information
 ------- -----------
-Machine IP             Creation Timestamp                      Role
-{{ range $machine := .}}{{ $machine.ObjectMeta.Name }}           {{ $machine.ObjectMeta.CreationTimestamp }}           {{ $machine.Spec.Roles }}
+Machine IP             Creation Timestamp                      Role           Phase          Last Contact              Unreachable Since
+{{ range $machine := .}}{{ $machine.ObjectMeta.Name }}           {{ $machine.ObjectMeta.CreationTimestamp }}           {{ $machine.Spec.Roles }}           {{ with index $machine.ObjectMeta.Annotations "cctl.platform9.com/phase" }}{{ . }}{{ else }}Unknown{{ end }}           {{ with index $machine.ObjectMeta.Annotations "cctl.platform9.com/last-contact" }}{{ . }}{{ else }}Never{{ end }}      {{ with index $machine.ObjectMeta.Annotations "cctl.platform9.com/unreachable-since" }}{{ . }}{{ else }}-{{ end }}
 {{ end }}
 `
+	MachineReachabilityPrintTemplate = `Machine Reachability
+------- ------------
+Machine IP             Reachable      Last Contact              Unreachable Since
+{{ range $r := .}}{{ $r.Name }}           {{ $r.Reachable }}           {{ with $r.LastContact }}{{ . }}{{ else }}Never{{ end }}      {{ with $r.UnreachableSince }}{{ . }}{{ else }}-{{ end }}
+{{ end }}
+`
+	MachineUsagePrintTemplate = `
+Machine Usage
+------- -----
+Machine IP             CPU            Memory                        Disk (/)
+{{ range $u := .}}{{ $u.Name }}           {{ $u.CPU }}           {{ $u.Memory }}           {{ $u.Disk }}
+{{ end }}{{ range $u := .}}
+Top Pods on {{ $u.Name }}
+{{ if $u.TopPodsError }}{{ $u.TopPodsError }}
+{{ else }}Namespace              Name                                    CPU            Memory
+{{ range $p := $u.TopPods }}{{ $p.Namespace }}           {{ $p.Name }}           {{ $p.CPU.String }}           {{ $p.Memory.String }}
+{{ end }}{{ end }}{{ end }}`
+	OperationPrintTemplate = `Namespace              Holder                        Operation                               Acquired                  Renewed                   Status
+{{ range $o := .}}{{ $o.Namespace }}           {{ $o.Holder }}           {{ $o.Operation }}           {{ $o.Acquired.Format "2006-01-02T15:04:05Z07:00" }}      {{ $o.Renewed.Format "2006-01-02T15:04:05Z07:00" }}      {{ $o.Status }}
+{{ end }}`
+	ReconcilePrintTemplate = `{{ if . }}Machine                Change                 Status         Disruptive     Detail
+{{ range $c := . }}{{ $c.Machine }}           {{ $c.Kind }}           {{ $c.Status }}           {{ $c.Disruptive }}           {{ $c.Detail }}{{ with $c.Remedy }} (use {{ . }}){{ end }}
+{{ end }}{{ else }}No changes
+{{ end }}`
+	StateBackupPrintTemplate = `{{ if . }}Backup                                                  Time                          Size
+{{ range $b := . }}{{ $b.Path }}           {{ $b.Time.Format "2006-01-02T15:04:05.000Z07:00" }}           {{ $b.Size }}
+{{ end }}{{ else }}No state backups
+{{ end }}`
+	StateDiffPrintTemplate = `Changes from {{ .From }} to {{ .To }}
+{{ if .Empty }}
+No changes
+{{ end }}{{ with .MachinesAdded }}
+Machines Added
+Namespace              Machine IP             Roles          Kubelet
+{{ range $m := . }}{{ $m.Namespace }}           {{ $m.Name }}           {{ $m.Roles }}           {{ $m.Kubelet }}
+{{ end }}{{ end }}{{ with .MachinesRemoved }}
+Machines Removed
+Namespace              Machine IP             Roles          Kubelet
+{{ range $m := . }}{{ $m.Namespace }}           {{ $m.Name }}           {{ $m.Roles }}           {{ $m.Kubelet }}
+{{ end }}{{ end }}{{ with .EtcdMembersAdded }}
+Etcd Members Added
+Namespace              Name                   ID                     Peer URLs
+{{ range $m := . }}{{ $m.Namespace }}           {{ $m.Name }}           {{ $m.ID }}           {{ $m.PeerURLs }}
+{{ end }}{{ end }}{{ with .EtcdMembersRemoved }}
+Etcd Members Removed
+Namespace              Name                   ID                     Peer URLs
+{{ range $m := . }}{{ $m.Namespace }}           {{ $m.Name }}           {{ $m.ID }}           {{ $m.PeerURLs }}
+{{ end }}{{ end }}{{ with .CertificatesRotated }}
+Certificates Rotated
+Namespace              Secret                 Key            Subject                  Serial                    Expires
+{{ range $c := . }}{{ $c.Namespace }}           {{ $c.Secret }}           {{ $c.Key }}           {{ $c.Subject }}           {{ $c.FromSerial }} -> {{ $c.ToSerial }}           {{ $c.FromNotAfter.Format "2006-01-02T15:04:05Z07:00" }} -> {{ $c.ToNotAfter.Format "2006-01-02T15:04:05Z07:00" }}
+{{ end }}{{ end }}{{ with .SecretsChanged }}
+Secrets Changed
+Namespace              Secret                 Change         Keys
+{{ range $s := . }}{{ $s.Namespace }}           {{ $s.Name }}           {{ $s.Change }}           {{ $s.Keys }}
+{{ end }}{{ end }}{{ with .FieldsChanged }}
+Fields Changed
+Object                                        Path                                    From -> To
+{{ range $f := . }}{{ $f.Kind }} {{ $f.Namespace }}/{{ $f.Name }}           {{ $f.Path }}           {{ with $f.From }}{{ . }}{{ else }}<none>{{ end }} -> {{ with $f.To }}{{ . }}{{ else }}<none>{{ end }}
+{{ end }}{{ end }}`
+	CSRApprovalPrintTemplate = `CSR                                   Node                   Decision       Reason
+{{ range $d := .}}{{ $d.Name }}           {{ $d.Node }}           {{ $d.Decision }}           {{ $d.Reason }}
+{{ end }}`
+	CertificateExpiryPrintTemplate = `Machine IP             Certificate                                          Expires                Remaining
+{{ range $c := .}}{{ $c.Machine }}           {{ $c.Path }}           {{ $c.Expires }}           {{ $c.Remaining }}
+{{ end }}`
+	VIPStatusPrintTemplate = `Machine IP             Keepalived     VIP Owner      State          Priority       Interface      Router ID      Drift
+{{ range $s := .}}{{ $s.Name }}           {{ $s.Keepalived }}           {{ $s.VIPOwner }}           {{ $s.State }}           {{ $s.Priority }}           {{ $s.Interface }}           {{ $s.RouterID }}           {{ $s.Drift }}
+{{ end }}`
+	DiscoveredMachinePrintTemplate = `Machine IP             Usable         OS                     Reason
+{{ range $c := .}}{{ $c.IP }}           {{ $c.Usable }}           {{ with $c.OS }}{{ . }}{{ else }}-{{ end }}           {{ $c.Reason }}
+{{ end }}`
+	HardwareCheckPrintTemplate = `Check                                  Result         Value                  Threshold              Error
+{{ range $r := .}}{{ $r.Check }}           {{ $r.Status }}           {{ with $r.Value }}{{ . }}{{ else }}-{{ end }}           {{ $r.Threshold }}           {{ $r.Error }}
+{{ end }}`
+	DoctorPrintTemplate = `Check                      Status         Message
+{{ range $r := .Results }}{{ $r.Check }}           {{ $r.Status }}           {{ $r.Message }}{{ with $r.Remediation }} (fix: {{ . }}){{ end }}
+{{ end }}{{ if .Go }}Go{{ else }}No-go{{ end }}
+`
+	RemoteVersionPrintTemplate = `Machine IP             Roles          Kubelet        Kubeadm        Etcdadm        Etcd           OS
+{{ range $m := .Machines }}{{ $m.Name }}           {{ $m.Roles }}           {{ $m.Version "kubelet" }}           {{ $m.Version "kubeadm" }}           {{ $m.Version "etcdadm" }}           {{ $m.Version "etcd" }}           {{ $m.Version "os" }}
+{{ end }}{{ if .Inconsistent }}Inconsistent versions: {{ range $i, $c := .Inconsistent }}{{ if $i }}, {{ end }}{{ $c }}{{ end }}{{ else }}All machines run the same versions{{ end }}
+`
+	StateVerifyPrintTemplate = `{{ if . }}Object                                 Severity       Repair                         Problem
+{{ range $p := . }}{{ $p.Object }}           {{ $p.Severity }}           {{ with $p.Repair }}{{ . }}{{ else }}-{{ end }}           {{ $p.Message }}
+{{ end }}{{ else }}The state is consistent
+{{ end }}`
+	NodeStatusPrintTemplate = `Machine IP             Roles          Node                   Ready          Kubelet Version        Internal IP
+{{ range $s := .}}{{ with $s.Machine }}{{ . }}{{ else }}-{{ end }}           {{ with $s.Roles }}{{ . }}{{ else }}-{{ end }}           {{ with $s.Node }}{{ . }}{{ else }}-{{ end }}           {{ $s.Ready }}           {{ with $s.KubeletVersion }}{{ . }}{{ else }}-{{ end }}           {{ with $s.InternalIP }}{{ . }}{{ else }}-{{ end }}
+{{ end }}`
+	ClusterStatusPrintTemplate = `Machine IP             Roles          Reachable      Kubelet        API Server     Etcd           Node Ready     Etcd Member    VIP Owner
+{{ range $h := .}}{{ $h.Name }}           {{ $h.Roles }}           {{ $h.Reachable }}           {{ $h.Kubelet }}           {{ $h.APIServer }}           {{ $h.Etcd }}           {{ $h.NodeReady }}           {{ $h.EtcdMember }}           {{ $h.VIPOwner }}
+{{ end }}`
+	// CronJobStateSecretKey is the key of the state file in the secret
+	// mounted by the rendered cronjobs.
+	CronJobStateSecretKey         = "cctl-state.yaml"
+	DefaultCronJobNamespace       = "kube-system"
+	DefaultCronJobStateSecretName = "cctl-state"
+	DefaultCronJobBackupClaimName = "cctl-backups"
 	// LabelNodeRoleMaster specifies that a node is a master
 	LabelNodeRoleMaster = "node-role.kubernetes.io/master"
 )
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package common
+
+import (
+	"fmt"
+	"path"
+)
+
+const (
+	// DefaultRemoteBinDir is where nodeadm and etcdadm install binaries on
+	// machines.
+	DefaultRemoteBinDir    = "/opt/bin"
+	DefaultAdminKubeconfig = "/etc/kubernetes/admin.conf"
+
+	// ProvisionerBinDir is where the machine provisioner installs etcdadm
+	// and nodeadm. It is fixed by the provisioner, and is not changed by
+	// SetRemotePaths.
+	ProvisionerBinDir = "/opt/bin"
+	// EtcdadmFile and NodeadmFile are the paths of etcdadm and nodeadm on
+	// machines.
+	EtcdadmFile = ProvisionerBinDir + "/etcdadm"
+	NodeadmFile = ProvisionerBinDir + "/nodeadm"
+)
+
+// Paths of binaries and files on machines. They are changed by
+// SetRemotePaths for clusters whose machines use other locations.
+var (
+	KubectlFile     = path.Join(DefaultRemoteBinDir, "kubectl")
+	KubeletFile     = path.Join(DefaultRemoteBinDir, "kubelet")
+	KubeadmFile     = path.Join(DefaultRemoteBinDir, "kubeadm")
+	EtcdctlFile     = path.Join(DefaultRemoteBinDir, "etcdctl.sh")
+	AdminKubeconfig = DefaultAdminKubeconfig
+)
+
+// SetRemotePaths sets the directory of the kubectl, kubelet, kubeadm, and
+// etcdctl.sh binaries, and the path of the admin kubeconfig, on machines. An
+// empty value leaves the path unchanged. etcdadm and nodeadm are always in
+// ProvisionerBinDir.
+func SetRemotePaths(binDir, adminKubeconfig string) error {
+	if err := ValidateRemotePaths(binDir, adminKubeconfig); err != nil {
+		return err
+	}
+	if len(binDir) != 0 {
+		KubectlFile = path.Join(binDir, "kubectl")
+		KubeletFile = path.Join(binDir, "kubelet")
+		KubeadmFile = path.Join(binDir, "kubeadm")
+		EtcdctlFile = path.Join(binDir, "etcdctl.sh")
+	}
+	if len(adminKubeconfig) != 0 {
+		AdminKubeconfig = adminKubeconfig
+	}
+	return nil
+}
+
+// ValidateRemotePaths verifies that the paths given are absolute.
+func ValidateRemotePaths(binDir, adminKubeconfig string) error {
+	if len(binDir) != 0 && !path.IsAbs(binDir) {
+		return fmt.Errorf("binary directory %q is not an absolute path", binDir)
+	}
+	if len(adminKubeconfig) != 0 && !path.IsAbs(adminKubeconfig) {
+		return fmt.Errorf("admin kubeconfig %q is not an absolute path", adminKubeconfig)
+	}
+	return nil
+}
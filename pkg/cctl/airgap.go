@@ -0,0 +1,259 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	machineActuator "github.com/platform9/ssh-provider/pkg/clusterapi/machine"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	"github.com/spf13/cobra"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/airgap"
+	"github.com/platform9/cctl/pkg/util/operror"
+	"github.com/platform9/cctl/pkg/util/transfer"
+)
+
+// artifactDir is the local directory from which create machine uploads the
+// nodeadm and etcdadm binaries that a machine is missing.
+var artifactDir string
+
+var bundleCmdDownload = &cobra.Command{
+	Use:   "download",
+	Short: "Download the artifacts that machines need to be provisioned without internet access",
+	Long: `Download the nodeadm, etcdadm, kubelet, kubeadm, kubectl, and CNI plugin
+artifacts of the given versions into --dir, and write a manifest of them, with
+their checksums. The Kubernetes binaries and the CNI plugins must match the
+checksums published with them. Artifacts already downloaded into --dir are
+kept. Copy the directory to a host that can reach the machines, and push it to
+each machine with bundle push before the machine is created.
+
+Container images, e.g. those of the control plane and flannel, are not
+downloaded; load them into a registry the machines can reach.`,
+	// The state is not read, so the state lock is not needed.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := cmd.Flag("dir").Value.String()
+		versions := airgap.Versions{
+			Nodeadm:    cmd.Flag("nodeadm-version").Value.String(),
+			Etcdadm:    cmd.Flag("etcdadm-version").Value.String(),
+			Kubernetes: cmd.Flag("kubernetes-version").Value.String(),
+			CNI:        cmd.Flag("cni-version").Value.String(),
+			Arch:       cmd.Flag("arch").Value.String(),
+		}
+		m, err := airgap.Download(dir, versions, airgap.HTTPGetter, log.Printf)
+		if err != nil {
+			log.Fatalf("Unable to download bundle: %v", err)
+		}
+		log.Printf("Downloaded %d artifacts to %q.", len(m.Artifacts), dir)
+	},
+}
+
+var bundleCmdPush = &cobra.Command{
+	Use:   "push",
+	Short: "Upload the downloaded artifacts to a machine",
+	Long: `Upload the artifacts downloaded by bundle download to the cache of the
+machine, so that it can be created without internet access. The checksum of
+every artifact is verified before and after it is uploaded; artifacts already
+on the machine, with the same checksum, are skipped.
+
+The artifacts are uploaded to ` + machineActuator.CachePath + `/<component>/<version>/,
+from which nodeadm and etcdadm are installed when the machine is provisioned.
+The machine need not be in the state; if it is not, --port and --public-keys
+identify it, as for create machine.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := cmd.Flag("dir").Value.String()
+		ip := cmd.Flag("ip").Value.String()
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Unable to parse `port`: %v", err)
+		}
+		publicKeyFiles, err := cmd.Flags().GetStringSlice("public-keys")
+		if err != nil {
+			log.Fatalf("Unable to parse `public-keys`: %v", err)
+		}
+		if err := pushBundle(dir, ip, port, publicKeyFiles); err != nil {
+			log.Fatalf("Unable to push bundle to machine %q: %v", ip, err)
+		}
+		log.Printf("Bundle pushed to machine %q successfully.", ip)
+	},
+}
+
+// pushBundle uploads every artifact of the bundle directory that is not
+// already on the machine.
+func pushBundle(dir, ip string, port int, publicKeyFiles []string) error {
+	m, err := airgap.ReadManifest(dir)
+	if err != nil {
+		return err
+	}
+	if err := airgap.Verify(dir, m); err != nil {
+		return err
+	}
+	reconnect := func() (sshmachine.Client, error) {
+		return hardwareCheckClient(ip, port, publicKeyFiles)
+	}
+	client, err := reconnect()
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	for i, a := range m.Artifacts {
+		remotePath := path.Join(machineActuator.CachePath, a.File)
+		if remoteFileChecksum(client, remotePath) == a.SHA256 {
+			log.Printf("[%d/%d] %s is already on the machine", i+1, len(m.Artifacts), remotePath)
+			continue
+		}
+		log.Printf("[%d/%d] Uploading %s", i+1, len(m.Artifacts), remotePath)
+		if err := client.MkdirAll(path.Dir(remotePath), 0755); err != nil {
+			return fmt.Errorf("unable to create %q: %v", path.Dir(remotePath), err)
+		}
+		mode := os.FileMode(0644)
+		if a.Executable {
+			mode = 0755
+		}
+		if err := transfer.Upload(client, reconnect, filepath.Join(dir, filepath.FromSlash(a.File)), remotePath, mode, transferOptions()); err != nil {
+			return fmt.Errorf("unable to upload %q: %v", a.File, err)
+		}
+	}
+	return nil
+}
+
+// provisioningBinary is a binary that a machine needs to be provisioned.
+type provisioningBinary struct {
+	component   string
+	version     string
+	installPath string
+}
+
+// provisioningBinaries returns the binaries that the machine needs to be
+// provisioned: nodeadm, for a master or node, and etcdadm, for a master or an
+// etcd machine, each installed at the path it is run from.
+func provisioningBinaries(machine *clusterv1.Machine) ([]provisioningBinary, error) {
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	versions := machineSpec.ComponentVersions
+	if isEtcdMachine(machine) {
+		return []provisioningBinary{{"etcdadm", versions.EtcdadmVersion, common.EtcdadmFile}}, nil
+	}
+	binaries := []provisioningBinary{{"nodeadm", versions.NodeadmVersion, machineActuator.NodeadmPath}}
+	if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+		binaries = append(binaries, provisioningBinary{"etcdadm", versions.EtcdadmVersion, machineActuator.EtcdadmPath})
+	}
+	return binaries, nil
+}
+
+// ensureProvisioningBinaries uploads, from --artifact-dir to the cache of the
+// machine, each binary that the machine needs to be provisioned, if it is
+// neither installed nor in the cache, so that it is installed from the cache.
+// Without --artifact-dir, a missing binary is reported before the machine is
+// provisioned.
+func ensureProvisioningBinaries(machine *clusterv1.Machine, pm *spv1.ProvisionedMachine) error {
+	binaries, err := provisioningBinaries(machine)
+	if err != nil {
+		return err
+	}
+	reconnect := func() (sshmachine.Client, error) {
+		return sshMachineClientFromSSHConfig(pm.Spec.SSHConfig)
+	}
+	client, err := reconnect()
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	for _, b := range binaries {
+		installed, err := client.Exists(b.installPath)
+		if err != nil {
+			return fmt.Errorf("unable to check if %s is installed at %q: %v", b.component, b.installPath, err)
+		}
+		if installed {
+			continue
+		}
+		file := airgap.CacheFile(b.component, b.version)
+		remotePath := path.Join(machineActuator.CachePath, file)
+		cached, err := client.Exists(remotePath)
+		if err != nil {
+			return fmt.Errorf("unable to check if %q exists: %v", remotePath, err)
+		}
+		if cached {
+			continue
+		}
+		if len(artifactDir) == 0 {
+			return operror.New(operror.Precondition, "%s is not installed at %q, and version %s is not in the cache %q of the machine. Use --artifact-dir to upload it, or bundle push", b.component, b.installPath, b.version, remotePath)
+		}
+		localPath := filepath.Join(artifactDir, filepath.FromSlash(file))
+		if _, err := os.Stat(localPath); err != nil {
+			return operror.New(operror.Precondition, "%s is not installed at %q, and version %s is not in --artifact-dir: %v", b.component, b.installPath, b.version, err)
+		}
+		if err := airgap.VerifyFile(artifactDir, file); err != nil {
+			return err
+		}
+		log.Printf("Uploading %s version %s to %s", b.component, b.version, remotePath)
+		if err := client.MkdirAll(path.Dir(remotePath), 0755); err != nil {
+			return fmt.Errorf("unable to create %q: %v", path.Dir(remotePath), err)
+		}
+		if err := transfer.Upload(client, reconnect, localPath, remotePath, 0755, transferOptions()); err != nil {
+			return fmt.Errorf("unable to upload %q: %v", localPath, err)
+		}
+	}
+	return nil
+}
+
+// remoteFileChecksum returns the SHA-256 checksum of the file on the machine,
+// or an empty string if it cannot be read.
+func remoteFileChecksum(client sshmachine.Client, remotePath string) string {
+	stdOut, _, err := client.RunCommand(fmt.Sprintf("sha256sum %s", remotePath))
+	if err != nil {
+		return ""
+	}
+	fields := strings.Fields(string(stdOut))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func init() {
+	bundleCmd.AddCommand(bundleCmdDownload)
+	bundleCmd.AddCommand(bundleCmdPush)
+	bundleCmdDownload.Flags().String("dir", "", "Directory to download the artifacts to")
+	bundleCmdDownload.MarkFlagRequired("dir")
+	bundleCmdDownload.Flags().String("nodeadm-version", common.DefaultNodeadmVersion, "Version of nodeadm")
+	bundleCmdDownload.Flags().String("etcdadm-version", common.DefaultEtcdadmVersion, "Version of etcdadm")
+	bundleCmdDownload.Flags().String("kubernetes-version", common.DefaultKubernetesVersion, "Version of the kubelet, kubeadm, and kubectl")
+	bundleCmdDownload.Flags().String("cni-version", common.DefaultCNIVersion, "Version of the CNI plugins")
+	bundleCmdDownload.Flags().String("arch", "amd64", "Architecture of the machines")
+	bundleCmdPush.Flags().String("dir", "", "Directory of the artifacts downloaded by bundle download")
+	bundleCmdPush.MarkFlagRequired("dir")
+	bundleCmdPush.Flags().String("ip", "", "IP of the machine")
+	bundleCmdPush.MarkFlagRequired("ip")
+	bundleCmdPush.Flags().Int("port", common.DefaultSSHPort, "SSH port, if the machine is not in the state")
+	bundleCmdPush.Flags().StringSlice("public-keys", []string{}, "The machine's SSH public keys, if the machine is not in the state. Provide a comma-separated list, or define multiple flags.")
+}
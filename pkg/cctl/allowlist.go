@@ -0,0 +1,222 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	"github.com/spf13/cobra"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/allowlist"
+	"github.com/platform9/cctl/pkg/util/hostos"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// commandAllowlistFile is the file of command patterns that every command run
+// on a machine must match. If empty, commands are not checked.
+var commandAllowlistFile string
+
+var (
+	commandAllowlistOnce sync.Once
+	commandAllowlist     allowlist.List
+	commandAllowlistErr  error
+)
+
+// readCommandAllowlist reads the command allowlist file once.
+func readCommandAllowlist() (allowlist.List, error) {
+	commandAllowlistOnce.Do(func() {
+		f, err := os.Open(commandAllowlistFile)
+		if err != nil {
+			commandAllowlistErr = fmt.Errorf("unable to open command allowlist: %v", err)
+			return
+		}
+		defer f.Close()
+		commandAllowlist, commandAllowlistErr = allowlist.Parse(f)
+	})
+	return commandAllowlist, commandAllowlistErr
+}
+
+// withCommandAllowlist wraps the client so that it refuses commands not in the
+// command allowlist, if one is given.
+func withCommandAllowlist(client sshmachine.Client) (sshmachine.Client, error) {
+	if len(commandAllowlistFile) == 0 {
+		return client, nil
+	}
+	l, err := readCommandAllowlist()
+	if err != nil {
+		return nil, err
+	}
+	return sshutil.NewAllowlistClient(client, l.Allows), nil
+}
+
+// commandAllowlistEntries returns the patterns of every command cctl runs on
+// machines, with the remote paths of the cluster. Commands of the bounded
+// programs are wrapped with timeout(1), as they are run, unless
+// --remote-timeout is zero.
+func commandAllowlistEntries() []allowlist.Entry {
+	bounded := func(pattern string) string {
+		if remoteTimeout <= 0 {
+			return pattern
+		}
+		return fmt.Sprintf("timeout --kill-after=%ds *s %s", int64(sshutil.TimeoutGracePeriod/time.Second), pattern)
+	}
+	kubectl := fmt.Sprintf("%s --kubeconfig=*", common.KubectlFile)
+	entries := []allowlist.Entry{
+		{Pattern: bounded(kubectl + " get *"), Purpose: "Get nodes, pods and CSRs, and check the API server health"},
+		{Pattern: bounded(kubectl + " certificate approve *"), Purpose: "Approve kubelet serving certificate requests"},
+		{Pattern: bounded(kubectl + " top pod *"), Purpose: "Report the resource usage of pods"},
+		{Pattern: bounded(kubectl + " drain *"), Purpose: "Drain a node before changing its machine"},
+		{Pattern: bounded(kubectl + " cordon *"), Purpose: "Cordon the node of a machine"},
+		{Pattern: bounded(kubectl + " uncordon *"), Purpose: "Uncordon a node after changing its machine, or on request"},
+		{Pattern: bounded(kubectl + " delete node *"), Purpose: "Delete the node of a deleted machine"},
+		{Pattern: bounded(kubectl + " label node *"), Purpose: "Label the node of a machine"},
+		{Pattern: bounded(kubectl + " replace -f *"), Purpose: "Point kube-proxy at the API endpoint"},
+		{Pattern: bounded(kubectl + " apply -f *"), Purpose: "Deploy the pod network"},
+		{Pattern: bounded(kubectl + " -nkube-system delete *"), Purpose: "Delete kube-dns after deploying CoreDNS, restart kube-proxy, and remove flannel if the cluster uses another pod network"},
+		{Pattern: fmt.Sprintf("sh -c '%s get secrets --all-namespaces -o json | %s replace -f -'", kubectl, kubectl), Purpose: "Re-encrypt secrets after enabling encryption or rotating the encryption key"},
+		{Pattern: bounded(common.KubeadmFile + " token create *"), Purpose: "Create bootstrap tokens to join machines"},
+		{Pattern: bounded(common.KubeadmFile + " config view"), Purpose: "Read the cluster configuration"},
+		{Pattern: bounded(common.KubeadmFile + " version"), Purpose: "Collect the kubeadm version for diagnostics"},
+		{Pattern: bounded(kubeadmVersionCmd()), Purpose: "Detect the kubeadm version, to parse its output"},
+		{Pattern: bounded(kubectlVersionCmd()), Purpose: "Detect the kubectl version, to parse its output"},
+		{Pattern: common.KubeletFile + " --version", Purpose: "Report the kubelet version of machines"},
+		{Pattern: bounded(common.EtcdadmFile + " *"), Purpose: "Initialize, join, reset, and inspect etcd members"},
+		{Pattern: bounded(common.EtcdctlFile + " *"), Purpose: "Snapshot, defragment, and check the health of etcd"},
+		{Pattern: bounded(common.NodeadmFile + " *"), Purpose: "Provision and deprovision Kubernetes nodes"},
+		{Pattern: "docker ps --quiet *", Purpose: "Find the etcd container during recovery"},
+		{Pattern: "docker stop *", Purpose: "Stop the etcd container during recovery"},
+		{Pattern: "docker rm *", Purpose: "Remove the etcd container during recovery"},
+		{Pattern: "journalctl --no-pager --unit *", Purpose: "Collect service logs for diagnostics"},
+		{Pattern: fmt.Sprintf("sed -i -E * %s", common.KeepalivedConfigFile), Purpose: "Change the keepalived interface"},
+		{Pattern: "grep -oP -- * " + common.StaticPodManifestsDir + "/kube-apiserver.yaml", Purpose: "Read the API server address and port"},
+		{Pattern: "ls -1 " + common.StaticPodManifestsDir, Purpose: "List static pods for diagnostics"},
+		{Pattern: "mkdir -p *", Purpose: "Create directories"},
+		{Pattern: "chmod *", Purpose: "Set the permissions of files and directories"},
+		{Pattern: "mv -f *", Purpose: "Move files"},
+		{Pattern: "cp -f *", Purpose: "Copy files"},
+		{Pattern: "rm -f *", Purpose: "Remove files"},
+		{Pattern: "rm -rf */cctl-hardware-check-*", Purpose: "Remove the directory of the disk check"},
+		{Pattern: "test -e * && echo true || echo false", Purpose: "Check if files exist"},
+		{Pattern: "test -d *", Purpose: "Check if directories exist"},
+		{Pattern: "dd if=*", Purpose: "Download files in chunks"},
+		{Pattern: "stat -c %s *", Purpose: "Get the size of files"},
+		{Pattern: "sha256sum *", Purpose: "Verify transferred files"},
+		{Pattern: "sh -c 'sha256sum *", Purpose: "Verify the chunks of interrupted uploads"},
+		{Pattern: "sh -c 'cat /dev/null *", Purpose: "Assemble uploaded chunks"},
+		{Pattern: "cat " + common.SystemUUIDFile, Purpose: "Find the node of a machine"},
+		{Pattern: "cat /etc/os-release", Purpose: "Discover the operating system of machines"},
+		{Pattern: "cat /proc/meminfo", Purpose: "Check memory"},
+		{Pattern: "head -n1 /proc/stat*", Purpose: "Measure CPU usage"},
+		{Pattern: "df -P -k /", Purpose: "Check disk usage"},
+		{Pattern: "df -P -k " + path.Dir(common.EtcdDataDir), Purpose: "Check disk space before provisioning machines"},
+		{Pattern: "ss -ltn", Purpose: "Check that the ports Kubernetes uses are free"},
+		{Pattern: "cat /proc/swaps", Purpose: "Check that swap is off"},
+		{Pattern: "uname -r", Purpose: "Check the kernel version"},
+		{Pattern: "docker info --format '{{.CgroupDriver}}'", Purpose: "Check the docker cgroup driver"},
+		{Pattern: "timedatectl status", Purpose: "Check that the clock is synchronized"},
+		{Pattern: "date +%s", Purpose: "Check the clock skew"},
+		{Pattern: "timeout * bash -c 'exec 3<>/dev/tcp/*'", Purpose: "Check the connectivity of new machines to the API server"},
+		{Pattern: "nproc", Purpose: "Check the number of CPUs"},
+		{Pattern: "ping -c 5 -q *", Purpose: "Check the network latency between masters"},
+		{Pattern: "fio *", Purpose: "Check the disk latency for etcd"},
+		{Pattern: "ip -o addr show", Purpose: "Find the interface of the virtual IP"},
+		{Pattern: "ip -o -4 addr show", Purpose: "Find the interfaces of machines"},
+		{Pattern: "command -v *", Purpose: "Detect the init system"},
+		{Pattern: common.DashcamCommandPath + " bundle --output *", Purpose: "Create support bundles"},
+		{Pattern: "true", Purpose: "Check that machines are reachable"},
+		{Pattern: "cat " + bootIDFile, Purpose: "Check that rebooted machines booted again"},
+	}
+	for _, init := range hostos.InitSystems {
+		o := hostos.OS{Init: init}
+		entries = append(entries,
+			allowlist.Entry{Pattern: o.ServiceStateCommand("*"), Purpose: "Report the status of services"},
+			allowlist.Entry{Pattern: o.ServiceCommand("restart", "*"), Purpose: "Restart services after rotating certificates or changing keepalived"},
+			allowlist.Entry{Pattern: o.ServiceCommand("stop", common.KubeletService), Purpose: "Stop the kubelet of hibernated machines"},
+			allowlist.Entry{Pattern: o.ServiceCommand("start", common.KubeletService), Purpose: "Start the kubelet of resumed machines"},
+			allowlist.Entry{Pattern: o.PowerOffCommand(), Purpose: "Power off hibernated machines"},
+			allowlist.Entry{Pattern: o.RebootCommand(), Purpose: "Reboot machines"},
+		)
+	}
+	for _, p := range hostos.PackageCommandPatterns() {
+		entries = append(entries, allowlist.Entry{Pattern: p, Purpose: "Install and query container runtime packages"})
+	}
+	entries = append(entries, allowlist.Entry{Pattern: hostos.SysextRefreshCommand, Purpose: "Install container runtime systemd-sysext images on immutable operating systems"})
+	return entries
+}
+
+var commandAllowlistCmdRender = &cobra.Command{
+	Use:   "command-allowlist",
+	Short: "Render the commands cctl runs on machines, for sudoers or a restricted shell",
+	Long: `Render the patterns of every command cctl runs on machines, so that the cctl
+user can be restricted to them. Every command is run with sudo. In a pattern,
+an asterisk matches any characters, including spaces, as in sudoers.
+
+The text format can be given to --command-allowlist, possibly after removing
+the patterns of operations that are not needed, to make cctl refuse every
+other command before it is run. The sudoers format assumes that programs given
+by name are in --bin-dir.
+
+The allowlist limits the programs cctl runs and their leading arguments, not
+what they do; e.g. "chmod *" allows changing the permissions of any file.
+Files are transferred over SFTP, which must also be allowed. 'exec machine'
+and 'ssh machine' run arbitrary commands, and are refused when
+--command-allowlist is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		format := cmd.Flag("format").Value.String()
+		entries := commandAllowlistEntries()
+		var err error
+		switch format {
+		case "text":
+			err = allowlist.Write(os.Stdout, entries)
+		case "sudoers":
+			err = allowlist.WriteSudoers(os.Stdout, cmd.Flag("user").Value.String(), cmd.Flag("bin-dir").Value.String(), entries)
+		case "json":
+			var b []byte
+			if b, err = json.MarshalIndent(entries, "", "  "); err == nil {
+				_, err = fmt.Println(string(b))
+			}
+		default:
+			log.Fatalf("Unknown format %q. Permitted values are text, sudoers and json.", format)
+		}
+		if err != nil {
+			log.Fatalf("Unable to render command allowlist: %v", err)
+		}
+	},
+}
+
+// mustNotEnforceCommandAllowlist exits if a command allowlist is given, for
+// commands that run arbitrary commands on machines.
+func mustNotEnforceCommandAllowlist(cmd *cobra.Command) {
+	if len(commandAllowlistFile) != 0 {
+		log.Fatalf("%q runs arbitrary commands, and is not allowed when --command-allowlist is given.", cmd.CommandPath())
+	}
+}
+
+func init() {
+	renderCmd.AddCommand(commandAllowlistCmdRender)
+	commandAllowlistCmdRender.Flags().String("format", "text", "Output format, permitted values text, sudoers and json")
+	commandAllowlistCmdRender.Flags().String("user", "cctl", "User the sudoers rules apply to")
+	commandAllowlistCmdRender.Flags().String("bin-dir", "/usr/bin", "Directory of the programs given by name, e.g. chmod, in the sudoers rules")
+}
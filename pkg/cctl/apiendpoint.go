@@ -0,0 +1,395 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/apiendpoint"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+const (
+	kubeProxyConfigMapName = "kube-proxy"
+	kubeProxyKubeconfigKey = "kubeconfig.conf"
+)
+
+// controlPlaneHookFlags are the flags of update cluster that configure the
+// control plane hook.
+var controlPlaneHookFlags = []string{"control-plane-hook-url", "control-plane-hook-command", "control-plane-endpoint"}
+
+// setControlPlaneHook records the control plane hook flags given to the
+// command in the cluster. Flags not given keep their recorded value, and an
+// empty flag removes it. The hook is removed when it has no settings left.
+func setControlPlaneHook(cmd *cobra.Command, cluster *clusterv1.Cluster) error {
+	hook, _, err := controlPlaneHook(cluster)
+	if err != nil {
+		return err
+	}
+	for flag, setting := range map[string]*string{
+		"control-plane-hook-url":     &hook.URL,
+		"control-plane-hook-command": &hook.Command,
+		"control-plane-endpoint":     &hook.Endpoint,
+	} {
+		if cmd.Flag(flag).Changed {
+			*setting = cmd.Flag(flag).Value.String()
+		}
+	}
+	if err := hook.Validate(); err != nil {
+		return err
+	}
+	if hook == (apiendpoint.Hook{}) {
+		delete(cluster.Annotations, common.ControlPlaneHookAnnotationKey)
+		return nil
+	}
+	hookJSON, err := json.Marshal(hook)
+	if err != nil {
+		return fmt.Errorf("unable to encode control plane hook: %v", err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[common.ControlPlaneHookAnnotationKey] = string(hookJSON)
+	return nil
+}
+
+// controlPlaneHook returns the control plane hook recorded in the cluster. It
+// returns false if the cluster has none.
+func controlPlaneHook(cluster *clusterv1.Cluster) (apiendpoint.Hook, bool, error) {
+	var hook apiendpoint.Hook
+	value, ok := cluster.Annotations[common.ControlPlaneHookAnnotationKey]
+	if !ok {
+		return hook, false, nil
+	}
+	if err := json.Unmarshal([]byte(value), &hook); err != nil {
+		return hook, false, fmt.Errorf("unable to decode control plane hook: %v", err)
+	}
+	return hook, true, nil
+}
+
+// syncControlPlaneEndpoints runs the control plane hook of the cluster, if
+// any, with the API server of every master as backends, then points the
+// kubelet and kube-proxy of every node at the endpoint of the hook, if it has
+// one. It does nothing if the cluster has no control plane hook.
+func syncControlPlaneEndpoints(cluster *clusterv1.Cluster, action, machineName string) error {
+	hook, ok, err := controlPlaneHook(cluster)
+	if err != nil || !ok {
+		return err
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	if hook.Runs() {
+		event := apiendpoint.Event{
+			Cluster:   cluster.Name,
+			Namespace: namespace,
+			Action:    action,
+			Machine:   machineName,
+			Backends:  []string{},
+		}
+		for _, m := range machineList.Items {
+			if clusterutil.RoleContains(clustercommon.MasterRole, m.Spec.Roles) {
+				event.Backends = append(event.Backends, net.JoinHostPort(m.Name, strconv.Itoa(common.DefaultAPIServerPort)))
+			}
+		}
+		log.Printf("Running control plane hook for %d masters", len(event.Backends))
+		if err := apiendpoint.Run(hook, event, common.ControlPlaneHookTimeout); err != nil {
+			return fmt.Errorf("unable to run control plane hook: %v", err)
+		}
+	}
+	// Nodes are repointed only at the endpoint of the hook. Without masters,
+	// nodes cannot reach the API server.
+	endpoint := hook.Endpoint
+	if len(endpoint) == 0 || len(clusterapi.MachinesWithRole(machineList.Items, clustercommon.MasterRole)) == 0 {
+		return nil
+	}
+	for i := range machineList.Items {
+		node := &machineList.Items[i]
+		if !clusterutil.RoleContains(clustercommon.NodeRole, node.Spec.Roles) {
+			continue
+		}
+		client, err := machineClientForMachine(node)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client for machine %q: %v", node.Name, err)
+		}
+		if err := ensureKubeletAPIEndpoint(node, client, endpoint); err != nil {
+			return fmt.Errorf("unable to point the kubelet of machine %q at %s: %v", node.Name, endpoint, err)
+		}
+	}
+	return ensureKubeProxyAPIEndpoint(endpoint)
+}
+
+// ensureKubeletAPIEndpoint points the kubeconfigs of the kubelet on the
+// machine at the endpoint, and restarts the kubelet if either changes.
+func ensureKubeletAPIEndpoint(machine *clusterv1.Machine, client sshmachine.Client, endpoint string) error {
+	var changed bool
+	for _, file := range []string{common.KubeletKubeconfig, common.KubeletBootstrapKubeconfig} {
+		current, err := readFileIfExists(client, file)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			continue
+		}
+		updated, fileChanged, err := apiendpoint.SetServer(current, endpoint)
+		if err != nil {
+			return fmt.Errorf("unable to update %q: %v", file, err)
+		}
+		if fileChanged {
+			if err := writeFileAsRoot(client, file, 0600, updated); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		log.Debugf("The kubelet of machine %q already uses %s", machine.Name, endpoint)
+		return nil
+	}
+	log.Printf("Pointed the kubelet of machine %q at %s", machine.Name, endpoint)
+	return restartService(common.KubeletService, client)
+}
+
+// ensureKubeProxyAPIEndpoint points the kubeconfig of kube-proxy at the
+// endpoint, and restarts the kube-proxy pods if it changes.
+func ensureKubeProxyAPIEndpoint(endpoint string) error {
+	masterMachine, masterProvisionedMachine, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return err
+	}
+	client, err := sshMachineClientFromSSHConfig(masterProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", masterMachine.Name, err)
+	}
+	kubectl := fmt.Sprintf("%s --kubeconfig=%s", common.KubectlFile, common.AdminKubeconfig)
+	cmd := fmt.Sprintf("%s get configmap %s -n%s -ojson", kubectl, kubeProxyConfigMapName, common.KubeSystemNamespace)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	var configMap corev1.ConfigMap
+	if err := json.Unmarshal(stdOut, &configMap); err != nil {
+		return fmt.Errorf("unable to decode configmap %q: %v", kubeProxyConfigMapName, err)
+	}
+	kubeconfig, ok := configMap.Data[kubeProxyKubeconfigKey]
+	if !ok {
+		log.Debugf("Configmap %q has no %q", kubeProxyConfigMapName, kubeProxyKubeconfigKey)
+		return nil
+	}
+	updated, changed, err := apiendpoint.SetServer([]byte(kubeconfig), endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to update configmap %q: %v", kubeProxyConfigMapName, err)
+	}
+	if !changed {
+		log.Debugf("kube-proxy already uses %s", endpoint)
+		return nil
+	}
+	configMap.Data[kubeProxyKubeconfigKey] = string(updated)
+	configMapJSON, err := json.Marshal(configMap)
+	if err != nil {
+		return fmt.Errorf("unable to encode configmap %q: %v", kubeProxyConfigMapName, err)
+	}
+	tmpPath := path.Join("/tmp", kubeProxyConfigMapName+".json")
+	if err := client.WriteFile(tmpPath, 0600, configMapJSON); err != nil {
+		return fmt.Errorf("unable to write %q: %v", tmpPath, err)
+	}
+	defer client.RemoveFile(tmpPath)
+	for _, cmd := range []string{
+		fmt.Sprintf("%s replace -f %s", kubectl, tmpPath),
+		fmt.Sprintf("%s -n%s delete pods -l k8s-app=%s", kubectl, common.KubeSystemNamespace, kubeProxyConfigMapName),
+	} {
+		stdOut, stdErr, err := client.RunCommand(cmd)
+		if err != nil {
+			return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		}
+	}
+	log.Printf("Pointed kube-proxy at %s", endpoint)
+	return nil
+}
+
+// syncNewMachineAPIEndpoint runs the control plane hook for a new master, or
+// points the kubelet of a new node at the endpoint of the hook, if any.
+func syncNewMachineAPIEndpoint(cluster *clusterv1.Cluster, machine *clusterv1.Machine) error {
+	if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+		return syncControlPlaneEndpoints(cluster, apiendpoint.ActionAdded, machine.Name)
+	}
+	hook, ok, err := controlPlaneHook(cluster)
+	if err != nil || !ok || len(hook.Endpoint) == 0 {
+		return err
+	}
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	return ensureKubeletAPIEndpoint(machine, client, hook.Endpoint)
+}
+
+// kubeconfigPolicyFlags are the flags of update cluster that configure the
+// kubeconfig policy.
+var kubeconfigPolicyFlags = []string{"kubeconfig-endpoint", "kubeconfig-site-label", "kubeconfig-site-endpoints"}
+
+// setKubeconfigPolicy records the kubeconfig policy flags given to the
+// command in the cluster. Flags not given keep their recorded value, and an
+// empty flag removes it. The policy is removed when it has no settings left.
+func setKubeconfigPolicy(cmd *cobra.Command, cluster *clusterv1.Cluster) error {
+	policy, err := kubeconfigPolicy(cluster)
+	if err != nil {
+		return err
+	}
+	if cmd.Flag("kubeconfig-endpoint").Changed {
+		policy.Default = cmd.Flag("kubeconfig-endpoint").Value.String()
+	}
+	if cmd.Flag("kubeconfig-site-label").Changed {
+		policy.SiteLabel = cmd.Flag("kubeconfig-site-label").Value.String()
+	}
+	if cmd.Flag("kubeconfig-site-endpoints").Changed {
+		pairs, err := cmd.Flags().GetStringSlice("kubeconfig-site-endpoints")
+		if err != nil {
+			return fmt.Errorf("unable to parse `kubeconfig-site-endpoints`: %v", err)
+		}
+		if policy.Sites, err = apiendpoint.ParseSites(pairs); err != nil {
+			return err
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	if len(policy.Default) == 0 && len(policy.SiteLabel) == 0 && len(policy.Sites) == 0 {
+		delete(cluster.Annotations, common.KubeconfigPolicyAnnotationKey)
+		return nil
+	}
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("unable to encode kubeconfig policy: %v", err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[common.KubeconfigPolicyAnnotationKey] = string(policyJSON)
+	return nil
+}
+
+// kubeconfigPolicy returns the kubeconfig policy recorded in the cluster.
+func kubeconfigPolicy(cluster *clusterv1.Cluster) (apiendpoint.KubeconfigPolicy, error) {
+	var policy apiendpoint.KubeconfigPolicy
+	value, ok := cluster.Annotations[common.KubeconfigPolicyAnnotationKey]
+	if !ok {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return policy, fmt.Errorf("unable to decode kubeconfig policy: %v", err)
+	}
+	return policy, nil
+}
+
+// adminKubeconfigForMachine returns the admin kubeconfig with its server set
+// for the machine by the kubeconfig policy of the cluster. masterPM is the
+// master the kubeconfig is copied from.
+func adminKubeconfigForMachine(kubeconfig []byte, machine *clusterv1.Machine, masterPM *spv1.ProvisionedMachine) ([]byte, error) {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get cluster: %v", err)
+	}
+	policy, err := kubeconfigPolicy(cluster)
+	if err != nil {
+		return nil, err
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	port := strconv.Itoa(common.DefaultAPIServerPort)
+	var vip string
+	if clusterSpec.VIPConfiguration != nil {
+		vip = net.JoinHostPort(clusterSpec.VIPConfiguration.IP, port)
+	}
+	dns, err := dnsAPIEndpoint(cluster)
+	if err != nil {
+		return nil, err
+	}
+	master := net.JoinHostPort(masterPM.Spec.SSHConfig.Host, port)
+	endpoint, err := policy.Endpoint(machine.Spec.Labels, vip, dns, master)
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoint) == 0 {
+		return kubeconfig, nil
+	}
+	kubeconfig, _, err = apiendpoint.SetServer(kubeconfig, endpoint)
+	return kubeconfig, err
+}
+
+// ensureAdminKubeconfigs rewrites the admin kubeconfig of every node whose
+// server differs from the one chosen by the kubeconfig policy of the cluster.
+func ensureAdminKubeconfigs() error {
+	_, masterPM, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return fmt.Errorf("unable to get a master machine and provisioned machine: %v", err)
+	}
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultAdminConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get secret %q: %v", common.DefaultAdminConfigSecretName, err)
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	for i := range machineList.Items {
+		node := &machineList.Items[i]
+		if !clusterutil.RoleContains(clustercommon.NodeRole, node.Spec.Roles) {
+			continue
+		}
+		kubeconfig, err := adminKubeconfigForMachine(secret.Data[common.DefaultAdminConfigSecretKey], node, masterPM)
+		if err != nil {
+			return fmt.Errorf("unable to choose the admin kubeconfig server of machine %q: %v", node.Name, err)
+		}
+		client, err := machineClientForMachine(node)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client for machine %q: %v", node.Name, err)
+		}
+		current, err := readFileIfExists(client, common.AdminKubeconfig)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(current, kubeconfig) {
+			continue
+		}
+		log.Printf("Updating the admin kubeconfig of machine %q", node.Name)
+		if err := writeFileAsRoot(client, common.AdminKubeconfig, 0600, kubeconfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/csr"
+)
+
+// approveCmd represents the approve command
+var approveCmd = &cobra.Command{
+	Use:   "approve",
+	Short: "Used to approve requests made by the cluster",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Approve called")
+	},
+}
+
+// csrDecision is the outcome of checking a pending kubelet serving CSR.
+type csrDecision struct {
+	Name     string
+	Node     string
+	Decision string
+	Reason   string
+}
+
+var csrCmdApprove = &cobra.Command{
+	Use:   "csr",
+	Short: "Approve pending kubelet serving certificate requests from machines in the state",
+	Long: `Approve pending kubelet serving certificate signing requests (CSRs). A CSR is
+approved only if it was created by the node of a machine in the state, and
+every subject alternative name in it is one of the node's addresses.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Fatalf("Unable to parse --dry-run: %v", err)
+		}
+		_, pm, err := masterMachineAndProvisionedMachine()
+		if err != nil {
+			log.Fatalf("Unable to get master machine: %v", err)
+		}
+		masterClient, err := sshMachineClientFromSSHConfig(pm.Spec.SSHConfig)
+		if err != nil {
+			log.Fatalf("Unable to create master client: %v", err)
+		}
+		decisions, err := approveKubeletServingCSRs(masterClient, dryRun)
+		if err != nil {
+			log.Fatalf("Unable to approve CSRs: %v", err)
+		}
+		if len(decisions) == 0 {
+			log.Println("No pending kubelet serving CSRs found")
+			return
+		}
+		t := template.Must(template.New("CSRApprovalPrintTemplate").Parse(common.CSRApprovalPrintTemplate))
+		if err := t.Execute(os.Stdout, decisions); err != nil {
+			log.Fatalf("Could not pretty print CSRs: %s", err)
+		}
+	},
+}
+
+// approveKubeletServingCSRs approves every pending kubelet serving CSR
+// created by the node of a machine in the state. If dryRun is true, no CSR is
+// approved.
+func approveKubeletServingCSRs(masterClient sshmachine.Client, dryRun bool) ([]csrDecision, error) {
+	cmd := fmt.Sprintf("%s --kubeconfig=%s get csr -ojson", common.KubectlFile, common.AdminKubeconfig)
+	stdOut, stdErr, err := masterClient.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	csrs, err := csr.ParseList(stdOut)
+	if err != nil {
+		return nil, err
+	}
+	nodeAddresses, err := managedNodeAddresses(masterClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var decisions []csrDecision
+	for i := range csrs {
+		c := &csrs[i]
+		if !c.IsPending() || !c.IsKubeletServing() {
+			continue
+		}
+		d := csrDecision{
+			Name:     c.Name(),
+			Node:     c.NodeName(),
+			Decision: "Skipped",
+		}
+		addresses, ok := nodeAddresses[c.NodeName()]
+		if !ok {
+			d.Reason = "node is not a machine in the state"
+			decisions = append(decisions, d)
+			continue
+		}
+		if err := c.Validate(addresses); err != nil {
+			d.Reason = err.Error()
+			decisions = append(decisions, d)
+			continue
+		}
+		if dryRun {
+			d.Decision = "Would approve"
+			decisions = append(decisions, d)
+			continue
+		}
+		cmd := fmt.Sprintf("%s --kubeconfig=%s certificate approve %s", common.KubectlFile, common.AdminKubeconfig, c.Name())
+		if stdOut, stdErr, err := masterClient.RunCommand(cmd); err != nil {
+			d.Decision = "Failed"
+			d.Reason = fmt.Sprintf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		} else {
+			d.Decision = "Approved"
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, nil
+}
+
+// managedNodeAddresses returns the addresses of every node whose addresses
+// include the IP of a machine in the state, keyed by node name.
+func managedNodeAddresses(masterClient sshmachine.Client) (map[string][]string, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	machineIPs := make(map[string]bool)
+	for _, m := range machineList.Items {
+		machineIPs[m.Name] = true
+	}
+	cmd := fmt.Sprintf(`%s --kubeconfig=%s get nodes -ojsonpath='{range .items[*]}{.metadata.name}{" "}{range .status.addresses[*]}{.address}{" "}{end}{"\n"}{end}'`, common.KubectlFile, common.AdminKubeconfig)
+	stdOut, stdErr, err := masterClient.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	nodeAddresses := make(map[string][]string)
+	for _, line := range strings.Split(string(stdOut), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, address := range fields[1:] {
+			if machineIPs[address] {
+				nodeAddresses[fields[0]] = fields[1:]
+				break
+			}
+		}
+	}
+	return nodeAddresses, nil
+}
+
+func init() {
+	rootCmd.AddCommand(approveCmd)
+	approveCmd.AddCommand(csrCmdApprove)
+	csrCmdApprove.Flags().Bool("dry-run", false, "List the CSRs that would be approved, without approving them")
+}
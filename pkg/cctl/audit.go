@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/audit"
+)
+
+// setAuditConfig records the audit policy read from the file, if given, and
+// the log rotation settings of the command in the cluster. The rotation
+// settings can only be changed for a cluster that has a policy.
+func setAuditConfig(cmd *cobra.Command, cluster *clusterv1.Cluster, policyFile string) error {
+	_, rotation, ok, err := auditConfig(cluster)
+	if err != nil {
+		return err
+	}
+	if len(policyFile) == 0 && !ok {
+		return fmt.Errorf("cluster has no audit policy; use --audit-policy to add one")
+	}
+	for flag, setting := range map[string]*int{
+		"audit-log-maxage":    &rotation.MaxAge,
+		"audit-log-maxbackup": &rotation.MaxBackup,
+		"audit-log-maxsize":   &rotation.MaxSize,
+	} {
+		// Settings not given keep their recorded value, or the default.
+		if !ok || cmd.Flag(flag).Changed {
+			if *setting, err = cmd.Flags().GetInt(flag); err != nil {
+				return fmt.Errorf("unable to parse %q: %v", flag, err)
+			}
+		}
+	}
+	if err := rotation.Validate(); err != nil {
+		return err
+	}
+	rotationJSON, err := json.Marshal(rotation)
+	if err != nil {
+		return fmt.Errorf("unable to encode audit log rotation settings: %v", err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	if len(policyFile) != 0 {
+		policy, err := ioutil.ReadFile(policyFile)
+		if err != nil {
+			return fmt.Errorf("unable to read %q: %v", policyFile, err)
+		}
+		if err := audit.ValidatePolicy(policy); err != nil {
+			return fmt.Errorf("%s is not a valid audit policy: %v", policyFile, err)
+		}
+		cluster.Annotations[common.AuditPolicyAnnotationKey] = string(policy)
+	}
+	cluster.Annotations[common.AuditLogRotationAnnotationKey] = string(rotationJSON)
+	return nil
+}
+
+// auditConfig returns the audit policy and log rotation settings recorded in
+// the cluster. It returns false if the cluster has no audit policy.
+func auditConfig(cluster *clusterv1.Cluster) ([]byte, audit.LogRotation, bool, error) {
+	rotation := audit.LogRotation{
+		MaxAge:    common.DefaultAuditLogMaxAge,
+		MaxBackup: common.DefaultAuditLogMaxBackup,
+		MaxSize:   common.DefaultAuditLogMaxSize,
+	}
+	policy, ok := cluster.Annotations[common.AuditPolicyAnnotationKey]
+	if !ok {
+		return nil, rotation, false, nil
+	}
+	if value, ok := cluster.Annotations[common.AuditLogRotationAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(value), &rotation); err != nil {
+			return nil, rotation, false, fmt.Errorf("unable to decode audit log rotation settings: %v", err)
+		}
+	}
+	return []byte(policy), rotation, true, nil
+}
+
+// ensureAuditConfig uploads the audit policy of the cluster to the master and
+// enables audit logging in the API server static pod manifest. If either
+// changes, it waits until the restarted API server is healthy.
+func ensureAuditConfig(cluster *clusterv1.Cluster, machineName string, client sshmachine.Client) error {
+	policy, rotation, ok, err := auditConfig(cluster)
+	if err != nil || !ok {
+		return err
+	}
+	if err := client.MkdirAll(audit.PolicyDir, 0755); err != nil {
+		return fmt.Errorf("unable to create %q: %v", audit.PolicyDir, err)
+	}
+	current, err := readFileIfExists(client, audit.PolicyFile)
+	if err != nil {
+		return err
+	}
+	policyChanged := !bytes.Equal(current, policy)
+	if policyChanged {
+		if err := writeFileAsRoot(client, audit.PolicyFile, 0600, policy); err != nil {
+			return err
+		}
+		log.Printf("Uploaded audit policy to machine %q", machineName)
+	}
+	manifest, err := client.ReadFile(apiServerManifestFile)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", apiServerManifestFile, err)
+	}
+	configured, manifestChanged, err := audit.ConfigureManifest(manifest, rotation)
+	if err != nil {
+		return fmt.Errorf("unable to configure %q: %v", apiServerManifestFile, err)
+	}
+	if !policyChanged && !manifestChanged {
+		log.Printf("Audit logging of machine %q is already configured", machineName)
+		return nil
+	}
+	log.Printf("Configured audit logging of machine %q", machineName)
+	return reloadAPIServer(client, configured, manifestChanged)
+}
+
+// writeFileAsRoot writes the file through a temporary file, because non root
+// users do not have permission to write to /etc directly. The temporary file
+// is created with mktemp, so that other users of the machine can neither
+// predict nor replace it, and is owned by the SSH user, who writes it over
+// SFTP, until it is moved into place and given to root.
+func writeFileAsRoot(client sshmachine.Client, filePath string, mode os.FileMode, data []byte) error {
+	cmd := "sh -c 'f=$(mktemp) && chown ${SUDO_UID:-$(id -u)} $f && echo $f'"
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	tmpPath := strings.TrimSpace(string(stdOut))
+	if !path.IsAbs(tmpPath) {
+		return fmt.Errorf("unable to parse temporary file from %q", string(stdOut))
+	}
+	if err := client.WriteFile(tmpPath, mode, data); err != nil {
+		client.RemoveFile(tmpPath)
+		return fmt.Errorf("unable to write %q: %v", tmpPath, err)
+	}
+	cmd = fmt.Sprintf("sh -c 'chown 0:0 %s && mv -f %s %s'", tmpPath, tmpPath, filePath)
+	if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+		client.RemoveFile(tmpPath)
+		return fmt.Errorf("unable to move %q to %q: error running %q: %v (stdout: %q, stderr: %q)", tmpPath, filePath, cmd, err, string(stdOut), string(stdErr))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// addBastionFlags adds the flags that configure the bastion.
+func addBastionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("bastion", "", "Address, as ip[:port], of a jump host used to SSH to machines. Its SSH credential is created with 'create credential --bastion'")
+	cmd.Flags().StringSlice("bastion-public-keys", []string{}, "The bastion's SSH public keys. Provide a comma-separated list, or define multiple flags.")
+}
+
+// setBastion records the bastion flags given to the command in the cluster.
+// Public keys not given are kept only if the address does not change. An
+// empty address removes the bastion.
+func setBastion(cmd *cobra.Command, cluster *clusterv1.Cluster) error {
+	bastion, ok := cluster.Annotations[common.BastionAnnotationKey]
+	if cmd.Flag("bastion").Changed {
+		if newBastion := cmd.Flag("bastion").Value.String(); newBastion != bastion {
+			bastion = newBastion
+			delete(cluster.Annotations, common.BastionPublicKeysAnnotationKey)
+		}
+	} else if !ok {
+		return fmt.Errorf("cluster has no bastion. Use --bastion to add one")
+	}
+	if len(bastion) == 0 {
+		if cmd.Flag("bastion-public-keys").Changed {
+			return fmt.Errorf("--bastion-public-keys requires --bastion")
+		}
+		delete(cluster.Annotations, common.BastionAnnotationKey)
+		delete(cluster.Annotations, common.BastionPublicKeysAnnotationKey)
+		return nil
+	}
+	if _, _, err := sshutil.ParseHostPort(bastion, common.DefaultSSHPort); err != nil {
+		return fmt.Errorf("the --bastion %s must be of the form ip[:port]: %v", bastion, err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[common.BastionAnnotationKey] = bastion
+	if !cmd.Flag("bastion-public-keys").Changed {
+		return nil
+	}
+	bastionPublicKeyFiles, err := cmd.Flags().GetStringSlice("bastion-public-keys")
+	if err != nil {
+		return fmt.Errorf("unable to parse `bastion-public-keys`: %v", err)
+	}
+	var bastionPublicKeys []string
+	for _, file := range bastionPublicKeyFiles {
+		publicKey, err := sshutil.PublicKeyFromFile(file)
+		if err != nil {
+			return fmt.Errorf("unable to parse SSH public key from %q: %v", file, err)
+		}
+		bastionPublicKeys = append(bastionPublicKeys, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))))
+	}
+	if len(bastionPublicKeys) == 0 {
+		delete(cluster.Annotations, common.BastionPublicKeysAnnotationKey)
+		return nil
+	}
+	cluster.Annotations[common.BastionPublicKeysAnnotationKey] = strings.Join(bastionPublicKeys, "\n")
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/pki"
+)
+
+// caRequest is a CA certificate that create ca-requests asks an external CA
+// to sign.
+type caRequest struct {
+	// name is the file name of the request and key, without extension, and
+	// the prefix of the create cluster flags that take the signed CA.
+	name       string
+	commonName string
+}
+
+var caRequests = []caRequest{
+	{name: "apiserver-ca", commonName: "kubernetes"},
+	{name: "etcd-ca", commonName: "etcd-ca"},
+	{name: "front-proxy-ca", commonName: "front-proxy-ca"},
+}
+
+var caRequestsCmdCreate = &cobra.Command{
+	Use:   "ca-requests",
+	Short: "Create requests for an external CA to sign the cluster CAs",
+	Long: `Create a private key and a certificate signing request for each of the API
+server, etcd, and front proxy CAs, for an external CA to sign as intermediate
+CAs. The key of the external CA is never given to cctl.
+
+For each CA, <name>.csr and <name>.key are written to --dir. Sign each request
+as a CA certificate, append the certificates of the signing CAs to it, and
+pass it, with the key, to create cluster, e.g.
+
+  cctl create cluster --apiserver-ca-cert apiserver-ca.crt --apiserver-ca-key apiserver-ca.key ...
+
+The state is not changed. Existing files are not overwritten.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := cmd.Flag("dir").Value.String()
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			log.Fatalf("Unable to create directory %q: %v", dir, err)
+		}
+		for _, r := range caRequests {
+			if err := writeCARequest(dir, r); err != nil {
+				log.Fatalf("Unable to create %s request: %v", r.name, err)
+			}
+			log.Printf("Wrote %s request and key to %q", r.name, dir)
+		}
+	},
+}
+
+// writeCARequest writes the request and key of the CA to the directory. The
+// key is readable only by the user.
+func writeCARequest(dir string, r caRequest) error {
+	csrFile := filepath.Join(dir, r.name+".csr")
+	keyFile := filepath.Join(dir, r.name+".key")
+	for _, file := range []string{csrFile, keyFile} {
+		if _, err := os.Stat(file); err == nil {
+			return fmt.Errorf("file %q already exists", file)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("unable to check file %q: %v", file, err)
+		}
+	}
+	csrPEM, keyPEM, err := pki.NewCARequest(r.commonName)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return fmt.Errorf("unable to write key %q: %v", keyFile, err)
+	}
+	if err := ioutil.WriteFile(csrFile, csrPEM, 0644); err != nil {
+		return fmt.Errorf("unable to write request %q: %v", csrFile, err)
+	}
+	return nil
+}
+
+func init() {
+	createCmd.AddCommand(caRequestsCmdCreate)
+	caRequestsCmdCreate.Flags().String("dir", ".", "Directory to write the requests and keys to")
+}
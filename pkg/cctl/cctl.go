@@ -0,0 +1,245 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cctl implements the cctl commands, and runs cctl operations from Go
+// programs, instead of running the cctl binary. Every operation opens the
+// state file, holding its lock, runs, and closes the state, like an
+// invocation of the binary. Operations run one at a time in a process.
+//
+// When the context of an operation is done, the commands it runs on machines
+// are stopped, and the operation fails at its next step, as when the binary
+// is interrupted. The state records the steps that completed, so that the
+// operation can be run again.
+package cctl
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/operror"
+)
+
+// ErrorKind is why an operation failed.
+type ErrorKind = operror.Kind
+
+const (
+	// KindUnknown is the kind of errors that are not classified, e.g. a
+	// command failed on a machine.
+	KindUnknown = operror.Unknown
+	// KindNotFound means an object the operation needs, e.g. the cluster or
+	// the machine, is not in the state.
+	KindNotFound = operror.NotFound
+	// KindInvalid means the options of the operation are not valid.
+	KindInvalid = operror.Invalid
+	// KindPrecondition means the cluster is not in a state that allows the
+	// operation, e.g. deleting a master would lose etcd quorum.
+	KindPrecondition = operror.Precondition
+)
+
+// OperationError is returned when an operation fails.
+type OperationError struct {
+	Operation string
+	Kind      ErrorKind
+	Err       error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Operation, e.Err)
+}
+
+// KindOf returns the kind of an error returned by an operation, or
+// KindUnknown.
+func KindOf(err error) ErrorKind {
+	if e, ok := err.(*OperationError); ok {
+		return e.Kind
+	}
+	return KindUnknown
+}
+
+// StateOptions locates the state and configures how it is used. The zero
+// value uses the defaults of the cctl binary.
+type StateOptions struct {
+	// StateFile is the path of the state file.
+	StateFile string
+	// Namespace is the namespace of the cluster objects in the state.
+	Namespace string
+	// RemoteTimeout is how long a kubeadm, etcdadm, nodeadm, or kubectl
+	// invocation on a machine may run. Negative means unlimited.
+	RemoteTimeout time.Duration
+}
+
+func (o StateOptions) withDefaults() StateOptions {
+	if len(o.StateFile) == 0 {
+		o.StateFile = common.DefaultStateFilename
+	}
+	if len(o.Namespace) == 0 {
+		o.Namespace = common.DefaultNamespace
+	}
+	switch {
+	case o.RemoteTimeout == 0:
+		o.RemoteTimeout = common.DefaultRemoteCommandTimeout
+	case o.RemoteTimeout < 0:
+		o.RemoteTimeout = 0
+	}
+	return o
+}
+
+// CreateMachineOptions are the options of CreateMachine.
+type CreateMachineOptions struct {
+	StateOptions
+	// IP is the address of the machine, and its name.
+	IP string
+	// Port is the SSH port of the machine. Zero means 22.
+	Port int
+	// Role is either "master" or "node".
+	Role string
+	// Iface is the network interface the virtual IP is bound to on masters,
+	// or a comma-separated list of candidates. Empty means eth0.
+	Iface string
+	// PublicKeyFiles are files with the SSH host public keys of the machine.
+	// If none are given, the identity of the machine is not verified.
+	PublicKeyFiles []string
+}
+
+// DeleteMachineOptions are the options of DeleteMachine.
+type DeleteMachineOptions struct {
+	StateOptions
+	// IPs are the machines to delete. Several machines are deleted in an
+	// order that keeps the cluster available.
+	IPs []string
+	// Force removes the machines from the state without running commands on
+	// them.
+	Force bool
+	// SkipDrainDelete does not drain and delete the nodes of the machines.
+	SkipDrainDelete bool
+}
+
+// RecoverEtcdOptions are the options of RecoverEtcd.
+type RecoverEtcdOptions struct {
+	StateOptions
+	// Snapshot is the path of the local etcd snapshot file.
+	Snapshot string
+}
+
+// mu serializes operations, which share the state and options kept in
+// package variables by the commands.
+var mu sync.Mutex
+
+// run opens the state, runs the operation, and closes the state. The
+// commands the operation runs on machines are bound to the context.
+func run(ctx context.Context, operation string, opts StateOptions, f func() error) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	opts = opts.withDefaults()
+	stateFilename = opts.StateFile
+	namespace = opts.Namespace
+	remoteTimeout = opts.RemoteTimeout
+	readOnly = false
+	interruptStopsCommands = false
+	previousContext := commandContext
+	commandContext = ctx
+	defer func() {
+		commandContext = previousContext
+	}()
+	// A state file in a repository is pulled to its clone.
+	gitState = nil
+	if err := openGitState(); err != nil {
+		return &OperationError{Operation: operation, Kind: KindUnknown, Err: err}
+	}
+	// Like a command that can change the cluster, the operation holds the
+	// operation lease, so that operators do not change the cluster at once.
+	subject := "pkg/cctl: " + operation
+	if err := takeOperationLease(subject); err != nil {
+		return &OperationError{Operation: operation, Kind: operror.KindOf(err), Err: err}
+	}
+	defer releaseOperationLease()
+	if err := openState(); err != nil {
+		return &OperationError{Operation: operation, Kind: KindUnknown, Err: err}
+	}
+	defer closeState()
+	defer closeMachineClients()
+	err := f()
+	// The state is pushed even if the operation failed, because it may have
+	// changed the state before it failed.
+	if pushErr := pushGitState(operationCommitMessage(subject, nil, err != nil)); pushErr != nil {
+		if err == nil {
+			return &OperationError{Operation: operation, Kind: KindUnknown, Err: fmt.Errorf("unable to push the state: %v", pushErr)}
+		}
+		log.Errorf("Unable to push the state: %v", pushErr)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = fmt.Errorf("%v: %v", ctxErr, err)
+		}
+		return &OperationError{Operation: operation, Kind: operror.KindOf(err), Err: err}
+	}
+	return nil
+}
+
+// closeState releases the lock on the state file. Files cached from machines
+// are forgotten, because they can change before the state is opened again.
+func closeState() {
+	unlockState()
+	state = nil
+	remoteReadCache = nil
+}
+
+// CreateMachine creates a machine and adds it to the cluster. Unlike the
+// binary, it does not check the hardware of masters.
+func CreateMachine(ctx context.Context, opts CreateMachineOptions) error {
+	return run(ctx, "create machine", opts.StateOptions, func() error {
+		if len(opts.IP) == 0 {
+			return operror.New(operror.Invalid, "no IP given")
+		}
+		port := opts.Port
+		if port == 0 {
+			port = common.DefaultSSHPort
+		}
+		iface := opts.Iface
+		if len(iface) == 0 {
+			iface = common.DefaultVIPNetworkInterface
+		}
+		return createMachine(opts.IP, port, iface, strings.Title(opts.Role), opts.PublicKeyFiles)
+	})
+}
+
+// DeleteMachine deletes machines from the cluster.
+func DeleteMachine(ctx context.Context, opts DeleteMachineOptions) error {
+	return run(ctx, "delete machine", opts.StateOptions, func() error {
+		switch len(opts.IPs) {
+		case 0:
+			return operror.New(operror.Invalid, "no machines to delete")
+		case 1:
+			return deleteMachine(opts.IPs[0], opts.Force, opts.SkipDrainDelete)
+		}
+		return deleteMachines(opts.IPs, opts.Force, opts.SkipDrainDelete)
+	})
+}
+
+// RecoverEtcd recovers the etcd cluster on every master from a snapshot.
+func RecoverEtcd(ctx context.Context, opts RecoverEtcdOptions) error {
+	return run(ctx, "recover etcd", opts.StateOptions, func() error {
+		return recoverEtcdFromSnapshot(opts.Snapshot)
+	})
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/lease"
+)
+
+func TestOperationErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cctl")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	state := StateOptions{StateFile: filepath.Join(dir, "state.yaml")}
+
+	tests := []struct {
+		name string
+		run  func() error
+		kind ErrorKind
+	}{
+		{
+			name: "invalid role",
+			run: func() error {
+				return CreateMachine(context.Background(), CreateMachineOptions{StateOptions: state, IP: "10.0.0.1", Role: "worker"})
+			},
+			kind: KindInvalid,
+		},
+		{
+			name: "no credential",
+			run: func() error {
+				return CreateMachine(context.Background(), CreateMachineOptions{StateOptions: state, IP: "10.0.0.1", Role: "node"})
+			},
+			kind: KindNotFound,
+		},
+		{
+			name: "no machines",
+			run: func() error {
+				return DeleteMachine(context.Background(), DeleteMachineOptions{StateOptions: state})
+			},
+			kind: KindInvalid,
+		},
+		{
+			name: "missing machine",
+			run: func() error {
+				return DeleteMachine(context.Background(), DeleteMachineOptions{StateOptions: state, IPs: []string{"10.0.0.1"}})
+			},
+			kind: KindNotFound,
+		},
+		{
+			name: "missing snapshot",
+			run: func() error {
+				return RecoverEtcd(context.Background(), RecoverEtcdOptions{StateOptions: state, Snapshot: filepath.Join(dir, "snapshot.db")})
+			},
+			kind: KindInvalid,
+		},
+	}
+	for _, test := range tests {
+		err := test.run()
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+			continue
+		}
+		if KindOf(err) != test.kind {
+			t.Errorf("%s: expected kind %q, found %q (%v)", test.name, test.kind, KindOf(err), err)
+		}
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := DeleteMachine(ctx, DeleteMachineOptions{StateOptions: StateOptions{StateFile: "/nonexistent/state.yaml"}, IPs: []string{"10.0.0.1"}})
+	if err != context.Canceled {
+		t.Errorf("expected %v, found %v", context.Canceled, err)
+	}
+}
+
+func TestContextCanceledDuringOperation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cctl")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	state := StateOptions{StateFile: filepath.Join(dir, "state.yaml")}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = run(ctx, "test", state, func() error {
+		cancel()
+		// Commands on machines are bound to commandContext.
+		if commandContext.Err() == nil {
+			t.Errorf("expected the commands of the operation to be stopped")
+		}
+		return errors.New("command stopped")
+	})
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("expected the error to say the context was canceled, found %v", err)
+	}
+	if commandContext.Err() != nil {
+		t.Errorf("expected the context of commands to be restored after the operation")
+	}
+}
+
+func TestOperationLeaseHeld(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cctl")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	state := StateOptions{StateFile: filepath.Join(dir, "state.yaml")}
+
+	path := state.StateFile + "." + common.DefaultNamespace + common.OperationLeaseFileSuffix
+	h, _, err := lease.Acquire(path, "operator@host", "cctl delete machine", time.Minute)
+	if err != nil {
+		t.Fatalf("unable to acquire lease: %v", err)
+	}
+	err = DeleteMachine(context.Background(), DeleteMachineOptions{StateOptions: state, IPs: []string{"10.0.0.1"}})
+	if KindOf(err) != KindPrecondition {
+		t.Errorf("expected kind %q, found %q (%v)", KindPrecondition, KindOf(err), err)
+	}
+	if err := h.Release(); err != nil {
+		t.Fatalf("unable to release lease: %v", err)
+	}
+	err = DeleteMachine(context.Background(), DeleteMachineOptions{StateOptions: state, IPs: []string{"10.0.0.1"}})
+	if KindOf(err) != KindNotFound {
+		t.Errorf("expected kind %q, found %q (%v)", KindNotFound, KindOf(err), err)
+	}
+	if l, err := lease.Read(path); err != nil || l != nil {
+		t.Errorf("expected the lease to be released after the operation, found %v, %v", l, err)
+	}
+}
+
+func TestOperationPushesGitState(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for k, v := range map[string]string{"GIT_AUTHOR_NAME": "test", "GIT_AUTHOR_EMAIL": "test@example.com", "GIT_COMMITTER_NAME": "test", "GIT_COMMITTER_EMAIL": "test@example.com"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+	dir, err := ioutil.TempDir("", "cctl")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bare := filepath.Join(dir, "clusters.git")
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", bare).CombinedOutput(); err != nil {
+		t.Fatalf("unable to create repository: %v: %s", err, out)
+	}
+	defer func(parent string) { gitStateParentDir = parent }(gitStateParentDir)
+	gitStateParentDir = filepath.Join(dir, "clones")
+	opts := StateOptions{StateFile: "file://" + bare + "//prod/state.yaml"}
+
+	for i, failed := range []bool{false, true} {
+		err := run(context.Background(), "test", opts, func() error {
+			if err := ioutil.WriteFile(stateFilename, []byte(fmt.Sprintf("# change %d\n", i)), 0600); err != nil {
+				return err
+			}
+			if failed {
+				return errors.New("failed after changing the state")
+			}
+			return nil
+		})
+		if (err != nil) != failed {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	out, err := exec.Command("git", "--git-dir", bare, "log", "--format=%s%n%b").CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to read log: %v: %s", err, out)
+	}
+	for _, expected := range []string{"pkg/cctl: test", "Result: succeeded", "Result: failed"} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected the pushed commits to contain %q, found:\n%s", expected, out)
+		}
+	}
+}
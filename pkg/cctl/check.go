@@ -0,0 +1,379 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/capacity"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/hardware"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Used to check that a resource meets requirements",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Check called")
+	},
+}
+
+// hardwareThresholds are the requirements a machine must meet.
+type hardwareThresholds struct {
+	maxFsyncLatency time.Duration
+	maxNetworkRTT   time.Duration
+	minCPUs         int64
+	minMemoryGiB    int64
+	diskDir         string
+	fioSize         string
+	pingTargets     []string
+}
+
+func defaultHardwareThresholds() hardwareThresholds {
+	return hardwareThresholds{
+		maxFsyncLatency: common.DefaultMaxFsyncLatency,
+		maxNetworkRTT:   common.DefaultMaxNetworkRTT,
+		minCPUs:         common.DefaultMinCPUs,
+		minMemoryGiB:    common.DefaultMinMemoryGiB,
+		diskDir:         "/var/lib",
+		fioSize:         "22m",
+	}
+}
+
+var hardwareCmdCheck = &cobra.Command{
+	Use:   "hardware",
+	Short: "Benchmark the disk, memory, and network of a machine",
+	Long: `Benchmark the disk, memory, and network of a machine, and compare the results
+against thresholds. The disk check measures the fdatasync latency that etcd
+depends on, using fio, which must be installed on the machine. The machine need
+not be in the state; if it is not, it is reached using the SSH credential.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		if len(ip) == 0 {
+			log.Fatalf("Must give --ip.")
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Unable to parse `port` flag: %v", err)
+		}
+		publicKeyFiles, err := cmd.Flags().GetStringSlice("public-keys")
+		if err != nil {
+			log.Fatalf("Unable to parse `public-keys` flag: %v", err)
+		}
+		t := defaultHardwareThresholds()
+		if t.maxFsyncLatency, err = cmd.Flags().GetDuration("max-fsync-latency"); err != nil {
+			log.Fatalf("Unable to parse `max-fsync-latency` flag: %v", err)
+		}
+		if t.maxNetworkRTT, err = cmd.Flags().GetDuration("max-network-rtt"); err != nil {
+			log.Fatalf("Unable to parse `max-network-rtt` flag: %v", err)
+		}
+		if t.minCPUs, err = cmd.Flags().GetInt64("min-cpus"); err != nil {
+			log.Fatalf("Unable to parse `min-cpus` flag: %v", err)
+		}
+		if t.minMemoryGiB, err = cmd.Flags().GetInt64("min-memory-gib"); err != nil {
+			log.Fatalf("Unable to parse `min-memory-gib` flag: %v", err)
+		}
+		t.diskDir = cmd.Flag("disk-dir").Value.String()
+		if t.pingTargets, err = cmd.Flags().GetStringSlice("ping"); err != nil {
+			log.Fatalf("Unable to parse `ping` flag: %v", err)
+		}
+		if !cmd.Flags().Changed("ping") {
+			if t.pingTargets, err = otherMasterIPs(ip); err != nil {
+				log.Fatalf("Unable to list masters: %v", err)
+			}
+		}
+
+		client, err := hardwareCheckClient(ip, port, publicKeyFiles)
+		if err != nil {
+			log.Fatalf("Unable to create machine client for %q: %v", ip, err)
+		}
+		results := checkHardware(client, t)
+		tmpl := template.Must(template.New("HardwareCheckPrintTemplate").Parse(common.HardwareCheckPrintTemplate))
+		if err := tmpl.Execute(os.Stdout, results); err != nil {
+			log.Fatalf("Could not pretty print hardware checks: %s", err)
+		}
+		if !hardware.Passed(results) {
+			log.Fatalf("Machine %q does not meet the hardware requirements", ip)
+		}
+	},
+}
+
+// hardwareCheckClient returns a client for the machine in the state, or, if
+// the machine is not in the state, a client that uses the SSH credential.
+func hardwareCheckClient(ip string, port int, publicKeyFiles []string) (sshmachine.Client, error) {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err == nil {
+		return machineClientForMachine(machine)
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	var publicKeys []string
+	for _, file := range publicKeyFiles {
+		publicKey, err := sshutil.PublicKeyFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse SSH public key from %q: %v", file, err)
+		}
+		publicKeys = append(publicKeys, string(ssh.MarshalAuthorizedKey(publicKey)))
+	}
+	return sshMachineClientFromSSHConfig(&spv1.SSHConfig{
+		Host:       ip,
+		Port:       port,
+		PublicKeys: publicKeys,
+		CredentialSecret: corev1.LocalObjectReference{
+			Name: common.DefaultSSHCredentialSecretName,
+		},
+	})
+}
+
+// otherMasterIPs returns the IPs of the masters in the state, other than ip.
+func otherMasterIPs(ip string) ([]string, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, m := range clusterapi.MachinesWithRole(machineList.Items, clustercommon.MasterRole) {
+		if m.Name != ip {
+			ips = append(ips, m.Name)
+		}
+	}
+	return ips, nil
+}
+
+// checkHardware runs the benchmarks on the machine.
+func checkHardware(client sshmachine.Client, t hardwareThresholds) []hardware.Result {
+	var results []hardware.Result
+
+	log.Println("[check] Counting CPUs")
+	cpus, err := remoteInt(client, "nproc")
+	results = append(results, hardware.MinInt("CPUs", cpus, t.minCPUs, "", err))
+
+	log.Println("[check] Reading memory")
+	var memoryGiB int64
+	stdOut, err := remoteOutput(client, "cat /proc/meminfo")
+	if err == nil {
+		var total int64
+		if total, err = hardware.MemTotal(stdOut); err == nil {
+			memoryGiB = total / (1024 * 1024 * 1024)
+		}
+	}
+	results = append(results, hardware.MinInt("Memory", memoryGiB, t.minMemoryGiB, "GiB", err))
+
+	log.Printf("[check] Measuring fdatasync latency in %s", t.diskDir)
+	p99, err := fdatasyncLatency(client, t.diskDir, t.fioSize)
+	results = append(results, hardware.MaxDuration("Disk fdatasync latency (p99)", p99, t.maxFsyncLatency, err))
+
+	for _, target := range t.pingTargets {
+		log.Printf("[check] Measuring round-trip time to %s", target)
+		var rtt time.Duration
+		stdOut, err := remoteOutput(client, fmt.Sprintf("ping -c 5 -q %s", target))
+		if err == nil {
+			rtt, err = hardware.PingAverage(stdOut)
+		}
+		results = append(results, hardware.MaxDuration(fmt.Sprintf("Network RTT to %s", target), rtt, t.maxNetworkRTT, err))
+	}
+	return results
+}
+
+// fdatasyncLatency runs fio with the write pattern of the etcd write-ahead
+// log, and returns the 99th percentile fdatasync latency.
+func fdatasyncLatency(client sshmachine.Client, dir, size string) (time.Duration, error) {
+	testDir := path.Join(dir, fmt.Sprintf("cctl-hardware-check-%s", uuid.NewV4().String()))
+	if err := client.MkdirAll(testDir, 0700); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if _, err := remoteOutput(client, fmt.Sprintf("rm -rf %s", testDir)); err != nil {
+			log.Warnf("Unable to remove %q: %v", testDir, err)
+		}
+	}()
+	stdOut, err := remoteOutput(client, fmt.Sprintf("fio --rw=write --ioengine=sync --fdatasync=1 --directory=%s --size=%s --bs=2300 --name=etcd-wal --output-format=json", testDir, size))
+	if err != nil {
+		return 0, fmt.Errorf("%v (is fio installed?)", err)
+	}
+	return hardware.FioSyncP99(stdOut)
+}
+
+func remoteOutput(client sshmachine.Client, cmd string) ([]byte, error) {
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return stdOut, nil
+}
+
+func remoteInt(client sshmachine.Client, cmd string) (int64, error) {
+	stdOut, err := remoteOutput(client, cmd)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(stdOut)), 10, 64)
+}
+
+// mustPassHardwareCheck runs the hardware checks, with the default
+// thresholds, on a machine that is about to become a master.
+func mustPassHardwareCheck(ip string, port int, publicKeyFiles []string) {
+	client, err := hardwareCheckClient(ip, port, publicKeyFiles)
+	if err != nil {
+		log.Fatalf("Unable to create machine client for %q: %v", ip, err)
+	}
+	t := defaultHardwareThresholds()
+	if t.pingTargets, err = otherMasterIPs(ip); err != nil {
+		log.Fatalf("Unable to list masters: %v", err)
+	}
+	results := checkHardware(client, t)
+	if hardware.Passed(results) {
+		return
+	}
+	tmpl := template.Must(template.New("HardwareCheckPrintTemplate").Parse(common.HardwareCheckPrintTemplate))
+	if err := tmpl.Execute(os.Stdout, results); err != nil {
+		log.Fatalf("Could not pretty print hardware checks: %s", err)
+	}
+	log.Fatalf("Not creating master %q: it does not meet the hardware requirements. Run `cctl check hardware` to use other thresholds.", ip)
+}
+
+// guardEtcdDiskLatency measures the fdatasync latency of the disk that will
+// hold the etcd data of a new master. Storage slower than maxLatency causes
+// constant leader elections, so the master is not created, unless ignore is
+// set. If the latency cannot be measured, e.g. because fio is not installed,
+// a warning is logged.
+func guardEtcdDiskLatency(ip string, port int, publicKeyFiles []string, maxLatency time.Duration, ignore bool) {
+	client, err := hardwareCheckClient(ip, port, publicKeyFiles)
+	if err != nil {
+		log.Fatalf("Unable to create machine client for %q: %v", ip, err)
+	}
+	dir := etcdDiskDir(client)
+	log.Printf("[pre-flight] Measuring fdatasync latency in %s", dir)
+	p99, err := fdatasyncLatency(client, dir, defaultHardwareThresholds().fioSize)
+	switch {
+	case err != nil:
+		log.Warnf("[pre-flight] Unable to measure the etcd disk latency of %q: %v", ip, err)
+	case p99 <= maxLatency:
+		log.Printf("[pre-flight] etcd disk fdatasync latency (p99) is %s", p99)
+	case ignore:
+		log.Warnf("[pre-flight] etcd disk fdatasync latency (p99) of %q is %s, above %s. Continuing, because --ignore-etcd-disk-latency is set.", ip, p99, maxLatency)
+	default:
+		log.Fatalf("Not creating master %q: its etcd disk fdatasync latency (p99) is %s, above %s. Use faster storage, raise --max-fsync-latency, or set --ignore-etcd-disk-latency.", ip, p99, maxLatency)
+	}
+}
+
+// guardPodNetworkCapacity checks that the pod CIDR of the cluster has a node
+// range for a new master or node. Warnings are logged if few ranges are left,
+// or if the kubelet maxPods is more than the addresses of a range. The machine
+// is not created if no range is left, because its node would get none.
+func guardPodNetworkCapacity(ip string) {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		log.Fatalf("Unable to get cluster: %v", err)
+	}
+	if len(cluster.Spec.ClusterNetwork.Pods.CIDRBlocks) == 0 {
+		log.Warnf("[pre-flight] Unable to check the pod network capacity: the cluster has no pod CIDR")
+		return
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		log.Fatalf("Unable to decode cluster spec: %v", err)
+	}
+	network := capacity.Network{PodCIDR: cluster.Spec.ClusterNetwork.Pods.CIDRBlocks[0]}
+	if clusterSpec.ClusterConfig != nil {
+		if network.NodeCIDRMaskSize, err = capacity.ParseNodeCIDRMaskSize(clusterSpec.ClusterConfig.KubeControllerManager[capacity.NodeCIDRMaskSizeArg]); err != nil {
+			log.Fatalf("Unable to check the pod network capacity: %v", err)
+		}
+		if clusterSpec.ClusterConfig.Kubelet != nil {
+			network.MaxPods = int(clusterSpec.ClusterConfig.Kubelet.MaxPods)
+		}
+	}
+	// The kubelet configuration of the machine overrides that of the cluster.
+	if maxPods, ok := newKubeletConfig["maxPods"].(float64); ok {
+		network.MaxPods = int(maxPods)
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		log.Fatalf("Unable to list machines: %v", err)
+	}
+	var nodes int
+	for _, m := range machineList.Items {
+		if m.Name != ip && clusterapi.HasNode(m) {
+			nodes++
+		}
+	}
+	report, err := capacity.Check(network, nodes, 1)
+	if err != nil {
+		log.Fatalf("Unable to check the pod network capacity: %v", err)
+	}
+	if report.Exhausted {
+		log.Fatalf("Not creating machine %q: %s. Delete unused machines, or recreate the cluster with a larger pod CIDR or node CIDR mask size.", ip, report.Warnings[0])
+	}
+	for _, w := range report.Warnings {
+		log.Warnf("[pre-flight] %s", w)
+	}
+	log.Printf("[pre-flight] Pod network has room for %d of %d nodes", report.NodeRanges-report.Nodes, report.NodeRanges)
+}
+
+// etcdDiskDir returns the etcd data directory, or, if it does not exist yet,
+// its parent, which is usually on the same disk.
+func etcdDiskDir(client sshmachine.Client) string {
+	if _, _, err := client.RunCommand(fmt.Sprintf("test -d %s", common.EtcdDataDir)); err == nil {
+		return common.EtcdDataDir
+	}
+	return path.Dir(common.EtcdDataDir)
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.AddCommand(hardwareCmdCheck)
+	hardwareCmdCheck.Flags().String("ip", "", "IP of the machine")
+	hardwareCmdCheck.Flags().Int("port", common.DefaultSSHPort, "SSH port, if the machine is not in the state")
+	hardwareCmdCheck.Flags().StringSlice("public-keys", []string{}, "The machine's SSH public keys, if the machine is not in the state. Provide a comma-separated list, or define multiple flags.")
+	hardwareCmdCheck.Flags().Duration("max-fsync-latency", common.DefaultMaxFsyncLatency, "Maximum 99th percentile fdatasync latency of the disk")
+	hardwareCmdCheck.Flags().Duration("max-network-rtt", common.DefaultMaxNetworkRTT, "Maximum average round-trip time to each ping target")
+	hardwareCmdCheck.Flags().Int64("min-cpus", common.DefaultMinCPUs, "Minimum number of CPUs")
+	hardwareCmdCheck.Flags().Int64("min-memory-gib", common.DefaultMinMemoryGiB, "Minimum memory, in GiB")
+	hardwareCmdCheck.Flags().String("disk-dir", "/var/lib", "Directory on the disk etcd will use, in which a temporary test directory is created")
+	hardwareCmdCheck.Flags().StringSlice("ping", []string{}, "Hosts to measure the round-trip time to (default: the other masters in the state)")
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/cliparse"
+)
+
+// The commands that print the versions of the programs whose output cctl
+// parses. Their output is cached, since it changes only when a program is
+// installed. They are functions, because the paths of the programs are known
+// only once the state is read.
+func kubeadmVersionCmd() string {
+	return fmt.Sprintf("%s version -o short", common.KubeadmFile)
+}
+
+func etcdadmVersionCmd() string {
+	return fmt.Sprintf("%s version --short", common.EtcdadmFile)
+}
+
+func kubectlVersionCmd() string {
+	return fmt.Sprintf("%s version --client --short", common.KubectlFile)
+}
+
+// remoteVersion returns the version of a program on the machine, as printed by
+// its version command. If the version cannot be detected, it returns nil, so
+// that the output of the program is parsed by the parser of the newest
+// version.
+func remoteVersion(client sshmachine.Client, cmd string) *semver.Version {
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		log.Warnf("Unable to detect version: error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		return nil
+	}
+	version, err := cliparse.ParseVersion(stdOut)
+	if err != nil {
+		log.Warnf("Unable to detect version from the output of %q: %v", cmd, err)
+		return nil
+	}
+	return version
+}
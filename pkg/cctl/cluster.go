@@ -0,0 +1,1195 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"text/template"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ghodss/yaml"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/apiendpoint"
+	"github.com/platform9/cctl/pkg/util/audit"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/cni"
+	"github.com/platform9/cctl/pkg/util/dnsrecord"
+	kubeadmutil "github.com/platform9/cctl/pkg/util/kubeadm"
+	"github.com/platform9/cctl/pkg/util/objectmeta"
+	"github.com/platform9/cctl/pkg/util/pki"
+	"github.com/platform9/cctl/pkg/util/schema"
+	"github.com/platform9/cctl/pkg/util/secret"
+	"github.com/platform9/cctl/semverutil"
+
+	spconstants "github.com/platform9/ssh-provider/constants"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+)
+
+var (
+	forceDelete   bool
+	abandonDelete bool
+	routerID      int
+	vip           string
+)
+
+// clusterCmd represents the cluster command
+var clusterCmdCreate = &cobra.Command{
+	Use:   "cluster",
+	Short: "Creates clusterspec in the current directory",
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if cmd.Flag("file").Changed {
+			clusterObjFile := cmd.Flag("f").Value.String()
+			clusterObj, err := clusterFromFile(clusterObjFile)
+			if err != nil {
+				log.Fatalf("Unable to parse cluster object %v", err)
+			}
+			if err := setObjectMetadataFromCluster(clusterObj); err != nil {
+				log.Fatalf("Unable to parse cluster object %v", err)
+			}
+
+			if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Create(clusterObj); err != nil {
+				log.Fatalf("Unable to create cluster %q: %v", common.DefaultClusterName, err)
+			}
+			if err := state.PullFromAPIs(); err != nil {
+				log.Fatalf("Unable to sync on-disk state: %v", err)
+			}
+			log.Println("Cluster created successfully.")
+			return
+		}
+
+		// If either vip or routerID is defined, then both must be
+		if cmd.Flag("vip").Changed != cmd.Flag("router-id").Changed {
+			log.Fatalf("Must use both --router-id and --vip, or use neither for a non-HA cluster.")
+		}
+		var vipConfig *spv1.VIPConfiguration
+		if cmd.Flag("vip").Changed && cmd.Flag("router-id").Changed {
+			if routerID > 255 || routerID < 0 {
+				log.Fatalf("The --router-id %d must be between [0,255].", routerID)
+			}
+			if parsedIP := net.ParseIP(vip); parsedIP == nil {
+				log.Fatalf("The --vip %s must be a valid IP.", vip)
+			}
+			vipConfig = &spv1.VIPConfiguration{
+				RouterID: routerID,
+				IP:       vip,
+			}
+		}
+
+		servicesCIDR := cmd.Flag("service-cidr").Value.String()
+		if !cmd.Flag("service-cidr").Changed && cmd.Flag("service-network").Changed {
+			servicesCIDR = cmd.Flag("service-network").Value.String()
+		}
+		podsCIDR := cmd.Flag("pod-network-cidr").Value.String()
+		if !cmd.Flag("pod-network-cidr").Changed && cmd.Flag("pod-network").Changed {
+			podsCIDR = cmd.Flag("pod-network").Value.String()
+		}
+		dnsDomain := cmd.Flag("cluster-dns-domain").Value.String()
+		if err := clusterapi.ValidateClusterNetwork(podsCIDR, servicesCIDR, dnsDomain); err != nil {
+			log.Fatalf("Invalid cluster network: %v", err)
+		}
+		saPrivateKeyFile := cmd.Flag("sa-private-key").Value.String()
+		saPublicKeyFile := cmd.Flag("sa-public-key").Value.String()
+		if (len(saPrivateKeyFile) == 0) != (len(saPublicKeyFile) == 0) {
+			log.Fatalf("Must specify both sa-private-key and sa-public-key")
+		}
+		apiServerCACertFile := cmd.Flag("apiserver-ca-cert").Value.String()
+		apiServerCAKeyFile := cmd.Flag("apiserver-ca-key").Value.String()
+		if (len(apiServerCACertFile) == 0) != (len(apiServerCAKeyFile) == 0) {
+			log.Fatalf("Must specify both --apiserver-ca-cert and --apiserver-ca-key")
+		}
+		etcdCACertFile := cmd.Flag("etcd-ca-cert").Value.String()
+		etcdCAKeyFile := cmd.Flag("etcd-ca-key").Value.String()
+		if (len(etcdCACertFile) == 0) != (len(etcdCAKeyFile) == 0) {
+			log.Fatalf("Must specify both --etcd-ca-cert and --etcd-ca-key")
+		}
+		frontProxyCACertFile := cmd.Flag("front-proxy-ca-cert").Value.String()
+		frontProxyCAKeyFile := cmd.Flag("front-proxy-ca-key").Value.String()
+		if (len(frontProxyCACertFile) == 0) != (len(frontProxyCAKeyFile) == 0) {
+			log.Fatalf("Must specify both --front-proxy-ca-cert and --front-proxy-ca-key")
+		}
+		clusterConfig := &spv1.ClusterConfig{}
+		var err error
+		clusterConfigFile := cmd.Flag("cluster-config").Value.String()
+		if len(clusterConfigFile) != 0 {
+			clusterConfig, err = parseClusterConfigFromFile(clusterConfigFile)
+			if err != nil {
+				log.Fatalf("Unable to parse cluster config %v", err)
+			}
+		}
+		setClusterConfigDefaults(clusterConfig)
+		if kubeadmConfigFile := cmd.Flag("kubeadm-config").Value.String(); len(kubeadmConfigFile) != 0 {
+			passthrough, err := kubeadmConfigFromFile(kubeadmConfigFile)
+			if err != nil {
+				log.Fatalf("Unable to parse kubeadm config: %v", err)
+			}
+			passthrough.ApplyTo(clusterConfig)
+		}
+		apiServerCertExtraSANs, err := cmd.Flags().GetStringSlice("apiserver-cert-extra-sans")
+		if err != nil {
+			log.Fatalf("Unable to parse `apiserver-cert-extra-sans`: %v", err)
+		}
+		if dnsName := cmd.Flag("dns-name").Value.String(); len(dnsName) != 0 {
+			apiServerCertExtraSANs = append(apiServerCertExtraSANs, strings.TrimSuffix(dnsName, "."))
+		}
+		if _, err := pki.ParseAltNames(apiServerCertExtraSANs); err != nil {
+			log.Fatalf("Invalid --apiserver-cert-extra-sans: %v", err)
+		}
+		cniPlugin, err := cni.ParsePlugin(cmd.Flag("cni").Value.String())
+		if err != nil {
+			log.Fatalf("Invalid --cni: %v", err)
+		}
+		cniManifestFile := cmd.Flag("cni-manifest").Value.String()
+		if len(cniManifestFile) != 0 && cniPlugin == cni.None {
+			log.Fatalf("Must not use --cni-manifest with --cni %s", cni.None)
+		}
+		var machineDefaults clusterapi.MachineDefaults
+		if machineDefaultsFile := cmd.Flag("machine-defaults").Value.String(); len(machineDefaultsFile) != 0 {
+			machineDefaults, err = machineDefaultsFromFile(machineDefaultsFile)
+			if err != nil {
+				log.Fatalf("Unable to parse machine defaults: %v", err)
+			}
+		}
+
+		newAPIServerCASecret, err := secret.CreateCASecret(namespace, common.DefaultAPIServerCASecretName, apiServerCACertFile, apiServerCAKeyFile)
+		if err != nil {
+			log.Fatalf("Unable to generate API Server CA cert pair: %v", err)
+		}
+		newEtcdCASecret, err := secret.CreateCASecret(namespace, common.DefaultEtcdCASecretName, etcdCACertFile, etcdCAKeyFile)
+		if err != nil {
+			log.Fatalf("Unable to generate etcd CA cert pair: %v", err)
+		}
+		newFrontProxyCASecret, err := secret.CreateCASecret(namespace, common.DefaultFrontProxyCASecretName, frontProxyCACertFile, frontProxyCAKeyFile)
+		if err != nil {
+			log.Fatalf("Unable to generate front proxy CA cert pair: %v", err)
+		}
+
+		newServiceAccountKeySecret, err := secret.CreateSAKeySecret(namespace, common.DefaultServiceAccountKeySecretName, saPrivateKeyFile, saPublicKeyFile)
+		if err != nil {
+			log.Fatalf("Unable to generate service account key pair: %v", err)
+		}
+		newBootstrapTokenSecret, err := secret.CreateBootstrapTokenSecret(namespace, common.DefaultBootstrapTokenSecretName)
+		if err != nil {
+			log.Fatalf("Unable to generate bootstrap token secret: %v", err)
+		}
+
+		newCluster, err := createCluster(common.DefaultClusterName, podsCIDR, servicesCIDR, dnsDomain, vipConfig, clusterConfig)
+		if err != nil {
+			log.Fatalf("Unable to create cluster: %v", err)
+		}
+		if len(apiServerCertExtraSANs) != 0 {
+			if newCluster.Annotations == nil {
+				newCluster.Annotations = make(map[string]string)
+			}
+			newCluster.Annotations[common.APIServerCertSANsAnnotationKey] = strings.Join(apiServerCertExtraSANs, ",")
+		}
+		var vrrpChanged bool
+		for _, flag := range vrrpFlags {
+			vrrpChanged = vrrpChanged || cmd.Flag(flag).Changed
+		}
+		if vrrpChanged {
+			if vipConfig == nil {
+				log.Fatalf("Must use --vip with --vrrp-priority, --vrrp-auth-pass, or --vrrp-unicast-peers.")
+			}
+			if err := setKeepalivedSettings(cmd, newCluster); err != nil {
+				log.Fatalf("Invalid VRRP settings: %v", err)
+			}
+		}
+		var dnsRecordChanged bool
+		for _, flag := range dnsRecordFlags {
+			dnsRecordChanged = dnsRecordChanged || cmd.Flag(flag).Changed
+		}
+		if dnsRecordChanged {
+			if err := setDNSRecord(cmd, newCluster); err != nil {
+				log.Fatalf("Invalid DNS record settings: %v", err)
+			}
+		}
+		if cmd.Flag("cni").Changed || len(cniManifestFile) != 0 {
+			if err := setCNI(newCluster, cniPlugin, cniManifestFile); err != nil {
+				log.Fatalf("Unable to configure the pod network: %v", err)
+			}
+		}
+		if err := clusterapi.SetMachineDefaults(newCluster, machineDefaults); err != nil {
+			log.Fatalf("Unable to set machine defaults: %v", err)
+		}
+		if len(cmd.Flag("bastion").Value.String()) != 0 {
+			if err := setBastion(cmd, newCluster); err != nil {
+				log.Fatalf("Unable to configure the bastion: %v", err)
+			}
+		}
+		remoteBinDir := cmd.Flag("remote-bin-dir").Value.String()
+		remoteAdminKubeconfig := cmd.Flag("remote-admin-kubeconfig").Value.String()
+		if err := common.ValidateRemotePaths(remoteBinDir, remoteAdminKubeconfig); err != nil {
+			log.Fatalf("Invalid remote paths: %v", err)
+		}
+		if remoteBinDir != common.DefaultRemoteBinDir || remoteAdminKubeconfig != common.DefaultAdminKubeconfig {
+			if newCluster.Annotations == nil {
+				newCluster.Annotations = make(map[string]string)
+			}
+			newCluster.Annotations[common.RemoteBinDirAnnotationKey] = remoteBinDir
+			newCluster.Annotations[common.RemoteAdminKubeconfigAnnotationKey] = remoteAdminKubeconfig
+		}
+		objectLabelPairs, err := cmd.Flags().GetStringSlice("object-labels")
+		if err != nil {
+			log.Fatalf("Unable to parse `object-labels`: %v", err)
+		}
+		labels, err := objectmeta.ParseLabels(objectLabelPairs)
+		if err != nil {
+			log.Fatalf("Invalid --object-labels: %v", err)
+		}
+		objectAnnotationPairs, err := cmd.Flags().GetStringArray("object-annotations")
+		if err != nil {
+			log.Fatalf("Unable to parse `object-annotations`: %v", err)
+		}
+		annotations, err := objectmeta.ParseAnnotations(objectAnnotationPairs)
+		if err != nil {
+			log.Fatalf("Invalid --object-annotations: %v", err)
+		}
+		if err := setClusterObjectMetadata(newCluster, labels, annotations); err != nil {
+			log.Fatalf("Unable to record object labels and annotations: %v", err)
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newAPIServerCASecret); err != nil {
+			log.Fatalf("Unable to create API server CA secret: %v", err)
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newEtcdCASecret); err != nil {
+			log.Fatalf("Unable to create etcd CA secret: %v", err)
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newFrontProxyCASecret); err != nil {
+			log.Fatalf("Unable to create front proxy CA secret: %v", err)
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newServiceAccountKeySecret); err != nil {
+			log.Fatalf("Unable to create service account secret: %v", err)
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newBootstrapTokenSecret); err != nil {
+			log.Fatalf("Unable to create bootstrap token secret: %v", err)
+		}
+		if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Create(newCluster); err != nil {
+			log.Fatalf("Unable to create cluster %q: %v", common.DefaultClusterName, err)
+		}
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		if err := syncDNSRecord(false); err != nil {
+			log.Fatalf("Cluster created, but unable to register the DNS name of the API endpoint: %v. Run update cluster --sync-dns-record to retry.", err)
+		}
+		log.Println("Cluster created successfully.")
+	},
+}
+
+func setClusterConfigDefaults(clusterConfig *spv1.ClusterConfig) {
+	setKubeAPIServerDefaults(clusterConfig)
+	setKubeControllerMgrDefaults(clusterConfig)
+	setKubeletConfigDefaults(clusterConfig)
+}
+
+func setKubeAPIServerDefaults(clusterConfig *spv1.ClusterConfig) {
+	if clusterConfig.KubeAPIServer == nil {
+		clusterConfig.KubeAPIServer = make(map[string]string)
+	}
+	// ServiceNodePortRange
+	if _, ok := clusterConfig.KubeAPIServer[spconstants.KubeAPIServerServiceNodePortRangeKey]; !ok {
+		clusterConfig.KubeAPIServer[spconstants.KubeAPIServerServiceNodePortRangeKey] = common.KubeAPIServerServiceNodePortRange
+	}
+}
+
+func setKubeControllerMgrDefaults(clusterConfig *spv1.ClusterConfig) {
+	if clusterConfig.KubeControllerManager == nil {
+		clusterConfig.KubeControllerManager = make(map[string]string)
+	}
+	if _, ok := clusterConfig.KubeControllerManager[spconstants.KubeControllerMgrPodEvictionTimeoutKey]; !ok {
+		clusterConfig.KubeControllerManager[spconstants.KubeControllerMgrPodEvictionTimeoutKey] = common.KubeControllerMgrPodEvictionTimeout
+	}
+}
+
+func setKubeletConfigDefaults(clusterConfig *spv1.ClusterConfig) {
+	if clusterConfig.Kubelet == nil {
+		clusterConfig.Kubelet = &spv1.KubeletConfiguration{}
+	}
+	if clusterConfig.Kubelet.KubeAPIQPS == nil {
+		clusterConfig.Kubelet.KubeAPIQPS = &common.KubeletKubeAPIQPS
+	}
+	if clusterConfig.Kubelet.KubeAPIBurst == 0 {
+		clusterConfig.Kubelet.KubeAPIBurst = common.KubeletKubeAPIBurst
+	}
+	if clusterConfig.Kubelet.MaxPods == 0 {
+		clusterConfig.Kubelet.MaxPods = common.KubeletMaxPods
+	}
+	if clusterConfig.Kubelet.FailSwapOn == nil {
+		clusterConfig.Kubelet.FailSwapOn = &common.KubeletFailSwapOn
+	}
+	if clusterConfig.Kubelet.FeatureGates == nil {
+		clusterConfig.Kubelet.FeatureGates = common.KubeletFeatureGates
+	}
+	if clusterConfig.Kubelet.EvictionHard == nil {
+		clusterConfig.Kubelet.EvictionHard = common.KubeletEvictionHard
+	}
+	if clusterConfig.KubeAPIServer == nil {
+		clusterConfig.KubeAPIServer = common.DefaultKubeAPIServerExtraArgs
+	}
+	if clusterConfig.KubeControllerManager == nil {
+		clusterConfig.KubeControllerManager = common.DefaultKubeControllerManagerExtraArgs
+	}
+	if clusterConfig.KubeScheduler == nil {
+		clusterConfig.KubeScheduler = common.DefaultKubeSchedulerExtraArgs
+	}
+}
+
+func parseClusterConfigFromFile(file string) (*spv1.ClusterConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cluster config file: %s", file)
+	}
+	if err := validateFileSchema(schema.ClusterConfig, file, data); err != nil {
+		return nil, err
+	}
+	clusterConfig := spv1.ClusterConfig{}
+	if err = yaml.Unmarshal(data, &clusterConfig); err != nil {
+		return nil, fmt.Errorf("unable to decode cluster config: %v", err)
+	}
+	return &clusterConfig, nil
+}
+
+// kubeadmConfigFromFile reads the kubeadm configuration to pass through to
+// masters from the file.
+func kubeadmConfigFromFile(file string) (*kubeadmutil.PassthroughConfiguration, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read kubeadm config file %q: %v", file, err)
+	}
+	return kubeadmutil.ParsePassthroughConfiguration(data)
+}
+
+var clusterCmdUpdate = &cobra.Command{
+	Use:   "cluster",
+	Short: "Update the spec of the cluster and apply the changes to the masters",
+	Long: `Update the spec of the cluster and apply the changes to the masters.
+
+--add-san adds subject alternative names to those given to create cluster with
+--apiserver-cert-extra-sans. The API server certificate of each master that
+does not have all of them is reissued, signed by the cluster CA, and the API
+server is restarted; masters are updated one at a time. The replaced
+certificate and key are kept with a .old suffix. If updating a master fails,
+run the command again to update the remaining masters.
+
+--audit-policy enables API server audit logging with the policy. The policy is
+uploaded to every master, and the API server static pod manifest is updated
+with the audit arguments, and with the policy and log directories mounted from
+the host. The log is written to ` + audit.LogFile + `, and rotated as
+configured by the --audit-log flags, which can also be changed for a cluster
+that already has a policy. The replaced manifest is kept in
+` + common.KubernetesDir + ` with a .old suffix.
+
+--encrypt-secrets enables the encryption of secrets at rest. An encryption key
+is generated and kept in the state, the encryption configuration is written to
+every master, the API server manifest is updated to read it, and every secret
+is re-encrypted. Use rotate encryption-key to rotate the key.
+
+--control-plane-hook-url and --control-plane-hook-command configure a hook run
+whenever a master is added or removed, to update the backends of an external
+load balancer. The URL is sent a POST request, and the command, run on this
+host, is given on its standard input, a JSON event with the action (added,
+removed, or sync), the machine, and the API server address, as host:port, of
+every master. --control-plane-endpoint is the host:port of the load balancer:
+after the hook runs, the kubelet kubeconfigs of every node, and the kubeconfig
+of kube-proxy, are pointed at it, and the kubelet and kube-proxy restarted
+where they change. Without it, the nodes are not changed. An empty value
+removes a setting. Changing a setting, or --sync-control-plane-endpoints, runs
+the hook, with action sync, and points the nodes at the endpoint, if any.
+
+--router-id, --vrrp-priority, --vrrp-auth-pass, and --vrrp-unicast-peers
+change the VRRP settings of a cluster with a VIP, so that clusters sharing an
+L2 segment do not clash. The keepalived configuration of every master is
+corrected, as by status vip --reconcile, and keepalived restarted where it
+changes. Each master is removed from its own unicast peers. An empty value
+removes a setting, except --router-id.
+
+--kubeconfig-endpoint, --kubeconfig-site-label, and --kubeconfig-site-endpoints
+set the server of the admin kubeconfig copied to each node, for nodes that
+cannot reach the server in the kubeconfig of the masters, e.g. nodes behind
+NAT. A node whose node label --kubeconfig-site-label is a site of
+--kubeconfig-site-endpoints, given as site=host:port, uses the address of its
+site. Other nodes use --kubeconfig-endpoint: vip, the VIP of the cluster; dns,
+the DNS name of the cluster; master, the master the kubeconfig is copied from;
+or, if empty, the server of the kubeconfig of the masters. The admin
+kubeconfig of every node is updated. An empty value removes a setting.
+
+--dns-provider, --dns-name, --dns-ttl, and --dns-provider-options configure
+the DNS record of the API endpoint, so that kubeconfigs reach the API server
+by name when its address changes. The name resolves to the VIP of the
+cluster, the IP of --control-plane-endpoint, or the IP of every master, and
+is registered with the provider whenever these change: route53, with the AWS
+CLI and its credentials; infoblox, through the WAPI, with the credentials in
+` + dnsrecord.InfobloxUsernameEnv + ` and ` + dnsrecord.InfobloxPasswordEnv + `; webhook, which is sent a
+POST request; or script, a command run on this host. The webhook and script
+are given a JSON record with the name, addresses, and TTL. The name is added
+to the API server certificate of every master. --sync-dns-record registers
+the name again.
+
+--bastion and --bastion-public-keys change the jump host used to SSH to
+machines, e.g. when it is replaced or its host keys are rotated. Its SSH
+credential is changed with create credential --bastion. An empty --bastion
+removes the bastion, so that machines are reached directly.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sans, err := cmd.Flags().GetStringSlice("add-san")
+		if err != nil {
+			log.Fatalf("Unable to parse `add-san`: %v", err)
+		}
+		if _, err := pki.ParseAltNames(sans); err != nil {
+			log.Fatalf("Invalid --add-san: %v", err)
+		}
+		auditPolicyFile := cmd.Flag("audit-policy").Value.String()
+		auditLogChanged := cmd.Flag("audit-log-maxage").Changed || cmd.Flag("audit-log-maxbackup").Changed || cmd.Flag("audit-log-maxsize").Changed
+		encryptSecrets, err := cmd.Flags().GetBool("encrypt-secrets")
+		if err != nil {
+			log.Fatalf("Unable to parse `encrypt-secrets`: %v", err)
+		}
+		var controlPlaneHookChanged bool
+		for _, flag := range controlPlaneHookFlags {
+			controlPlaneHookChanged = controlPlaneHookChanged || cmd.Flag(flag).Changed
+		}
+		syncControlPlane, err := cmd.Flags().GetBool("sync-control-plane-endpoints")
+		if err != nil {
+			log.Fatalf("Unable to parse `sync-control-plane-endpoints`: %v", err)
+		}
+		vrrpChanged := cmd.Flag("router-id").Changed
+		for _, flag := range vrrpFlags {
+			vrrpChanged = vrrpChanged || cmd.Flag(flag).Changed
+		}
+		var kubeconfigPolicyChanged bool
+		for _, flag := range kubeconfigPolicyFlags {
+			kubeconfigPolicyChanged = kubeconfigPolicyChanged || cmd.Flag(flag).Changed
+		}
+		var dnsRecordChanged bool
+		for _, flag := range dnsRecordFlags {
+			dnsRecordChanged = dnsRecordChanged || cmd.Flag(flag).Changed
+		}
+		syncDNS, err := cmd.Flags().GetBool("sync-dns-record")
+		if err != nil {
+			log.Fatalf("Unable to parse `sync-dns-record`: %v", err)
+		}
+		bastionChanged := cmd.Flag("bastion").Changed || cmd.Flag("bastion-public-keys").Changed
+		if len(sans) == 0 && len(auditPolicyFile) == 0 && !auditLogChanged && !encryptSecrets && !controlPlaneHookChanged && !syncControlPlane && !vrrpChanged && !kubeconfigPolicyChanged && !dnsRecordChanged && !syncDNS && !bastionChanged {
+			log.Fatalf("Nothing to update. Use --add-san to add subject alternative names, --audit-policy to enable audit logging, --encrypt-secrets to enable the encryption of secrets, --control-plane-hook-url, --control-plane-hook-command, or --control-plane-endpoint to configure the control plane hook, --router-id or the --vrrp flags to change the VRRP settings, the --kubeconfig flags to set the server of the admin kubeconfig of nodes, the --dns flags to register the DNS name of the API endpoint, or the --bastion flags to change the bastion.")
+		}
+		if dnsName := cmd.Flag("dns-name").Value.String(); cmd.Flag("dns-name").Changed && len(dnsName) != 0 {
+			sans = append(sans, strings.TrimSuffix(dnsName, "."))
+			if _, err := pki.ParseAltNames(sans); err != nil {
+				log.Fatalf("Invalid --dns-name: %v", err)
+			}
+		}
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get cluster: %v", err)
+		}
+		if _, ok := cluster.Annotations[common.ControlPlaneHookAnnotationKey]; syncControlPlane && !ok && !controlPlaneHookChanged {
+			log.Fatalf("Cluster has no control plane hook. Use --control-plane-hook-url, --control-plane-hook-command, or --control-plane-endpoint to add one.")
+		}
+		if _, ok := cluster.Annotations[common.DNSRecordAnnotationKey]; syncDNS && !ok && !dnsRecordChanged {
+			log.Fatalf("Cluster has no DNS record settings. Use --dns-provider and --dns-name to add them.")
+		}
+		var changed bool
+		current := apiServerCertSANs(cluster)
+		merged := current
+		seen := make(map[string]bool, len(current))
+		for _, san := range current {
+			seen[san] = true
+		}
+		for _, san := range sans {
+			if !seen[san] {
+				seen[san] = true
+				merged = append(merged, san)
+			}
+		}
+		if len(merged) != len(current) {
+			if cluster.Annotations == nil {
+				cluster.Annotations = make(map[string]string)
+			}
+			cluster.Annotations[common.APIServerCertSANsAnnotationKey] = strings.Join(merged, ",")
+			changed = true
+		}
+		if len(auditPolicyFile) != 0 || auditLogChanged {
+			if err := setAuditConfig(cmd, cluster, auditPolicyFile); err != nil {
+				log.Fatalf("Unable to configure audit logging: %v", err)
+			}
+			changed = true
+		}
+		if controlPlaneHookChanged {
+			if err := setControlPlaneHook(cmd, cluster); err != nil {
+				log.Fatalf("Unable to configure the control plane hook: %v", err)
+			}
+			changed = true
+		}
+		if vrrpChanged {
+			if err := setVRRPSettings(cmd, cluster); err != nil {
+				log.Fatalf("Unable to change the VRRP settings: %v", err)
+			}
+			changed = true
+		}
+		if kubeconfigPolicyChanged {
+			if err := setKubeconfigPolicy(cmd, cluster); err != nil {
+				log.Fatalf("Unable to configure the kubeconfig policy: %v", err)
+			}
+			changed = true
+		}
+		if dnsRecordChanged {
+			if err := setDNSRecord(cmd, cluster); err != nil {
+				log.Fatalf("Unable to configure the DNS record: %v", err)
+			}
+			changed = true
+		}
+		if bastionChanged {
+			if err := setBastion(cmd, cluster); err != nil {
+				log.Fatalf("Unable to configure the bastion: %v", err)
+			}
+			changed = true
+		}
+		if changed {
+			// The changes are recorded before the masters are updated, so
+			// that masters created later get them, and a failed update can be
+			// run again.
+			if cluster, err = state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Update(cluster); err != nil {
+				log.Fatalf("Unable to update cluster: %v", err)
+			}
+			if err := state.PullFromAPIs(); err != nil {
+				log.Fatalf("Unable to sync on-disk state: %v", err)
+			}
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		for i := range machineList.Items {
+			master := &machineList.Items[i]
+			if !clusterutil.RoleContains(clustercommon.MasterRole, master.Spec.Roles) {
+				continue
+			}
+			client, err := machineClientForMachine(master)
+			if err != nil {
+				log.Fatalf("Unable to create machine client for machine %q: %v", master.Name, err)
+			}
+			if len(sans) != 0 {
+				if err := ensureAPIServerCertSANs(cluster, master.Name, client); err != nil {
+					log.Fatalf("Unable to update the API server certificate of machine %q: %v", master.Name, err)
+				}
+			}
+			if len(auditPolicyFile) != 0 || auditLogChanged {
+				if err := ensureAuditConfig(cluster, master.Name, client); err != nil {
+					log.Fatalf("Unable to configure audit logging on machine %q: %v", master.Name, err)
+				}
+			}
+			if vrrpChanged {
+				if err := ensureKeepalivedConfig(cluster, master, client); err != nil {
+					log.Fatalf("Unable to apply the VRRP settings on machine %q: %v", master.Name, err)
+				}
+			}
+		}
+		if encryptSecrets {
+			if err := enableSecretsEncryption(); err != nil {
+				log.Fatalf("Unable to enable the encryption of secrets: %v", err)
+			}
+		}
+		if controlPlaneHookChanged || syncControlPlane {
+			if err := syncControlPlaneEndpoints(cluster, apiendpoint.ActionSync, ""); err != nil {
+				log.Fatalf("Unable to sync the control plane endpoints: %v", err)
+			}
+		}
+		if dnsRecordChanged || syncDNS {
+			if err := syncDNSRecord(syncDNS); err != nil {
+				log.Fatalf("Unable to register the DNS name of the API endpoint: %v", err)
+			}
+		}
+		policy, err := kubeconfigPolicy(cluster)
+		if err != nil {
+			log.Fatalf("Unable to read the kubeconfig policy: %v", err)
+		}
+		if kubeconfigPolicyChanged || (dnsRecordChanged && policy.Default == apiendpoint.EndpointDNS) {
+			if err := ensureAdminKubeconfigs(); err != nil {
+				log.Fatalf("Unable to update the admin kubeconfigs of nodes: %v", err)
+			}
+		}
+		log.Println("Cluster updated successfully.")
+	},
+}
+
+// machineDefaultsFromFile reads the per-role defaults of create machine from
+// the file.
+func machineDefaultsFromFile(file string) (clusterapi.MachineDefaults, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read machine defaults file %q: %v", file, err)
+	}
+	if err := validateFileSchema(schema.MachineDefaults, file, data); err != nil {
+		return nil, err
+	}
+	return clusterapi.ParseMachineDefaults(data)
+}
+
+func clusterFromFile(file string) (*clusterv1.Cluster, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cluster object: %s", file)
+	}
+	if err := validateFileSchema(schema.Cluster, file, data); err != nil {
+		return nil, err
+	}
+	clusterObj := clusterv1.Cluster{}
+	if err = yaml.Unmarshal(data, &clusterObj); err != nil {
+		return nil, fmt.Errorf("unable to decode cluster object: %v", err)
+	}
+	if len(clusterObj.Namespace) == 0 {
+		clusterObj.Namespace = namespace
+	}
+	return &clusterObj, nil
+}
+
+func createCluster(clusterName, podsCIDR, servicesCIDR, dnsDomain string, vipConfig *spv1.VIPConfiguration, clusterConfig *spv1.ClusterConfig) (*clusterv1.Cluster, error) {
+	newCluster := clusterv1.Cluster{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Cluster",
+			APIVersion: "cluster.k8s.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              clusterName,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: clusterv1.ClusterSpec{
+			ClusterNetwork: clusterv1.ClusterNetworkingConfig{
+				Services: clusterv1.NetworkRanges{
+					CIDRBlocks: []string{
+						servicesCIDR,
+					},
+				},
+				Pods: clusterv1.NetworkRanges{
+					CIDRBlocks: []string{
+						podsCIDR,
+					},
+				},
+				ServiceDomain: dnsDomain,
+			},
+		},
+	}
+
+	spClusterSpec := spv1.ClusterSpec{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "sshprovider.platform9.com/v1alpha1",
+			Kind:       "ClusterSpec",
+		},
+		APIServerCASecret: &corev1.LocalObjectReference{
+			Name: common.DefaultAPIServerCASecretName,
+		},
+		EtcdCASecret: &corev1.LocalObjectReference{
+			Name: common.DefaultEtcdCASecretName,
+		},
+		FrontProxyCASecret: &corev1.LocalObjectReference{
+			Name: common.DefaultFrontProxyCASecretName,
+		},
+		ServiceAccountKeySecret: &corev1.LocalObjectReference{
+			Name: common.DefaultServiceAccountKeySecretName,
+		},
+		BootstrapTokenSecret: &corev1.LocalObjectReference{
+			Name: common.DefaultBootstrapTokenSecretName,
+		},
+		ClusterConfig:    clusterConfig,
+		VIPConfiguration: vipConfig,
+	}
+
+	spClusterStatus := spv1.ClusterStatus{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "sshprovider.platform9.com/v1alpha1",
+			Kind:       "ClusterStatus",
+		},
+		EtcdMembers: []spv1.EtcdMember{},
+	}
+
+	providerCodec.PutClusterSpec(spClusterSpec, &newCluster)
+	providerCodec.PutClusterStatus(spClusterStatus, &newCluster)
+
+	return &newCluster, nil
+}
+
+var clusterCmdDelete = &cobra.Command{
+	Use:   "cluster",
+	Short: "Deletes a node from a cluster",
+	Long: `Delete the cluster from the state. The machines must be deleted first, unless
+--force is given.
+
+With --abandon, every object of the cluster is removed from the state: the
+cluster, machines, provisioned machines, and secrets, including credentials.
+No machine is contacted, so the cluster keeps running. Use it to hand a
+running cluster over to another tool, or to forget a cluster that was
+destroyed without cctl. Back up the state first; the objects cannot be
+recovered otherwise.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if abandonDelete {
+			if err := abandonCluster(); err != nil {
+				log.Fatalf("Unable to abandon cluster: %v", err)
+			}
+			log.Println("Cluster abandoned successfully. No machine was changed.")
+			return
+		}
+		log.Println("Running cluster delete")
+
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get cluster: %v", err)
+		}
+
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+
+		if len(machineList.Items) > 0 {
+			var machineNames []string
+			for _, machine := range machineList.Items {
+				machineNames = append(machineNames, machine.Name)
+			}
+			if forceDelete {
+				log.Printf("Machines [%s] part of cluster. Deleting them from the state.", machineNames)
+				for _, machine := range clusterapi.OrderForDeletion(machineList.Items) {
+					if err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Delete(machine.Name, &metav1.DeleteOptions{}); err != nil {
+						if !apierrors.IsNotFound(err) {
+							log.Fatalf("Unable to delete machine %q: %v", machine.Name, err)
+						}
+					}
+				}
+			} else {
+				log.Fatalf("Machines [%s] part of cluster. Delete them before deleting the cluster.", machineNames)
+			}
+		}
+
+		clusterProviderSpec, err := providerCodec.GetClusterSpec(*cluster)
+		if err != nil {
+			log.Fatalf("Unable to decode cluster spec: %v", err)
+		}
+		if clusterProviderSpec.APIServerCASecret != nil {
+			if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(clusterProviderSpec.APIServerCASecret.Name, &metav1.DeleteOptions{}); err != nil {
+				if !apierrors.IsNotFound(err) {
+					log.Fatalf("Unable to delete API server CA secret: %v", err)
+				}
+			}
+		}
+		if clusterProviderSpec.EtcdCASecret != nil {
+			if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(clusterProviderSpec.EtcdCASecret.Name, &metav1.DeleteOptions{}); err != nil {
+				if !apierrors.IsNotFound(err) {
+					log.Fatalf("Unable to delete etcd CA secret: %v", err)
+				}
+			}
+		}
+		if clusterProviderSpec.FrontProxyCASecret != nil {
+			if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(clusterProviderSpec.FrontProxyCASecret.Name, &metav1.DeleteOptions{}); err != nil {
+				if !apierrors.IsNotFound(err) {
+					log.Fatalf("Unable to delete front proxy CA secret: %v", err)
+				}
+			}
+		}
+		if clusterProviderSpec.ServiceAccountKeySecret != nil {
+			if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(clusterProviderSpec.ServiceAccountKeySecret.Name, &metav1.DeleteOptions{}); err != nil {
+				if !apierrors.IsNotFound(err) {
+					log.Fatalf("Unable to delete service account key secret: %v", err)
+				}
+			}
+		}
+		if clusterProviderSpec.BootstrapTokenSecret != nil {
+			if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(clusterProviderSpec.BootstrapTokenSecret.Name, &metav1.DeleteOptions{}); err != nil {
+				if !apierrors.IsNotFound(err) {
+					log.Fatalf("Unable to delete bootstrap token secret: %v", err)
+				}
+			}
+		}
+
+		if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(common.DefaultAdminConfigSecretName, &metav1.DeleteOptions{}); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Fatalf("Unable to delete admin kubeconfig secret: %v", err)
+			}
+		}
+
+		if err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Delete(cluster.Name, &metav1.DeleteOptions{}); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Fatalf("Unable to delete cluster: %v", err)
+			}
+		}
+
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		log.Println("Cluster deleted successfully")
+	},
+}
+
+// abandonCluster removes every object in the namespace from the state, without
+// contacting any machine.
+func abandonCluster() error {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	for _, machine := range clusterapi.OrderForDeletion(machineList.Items) {
+		log.Printf("Removing machine %q from the state", machine.Name)
+		if err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Delete(machine.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete machine %q: %v", machine.Name, err)
+		}
+	}
+	pmList, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list provisioned machines: %v", err)
+	}
+	for _, pm := range pmList.Items {
+		log.Printf("Removing provisioned machine %q from the state", pm.Name)
+		if err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Delete(pm.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete provisioned machine %q: %v", pm.Name, err)
+		}
+	}
+	secretList, err := state.KubeClient.CoreV1().Secrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list secrets: %v", err)
+	}
+	for _, secret := range secretList.Items {
+		log.Printf("Removing secret %q from the state", secret.Name)
+		if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(secret.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete secret %q: %v", secret.Name, err)
+		}
+	}
+	clusterList, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list clusters: %v", err)
+	}
+	for _, cluster := range clusterList.Items {
+		log.Printf("Removing cluster %q from the state", cluster.Name)
+		if err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Delete(cluster.Name, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("unable to delete cluster %q: %v", cluster.Name, err)
+		}
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+
+var clusterCmdGet = &cobra.Command{
+	Use:   "cluster",
+	Short: "Get the cluster details",
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get cluster: %v", err)
+		}
+		if ok, err := printTemplateOutput(cluster); ok {
+			if err != nil {
+				log.Fatalf("Unable to print cluster: %v", err)
+			}
+			return
+		}
+		switch outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(cluster)
+			if err != nil {
+				log.Fatalf("Unable to marshal cluster spec file to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(cluster)
+			if err != nil {
+				log.Fatalf("Unable to marshal cluster spec file to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			// Pretty print cluster details
+			clusterProviderSpec, err := providerCodec.GetClusterSpec(*cluster)
+			if err != nil {
+				log.Fatalf("Could not decode cluster provider spec: %v", err)
+			}
+			data := struct {
+				Cluster             *clusterv1.Cluster
+				ClusterProviderSpec *spv1.ClusterSpec
+			}{
+				Cluster:             cluster,
+				ClusterProviderSpec: clusterProviderSpec,
+			}
+			t := template.Must(template.New("ClusterV1PrintTemplate").Parse(common.ClusterV1PrintTemplate))
+			if err := t.Execute(os.Stdout, &data); err != nil {
+				log.Fatalf("Could not pretty print cluster details: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+	},
+}
+
+func createLocalCopyOfAdminKubeConfig() (string, error) {
+	kubeconfig, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultAdminConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to get admin kubeconfig from secret: %v", err)
+	}
+	tmpKubeConfig, err := ioutil.TempFile("", common.TmpKubeConfigNamePrefix)
+	if err != nil {
+		return "", fmt.Errorf("unable to create temporary file : %v", err)
+	}
+	kubeconfigData, ok := kubeconfig.Data[common.DefaultAdminConfigSecretKey]
+	if !ok {
+		return "", fmt.Errorf("unable to find data in admin kubeconfig secret")
+	}
+	if len(kubeconfigData) == 0 {
+		return "", fmt.Errorf("invalid data in admin kubeconfig secret")
+	}
+	err = ioutil.WriteFile(tmpKubeConfig.Name(), kubeconfigData, os.FileMode(os.O_RDONLY))
+	if err != nil {
+		return "", fmt.Errorf("unable to write kubeconfig to file : %v", err)
+	}
+	return tmpKubeConfig.Name(), nil
+}
+
+func checkClusterHealth() error {
+	kubeconfig, err := createLocalCopyOfAdminKubeConfig()
+	defer os.Remove(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to create local copy of kubeconfig : %v", err)
+	}
+	log.Print("Checking if all masters are in ready state")
+	if err = common.MasterNodesReady(kubeconfig); err != nil {
+		return err
+	}
+	log.Print("Checking if all control plane pods are in ready state")
+	if err = common.ControlPlaneReady(kubeconfig); err != nil {
+		return err
+	}
+	return nil
+}
+
+func trimVFromVersion(version string) string {
+	return strings.TrimPrefix(version, "v")
+}
+
+func checkVersionSkew() error {
+	machines, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get list of machines in the cluster")
+	}
+	// TODO(puneet) doing this check for every machine seems expensive
+	// should we have a set of versions at cluster level as well?
+	for _, machine := range machines.Items {
+		machineSpec, err := providerCodec.GetMachineSpec(machine)
+		if err != nil {
+			return fmt.Errorf("unable to decode machine spec: %v", err)
+		}
+		machineK8sVersion, err := semver.NewVersion(machineSpec.ComponentVersions.KubernetesVersion)
+		if err != nil {
+			return fmt.Errorf("unable to parse kubernetes version for machine %s", machine.Name)
+		}
+		// minimum K8s version that we can upgrade from
+		minimumK8sVersion, err := semver.NewVersion(trimVFromVersion(common.MinimumControlPlaneVersion))
+		if err != nil {
+			return fmt.Errorf("unable to parse kubernetes version %s", minimumK8sVersion)
+		}
+		if semverutil.CompareMajorMinorVersions(*machineK8sVersion, *minimumK8sVersion) < 0 {
+			return fmt.Errorf("cannot upgrade machine %s. Minimum supported version for upgrade %s. Machine is currently at %s", machine.Name, minimumK8sVersion, machineK8sVersion)
+		}
+	}
+	return nil
+}
+
+func upgradeMachines(machines []clusterv1.Machine) error {
+	for _, machine := range machines {
+		machineSpec, err := providerCodec.GetMachineSpec(machine)
+		if err != nil {
+			return fmt.Errorf("unable to decode machine spec: %v", err)
+		}
+		currentProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().
+			ProvisionedMachines(namespace).
+			Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to decode provisioned machine spec: %v", err)
+		}
+		if err = upgradeMachine(currentProvisionedMachine.Spec.SSHConfig.Host); err != nil {
+			return fmt.Errorf("Cluster upgrade failed with error: %v", err)
+		}
+	}
+	return nil
+}
+
+var clusterCmdUpgrade = &cobra.Command{
+	Use:   "cluster",
+	Short: "Upgrade the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := createAdminKubeConfigSecretIfNotPresent(); err != nil {
+			log.Fatalf("Unable to create admin kubeconfig secret: %v", err)
+		}
+		log.Print("[pre-flight] Running preflight checks for cluster upgrade")
+		if err := checkVersionSkew(); err != nil {
+			log.Fatalf("[pre-flight] Preflight check failed with error: %v", err)
+		}
+		if err := checkClusterHealth(); err != nil {
+			log.Fatalf("[pre-flight] Preflight check failed with error: %v", err)
+		}
+		log.Print("[pre-flight] Preflight check passed")
+		log.Print("Starting cluster upgrade")
+
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("unable to get cluster %s: %v", common.DefaultClusterName, err)
+		}
+		clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+		if err != nil {
+			log.Fatalf("unable to get cluster spec %s: %v", common.DefaultClusterName, err)
+		}
+		if clusterSpec.ClusterConfig == nil {
+			clusterSpec.ClusterConfig = &spv1.ClusterConfig{}
+			setClusterConfigDefaults(clusterSpec.ClusterConfig)
+		}
+		if err := providerCodec.PutClusterSpec(*clusterSpec, cluster); err != nil {
+			log.Fatalf("Unable to update cluster spec %s: %v", common.DefaultClusterName, err)
+		}
+		if _, err = state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Update(cluster); err != nil {
+			log.Fatalf("unable to update cluster spec %s: %v", common.DefaultClusterName, err)
+		}
+		machines, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("unable to get list of machines in the cluster")
+		}
+		masters := clusterapi.MachinesWithRole(machines.Items, clustercommon.MasterRole)
+		nodes := clusterapi.MachinesWithRole(machines.Items, clustercommon.NodeRole)
+		log.Printf("Upgrading cluster masters")
+		if err = upgradeMachines(masters); err != nil {
+			log.Fatalf("Cluster upgrade failed with error: %v", err)
+		}
+		log.Printf("Upgrading cluster nodes")
+		if err = upgradeMachines(nodes); err != nil {
+			log.Fatalf("Cluster upgrade failed with error: %v", err)
+		}
+		log.Printf("Performing post-upgrade tasks")
+		if err = postUpgradeTasks(masters); err != nil {
+			log.Fatalf("Cluster upgrade failed with error: %v", err)
+		}
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		log.Printf("Cluster upgraded successfully")
+	},
+}
+
+func postUpgradeTasks(masters []clusterv1.Machine) error {
+	// Actions required on upgrade
+	someMaster := masters[0]
+	someMasterSpec, err := providerCodec.GetMachineSpec(someMaster)
+	if err != nil {
+		return fmt.Errorf("Unable to decode machine %q spec: %v", someMaster.Name, err)
+	}
+	someMasterStatus, err := providerCodec.GetMachineStatus(someMaster)
+	if err != nil {
+		return fmt.Errorf("Unable to decode machine %q status: %v", someMaster.Name, err)
+	}
+	currentKubernetesVersion := semver.New(someMasterSpec.ComponentVersions.KubernetesVersion)
+	// When upgrading from < 1.11, or restarting a partially failed upgrade to 1.11
+	if currentKubernetesVersion.LessThan(*semver.New("1.12.0")) {
+		// Remove kube-dns deployment
+		log.Info("[post-upgrade] Removing kube-dns deployment")
+		machineClient, err := sshMachineClientFromSSHConfig(someMasterStatus.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client for machine %q: %v", someMaster.Name, err)
+		}
+		cmd := fmt.Sprintf(`%s --kubeconfig=%s -nkube-system delete --ignore-not-found=true deployment kube-dns`, common.KubectlFile, common.AdminKubeconfig)
+		stdOut, stdErr, err := machineClient.RunCommand(cmd)
+		if err != nil {
+			return fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+		}
+	}
+	return nil
+}
+
+func init() {
+	createCmd.AddCommand(clusterCmdCreate)
+
+	clusterCmdUpdate.Flags().StringSlice("add-san", []string{}, "Subject alternative names, IPs or DNS names, to add to the API server certificate of every master. Provide a comma-separated list, or define multiple flags.")
+	clusterCmdUpdate.Flags().String("audit-policy", "", "Location of an API server audit policy file. Enables audit logging on every master")
+	clusterCmdUpdate.Flags().Int("audit-log-maxage", common.DefaultAuditLogMaxAge, "Number of days to keep rotated audit logs")
+	clusterCmdUpdate.Flags().Int("audit-log-maxbackup", common.DefaultAuditLogMaxBackup, "Number of rotated audit logs to keep")
+	clusterCmdUpdate.Flags().Int("audit-log-maxsize", common.DefaultAuditLogMaxSize, "Size, in megabytes, at which the audit log is rotated")
+	clusterCmdUpdate.Flags().Bool("encrypt-secrets", false, "Encrypt secrets at rest with a generated key")
+	clusterCmdUpdate.Flags().String("control-plane-hook-url", "", "URL sent a POST request, with the API server address of every master, whenever a master is added or removed")
+	clusterCmdUpdate.Flags().String("control-plane-hook-command", "", "Command run on this host, given the API server address of every master on its standard input, whenever a master is added or removed")
+	clusterCmdUpdate.Flags().String("control-plane-endpoint", "", "Address, as host:port, of the external load balancer of the API servers. The kubelet and kube-proxy of every node are pointed at it")
+	clusterCmdUpdate.Flags().Bool("sync-control-plane-endpoints", false, "Run the control plane hook, and point the kubelet and kube-proxy of every node at the API endpoint")
+	clusterCmdUpdate.Flags().Int("router-id", 0, "Virtual router ID for keepalived. Must be in the range [0, 255]. Must be unique within a single L2 network domain.")
+	addVRRPFlags(clusterCmdUpdate)
+	addDNSRecordFlags(clusterCmdUpdate)
+	clusterCmdUpdate.Flags().Bool("sync-dns-record", false, "Register the DNS name of the API endpoint with the DNS provider again, even if its addresses did not change")
+	clusterCmdUpdate.Flags().String("kubeconfig-endpoint", "", "Server of the admin kubeconfig copied to nodes not at a site of --kubeconfig-site-endpoints: vip, dns, or master. Defaults to the server of the kubeconfig of the masters")
+	clusterCmdUpdate.Flags().String("kubeconfig-site-label", "", "Node label whose value is the site of a node, for --kubeconfig-site-endpoints")
+	clusterCmdUpdate.Flags().StringSlice("kubeconfig-site-endpoints", []string{}, "Servers, as site=host:port, of the admin kubeconfig copied to nodes at each site, e.g. NAT addresses. Provide a comma-separated list, or define multiple flags.")
+	addBastionFlags(clusterCmdUpdate)
+	updateCmd.AddCommand(clusterCmdUpdate)
+	clusterCmdCreate.Flags().String("service-cidr", common.DefaultServiceCIDR, "Network CIDR for services e.g. 10.1.0.0/16")
+	clusterCmdCreate.Flags().String("pod-network-cidr", common.DefaultPodNetworkCIDR, "Network CIDR for pods e.g. 10.2.0.0/16")
+	clusterCmdCreate.Flags().String("cluster-dns-domain", common.DefaultClusterDNSDomain, "DNS domain of services, e.g. cluster.local")
+	clusterCmdCreate.Flags().String("service-network", common.DefaultServiceCIDR, "Network CIDR for services e.g. 10.1.0.0/16")
+	clusterCmdCreate.Flags().MarkDeprecated("service-network", "use --service-cidr instead")
+	clusterCmdCreate.Flags().String("pod-network", common.DefaultPodNetworkCIDR, "Network CIDR for pods e.g. 10.2.0.0/16")
+	clusterCmdCreate.Flags().MarkDeprecated("pod-network", "use --pod-network-cidr instead")
+	clusterCmdCreate.Flags().StringVar(&vip, "vip", "", "Virtual IP to be used for multi master setup")
+	clusterCmdCreate.Flags().IntVar(&routerID, "router-id", -1, "Virtual router ID for keepalived for multi master setup. Must be in the range [0, 254]. Must be unique within a single L2 network domain.")
+	addVRRPFlags(clusterCmdCreate)
+	addDNSRecordFlags(clusterCmdCreate)
+	clusterCmdCreate.Flags().String("apiserver-ca-cert", "", "The API Server CA certificate. Used to sign kubelet certificate requests and verify client certificates. May be an intermediate CA, followed by the certificates of the CAs that signed it; see create ca-requests")
+	clusterCmdCreate.Flags().String("apiserver-ca-key", "", "The API Server CA certificate key.")
+	clusterCmdCreate.Flags().String("etcd-ca-cert", "", "The etcd CA certificate. Used to sign and verify client and peer certificates. May be an intermediate CA, followed by the certificates of the CAs that signed it")
+	clusterCmdCreate.Flags().String("etcd-ca-key", "", "The etcd CA certificate key.")
+	clusterCmdCreate.Flags().String("front-proxy-ca-cert", "", "The front proxy CA certificate. Used to verify client certificates on incoming requests. May be an intermediate CA, followed by the certificates of the CAs that signed it")
+	clusterCmdCreate.Flags().String("front-proxy-ca-key", "", "The front proxy CA certificate key.")
+	clusterCmdCreate.Flags().String("sa-private-key", "", "Location of file containing private key used for signing service account tokens")
+	clusterCmdCreate.Flags().String("sa-public-key", "", "Location of file containing public key used for signing service account tokens")
+	clusterCmdCreate.Flags().String("cluster-config", "", "Location of file containing configurable parameters for the cluster")
+	clusterCmdCreate.Flags().StringSlice("apiserver-cert-extra-sans", []string{}, "Extra subject alternative names, IPs or DNS names, e.g. of an external load balancer, for the API server certificate of every master. Provide a comma-separated list, or define multiple flags.")
+	clusterCmdCreate.Flags().String("cni", string(cni.Flannel), "Pod network deployed after each master comes up: flannel, calico, or none. Flannel is deployed by nodeadm")
+	clusterCmdCreate.Flags().String("cni-manifest", "", "Location of a manifest of the pod network, applied from each master instead of the built-in manifest of --cni")
+	clusterCmdCreate.Flags().String("machine-defaults", "", "Location of a YAML file with defaults, per role, for the --port, --iface, --labels, --taints, and --kubelet-config flags of create machine")
+	clusterCmdCreate.Flags().String("kubeadm-config", "", "Location of a file containing a kubeadm ClusterConfiguration with apiServerExtraArgs, controllerManagerExtraArgs, or schedulerExtraArgs, merged into the kubeadm configuration of masters. Its arguments replace those of --cluster-config")
+	clusterCmdCreate.Flags().StringP("file", "f", "", "Location of file containing a cluster object")
+	addBastionFlags(clusterCmdCreate)
+	clusterCmdCreate.Flags().String("remote-bin-dir", common.DefaultRemoteBinDir, "Directory of the kubectl, kubelet, kubeadm, and etcdctl.sh binaries on machines. etcdadm and nodeadm, which the machine provisioner installs, are always in "+common.ProvisionerBinDir)
+	clusterCmdCreate.Flags().String("remote-admin-kubeconfig", common.DefaultAdminKubeconfig, "Path of the admin kubeconfig on masters")
+	clusterCmdCreate.Flags().StringSlice("object-labels", []string{}, "Labels, as key=value, added to every object cctl creates in the state, and to the manifests it renders. Provide a comma-separated list, or define multiple flags.")
+	clusterCmdCreate.Flags().StringArray("object-annotations", []string{}, "Annotations, as key=value, added to every object cctl creates in the state, and to the manifests it renders. Define one flag per annotation.")
+	//clusterCmdCreate.Flags().String("version", "1.10.2", "Kubernetes version")
+
+	deleteCmd.AddCommand(clusterCmdDelete)
+	clusterCmdDelete.Flags().BoolVar(&forceDelete, "force", false, "Force delete a cluster")
+	clusterCmdDelete.Flags().BoolVar(&abandonDelete, "abandon", false, "Remove every object of the cluster from the state, without changing any machine, e.g. to hand the cluster over to another tool")
+
+	getCmd.AddCommand(clusterCmdGet)
+	upgradeCmd.AddCommand(clusterCmdUpgrade)
+	clusterCmdUpgrade.Flags().DurationVar(&drainTimeout, "drain-timeout", common.DrainTimeout, "The length of time to wait before giving up, zero means infinite")
+	clusterCmdUpgrade.Flags().IntVar(&drainGracePeriodSeconds, "drain-grace-period", common.DrainGracePeriodSeconds, "Period of time in seconds given to each pod to terminate gracefully. If negative, the default value specified in the pod will be used.")
+	clusterCmdUpgrade.Flags().BoolVar(&drainDeleteLocalData, "drain-delete-local-data", common.DrainDeleteLocalData, "Continue even if there are pods using emptyDir (local data that will be deleted when the node is drained).")
+	clusterCmdUpgrade.Flags().BoolVar(&drainForce, "drain-force", common.DrainForce, "Continue even if there are pods not managed by a ReplicationController, ReplicaSet, Job, DaemonSet or StatefulSet.")
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/cni"
+)
+
+// setCNI records the pod network of the cluster, and the manifest read from
+// the file, if given, which replaces the built-in manifest of the plugin.
+func setCNI(cluster *clusterv1.Cluster, plugin cni.Plugin, manifestFile string) error {
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	if len(manifestFile) != 0 {
+		manifest, err := ioutil.ReadFile(manifestFile)
+		if err != nil {
+			return fmt.Errorf("unable to read %q: %v", manifestFile, err)
+		}
+		if err := cni.ValidateManifest(manifest); err != nil {
+			return fmt.Errorf("%s is not a valid manifest: %v", manifestFile, err)
+		}
+		cluster.Annotations[common.CNIManifestAnnotationKey] = string(manifest)
+	}
+	cluster.Annotations[common.CNIAnnotationKey] = string(plugin)
+	return nil
+}
+
+// clusterCNI returns the pod network of the cluster, and its manifest, if
+// any. Clusters that do not record their pod network use the flannel
+// deployed by nodeadm.
+func clusterCNI(cluster *clusterv1.Cluster) (cni.Plugin, []byte, error) {
+	name, ok := cluster.Annotations[common.CNIAnnotationKey]
+	if !ok {
+		return cni.Flannel, nil, nil
+	}
+	plugin, err := cni.ParsePlugin(name)
+	if err != nil {
+		return "", nil, err
+	}
+	if manifest, ok := cluster.Annotations[common.CNIManifestAnnotationKey]; ok {
+		return plugin, []byte(manifest), nil
+	}
+	if len(cluster.Spec.ClusterNetwork.Pods.CIDRBlocks) == 0 {
+		return "", nil, fmt.Errorf("cluster has no pod CIDR")
+	}
+	manifest, err := cni.Manifest(plugin, cluster.Spec.ClusterNetwork.Pods.CIDRBlocks[0])
+	return plugin, manifest, err
+}
+
+// ensureCNI deploys the pod network of the cluster from a new master, and
+// removes the flannel that nodeadm deploys on every master, if the cluster
+// does not use flannel. The CNI configuration of flannel is removed from the
+// machine too, so that the kubelet does not select it.
+func ensureCNI(cluster *clusterv1.Cluster, machine *clusterv1.Machine, client sshmachine.Client) error {
+	plugin, manifest, err := clusterCNI(cluster)
+	if err != nil {
+		return err
+	}
+	if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+		kubectl := fmt.Sprintf("%s --kubeconfig=%s", common.KubectlFile, common.AdminKubeconfig)
+		var cmds []string
+		if plugin != cni.Flannel {
+			for _, ds := range cni.FlannelDaemonSets {
+				cmds = append(cmds, fmt.Sprintf("%s -n%s delete --ignore-not-found=true daemonset %s", kubectl, common.KubeSystemNamespace, ds))
+			}
+		}
+		if len(manifest) != 0 {
+			tmpPath := path.Join("/tmp", "cni-manifest.yaml")
+			if err := client.WriteFile(tmpPath, 0600, manifest); err != nil {
+				return fmt.Errorf("unable to write %q: %v", tmpPath, err)
+			}
+			defer client.RemoveFile(tmpPath)
+			cmds = append(cmds, fmt.Sprintf("%s apply -f %s", kubectl, tmpPath))
+		}
+		for _, cmd := range cmds {
+			stdOut, stdErr, err := client.RunCommand(cmd)
+			if err != nil {
+				return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+			}
+		}
+		if len(manifest) != 0 {
+			log.Printf("Deployed pod network %q from machine %q", plugin, machine.Name)
+		}
+	}
+	if plugin == cni.Flannel {
+		return nil
+	}
+	for _, file := range cni.FlannelConfigFiles {
+		if err := client.RemoveFile(file); err != nil {
+			return fmt.Errorf("unable to remove %q: %v", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+)
+
+// machineIPsCmdName is the hidden command the completion scripts run to list
+// the machines in the state.
+const machineIPsCmdName = "__complete-machine-ips"
+
+// machineIPFlags are the flags whose values are completed with the IPs of the
+// machines in the state.
+var machineIPFlags = map[string]bool{
+	"ip":     true,
+	"old-ip": true,
+}
+
+// bashCompletionFunction is called by the bash completion script to complete
+// the machine IP flags. It passes on the --state and --namespace flags of the
+// command line being completed.
+const bashCompletionFunction = `__cctl_machine_ips()
+{
+    local args=() i
+    for ((i=1; i<${#words[@]}; i++)); do
+        case "${words[i]}" in
+            --state|--namespace)
+                args+=("${words[i]}" "${words[i+1]}")
+                ;;
+            --state=*|--namespace=*)
+                args+=("${words[i]}")
+                ;;
+        esac
+    done
+    local out
+    if out=$(cctl "${args[@]}" ` + machineIPsCmdName + ` 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out[*]}" -- "$cur" ) )
+    fi
+}
+`
+
+var completionCmd = &cobra.Command{
+	Use:   "completion SHELL",
+	Short: "Output a shell completion script for bash, zsh, or fish",
+	Long: `Output a shell completion script for bash, zsh, or fish.
+
+In bash and fish, the values of the --ip flags are completed with the IPs of
+the machines in the state file given by --state on the command line, or the
+default state file. In zsh, only commands are completed.
+
+To load completions in the current shell:
+
+  bash: source <(cctl completion bash)
+  zsh:  source <(cctl completion zsh)
+  fish: cctl completion fish | source`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = genBashCompletion(os.Stdout)
+		case "zsh":
+			err = rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			err = genFishCompletion(os.Stdout)
+		default:
+			log.Fatalf("Shell %q is not supported, must be bash, zsh, or fish.", args[0])
+		}
+		if err != nil {
+			log.Fatalf("Unable to generate %s completion: %v", args[0], err)
+		}
+	},
+}
+
+var machineIPsCmdComplete = &cobra.Command{
+	Use:    machineIPsCmdName,
+	Short:  "List the IPs of the machines in the state, for shell completion",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ips, err := stateMachineIPs()
+		if err != nil {
+			// Completion must not print errors in the middle of the command line.
+			os.Exit(1)
+		}
+		for _, ip := range ips {
+			fmt.Println(ip)
+		}
+	},
+}
+
+// stateMachineIPs reads the state file, without locking or changing it, and
+// returns the names of its machines, which are their IPs.
+func stateMachineIPs() ([]string, error) {
+	s := cctlstate.NewWithFile(stateFilename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+	s.ReadOnly = true
+	if err := configureStateSigning(s); err != nil {
+		return nil, err
+	}
+	if err := s.PushToAPIs(); err != nil {
+		return nil, err
+	}
+	machineList, err := s.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, m := range machineList.Items {
+		ips = append(ips, m.Name)
+	}
+	return ips, nil
+}
+
+func genBashCompletion(w io.Writer) error {
+	rootCmd.BashCompletionFunction = bashCompletionFunction
+	visitCommands(rootCmd, func(c *cobra.Command) {
+		c.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+			if machineIPFlags[f.Name] {
+				c.MarkFlagCustom(f.Name, "__cctl_machine_ips")
+			}
+		})
+	})
+	return rootCmd.GenBashCompletion(w)
+}
+
+// genFishCompletion writes a fish completion script. The vendored cobra does
+// not generate one.
+func genFishCompletion(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	buf.WriteString(`# fish completion for cctl
+
+# __cctl_using_path succeeds if the commands on the command line, ignoring
+# flags and their values, are the given path ("exact"), or start with it
+# ("prefix").
+function __cctl_using_path
+    set -l mode $argv[1]
+    set -l path $argv[2..-1]
+    set -l words (commandline -opc)
+    set -e words[1]
+    set -l cmds
+    for w in $words
+        switch $w
+            case '-*'
+            case '*'
+                set cmds $cmds $w
+        end
+    end
+    if test "$mode" = exact
+        test "$cmds" = "$path"
+        return
+    end
+    test (count $cmds) -ge (count $path); or return 1
+    test (count $path) -eq 0; and return 0
+    test "$cmds[1..(count $path)]" = "$path"
+end
+
+function __cctl_machine_ips
+    set -l words (commandline -opc)
+    set -l args
+    for i in (seq (count $words))
+        switch $words[$i]
+            case --state --namespace
+                set -l next (math $i + 1)
+                if test $next -le (count $words)
+                    set args $args $words[$i] $words[$next]
+                end
+            case '--state=*' '--namespace=*'
+                set args $args $words[$i]
+        end
+    end
+    cctl $args ` + machineIPsCmdName + ` 2>/dev/null
+end
+
+complete -c cctl -f
+`)
+	rootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		writeFishFlag(buf, "", f)
+	})
+	visitCommands(rootCmd, func(c *cobra.Command) {
+		path := strings.Join(strings.Fields(c.CommandPath())[1:], " ")
+		for _, sub := range c.Commands() {
+			if !sub.IsAvailableCommand() {
+				continue
+			}
+			fmt.Fprintf(buf, "complete -c cctl -n %s -a %s -d %s\n", fishQuote("__cctl_using_path exact "+path), fishQuote(sub.Name()), fishQuote(sub.Short))
+		}
+		mode := "prefix"
+		if c.HasAvailableSubCommands() {
+			mode = "exact"
+		}
+		c.LocalNonPersistentFlags().VisitAll(func(f *pflag.Flag) {
+			writeFishFlag(buf, fmt.Sprintf("__cctl_using_path %s %s", mode, path), f)
+		})
+	})
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func writeFishFlag(buf *bytes.Buffer, condition string, f *pflag.Flag) {
+	if f.Hidden {
+		return
+	}
+	fmt.Fprintf(buf, "complete -c cctl")
+	if len(condition) != 0 {
+		fmt.Fprintf(buf, " -n %s", fishQuote(condition))
+	}
+	fmt.Fprintf(buf, " -l %s", f.Name)
+	if len(f.Shorthand) != 0 {
+		fmt.Fprintf(buf, " -s %s", f.Shorthand)
+	}
+	switch {
+	case machineIPFlags[f.Name]:
+		buf.WriteString(" -x -a '(__cctl_machine_ips)'")
+	case f.Value.Type() != "bool":
+		buf.WriteString(" -r")
+	}
+	fmt.Fprintf(buf, " -d %s\n", fishQuote(firstLine(f.Usage)))
+}
+
+// visitCommands calls fn for the command and all its available descendants.
+func visitCommands(c *cobra.Command, fn func(*cobra.Command)) {
+	fn(c)
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() {
+			visitCommands(sub, fn)
+		}
+	}
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(machineIPsCmdComplete)
+}
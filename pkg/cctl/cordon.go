@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+)
+
+var cordonCmd = &cobra.Command{
+	Use:   "cordon",
+	Short: "Mark the node of a resource unschedulable",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {},
+}
+
+var uncordonCmd = &cobra.Command{
+	Use:   "uncordon",
+	Short: "Mark the node of a resource schedulable",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {},
+}
+
+var machineCmdCordon = &cobra.Command{
+	Use:   "machine",
+	Short: "Mark the node of a machine unschedulable",
+	Long: `Mark the cluster node of the machine unschedulable, so that no new pods are
+scheduled to it. Pods already running on it are not evicted. The node is
+cordoned from a master, using the admin kubeconfig. The state is not
+changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		if err := setMachineSchedulable(ip, false); err != nil {
+			log.Fatalf("Unable to cordon machine %q: %v", ip, err)
+		}
+		log.Printf("Node of machine %q cordoned successfully.", ip)
+	},
+}
+
+var machineCmdUncordon = &cobra.Command{
+	Use:   "machine",
+	Short: "Mark the node of a machine schedulable",
+	Long: `Mark the cluster node of the machine schedulable, so that pods are scheduled
+to it again. The node is uncordoned from a master, using the admin
+kubeconfig. The state is not changed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		if err := setMachineSchedulable(ip, true); err != nil {
+			log.Fatalf("Unable to uncordon machine %q: %v", ip, err)
+		}
+		log.Printf("Node of machine %q uncordoned successfully.", ip)
+	},
+}
+
+// setMachineSchedulable cordons, or uncordons, the cluster node of the
+// machine. kubectl runs on a master, because only the admin kubeconfig is
+// allowed to change nodes.
+func setMachineSchedulable(ip string, schedulable bool) error {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	nodeName, err := nodeNameForMachine(machine.Name, client)
+	if err != nil {
+		return fmt.Errorf("unable to get node name: %v", err)
+	}
+	if len(nodeName) == 0 {
+		return fmt.Errorf("no cluster node found for machine %q", machine.Name)
+	}
+	masterMachine, masterProvisionedMachine, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return err
+	}
+	masterClient, err := sshMachineClientFromSSHConfig(masterProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", masterMachine.Name, err)
+	}
+	verb := "cordon"
+	if schedulable {
+		verb = "uncordon"
+	}
+	log.Printf("Running %s on cluster node %q of machine %q", verb, nodeName, machine.Name)
+	cmd := fmt.Sprintf("%s --kubeconfig=%s %s %s", common.KubectlFile, common.AdminKubeconfig, verb, nodeName)
+	stdOut, stdErr, err := masterClient.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(cordonCmd)
+	rootCmd.AddCommand(uncordonCmd)
+	cordonCmd.AddCommand(machineCmdCordon)
+	uncordonCmd.AddCommand(machineCmdUncordon)
+	machineCmdCordon.Flags().String("ip", "", "IP of the machine")
+	machineCmdCordon.MarkFlagRequired("ip")
+	machineCmdUncordon.Flags().String("ip", "", "IP of the machine")
+	machineCmdUncordon.MarkFlagRequired("ip")
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+
+	"github.com/platform9/cctl/common"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var bastionCredential bool
+
+// sshKeyPassphrases are the passphrases of the SSH private keys decrypted so
+// far, keyed by the fingerprint of the key, so that the passphrase of each key
+// is read at most once.
+var sshKeyPassphrases = struct {
+	sync.Mutex
+	byKey map[string]string
+}{byKey: make(map[string]string)}
+
+var credentialCmdCreate = &cobra.Command{
+	Use:   "credential",
+	Short: "Create new SSH credential",
+	Run: func(cmd *cobra.Command, args []string) {
+		privateKeyFilename := cmd.Flag("private-key").Value.String()
+		useAgent, err := cmd.Flags().GetBool("ssh-agent")
+		if err != nil {
+			log.Fatalf("Unable to parse --ssh-agent: %v", err)
+		}
+		if useAgent == (len(privateKeyFilename) != 0) {
+			log.Fatalf("Exactly one of --private-key and --ssh-agent must be given.")
+		}
+		// A credential without a private key authenticates using the
+		// ssh-agent, so that the private key is not stored in the state.
+		privateKeyBytes := []byte{}
+		if useAgent {
+			if _, err := sshutil.AgentSigners(); err != nil {
+				log.Warnf("Unable to use ssh-agent: %v. The ssh-agent will be needed to use the credential.", err)
+			}
+		} else {
+			privateKeyBytes, err = ioutil.ReadFile(privateKeyFilename)
+			if err != nil {
+				log.Fatalf("Failed to read private key from %q: %v", privateKeyFilename, err)
+			}
+		}
+		secretName := common.DefaultSSHCredentialSecretName
+		if bastionCredential {
+			secretName = common.DefaultBastionSSHCredentialSecretName
+		}
+		if sshutil.IsEncryptedPrivateKey(string(privateKeyBytes)) {
+			if _, err := decryptSSHPrivateKey(string(privateKeyBytes), secretName); err != nil {
+				log.Fatalf("Unable to decrypt private key %q: %v", privateKeyFilename, err)
+			}
+			log.Printf("Private key %q is protected by a passphrase. The passphrase will be needed to use the credential.", privateKeyFilename)
+		}
+		secret := corev1.Secret{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Secret",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              secretName,
+				Namespace:         namespace,
+				CreationTimestamp: metav1.Now(),
+			},
+			Data: map[string][]byte{
+				"username":       []byte(cmd.Flag("user").Value.String()),
+				"ssh-privatekey": privateKeyBytes,
+			},
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(&secret); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				log.Fatalf("Credential already exists. To create a new credential, first delete the existing one.")
+			}
+			log.Fatalf("Unable to create ssh credential secret: %v", err)
+		}
+		if useAgent {
+			log.Printf("Created ssh credential: user %q and keys from ssh-agent", cmd.Flag("user").Value.String())
+		} else {
+			log.Printf("Created ssh credential: user %q and private key %q", cmd.Flag("user").Value.String(), privateKeyFilename)
+		}
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+	},
+}
+
+var credentialCmdDelete = &cobra.Command{
+	Use:   "credential",
+	Short: "Delete SSH credential",
+	Run: func(cmd *cobra.Command, args []string) {
+		secretName := common.DefaultSSHCredentialSecretName
+		if bastionCredential {
+			secretName = common.DefaultBastionSSHCredentialSecretName
+		}
+		if err := state.KubeClient.CoreV1().Secrets(namespace).Delete(secretName, &metav1.DeleteOptions{}); err != nil {
+			if apierrors.IsNotFound(err) {
+				log.Fatal("SSH credential dooes not exist.")
+			}
+			log.Fatalf("Unable to delete ssh credential secret: %v", err)
+		}
+		log.Println("Deleted ssh credential")
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+	},
+}
+
+// decryptSSHPrivateKey returns the private key of the credential, decrypted if
+// it is protected by a passphrase. The passphrase is read from the keychain,
+// the environment, or, if neither has it, the terminal, and is kept for the
+// next use of the key.
+func decryptSSHPrivateKey(privateKey, credential string) (string, error) {
+	if !sshutil.IsEncryptedPrivateKey(privateKey) {
+		return privateKey, nil
+	}
+	if err := sshutil.CheckEncryptedPrivateKey(privateKey); err != nil {
+		return "", err
+	}
+	fingerprint := sshutil.PrivateKeyFingerprint(privateKey)
+	sshKeyPassphrases.Lock()
+	defer sshKeyPassphrases.Unlock()
+	p, ok := sshKeyPassphrases.byKey[fingerprint]
+	if !ok {
+		var err error
+		if p, err = readSSHKeyPassphrase(credential); err != nil {
+			return "", err
+		}
+	}
+	decrypted, err := sshutil.DecryptPrivateKey(privateKey, p)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt SSH private key of credential %q: %v", credential, err)
+	}
+	sshKeyPassphrases.byKey[fingerprint] = p
+	return decrypted, nil
+}
+
+// readSSHKeyPassphrase reads the passphrase of the private key of the
+// credential. The passphrase of the bastion credential has a keychain account
+// and environment variable of its own; if neither has it, the passphrase of
+// the machine credential is used, as the two credentials often share a key.
+func readSSHKeyPassphrase(credential string) (string, error) {
+	account, envVar := common.KeychainSSHKeyPassphraseAccount, common.SSHKeyPassphraseEnvVar
+	if credential == common.DefaultBastionSSHCredentialSecretName {
+		if p, ok := passphrase(common.KeychainBastionSSHKeyPassphraseAccount, common.BastionSSHKeyPassphraseEnvVar); ok {
+			return p, nil
+		}
+		if p, ok := passphrase(account, envVar); ok {
+			return p, nil
+		}
+		account, envVar = common.KeychainBastionSSHKeyPassphraseAccount, common.BastionSSHKeyPassphraseEnvVar
+	} else if p, ok := passphrase(account, envVar); ok {
+		return p, nil
+	}
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("SSH private key of credential %q is protected by a passphrase: set %s, or store the passphrase with `cctl create keychain-secret --name %s`", credential, envVar, account)
+	}
+	p, err := readSecret(fmt.Sprintf("Enter passphrase of SSH private key of credential %q: ", credential))
+	if err != nil {
+		return "", fmt.Errorf("unable to read SSH private key passphrase: %v", err)
+	}
+	return p, nil
+}
+
+func init() {
+	createCmd.AddCommand(credentialCmdCreate)
+	credentialCmdCreate.Flags().String("user", "root", "SSH username")
+	credentialCmdCreate.Flags().String("private-key", "", "SSH privateKey file location")
+	credentialCmdCreate.Flags().Bool("ssh-agent", false, fmt.Sprintf("Authenticate using the keys held by the ssh-agent at %s, instead of storing a private key in the state", sshutil.AgentSocketEnvVar))
+	credentialCmdCreate.Flags().BoolVar(&bastionCredential, "bastion", false, "Create the credential used to SSH to the bastion")
+
+	deleteCmd.AddCommand(credentialCmdDelete)
+	credentialCmdDelete.Flags().BoolVar(&bastionCredential, "bastion", false, "Delete the credential used to SSH to the bastion")
+}
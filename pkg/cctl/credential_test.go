@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/platform9/cctl/common"
+)
+
+func encryptedTestKey(t *testing.T, passphrase string) (string, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	der := x509.MarshalPKCS1PrivateKey(key)
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", der, []byte(passphrase), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("unable to encrypt key: %v", err)
+	}
+	return string(pem.EncodeToMemory(block)), string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+}
+
+func TestDecryptSSHPrivateKeyPerCredential(t *testing.T) {
+	defer func(byKey map[string]string) { sshKeyPassphrases.byKey = byKey }(sshKeyPassphrases.byKey)
+	sshKeyPassphrases.byKey = make(map[string]string)
+	defer os.Unsetenv(common.SSHKeyPassphraseEnvVar)
+	defer os.Unsetenv(common.BastionSSHKeyPassphraseEnvVar)
+	os.Setenv(common.SSHKeyPassphraseEnvVar, "machine")
+	os.Setenv(common.BastionSSHKeyPassphraseEnvVar, "bastion")
+
+	machineKey, machinePlain := encryptedTestKey(t, "machine")
+	bastionKey, bastionPlain := encryptedTestKey(t, "bastion")
+	if decrypted, err := decryptSSHPrivateKey(machineKey, common.DefaultSSHCredentialSecretName); err != nil || decrypted != machinePlain {
+		t.Fatalf("unable to decrypt machine key: %v", err)
+	}
+	if decrypted, err := decryptSSHPrivateKey(bastionKey, common.DefaultBastionSSHCredentialSecretName); err != nil || decrypted != bastionPlain {
+		t.Fatalf("unable to decrypt bastion key: %v", err)
+	}
+
+	// The passphrase of each key is kept once it decrypts the key.
+	os.Setenv(common.SSHKeyPassphraseEnvVar, "changed")
+	os.Setenv(common.BastionSSHKeyPassphraseEnvVar, "changed")
+	if _, err := decryptSSHPrivateKey(machineKey, common.DefaultSSHCredentialSecretName); err != nil {
+		t.Errorf("expected the passphrase of the machine key to be kept, got %v", err)
+	}
+	if _, err := decryptSSHPrivateKey(bastionKey, common.DefaultBastionSSHCredentialSecretName); err != nil {
+		t.Errorf("expected the passphrase of the bastion key to be kept, got %v", err)
+	}
+	otherKey, _ := encryptedTestKey(t, "machine")
+	if _, err := decryptSSHPrivateKey(otherKey, common.DefaultSSHCredentialSecretName); err == nil {
+		t.Errorf("expected the passphrase of one key not to be used for another")
+	}
+
+	// Without a passphrase of its own, the bastion key is decrypted with the
+	// passphrase of the machine key.
+	os.Unsetenv(common.BastionSSHKeyPassphraseEnvVar)
+	os.Setenv(common.SSHKeyPassphraseEnvVar, "shared")
+	sharedKey, _ := encryptedTestKey(t, "shared")
+	if _, err := decryptSSHPrivateKey(sharedKey, common.DefaultBastionSSHCredentialSecretName); err != nil {
+		t.Errorf("expected the bastion key to be decrypted with the machine passphrase, got %v", err)
+	}
+}
@@ -14,7 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
+package cctl
 
 import (
 	"fmt"
@@ -29,11 +29,11 @@ var deleteCmd = &cobra.Command{
 	Short: "Used to delete resources",
 	Args:  cobra.MinimumNArgs(1),
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		InitState()
+		initState()
 		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
-		// Therefore LogLevel must be set in all the PersistentPreRuns
-		if err := log.SetLogLevelUsingString(LogLevel); err != nil {
-			log.Fatalf("Unable to parse log level %s", LogLevel)
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -0,0 +1,213 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/archive"
+)
+
+const redactedValue = "REDACTED"
+
+// machineDiagnostic is a command whose output is collected from every
+// machine.
+type machineDiagnostic struct {
+	file    string
+	command string
+}
+
+// machineDiagnostics returns the commands run on every machine. Journal logs
+// are limited to entries newer than since.
+func machineDiagnostics(since time.Duration) []machineDiagnostic {
+	journal := func(unit string) string {
+		return fmt.Sprintf("journalctl --no-pager --unit %s --since -%ds", unit, int64(since.Seconds()))
+	}
+	return []machineDiagnostic{
+		{"journal/kubelet.log", journal("kubelet")},
+		{"journal/etcd.log", journal("etcd")},
+		{"journal/keepalived.log", journal(common.KeepalivedService)},
+		{"versions/kubeadm.txt", fmt.Sprintf("%s version", common.KubeadmFile)},
+		{"versions/etcdadm.txt", fmt.Sprintf("%s version", common.EtcdadmFile)},
+	}
+}
+
+var diagnoseCmd = &cobra.Command{
+	Use:   "diagnose",
+	Short: "Collect logs, versions, and state from all machines into an archive for support cases",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		output := cmd.Flag("output").Value.String()
+		if len(output) == 0 {
+			output = fmt.Sprintf("%s-%s.tar.gz", common.DiagnosticsFileNamePrefix, time.Now().Format(time.RFC3339))
+		}
+		since, err := cmd.Flags().GetDuration("since")
+		if err != nil {
+			log.Fatalf("Unable to parse --since: %v", err)
+		}
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatalf("Unable to create %q: %v", output, err)
+		}
+		defer f.Close()
+		w := archive.NewWriter(f)
+
+		if err := collectStateDiagnostics(w); err != nil {
+			log.Fatalf("Unable to collect state: %v", err)
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		for i := range machineList.Items {
+			machine := &machineList.Items[i]
+			log.Printf("[%d/%d] Collecting diagnostics from machine %q", i+1, len(machineList.Items), machine.Name)
+			if err := collectMachineDiagnostics(w, machine, since); err != nil {
+				log.Errorf("Unable to collect diagnostics from machine %q: %v", machine.Name, err)
+				if err := w.WriteFile(path.Join(machine.Name, "error.txt"), []byte(err.Error())); err != nil {
+					log.Fatalf("Unable to write diagnostics: %v", err)
+				}
+			}
+		}
+		if err := w.Close(); err != nil {
+			log.Fatalf("Unable to write diagnostics: %v", err)
+		}
+		log.Printf("Diagnostics written to %s", output)
+	},
+}
+
+// collectStateDiagnostics adds the cctl state to the archive. Secret values
+// are redacted.
+func collectStateDiagnostics(w *archive.Writer) error {
+	clusterList, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list clusters: %v", err)
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	pmList, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list provisioned machines: %v", err)
+	}
+	secretList, err := state.KubeClient.CoreV1().Secrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list secrets: %v", err)
+	}
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		for k := range secret.Data {
+			secret.Data[k] = []byte(redactedValue)
+		}
+		for k := range secret.StringData {
+			secret.StringData[k] = redactedValue
+		}
+	}
+	objs := []struct {
+		file string
+		obj  interface{}
+	}{
+		{"state/clusters.yaml", clusterList},
+		{"state/machines.yaml", machineList},
+		{"state/provisionedmachines.yaml", pmList},
+		{"state/secrets.yaml", secretList},
+	}
+	for _, o := range objs {
+		b, err := yaml.Marshal(o.obj)
+		if err != nil {
+			return fmt.Errorf("unable to marshal %q to yaml: %v", o.file, err)
+		}
+		if err := w.WriteFile(o.file, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectMachineDiagnostics adds the output of the diagnostic commands, and
+// the static pod manifests, of the machine to the archive. A command that
+// fails does not stop collection; its error is recorded in the archive.
+func collectMachineDiagnostics(w *archive.Writer, machine *clusterv1.Machine, since time.Duration) error {
+	machineClient, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	for _, d := range machineDiagnostics(since) {
+		file := path.Join(machine.Name, d.file)
+		stdOut, stdErr, err := machineClient.RunCommand(d.command)
+		if err := w.WriteFile(file, stdOut); err != nil {
+			return err
+		}
+		if err != nil {
+			msg := fmt.Sprintf("%q failed: %v\nstderr:\n%s", d.command, err, stdErr)
+			if err := w.WriteFile(file+".error", []byte(msg)); err != nil {
+				return err
+			}
+		}
+	}
+	return collectStaticPodManifests(w, machine.Name, machineClient)
+}
+
+func collectStaticPodManifests(w *archive.Writer, machineName string, machineClient sshmachine.Client) error {
+	exists, err := machineClient.Exists(common.StaticPodManifestsDir)
+	if err != nil || !exists {
+		return nil
+	}
+	stdOut, _, err := machineClient.RunCommand(fmt.Sprintf("ls -1 %s", common.StaticPodManifestsDir))
+	if err != nil {
+		log.Debugf("Unable to list static pod manifests on machine %q: %v", machineName, err)
+		return nil
+	}
+	for _, name := range strings.Fields(string(stdOut)) {
+		data, err := machineClient.ReadFile(path.Join(common.StaticPodManifestsDir, name))
+		if err != nil {
+			log.Debugf("Unable to read static pod manifest %q on machine %q: %v", name, machineName, err)
+			continue
+		}
+		if err := w.WriteFile(path.Join(machineName, "manifests", name), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(diagnoseCmd)
+	diagnoseCmd.Flags().String("output", "", fmt.Sprintf("File path for the diagnostics archive (default \"%s-<timestamp>.tar.gz\" created in current directory)", common.DiagnosticsFileNamePrefix))
+	diagnoseCmd.Flags().Duration("since", 24*time.Hour, "Collect journal logs newer than this duration")
+}
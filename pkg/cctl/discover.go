@@ -0,0 +1,195 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/discover"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// discoverCmd represents the discover command
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Used to find resources that can be added to the cluster",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Discover called")
+	},
+}
+
+var machinesCmdDiscover = &cobra.Command{
+	Use:   "machines",
+	Short: "Find hosts in a CIDR that can be adopted as machines",
+	Long: `Find hosts in a CIDR that can be adopted as machines. A host is usable if it
+is not already a machine, the SSH credential authenticates to it, it can run
+commands with sudo, and its OS matches one of the --os patterns. Host keys are
+not verified; give them when creating each machine, or scan them afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cidr := cmd.Flag("cidr").Value.String()
+		if len(cidr) == 0 {
+			log.Fatalf("Must give --cidr.")
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Unable to parse `port` flag: %v", err)
+		}
+		secretName := cmd.Flag("ssh-secret").Value.String()
+		osPatterns, err := cmd.Flags().GetStringSlice("os")
+		if err != nil {
+			log.Fatalf("Unable to parse `os` flag: %v", err)
+		}
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse `timeout` flag: %v", err)
+		}
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil {
+			log.Fatalf("Unable to parse `concurrency` flag: %v", err)
+		}
+		outputFile := cmd.Flag("output-file").Value.String()
+
+		hosts, err := discover.Hosts(cidr)
+		if err != nil {
+			log.Fatalf("Unable to list hosts: %v", err)
+		}
+		probe, err := newDiscoveryProbe(port, secretName, osPatterns, timeout)
+		if err != nil {
+			log.Fatalf("Unable to prepare discovery: %v", err)
+		}
+		log.Printf("Scanning %d hosts in %s for SSH on port %d", len(hosts), cidr, port)
+		candidates := discover.Scan(hosts, concurrency, probe)
+		if len(candidates) == 0 {
+			log.Println("No SSH-reachable hosts found")
+			return
+		}
+		t := template.Must(template.New("DiscoveredMachinePrintTemplate").Parse(common.DiscoveredMachinePrintTemplate))
+		if err := t.Execute(os.Stdout, candidates); err != nil {
+			log.Fatalf("Could not pretty print discovered machines: %s", err)
+		}
+		var usable []string
+		for _, c := range candidates {
+			if c.Usable {
+				usable = append(usable, c.IP)
+			}
+		}
+		if len(outputFile) != 0 {
+			b, err := yaml.Marshal(usable)
+			if err != nil {
+				log.Fatalf("Unable to encode usable hosts: %v", err)
+			}
+			if err := ioutil.WriteFile(outputFile, b, 0644); err != nil {
+				log.Fatalf("Unable to write usable hosts to %q: %v", outputFile, err)
+			}
+			log.Printf("Wrote %d usable hosts to %q", len(usable), outputFile)
+		}
+	},
+}
+
+// newDiscoveryProbe returns a probe that connects to a host using the SSH
+// credential, and reads its OS release.
+func newDiscoveryProbe(port int, secretName string, osPatterns []string, timeout time.Duration) (discover.Probe, error) {
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to find SSH credential %q", secretName)
+		}
+		return nil, fmt.Errorf("unable to get SSH credential secret: %v", err)
+	}
+	username, privateKey, err := providerCodec.UsernameAndKeyFromSecret(secret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH credential from secret: %v", err)
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	existing := make(map[string]bool)
+	for _, m := range machineList.Items {
+		existing[m.Name] = true
+	}
+	builder, err := newMachineClientBuilder()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create machine client builder: %v", err)
+	}
+	dial := sshutil.TCPDialer(timeout)
+	return func(host string) (discover.Candidate, bool) {
+		conn, err := dial(net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return discover.Candidate{}, false
+		}
+		conn.Close()
+		c := discover.Candidate{IP: host}
+		if existing[host] {
+			c.Reason = "already a machine"
+			return c, true
+		}
+		client, err := builder(host, port, username, privateKey, nil, true)
+		if err != nil {
+			c.Reason = fmt.Sprintf("unable to authenticate: %v", err)
+			return c, true
+		}
+		cmd := "cat /etc/os-release"
+		stdOut, stdErr, err := client.RunCommand(cmd)
+		if err != nil {
+			c.Reason = fmt.Sprintf("error running %q: %v (stderr: %q)", cmd, err, string(stdErr))
+			return c, true
+		}
+		osRelease := discover.ParseOSRelease(stdOut)
+		c.OS = osRelease.String()
+		if !discover.MatchesOS(osRelease, osPatterns) {
+			c.Reason = fmt.Sprintf("OS does not match %v", osPatterns)
+			return c, true
+		}
+		c.Usable = true
+		return c, true
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(discoverCmd)
+	discoverCmd.AddCommand(machinesCmdDiscover)
+	machinesCmdDiscover.Flags().String("cidr", "", "IPv4 CIDR to scan, e.g. 10.0.0.0/24")
+	machinesCmdDiscover.Flags().Int("port", common.DefaultSSHPort, "SSH port")
+	machinesCmdDiscover.Flags().String("ssh-secret", common.DefaultSSHCredentialSecretName, "Name of the SSH credential secret used to authenticate")
+	machinesCmdDiscover.Flags().StringSlice("os", []string{}, "Operating systems to accept, as an ID or ID-version prefix from /etc/os-release, e.g. ubuntu or centos-7. Provide a comma-separated list, or define multiple flags. By default, every OS is accepted")
+	machinesCmdDiscover.Flags().Duration("timeout", 2*time.Second, "How long to wait for each host to accept a connection")
+	machinesCmdDiscover.Flags().Int("concurrency", 32, "Number of hosts to probe at a time")
+	machinesCmdDiscover.Flags().String("output-file", "", "Write a YAML list of the usable hosts to this file")
+}
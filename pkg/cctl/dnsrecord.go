@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/dnsrecord"
+)
+
+// dnsRecordFlags are the flags of create and update cluster that configure
+// the DNS record of the API endpoint.
+var dnsRecordFlags = []string{"dns-provider", "dns-name", "dns-ttl", "dns-provider-options"}
+
+// addDNSRecordFlags adds the flags that configure the DNS record of the API
+// endpoint.
+func addDNSRecordFlags(cmd *cobra.Command) {
+	cmd.Flags().String("dns-provider", "", fmt.Sprintf("DNS provider that registers --dns-name for the API endpoint: %s. An empty value removes the DNS record settings", strings.Join(dnsrecord.Providers(), ", ")))
+	cmd.Flags().String("dns-name", "", "DNS name of the API endpoint, added to the API server certificate of every master")
+	cmd.Flags().Int("dns-ttl", 0, fmt.Sprintf("TTL, in seconds, of the DNS record of the API endpoint. Defaults to %d", dnsrecord.DefaultTTL))
+	cmd.Flags().StringSlice("dns-provider-options", []string{}, "Options, as key=value, of --dns-provider: command for script; url for webhook; hosted-zone-id and aws for route53; wapi-url and view for infoblox. Provide a comma-separated list, or define multiple flags.")
+}
+
+// setDNSRecord records the DNS record flags given to the command in the
+// cluster. Flags not given keep their recorded value. An empty provider
+// removes the settings. The addresses last registered are forgotten, so that
+// the changed record is registered again.
+func setDNSRecord(cmd *cobra.Command, cluster *clusterv1.Cluster) error {
+	config, _, err := dnsRecordConfig(cluster)
+	if err != nil {
+		return err
+	}
+	if cmd.Flag("dns-provider").Changed {
+		config.Provider = cmd.Flag("dns-provider").Value.String()
+	}
+	if cmd.Flag("dns-name").Changed {
+		config.Name = cmd.Flag("dns-name").Value.String()
+	}
+	if cmd.Flag("dns-ttl").Changed {
+		if config.TTL, err = cmd.Flags().GetInt("dns-ttl"); err != nil {
+			return fmt.Errorf("unable to parse `dns-ttl`: %v", err)
+		}
+	}
+	if cmd.Flag("dns-provider-options").Changed {
+		pairs, err := cmd.Flags().GetStringSlice("dns-provider-options")
+		if err != nil {
+			return fmt.Errorf("unable to parse `dns-provider-options`: %v", err)
+		}
+		if config.Options, err = dnsrecord.ParseOptions(pairs); err != nil {
+			return err
+		}
+	}
+	if len(config.Provider) == 0 {
+		if !cmd.Flag("dns-provider").Changed {
+			return fmt.Errorf("--dns-provider is required")
+		}
+		delete(cluster.Annotations, common.DNSRecordAnnotationKey)
+		return nil
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	config.Addresses = nil
+	return saveDNSRecordConfig(cluster, config)
+}
+
+func saveDNSRecordConfig(cluster *clusterv1.Cluster, config dnsrecord.Config) error {
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("unable to encode DNS record settings: %v", err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[common.DNSRecordAnnotationKey] = string(configJSON)
+	return nil
+}
+
+// dnsRecordConfig returns the DNS record settings recorded in the cluster.
+// It returns false if the cluster has none.
+func dnsRecordConfig(cluster *clusterv1.Cluster) (dnsrecord.Config, bool, error) {
+	var config dnsrecord.Config
+	value, ok := cluster.Annotations[common.DNSRecordAnnotationKey]
+	if !ok {
+		return config, false, nil
+	}
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return config, false, fmt.Errorf("unable to decode DNS record settings: %v", err)
+	}
+	return config, true, nil
+}
+
+// dnsAPIEndpoint returns the address, as name:port, of the API endpoint by
+// the DNS name of the cluster, or an empty address if it has none.
+func dnsAPIEndpoint(cluster *clusterv1.Cluster) (string, error) {
+	config, ok, err := dnsRecordConfig(cluster)
+	if err != nil || !ok {
+		return "", err
+	}
+	return net.JoinHostPort(strings.TrimSuffix(config.Name, "."), strconv.Itoa(common.DefaultAPIServerPort)), nil
+}
+
+// apiEndpointAddresses returns the addresses the DNS name of the cluster
+// resolves to: the VIP, if any; the address of the endpoint of the control
+// plane hook, if it is an IP; or the IP of every master.
+func apiEndpointAddresses(cluster *clusterv1.Cluster) ([]string, error) {
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if clusterSpec.VIPConfiguration != nil {
+		return []string{clusterSpec.VIPConfiguration.IP}, nil
+	}
+	hook, _, err := controlPlaneHook(cluster)
+	if err != nil {
+		return nil, err
+	}
+	if host, _, err := net.SplitHostPort(hook.Endpoint); err == nil && net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	var addresses []string
+	for _, m := range clusterapi.MachinesWithRole(machineList.Items, clustercommon.MasterRole) {
+		addresses = append(addresses, m.Name)
+	}
+	return addresses, nil
+}
+
+// syncDNSRecord registers the DNS record of the API endpoint with the DNS
+// provider of the cluster, if the addresses of the endpoint changed since
+// they were last registered, or if force is true, and records them. It does
+// nothing if the cluster has no DNS record settings, or the endpoint has no
+// addresses yet.
+func syncDNSRecord(force bool) error {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	config, ok, err := dnsRecordConfig(cluster)
+	if err != nil || !ok {
+		return err
+	}
+	addresses, err := apiEndpointAddresses(cluster)
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		log.Printf("Not registering DNS name %q: the cluster has no masters yet", config.Name)
+		return nil
+	}
+	config, registered, err := dnsrecord.Register(config, cluster.Name, namespace, addresses, force, common.DNSRecordTimeout)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		log.Debugf("DNS name %q is already registered for %s", config.Name, strings.Join(addresses, ", "))
+		return nil
+	}
+	log.Printf("Registered DNS name %q for %s", config.Name, strings.Join(config.Addresses, ", "))
+	if err := saveDNSRecordConfig(cluster, config); err != nil {
+		return err
+	}
+	if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Update(cluster); err != nil {
+		return fmt.Errorf("unable to update cluster: %v", err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
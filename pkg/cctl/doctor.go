@@ -0,0 +1,350 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	stateutil "github.com/platform9/cctl/pkg/state/util"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/doctor"
+	"github.com/platform9/cctl/pkg/util/filelock"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// doctorDialTimeout limits how long doctor waits to connect to the bastion.
+const doctorDialTimeout = 10 * time.Second
+
+// doctorReport is the report printed by doctor.
+type doctorReport struct {
+	Results []doctor.Result `json:"results"`
+	Go      bool            `json:"go"`
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that the local environment is ready to change the cluster",
+	Long: `Check that the local environment is ready to change the cluster, and report
+go or no-go. Run it before risky operations, e.g. upgrades or deleting masters.
+
+The checks are:
+
+  - the state file is readable, and at the current version, or else it must
+    be migrated with cctl state migrate;
+  - no other invocation holds the state lock, and no operation is running;
+  - the state file and the --signing-key file, which hold private keys, are
+    readable only by their owner;
+  - the state file is signed, if --signing-key is given;
+  - the provider configs of clusters and machines are current, or else they
+    must be migrated with cctl state migrate;
+  - the ssh-agent holds keys, if the SSH credential is kept in it;
+  - the bastion, if any, accepts connections;
+  - the first master accepts SSH connections and runs commands;
+  - cctl supports the Kubernetes version of every machine.
+
+Warnings do not stop risky operations. Failures do, and doctor exits non-zero.
+The state is only read, so doctor runs while another invocation holds the
+state lock.`,
+	// The state lock is checked, not acquired.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		results := runDoctorChecks()
+		report := doctorReport{Results: results, Go: doctor.Go(results)}
+		switch outputFmt := cmd.Flag("output").Value.String(); outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(report)
+			if err != nil {
+				log.Fatalf("Unable to marshal report to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(report)
+			if err != nil {
+				log.Fatalf("Unable to marshal report to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("DoctorPrintTemplate").Parse(common.DoctorPrintTemplate))
+			if err := t.Execute(os.Stdout, report); err != nil {
+				log.Fatalf("Could not pretty print report: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+		if !report.Go {
+			log.Fatalf("The local environment is not ready to change the cluster")
+		}
+	},
+}
+
+// runDoctorChecks checks the local environment. Checks that need the state
+// are skipped if it cannot be read.
+func runDoctorChecks() []doctor.Result {
+	results := []doctor.Result{checkStateFile()}
+	stateReadable := results[0].Status == doctor.StatusOK
+	if stateReadable {
+		results = append(results, checkStateMigration(), checkPrivateFile("state-file-permissions", stateFilename))
+		stateReadable = results[1].Status == doctor.StatusOK
+	} else {
+		results = append(results, doctor.Skipped("state-migration", "state file is not readable"), doctor.Skipped("state-file-permissions", "state file is not readable"))
+	}
+	results = append(results, checkStateLock(), checkOperations())
+	if len(signingKeyFile) != 0 {
+		results = append(results, checkPrivateFile("signing-key-permissions", signingKeyFile))
+	}
+	if !stateReadable {
+		for _, check := range []string{"state-signature", "provider-configs", "ssh-agent", "bastion", "master-connectivity", "kubernetes-version"} {
+			results = append(results, doctor.Skipped(check, "state file is not readable, or not at the current version"))
+		}
+		return results
+	}
+	r, ok := checkStateSignature()
+	results = append(results, r)
+	if !ok {
+		for _, check := range []string{"provider-configs", "ssh-agent", "bastion", "master-connectivity", "kubernetes-version"} {
+			results = append(results, doctor.Skipped(check, "state cannot be read"))
+		}
+		return results
+	}
+	r = checkProviderConfigs()
+	results = append(results, r)
+	if r.Status != doctor.StatusOK {
+		for _, check := range []string{"ssh-agent", "bastion", "master-connectivity", "kubernetes-version"} {
+			results = append(results, doctor.Skipped(check, "provider configs cannot be decoded"))
+		}
+		return results
+	}
+	return append(results, checkSSHAgent(), checkBastion(), checkMasterConnectivity(), checkKubernetesVersions())
+}
+
+func checkStateFile() doctor.Result {
+	const check = "state-file"
+	f, err := os.Open(stateFilename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return doctor.Failed(check, "give the state file with --state", "state file %q does not exist", stateFilename)
+		}
+		return doctor.Failed(check, "give the state file with --state, and make it readable", "unable to open state file: %v", err)
+	}
+	defer f.Close()
+	return doctor.OK(check, "%s", stateFilename)
+}
+
+func checkStateMigration() doctor.Result {
+	const check = "state-migration"
+	version, err := stateutil.VersionFromFile(stateFilename)
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "unable to read version of state file: %v", err)
+	}
+	if version < int(cctlstate.Version) {
+		return doctor.Failed(check, "run cctl state migrate", "state file version is %d, must be %d", version, cctlstate.Version)
+	}
+	if version > int(cctlstate.Version) {
+		return doctor.Failed(check, "use the cctl version that wrote the state file", "state file version %d is newer than %d, the version this cctl supports", version, cctlstate.Version)
+	}
+	return doctor.OK(check, "state file version is %d", version)
+}
+
+func checkStateLock() doctor.Result {
+	const check = "state-lock"
+	holder, stale, err := filelock.Check(stateFilename + common.StateLockFileSuffix)
+	switch {
+	case err != nil:
+		return doctor.Failed(check, "make the lock file readable", "%v", err)
+	case holder == nil:
+		return doctor.OK(check, "not held")
+	case stale:
+		return doctor.Warning(check, "none; the next invocation removes the stale lock", "held by %s, which is no longer running", holder)
+	default:
+		return doctor.Failed(check, "wait for the other invocation to finish", "held by %s", holder)
+	}
+}
+
+func checkOperations() doctor.Result {
+	const check = "operations"
+	now := time.Now()
+	operations, err := listOperations(now)
+	if err != nil {
+		return doctor.Failed(check, "make the operation leases readable", "unable to list operations: %v", err)
+	}
+	var expired []operation
+	for _, op := range operations {
+		if op.Expires.After(now) {
+			return doctor.Failed(check, "wait for the operation to finish; see get operations", "%q by %s in namespace %q is running", op.Operation, op.Holder, op.Namespace)
+		}
+		expired = append(expired, op)
+	}
+	if len(expired) != 0 {
+		op := expired[0]
+		return doctor.Warning(check, "check that the operation did not leave the cluster half changed; the next command takes over the lease", "%q by %s in namespace %q expired without finishing", op.Operation, op.Holder, op.Namespace)
+	}
+	return doctor.OK(check, "none running")
+}
+
+func checkPrivateFile(check, filename string) doctor.Result {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return doctor.Failed(check, "make the file readable", "unable to stat %q: %v", filename, err)
+	}
+	if err := doctor.PrivateFileMode(info.Mode()); err != nil {
+		return doctor.Failed(check, fmt.Sprintf("run chmod 600 %s", filename), "%q: %v", filename, err)
+	}
+	return doctor.OK(check, "%q has mode %04o", filename, info.Mode().Perm())
+}
+
+// checkStateSignature reads the state, and verifies its signature if
+// --signing-key is given. The read state is used by the checks that follow.
+// It returns false if the state cannot be read.
+func checkStateSignature() (doctor.Result, bool) {
+	const check = "state-signature"
+	s, err := readStateVersion(currentStateVersion)
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup, or give the right --signing-key", "unable to read state: %v", err), false
+	}
+	state = s
+	if err := applyRemotePaths(); err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "unable to configure remote paths: %v", err), false
+	}
+	if len(signingKeyFile) == 0 {
+		return doctor.Warning(check, "give --signing-key to detect changes made to the state file outside cctl", "not verified, no signing key given"), true
+	}
+	return doctor.OK(check, "verified"), true
+}
+
+func checkProviderConfigs() doctor.Result {
+	const check = "provider-configs"
+	legacy, err := stateutil.LegacyProviderConfigs(state.ClusterClient)
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "%v", err)
+	}
+	if len(legacy) != 0 {
+		return doctor.Failed(check, "run cctl state migrate", "written by an older version of the ssh-provider: %s", strings.Join(legacy, ", "))
+	}
+	return doctor.OK(check, "current")
+}
+
+func checkSSHAgent() doctor.Result {
+	const check = "ssh-agent"
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultSSHCredentialSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return doctor.Skipped(check, "no SSH credential")
+		}
+		return doctor.Failed(check, "restore the state file from a backup", "unable to get SSH credential secret: %v", err)
+	}
+	_, privateKey, err := providerCodec.UsernameAndKeyFromSecret(secret)
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "unable to read SSH credential from secret: %v", err)
+	}
+	if len(privateKey) != 0 {
+		return doctor.Skipped(check, "SSH credential is kept in the state")
+	}
+	signers, err := sshutil.AgentSigners()
+	if err != nil {
+		return doctor.Failed(check, "start ssh-agent, and add the SSH key with ssh-add", "%v", err)
+	}
+	if len(signers) == 0 {
+		return doctor.Failed(check, "add the SSH key with ssh-add", "ssh-agent holds no keys")
+	}
+	return doctor.OK(check, "ssh-agent holds %d keys", len(signers))
+}
+
+func checkBastion() doctor.Result {
+	const check = "bastion"
+	bastion, err := clusterBastion()
+	if err != nil {
+		return doctor.Failed(check, "fix the bastion with update cluster", "%v", err)
+	}
+	if bastion == nil {
+		return doctor.Skipped(check, "cluster has no bastion")
+	}
+	address := net.JoinHostPort(bastion.Host, strconv.Itoa(bastion.Port))
+	conn, err := net.DialTimeout("tcp", address, doctorDialTimeout)
+	if err != nil {
+		return doctor.Failed(check, "check the network between this host and the bastion", "unable to connect to %s: %v", address, err)
+	}
+	conn.Close()
+	return doctor.OK(check, "%s accepts connections", address)
+}
+
+func checkMasterConnectivity() doctor.Result {
+	const check = "master-connectivity"
+	masters, err := masterMachines()
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "%v", err)
+	}
+	if len(masters) == 0 {
+		return doctor.Skipped(check, "cluster has no masters")
+	}
+	_, pm, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "%v", err)
+	}
+	client, err := sshMachineClientFromSSHConfig(pm.Spec.SSHConfig)
+	if err != nil {
+		return doctor.Failed(check, "check the SSH credential, and the network between this host and the master", "unable to connect to %s: %v", pm.Spec.SSHConfig.Host, err)
+	}
+	if _, stdErr, err := client.RunCommand("true"); err != nil {
+		return doctor.Failed(check, "check that the SSH user can run commands on the master", "unable to run a command on %s: %v (stderr: %q)", pm.Spec.SSHConfig.Host, err, string(stdErr))
+	}
+	return doctor.OK(check, "%s runs commands", pm.Spec.SSHConfig.Host)
+}
+
+func checkKubernetesVersions() doctor.Result {
+	const check = "kubernetes-version"
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return doctor.Failed(check, "restore the state file from a backup", "unable to list machines: %v", err)
+	}
+	if len(machineList.Items) == 0 {
+		return doctor.Skipped(check, "cluster has no machines")
+	}
+	for _, m := range machineList.Items {
+		machineSpec, err := providerCodec.GetMachineSpec(m)
+		if err != nil {
+			return doctor.Failed(check, "restore the state file from a backup", "unable to decode spec of machine %q: %v", m.Name, err)
+		}
+		version := machineSpec.ComponentVersions.KubernetesVersion
+		if err := doctor.KubernetesVersionSupported(version, common.MinimumControlPlaneVersion, common.DefaultKubernetesVersion); err != nil {
+			return doctor.Failed(check, "use the cctl version that created the cluster", "machine %q: %v", m.Name, err)
+		}
+	}
+	return doctor.OK(check, "supported by every machine")
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().StringP("output", "o", "", "Output format yaml|json. Defaults to text")
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/encryption"
+)
+
+// encryptionKeysSecretKey is the key of the encryption keys in their secret.
+const encryptionKeysSecretKey = "keys"
+
+var encryptionKeyCmdRotate = &cobra.Command{
+	Use:   "encryption-key",
+	Short: "Rotate the key that encrypts secrets at rest",
+	Long: `Rotate the key that encrypts secrets at rest, as enabled by update cluster
+--encrypt-secrets. A new key is generated, and:
+
+  1. added to the encryption configuration of every master, after the current
+     key, so that every API server can decrypt secrets encrypted with it;
+  2. made the first key of every master, so that secrets are encrypted with it;
+  3. used to re-encrypt every secret;
+  4. kept as the only key of every master.
+
+The API server of every master is restarted after each change, one master at
+a time. Each step is recorded in the state before it is applied, so if the
+rotation fails, run the command again to continue it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rotateEncryptionKey(); err != nil {
+			log.Fatalf("Unable to rotate encryption key: %v", err)
+		}
+		log.Println("Encryption key rotated successfully.")
+	},
+}
+
+// encryptionKeys returns the keys that encrypt secrets at rest. It returns
+// false if the encryption of secrets is not enabled.
+func encryptionKeys() ([]encryption.Key, bool, error) {
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultEncryptionKeysSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("unable to get secret %q: %v", common.DefaultEncryptionKeysSecretName, err)
+	}
+	keys, err := encryption.DecodeKeys(secret.Data[encryptionKeysSecretKey])
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read secret %q: %v", common.DefaultEncryptionKeysSecretName, err)
+	}
+	return keys, true, nil
+}
+
+// saveEncryptionKeys records the keys in the state.
+func saveEncryptionKeys(keys []encryption.Key) error {
+	data, err := encryption.EncodeKeys(keys)
+	if err != nil {
+		return err
+	}
+	secrets := state.KubeClient.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(common.DefaultEncryptionKeysSecretName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: common.DefaultEncryptionKeysSecretName},
+			Data:       map[string][]byte{encryptionKeysSecretKey: data},
+		}
+		_, err = secrets.Create(secret)
+	case err == nil:
+		secret.Data = map[string][]byte{encryptionKeysSecretKey: data}
+		_, err = secrets.Update(secret)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save secret %q: %v", common.DefaultEncryptionKeysSecretName, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+
+// enableSecretsEncryption generates the encryption key, if there is none,
+// configures every master to encrypt secrets with it, and encrypts the
+// existing secrets.
+func enableSecretsEncryption() error {
+	keys, ok, err := encryptionKeys()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		key, err := encryption.NewKey(time.Now())
+		if err != nil {
+			return err
+		}
+		keys = []encryption.Key{key}
+		if err := saveEncryptionKeys(keys); err != nil {
+			return err
+		}
+	} else if encryption.RotationOf(keys) != encryption.RotationNone {
+		return fmt.Errorf("the encryption key is being rotated; run rotate encryption-key to continue the rotation")
+	}
+	if err := applyEncryptionKeys(); err != nil {
+		return err
+	}
+	return reencryptSecrets()
+}
+
+// rotateEncryptionKey continues the rotation of the encryption key from the
+// step recorded in the state, or starts a new one.
+func rotateEncryptionKey() error {
+	keys, ok, err := encryptionKeys()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("encryption of secrets is not enabled; use update cluster --encrypt-secrets to enable it")
+	}
+	// The recorded step may not have been applied to every master.
+	if err := applyEncryptionKeys(); err != nil {
+		return err
+	}
+	if encryption.RotationOf(keys) == encryption.RotationNone {
+		key, err := encryption.NewKey(time.Now())
+		if err != nil {
+			return err
+		}
+		keys = []encryption.Key{keys[0], key}
+		log.Printf("Adding encryption key %q", key.Name)
+		if err := saveAndApplyEncryptionKeys(keys); err != nil {
+			return err
+		}
+	}
+	if encryption.RotationOf(keys) == encryption.RotationNewKeyAdded {
+		keys = []encryption.Key{keys[1], keys[0]}
+		log.Printf("Encrypting secrets with encryption key %q", keys[0].Name)
+		if err := saveAndApplyEncryptionKeys(keys); err != nil {
+			return err
+		}
+	}
+	if err := reencryptSecrets(); err != nil {
+		return err
+	}
+	log.Printf("Removing encryption key %q", keys[1].Name)
+	return saveAndApplyEncryptionKeys(keys[:1])
+}
+
+func saveAndApplyEncryptionKeys(keys []encryption.Key) error {
+	if err := saveEncryptionKeys(keys); err != nil {
+		return err
+	}
+	return applyEncryptionKeys()
+}
+
+// applyEncryptionKeys configures every master with the encryption keys in the
+// state, one at a time.
+func applyEncryptionKeys() error {
+	masters, err := masterMachines()
+	if err != nil {
+		return err
+	}
+	for i := range masters {
+		client, err := machineClientForMachine(&masters[i])
+		if err != nil {
+			return fmt.Errorf("unable to create machine client for machine %q: %v", masters[i].Name, err)
+		}
+		if err := ensureEncryptionConfig(&masters[i], client); err != nil {
+			return fmt.Errorf("unable to configure encryption on machine %q: %v", masters[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// reencryptSecrets rewrites every secret, so that the API server encrypts it
+// with the first encryption key.
+func reencryptSecrets() error {
+	masters, err := masterMachines()
+	if err != nil {
+		return err
+	}
+	if len(masters) == 0 {
+		return fmt.Errorf("cluster has no masters")
+	}
+	client, err := machineClientForMachine(&masters[0])
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", masters[0].Name, err)
+	}
+	log.Printf("Re-encrypting all secrets")
+	// The secrets are piped on the master, so that they are not sent to cctl.
+	kubectl := fmt.Sprintf("%s --kubeconfig=%s", common.KubectlFile, common.AdminKubeconfig)
+	cmd := fmt.Sprintf("sh -c '%s get secrets --all-namespaces -o json | %s replace -f -'", kubectl, kubectl)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("unable to re-encrypt secrets: error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return nil
+}
+
+func masterMachines() ([]clusterv1.Machine, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	var masters []clusterv1.Machine
+	for _, m := range machineList.Items {
+		if clusterutil.RoleContains(clustercommon.MasterRole, m.Spec.Roles) {
+			masters = append(masters, m)
+		}
+	}
+	return masters, nil
+}
+
+// ensureEncryptionConfig writes the encryption configuration, with the keys in
+// the state, to the master, and gives it to the API server. If either
+// changes, it waits until the restarted API server is healthy.
+func ensureEncryptionConfig(machine *clusterv1.Machine, client sshmachine.Client) error {
+	keys, ok, err := encryptionKeys()
+	if err != nil || !ok {
+		return err
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	version, err := semver.NewVersion(machineSpec.ComponentVersions.KubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("unable to parse Kubernetes version %q: %v", machineSpec.ComponentVersions.KubernetesVersion, err)
+	}
+	config, err := encryption.Config(keys, version)
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(encryption.ConfigDir, 0700); err != nil {
+		return fmt.Errorf("unable to create %q: %v", encryption.ConfigDir, err)
+	}
+	current, err := readFileIfExists(client, encryption.ConfigFile)
+	if err != nil {
+		return err
+	}
+	configChanged := !bytes.Equal(current, config)
+	if configChanged {
+		if err := writeFileAsRoot(client, encryption.ConfigFile, 0600, config); err != nil {
+			return err
+		}
+	}
+	manifest, err := client.ReadFile(apiServerManifestFile)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", apiServerManifestFile, err)
+	}
+	configured, manifestChanged, err := encryption.ConfigureManifest(manifest, version)
+	if err != nil {
+		return fmt.Errorf("unable to configure %q: %v", apiServerManifestFile, err)
+	}
+	if !configChanged && !manifestChanged {
+		log.Printf("Encryption of machine %q is already configured", machine.Name)
+		return nil
+	}
+	log.Printf("Configured encryption of machine %q", machine.Name)
+	return reloadAPIServer(client, configured, manifestChanged)
+}
+
+func init() {
+	rotateCmd.AddCommand(encryptionKeyCmdRotate)
+}
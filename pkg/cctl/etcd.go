@@ -14,14 +14,14 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
+package cctl
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	log "github.com/platform9/cctl/pkg/logrus"
 	"github.com/satori/go.uuid"
@@ -33,14 +33,18 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
 	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
 
 	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
-	sputil "github.com/platform9/ssh-provider/pkg/controller"
 	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
 	setsutil "github.com/platform9/ssh-provider/pkg/util/sets"
 
 	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/cliparse"
 	capiutil "github.com/platform9/cctl/pkg/util/clusterapi"
+	etcdutil "github.com/platform9/cctl/pkg/util/etcd"
+	"github.com/platform9/cctl/pkg/util/operror"
+	"github.com/platform9/cctl/pkg/util/transfer"
 )
 
 var recoverEtcdCmd = &cobra.Command{
@@ -51,77 +55,89 @@ var recoverEtcdCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("Unable to parse `snapshot`: %v", err)
 		}
-		remotePath := fmt.Sprintf("%s-%s", "/tmp/cctl-etcd-snapshot", uuid.NewV4().String())
-
-		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(common.DefaultNamespace).Get(common.DefaultClusterName, metav1.GetOptions{})
-		if err != nil {
-			if apierrors.IsNotFound(err) {
-				log.Fatalf("No cluster found. Create a cluster before creating a machine.")
-			}
-			log.Fatalf("Unable to get cluster: %v", err)
-		}
-		clusterProviderSpec, err := sputil.GetClusterSpec(*cluster)
-		if err != nil {
-			log.Fatalf("Unable to decode cluster spec: %v", err)
-		}
-		etcdCASecret, err := state.KubeClient.CoreV1().Secrets(common.DefaultNamespace).Get(clusterProviderSpec.EtcdCASecret.Name, metav1.GetOptions{})
-		if err != nil {
-			if apierrors.IsNotFound(err) {
-				log.Fatalf("Unable to get etcd CA secret: %v", err)
-			}
+		if err := recoverEtcdFromSnapshot(localPath); err != nil {
+			log.Fatalf("Unable to recover etcd: %v", err)
 		}
+		log.Println("Recovered etcd successfully.")
+	},
+}
 
-		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(common.DefaultNamespace).List(metav1.ListOptions{})
-		if err != nil {
-			log.Fatalf("Unable to list machines: %v", err)
+// recoverEtcdFromSnapshot recovers the etcd cluster on every master and etcd
+// machine from the local snapshot file.
+func recoverEtcdFromSnapshot(localPath string) error {
+	if _, err := os.Stat(localPath); err != nil {
+		return operror.New(operror.Invalid, "unable to read snapshot: %v", err)
+	}
+	remotePath := fmt.Sprintf("%s-%s", "/tmp/cctl-etcd-snapshot", uuid.NewV4().String())
+
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return operror.New(operror.NotFound, "no cluster found")
 		}
-		masters := capiutil.MachinesWithRole(machineList.Items, clustercommon.MasterRole)
-		for _, m := range masters {
-			log.Printf("[recover etcd] Found master %q", m.Name)
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterProviderSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	etcdCASecret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(clusterProviderSpec.EtcdCASecret.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return operror.New(operror.NotFound, "etcd CA secret %q not found", clusterProviderSpec.EtcdCASecret.Name)
 		}
+		return fmt.Errorf("unable to get etcd CA secret: %v", err)
+	}
 
-		if err := recoverEtcd(localPath, remotePath, etcdCASecret, cluster, masters); err != nil {
-			log.Fatalf("Unable to recover etcd: %v", err)
-		}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	etcdMachines := capiutil.EtcdMachines(machineList.Items)
+	for _, m := range etcdMachines {
+		log.Printf("[recover etcd] Found etcd machine %q", m.Name)
+	}
 
-		if err := state.PullFromAPIs(); err != nil {
-			log.Fatalf("Unable to sync on-disk state: %v", err)
-		}
+	if err := recoverEtcd(localPath, remotePath, etcdCASecret, cluster, etcdMachines); err != nil {
+		return err
+	}
 
-		log.Println("Recovered etcd successfully.")
-	},
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
 }
 
-func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, cluster *clusterv1.Cluster, masters []clusterv1.Machine) error {
-	if len(masters) == 0 {
+func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, cluster *clusterv1.Cluster, etcdMachines []clusterv1.Machine) error {
+	if len(etcdMachines) == 0 {
 		return nil
 	}
 
-	mastersWithClient := make([]struct {
+	machinesWithClient := make([]struct {
 		Machine clusterv1.Machine
 		Client  sshmachine.Client
-	}, len(masters))
-	for i, master := range masters {
-		machineStatus, err := sputil.GetMachineStatus(master)
+	}, len(etcdMachines))
+	for i, m := range etcdMachines {
+		machineStatus, err := providerCodec.GetMachineStatus(m)
 		if err != nil {
-			return fmt.Errorf("unable to decode machine %q spec: %v", master.Name, err)
+			return fmt.Errorf("unable to decode machine %q spec: %v", m.Name, err)
 		}
 		client, err := sshMachineClientFromSSHConfig(machineStatus.SSHConfig)
 		if err != nil {
-			return fmt.Errorf("unable to create machine client for machine %q: %v", master.Name, err)
+			return fmt.Errorf("unable to create machine client for machine %q: %v", m.Name, err)
 		}
-		mastersWithClient[i].Machine = master
-		mastersWithClient[i].Client = client
+		machinesWithClient[i].Machine = m
+		machinesWithClient[i].Client = client
 	}
 
-	// Reset all masters
-	log.Println("[recover etcd] Cleaning up degraded etcd cluster on all masters")
-	for _, mwc := range mastersWithClient {
+	// Reset all etcdMachines
+	log.Println("[recover etcd] Cleaning up degraded etcd cluster on all etcdMachines")
+	for _, mwc := range machinesWithClient {
 		if err := resetEtcdSkipRemoveMember(mwc.Client); err != nil {
 			return fmt.Errorf("unable to reset etcd on machine %q: %v", mwc.Machine.Name, err)
 		}
 
-		machineStatus, err := sputil.GetMachineStatus(mwc.Machine)
+		machineStatus, err := providerCodec.GetMachineStatus(mwc.Machine)
 		if err != nil {
 			return fmt.Errorf("unable to decode machine status: %v", err)
 		}
@@ -130,20 +146,24 @@ func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, clus
 		}
 	}
 
-	// Write etcd CA to all masters
-	log.Println("[recover etcd] Writing etcd CA to all masters")
-	for _, mwc := range mastersWithClient {
+	// Write etcd CA to all etcdMachines
+	log.Println("[recover etcd] Writing etcd CA to all etcdMachines")
+	for _, mwc := range machinesWithClient {
 		if err := writeSecretToMachine(mwc.Client, etcdCASecret, "tls.crt", "tls.key", "/etc/etcd/pki/ca.crt", "/etc/etcd/pki/ca.key"); err != nil {
 			return fmt.Errorf("unable to write etcd CA cert and key to machine %q: %v", mwc.Machine.Name, err)
 		}
 	}
 
-	firstMWC := mastersWithClient[0]
-	otherMWCs := mastersWithClient[1:]
+	firstMWC := machinesWithClient[0]
+	otherMWCs := machinesWithClient[1:]
 
-	// Recover the first master
-	log.Printf("[recover etcd] Initializing new etcd cluster from snapshot on master %q", firstMWC.Machine.Name)
-	if err := writeRemoteFile(localPath, remotePath, firstMWC.Client); err != nil {
+	// Recover the first etcd machine
+	log.Printf("[recover etcd] Initializing new etcd cluster from snapshot on machine %q", firstMWC.Machine.Name)
+	firstMachineStatus, err := providerCodec.GetMachineStatus(firstMWC.Machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine %q status: %v", firstMWC.Machine.Name, err)
+	}
+	if err := writeRemoteFile(localPath, remotePath, firstMWC.Client, firstMachineStatus.SSHConfig); err != nil {
 		return fmt.Errorf("unable to write etcd snapshot to machine %q: %v", firstMWC.Machine.Name, err)
 	}
 	if err := etcdadmInitFromSnapshot(remotePath, firstMWC.Client); err != nil {
@@ -154,10 +174,10 @@ func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, clus
 		return fmt.Errorf("error reading etcd member data from machine %q: %v", firstMWC.Machine.Name, err)
 	}
 	if err := updateMachineEtcdMember(firstEtcdMember, &firstMWC.Machine); err != nil {
-		return fmt.Errorf("unable to update machine %q status with etcd member %q: %v", firstMWC.Machine.Name, firstEtcdMember, err)
+		return fmt.Errorf("unable to update machine %q status with etcd member %v: %v", firstMWC.Machine.Name, firstEtcdMember, err)
 	}
 	if err := insertClusterEtcdMember(firstEtcdMember, cluster); err != nil {
-		return fmt.Errorf("unable to update cluster status with etcd member %q: %v", firstEtcdMember, err)
+		return fmt.Errorf("unable to update cluster status with etcd member %v: %v", firstEtcdMember, err)
 	}
 
 	// Delete the temporary file
@@ -166,13 +186,13 @@ func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, clus
 		return fmt.Errorf("unable to remove temporary files: %v ", err)
 	}
 
-	// Recover the other masters
+	// Recover the other etcdMachines
 	if len(firstEtcdMember.ClientURLs) == 0 {
 		return fmt.Errorf("unable to proceed: etcd member for machine %q has no client URLs", firstMWC.Machine.Name)
 	}
 	endpoint := firstEtcdMember.ClientURLs[0]
 	for _, mwc := range otherMWCs {
-		log.Printf("[recover etcd] Joining master %q to new etcd cluster", mwc.Machine.Name)
+		log.Printf("[recover etcd] Joining machine %q to new etcd cluster", mwc.Machine.Name)
 		if err := etcdadmJoin(endpoint, mwc.Client); err != nil {
 			return fmt.Errorf("error running etcdadm join on machine %q: %v", mwc.Machine.Name, err)
 		}
@@ -181,14 +201,17 @@ func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, clus
 			return fmt.Errorf("error reading etcd member data from machine %q: %v", mwc.Machine.Name, err)
 		}
 		if err := updateMachineEtcdMember(etcdMember, &mwc.Machine); err != nil {
-			return fmt.Errorf("unable to update machine %q status with etcd member %q: %v", mwc.Machine.Name, etcdMember, err)
+			return fmt.Errorf("unable to update machine %q status with etcd member %v: %v", mwc.Machine.Name, etcdMember, err)
 		}
 		if err := insertClusterEtcdMember(etcdMember, cluster); err != nil {
-			return fmt.Errorf("unable to update cluster status with etcd member %q: %v", etcdMember, err)
+			return fmt.Errorf("unable to update cluster status with etcd member %v: %v", etcdMember, err)
 		}
 	}
 
-	for _, mwc := range mastersWithClient {
+	for _, mwc := range machinesWithClient {
+		if !clusterutil.RoleContains(clustercommon.MasterRole, mwc.Machine.Spec.Roles) {
+			continue
+		}
 		log.Printf("[recover etcd] Removing kube-apiserver container on master %q to trigger immediate restart", mwc.Machine.Name)
 		if err := removeKubeAPIServerContainer(mwc.Client); err != nil {
 			return fmt.Errorf("unable to remove kube-apiserver container on master %q: %v", mwc.Machine.Name, err)
@@ -198,57 +221,63 @@ func recoverEtcd(localPath, remotePath string, etcdCASecret *corev1.Secret, clus
 	return nil
 }
 
+// updateMachineEtcdMember sets the etcd member in the status of the latest
+// version of the machine, and copies the result to machine.
 func updateMachineEtcdMember(etcdMember spv1.EtcdMember, machine *clusterv1.Machine) error {
-	machineStatus, err := sputil.GetMachineStatus(*machine)
+	updated, err := capiutil.UpdateMachineStatus(state.ClusterClient, machine.Namespace, machine.Name, func(m *clusterv1.Machine) error {
+		machineStatus, err := providerCodec.GetMachineStatus(*m)
+		if err != nil {
+			return fmt.Errorf("unable to decode machine status: %v", err)
+		}
+		machineStatus.EtcdMember = &etcdMember
+		if err := providerCodec.PutMachineStatus(*machineStatus, m); err != nil {
+			return fmt.Errorf("unable to encode machine status: %v", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("unable to decode machine status: %v", err)
-	}
-	machineStatus.EtcdMember = &etcdMember
-	if err := sputil.PutMachineStatus(*machineStatus, machine); err != nil {
-		return fmt.Errorf("unable to encode machine status: %v", err)
-	}
-	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(machine.Namespace).UpdateStatus(machine); err != nil {
-		return fmt.Errorf("error updating machine %q: %v", machine.Name, err)
+		return err
 	}
+	*machine = *updated
 	return nil
 }
 
+// insertClusterEtcdMember adds the etcd member to the status of the latest
+// version of the cluster, and copies the result to cluster. Members added or
+// removed by other operations since cluster was read are kept.
 func insertClusterEtcdMember(etcdMember spv1.EtcdMember, cluster *clusterv1.Cluster) error {
-	clusterStatus, err := sputil.GetClusterStatus(*cluster)
-	if err != nil {
-		return fmt.Errorf("unable to decode cluster status: %v", err)
-	}
-	etcdMemberSet := setsutil.NewEtcdMemberSet(clusterStatus.EtcdMembers...)
-	etcdMemberSet.Insert(etcdMember)
-	clusterStatus.EtcdMembers = etcdMemberSet.List()
-	if err := sputil.PutClusterStatus(*clusterStatus, cluster); err != nil {
-		return fmt.Errorf("unable to encode cluster status: %v", err)
-	}
-	if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(common.DefaultNamespace).UpdateStatus(cluster); err != nil {
-		return fmt.Errorf("unable to update cluster: %v", err)
-	}
-	return nil
+	return changeClusterEtcdMembers(cluster, func(s setsutil.EtcdMemberSet) { s.Insert(etcdMember) })
 }
 
+// removeClusterEtcdMember removes the etcd member from the status of the
+// latest version of the cluster, and copies the result to cluster.
 func removeClusterEtcdMember(etcdMember spv1.EtcdMember, cluster *clusterv1.Cluster) error {
-	clusterStatus, err := sputil.GetClusterStatus(*cluster)
+	return changeClusterEtcdMembers(cluster, func(s setsutil.EtcdMemberSet) { s.Delete(etcdMember) })
+}
+
+func changeClusterEtcdMembers(cluster *clusterv1.Cluster, change func(setsutil.EtcdMemberSet)) error {
+	updated, err := capiutil.UpdateClusterStatus(state.ClusterClient, namespace, cluster.Name, func(c *clusterv1.Cluster) error {
+		clusterStatus, err := providerCodec.GetClusterStatus(*c)
+		if err != nil {
+			return fmt.Errorf("unable to decode cluster status: %v", err)
+		}
+		etcdMemberSet := setsutil.NewEtcdMemberSet(clusterStatus.EtcdMembers...)
+		change(etcdMemberSet)
+		clusterStatus.EtcdMembers = etcdMemberSet.List()
+		if err := providerCodec.PutClusterStatus(*clusterStatus, c); err != nil {
+			return fmt.Errorf("unable to encode cluster status: %v", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("unable to decode cluster status: %v", err)
-	}
-	etcdMemberSet := setsutil.NewEtcdMemberSet(clusterStatus.EtcdMembers...)
-	etcdMemberSet.Delete(etcdMember)
-	clusterStatus.EtcdMembers = etcdMemberSet.List()
-	if err := sputil.PutClusterStatus(*clusterStatus, cluster); err != nil {
-		return fmt.Errorf("unable to encode cluster status: %v", err)
-	}
-	if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(common.DefaultNamespace).UpdateStatus(cluster); err != nil {
-		return fmt.Errorf("unable to update cluster: %v", err)
+		return err
 	}
+	*cluster = *updated
 	return nil
 }
 
 func resetEtcdSkipRemoveMember(client sshmachine.Client) error {
-	cmd := fmt.Sprintf("%s reset --skip-remove-member", "/opt/bin/etcdadm")
+	cmd := fmt.Sprintf("%s reset --skip-remove-member", common.EtcdadmFile)
 	stdOut, stdErr, err := client.RunCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
@@ -256,16 +285,14 @@ func resetEtcdSkipRemoveMember(client sshmachine.Client) error {
 	return nil
 }
 
-func writeRemoteFile(localPath, remotePath string, client sshmachine.Client) error {
-	b, err := ioutil.ReadFile(localPath)
-	if err != nil {
-		return fmt.Errorf("unable to read local file %q: %v", localPath, err)
-	}
-	return client.WriteFile(remotePath, 0600, b)
+// writeRemoteFile uploads the local file to the machine. The upload is
+// chunked, rate-limited by --bwlimit, and resumes after a dropped connection.
+func writeRemoteFile(localPath, remotePath string, client sshmachine.Client, sshConfig *spv1.SSHConfig) error {
+	return transfer.Upload(client, reconnectFunc(sshConfig), localPath, remotePath, 0600, transferOptions())
 }
 
 func etcdadmInitFromSnapshot(remotePath string, client sshmachine.Client) error {
-	cmd := fmt.Sprintf("%s init --snapshot %s", "/opt/bin/etcdadm", remotePath)
+	cmd := fmt.Sprintf("%s init --snapshot %s", common.EtcdadmFile, remotePath)
 	stdOut, stdErr, err := client.RunCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
@@ -274,7 +301,7 @@ func etcdadmInitFromSnapshot(remotePath string, client sshmachine.Client) error
 }
 
 func etcdadmJoin(endpoint string, client sshmachine.Client) error {
-	cmd := fmt.Sprintf("%s join %s", "/opt/bin/etcdadm", endpoint)
+	cmd := fmt.Sprintf("%s join %s", common.EtcdadmFile, endpoint)
 	stdOut, stdErr, err := client.RunCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
@@ -328,14 +355,14 @@ func writeSecretToMachine(machineClient sshmachine.Client, secret *corev1.Secret
 // import it and remove this function.
 func etcdMemberFromMachine(machineClient sshmachine.Client) (spv1.EtcdMember, error) {
 	var etcdMember spv1.EtcdMember
-	cmd := fmt.Sprintf("%s info", "/opt/bin/etcdadm")
+	cmd := fmt.Sprintf("%s info", common.EtcdadmFile)
 	stdOut, stdErr, err := machineClient.RunCommand(cmd)
 	if err != nil {
 		return etcdMember, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
 	}
-	err = json.Unmarshal(stdOut, &etcdMember)
+	etcdMember, err = cliparse.ParseEtcdadmInfo(stdOut, remoteVersion(machineClient, etcdadmVersionCmd()))
 	if err != nil {
-		return etcdMember, fmt.Errorf("error unmarshalling etcdadm info output: %v", err)
+		return etcdMember, fmt.Errorf("error parsing etcdadm info output: %v", err)
 	}
 	return etcdMember, nil
 }
@@ -409,14 +436,14 @@ var snapshotEtcdCmd = &cobra.Command{
 		}
 		remotePath := fmt.Sprintf("%s-%s", "/tmp/cctl-etcd-snapshot", uuid.NewV4().String())
 
-		machine, err := state.ClusterClient.ClusterV1alpha1().Machines(common.DefaultNamespace).Get(ip, metav1.GetOptions{})
+		machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
 		if err != nil {
 			if apierrors.IsNotFound(err) {
 				log.Fatalf("Machine %q not found", ip)
 			}
 			log.Fatalf("Unable to get machine %q: %v", ip, err)
 		}
-		machineStatus, err := sputil.GetMachineStatus(*machine)
+		machineStatus, err := providerCodec.GetMachineStatus(*machine)
 		if err != nil {
 			log.Fatalf("Unable to decode machine %q spec: %v", machine.Name, err)
 		}
@@ -430,7 +457,7 @@ var snapshotEtcdCmd = &cobra.Command{
 			log.Fatalf("Unable to create etcd snapshot: %v", err)
 		}
 		log.Println("[snapshot] Downloading snapshot")
-		if err := downloadRemoteFile(remotePath, localPath, client); err != nil {
+		if err := downloadRemoteFile(remotePath, localPath, client, machineStatus.SSHConfig); err != nil {
 			log.Fatalf("Unable to download etcd snapshot: %v", err)
 		}
 		log.Printf("[snapshot] Downloaded snapshot to %q", localPath)
@@ -442,8 +469,106 @@ var snapshotEtcdCmd = &cobra.Command{
 	},
 }
 
+var defragEtcdCmd = &cobra.Command{
+	Use:   "etcd",
+	Short: "Defragments the database of every etcd member, one at a time",
+	Long: `Defragments the database of every etcd member, one at a time. A member does
+not serve requests while it is defragmented, so the cluster must be healthy
+before each member is defragmented, and becomes healthy again afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip, err := cmd.Flags().GetString("ip")
+		if err != nil {
+			log.Fatalf("Unable to parse `ip`: %v", err)
+		}
+		timeout, err := cmd.Flags().GetDuration("health-timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse `health-timeout`: %v", err)
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		etcdMachines := capiutil.EtcdMachines(machineList.Items)
+		if len(ip) != 0 {
+			var selected []clusterv1.Machine
+			for _, m := range etcdMachines {
+				if m.Name == ip {
+					selected = append(selected, m)
+				}
+			}
+			if len(selected) == 0 {
+				log.Fatalf("Machine %q with an etcd member not found", ip)
+			}
+			etcdMachines = selected
+		}
+		if len(etcdMachines) == 0 {
+			log.Fatalf("No machines with an etcd member found")
+		}
+		for i := range etcdMachines {
+			if err := defragEtcdMember(&etcdMachines[i], timeout); err != nil {
+				log.Fatalf("Unable to defragment etcd member on machine %q: %v", etcdMachines[i].Name, err)
+			}
+		}
+		log.Println("[defrag] Defragmented every etcd member successfully")
+	},
+}
+
+// defragEtcdMember defragments the etcd member on the machine, if the etcd
+// cluster is healthy, and waits for the cluster to be healthy again.
+func defragEtcdMember(machine *clusterv1.Machine, timeout time.Duration) error {
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	log.Printf("[defrag] Checking etcd health before defragmenting machine %q", machine.Name)
+	if err := waitForEtcdHealthy(client, timeout); err != nil {
+		return err
+	}
+	before, err := etcdLocalEndpointStatus(client)
+	if err != nil {
+		return err
+	}
+	log.Printf("[defrag] Defragmenting etcd member on machine %q", machine.Name)
+	cmd := fmt.Sprintf("%s defrag", common.EtcdctlFile)
+	if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	log.Printf("[defrag] Waiting for etcd to be healthy after defragmenting machine %q", machine.Name)
+	if err := waitForEtcdHealthy(client, timeout); err != nil {
+		return err
+	}
+	after, err := etcdLocalEndpointStatus(client)
+	if err != nil {
+		return err
+	}
+	log.Printf("[defrag] Database of etcd member on machine %q went from %s to %s", machine.Name, formatBytes(before.DBSize), formatBytes(after.DBSize))
+	return nil
+}
+
+// etcdLocalEndpointStatus returns the status of the etcd member on the
+// machine.
+func etcdLocalEndpointStatus(client sshmachine.Client) (etcdutil.EndpointStatus, error) {
+	cmd := fmt.Sprintf("%s endpoint status -w json", common.EtcdctlFile)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return etcdutil.EndpointStatus{}, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	statuses, err := etcdutil.ParseEndpointStatus(stdOut)
+	if err != nil {
+		return etcdutil.EndpointStatus{}, err
+	}
+	if len(statuses) != 1 {
+		return etcdutil.EndpointStatus{}, fmt.Errorf("expected the status of 1 endpoint, found %d", len(statuses))
+	}
+	return statuses[0], nil
+}
+
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1024*1024))
+}
+
 func createSnapshot(remotePath string, client sshmachine.Client) error {
-	cmd := fmt.Sprintf("%s snapshot save %s", "/opt/bin/etcdctl.sh", remotePath)
+	cmd := fmt.Sprintf("%s snapshot save %s", common.EtcdctlFile, remotePath)
 	stdOut, stdErr, err := client.RunCommand(cmd)
 	if err != nil {
 		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
@@ -451,12 +576,40 @@ func createSnapshot(remotePath string, client sshmachine.Client) error {
 	return nil
 }
 
-func downloadRemoteFile(remotePath, localPath string, client sshmachine.Client) error {
-	snapshotBytes, err := client.ReadFile(remotePath)
-	if err != nil {
-		return err
+// etcdEndpointHealth returns the health of every member of the etcd cluster
+// the machine belongs to.
+func etcdEndpointHealth(client sshmachine.Client) (etcdutil.EndpointHealth, error) {
+	cmd := fmt.Sprintf("%s endpoint health --cluster", common.EtcdctlFile)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	// The command fails if any member is unhealthy, but still reports the
+	// health of every member.
+	health := etcdutil.ParseEndpointHealth(append(stdOut, stdErr...))
+	if len(health.Healthy)+len(health.Unhealthy) == 0 {
+		return health, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return health, nil
+}
+
+// downloadRemoteFile downloads the file from the machine. The download is
+// chunked, rate-limited by --bwlimit, and resumes after a dropped connection.
+func downloadRemoteFile(remotePath, localPath string, client sshmachine.Client, sshConfig *spv1.SSHConfig) error {
+	return transfer.Download(client, reconnectFunc(sshConfig), remotePath, localPath, 0600, transferOptions())
+}
+
+// reconnectFunc returns a function that creates a new client for the machine,
+// used to resume a transfer.
+func reconnectFunc(sshConfig *spv1.SSHConfig) transfer.ClientFactory {
+	return func() (sshmachine.Client, error) {
+		return sshMachineClientFromSSHConfig(sshConfig)
+	}
+}
+
+func transferOptions() transfer.Options {
+	return transfer.Options{
+		ChunkSize:      transfer.DefaultChunkSize,
+		BandwidthLimit: int64(bwLimit) * 1024,
+		Retries:        transferRetries,
 	}
-	return ioutil.WriteFile(localPath, snapshotBytes, 0600)
 }
 
 func init() {
@@ -466,4 +619,8 @@ func init() {
 	snapshotEtcdCmd.Flags().String("ip", "", "IP of the machine used to create the etcd snapshot")
 	snapshotEtcdCmd.Flags().String("snapshot", "", "Path to save the etcd snapshot")
 	snapshotCmd.AddCommand(snapshotEtcdCmd)
+
+	defragEtcdCmd.Flags().String("ip", "", "IP of the master or etcd machine whose etcd member to defragment. If not specified, every member is defragmented")
+	defragEtcdCmd.Flags().Duration("health-timeout", 2*time.Minute, "How long to wait for the etcd cluster to be healthy before and after defragmenting each member")
+	defragCmd.AddCommand(defragEtcdCmd)
 }
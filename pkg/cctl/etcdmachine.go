@@ -0,0 +1,226 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	machineActuator "github.com/platform9/ssh-provider/pkg/clusterapi/machine"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/cliparse"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+// isEtcdMachine returns true if the machine runs only an etcd member. The
+// actuator provisions masters and nodes; cctl provisions etcd machines.
+func isEtcdMachine(machine *clusterv1.Machine) bool {
+	return clusterutil.RoleContains(clusterapi.EtcdRole, machine.Spec.Roles)
+}
+
+// createEtcdMachine installs etcdadm on the etcd machine, writes the etcd CA,
+// and creates its etcd member: the first member of the cluster forms the etcd
+// cluster, and any other joins it. The member is recorded in the status of
+// the machine.
+func createEtcdMachine(cluster *clusterv1.Cluster, machine *clusterv1.Machine) error {
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	if err := installEtcdadm(machineSpec.ComponentVersions.EtcdadmVersion, client); err != nil {
+		return fmt.Errorf("unable to install etcdadm: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if clusterSpec.EtcdCASecret == nil {
+		return fmt.Errorf("cluster has no etcd CA")
+	}
+	etcdCASecret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(clusterSpec.EtcdCASecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get etcd CA secret: %v", err)
+	}
+	if err := writeSecretToMachine(client, etcdCASecret, "tls.crt", "tls.key", path.Join(common.EtcdPKIDir, "ca.crt"), path.Join(common.EtcdPKIDir, "ca.key")); err != nil {
+		return fmt.Errorf("unable to write etcd CA cert and key: %v", err)
+	}
+	clusterStatus, err := providerCodec.GetClusterStatus(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster status: %v", err)
+	}
+	if len(clusterStatus.EtcdMembers) == 0 {
+		log.Println("Creating the etcd cluster")
+		cmd := fmt.Sprintf("%s init", common.EtcdadmFile)
+		if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+			return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		}
+	} else {
+		etcdMember := clusterStatus.EtcdMembers[0]
+		if len(etcdMember.ClientURLs) == 0 {
+			return fmt.Errorf("etcd member %q has no client URLs", etcdMember.Name)
+		}
+		log.Printf("Joining the etcd cluster at %s", etcdMember.ClientURLs[0])
+		if err := etcdadmJoin(etcdMember.ClientURLs[0], client); err != nil {
+			return err
+		}
+	}
+	etcdMember, err := etcdMemberFromMachine(client)
+	if err != nil {
+		return fmt.Errorf("error reading etcd member data from machine: %v", err)
+	}
+	return updateMachineEtcdMember(etcdMember, machine)
+}
+
+// deleteEtcdMachine removes the etcd member of the etcd machine from the etcd
+// cluster, and resets the machine.
+func deleteEtcdMachine(cluster *clusterv1.Cluster, machine *clusterv1.Machine) error {
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	cmd := fmt.Sprintf("%s reset", common.EtcdadmFile)
+	if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return nil
+}
+
+// upgradeEtcdMachine upgrades the etcd machine to the goal component
+// versions. If the etcd version changed, the etcd member of the machine is
+// replaced with one of the goal version; the etcd cluster must keep quorum
+// while the member is replaced. The machine is updated to its latest version.
+func upgradeEtcdMachine(machine *clusterv1.Machine, goal *spv1.MachineComponentVersions, upgrade UpgradeRequired) error {
+	if upgrade.EtcdVersion {
+		if err := replaceEtcdMember(machine, goal); err != nil {
+			return err
+		}
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	machineSpec.ComponentVersions = goal
+	if err := providerCodec.PutMachineSpec(*machineSpec, machine); err != nil {
+		return fmt.Errorf("unable to encode machine spec: %v", err)
+	}
+	return nil
+}
+
+// replaceEtcdMember removes the etcd member of the etcd machine, and creates
+// a new one with the goal component versions.
+func replaceEtcdMember(machine *clusterv1.Machine, goal *spv1.MachineComponentVersions) error {
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	if err := deleteMustNotLoseEtcdQuorum(machine); err != nil {
+		return err
+	}
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	log.Println("Removing the etcd member")
+	if err := deleteEtcdMachine(cluster, machine); err != nil {
+		return err
+	}
+	machineStatus, err := providerCodec.GetMachineStatus(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to get machine status: %v", err)
+	}
+	if machineStatus.EtcdMember != nil {
+		if err := removeClusterEtcdMember(*machineStatus.EtcdMember, cluster); err != nil {
+			return fmt.Errorf("unable to delete etcd member from cluster status: %v", err)
+		}
+	}
+	log.Println("Creating the etcd member")
+	goalMachine := machine.DeepCopy()
+	machineSpec.ComponentVersions = goal
+	if err := providerCodec.PutMachineSpec(*machineSpec, goalMachine); err != nil {
+		return fmt.Errorf("unable to encode machine spec: %v", err)
+	}
+	// The goal machine is replaced with the latest version of the machine,
+	// with the new etcd member in its status.
+	if err := createEtcdMachine(cluster, goalMachine); err != nil {
+		return err
+	}
+	machineStatus, err = providerCodec.GetMachineStatus(*goalMachine)
+	if err != nil {
+		return fmt.Errorf("unable to get machine status: %v", err)
+	}
+	if err := insertClusterEtcdMember(*machineStatus.EtcdMember, cluster); err != nil {
+		return fmt.Errorf("unable to add etcd member to cluster status: %v", err)
+	}
+	*machine = *goalMachine
+	return nil
+}
+
+// installEtcdadm is a near copy of the function in
+// https://github.com/platform9/ssh-provider/blob/28922e78090ea51444156996f70d5236f4ddc256/pkg/clusterapi/machine/actuator.go#L66
+// TODO(dlipovetsky) Once this code is moved out of the actuator and exported,
+// import it and remove this function.
+func installEtcdadm(version string, client sshmachine.Client) error {
+	desiredVersion, err := semver.NewVersion(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return fmt.Errorf("unable to parse etcdadm version %q: %v", version, err)
+	}
+	exists, err := client.Exists(common.EtcdadmFile)
+	if err != nil {
+		return fmt.Errorf("unable to check if etcdadm is installed at %q: %v", common.EtcdadmFile, err)
+	}
+	if exists {
+		stdOut, _, err := client.RunCommand(etcdadmVersionCmd())
+		if err != nil {
+			return fmt.Errorf("unable to check the installed etcdadm version: %v", err)
+		}
+		installedVersion, err := cliparse.ParseVersion(stdOut)
+		if err != nil {
+			return fmt.Errorf("unable to parse the installed etcdadm version %q: %v", string(stdOut), err)
+		}
+		if installedVersion.Major == desiredVersion.Major && installedVersion.Minor == desiredVersion.Minor && installedVersion.Patch == desiredVersion.Patch {
+			return nil
+		}
+	}
+	cachePath := filepath.Join(machineActuator.CachePath, "etcdadm", version, "etcdadm")
+	exists, err = client.Exists(cachePath)
+	if err != nil {
+		return fmt.Errorf("unable to check if %q exists: %v", cachePath, err)
+	}
+	if !exists {
+		return fmt.Errorf("unable to find etcdadm in the cache %q", cachePath)
+	}
+	log.Printf("Installing etcdadm version %q from cache %q", version, cachePath)
+	if err := client.CopyFile(cachePath, common.EtcdadmFile); err != nil {
+		return fmt.Errorf("unable to copy file from %q to %q: %v", cachePath, common.EtcdadmFile, err)
+	}
+	return nil
+}
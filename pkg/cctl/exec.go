@@ -0,0 +1,168 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/fanout"
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec",
+	Short: "Used to run a command on resources",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Exec called")
+	},
+}
+
+var machineCmdExec = &cobra.Command{
+	Use:   "machine -- COMMAND [ARGS...]",
+	Short: "Run a command on machines in parallel",
+	Long: `Run a command on the machines in the state, in parallel, and print the output
+of each machine. The command runs in sh, as root. Select the machines with
+--ip, --role, or --selector; without any, the command runs on all machines.
+cctl exits with an error if the command fails on any machine.`,
+	Example: `  cctl exec machine --role node -- kubelet --version`,
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mustNotEnforceCommandAllowlist(cmd)
+		ips, err := cmd.Flags().GetStringSlice("ip")
+		if err != nil {
+			log.Fatalf("Unable to parse `ip` flag: %v", err)
+		}
+		role := strings.Title(cmd.Flag("role").Value.String())
+		selector, err := labels.Parse(cmd.Flag("selector").Value.String())
+		if err != nil {
+			log.Fatalf("Unable to parse `selector` flag: %v", err)
+		}
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil {
+			log.Fatalf("Unable to parse `concurrency` flag: %v", err)
+		}
+		output := cmd.Flag("output").Value.String()
+		if output != "text" && output != "json" {
+			log.Fatalf("Unknown output format %q, must be text or json", output)
+		}
+
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		machines, err := selectMachines(machineList.Items, ips, clustercommon.MachineRole(role), selector)
+		if err != nil {
+			log.Fatalf("Unable to select machines: %v", err)
+		}
+		if len(machines) == 0 {
+			log.Fatalf("No machines match.")
+		}
+		byName := make(map[string]*clusterv1.Machine, len(machines))
+		var hosts []string
+		for i := range machines {
+			byName[machines[i].Name] = &machines[i]
+			hosts = append(hosts, machines[i].Name)
+		}
+
+		command := fanout.ShellCommand(args)
+		// Clients are created one at a time, because creating one can prompt
+		// for the passphrase of the SSH key; the commands run in parallel.
+		var clientMu sync.Mutex
+		results := fanout.Run(hosts, concurrency, func(host string) ([]byte, []byte, error) {
+			clientMu.Lock()
+			client, err := machineClientForMachine(byName[host])
+			clientMu.Unlock()
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to create machine client: %v", err)
+			}
+			return client.RunCommand(command)
+		})
+		switch output {
+		case "json":
+			b, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				log.Fatalf("Unable to marshal results: %v", err)
+			}
+			fmt.Println(string(b))
+		default:
+			if err := fanout.Print(os.Stdout, results); err != nil {
+				log.Fatalf("Unable to print results: %v", err)
+			}
+		}
+		if n := fanout.Failed(results); n != 0 {
+			log.Fatalf("The command failed on %d of %d machines.", n, len(results))
+		}
+	},
+}
+
+// selectMachines returns the machines with the IPs, if any are given, and
+// with the role and labels, if they are given.
+func selectMachines(machines []clusterv1.Machine, ips []string, role clustercommon.MachineRole, selector labels.Selector) ([]clusterv1.Machine, error) {
+	if len(role) != 0 {
+		machines = clusterapi.MachinesWithRole(machines, role)
+	}
+	wanted := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		wanted[ip] = true
+	}
+	var selected []clusterv1.Machine
+	for _, m := range machines {
+		if len(ips) != 0 && !wanted[m.Name] {
+			continue
+		}
+		if !selector.Matches(labels.Set(m.Labels)) {
+			continue
+		}
+		selected = append(selected, m)
+		delete(wanted, m.Name)
+	}
+	for ip := range wanted {
+		return nil, fmt.Errorf("machine %q not found, or does not match --role and --selector", ip)
+	}
+	return selected, nil
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.AddCommand(machineCmdExec)
+	machineCmdExec.Flags().StringSlice("ip", []string{}, "IPs of the machines. Provide a comma-separated list, or define multiple flags.")
+	machineCmdExec.Flags().String("role", "", "Run on the machines with this role. Can be master/node/etcd")
+	machineCmdExec.Flags().String("selector", "", "Run on the machines whose labels match this selector, e.g. zone=a")
+	machineCmdExec.Flags().Int("concurrency", 10, "Number of machines the command runs on at the same time")
+	machineCmdExec.Flags().StringP("output", "o", "text", "Output format text|json")
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/capiexport"
+)
+
+// exportFormatCAPI is the format of the manifests of upstream Cluster API.
+const exportFormatCAPI = "capi"
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the state as manifests of another cluster manager",
+	Long: `Export the cluster, machines, provisioned machines, and secrets of the state as
+manifests, to move the cluster off the state file.
+
+With --format capi, the manifests are Cluster API v1alpha3 objects, to be
+applied to a management cluster with an SSH infrastructure provider:
+
+  - a Cluster, and its SSHCluster, with the API endpoint, VIP, and bastion;
+  - a Machine, and its SSHMachine, for every machine, with its SSH
+    configuration and roles. Machines are already provisioned, so their
+    bootstrap data is empty;
+  - the CA, service account key, and admin kubeconfig secrets, renamed as
+    Cluster API expects, e.g. <cluster>-ca, and every other secret, except
+    the bootstrap token, with its own name.
+
+The Cluster is paused, so that the controllers adopt the machines only after
+the paused annotation is removed. The manifests hold private keys, so the file
+given by --file is written readable only by its owner.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		format := cmd.Flag("format").Value.String()
+		if format != exportFormatCAPI {
+			log.Fatalf("Unsupported export format %q", format)
+		}
+		targetNamespace := cmd.Flag("target-namespace").Value.String()
+		if len(targetNamespace) == 0 {
+			targetNamespace = namespace
+		}
+		objects, err := capiExportObjects()
+		if err != nil {
+			log.Fatalf("Unable to read the state: %v", err)
+		}
+		exported, err := capiexport.Export(objects, targetNamespace)
+		if err != nil {
+			log.Fatalf("Unable to export the state: %v", err)
+		}
+		b, err := capiexport.Marshal(exported)
+		if err != nil {
+			log.Fatalf("Unable to export the state: %v", err)
+		}
+		file := cmd.Flag("file").Value.String()
+		if len(file) == 0 {
+			os.Stdout.Write(b)
+			return
+		}
+		if err := ioutil.WriteFile(file, b, 0600); err != nil {
+			log.Fatalf("Unable to write %q: %v", file, err)
+		}
+		log.Printf("[export] Exported %d objects to %q", len(exported), file)
+	},
+}
+
+// capiExportObjects returns the objects of the cluster in the state, with
+// their provider specs decoded.
+func capiExportObjects() (capiexport.Objects, error) {
+	var o capiexport.Objects
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return o, fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return o, fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	o.Cluster = *cluster
+	o.ClusterSpec = *clusterSpec
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return o, fmt.Errorf("unable to list machines: %v", err)
+	}
+	for _, m := range machineList.Items {
+		machineSpec, err := providerCodec.GetMachineSpec(m)
+		if err != nil {
+			return o, fmt.Errorf("unable to decode spec of machine %q: %v", m.Name, err)
+		}
+		pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			return o, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+		}
+		o.Machines = append(o.Machines, capiexport.Machine{Machine: m, Spec: *machineSpec, ProvisionedMachine: *pm})
+	}
+	secretList, err := state.KubeClient.CoreV1().Secrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return o, fmt.Errorf("unable to list secrets: %v", err)
+	}
+	o.Secrets = secretList.Items
+	return o, nil
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().String("format", exportFormatCAPI, "Format of the manifests. Only capi, for Cluster API v1alpha3, is supported")
+	exportCmd.Flags().String("target-namespace", "", "Namespace of the exported objects. Defaults to --namespace")
+	exportCmd.Flags().StringP("file", "f", "", "File to write the manifests to. Defaults to stdout")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/jsonpath"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	jsonpathOutputPrefix   = "jsonpath="
+	goTemplateOutputPrefix = "go-template="
+)
+
+var outputFmt string
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Display one or more resources",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		log.Printf("Unknown resource %q. Use --help to print available options", args[0])
+	},
+}
+
+// printTemplateOutput prints the object using the jsonpath or go-template
+// output format. The template is applied to the JSON representation of the
+// object. It returns false if the output format is not a template.
+func printTemplateOutput(obj interface{}) (bool, error) {
+	switch {
+	case strings.HasPrefix(outputFmt, jsonpathOutputPrefix):
+		j, err := jsonpath.Parse(strings.TrimPrefix(outputFmt, jsonpathOutputPrefix))
+		if err != nil {
+			return true, fmt.Errorf("unable to parse jsonpath template: %v", err)
+		}
+		return true, j.Execute(os.Stdout, obj)
+	case strings.HasPrefix(outputFmt, goTemplateOutputPrefix):
+		t, err := template.New("output").Parse(strings.TrimPrefix(outputFmt, goTemplateOutputPrefix))
+		if err != nil {
+			return true, fmt.Errorf("unable to parse go-template: %v", err)
+		}
+		b, err := json.Marshal(obj)
+		if err != nil {
+			return true, fmt.Errorf("unable to marshal object to json: %v", err)
+		}
+		var data interface{}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return true, fmt.Errorf("unable to unmarshal object from json: %v", err)
+		}
+		return true, t.Execute(os.Stdout, data)
+	}
+	return false, nil
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+	getCmd.PersistentFlags().StringVarP(&outputFmt, "o", "o", "", "Output format yaml|json|jsonpath=<template>|go-template=<template>. Templates are applied to a single object, or to a list with an items field")
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+	"github.com/spf13/pflag"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/gitstate"
+	"github.com/platform9/cctl/pkg/util/secretstore"
+)
+
+var (
+	// gitState is the repository of the state file, if --state is in one.
+	gitState *gitstate.Remote
+	// gitStateDir is the clone of the repository.
+	gitStateDir string
+	// gitStateParentDir holds the clones of repositories.
+	gitStateParentDir string
+	// gitStateAllowSecrets pushes the state even if secrets have their data
+	// in the state file.
+	gitStateAllowSecrets bool
+	// gitStateCommitted is set once the state is committed.
+	gitStateCommitted bool
+	// gitStateMu serializes the git commands run in the clone, e.g. by the
+	// heartbeats of the operation lease.
+	gitStateMu sync.Mutex
+)
+
+// configureGitState clones the repository of the state file, or pulls the
+// changes pushed since it was cloned, if --state is in a repository, and
+// makes commands use the state file in the clone. It runs before any
+// command.
+func configureGitState() {
+	if err := openGitState(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if gitState == nil {
+		return
+	}
+	// A command that fails may have changed the state before it failed.
+	log.RegisterExitHandler(func() {
+		if err := commitGitState(true); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to push the state: %v\n", err)
+		}
+	})
+}
+
+// openGitState clones or pulls the repository of the state file, if the
+// state file is in one, and points stateFilename at the state file in the
+// clone.
+func openGitState() error {
+	r, ok, err := gitstate.Parse(stateFilename)
+	if err != nil {
+		return fmt.Errorf("unable to parse --state: %v", err)
+	}
+	if !ok {
+		return nil
+	}
+	parent := gitStateParentDir
+	if len(parent) == 0 {
+		u, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("unable to find home directory for --state-git-dir: %v", err)
+		}
+		parent = filepath.Join(u.HomeDir, common.DefaultStateGitDir)
+	}
+	dir := r.Dir(parent)
+	log.Debugf("Syncing %s to %q", r.Repository, dir)
+	if err := gitstate.Sync(r, dir); err != nil {
+		return fmt.Errorf("unable to sync the state repository: %v", err)
+	}
+	stateFilename = filepath.Join(dir, filepath.FromSlash(r.Path))
+	if err := os.MkdirAll(filepath.Dir(stateFilename), 0700); err != nil {
+		return fmt.Errorf("unable to create %q: %v", filepath.Dir(stateFilename), err)
+	}
+	gitState, gitStateDir = &r, dir
+	return nil
+}
+
+// pullGitState pulls the changes pushed since the repository of the state
+// file was last synced, if the state file is in one, e.g. before a job of
+// serve runs.
+func pullGitState() error {
+	gitStateMu.Lock()
+	defer gitStateMu.Unlock()
+	if gitState == nil {
+		return nil
+	}
+	if err := gitstate.Sync(*gitState, gitStateDir); err != nil {
+		return fmt.Errorf("unable to sync the state repository: %v", err)
+	}
+	return nil
+}
+
+// commitGitState commits and pushes the state changed by the command. It
+// runs at most once.
+func commitGitState(failed bool) error {
+	gitStateMu.Lock()
+	committed := gitStateCommitted
+	gitStateCommitted = true
+	gitStateMu.Unlock()
+	if committed {
+		return nil
+	}
+	return pushGitState(gitCommitMessage(failed))
+}
+
+// pushGitState commits the state file, and its signature, if they changed,
+// with the message, and pushes the commit. It does nothing unless the state
+// file is in a repository. Unless --state-git-allow-secrets is given, it
+// refuses to push a state file with secret data, which everyone with access
+// to the repository, and its history, could read.
+func pushGitState(message string) error {
+	gitStateMu.Lock()
+	defer gitStateMu.Unlock()
+	if gitState == nil || readOnly {
+		return nil
+	}
+	r := *gitState
+	if !gitStateAllowSecrets {
+		inline, err := inlineSecrets(stateFilename)
+		if err != nil {
+			return err
+		}
+		if len(inline) != 0 {
+			return fmt.Errorf("the state was not pushed, because secrets %s have their data in the state file. Move them to Vault with 'cctl state vault-secrets', or give --state-git-allow-secrets. The state is kept in %q, and is pushed by the next command", strings.Join(inline, ", "), gitStateDir)
+		}
+	}
+	files := []string{r.Path, r.Path + cctlstate.SignatureFileSuffix}
+	committed, err := gitstate.Commit(r, gitStateDir, files, message)
+	if err != nil {
+		return err
+	}
+	if committed {
+		log.Printf("Pushed the state to %s", r.Repository)
+	}
+	return nil
+}
+
+// inlineSecrets returns the secrets, as namespace/name, whose data is in the
+// state file.
+func inlineSecrets(filename string) ([]string, error) {
+	s := cctlstate.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+	s.ReadOnly = true
+	if err := s.PushToAPIs(); err != nil {
+		return nil, fmt.Errorf("unable to read the state: %v", err)
+	}
+	return secretstore.Inline(s.SecretList.Items), nil
+}
+
+// publishOperationLease commits the operation lease file, or its removal,
+// and pushes the commit, if the state file is in a repository, so that
+// operators on other hosts, whose clones have their own state lock and lease
+// files, see the lease before they change the cluster. It returns
+// gitstate.ErrConflict if another operator pushed a change of the lease
+// first.
+func publishOperationLease(action string) error {
+	gitStateMu.Lock()
+	defer gitStateMu.Unlock()
+	if gitState == nil {
+		return nil
+	}
+	rel, err := filepath.Rel(gitStateDir, operationLeaseFilename(namespace))
+	if err != nil {
+		return fmt.Errorf("unable to find the operation lease in %q: %v", gitStateDir, err)
+	}
+	message := fmt.Sprintf("%s the operation lease of namespace %s\n\nOperator: %s\n", action, namespace, operationHolder())
+	return gitstate.CommitExclusive(*gitState, gitStateDir, filepath.ToSlash(rel), message)
+}
+
+// gitCommitMessage describes the command that changed the state: its
+// arguments, and the names, but not the values, of its flags, which can be
+// secrets.
+func gitCommitMessage(failed bool) string {
+	subject := "cctl"
+	var flags []string
+	if c, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		subject = strings.Join(append([]string{c.CommandPath()}, c.Flags().Args()...), " ")
+		c.Flags().Visit(func(f *pflag.Flag) {
+			flags = append(flags, "--"+f.Name)
+		})
+	}
+	return operationCommitMessage(subject, flags, failed)
+}
+
+// operationCommitMessage describes the operation that changed the state,
+// e.g. a job of serve, and the names of its flags, if any.
+func operationCommitMessage(subject string, flags []string, failed bool) string {
+	result := "succeeded"
+	if failed {
+		result = "failed"
+	}
+	body := []string{
+		"Namespace: " + namespace,
+		"Operator: " + operationHolder(),
+		"Result: " + result,
+	}
+	if len(flags) != 0 {
+		body = append([]string{"Flags: " + strings.Join(flags, ", ")}, body...)
+	}
+	return subject + "\n\n" + strings.Join(body, "\n") + "\n"
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&gitStateAllowSecrets, "state-git-allow-secrets", false, "push a state file given as <repository>//<path> even if secrets have their data in it, rather than in Vault")
+	rootCmd.PersistentFlags().StringVar(&gitStateParentDir, "state-git-dir", "", "directory that holds the clones of the repositories of state files given as --state <repository>//<path>. Defaults to "+filepath.Join("~", common.DefaultStateGitDir))
+}
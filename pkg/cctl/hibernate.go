@@ -0,0 +1,252 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+// hibernateCmd represents the hibernate command
+var hibernateCmd = &cobra.Command{
+	Use:   "hibernate",
+	Short: "Used to take resources out of service until they are resumed",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Hibernate called")
+	},
+}
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Used to return hibernated resources to service",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Resume called")
+	},
+}
+
+var nodesCmdHibernate = &cobra.Command{
+	Use:   "nodes",
+	Short: "Drain worker machines, and stop their kubelet or power them off",
+	Long: `Drain the nodes of worker machines, then stop their kubelet, or power them off
+with --power-off, e.g. to save compute overnight. The machines are recorded as
+Hibernated until 'resume nodes' returns them to service. Masters are never
+hibernated, so the control plane stays available.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := mustSelectNodesForHibernation(cmd)
+		powerOff, err := cmd.Flags().GetBool("power-off")
+		if err != nil {
+			log.Fatalf("Unable to parse `power-off`: %v", err)
+		}
+		for i, machine := range machines {
+			log.Printf("[%d/%d] Hibernating machine %q", i+1, len(machines), machine.Name)
+			if err := hibernateMachine(&machine, powerOff); err != nil {
+				log.Fatalf("Unable to hibernate machine %q: %v", machine.Name, err)
+			}
+		}
+		log.Printf("Hibernated %d machines.", len(machines))
+	},
+}
+
+var nodesCmdResume = &cobra.Command{
+	Use:   "nodes",
+	Short: "Return hibernated worker machines to service",
+	Long: `Return hibernated worker machines to service: wait for each machine to be
+reachable, e.g. after it is powered on, start its kubelet, wait for its node to
+be Ready, and uncordon it. Selected machines that are not hibernated are
+skipped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		machines := mustSelectNodesForHibernation(cmd)
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse `timeout`: %v", err)
+		}
+		var resumed int
+		for _, machine := range machines {
+			if clusterapi.Phase(&machine) != clusterapi.MachinePhaseHibernated {
+				log.Printf("Skipping machine %q: it is not hibernated", machine.Name)
+				continue
+			}
+			log.Printf("Resuming machine %q", machine.Name)
+			if err := resumeMachine(&machine, timeout); err != nil {
+				log.Fatalf("Unable to resume machine %q: %v", machine.Name, err)
+			}
+			resumed++
+		}
+		log.Printf("Resumed %d machines.", resumed)
+	},
+}
+
+// mustSelectNodesForHibernation returns the machines selected by the flags,
+// and exits if any of them is a master.
+func mustSelectNodesForHibernation(cmd *cobra.Command) []clusterv1.Machine {
+	ips, err := cmd.Flags().GetStringSlice("ip")
+	if err != nil {
+		log.Fatalf("Unable to parse `ip` flag: %v", err)
+	}
+	selector, err := labels.Parse(cmd.Flag("selector").Value.String())
+	if err != nil {
+		log.Fatalf("Unable to parse `selector`: %v", err)
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		log.Fatalf("Unable to list machines: %v", err)
+	}
+	machines, err := selectMachines(machineList.Items, ips, clustercommon.MachineRole(strings.Title(cmd.Flag("role").Value.String())), selector)
+	if err != nil {
+		log.Fatalf("Unable to select machines: %v", err)
+	}
+	if len(machines) == 0 {
+		log.Fatalf("No machines selected.")
+	}
+	for _, machine := range machines {
+		if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+			log.Fatalf("Machine %q is a master. Only machines without the master role can be hibernated.", machine.Name)
+		}
+		if isEtcdMachine(&machine) {
+			log.Fatalf("Machine %q is an etcd machine. Only machines with a node can be hibernated.", machine.Name)
+		}
+	}
+	return machines
+}
+
+// hibernateMachine drains the node of the machine, then stops the kubelet, or
+// powers off the machine.
+func hibernateMachine(machine *clusterv1.Machine, powerOff bool) error {
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	nodeName, err := nodeNameForMachine(machine.Name, client)
+	if err != nil {
+		return fmt.Errorf("unable to identify node: %v", err)
+	}
+	if len(nodeName) == 0 {
+		return fmt.Errorf("no node found for machine %q", machine.Name)
+	}
+	log.Printf("Draining node %q", nodeName)
+	if err := drainNode(nodeName, client); err != nil {
+		return fmt.Errorf("unable to drain node %q: %v", nodeName, err)
+	}
+	machineOS, err := hostOSForMachine(machine, client)
+	if err != nil {
+		return fmt.Errorf("unable to detect operating system: %v", err)
+	}
+	cmd := machineOS.ServiceCommand("stop", common.KubeletService)
+	if powerOff {
+		// The machine powers off after the command returns, so that the
+		// result is not lost with the connection.
+		cmd = machineOS.PowerOffCommand()
+	}
+	log.Printf("Running %q", cmd)
+	if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return setMachinePhase(machine.Name, clusterapi.MachinePhaseHibernated)
+}
+
+// resumeMachine waits for the machine to be reachable, starts the kubelet,
+// waits for the node to be Ready, and uncordons it.
+func resumeMachine(machine *clusterv1.Machine, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	log.Printf("Waiting for machine %q to be reachable", machine.Name)
+	for {
+		client, err := machineClientForMachine(machine)
+		if err == nil {
+			_, _, err = client.RunCommand("true")
+		}
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("machine is not reachable: %v", err)
+		}
+		time.Sleep(rotatePollInterval)
+	}
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	machineOS, err := hostOSForMachine(machine, client)
+	if err != nil {
+		return fmt.Errorf("unable to detect operating system: %v", err)
+	}
+	cmd := machineOS.ServiceCommand("start", common.KubeletService)
+	if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	log.Printf("Waiting for the node of machine %q to be Ready", machine.Name)
+	if err := waitForNodeReady(machine.Name, client, deadline); err != nil {
+		return err
+	}
+	nodeName, err := nodeNameForMachine(machine.Name, client)
+	if err != nil {
+		return fmt.Errorf("unable to identify node: %v", err)
+	}
+	if err := uncordonNode(nodeName, client); err != nil {
+		return fmt.Errorf("unable to uncordon node %q: %v", nodeName, err)
+	}
+	return setMachinePhase(machine.Name, clusterapi.MachinePhaseReady)
+}
+
+func init() {
+	rootCmd.AddCommand(hibernateCmd)
+	rootCmd.AddCommand(resumeCmd)
+	hibernateCmd.AddCommand(nodesCmdHibernate)
+	resumeCmd.AddCommand(nodesCmdResume)
+	for _, cmd := range []*cobra.Command{nodesCmdHibernate, nodesCmdResume} {
+		cmd.Flags().StringSlice("ip", []string{}, "IPs of the machines. Provide a comma-separated list, or define multiple flags.")
+		cmd.Flags().String("role", "node", "Select the machines with this role. Empty selects machines of any role")
+		cmd.Flags().String("selector", "", "Select the machines whose labels match this selector, e.g. pool=lab")
+	}
+	nodesCmdHibernate.Flags().Bool("power-off", false, "Power off the machines, instead of stopping their kubelet")
+	nodesCmdHibernate.Flags().DurationVar(&drainTimeout, "drain-timeout", common.DrainTimeout, "The length of time to wait before giving up, zero means infinite")
+	nodesCmdHibernate.Flags().IntVar(&drainGracePeriodSeconds, "drain-grace-period", common.DrainGracePeriodSeconds, "Period of time in seconds given to each pod to terminate gracefully. If negative, the default value specified in the pod will be used.")
+	nodesCmdHibernate.Flags().BoolVar(&drainDeleteLocalData, "drain-delete-local-data", common.DrainDeleteLocalData, "Continue even if there are pods using emptyDir (local data that will be deleted when the node is drained).")
+	nodesCmdHibernate.Flags().BoolVar(&drainForce, "drain-force", common.DrainForce, "Continue even if there are pods not managed by a ReplicationController, ReplicaSet, Job, DaemonSet or StatefulSet.")
+	nodesCmdResume.Flags().Duration("timeout", 15*time.Minute, "How long to wait for each machine to be reachable and its node to be Ready")
+}
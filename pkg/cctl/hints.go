@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/hints"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// failureHints collects hints for the failures of the current operation,
+// from the output of failed commands and from the error that ends it.
+var failureHints = &hints.Collector{}
+
+// hintsHook looks for known failures in the error that ends the operation.
+type hintsHook struct{}
+
+func (hintsHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.FatalLevel}
+}
+
+func (hintsHook) Fire(entry *logrus.Entry) error {
+	failureHints.Observe(entry.Message)
+	return nil
+}
+
+// writeFailureHints writes the hints for the failures of the operation,
+// after the error that ends it.
+func writeFailureHints() {
+	hints.Write(os.Stderr, failureHints.Hints())
+}
+
+// hintedError is an error with the hints for the failures that led to it.
+type hintedError struct {
+	error
+	hints []hints.Hint
+}
+
+func (e *hintedError) Cause() error {
+	return e.error
+}
+
+func (e *hintedError) Hints() []hints.Hint {
+	return e.hints
+}
+
+// withFailureHints returns the error with the hints for the failures of the
+// operation, if there are any.
+func withFailureHints(err error) error {
+	if err == nil {
+		return nil
+	}
+	failureHints.Observe(err.Error())
+	found := failureHints.Hints()
+	if len(found) == 0 {
+		return err
+	}
+	return &hintedError{error: err, hints: found}
+}
+
+// hintingClient looks for known failures in the output of commands that fail
+// on the machine. The actuators do not return this output in their errors.
+type hintingClient struct {
+	sshmachine.Client
+}
+
+func (c *hintingClient) Close() error {
+	return sshutil.Close(c.Client)
+}
+
+func (c *hintingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	stdOut, stdErr, err := c.Client.RunCommand(cmd)
+	if err != nil {
+		failureHints.Observe(string(stdErr), string(stdOut), err.Error())
+	}
+	return stdOut, stdErr, err
+}
+
+func init() {
+	log.AddHook(hintsHook{})
+	log.RegisterExitHandler(writeFailureHints)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"sync"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/discover"
+	"github.com/platform9/cctl/pkg/util/hostos"
+)
+
+var (
+	// hostOSes are the operating systems of machines, by machine client, so
+	// that each is detected once.
+	hostOSes   = make(map[sshmachine.Client]hostos.OS)
+	hostOSesMu sync.Mutex
+)
+
+// detectHostOS detects the operating system family and init system of the
+// machine.
+func detectHostOS(client sshmachine.Client) (hostos.OS, error) {
+	hostOSesMu.Lock()
+	o, ok := hostOSes[client]
+	hostOSesMu.Unlock()
+	if ok {
+		return o, nil
+	}
+	out, err := remoteOutput(client, "cat /etc/os-release")
+	if err != nil {
+		return hostos.OS{}, err
+	}
+	if o.Family, err = hostos.FamilyOf(discover.ParseOSRelease(out)); err != nil {
+		return hostos.OS{}, err
+	}
+	for _, init := range hostos.InitSystems {
+		if _, _, err := client.RunCommand(hostos.InitSystemProbes[init]); err == nil {
+			o.Init = init
+			break
+		}
+	}
+	if len(o.Init) == 0 {
+		return hostos.OS{}, fmt.Errorf("unable to find a supported init system (systemd or openrc)")
+	}
+	hostOSesMu.Lock()
+	hostOSes[client] = o
+	hostOSesMu.Unlock()
+	return o, nil
+}
+
+// hostOSForMachine returns the operating system recorded for the machine when
+// it was created or, for machines created before it was recorded, detects it.
+func hostOSForMachine(machine *clusterv1.Machine, client sshmachine.Client) (hostos.OS, error) {
+	value, ok := machine.Annotations[common.HostOSAnnotationKey]
+	if !ok {
+		return detectHostOS(client)
+	}
+	o, err := hostos.Parse(value)
+	if err != nil {
+		return hostos.OS{}, fmt.Errorf("unable to parse operating system of machine %q: %v", machine.Name, err)
+	}
+	hostOSesMu.Lock()
+	hostOSes[client] = o
+	hostOSesMu.Unlock()
+	return o, nil
+}
+
+// hostOS returns the operating system of the machine of the client. If it
+// cannot be detected, the default operating system is assumed.
+func hostOS(client sshmachine.Client) hostos.OS {
+	o, err := detectHostOS(client)
+	if err != nil {
+		log.Debugf("Unable to detect operating system, assuming %s: %v", hostos.Default, err)
+		return hostos.Default
+	}
+	return o
+}
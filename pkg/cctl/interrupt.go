@@ -0,0 +1,73 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// commandContext is cancelled when cctl is interrupted, so that the commands
+// it runs on machines stop, rather than run on unattended, and the operation
+// fails at its next step.
+var commandContext, cancelCommandContext = context.WithCancel(context.Background())
+
+// interruptStopsCommands is unset by commands that handle interrupts
+// themselves, e.g. serve, which lets the running job complete.
+var interruptStopsCommands = true
+
+var handleInterruptOnce sync.Once
+
+// handleInterrupt cancels commandContext when cctl is first interrupted, and
+// exits when it is interrupted again.
+func handleInterrupt() {
+	handleInterruptOnce.Do(func() {
+		if !interruptStopsCommands {
+			return
+		}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			log.Warnf("Received %v. Stopping the commands running on machines. Send it again to exit immediately.", sig)
+			cancelCommandContext()
+			sig = <-signals
+			log.Fatalf("Received %v. Exiting.", sig)
+		}()
+	})
+}
+
+// bindCommandContext makes the clients of the builder stop their commands
+// when commandContext is cancelled.
+func bindCommandContext(builder sshutil.ClientBuilder) sshutil.ClientBuilder {
+	return func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		handleInterrupt()
+		client, err := builder(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+		if err != nil {
+			return nil, err
+		}
+		return sshutil.BindContext(commandContext, client), nil
+	}
+}
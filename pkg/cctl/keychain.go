@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/keychain"
+)
+
+var keychainAccounts = []string{common.KeychainSSHKeyPassphraseAccount, common.KeychainBastionSSHKeyPassphraseAccount}
+
+var keychainCmdCreate = &cobra.Command{
+	Use:   "keychain-secret",
+	Short: "Store a passphrase in the OS keychain",
+	Long: fmt.Sprintf(`Store a passphrase in the OS keychain (macOS Keychain, libsecret, or
+Windows Credential Manager), so that it does not need to be given in an
+environment variable. Supported names: %s`, strings.Join(keychainAccounts, ", ")),
+	Run: func(cmd *cobra.Command, args []string) {
+		account := cmd.Flag("name").Value.String()
+		if err := validateKeychainAccount(account); err != nil {
+			log.Fatalf("Invalid --name: %v", err)
+		}
+		secret, err := readSecret(fmt.Sprintf("Enter %s: ", account))
+		if err != nil {
+			log.Fatalf("Unable to read secret: %v", err)
+		}
+		if len(secret) == 0 {
+			log.Fatalf("Secret must not be empty.")
+		}
+		if err := keychain.Set(account, secret); err != nil {
+			log.Fatalf("Unable to store secret in keychain: %v", err)
+		}
+		log.Printf("Stored %s in the keychain", account)
+	},
+}
+
+var keychainCmdDelete = &cobra.Command{
+	Use:   "keychain-secret",
+	Short: "Delete a passphrase from the OS keychain",
+	Run: func(cmd *cobra.Command, args []string) {
+		account := cmd.Flag("name").Value.String()
+		if err := validateKeychainAccount(account); err != nil {
+			log.Fatalf("Invalid --name: %v", err)
+		}
+		if err := keychain.Delete(account); err != nil {
+			if err == keychain.ErrNotFound {
+				log.Fatalf("No %s found in the keychain.", account)
+			}
+			log.Fatalf("Unable to delete secret from keychain: %v", err)
+		}
+		log.Printf("Deleted %s from the keychain", account)
+	},
+}
+
+func validateKeychainAccount(account string) error {
+	for _, a := range keychainAccounts {
+		if a == account {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %s", account, strings.Join(keychainAccounts, ", "))
+}
+
+// readSecret reads a secret from the terminal without echoing it, or from
+// stdin if it is not a terminal.
+func readSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		b, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) == 0 {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// passphrase returns the passphrase stored in the keychain for the account.
+// If the keychain has none, or is not available, the environment variable is
+// used instead.
+func passphrase(account, envVar string) (string, bool) {
+	secret, err := keychain.Get(account)
+	if err == nil {
+		return secret, true
+	}
+	if err != keychain.ErrNotFound {
+		log.Debugf("Unable to read %s from keychain: %v", account, err)
+	}
+	return os.LookupEnv(envVar)
+}
+
+func init() {
+	createCmd.AddCommand(keychainCmdCreate)
+	keychainCmdCreate.Flags().String("name", "", fmt.Sprintf("Name of the passphrase. One of %s", strings.Join(keychainAccounts, ", ")))
+	keychainCmdCreate.MarkFlagRequired("name")
+
+	deleteCmd.AddCommand(keychainCmdDelete)
+	keychainCmdDelete.Flags().String("name", "", fmt.Sprintf("Name of the passphrase. One of %s", strings.Join(keychainAccounts, ", ")))
+	keychainCmdDelete.MarkFlagRequired("name")
+}
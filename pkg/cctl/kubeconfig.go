@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+)
+
+var kubeconfigCmdGet = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "Get kubeconfig for cluster",
+	Long: `Get the admin kubeconfig of the cluster, from the state, or, if it is not in
+the state, from a master. The kubeconfig is printed to stdout, and written to a
+file only if --file is given. Log messages are written to stderr, so that
+stdout can be consumed by other programs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetInfoOutput(os.Stderr)
+		file := cmd.Flag("file").Value.String()
+		kubeconfig, err := adminKubeconfig()
+		if err != nil {
+			log.Fatalf("Unable to get admin kubeconfig: %v", err)
+		}
+		switch outputFmt {
+		case "", "yaml":
+		case "json":
+			if kubeconfig, err = yaml.YAMLToJSON(kubeconfig); err != nil {
+				log.Fatalf("Unable to convert admin kubeconfig to json: %v", err)
+			}
+			kubeconfig = append(kubeconfig, '\n')
+		default:
+			log.Fatalf("Unknown output format %q, must be yaml or json", outputFmt)
+		}
+		if err := writeSecretOutput(file, kubeconfig); err != nil {
+			log.Fatalf("Unable to write admin kubeconfig: %v", err)
+		}
+	},
+}
+
+// adminKubeconfig returns the admin kubeconfig from the state, or, if it is
+// not in the state, from a master. The state is not changed.
+func adminKubeconfig() ([]byte, error) {
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultAdminConfigSecretName, metav1.GetOptions{})
+	if err == nil {
+		kubeconfig, ok := secret.Data[common.DefaultAdminConfigSecretKey]
+		if !ok || len(kubeconfig) == 0 {
+			return nil, fmt.Errorf("unable to find data in admin kubeconfig secret")
+		}
+		return kubeconfig, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get admin kubeconfig secret: %v", err)
+	}
+	machine, provisionedMachine, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get master machine and provisioned machine: %v", err)
+	}
+	log.Printf("Reading admin kubeconfig from master %q", machine.Name)
+	return adminKubeconfigFromMachine(machine, provisionedMachine)
+}
+
+func init() {
+	getCmd.AddCommand(kubeconfigCmdGet)
+	kubeconfigCmdGet.Flags().String("file", "", "Specify the file to write kubeconfig to, readable only by the user. If not specified, output on stdout")
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/kubelet"
+)
+
+// kubeletConfigOverridesFromFile reads the kubelet configuration overrides
+// from the YAML or JSON file.
+func kubeletConfigOverridesFromFile(file string) (kubelet.Overrides, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read kubelet configuration file %q: %v", file, err)
+	}
+	o, err := kubelet.ParseOverrides(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse kubelet configuration file %q: %v", file, err)
+	}
+	return o, nil
+}
+
+// setKubeletConfigOverrides records the kubelet configuration overrides in
+// the machine, so that they are applied again after the machine is upgraded.
+func setKubeletConfigOverrides(machine *clusterv1.Machine, o kubelet.Overrides) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("unable to encode kubelet configuration overrides: %v", err)
+	}
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[common.KubeletConfigAnnotationKey] = string(b)
+	return nil
+}
+
+// kubeletConfigOverrides returns the kubelet configuration overrides recorded
+// in the machine, or nil if there are none.
+func kubeletConfigOverrides(machine *clusterv1.Machine) (kubelet.Overrides, error) {
+	value, ok := machine.Annotations[common.KubeletConfigAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	var o kubelet.Overrides
+	if err := json.Unmarshal([]byte(value), &o); err != nil {
+		return nil, fmt.Errorf("unable to decode kubelet configuration overrides of machine %q: %v", machine.Name, err)
+	}
+	return o, nil
+}
+
+// applyKubeletConfigOverrides merges the kubelet configuration overrides of
+// the machine, if any, into the kubelet configuration written by kubeadm, and
+// restarts the kubelet if the configuration changed.
+func applyKubeletConfigOverrides(machine *clusterv1.Machine, machineClient sshmachine.Client) error {
+	o, err := kubeletConfigOverrides(machine)
+	if err != nil || o == nil {
+		return err
+	}
+	config, err := machineClient.ReadFile(common.KubeletConfigFile)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", common.KubeletConfigFile, err)
+	}
+	merged, changed, err := kubelet.Merge(config, o)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		log.Printf("Kubelet configuration of machine %q already has its overrides", machine.Name)
+		return nil
+	}
+	log.Printf("Applying kubelet configuration overrides to machine %q", machine.Name)
+	if err := machineClient.WriteFile(common.KubeletConfigFile, 0644, merged); err != nil {
+		return fmt.Errorf("unable to write %q: %v", common.KubeletConfigFile, err)
+	}
+	return restartService(common.KubeletService, machineClient)
+}
@@ -0,0 +1,2930 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+
+	setsutil "github.com/platform9/ssh-provider/pkg/util/sets"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/apiendpoint"
+	"github.com/platform9/cctl/pkg/util/archive"
+	"github.com/platform9/cctl/pkg/util/cliparse"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/dataloss"
+	etcdutil "github.com/platform9/cctl/pkg/util/etcd"
+	"github.com/platform9/cctl/pkg/util/hostos"
+	kubeadmutil "github.com/platform9/cctl/pkg/util/kubeadm"
+	"github.com/platform9/cctl/pkg/util/kubelet"
+	"github.com/platform9/cctl/pkg/util/netif"
+	"github.com/platform9/cctl/pkg/util/objectmeta"
+	"github.com/platform9/cctl/pkg/util/operror"
+	"github.com/platform9/cctl/pkg/util/provider"
+	"github.com/platform9/cctl/pkg/util/secretstore"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	machineActuator "github.com/platform9/ssh-provider/pkg/clusterapi/machine"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ifaceFlagUsage describes the --iface flag of the machine commands.
+const ifaceFlagUsage = "Interface that keepalived will bind to in case of master. Provide a comma-separated list of candidates to use the first one found on the machine; the candidate \"auto\" selects the interface on the subnet of the VIP"
+
+var (
+	drainTimeout            time.Duration
+	drainGracePeriodSeconds int
+	drainDeleteLocalData    bool
+	drainForce              bool
+	// keepMachineOnFailure keeps a machine that fails to be created, instead
+	// of rolling it back.
+	keepMachineOnFailure bool
+	// newNodeLabels and newNodeTaints are applied to the cluster node of a
+	// machine when it is created.
+	newNodeLabels map[string]string
+	newNodeTaints []corev1.Taint
+	// newKubeletConfig is merged into the kubelet configuration of a machine
+	// when it is created.
+	newKubeletConfig kubelet.Overrides
+	// acknowledgeDataLoss deletes a machine even if the data of pods on its
+	// node is lost.
+	acknowledgeDataLoss bool
+)
+
+func updateBootstrapToken(masterMachine *clusterv1.Machine, masterProvisionedMachine *spv1.ProvisionedMachine) error {
+	log.Println("Getting a bootstrap token from a master")
+	newBootstrapTokenSecret, err := bootstrapTokenSecretFromMachine(masterMachine, masterProvisionedMachine)
+	if err != nil {
+		return fmt.Errorf("Unable to read bootstrap token from master: %v", err)
+	}
+	if existing, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultBootstrapTokenSecretName, metav1.GetOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("Unable to get bootstrap token secret: %v", err)
+		}
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newBootstrapTokenSecret); err != nil {
+			return fmt.Errorf("Unable to create bootstrap token secret: %v", err)
+		}
+	} else {
+		secretstore.KeepPath(newBootstrapTokenSecret, existing)
+		if _, err := state.KubeClient.CoreV1().Secrets(namespace).Update(newBootstrapTokenSecret); err != nil {
+			return fmt.Errorf("Unable to update bootstrap token secret: %v", err)
+		}
+	}
+	return nil
+}
+
+func createAdminKubeconfigSecret(machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine) (*corev1.Secret, error) {
+	adminConfigData, err := adminKubeconfigFromMachine(machine, provisionedMachine)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get admin kubeconfig data: %v", err)
+	}
+	adminConfigSecret := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              common.DefaultAdminConfigSecretName,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.Now(),
+		},
+		Data: make(map[string][]byte),
+	}
+	adminConfigSecret.Data[common.DefaultAdminConfigSecretKey] = adminConfigData
+	return &adminConfigSecret, nil
+}
+
+func copyAdminConfigFromSecret(masterMachine *clusterv1.Machine, masterProvisionedMachine *spv1.ProvisionedMachine,
+	newMachine *clusterv1.Machine, newProvisionedMachine *spv1.ProvisionedMachine) error {
+	log.Println("Writing admin kubeconfig to machine")
+	kubeconfig, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultAdminConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Unable to get admin kubeconfig from secret: %v", err)
+	}
+	kubeconfigData, ok := kubeconfig.Data[common.DefaultAdminConfigSecretKey]
+	if !ok {
+		return fmt.Errorf("unable to find data in admin kubeconfig secret")
+	}
+	if len(kubeconfigData) == 0 {
+		return fmt.Errorf("invalid data in admin kubeconfig secret")
+	}
+	kubeconfigData, err = adminKubeconfigForMachine(kubeconfigData, newMachine, masterProvisionedMachine)
+	if err != nil {
+		return fmt.Errorf("unable to choose the admin kubeconfig server: %v", err)
+	}
+	if err := writeAdminKubeconfigToMachine(kubeconfigData, newMachine, newProvisionedMachine); err != nil {
+		return fmt.Errorf("Unable to write admin kubeconfig to machine: %v", err)
+	}
+	return nil
+}
+
+func createAdminKubeConfigSecretIfNotPresent() error {
+	machine, provisionedMachine, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return fmt.Errorf("unable to get master machine and provisioned machine: %v", err)
+	}
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultAdminConfigSecretName, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			adminKubeConfigSecret, err := createAdminKubeconfigSecret(machine, provisionedMachine)
+			if err != nil {
+				return fmt.Errorf("unable to create secret for admin kubeconfig: %v", err)
+			}
+			if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(adminKubeConfigSecret); err != nil {
+				return fmt.Errorf("unable to create secret for admin kubeconfig: %v", err)
+			}
+		} else {
+			return fmt.Errorf("unable to get secret for admin kubeconfig: %v", err)
+		}
+	}
+	return nil
+}
+
+func createMachine(ip string, port int, iface string, roleString string, publicKeyFiles []string) error {
+	role := clustercommon.MachineRole(roleString)
+	// TODO(dlipovetsky) Move to master validation code
+	if role != clustercommon.MasterRole && role != clustercommon.NodeRole && role != clusterapi.EtcdRole {
+		return operror.New(operror.Invalid, "machine role %q is not supported, must be %q, %q, or %q", role, clustercommon.MasterRole, clustercommon.NodeRole, clusterapi.EtcdRole)
+	}
+	publicKeys, err := parsePublicKeyFiles(publicKeyFiles)
+	if err != nil {
+		return err
+	}
+
+	sshCredentialSecret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultSSHCredentialSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return operror.New(operror.NotFound, "no SSH credential found. Create a credential before creating a machine")
+		}
+		return fmt.Errorf("unable to get SSH credential secret: %v", err)
+	}
+
+	newSSHConfig := spv1.SSHConfig{
+		Host:       ip,
+		Port:       port,
+		PublicKeys: publicKeys,
+		CredentialSecret: corev1.LocalObjectReference{
+			Name: sshCredentialSecret.Name,
+		},
+	}
+
+	return createMachineWithSSHConfig(ip, role, iface, newSSHConfig, nil)
+}
+
+// parsePublicKeyFiles returns the SSH public keys in the files, in
+// authorized_keys format.
+func parsePublicKeyFiles(publicKeyFiles []string) ([]string, error) {
+	var publicKeys []string
+	for _, file := range publicKeyFiles {
+		publicKey, err := sshutil.PublicKeyFromFile(file)
+		if err != nil {
+			return nil, operror.New(operror.Invalid, "unable to parse SSH public key from %q: %v", file, err)
+		}
+		publicKeys = append(publicKeys, string(ssh.MarshalAuthorizedKey(publicKey)))
+	}
+	return publicKeys, nil
+}
+
+// machineTemplate is the configuration of an existing machine that a new
+// machine can be created like.
+type machineTemplate struct {
+	role             clustercommon.MachineRole
+	iface            string
+	port             int
+	credentialSecret corev1.LocalObjectReference
+	labels           map[string]string
+}
+
+// machineTemplateFrom returns the configuration of the machine, to create
+// another machine like it.
+func machineTemplateFrom(ip string) (*machineTemplate, error) {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, operror.New(operror.NotFound, "machine %q not found", ip)
+		}
+		return nil, fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	if len(machine.Spec.Roles) != 1 {
+		return nil, operror.New(operror.Invalid, "machine %q has roles %v; only a machine with exactly one role can be copied", ip, machine.Spec.Roles)
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode machine %q spec: %v", ip, err)
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	labels := make(map[string]string, len(machine.Labels))
+	for k, v := range machine.Labels {
+		labels[k] = v
+	}
+	return &machineTemplate{
+		role:             machine.Spec.Roles[0],
+		iface:            pm.Spec.VIPNetworkInterface,
+		port:             pm.Spec.SSHConfig.Port,
+		credentialSecret: pm.Spec.SSHConfig.CredentialSecret,
+		labels:           labels,
+	}, nil
+}
+
+// createMachineLike creates a machine with the role, SSH credential, and
+// labels of the template, reached on the port, with keepalived bound to the
+// interface.
+func createMachineLike(ip string, template *machineTemplate, port int, iface string, publicKeyFiles []string) error {
+	publicKeys, err := parsePublicKeyFiles(publicKeyFiles)
+	if err != nil {
+		return err
+	}
+	newSSHConfig := spv1.SSHConfig{
+		Host:             ip,
+		Port:             port,
+		PublicKeys:       publicKeys,
+		CredentialSecret: template.credentialSecret,
+	}
+	return createMachineWithSSHConfig(ip, template.role, iface, newSSHConfig, template.labels)
+}
+
+// createMachineWithSSHConfig creates and provisions a machine that is reached
+// using the SSH configuration. The machine object gets the labels, if any. If
+// the machine fails to be created, it is rolled back, unless
+// keepMachineOnFailure is set. If a machine that was not created completely
+// already exists for the IP, its creation is resumed from the first
+// incomplete step.
+func createMachineWithSSHConfig(ip string, role clustercommon.MachineRole, iface string, newSSHConfig spv1.SSHConfig, labels map[string]string) error {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return operror.New(operror.NotFound, "no cluster found. Create a cluster before creating a machine")
+		}
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+
+	cspec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	newMachine, newProvisionedMachine, err := existingMachineAndProvisionedMachine(ip, role)
+	if err != nil {
+		return err
+	}
+	if newMachine != nil {
+		switch phase := clusterapi.Phase(newMachine); phase {
+		case clusterapi.MachinePhaseProvisioning, clusterapi.MachinePhaseFailed:
+			return resumeCreatingMachine(cluster, newMachine, newProvisionedMachine)
+		default:
+			log.Printf("Machine %q already exists, with phase %s. Nothing to do.", ip, phase)
+			return nil
+		}
+	}
+	if role == clusterapi.EtcdRole && (len(newNodeLabels) != 0 || len(newNodeTaints) != 0 || newKubeletConfig != nil) {
+		return operror.New(operror.Invalid, "etcd machines have no node, so they cannot have labels, taints, or a kubelet configuration")
+	}
+	// If no vip exists, check if other masters exist before creating a new one.
+	if cspec.VIPConfiguration == nil {
+		if role == clustercommon.MasterRole {
+			_, _, err = masterMachineAndProvisionedMachine()
+			if err == nil {
+				return operror.New(operror.Precondition, "creating a master is not allowed: this cluster already has one master and has no VIP configured")
+			}
+		}
+	}
+
+	iface, err = selectVIPNetworkInterface(role, iface, cspec.VIPConfiguration, &newSSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to select the interface keepalived will bind to: %v", err)
+	}
+	preflightClient, err := sshMachineClientFromSSHConfig(&newSSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	if err := runPreflightChecks(preflightClient, role, preflightPorts(role), cluster, cspec); err != nil {
+		return err
+	}
+	newProvisionedMachine, newMachine, err = newProvisionedMachineAndMachine(ip, role, iface, newSSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine objects: %v", err)
+	}
+	// The operating system is recorded, so that the commands for it are run
+	// on the machine later, without detecting it again.
+	if detected, err := detectHostOS(preflightClient); err != nil {
+		log.Warnf("Unable to detect the operating system of the machine; commands for %s are used: %v", hostos.Default, err)
+	} else {
+		if newMachine.Annotations == nil {
+			newMachine.Annotations = make(map[string]string)
+		}
+		newMachine.Annotations[common.HostOSAnnotationKey] = detected.String()
+	}
+	if len(labels) != 0 {
+		newMachine.Labels = labels
+	}
+	if len(newNodeLabels) != 0 {
+		newMachine.Spec.Labels = newNodeLabels
+	}
+	// The taints are registered with the node when it joins the cluster.
+	newMachine.Spec.Taints = append(newMachine.Spec.Taints, newNodeTaints...)
+	if newKubeletConfig != nil {
+		if err := setKubeletConfigOverrides(newMachine, newKubeletConfig); err != nil {
+			return err
+		}
+	}
+	clusterapi.SetPhase(newMachine, clusterapi.MachinePhaseProvisioning)
+	if _, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Create(newProvisionedMachine); err != nil {
+		return fmt.Errorf("unable to create provisioned machine: %v", err)
+	}
+	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Create(newMachine); err != nil {
+		if err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Delete(newProvisionedMachine.Name, &metav1.DeleteOptions{}); err != nil {
+			log.Errorf("Unable to delete provisioned machine %q: %v", newProvisionedMachine.Name, err)
+		}
+		return fmt.Errorf("unable to create machine: %v", err)
+	}
+	return provisionMachine(cluster, newMachine, newProvisionedMachine)
+}
+
+// resumeCreatingMachine resumes creating the machine from the first step that
+// was not completed.
+func resumeCreatingMachine(cluster *clusterv1.Cluster, machine *clusterv1.Machine, pm *spv1.ProvisionedMachine) error {
+	var completed []string
+	for _, step := range clusterapi.CompletedCreateSteps(machine) {
+		completed = append(completed, string(step))
+	}
+	if len(completed) == 0 {
+		completed = append(completed, "none")
+	}
+	log.Printf("Resuming creation of machine %q, with phase %s. Completed steps: %s. Skipping preflight checks.", machine.Name, clusterapi.Phase(machine), strings.Join(completed, ", "))
+	// The machine is updated, rather than its phase set by name, because the
+	// actuator updates the status of the machine it is given.
+	clusterapi.SetPhase(machine, clusterapi.MachinePhaseProvisioning)
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine)
+	if err != nil {
+		return fmt.Errorf("unable to record machine phase: %v", err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return provisionMachine(cluster, machine, pm)
+}
+
+// machineExists returns true if there is a machine for the IP.
+func machineExists(ip string) bool {
+	_, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	return err == nil
+}
+
+// existingMachineAndProvisionedMachine returns the machine and provisioned
+// machine for the IP, or nil if there is no machine. The machine must have the
+// role.
+func existingMachineAndProvisionedMachine(ip string, role clustercommon.MachineRole) (*clusterv1.Machine, *spv1.ProvisionedMachine, error) {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("unable to get machine %q: %v", ip, err)
+		}
+		if _, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(ip, metav1.GetOptions{}); err == nil {
+			return nil, nil, operror.New(operror.Precondition, "provisioned machine %q exists, but has no machine. Remove it with 'cctl prune state --older-than 0d' before creating the machine", ip)
+		}
+		return nil, nil, nil
+	}
+	if !clusterutil.RoleContains(role, machine.Spec.Roles) {
+		return nil, nil, operror.New(operror.Invalid, "machine %q already exists with roles %v", ip, machine.Spec.Roles)
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode machine %q spec: %v", ip, err)
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	return machine, pm, nil
+}
+
+// provisionMachine provisions the machine, and updates the cluster status,
+// skipping the steps that were already completed. Each step is recorded when
+// it completes.
+func provisionMachine(cluster *clusterv1.Cluster, newMachine *clusterv1.Machine, newProvisionedMachine *spv1.ProvisionedMachine) (err error) {
+	// actuator is set once the machine is about to be provisioned, so that
+	// the rollback resets it.
+	var actuator provider.Actuator
+	defer func() {
+		if err == nil {
+			return
+		}
+		if !keepMachineOnFailure {
+			rollbackMachine(newMachine.Name, newProvisionedMachine.Name, actuator)
+			return
+		}
+		if err := setMachinePhase(newMachine.Name, clusterapi.MachinePhaseFailed); err != nil {
+			log.Errorf("Unable to record machine phase: %v", err)
+		}
+	}()
+
+	var masterMachine *clusterv1.Machine
+	var masterProvisionedMachine *spv1.ProvisionedMachine
+	if clusterutil.RoleContains(clustercommon.NodeRole, newMachine.Spec.Roles) {
+		var err error
+		masterMachine, masterProvisionedMachine, err = masterMachineAndProvisionedMachine()
+		if err != nil {
+			return fmt.Errorf("unable to get a master machine and provisioned machine: %v", err)
+		}
+		log.Println("Updating bootstrap token")
+		if err := updateBootstrapToken(masterMachine, masterProvisionedMachine); err != nil {
+			return fmt.Errorf("unable to update bootstrap token: %v", err)
+		}
+	}
+	machineClientBuilder, err := newMachineClientBuilder()
+	if err != nil {
+		return fmt.Errorf("unable to create machine client builder: %v", err)
+	}
+	insecureIgnoreHostKey := false
+	if len(newProvisionedMachine.Spec.SSHConfig.PublicKeys) == 0 {
+		insecureIgnoreHostKey = true
+		log.Printf("Not able to verify machine SSH identity: No public keys given. Continuing...")
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	actuator = newActuator(
+		state.KubeClient,
+		state.ClusterClient,
+		state.SPClient,
+		machineClientBuilder,
+		insecureIgnoreHostKey,
+		log.LogLevel(),
+	)
+	if clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepProvisioned) {
+		log.Println("Machine already provisioned")
+	} else {
+		if err := ensureProvisioningBinaries(newMachine, newProvisionedMachine); err != nil {
+			return err
+		}
+		log.Println("Provisioning machine")
+		create := actuator.Create
+		if isEtcdMachine(newMachine) {
+			create = createEtcdMachine
+		}
+		if err := create(cluster, newMachine); err != nil {
+			return fmt.Errorf("unable to create machine: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepProvisioned); err != nil {
+			return err
+		}
+	}
+
+	if clusterutil.RoleContains(clustercommon.NodeRole, newMachine.Spec.Roles) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepAdminKubeconfig) {
+		log.Println("Writing admin kubeconfig to the node")
+		if err := createAdminKubeConfigSecretIfNotPresent(); err != nil {
+			return fmt.Errorf("unable to create admin kubeconfig secret: %v", err)
+		}
+		if err := copyAdminConfigFromSecret(masterMachine, masterProvisionedMachine, newMachine, newProvisionedMachine); err != nil {
+			return fmt.Errorf("unable to place admin kubeconfig on the node: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepAdminKubeconfig); err != nil {
+			return err
+		}
+	}
+
+	if clusterapi.RunsEtcd(*newMachine) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepClusterStatus) {
+		log.Println("Updating cluster status")
+		// Update cluster etcd members
+		machineStatus, err := providerCodec.GetMachineStatus(*newMachine)
+		if err != nil {
+			return fmt.Errorf("unable to get machine %q status: %v", newMachine.Name, err)
+		}
+		if machineStatus.EtcdMember != nil {
+			if err := insertClusterEtcdMember(*machineStatus.EtcdMember, cluster); err != nil {
+				return fmt.Errorf("unable to add etcd member to cluster status: %v", err)
+			}
+		}
+		// Update cluster API endpoints. Etcd machines have no API server.
+		if clusterutil.RoleContains(clustercommon.MasterRole, newMachine.Spec.Roles) {
+			var apiEndpoint *clusterv1.APIEndpoint
+			// Use the controlPlaneEndpoint if it is defined
+			apiEndpoint, err = controlPlaneEndpointFromMachine(newMachine, newProvisionedMachine)
+			if err != nil {
+				if err.Error() != "controlPlaneEndpoint is not defined" {
+					return fmt.Errorf("unable to get machine %q control plane endpoint: %v", newMachine.Name, err)
+				}
+				// If control plane endpoint is not defined, use the machine's advertised API address and port
+				apiEndpoint, err = apiEndpointFromMachine(newMachine, newProvisionedMachine)
+				if err != nil {
+					return fmt.Errorf("unable to get machine %q advertised API address and port: %v", newMachine.Name, err)
+				}
+			}
+
+			updated, err := clusterapi.UpdateClusterStatus(state.ClusterClient, namespace, cluster.Name, func(c *clusterv1.Cluster) error {
+				apiEndpointSet := setsutil.NewAPIEndpointSet(c.Status.APIEndpoints...)
+				apiEndpointSet.Insert(*apiEndpoint)
+				c.Status.APIEndpoints = apiEndpointSet.List()
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("unable to update cluster state: %v", err)
+			}
+			*cluster = *updated
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepClusterStatus); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cluster.Annotations[common.CNIAnnotationKey]; ok && !isEtcdMachine(newMachine) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepCNI) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := ensureCNI(cluster, newMachine, machineClient); err != nil {
+			return fmt.Errorf("unable to deploy the pod network: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepCNI); err != nil {
+			return err
+		}
+	}
+
+	if clusterutil.RoleContains(clustercommon.MasterRole, newMachine.Spec.Roles) && len(apiServerCertSANs(cluster)) != 0 && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepAPIServerCertSANs) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := ensureAPIServerCertSANs(cluster, newMachine.Name, machineClient); err != nil {
+			return fmt.Errorf("unable to add alternative names to the API server certificate: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepAPIServerCertSANs); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cluster.Annotations[common.AuditPolicyAnnotationKey]; ok && clusterutil.RoleContains(clustercommon.MasterRole, newMachine.Spec.Roles) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepAuditConfig) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := ensureAuditConfig(cluster, newMachine.Name, machineClient); err != nil {
+			return fmt.Errorf("unable to configure audit logging: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepAuditConfig); err != nil {
+			return err
+		}
+	}
+
+	if clusterutil.RoleContains(clustercommon.MasterRole, newMachine.Spec.Roles) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepEncryptionConfig) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := ensureEncryptionConfig(newMachine, machineClient); err != nil {
+			return fmt.Errorf("unable to configure encryption of secrets: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepEncryptionConfig); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cluster.Annotations[common.KeepalivedAnnotationKey]; ok && clusterutil.RoleContains(clustercommon.MasterRole, newMachine.Spec.Roles) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepKeepalivedConfig) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := ensureKeepalivedConfig(cluster, newMachine, machineClient); err != nil {
+			return fmt.Errorf("unable to apply the VRRP settings: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepKeepalivedConfig); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cluster.Annotations[common.ControlPlaneHookAnnotationKey]; ok && !isEtcdMachine(newMachine) && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepControlPlaneHook) {
+		if err := syncNewMachineAPIEndpoint(cluster, newMachine); err != nil {
+			return fmt.Errorf("unable to update the control plane endpoints: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepControlPlaneHook); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := cluster.Annotations[common.DNSRecordAnnotationKey]; ok && clusterutil.RoleContains(clustercommon.MasterRole, newMachine.Spec.Roles) {
+		if err := syncDNSRecord(false); err != nil {
+			return fmt.Errorf("unable to register the DNS name of the API endpoint: %v", err)
+		}
+	}
+
+	if _, ok := newMachine.Annotations[common.KubeletConfigAnnotationKey]; ok && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepKubeletConfig) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := applyKubeletConfigOverrides(newMachine, machineClient); err != nil {
+			return fmt.Errorf("unable to apply kubelet configuration overrides: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepKubeletConfig); err != nil {
+			return err
+		}
+	}
+
+	if len(newMachine.Spec.Labels) != 0 && !clusterapi.CreateStepCompleted(newMachine, clusterapi.CreateStepNodeLabels) {
+		machineClient, err := sshMachineClientFromSSHConfig(newProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client: %v", err)
+		}
+		if err := labelNodeForMachine(newMachine, newMachine.Spec.Labels, machineClient); err != nil {
+			return fmt.Errorf("unable to label the node: %v", err)
+		}
+		if err := recordCreateStep(newMachine.Name, clusterapi.CreateStepNodeLabels); err != nil {
+			return err
+		}
+	}
+
+	if err := setMachinePhase(newMachine.Name, clusterapi.MachinePhaseReady); err != nil {
+		return fmt.Errorf("unable to record machine phase: %v", err)
+	}
+	log.Println("Machine created successfully.")
+	return nil
+}
+
+// rollbackMachine removes a machine that failed to be created from the
+// cluster and the state. If the actuator is given, the node of the machine is
+// deleted, and the machine is reset. Errors are logged, and do not stop the
+// rollback, because the machine has already failed.
+func rollbackMachine(machineName, provisionedMachineName string, actuator provider.Actuator) {
+	log.Printf("Rolling back machine %q. To keep a machine that fails to be created, use --keep-on-failure.", machineName)
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("Unable to roll back machine %q: unable to get cluster: %v", machineName, err)
+		return
+	}
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(machineName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("Unable to get machine %q: %v", machineName, err)
+	}
+	if machine != nil && err == nil {
+		if actuator != nil && isEtcdMachine(machine) {
+			log.Println("Resetting machine")
+			if err := deleteEtcdMachine(cluster, machine); err != nil {
+				log.Errorf("Unable to reset machine %q: %v. Run '%s reset' on the machine before creating it again.", machineName, err, common.EtcdadmFile)
+			}
+		} else if actuator != nil {
+			if pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(provisionedMachineName, metav1.GetOptions{}); err == nil {
+				if err := drainAndDeleteNodeForMachine(machine, pm); err != nil {
+					log.Warnf("Unable to delete the node of machine %q: %v", machineName, err)
+				}
+			}
+			log.Println("Resetting machine")
+			if err := actuator.Delete(cluster, machine); err != nil {
+				log.Errorf("Unable to reset machine %q: %v. Run '%s reset' on the machine before creating it again.", machineName, err, machineActuator.NodeadmPath)
+			}
+		}
+		if machineStatus, err := providerCodec.GetMachineStatus(*machine); err == nil && machineStatus.EtcdMember != nil {
+			if err := removeClusterEtcdMember(*machineStatus.EtcdMember, cluster); err != nil {
+				log.Errorf("Unable to delete etcd member from cluster status: %v", err)
+			}
+		}
+		if err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Delete(machineName, &metav1.DeleteOptions{}); err != nil {
+			log.Errorf("Unable to delete machine %q: %v", machineName, err)
+		}
+		if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) && clusterapi.CreateStepCompleted(machine, clusterapi.CreateStepControlPlaneHook) {
+			if err := syncControlPlaneEndpoints(cluster, apiendpoint.ActionRemoved, machineName); err != nil {
+				log.Errorf("Unable to update the control plane endpoints: %v. Run update cluster --sync-control-plane-endpoints to retry.", err)
+			}
+		}
+		if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+			if err := syncDNSRecord(false); err != nil {
+				log.Errorf("Unable to register the DNS name of the API endpoint: %v. Run update cluster --sync-dns-record to retry.", err)
+			}
+		}
+	}
+	if err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Delete(provisionedMachineName, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("Unable to delete provisioned machine %q: %v", provisionedMachineName, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		log.Errorf("Unable to sync on-disk state: %v", err)
+		return
+	}
+	log.Printf("Rolled back machine %q", machineName)
+}
+
+// machineCmdCreate represents the machine create command
+var machineCmdCreate = &cobra.Command{
+	Use:   "machine",
+	Short: "Adds a machine to the cluster",
+	Long: `Adds a machine to the cluster.
+
+Before the machine is provisioned, preflight checks verify that the ports
+Kubernetes uses are free, swap is off, the OS and kernel are supported, the
+docker and kubelet cgroup drivers match, there is enough disk space, the clock
+is synchronized, and the machine can connect to the API server. If any check
+fails, the machine is not created, and every failure is reported. Failures of
+the checks named in --ignore-preflight-errors are reported as warnings.
+
+With --check-capacity, a master or node is not created if the pod CIDR has no
+node range left for it, since its pods would fail to get addresses. The node
+CIDR mask size is read from the node-cidr-mask-size argument of the controller
+manager, or its default. A warning is logged if fewer than a tenth of the
+ranges are left, or if the kubelet maxPods is more than the pod addresses of a
+range.
+
+Before the machine is provisioned, the nodeadm and etcdadm binaries it needs
+are looked for on the machine, and in the cache from which they are installed.
+Binaries found in neither are uploaded to the cache from --artifact-dir, a
+directory laid out as by bundle download, whose manifest, if any, is used to
+verify them. Without --artifact-dir, the machine is not provisioned.
+
+If the machine fails to be created after it is added to the state, it is
+rolled back: its node is deleted, it is reset, and it is removed from the
+state. Use --keep-on-failure to keep it, with phase Failed, to troubleshoot it.
+
+The node of the machine is registered with the taints given in --taints, in
+addition to the default taint of a master. The labels given in --labels are
+applied to the node after it joins the cluster. The fragment of a kubelet
+configuration in --kubelet-config is merged into the kubelet configuration on
+the machine, after it joins, and again after it is upgraded.
+
+Each step of creating the machine is recorded once it completes. If the
+machine already exists with phase Provisioning or Failed, e.g. because it was
+kept with --keep-on-failure, or cctl was interrupted, creating it again resumes
+from the first incomplete step, using the configuration of the existing
+machine; preflight checks are skipped. If the machine was already created,
+nothing is done.
+
+With --like, the machine is created like an existing one: it gets the role,
+VIP network interface, SSH port, SSH credential, and labels of the existing
+machine. --port and --iface, if given, override those of the existing machine.
+The SSH public keys identify the new machine, so they are not copied.
+
+If the cluster was created with --machine-defaults, the defaults of the role
+of the machine are used for the flags that are not given: --port, --iface,
+--taints, and --kubelet-config. With --like, --port and --iface are copied
+from the existing machine instead. The labels of the role are applied too;
+--labels adds to them, and replaces those with the same key.
+
+A machine with the etcd role runs only an etcd member, managed by etcdadm, and
+neither the kubelet nor the control plane, so it has no node, and cannot have
+labels, taints, or a kubelet configuration. The first etcd member of the
+cluster, on a master or an etcd machine, forms the etcd cluster, and every
+other member joins it. Etcd machines are deleted after masters, and their etcd
+quorum is checked before they are deleted or upgraded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		iface := cmd.Flag("iface").Value.String()
+		role := strings.Title(cmd.Flag("role").Value.String())
+		port, err := strconv.Atoi(cmd.Flag("port").Value.String())
+		if err != nil {
+			log.Fatalf("Invalid port %v", err)
+		}
+		publicKeyFiles, err := cmd.Flags().GetStringSlice("public-keys")
+		if err != nil {
+			log.Fatalf("Unable to parse `public-keys`: %v", err)
+		}
+		like := cmd.Flag("like").Value.String()
+		var template *machineTemplate
+		if len(like) != 0 {
+			if cmd.Flags().Changed("role") {
+				log.Fatalf("Must not give --role with --like; the role of machine %q is used.", like)
+			}
+			template, err = machineTemplateFrom(like)
+			if err != nil {
+				log.Fatalf("Unable to create machine like %q: %v", like, err)
+			}
+			role = string(template.role)
+			if !cmd.Flags().Changed("port") {
+				port = template.port
+			}
+			if !cmd.Flags().Changed("iface") {
+				iface = template.iface
+			}
+		}
+		roleDefaults, err := machineDefaultsForRole(clustercommon.MachineRole(role))
+		if err != nil {
+			log.Fatalf("Unable to get the machine defaults of role %q: %v", role, err)
+		}
+		if template == nil {
+			if !cmd.Flags().Changed("port") && roleDefaults.Port != 0 {
+				port = roleDefaults.Port
+			}
+			if !cmd.Flags().Changed("iface") && len(roleDefaults.Iface) != 0 {
+				iface = roleDefaults.Iface
+			}
+		}
+		labelPairs, err := cmd.Flags().GetStringSlice("labels")
+		if err != nil {
+			log.Fatalf("Unable to parse `labels`: %v", err)
+		}
+		labels, err := objectmeta.ParseLabels(labelPairs)
+		if err != nil {
+			log.Fatalf("Unable to parse `labels`: %v", err)
+		}
+		newNodeLabels = make(map[string]string, len(roleDefaults.Labels)+len(labels))
+		for k, v := range roleDefaults.Labels {
+			newNodeLabels[k] = v
+		}
+		for k, v := range labels {
+			newNodeLabels[k] = v
+		}
+		if cmd.Flags().Changed("taints") {
+			taintSpecs, err := cmd.Flags().GetStringSlice("taints")
+			if err != nil {
+				log.Fatalf("Unable to parse `taints`: %v", err)
+			}
+			if newNodeTaints, err = parseTaints(taintSpecs); err != nil {
+				log.Fatalf("Unable to parse `taints`: %v", err)
+			}
+		} else {
+			newNodeTaints = roleDefaults.Taints
+		}
+		if kubeletConfigFile := cmd.Flag("kubelet-config").Value.String(); len(kubeletConfigFile) != 0 {
+			if newKubeletConfig, err = kubeletConfigOverridesFromFile(kubeletConfigFile); err != nil {
+				log.Fatalf("Unable to parse `kubelet-config`: %v", err)
+			}
+		} else {
+			newKubeletConfig = roleDefaults.KubeletConfig
+		}
+		checkHardware, err := cmd.Flags().GetBool("check-hardware")
+		if err != nil {
+			log.Fatalf("Unable to parse `check-hardware`: %v", err)
+		}
+		// The hardware of a machine that already exists was checked when it
+		// was first created.
+		runsEtcd := clustercommon.MachineRole(role) == clustercommon.MasterRole || clustercommon.MachineRole(role) == clusterapi.EtcdRole
+		if runsEtcd && !machineExists(ip) {
+			if checkHardware {
+				mustPassHardwareCheck(ip, port, publicKeyFiles)
+			} else {
+				maxFsyncLatency, err := cmd.Flags().GetDuration("max-fsync-latency")
+				if err != nil {
+					log.Fatalf("Unable to parse `max-fsync-latency`: %v", err)
+				}
+				ignoreEtcdDiskLatency, err := cmd.Flags().GetBool("ignore-etcd-disk-latency")
+				if err != nil {
+					log.Fatalf("Unable to parse `ignore-etcd-disk-latency`: %v", err)
+				}
+				guardEtcdDiskLatency(ip, port, publicKeyFiles, maxFsyncLatency, ignoreEtcdDiskLatency)
+			}
+		}
+		checkCapacity, err := cmd.Flags().GetBool("check-capacity")
+		if err != nil {
+			log.Fatalf("Unable to parse `check-capacity`: %v", err)
+		}
+		hasNode := clustercommon.MachineRole(role) == clustercommon.MasterRole || clustercommon.MachineRole(role) == clustercommon.NodeRole
+		if checkCapacity && hasNode && !machineExists(ip) {
+			guardPodNetworkCapacity(ip)
+		}
+		startOperationReport(cmd, "create machine", []string{ip})
+		if template != nil {
+			err = createMachineLike(ip, template, port, iface, publicKeyFiles)
+		} else {
+			err = createMachine(ip, port, iface, role, publicKeyFiles)
+		}
+		if err != nil {
+			log.Fatalf("Unable to create machine %q: %v", ip, err)
+		}
+		finishOperationReport(nil)
+	},
+}
+
+func getGoalComponentVersions() *spv1.MachineComponentVersions {
+	return &spv1.MachineComponentVersions{
+		NodeadmVersion:    common.DefaultNodeadmVersion,
+		EtcdadmVersion:    common.DefaultEtcdadmVersion,
+		KubernetesVersion: common.DefaultKubernetesVersion,
+		CNIVersion:        common.DefaultCNIVersion,
+		KeepalivedVersion: common.DefaultKeepalivedVersion,
+		FlannelVersion:    common.DefaultFlannelVersion,
+		EtcdVersion:       common.DefaultEtcdVersion,
+	}
+}
+
+func newProvisionedMachineAndMachine(name string, role clustercommon.MachineRole, vipNetworkInterface string, sshConfig spv1.SSHConfig) (*spv1.ProvisionedMachine, *clusterv1.Machine, error) {
+	newProvisionedMachine := spv1.ProvisionedMachine{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ProvisionedMachine",
+			APIVersion: "sshprovider.platform9.com/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: spv1.ProvisionedMachineSpec{
+			SSHConfig:           &sshConfig,
+			VIPNetworkInterface: vipNetworkInterface,
+		},
+	}
+
+	newMachine := clusterv1.Machine{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Machine",
+			APIVersion: "cluster.k8s.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.Now(),
+		},
+		Spec: clusterv1.MachineSpec{
+			Roles: []clustercommon.MachineRole{role},
+		},
+		Status: clusterv1.MachineStatus{},
+	}
+
+	if role == clustercommon.MasterRole {
+		newMachine.Spec.Taints = []corev1.Taint{
+			{
+				Key:    common.LabelNodeRoleMaster,
+				Effect: corev1.TaintEffectPreferNoSchedule,
+			},
+		}
+	}
+
+	machineProviderSpec := spv1.MachineSpec{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "sshprovider.platform9.com/v1alpha1",
+			Kind:       "MachineSpec",
+		},
+		ProvisionedMachineName: newProvisionedMachine.Name,
+		Roles: []spv1.MachineRole{
+			spv1.MachineRole(role),
+		},
+		ComponentVersions: getGoalComponentVersions(),
+	}
+	if err := providerCodec.PutMachineSpec(machineProviderSpec, &newMachine); err != nil {
+		return nil, nil, fmt.Errorf("unable to encode machine provider spec: %v", err)
+	}
+
+	machineProviderStatus := spv1.MachineStatus{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "sshprovider.platform9.com/v1alpha1",
+			Kind:       "MachineStatus",
+		},
+	}
+	if err := providerCodec.PutMachineStatus(machineProviderStatus, &newMachine); err != nil {
+		return nil, nil, fmt.Errorf("unable to encode machine provider status: %v", err)
+	}
+
+	if err := providerCodec.BindMachineAndProvisionedMachine(&newMachine, &newProvisionedMachine); err != nil {
+		return nil, nil, fmt.Errorf("unable to create bi-directional bind between machine and provisioned machine: %v", err)
+	}
+	return &newProvisionedMachine, &newMachine, nil
+}
+
+func deleteMachine(ip string, force bool, skipDrainDelete bool) error {
+	targetMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return operror.New(operror.NotFound, "machine %q not found", ip)
+		}
+		return fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	targetMachineSpec, err := providerCodec.GetMachineSpec(*targetMachine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine %q spec: %v", targetMachine.Name, err)
+	}
+	targetProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(targetMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get provisioned machine %q: %v", targetMachineSpec.ProvisionedMachineName, err)
+	}
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+
+	if force {
+		log.Println("--force enabled: skipping node drain, node delete, and commands invoked on the machine")
+	} else {
+		if err := deleteMustNotOrphanNodes(*targetMachine); err != nil {
+			return err
+		}
+		if clusterapi.RunsEtcd(*targetMachine) {
+			if err := deleteMustNotLoseEtcdQuorum(targetMachine); err != nil {
+				return err
+			}
+		}
+		// Etcd machines have no node.
+		if !skipDrainDelete && !isEtcdMachine(targetMachine) {
+			if err := deleteMustNotLoseData(targetMachine, targetProvisionedMachine); err != nil {
+				return err
+			}
+			if err := drainAndDeleteNodeForMachine(targetMachine, targetProvisionedMachine); err != nil {
+				return fmt.Errorf("unable to drain and delete cluster node for machine %q: %v", targetMachine.Name, err)
+			}
+		}
+
+		var insecureIgnoreHostKey bool
+		if len(targetProvisionedMachine.Spec.SSHConfig.PublicKeys) == 0 {
+			insecureIgnoreHostKey = true
+			log.Printf("Not able to verify machine SSH identity: No public keys given. Continuing...")
+		}
+		machineClientBuilder, err := newMachineClientBuilder()
+		if err != nil {
+			return fmt.Errorf("unable to create machine client builder: %v", err)
+		}
+		actuator := newActuator(
+			state.KubeClient,
+			state.ClusterClient,
+			state.SPClient,
+			machineClientBuilder,
+			insecureIgnoreHostKey,
+			log.LogLevel(),
+		)
+		if err := setMachinePhase(targetMachine.Name, clusterapi.MachinePhaseDeleting); err != nil {
+			return fmt.Errorf("unable to record machine phase: %v", err)
+		}
+		log.Println("Deleting machine")
+		deleteFunc := actuator.Delete
+		if isEtcdMachine(targetMachine) {
+			deleteFunc = deleteEtcdMachine
+		}
+		if err = deleteFunc(cluster, targetMachine); err != nil {
+			if err := setMachinePhase(targetMachine.Name, clusterapi.MachinePhaseFailed); err != nil {
+				log.Errorf("Unable to record machine phase: %v", err)
+			}
+			return fmt.Errorf("unable to delete machine: %v", err)
+		}
+	}
+
+	log.Println("Updating cluster status")
+	machineStatus, err := providerCodec.GetMachineStatus(*targetMachine)
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q status: %v", targetMachine.Name, err)
+	}
+	if machineStatus.EtcdMember != nil {
+		if err := removeClusterEtcdMember(*machineStatus.EtcdMember, cluster); err != nil {
+			return fmt.Errorf("unable to delete etcd member from cluster status: %v", err)
+		}
+	}
+
+	if err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Delete(targetMachine.Name, &metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("unable to delete machine %q: %v", targetMachine.Name, err)
+	}
+	if err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Delete(targetProvisionedMachine.Name, &metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("unable to delete provisioned machine %q: %v", targetProvisionedMachine.Name, err)
+	}
+
+	if clusterutil.RoleContains(clustercommon.MasterRole, targetMachine.Spec.Roles) {
+		// Update cluster API endpoints
+		machines, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to list machines: %v", err)
+		}
+		masters := clusterapi.MachinesWithRole(machines.Items, clustercommon.MasterRole)
+		// It may not possible to identify the endpoint for the machine being
+		// deleted, e.g. if the machine is failed and `kubeadm config view`
+		// cannot be invoked. For now, assume there is only one endpoint, and
+		// delete it after the last master is deleted.
+		// See https://github.com/platform9/ssh-provider/issues/67
+		if len(masters) == 0 {
+			_, err = clusterapi.UpdateClusterStatus(state.ClusterClient, namespace, cluster.Name, func(c *clusterv1.Cluster) error {
+				c.Status.APIEndpoints = []clusterv1.APIEndpoint{}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("unable to update cluster state: %v", err)
+			}
+		}
+	}
+
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+
+	if clusterutil.RoleContains(clustercommon.MasterRole, targetMachine.Spec.Roles) {
+		if err := syncControlPlaneEndpoints(cluster, apiendpoint.ActionRemoved, targetMachine.Name); err != nil {
+			return fmt.Errorf("machine was deleted, but unable to update the control plane endpoints: %v. Run update cluster --sync-control-plane-endpoints to retry", err)
+		}
+		if err := syncDNSRecord(false); err != nil {
+			return fmt.Errorf("machine was deleted, but unable to register the DNS name of the API endpoint: %v. Run update cluster --sync-dns-record to retry", err)
+		}
+	}
+
+	log.Println("Machine deleted successfully.")
+	return nil
+}
+
+var machineCmdDelete = &cobra.Command{
+	Use:   "machine",
+	Short: "Deletes one or more machines from the cluster",
+	Long: `Deletes one or more machines from the cluster.
+
+Before the node of a machine is drained, the pods on it whose data would be
+lost are listed: pods with emptyDir volumes, which are deleted when the pods
+are evicted, and pods with local persistent volumes, whose data is left on the
+machine. If there are any, the machine is not deleted, unless
+--acknowledge-data-loss is given. Draining a node with emptyDir volumes also
+requires --drain-delete-local-data, which alone acknowledges the loss of
+emptyDir data, so that a node whose pods have no local persistent volumes is
+deleted with --drain-delete-local-data, and, if it runs pods not managed by a
+controller, --drain-force.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ips, err := cmd.Flags().GetStringSlice("ip")
+		if err != nil {
+			log.Fatalf("Unable to parse `ip` flag: %v", err)
+		}
+		machinesFile := cmd.Flag("file").Value.String()
+		role := cmd.Flag("role").Value.String()
+		selectors := 0
+		for _, changed := range []bool{len(ips) != 0, len(machinesFile) != 0, len(role) != 0} {
+			if changed {
+				selectors++
+			}
+		}
+		if selectors != 1 {
+			log.Fatalf("Must use exactly one of --ip, --file, or --role.")
+		}
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Fatalf("Unable to parse `force` flag: %v", err)
+		}
+		skipDrainDelete, err := cmd.Flags().GetBool("skip-drain-delete")
+		if err != nil {
+			log.Fatalf("Unable to parse `skip-drain-delete` flag: %v", err)
+		}
+		switch {
+		case len(machinesFile) != 0:
+			ips, err = machineIPsFromFile(machinesFile)
+			if err != nil {
+				log.Fatalf("Unable to read machines from %q: %v", machinesFile, err)
+			}
+		case len(role) != 0:
+			machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				log.Fatalf("Unable to list machines: %v", err)
+			}
+			for _, machine := range clusterapi.MachinesWithRole(machineList.Items, clustercommon.MachineRole(role)) {
+				ips = append(ips, machine.Name)
+			}
+		}
+		if len(ips) == 0 {
+			log.Fatalf("No machines to delete.")
+		}
+		startOperationReport(cmd, "delete machine", ips)
+		if len(ips) == 1 {
+			if err := deleteMachine(ips[0], force, skipDrainDelete); err != nil {
+				log.Fatalf("Unable to delete machine %q: %v", ips[0], err)
+			}
+			finishOperationReport(nil)
+			return
+		}
+		if err := deleteMachines(ips, force, skipDrainDelete); err != nil {
+			log.Fatalf("Unable to delete machines: %v", err)
+		}
+		finishOperationReport(nil)
+	},
+}
+
+// machineIPsFromFile reads a YAML list of machine IPs from the file.
+func machineIPsFromFile(file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var ips []string
+	if err := yaml.Unmarshal(data, &ips); err != nil {
+		return nil, fmt.Errorf("unable to parse list of machine IPs: %v", err)
+	}
+	return ips, nil
+}
+
+func deleteMustNotOrphanNodes(targetMachines ...clusterv1.Machine) error {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	if err := clusterapi.ValidateDeletion(machineList.Items, targetMachines); err != nil {
+		return operror.New(operror.Precondition, "not deleting machines: %v", err)
+	}
+	return nil
+}
+
+// deleteMustNotLoseEtcdQuorum verifies that the etcd cluster keeps quorum
+// after the etcd member on the target machine is removed. The health of the
+// cluster is checked from another member, so that a member whose machine is
+// down can be removed.
+func deleteMustNotLoseEtcdQuorum(targetMachine *clusterv1.Machine) error {
+	machineStatus, err := providerCodec.GetMachineStatus(*targetMachine)
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q status: %v", targetMachine.Name, err)
+	}
+	if machineStatus.EtcdMember == nil {
+		return nil
+	}
+	log.Println("Checking etcd cluster health")
+	health, ok, err := etcdEndpointHealthFromOtherMember(targetMachine)
+	if err != nil {
+		return fmt.Errorf("unable to check etcd cluster health: %v", err)
+	}
+	if !ok {
+		// The target is the last member.
+		return nil
+	}
+	if !health.SafeToRemoveMember(machineStatus.EtcdMember.ClientURLs) {
+		return operror.New(operror.Precondition, "not deleting machine %q: the etcd cluster would lose quorum. Healthy members: %v, unhealthy members: %v", targetMachine.Name, health.Healthy, health.Unhealthy)
+	}
+	return nil
+}
+
+// etcdEndpointHealthFromOtherMember returns the health of the etcd cluster,
+// as seen from the first reachable machine, other than the target, that runs
+// an etcd member, so that the health of a member whose machine is down is
+// reported too. It returns false if no other machine runs an etcd member.
+func etcdEndpointHealthFromOtherMember(targetMachine *clusterv1.Machine) (etcdutil.EndpointHealth, bool, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return etcdutil.EndpointHealth{}, false, fmt.Errorf("unable to list machines: %v", err)
+	}
+	var errs []string
+	for i := range machineList.Items {
+		m := &machineList.Items[i]
+		if m.Name == targetMachine.Name {
+			continue
+		}
+		machineStatus, err := providerCodec.GetMachineStatus(*m)
+		if err != nil {
+			return etcdutil.EndpointHealth{}, false, fmt.Errorf("unable to get machine %q status: %v", m.Name, err)
+		}
+		if machineStatus.EtcdMember == nil {
+			continue
+		}
+		client, err := machineClientForMachine(m)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("machine %q: %v", m.Name, err))
+			continue
+		}
+		health, err := etcdEndpointHealth(client)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("machine %q: %v", m.Name, err))
+			continue
+		}
+		return health, true, nil
+	}
+	if len(errs) != 0 {
+		return etcdutil.EndpointHealth{}, false, fmt.Errorf("no other etcd member is reachable: %s", strings.Join(errs, "; "))
+	}
+	return etcdutil.EndpointHealth{}, false, nil
+}
+
+// deleteMustNotLoseData lists the pods on the node of the target machine
+// whose emptyDir or local persistent volume data is lost when the node is
+// drained and deleted, and refuses to delete the machine if there are any,
+// unless acknowledgeDataLoss is set, or, if only emptyDir data is lost,
+// drainDeleteLocalData is set.
+func deleteMustNotLoseData(targetMachine *clusterv1.Machine, targetProvisionedMachine *spv1.ProvisionedMachine) error {
+	machineClient, err := sshMachineClientFromSSHConfig(targetProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", targetMachine.Name, err)
+	}
+	nodeName, err := nodeNameForMachine(targetMachine.Name, machineClient)
+	if err != nil {
+		return fmt.Errorf("unable to get node name: %v", err)
+	}
+	if len(nodeName) == 0 {
+		return nil
+	}
+	log.Printf("Checking the data of the pods on cluster node %q", nodeName)
+	podsCmd := fmt.Sprintf("%s --kubeconfig=%s get pods --all-namespaces --field-selector spec.nodeName=%s -ojson", common.KubectlFile, common.AdminKubeconfig, nodeName)
+	pods, stdErr, err := machineClient.RunCommand(podsCmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stderr: %q)", podsCmd, err, string(stdErr))
+	}
+	pvsCmd := fmt.Sprintf("%s --kubeconfig=%s get pv -ojson", common.KubectlFile, common.AdminKubeconfig)
+	pvs, stdErr, err := machineClient.RunCommand(pvsCmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stderr: %q)", pvsCmd, err, string(stdErr))
+	}
+	impacts, err := dataloss.Assess(pods, pvs)
+	if err != nil {
+		return fmt.Errorf("unable to find the data on node %q: %v", nodeName, err)
+	}
+	if len(impacts) == 0 {
+		return nil
+	}
+	log.Warnf("Deleting machine %q loses the data of %d pods on its node %q:", targetMachine.Name, len(impacts), nodeName)
+	var localVolumes bool
+	for _, impact := range impacts {
+		if len(impact.EmptyDirs) != 0 {
+			log.Warnf("  %s: emptyDir volumes %s are deleted", impact.Pod, strings.Join(impact.EmptyDirs, ", "))
+		}
+		if len(impact.LocalVolumes) != 0 {
+			log.Warnf("  %s: local persistent volumes %s are left on the machine, and the pod cannot be scheduled to another node", impact.Pod, strings.Join(impact.LocalVolumes, ", "))
+			localVolumes = true
+		}
+	}
+	switch {
+	case acknowledgeDataLoss:
+		log.Warnf("--acknowledge-data-loss enabled: deleting machine %q", targetMachine.Name)
+	case drainDeleteLocalData && !localVolumes:
+		log.Warnf("--drain-delete-local-data enabled: deleting machine %q", targetMachine.Name)
+	case drainDeleteLocalData:
+		return operror.New(operror.Precondition, "not deleting machine %q: pods on its node have local persistent volumes, which --drain-delete-local-data does not delete. Back up or migrate the data, then use --acknowledge-data-loss", targetMachine.Name)
+	default:
+		return operror.New(operror.Precondition, "not deleting machine %q: the data of %d pods on its node would be lost. Back up or migrate the data, then use --acknowledge-data-loss, or, if only emptyDir data is lost, --drain-delete-local-data", targetMachine.Name, len(impacts))
+	}
+	return nil
+}
+
+// deleteMachines deletes the machines, one at a time, in an order that keeps
+// the cluster available: nodes first, then masters, then etcd machines, whose
+// members the masters may use. Unless force is true, the etcd quorum is
+// checked before each master or etcd machine is deleted. Deletion stops at the
+// first failure, and a summary is logged.
+func deleteMachines(ips []string, force bool, skipDrainDelete bool) error {
+	var targetMachines []clusterv1.Machine
+	for _, ip := range ips {
+		targetMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return operror.New(operror.NotFound, "machine %q not found", ip)
+			}
+			return fmt.Errorf("unable to get machine %q: %v", ip, err)
+		}
+		targetMachines = append(targetMachines, *targetMachine)
+	}
+	if !force {
+		if err := deleteMustNotOrphanNodes(targetMachines...); err != nil {
+			return err
+		}
+	}
+	ordered := clusterapi.OrderForDeletion(targetMachines)
+	var deleted []string
+	var failErr error
+	attempted := 0
+	for i, targetMachine := range ordered {
+		// No machine is deleted once cctl is interrupted.
+		if err := commandContext.Err(); err != nil {
+			failErr = fmt.Errorf("machine %q not deleted: %v", targetMachine.Name, err)
+			break
+		}
+		attempted++
+		log.Printf("[%d/%d] Deleting machine %q", i+1, len(ordered), targetMachine.Name)
+		if err := deleteMachine(targetMachine.Name, force, skipDrainDelete); err != nil {
+			// Keep the kind of the error, so that callers can tell why
+			// deletion stopped.
+			failErr = operror.Wrap(operror.KindOf(err), fmt.Errorf("machine %q: %v", targetMachine.Name, err))
+			break
+		}
+		deleted = append(deleted, targetMachine.Name)
+	}
+	log.Printf("Deleted %d of %d machines: %v", len(deleted), len(ordered), deleted)
+	if failErr != nil {
+		var notAttempted []string
+		for _, targetMachine := range ordered[attempted:] {
+			notAttempted = append(notAttempted, targetMachine.Name)
+		}
+		if len(notAttempted) != 0 {
+			log.Printf("Not attempted: %v", notAttempted)
+		}
+		return failErr
+	}
+	return nil
+}
+
+func bootstrapTokenSecretFromMachine(machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine) (*corev1.Secret, error) {
+	_, joinCommand, err := joinCommandFromMachine(machine, provisionedMachine, "")
+	if err != nil {
+		return nil, err
+	}
+	secret := corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              common.DefaultBootstrapTokenSecretName,
+			Namespace:         namespace,
+			CreationTimestamp: metav1.Now(),
+		},
+		Data: map[string][]byte{
+			"token":  []byte(joinCommand.Token),
+			"cahash": []byte(joinCommand.CACertHashes[0]),
+		},
+	}
+	return &secret, nil
+}
+
+// joinCommandFromMachine creates a bootstrap token on the master, and returns
+// the kubeadm join command that uses it, as printed, and as parsed for the
+// kubeadm version of the master. If ttl is not empty, it is the lifetime of
+// the token; otherwise, the kubeadm default is used.
+func joinCommandFromMachine(machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine, ttl string) (string, cliparse.JoinCommand, error) {
+	machineClient, err := sshMachineClientFromSSHConfig(provisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return "", cliparse.JoinCommand{}, fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	cmd := fmt.Sprintf("%s token create --print-join-command", common.KubeadmFile)
+	if len(ttl) != 0 {
+		cmd = fmt.Sprintf("%s --ttl %s", cmd, ttl)
+	}
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return "", cliparse.JoinCommand{}, fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+	}
+	printed := strings.TrimSpace(string(stdOut))
+	joinCommand, err := cliparse.ParseJoinCommand(printed, remoteVersion(machineClient, kubeadmVersionCmd()))
+	if err != nil {
+		return "", cliparse.JoinCommand{}, fmt.Errorf("unable to parse join command %q: %v", printed, err)
+	}
+	return printed, joinCommand, nil
+}
+
+func masterMachineAndProvisionedMachine() (*clusterv1.Machine, *spv1.ProvisionedMachine, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	var masterMachine *clusterv1.Machine
+	for _, machine := range machineList.Items {
+		if clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+			// Choose first master in the list
+			masterMachine = machine.DeepCopy()
+			break
+		}
+	}
+	if masterMachine == nil {
+		return nil, nil, fmt.Errorf("unable to find any machine with Master role, cannot obtain bootstrap token")
+	}
+	masterMachineSpec, err := providerCodec.GetMachineSpec(*masterMachine)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	masterProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(masterMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get provisioned machine: %v", err)
+	}
+	return masterMachine, masterProvisionedMachine.DeepCopy(), nil
+}
+
+// controlPlaneEndpointFromMachine returns the advertised API address and port
+// of the API server on the machine
+func controlPlaneEndpointFromMachine(machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine) (*clusterv1.APIEndpoint, error) {
+	machineClient, err := sshMachineClientFromSSHConfig(provisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+
+	cmd := fmt.Sprintf("%s config view", common.KubeadmFile)
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		log.Println(stdOut)
+		log.Println(stdErr)
+		return nil, fmt.Errorf("unable to run %q on %q: %v", cmd, machine.Name, err)
+	}
+	kcc := kubeadmutil.ClusterConfiguration{}
+	err = yaml.Unmarshal(stdOut, &kcc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read kubeadm ClusterConfiguration from machine %q:%v", machine.Name, err)
+	}
+	return kubeadmutil.APIEndpointFromClusterConfiguration(&kcc)
+}
+
+// apiEndpointFromMachine returns the advertised API address and port of the API
+// server on the machine
+func apiEndpointFromMachine(machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine) (*clusterv1.APIEndpoint, error) {
+	machineClient, err := sshMachineClientFromSSHConfig(provisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	cmd := `grep -oP -- '--advertise-address=\K([0-9]{0,3}\.[0-9]{0,3}\.[0-9]{0,3}\.[0-9]{0,3})' /etc/kubernetes/manifests/kube-apiserver.yaml`
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		log.Println(stdOut)
+		log.Println(stdErr)
+		return nil, fmt.Errorf("unable to run %q on %q: %v", cmd, machine.Name, err)
+	}
+	apiAddr := net.ParseIP(strings.TrimSpace(string(stdOut)))
+	if apiAddr == nil {
+		return nil, fmt.Errorf("unable to parse advertised API address from %q", string(stdOut))
+	}
+
+	cmd = `grep -oP -- '--secure-port=\K([0-9]{1,5})' /etc/kubernetes/manifests/kube-apiserver.yaml`
+	stdOut, stdErr, err = machineClient.RunCommand(cmd)
+	if err != nil {
+		log.Println(stdOut)
+		log.Println(stdErr)
+		return nil, fmt.Errorf("unable to run %q on %q: %v", cmd, machine.Name, err)
+	}
+	apiPort, err := strconv.Atoi(strings.TrimSpace(string(stdOut)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse API secure port from %q", string(stdOut))
+	}
+
+	return &clusterv1.APIEndpoint{
+		Host: apiAddr.String(),
+		Port: apiPort,
+	}, nil
+}
+
+func adminKubeconfigFromMachine(machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine) ([]byte, error) {
+	machineClient, err := sshMachineClientFromSSHConfig(provisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	// chmod file for read access for all users
+	stdOut, stdErr, err := machineClient.RunCommand(fmt.Sprintf("chmod 0644 %s", common.AdminKubeconfig))
+	if err != nil {
+		log.Println(stdOut)
+		log.Println(stdErr)
+		return nil, fmt.Errorf("unable to change kubeconfig file permissions on %q: %v", machine.Name, err)
+	}
+	fileContents, err := machineClient.ReadFile(common.AdminKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read kubeconfig from machine %q:%v", machine.Name, err)
+	}
+	// chmod file to keep it secure
+	stdOut, stdErr, err = machineClient.RunCommand(fmt.Sprintf("chmod 0600 %s", common.AdminKubeconfig))
+	if err != nil {
+		log.Println(stdOut)
+		log.Println(stdErr)
+		return nil, fmt.Errorf("unable to change kubeconfig file permissions on %q: %v", machine.Name, err)
+	}
+	return fileContents, nil
+}
+
+func writeAdminKubeconfigToMachine(kubeconfig []byte, machine *clusterv1.Machine, provisionedMachine *spv1.ProvisionedMachine) error {
+	machineClient, err := sshMachineClientFromSSHConfig(provisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	// write kubeconfig to /tmp first and then move to /etc
+	if err := machineClient.WriteFile("/tmp/admin.conf", 0600, kubeconfig); err != nil {
+		return fmt.Errorf("unable to write kubeconfig to machine %q: %v", machine.Name, err)
+	}
+	// move kubeconfig from /tmp to /etc/kubernetes
+	return machineClient.MoveFile("/tmp/admin.conf", common.AdminKubeconfig)
+}
+
+func drainAndDeleteNodeForMachine(targetMachine *clusterv1.Machine, targetProvisionedMachine *spv1.ProvisionedMachine) error {
+	var err error
+	targetMachineClient, err := sshMachineClientFromSSHConfig(targetProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", targetMachine.Name, err)
+	}
+	nodeName, err := nodeNameForMachine(targetMachine.Name, targetMachineClient)
+	if err != nil {
+		return fmt.Errorf("unable to get node name: %v", err)
+	}
+	if len(nodeName) != 0 {
+		log.Printf("Draining cluster node %q for machine %q", nodeName, targetMachine.Name)
+		if err := drainNode(nodeName, targetMachineClient); err != nil {
+			return fmt.Errorf("unable to drain node: %v", err)
+		}
+		log.Printf("Deleting cluster node %q for machine %q", nodeName, targetMachine.Name)
+		return deleteNode(nodeName, targetMachineClient)
+
+	}
+	return nil
+}
+
+// machineClientForMachine returns a client for the provisioned machine bound
+// to the machine.
+func machineClientForMachine(machine *clusterv1.Machine) (sshmachine.Client, error) {
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	return sshMachineClientFromSSHConfig(pm.Spec.SSHConfig)
+}
+
+func sshMachineClientFromSSHConfig(sshConfig *spv1.SSHConfig) (sshmachine.Client, error) {
+	sshCredentialSecret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(sshConfig.CredentialSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to find SSH credential %q", sshConfig.CredentialSecret.Name)
+		}
+		return nil, fmt.Errorf("unable to get SSH credential secret: %v", err)
+	}
+	username, privateKey, err := providerCodec.UsernameAndKeyFromSecret(sshCredentialSecret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH credential from secret: %v", err)
+	}
+	var insecureIgnoreHostKey bool
+	if len(sshConfig.PublicKeys) == 0 {
+		insecureIgnoreHostKey = true
+		log.Printf("Not able to verify machine SSH identity: No public keys given. Continuing...")
+	}
+	machineClientBuilder, err := newMachineClientBuilder()
+	if err != nil {
+		return nil, err
+	}
+	return machineClientBuilder(sshConfig.Host, sshConfig.Port, username, privateKey, sshConfig.PublicKeys, insecureIgnoreHostKey)
+}
+
+// newMachineClientBuilder returns the builder used to create machine clients.
+// If the cluster has a bastion, the clients connect through it. Private keys
+// protected by a passphrase are decrypted before they are used. If an
+// operation report was started, the commands the clients run are recorded.
+// Reads go through the remoteReadCache. Invocations of the boundedPrograms
+// are stopped after --remote-timeout. At --v=2, remote operations are logged.
+func newMachineClientBuilder() (sshutil.ClientBuilder, error) {
+	builder, err := newUnencryptedMachineClientBuilder()
+	if err != nil {
+		return nil, err
+	}
+	builder = sshutil.NewRetryClientBuilder(profileSSHConnections(countSSHFailures(bindCommandContext(builder))), sshutil.RetryOptions{
+		Retries:  sshRetries,
+		Interval: sshRetryInterval,
+		Context:  commandContext,
+	})
+	return func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		// The builder is given the private keys of machine credentials.
+		privateKey, err := decryptSSHPrivateKey(privateKey, common.DefaultSSHCredentialSecretName)
+		if err != nil {
+			return nil, err
+		}
+		client, err := builder(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+		if err != nil {
+			return nil, err
+		}
+		if client, err = withCommandAllowlist(client); err != nil {
+			return nil, err
+		}
+		client = sshutil.NewTimeoutClient(client, sshutil.TimeoutOptions{
+			Timeout:    remoteTimeout,
+			Programs:   boundedPrograms,
+			SaveOutput: saveTimeoutBundle(host),
+		})
+		if log.V(2) {
+			client = sshutil.NewLoggingClient(host, client)
+		}
+		client = &hintingClient{Client: client}
+		if operationReport != nil {
+			client = &recordingClient{Client: client, host: host, report: operationReport}
+		}
+		return trackMachineClient(readCache().Wrap(host, client)), nil
+	}, nil
+}
+
+// machineClients are the machine clients created since they were last
+// closed.
+var machineClients struct {
+	sync.Mutex
+	clients []sshmachine.Client
+}
+
+func trackMachineClient(client sshmachine.Client) sshmachine.Client {
+	machineClients.Lock()
+	defer machineClients.Unlock()
+	machineClients.clients = append(machineClients.clients, client)
+	return client
+}
+
+// closeMachineClients closes the machine clients created since it was last
+// called. Library operations and serve jobs call it when they end, because
+// the process outlives them.
+func closeMachineClients() {
+	machineClients.Lock()
+	clients := machineClients.clients
+	machineClients.clients = nil
+	machineClients.Unlock()
+	for _, client := range clients {
+		if err := sshutil.Close(client); err != nil {
+			log.Debugf("Unable to close machine client: %v", err)
+		}
+	}
+}
+
+// boundedPrograms are the programs whose invocations on machines are limited
+// by --remote-timeout. They can hang, e.g. waiting for an unreachable etcd
+// member, without any output.
+var boundedPrograms = []string{"kubeadm", "etcdadm", "nodeadm", "kubectl", "etcdctl.sh"}
+
+// saveTimeoutBundle returns a function that saves the partial output of a
+// command that timed out on the host to an archive in the current directory.
+func saveTimeoutBundle(host string) func(*sshutil.TimeoutError) (string, error) {
+	return func(timeoutErr *sshutil.TimeoutError) (string, error) {
+		name := fmt.Sprintf("%s-%s-%s.tar.gz", common.TimeoutBundleFileNamePrefix, host, time.Now().Format(time.RFC3339))
+		f, err := os.Create(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		w := archive.NewWriter(f)
+		files := []struct {
+			name string
+			data []byte
+		}{
+			{"command.txt", []byte(fmt.Sprintf("%s\n", timeoutErr.Command))},
+			{"timeout.txt", []byte(fmt.Sprintf("%v\n", timeoutErr.Timeout))},
+			{"stdout.txt", timeoutErr.StdOut},
+			{"stderr.txt", timeoutErr.StdErr},
+		}
+		for _, file := range files {
+			if err := w.WriteFile(file.name, file.data); err != nil {
+				return "", err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+}
+
+// remoteReadCache caches, for the rest of the invocation, the files read from
+// machines, the output of etcdadm info, and the versions of programs. Several steps of an operation read
+// the same files, e.g. admin.conf, and on a slow link every read is costly.
+// Writes through a machine client, and commands not known to be read-only,
+// invalidate the cache of the machine. It is created on first use, once the
+// remote paths of the cluster are known.
+var remoteReadCache *sshutil.ReadCache
+
+func readCache() *sshutil.ReadCache {
+	if remoteReadCache == nil {
+		remoteReadCache = sshutil.NewReadCache(
+			[]string{fmt.Sprintf("%s info", common.EtcdadmFile), kubeadmVersionCmd(), etcdadmVersionCmd(), kubectlVersionCmd()},
+			[]string{common.KubectlFile + " ", "test -e ", "docker ps ", "systemctl is-active "},
+		)
+	}
+	return remoteReadCache
+}
+
+// directClientBuilder creates clients that connect directly to the machine.
+// Credentials without a private key authenticate using the ssh-agent. The
+// clients, unlike those of the vendored machine package, can stop their
+// commands when a context is done.
+func directClientBuilder(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+	return sshutil.NewClient(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+}
+
+func newUnencryptedMachineClientBuilder() (sshutil.ClientBuilder, error) {
+	bastion, err := clusterBastion()
+	if err != nil {
+		return nil, err
+	}
+	if bastion == nil {
+		return directClientBuilder, nil
+	}
+	return sshutil.NewBastionClientBuilder(*bastion), nil
+}
+
+// clusterBastion returns the bastion of the cluster, with its private key
+// decrypted, or nil if the cluster has no bastion.
+func clusterBastion() (*sshutil.Bastion, error) {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to get cluster: %v", err)
+	}
+	bastionAddr, ok := cluster.Annotations[common.BastionAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	host, port, err := sshutil.ParseHostPort(bastionAddr, common.DefaultSSHPort)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse bastion address %q: %v", bastionAddr, err)
+	}
+	bastionCredentialSecret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultBastionSSHCredentialSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to find bastion SSH credential %q", common.DefaultBastionSSHCredentialSecretName)
+		}
+		return nil, fmt.Errorf("unable to get bastion SSH credential secret: %v", err)
+	}
+	username, privateKey, err := providerCodec.UsernameAndKeyFromSecret(bastionCredentialSecret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bastion SSH credential from secret: %v", err)
+	}
+	privateKey, err = decryptSSHPrivateKey(privateKey, common.DefaultBastionSSHCredentialSecretName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bastion SSH credential: %v", err)
+	}
+	var publicKeys []string
+	if keys := cluster.Annotations[common.BastionPublicKeysAnnotationKey]; len(keys) != 0 {
+		publicKeys = strings.Split(strings.TrimSpace(keys), "\n")
+	}
+	var insecureIgnoreHostKey bool
+	if len(publicKeys) == 0 {
+		insecureIgnoreHostKey = true
+		log.Printf("Not able to verify bastion SSH identity: No public keys given. Continuing...")
+	}
+	return &sshutil.Bastion{
+		Host:                  host,
+		Port:                  port,
+		Username:              username,
+		PrivateKey:            privateKey,
+		PublicKeys:            publicKeys,
+		InsecureIgnoreHostKey: insecureIgnoreHostKey,
+	}, nil
+}
+
+var machineCmdGet = &cobra.Command{
+	Use:   "machine",
+	Short: "Get machine resources",
+	Long: `Get machine resources from the state. Machines are not contacted; the
+phase, last contact, and unreachable since are as of the last 'cctl status' or
+'cctl status machine'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		var machineList *clusterv1.MachineList
+		if len(ip) == 0 {
+			var err error
+			machineList, err = state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				log.Fatalf("Unable to list machines: %v", err)
+			}
+		} else {
+			machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+			if err != nil {
+				log.Fatalf("Unable to get machine %q: %v", ip, err)
+			}
+			machineList = &clusterv1.MachineList{
+				Items: []clusterv1.Machine{*machine},
+			}
+		}
+		if ok, err := printTemplateOutput(machineList); ok {
+			if err != nil {
+				log.Fatalf("Unable to print machines: %v", err)
+			}
+			return
+		}
+		switch outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(machineList.Items)
+			if err != nil {
+				log.Fatalf("Unable to marshal cluster spec file to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(machineList.Items)
+			if err != nil {
+				log.Fatalf("Unable to marshal cluster spec file to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("MachineV1PrintTemplate").Parse(common.MachineV1PrintTemplate))
+			if err := t.Execute(os.Stdout, machineList.Items); err != nil {
+				log.Fatalf("Could not pretty print cluster details: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+	},
+}
+
+// machineReachability describes the result of contacting a machine over SSH.
+type machineReachability struct {
+	Name             string
+	Reachable        bool
+	LastContact      string
+	UnreachableSince string
+}
+
+// setMachinePhase records the phase of the machine in the on-disk state.
+func setMachinePhase(name string, phase clusterapi.MachinePhase) error {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q: %v", name, err)
+	}
+	clusterapi.SetPhase(machine, phase)
+	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine); err != nil {
+		return fmt.Errorf("unable to update machine %q: %v", name, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+
+// recordCreateStep records that the create step was completed for the machine,
+// and syncs the on-disk state, so that creating the machine again skips it.
+func recordCreateStep(name string, step clusterapi.CreateStep) error {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q: %v", name, err)
+	}
+	clusterapi.SetCreateStepCompleted(machine, step)
+	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine); err != nil {
+		return fmt.Errorf("unable to record step %s of machine %q: %v", step, name, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+
+// probeMachine connects to the machine over SSH and records the result in the
+// machine's annotations. The caller is responsible for persisting the machine.
+func probeMachine(machine *clusterv1.Machine) (machineReachability, error) {
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return machineReachability{}, fmt.Errorf("unable to decode machine %q spec: %v", machine.Name, err)
+	}
+	provisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return machineReachability{}, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	machineClient, err := sshMachineClientFromSSHConfig(provisionedMachine.Spec.SSHConfig)
+	if err == nil {
+		_, _, err = machineClient.RunCommand("true")
+	}
+	if err != nil {
+		log.Debugf("Machine %q is unreachable: %v", machine.Name, err)
+	}
+	return recordReachability(machine, err == nil), nil
+}
+
+// recordReachability records in the machine's annotations whether the machine
+// was reachable, and returns the reachability to report.
+func recordReachability(machine *clusterv1.Machine, reachable bool) machineReachability {
+	clusterapi.RecordProbe(machine, reachable, time.Now())
+	r := machineReachability{
+		Name:      machine.Name,
+		Reachable: reachable,
+	}
+	if t := clusterapi.LastContact(machine); t != nil {
+		r.LastContact = t.Format(time.RFC3339)
+	}
+	if t := clusterapi.UnreachableSince(machine); t != nil {
+		r.UnreachableSince = t.Format(time.RFC3339)
+	}
+	return r
+}
+
+var machineCmdStatus = &cobra.Command{
+	Use:   "machine",
+	Short: "Check that machines are reachable over SSH",
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		var machines []clusterv1.Machine
+		if len(ip) == 0 {
+			machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				log.Fatalf("Unable to list machines: %v", err)
+			}
+			machines = machineList.Items
+		} else {
+			machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+			if err != nil {
+				log.Fatalf("Unable to get machine %q: %v", ip, err)
+			}
+			machines = []clusterv1.Machine{*machine}
+		}
+		results := make([]machineReachability, 0, len(machines))
+		for i := range machines {
+			machine := &machines[i]
+			r, err := probeMachine(machine)
+			if err != nil {
+				log.Fatalf("Unable to check machine %q: %v", machine.Name, err)
+			}
+			results = append(results, r)
+			if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine); err != nil {
+				log.Fatalf("Unable to update machine %q: %v", machine.Name, err)
+			}
+		}
+		// In read-only mode, the reachability is reported, but not recorded.
+		if err := state.PullFromAPIs(); err != nil && err != cctlstate.ErrReadOnly {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		t := template.Must(template.New("MachineReachabilityPrintTemplate").Parse(common.MachineReachabilityPrintTemplate))
+		if err := t.Execute(os.Stdout, results); err != nil {
+			log.Fatalf("Could not pretty print machine reachability: %s", err)
+		}
+		if !showUsage {
+			return
+		}
+		usages := machineUsages(machines, results, topPodsCount)
+		t = template.Must(template.New("MachineUsagePrintTemplate").Parse(common.MachineUsagePrintTemplate))
+		if err := t.Execute(os.Stdout, usages); err != nil {
+			log.Fatalf("Could not pretty print machine usage: %s", err)
+		}
+	},
+}
+
+type UpgradeRequired struct {
+	NodeadmVersion    bool
+	EtcdadmVersion    bool
+	KubernetesVersion bool
+	CNIVersion        bool
+	FlannelVersion    bool
+	KeepalivedVersion bool
+	EtcdVersion       bool
+}
+
+func isUpgradeRequired(old *spv1.MachineComponentVersions, cur *spv1.MachineComponentVersions) (bool, UpgradeRequired) {
+	if cmp.Equal(old, cur) {
+		return false, UpgradeRequired{}
+	}
+
+	return true, UpgradeRequired{
+		old.NodeadmVersion != cur.NodeadmVersion,
+		old.EtcdadmVersion != cur.EtcdadmVersion,
+		old.KubernetesVersion != cur.KubernetesVersion,
+		old.CNIVersion != cur.CNIVersion,
+		old.FlannelVersion != cur.FlannelVersion,
+		old.KeepalivedVersion != cur.KeepalivedVersion,
+		old.EtcdVersion != cur.EtcdVersion,
+	}
+}
+
+type instanceStatus *clusterv1.Machine
+
+func getGoalMachine(currentMachine *clusterv1.Machine) (*clusterv1.Machine, error) {
+	currentMachineSpec, err := providerCodec.GetMachineSpec(*currentMachine)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode machine %q spec: %v", currentMachine.Name, err)
+	}
+	// Prepare goal machine object using current machine
+	goalMachine := currentMachine.DeepCopy()
+
+	// Actions required on upgrade
+	currentKubernetesVersion := semver.New(currentMachineSpec.ComponentVersions.KubernetesVersion)
+	// When upgrading from < 1.11
+	if currentKubernetesVersion.LessThan(*semver.New("1.11.0")) {
+		// Master machines need a workaround for https://github.com/kubernetes/kubeadm/issues/1358
+		if clusterutil.RoleContains(clustercommon.MasterRole, currentMachine.Spec.Roles) && len(currentMachine.Spec.Taints) == 0 {
+			goalMachine.Spec.Taints = []corev1.Taint{
+				{
+					Key:    common.LabelNodeRoleMaster,
+					Effect: corev1.TaintEffectPreferNoSchedule,
+				},
+			}
+		}
+	}
+
+	goalMachineSpec, err := providerCodec.GetMachineSpec(*goalMachine)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode machine %q spec: %v", goalMachine.Name, err)
+	}
+	goalMachineSpec.ComponentVersions = getGoalComponentVersions()
+	providerCodec.PutMachineSpec(*goalMachineSpec, goalMachine)
+	// Add current machine as goal machine's annotation
+	if currentMachine.ObjectMeta.Annotations == nil {
+		currentMachine.ObjectMeta.Annotations = make(map[string]string)
+	}
+	if _, err := providerCodec.PutMachineInstanceStatus(goalMachine, currentMachine); err != nil {
+		return nil, fmt.Errorf("Unable to set machine instance status %v", err)
+	}
+	return goalMachine, nil
+}
+
+func upgradeMachine(ip string) error {
+	log.Printf("Upgrading machine %s\n", ip)
+	// Get the current machine
+	currentMachine, err := state.ClusterClient.ClusterV1alpha1().
+		Machines(namespace).
+		Get(ip, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	currentMachineSpec, err := providerCodec.GetMachineSpec(*currentMachine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine %q spec: %v", currentMachine.Name, err)
+	}
+	currentProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().
+		ProvisionedMachines(namespace).
+		Get(currentMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+
+	// Check if upgrade is required
+	goalComponentVersions := getGoalComponentVersions()
+	upgradeRequired, upgrade := isUpgradeRequired(currentMachineSpec.ComponentVersions, goalComponentVersions)
+	if !upgradeRequired {
+		log.Println("Machine is up to date.")
+		return nil
+	}
+
+	// The phase is recorded before the machine changes, so that an
+	// interrupted upgrade is visible in the state.
+	if err := setMachinePhase(currentMachine.Name, clusterapi.MachinePhaseProvisioning); err != nil {
+		return err
+	}
+	clusterapi.SetPhase(currentMachine, clusterapi.MachinePhaseProvisioning)
+	if err := upgradeMachineComponents(currentMachine, currentMachineSpec, currentProvisionedMachine, goalComponentVersions, upgrade); err != nil {
+		if phaseErr := setMachinePhase(currentMachine.Name, clusterapi.MachinePhaseFailed); phaseErr != nil {
+			log.Warnf("Unable to record the failed upgrade of machine %q: %v", currentMachine.Name, phaseErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// upgradeMachineComponents upgrades the components of the machine to the goal
+// versions, and records the machine, with phase Ready, in the state.
+func upgradeMachineComponents(currentMachine *clusterv1.Machine, currentMachineSpec *spv1.MachineSpec, currentProvisionedMachine *spv1.ProvisionedMachine, goalComponentVersions *spv1.MachineComponentVersions, upgrade UpgradeRequired) error {
+	if isEtcdMachine(currentMachine) {
+		// Etcd machines run only etcd, so only an etcd version change
+		// replaces their etcd member.
+		if err := upgradeEtcdMachine(currentMachine, goalComponentVersions, upgrade); err != nil {
+			return fmt.Errorf("unable to upgrade etcd machine: %v", err)
+		}
+		log.Println("Machine upgraded successfully.")
+	} else if upgrade.KubernetesVersion || upgrade.CNIVersion || upgrade.FlannelVersion ||
+		upgrade.KeepalivedVersion ||
+		upgrade.EtcdVersion {
+
+		targetMachineClient, err := sshMachineClientFromSSHConfig(currentProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create machine client for machine %q: %v", currentMachine.Name, err)
+		}
+		// Prepare goal machine using current machine
+		goalMachine, err := getGoalMachine(currentMachine)
+		if err != nil {
+			return fmt.Errorf("unable to create goal machine object: %v", err)
+		}
+
+		// Drain current node
+		nodeName, err := nodeNameForMachine(currentMachine.Name, targetMachineClient)
+		if err != nil {
+			return fmt.Errorf("unable to get node name for machine %s: %v", currentMachine.Name, err)
+		}
+		if err := drainNode(nodeName, targetMachineClient); err != nil {
+			return fmt.Errorf("unable to drain the node %s: %v", nodeName, err)
+		}
+
+		// Instantiate actuator
+		machineClientBuilder, err := newMachineClientBuilder()
+		if err != nil {
+			return fmt.Errorf("unable to create machine client builder: %v", err)
+		}
+		insecureIgnoreHostKey := false
+		if len(currentProvisionedMachine.Spec.SSHConfig.PublicKeys) == 0 {
+			insecureIgnoreHostKey = true
+			log.Printf("Not able to verify machine SSH identity: No public keys given. Continuing...")
+		}
+		actuator := newActuator(
+			state.KubeClient,
+			state.ClusterClient,
+			state.SPClient,
+			machineClientBuilder,
+			insecureIgnoreHostKey,
+			log.LogLevel(),
+		)
+
+		// If goal machine is a node we would have to update the token
+		// as current token might have expired
+		var masterMachine *clusterv1.Machine
+		var masterProvisionedMachine *spv1.ProvisionedMachine
+		if clusterutil.RoleContains(clustercommon.NodeRole, goalMachine.Spec.Roles) {
+			var err error
+			masterMachine, masterProvisionedMachine, err = masterMachineAndProvisionedMachine()
+			if err != nil {
+				return fmt.Errorf("unable to get a master machine and provisioned machine: %v", err)
+			}
+			if err = updateBootstrapToken(masterMachine, masterProvisionedMachine); err != nil {
+				return fmt.Errorf("unable to update bootstrap token for node")
+			}
+		}
+
+		// Call actuator's update
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get cluster %s: %v", common.DefaultClusterName, err)
+		}
+		currentMachineStatus, err := providerCodec.GetMachineStatus(*currentMachine)
+		if err != nil {
+			return fmt.Errorf("unable to get machine status: %v", err)
+		}
+		// We are deleting etcd member prior to actual delete from actuator
+		// this is still valid as delete only needs memberid (available in machine status)
+		// if delete called in actuator update succeeds this would allow us to pass correct cluster state to create
+		// if delete called in actuator update fails this state would never get persisted
+		if clusterutil.RoleContains(clustercommon.MasterRole, goalMachine.Spec.Roles) {
+			if err := removeClusterEtcdMember(*currentMachineStatus.EtcdMember, cluster); err != nil {
+				return fmt.Errorf("unable to delete etcd member from cluster status")
+			}
+		}
+		if err := actuator.Update(cluster, goalMachine); err != nil {
+			return fmt.Errorf("unable to update the node %s: %v", nodeName, err)
+		}
+		goalMachineStatus, err := providerCodec.GetMachineStatus(*goalMachine)
+		if err != nil {
+			return fmt.Errorf("unable to get machine status: %v", err)
+		}
+		if clusterutil.RoleContains(clustercommon.MasterRole, goalMachine.Spec.Roles) {
+			if err := insertClusterEtcdMember(*goalMachineStatus.EtcdMember, cluster); err != nil {
+				return fmt.Errorf("unable to add etcd member from cluster status")
+			}
+		}
+
+		//Uncordon upgraded node
+		if clusterutil.RoleContains(clustercommon.NodeRole, goalMachine.Spec.Roles) {
+			if err := createAdminKubeConfigSecretIfNotPresent(); err != nil {
+				log.Fatalf("Unable to create admin kubeconfig secret: %v", err)
+			}
+			if err := copyAdminConfigFromSecret(masterMachine, masterProvisionedMachine, goalMachine, currentProvisionedMachine); err != nil {
+				return fmt.Errorf("unable to copy admin kubeconfig to node: %v", err)
+			}
+		}
+		// kubeadm rewrites the kubelet configuration during the upgrade.
+		if err := applyKubeletConfigOverrides(goalMachine, targetMachineClient); err != nil {
+			return fmt.Errorf("unable to apply kubelet configuration overrides: %v", err)
+		}
+		// kubeadm may reissue the API server certificate during the upgrade,
+		// without the extra alternative names.
+		if clusterutil.RoleContains(clustercommon.MasterRole, goalMachine.Spec.Roles) {
+			if err := ensureAPIServerCertSANs(cluster, goalMachine.Name, targetMachineClient); err != nil {
+				return fmt.Errorf("unable to add alternative names to the API server certificate: %v", err)
+			}
+			// kubeadm rewrites the API server manifest during the upgrade.
+			if err := ensureAuditConfig(cluster, goalMachine.Name, targetMachineClient); err != nil {
+				return fmt.Errorf("unable to configure audit logging: %v", err)
+			}
+			if err := ensureEncryptionConfig(goalMachine, targetMachineClient); err != nil {
+				return fmt.Errorf("unable to configure encryption of secrets: %v", err)
+			}
+		}
+		if err := uncordonNode(nodeName, targetMachineClient); err != nil {
+			return fmt.Errorf("unable to uncordon the node %s: %v", nodeName, err)
+		}
+
+		//Reset annotation to empty
+		goalMachine.ObjectMeta.Annotations[common.InstanceStatusAnnotationKey] = ""
+		clusterapi.SetPhase(goalMachine, clusterapi.MachinePhaseReady)
+
+		currentMachine = goalMachine.DeepCopy()
+		log.Println("Machine upgraded successfully.")
+	} else {
+		// A nodeadm/etcdadm version change does not require an actuator call, just a state file update
+		if upgrade.NodeadmVersion || upgrade.EtcdadmVersion {
+			currentMachineSpec.ComponentVersions.NodeadmVersion = goalComponentVersions.NodeadmVersion
+			currentMachineSpec.ComponentVersions.EtcdadmVersion = goalComponentVersions.EtcdadmVersion
+			log.Println("Nodeadm/Etcdadm only change, updating state file.")
+
+			if err := providerCodec.PutMachineSpec(*currentMachineSpec, currentMachine); err != nil {
+				return fmt.Errorf("unable to encode machine provider spec: %v", err)
+			}
+			log.Println("Machine upgraded successfully.")
+		}
+	}
+	clusterapi.SetPhase(currentMachine, clusterapi.MachinePhaseReady)
+	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).
+		Update(currentMachine); err != nil {
+		return fmt.Errorf("unable to update machine: %v", err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+func nodeNameForMachine(machineName string, machineClient sshmachine.Client) (string, error) {
+	log.Printf("Reading system UUID of machine %q", machineName)
+	cmd := fmt.Sprintf("cat %s", common.SystemUUIDFile)
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+	}
+	systemUUID := strings.TrimSpace(string(stdOut))
+	// TODO(dlipovetsky) Handle the case when kubectl is not found. Possibly
+	// infer that the nodeadm reset ran at least as far as removing the kubectl
+	// binary. nodeName includes the object kind, i.e.,
+
+	log.Printf("Identifying node for machine %q", machineName)
+	// Requires sudo because the kubelet kubeconfig is readable by only by root.
+	cmd = fmt.Sprintf(`%s --kubeconfig=%s get nodes -ojsonpath='{.items[?(@.status.nodeInfo.systemUUID=="%s")].metadata.name}'`, common.KubectlFile, common.KubeletKubeconfig, systemUUID)
+	stdOut, stdErr, err = machineClient.RunCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+	}
+	nodeNames, err := cliparse.ParseNames(stdOut, "node", remoteVersion(machineClient, kubectlVersionCmd()))
+	if err != nil {
+		return "", fmt.Errorf("unable to parse the output of %q: %v", cmd, err)
+	}
+	switch len(nodeNames) {
+	case 0:
+		return "", nil
+	case 1:
+		return nodeNames[0], nil
+	default:
+		return "", fmt.Errorf("found %d nodes with system UUID %q: %v", len(nodeNames), systemUUID, nodeNames)
+	}
+}
+
+func drainNode(nodeName string, machineClient sshmachine.Client) error {
+	// Requires sudo because the admin kubeconfig is readable by only by
+	// root.
+	// Use the admin kubeconfig because admin permissions are required to
+	// drain.
+	// Use --ignore-daemonsets because any DaemonSet-managed Pods will
+	// prevent the drain otherwise, and because all Nodes have DaemonSet
+	// Pods (kube-proxy, overlay network).
+	cmd := fmt.Sprintf("%s --kubeconfig=%s drain %s --timeout=%v --grace-period=%v --delete-local-data=%v --force=%v --ignore-daemonsets", common.KubectlFile, common.AdminKubeconfig, nodeName, drainTimeout, drainGracePeriodSeconds, drainDeleteLocalData, drainForce)
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+	}
+	log.Println(string(stdOut))
+	return nil
+}
+
+func deleteNode(nodeName string, machineClient sshmachine.Client) error {
+	// Requires sudo because the kubelet kubeconfig is readable by only by
+	// root.
+	cmd := fmt.Sprintf("%s --kubeconfig=%s delete node %s", common.KubectlFile, common.KubeletKubeconfig, nodeName)
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+	}
+	log.Println(string(stdOut))
+	return nil
+}
+
+func uncordonNode(nodeName string, machineClient sshmachine.Client) error {
+	// Requires sudo because the kubelet kubeconfig is readable by only by
+	// root.
+	cmd := fmt.Sprintf("%s --kubeconfig=%s uncordon %s", common.KubectlFile, common.AdminKubeconfig, nodeName)
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (%s) (%s)", cmd, err, string(stdOut), string(stdErr))
+	}
+	log.Println(string(stdOut))
+	return nil
+}
+
+var machineCmdUpgrade = &cobra.Command{
+	Use:   "machine",
+	Short: "Upgrade machine",
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		startOperationReport(cmd, "upgrade machine", []string{ip})
+		if err := upgradeMachine(ip); err != nil {
+			log.Fatalf("Upgrade machine failed with error : %v", err)
+		}
+		finishOperationReport(nil)
+	},
+}
+
+// machineUpdate is the set of changes to apply to a machine. A nil or empty
+// field is left unchanged.
+type machineUpdate struct {
+	iface          string
+	port           int
+	publicKeyFiles []string
+	labels         map[string]string
+}
+
+func updateMachine(ip string, update machineUpdate) error {
+	targetMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return operror.New(operror.NotFound, "machine %q not found", ip)
+		}
+		return fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	targetMachineSpec, err := providerCodec.GetMachineSpec(*targetMachine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine %q spec: %v", targetMachine.Name, err)
+	}
+	targetProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(targetMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get provisioned machine %q: %v", targetMachineSpec.ProvisionedMachineName, err)
+	}
+
+	sshConfig := targetProvisionedMachine.Spec.SSHConfig.DeepCopy()
+	if update.port != 0 {
+		sshConfig.Port = update.port
+	}
+	if len(update.publicKeyFiles) != 0 {
+		var publicKeys []string
+		for _, file := range update.publicKeyFiles {
+			publicKey, err := sshutil.PublicKeyFromFile(file)
+			if err != nil {
+				return fmt.Errorf("unable to parse SSH public key from %q: %v", file, err)
+			}
+			publicKeys = append(publicKeys, string(ssh.MarshalAuthorizedKey(publicKey)))
+		}
+		sshConfig.PublicKeys = publicKeys
+	}
+	// Verify the new SSH configuration before it is saved, so that the
+	// machine does not become unreachable.
+	machineClient, err := sshMachineClientFromSSHConfig(sshConfig)
+	if err != nil {
+		return fmt.Errorf("unable to connect to machine %q using the updated SSH configuration: %v", targetMachine.Name, err)
+	}
+	targetProvisionedMachine.Spec.SSHConfig = sshConfig
+
+	if len(update.iface) != 0 && update.iface != targetProvisionedMachine.Spec.VIPNetworkInterface {
+		iface, err := updateKeepalivedInterface(targetMachine, update.iface, targetProvisionedMachine.Spec.VIPNetworkInterface, machineClient)
+		if err != nil {
+			return fmt.Errorf("unable to update keepalived interface: %v", err)
+		}
+		targetProvisionedMachine.Spec.VIPNetworkInterface = iface
+	}
+
+	if len(update.labels) != 0 {
+		if targetMachine.Spec.Labels == nil {
+			targetMachine.Spec.Labels = make(map[string]string)
+		}
+		for k, v := range update.labels {
+			targetMachine.Spec.Labels[k] = v
+		}
+		if err := labelNodeForMachine(targetMachine, update.labels, machineClient); err != nil {
+			return fmt.Errorf("unable to label node: %v", err)
+		}
+	}
+
+	if _, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Update(targetProvisionedMachine); err != nil {
+		return fmt.Errorf("unable to update provisioned machine %q: %v", targetProvisionedMachine.Name, err)
+	}
+	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(targetMachine); err != nil {
+		return fmt.Errorf("unable to update machine %q: %v", targetMachine.Name, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+
+// updateKeepalivedInterface selects the interface keepalived binds the VIP to
+// from the comma-separated candidates and, if it differs from the current
+// interface, changes it and restarts keepalived. Only masters of clusters with
+// a VIP run keepalived. The selected interface is returned.
+func updateKeepalivedInterface(machine *clusterv1.Machine, candidates, current string, machineClient sshmachine.Client) (string, error) {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return "", fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if !clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) || clusterSpec.VIPConfiguration == nil {
+		return firstVIPNetworkInterface(candidates, current), nil
+	}
+	iface, err := resolveVIPNetworkInterface(candidates, clusterSpec.VIPConfiguration.IP, machineClient)
+	if err != nil {
+		return "", err
+	}
+	if iface == current {
+		return iface, nil
+	}
+	log.Printf("Changing keepalived interface to %q", iface)
+	cmd := fmt.Sprintf(`sed -i -E 's/^([[:space:]]*interface[[:space:]]+).*/\1%s/' %s`, iface, common.KeepalivedConfigFile)
+	if stdOut, stdErr, err := machineClient.RunCommand(cmd); err != nil {
+		return "", fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	if err := restartService(common.KeepalivedService, machineClient); err != nil {
+		return "", err
+	}
+	return iface, nil
+}
+
+// selectVIPNetworkInterface selects the interface keepalived binds the VIP to
+// from the comma-separated candidates. The interfaces of masters are checked
+// on the machine, because the right interface can differ between machines.
+// Other machines do not run keepalived, so the first candidate is used.
+func selectVIPNetworkInterface(role clustercommon.MachineRole, candidates string, vipConfig *spv1.VIPConfiguration, sshConfig *spv1.SSHConfig) (string, error) {
+	if role != clustercommon.MasterRole || vipConfig == nil {
+		return firstVIPNetworkInterface(candidates, common.DefaultVIPNetworkInterface), nil
+	}
+	machineClient, err := sshMachineClientFromSSHConfig(sshConfig)
+	if err != nil {
+		return "", fmt.Errorf("unable to create machine client: %v", err)
+	}
+	iface, err := resolveVIPNetworkInterface(candidates, vipConfig.IP, machineClient)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Selected interface %q for keepalived", iface)
+	return iface, nil
+}
+
+// resolveVIPNetworkInterface returns the first of the comma-separated
+// candidates that is an interface on the machine. The candidate "auto" selects
+// the interface with an address in the subnet of the VIP.
+func resolveVIPNetworkInterface(candidates, vip string, machineClient sshmachine.Client) (string, error) {
+	cmd := "ip -o -4 addr show"
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return netif.Select(netif.SplitCandidates(candidates), netif.ParseAddresses(stdOut), net.ParseIP(vip))
+}
+
+// firstVIPNetworkInterface returns the first candidate that names an
+// interface, or the fallback if there is none.
+func firstVIPNetworkInterface(candidates, fallback string) string {
+	for _, c := range netif.SplitCandidates(candidates) {
+		if c != netif.Auto {
+			return c
+		}
+	}
+	return fallback
+}
+
+// labelNodeForMachine applies the labels to the cluster node of the machine.
+// The labels are applied from a master, because only the admin kubeconfig is
+// allowed to label nodes.
+func labelNodeForMachine(machine *clusterv1.Machine, labels map[string]string, machineClient sshmachine.Client) error {
+	nodeName, err := nodeNameForMachine(machine.Name, machineClient)
+	if err != nil {
+		return fmt.Errorf("unable to get node name: %v", err)
+	}
+	if len(nodeName) == 0 {
+		log.Printf("No cluster node found for machine %q. Labels will be applied when the node is created.", machine.Name)
+		return nil
+	}
+	// The labels are given to kubectl in a shell command. Labels recorded
+	// before they were validated are checked here.
+	if err := objectmeta.ValidateLabels(labels); err != nil {
+		return err
+	}
+	masterMachine, masterProvisionedMachine, err := masterMachineAndProvisionedMachine()
+	if err != nil {
+		return err
+	}
+	masterClient, err := sshMachineClientFromSSHConfig(masterProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", masterMachine.Name, err)
+	}
+	var pairs []string
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	log.Printf("Labeling cluster node %q for machine %q", nodeName, machine.Name)
+	cmd := fmt.Sprintf("%s --kubeconfig=%s label node %s --overwrite %s", common.KubectlFile, common.AdminKubeconfig, nodeName, strings.Join(pairs, " "))
+	stdOut, stdErr, err := masterClient.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return nil
+}
+
+// machineDefaultsForRole returns the defaults of create machine for the role,
+// as recorded in the cluster. If the cluster has none, they are empty.
+func machineDefaultsForRole(role clustercommon.MachineRole) (clusterapi.RoleDefaults, error) {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return clusterapi.RoleDefaults{}, nil
+		}
+		return clusterapi.RoleDefaults{}, fmt.Errorf("unable to get cluster: %v", err)
+	}
+	defaults, err := clusterapi.MachineDefaultsFromCluster(cluster)
+	if err != nil {
+		return clusterapi.RoleDefaults{}, err
+	}
+	return defaults[role], nil
+}
+
+// parseTaints parses taints of the form key=value:Effect or key:Effect.
+func parseTaints(specs []string) ([]corev1.Taint, error) {
+	taints := make([]corev1.Taint, 0, len(specs))
+	for _, spec := range specs {
+		i := strings.LastIndex(spec, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("taint %q must be of the form key=value:Effect or key:Effect", spec)
+		}
+		taint := corev1.Taint{Effect: corev1.TaintEffect(spec[i+1:])}
+		switch taint.Effect {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("taint %q has effect %q; must be one of %s, %s, or %s", spec, taint.Effect, corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+		}
+		kv := strings.SplitN(spec[:i], "=", 2)
+		taint.Key = kv[0]
+		if len(kv) == 2 {
+			taint.Value = kv[1]
+		}
+		if len(taint.Key) == 0 {
+			return nil, fmt.Errorf("taint %q must have a key", spec)
+		}
+		taints = append(taints, taint)
+	}
+	return taints, nil
+}
+
+var machineCmdUpdate = &cobra.Command{
+	Use:   "machine",
+	Short: "Update the spec of a machine and apply the changes to the machine",
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Unable to parse `port` flag: %v", err)
+		}
+		publicKeyFiles, err := cmd.Flags().GetStringSlice("public-keys")
+		if err != nil {
+			log.Fatalf("Unable to parse `public-keys` flag: %v", err)
+		}
+		labelPairs, err := cmd.Flags().GetStringSlice("labels")
+		if err != nil {
+			log.Fatalf("Unable to parse `labels` flag: %v", err)
+		}
+		labels, err := objectmeta.ParseLabels(labelPairs)
+		if err != nil {
+			log.Fatalf("Unable to parse `labels` flag: %v", err)
+		}
+		update := machineUpdate{
+			iface:          cmd.Flag("iface").Value.String(),
+			port:           port,
+			publicKeyFiles: publicKeyFiles,
+			labels:         labels,
+		}
+		if err := updateMachine(ip, update); err != nil {
+			log.Fatalf("Unable to update machine %q: %v", ip, err)
+		}
+		log.Println("Machine updated successfully.")
+	},
+}
+
+// promoteMachine converts a machine with the node role into a master. The
+// machine is checked before it is changed: its interface for keepalived is
+// selected, and it must pass the preflight checks of a master. The node is
+// then drained and deleted, and the machine is reset, before being
+// provisioned again as a master. Provisioning joins the machine to the etcd
+// cluster and bootstraps the control plane. The machine keeps its objects in
+// the state, its labels, and its taints, throughout; if provisioning fails,
+// the machine is kept with phase Failed, so that creating it again as a
+// master resumes the promotion.
+func promoteMachine(ip string) error {
+	targetMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q: %v", ip, err)
+	}
+	if clusterutil.RoleContains(clustercommon.MasterRole, targetMachine.Spec.Roles) {
+		return fmt.Errorf("machine %q is already a master", targetMachine.Name)
+	}
+	if isEtcdMachine(targetMachine) {
+		return fmt.Errorf("machine %q is an etcd machine; only a node can be promoted", targetMachine.Name)
+	}
+	targetMachineSpec, err := providerCodec.GetMachineSpec(*targetMachine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine %q spec: %v", targetMachine.Name, err)
+	}
+	targetProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(targetMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get provisioned machine %q: %v", targetMachineSpec.ProvisionedMachineName, err)
+	}
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if clusterSpec.VIPConfiguration == nil {
+		if _, _, err := masterMachineAndProvisionedMachine(); err == nil {
+			return fmt.Errorf("this cluster already has one master and has no VIP configured")
+		}
+	}
+	iface, err := selectVIPNetworkInterface(clustercommon.MasterRole, targetProvisionedMachine.Spec.VIPNetworkInterface, clusterSpec.VIPConfiguration, targetProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to select the interface keepalived will bind to: %v", err)
+	}
+	preflightClient, err := sshMachineClientFromSSHConfig(targetProvisionedMachine.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	// The ports of the node are freed when the machine is reset.
+	if err := runPreflightChecks(preflightClient, clustercommon.MasterRole, promotionPreflightPorts(), cluster, clusterSpec); err != nil {
+		return err
+	}
+	masterMachine, err := promotedMachine(targetMachine, targetProvisionedMachine, iface)
+	if err != nil {
+		return err
+	}
+
+	if err := setMachinePhase(targetMachine.Name, clusterapi.MachinePhaseProvisioning); err != nil {
+		return err
+	}
+	if err := drainAndResetMachine(cluster, targetMachine, targetProvisionedMachine); err != nil {
+		if phaseErr := setMachinePhase(targetMachine.Name, clusterapi.MachinePhaseFailed); phaseErr != nil {
+			log.Warnf("Unable to record the failed promotion of machine %q: %v", targetMachine.Name, phaseErr)
+		}
+		return err
+	}
+
+	log.Println("Provisioning machine as a master")
+	targetProvisionedMachine.Spec.VIPNetworkInterface = iface
+	if targetProvisionedMachine, err = state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Update(targetProvisionedMachine); err != nil {
+		return fmt.Errorf("unable to update provisioned machine %q: %v", targetProvisionedMachine.Name, err)
+	}
+	// The actuator may have updated the machine while resetting it.
+	current, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(masterMachine.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q: %v", masterMachine.Name, err)
+	}
+	masterMachine.ResourceVersion = current.ResourceVersion
+	if masterMachine, err = state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(masterMachine); err != nil {
+		return fmt.Errorf("unable to update machine %q: %v", masterMachine.Name, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	// The machine was reset, so rolling it back would leave a machine that is
+	// neither a node nor in the state.
+	keep := keepMachineOnFailure
+	keepMachineOnFailure = true
+	defer func() { keepMachineOnFailure = keep }()
+	if err := provisionMachine(cluster, masterMachine, targetProvisionedMachine); err != nil {
+		return fmt.Errorf("%v. The machine is kept with phase %s; run 'cctl create machine --ip %s --role master' to resume promoting it", err, clusterapi.MachinePhaseFailed, ip)
+	}
+	return nil
+}
+
+// drainAndResetMachine drains and deletes the node of the machine, and resets
+// the machine, so that it can be provisioned again.
+func drainAndResetMachine(cluster *clusterv1.Cluster, machine *clusterv1.Machine, pm *spv1.ProvisionedMachine) error {
+	if err := drainAndDeleteNodeForMachine(machine, pm); err != nil {
+		return fmt.Errorf("unable to drain and delete cluster node for machine %q: %v", machine.Name, err)
+	}
+	machineClientBuilder, err := newMachineClientBuilder()
+	if err != nil {
+		return fmt.Errorf("unable to create machine client builder: %v", err)
+	}
+	actuator := newActuator(
+		state.KubeClient,
+		state.ClusterClient,
+		state.SPClient,
+		machineClientBuilder,
+		len(pm.Spec.SSHConfig.PublicKeys) == 0,
+		log.LogLevel(),
+	)
+	log.Println("Resetting machine")
+	if err := actuator.Delete(cluster, machine); err != nil {
+		return fmt.Errorf("unable to reset machine: %v", err)
+	}
+	return nil
+}
+
+// promotedMachine returns the machine as a master, to replace the machine
+// once it is reset. It keeps the labels, annotations, node labels, and taints
+// of the machine, and the master taint is added.
+func promotedMachine(machine *clusterv1.Machine, pm *spv1.ProvisionedMachine, iface string) (*clusterv1.Machine, error) {
+	_, master, err := newProvisionedMachineAndMachine(machine.Name, clustercommon.MasterRole, iface, *pm.Spec.SSHConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create machine objects: %v", err)
+	}
+	master.ObjectMeta = *machine.ObjectMeta.DeepCopy()
+	delete(master.Annotations, common.CompletedCreateStepsAnnotationKey)
+	master.Spec.Labels = machine.Spec.Labels
+	for _, t := range machine.Spec.Taints {
+		if !hasTaint(master.Spec.Taints, t) {
+			master.Spec.Taints = append(master.Spec.Taints, t)
+		}
+	}
+	clusterapi.SetPhase(master, clusterapi.MachinePhaseProvisioning)
+	return master, nil
+}
+
+func hasTaint(taints []corev1.Taint, taint corev1.Taint) bool {
+	for _, t := range taints {
+		if t.Key == taint.Key && t.Effect == taint.Effect {
+			return true
+		}
+	}
+	return false
+}
+
+var machineCmdPromote = &cobra.Command{
+	Use:   "machine",
+	Short: "Promote a machine with the node role to a master",
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		if err := promoteMachine(ip); err != nil {
+			log.Fatalf("Unable to promote machine %q: %v", ip, err)
+		}
+	},
+}
+
+var machineBundleCmd = &cobra.Command{
+	Use:   "machine",
+	Short: "Create a support bundle for a node",
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		targetMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get machine %q: %v", ip, err)
+		}
+		targetMachineSpec, err := providerCodec.GetMachineSpec(*targetMachine)
+		if err != nil {
+			log.Fatalf("Unable to decode machine %q spec: %v", targetMachine.Name, err)
+		}
+		targetProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(targetMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get provisioned machine %q: %v", targetMachineSpec.ProvisionedMachineName, err)
+		}
+		targetMachineClient, err := sshMachineClientFromSSHConfig(targetProvisionedMachine.Spec.SSHConfig)
+		if err != nil {
+			log.Fatalf("unable to create machine client for machine %q: %v", targetMachine.Name, err)
+		}
+		t := time.Now()
+
+		bundleFileBaseName := fmt.Sprintf("%s-%s-%s.tgz", common.SupportBundleFileNamePrefix, ip, t.Format(time.RFC3339))
+		localPath := cmd.Flag("output").Value.String()
+		if len(localPath) == 0 {
+			localPath = bundleFileBaseName
+		}
+		remotePath := path.Join(common.DashcamBundleBaseDir, bundleFileBaseName)
+		command := fmt.Sprintf("%s bundle --output %s", common.DashcamCommandPath, remotePath)
+		log.Printf("Started creating support bundle for %s. This will take a few minutes.", ip)
+		stdOut, stdErr, err := targetMachineClient.RunCommand(command)
+		if err != nil {
+			log.Fatalf("Failed to create support bundle %q: %v (stdout: %q, stderr: %q)", command, err, string(stdOut), string(stdErr))
+		}
+		defer targetMachineClient.RemoveFile(remotePath)
+		if err = downloadRemoteFile(remotePath, localPath, targetMachineClient, targetProvisionedMachine.Spec.SSHConfig); err != nil {
+			log.Fatalf("Failed to download support bundle: %v", err)
+		}
+		log.Infof("cctl bundle downloaded to %s ", localPath)
+	},
+}
+
+func init() {
+	createCmd.AddCommand(machineCmdCreate)
+	machineCmdCreate.Flags().String("ip", "", "IP of the machine")
+	machineCmdCreate.Flags().Int("port", common.DefaultSSHPort, "SSH port")
+	machineCmdCreate.Flags().String("role", "", "Role of the machine. Can be master/node/etcd")
+	machineCmdCreate.Flags().StringSlice("public-keys", []string{}, "The machine's SSH public keys. Provide a comma-separated list, or define multiple flags.")
+	machineCmdCreate.Flags().String("iface", common.DefaultVIPNetworkInterface, ifaceFlagUsage)
+	machineCmdCreate.Flags().StringSliceVar(&ignorePreflightErrors, "ignore-preflight-errors", []string{}, "Preflight checks whose failures are shown as warnings: ports, swap, os, writable-paths, cgroup-driver, disk-space, time-sync, api-connectivity, or all. Provide a comma-separated list, or define multiple flags.")
+	machineCmdCreate.Flags().StringVar(&artifactDir, "artifact-dir", "", "Directory, laid out as by bundle download, from which nodeadm and etcdadm are uploaded to a machine that has them neither installed nor in its cache")
+	machineCmdCreate.Flags().BoolVar(&keepMachineOnFailure, "keep-on-failure", false, "If the machine fails to be created, keep it in the state, with phase Failed, and do not reset it, e.g. to troubleshoot it")
+	machineCmdCreate.Flags().StringSlice("labels", []string{}, "Labels, as key=value, to apply to the machine's cluster node after it joins the cluster. Provide a comma-separated list, or define multiple flags.")
+	machineCmdCreate.Flags().StringSlice("taints", []string{}, "Taints, as key=value:Effect or key:Effect, to register the machine's cluster node with. Effect is NoSchedule, PreferNoSchedule, or NoExecute. Provide a comma-separated list, or define multiple flags.")
+	machineCmdCreate.Flags().String("kubelet-config", "", "YAML file with a fragment of a KubeletConfiguration, e.g. maxPods, evictionHard, or systemReserved, to merge into the kubelet configuration of the machine")
+	machineCmdCreate.Flags().String("like", "", "IP of an existing machine to copy the role, interface, SSH port, SSH credential, and labels from")
+	machineCmdCreate.Flags().String("report", "", reportFlagUsage)
+	machineCmdCreate.Flags().String("events", "", eventsFlagUsage)
+	machineCmdCreate.Flags().Duration("max-fsync-latency", common.DefaultMaxFsyncLatency, "Before creating a master, measure the 99th percentile fdatasync latency of the disk that will hold the etcd data, and refuse to create the master if it is above this value")
+	machineCmdCreate.Flags().Bool("ignore-etcd-disk-latency", false, "Create a master even if its etcd disk latency is above --max-fsync-latency, logging a warning instead")
+	machineCmdCreate.Flags().Bool("check-hardware", false, "Before creating a master, verify that its disk, memory, and network meet the etcd requirements, using the default thresholds of the check hardware command")
+	machineCmdCreate.Flags().Bool("check-capacity", false, "Before creating a master or node, verify that the pod CIDR has a node range left for it, and warn if few are left, or if the kubelet maxPods is more than the addresses of a range")
+
+	deleteCmd.AddCommand(machineCmdDelete)
+	machineCmdDelete.Flags().StringSlice("ip", []string{}, "IPs of the machines. Provide a comma-separated list, or define multiple flags.")
+	machineCmdDelete.Flags().StringP("file", "f", "", "Location of a file containing a YAML list of machine IPs")
+	machineCmdDelete.Flags().String("role", "", "Delete all machines with this role. Can be master/node/etcd")
+	machineCmdDelete.Flags().Bool("force", false, "Force delete the machine")
+	machineCmdDelete.Flags().Bool("skip-drain-delete", false, "Do not drain and delete the cluster node for the machine")
+	machineCmdDelete.Flags().BoolVar(&acknowledgeDataLoss, "acknowledge-data-loss", false, "Delete the machine even if pods on its node have emptyDir or local persistent volume data that is lost when the node is drained and deleted")
+	machineCmdDelete.Flags().String("report", "", reportFlagUsage)
+	machineCmdDelete.Flags().String("events", "", eventsFlagUsage)
+	machineCmdDelete.Flags().DurationVar(&drainTimeout, "drain-timeout", common.DrainTimeout, "The length of time to wait before giving up, zero means infinite")
+	machineCmdDelete.Flags().IntVar(&drainGracePeriodSeconds, "drain-grace-period", common.DrainGracePeriodSeconds, "Period of time in seconds given to each pod to terminate gracefully. If negative, the default value specified in the pod will be used.")
+	machineCmdDelete.Flags().BoolVar(&drainDeleteLocalData, "drain-delete-local-data", common.DrainDeleteLocalData, "Continue even if there are pods using emptyDir (local data that will be deleted when the node is drained).")
+	machineCmdDelete.Flags().BoolVar(&drainForce, "drain-force", common.DrainForce, "Continue even if there are pods not managed by a ReplicationController, ReplicaSet, Job, DaemonSet or StatefulSet.")
+
+	machineCmdGet.Flags().String("ip", "", "IP of the machine")
+	getCmd.AddCommand(machineCmdGet)
+
+	machineCmdUpgrade.Flags().String("ip", "", "IP of the machine")
+	machineCmdUpgrade.Flags().String("report", "", reportFlagUsage)
+	machineCmdUpgrade.Flags().String("events", "", eventsFlagUsage)
+	upgradeCmd.AddCommand(machineCmdUpgrade)
+
+	promoteCmd.AddCommand(machineCmdPromote)
+	machineCmdPromote.Flags().String("ip", "", "IP of the machine")
+	machineCmdPromote.MarkFlagRequired("ip")
+
+	updateCmd.AddCommand(machineCmdUpdate)
+	machineCmdUpdate.Flags().String("ip", "", "IP of the machine")
+	machineCmdUpdate.MarkFlagRequired("ip")
+	machineCmdUpdate.Flags().String("iface", "", ifaceFlagUsage)
+	machineCmdUpdate.Flags().Int("port", 0, "SSH port")
+	machineCmdUpdate.Flags().StringSlice("public-keys", []string{}, "The machine's SSH public keys. Provide a comma-separated list, or define multiple flags.")
+	machineCmdUpdate.Flags().StringSlice("labels", []string{}, "Labels, as key=value, to add to the machine's cluster node. Provide a comma-separated list, or define multiple flags.")
+
+	machineCmdStatus.Flags().String("ip", "", "IP of the machine. If not specified, all machines are checked")
+	machineCmdStatus.Flags().BoolVar(&showUsage, "usage", true, "Show the CPU, memory, and disk usage, and the top pods, of reachable machines")
+	machineCmdStatus.Flags().IntVar(&topPodsCount, "top-pods", 5, "Number of pods, using the most CPU, to show for each machine")
+	statusCmd.AddCommand(machineCmdStatus)
+
+	bundleCmd.AddCommand(machineBundleCmd)
+	machineBundleCmd.Flags().String("output", "", fmt.Sprintf("File path for bundle tgz file (default \"%s-<ip>-<timestamp>.tgz\" created in current directory)", common.SupportBundleFileNamePrefix))
+	machineBundleCmd.Flags().String("ip", "", "IP address of the machine")
+	machineBundleCmd.MarkFlagRequired("ip")
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// The metrics are served by serve, so that the health of cluster management
+// can be alerted on.
+var (
+	machineOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cctl_machine_operations_total",
+		Help: "Number of machine operations, by operation and result.",
+	}, []string{"operation", "result"})
+	machineOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cctl_machine_operation_duration_seconds",
+		Help:    "Duration of machine operations, by operation.",
+		Buckets: []float64{30, 60, 120, 300, 600, 1200, 1800, 3600},
+	}, []string{"operation"})
+	sshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cctl_ssh_failures_total",
+		Help: "Number of failures to connect to a machine, or to run a command on it, not counting commands that exit with an error.",
+	}, []string{"host"})
+	certificateExpiryTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cctl_certificate_expiry_timestamp_seconds",
+		Help: "Time the certificate on the master or etcd machine expires, as of the last certificate check.",
+	}, []string{"machine", "path"})
+	certificateCheckTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cctl_certificate_check_timestamp_seconds",
+		Help: "Time of the last certificate check that read the certificates of every master and etcd machine.",
+	})
+	etcdMembers = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cctl_etcd_members",
+		Help: "Number of machines with an etcd member in the state.",
+	}, countEtcdMembers)
+)
+
+// observeMachineOperation runs the machine operation, and records its result
+// and duration.
+func observeMachineOperation(operation string, run func() error) error {
+	started := time.Now()
+	err := run()
+	result := "succeeded"
+	if err != nil {
+		result = "failed"
+	}
+	machineOperations.WithLabelValues(operation, result).Inc()
+	machineOperationDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+	return err
+}
+
+// countEtcdMembers returns the number of machines with an etcd member in the
+// state file, or NaN if it cannot be read.
+func countEtcdMembers() float64 {
+	s, err := readStateObjects()
+	if err != nil {
+		log.Errorf("Unable to read state: %v", err)
+		return math.NaN()
+	}
+	var n int
+	for _, machine := range s.MachineList.Items {
+		if machine.Namespace != namespace {
+			continue
+		}
+		machineStatus, err := providerCodec.GetMachineStatus(machine)
+		if err == nil && machineStatus.EtcdMember != nil {
+			n++
+		}
+	}
+	return float64(n)
+}
+
+// checkCertificateExpiries records when the certificates on every master and
+// etcd machine expire.
+func checkCertificateExpiries() error {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list machines: %v", err)
+	}
+	var failed []string
+	certificateExpiryTimestamp.Reset()
+	for i := range machineList.Items {
+		machine := &machineList.Items[i]
+		if !clusterapi.RunsEtcd(*machine) {
+			continue
+		}
+		client, err := machineClientForMachine(machine)
+		if err != nil {
+			log.Errorf("Unable to create machine client for machine %q: %v", machine.Name, err)
+			failed = append(failed, machine.Name)
+			continue
+		}
+		master := clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles)
+		expiries, err := machineCertificateExpiries(machine.Name, client, master)
+		if err != nil {
+			log.Errorf("Unable to read certificates on machine %q: %v", machine.Name, err)
+			failed = append(failed, machine.Name)
+		}
+		for _, e := range expiries {
+			certificateExpiryTimestamp.WithLabelValues(e.Machine, e.Path).Set(float64(e.expires.Unix()))
+		}
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("unable to read certificates on machines %s", strings.Join(failed, ", "))
+	}
+	certificateCheckTimestamp.Set(float64(time.Now().Unix()))
+	return nil
+}
+
+// countSSHFailures counts the failures of the builder to connect to machines,
+// and of its clients to run commands.
+func countSSHFailures(builder sshutil.ClientBuilder) sshutil.ClientBuilder {
+	return func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		client, err := builder(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+		if err != nil {
+			sshFailures.WithLabelValues(host).Inc()
+			return nil, err
+		}
+		return &sshFailureCountingClient{Client: client, host: host}, nil
+	}
+}
+
+// sshFailureCountingClient counts the failures to run commands on the
+// machine. The machine client returns the failure of a command that runs, and
+// exits with an error, as "command failed"; those are not SSH failures.
+type sshFailureCountingClient struct {
+	sshmachine.Client
+	host string
+}
+
+func (c *sshFailureCountingClient) Close() error {
+	return sshutil.Close(c.Client)
+}
+
+func (c *sshFailureCountingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	stdOut, stdErr, err := c.Client.RunCommand(cmd)
+	if err != nil && !strings.HasPrefix(err.Error(), "command failed") {
+		sshFailures.WithLabelValues(c.host).Inc()
+	}
+	return stdOut, stdErr, err
+}
+
+func init() {
+	prometheus.MustRegister(machineOperations, machineOperationDuration, sshFailures, certificateExpiryTimestamp, certificateCheckTimestamp, etcdMembers)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+
+	"github.com/platform9/cctl/pkg/state/v1"
+
+	"github.com/spf13/cobra"
+
+	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	stateutil "github.com/platform9/cctl/pkg/state/util"
+	"github.com/platform9/cctl/pkg/state/v0"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+)
+
+// migrateCmd represents the migrate command
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the state file to the current version",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		runMigrate()
+	},
+}
+
+var stateCmdMigrate = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the state file to the current version",
+	Long: `Migrate the state file to the current version.
+
+The schema version of the state file is upgraded to the current version, and
+the provider configs and statuses of clusters and machines written by older
+versions of the ssh-provider, e.g. with API version sshproviderconfig/v1alpha1,
+are upgraded to the API version the ssh-provider of this cctl decodes. Other
+commands refuse to read a state file that needs migration.
+
+Migration is idempotent: a state file at the current version is not changed.
+Back up the state file first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runMigrate()
+	},
+}
+
+func runMigrate() {
+	if err := lockState(); err != nil {
+		log.Fatalf("Unable to open state: %v", err)
+	}
+	if err := migrateState(); err != nil {
+		log.Fatalf("Unable to migrate state: %v", err)
+	}
+}
+
+// migrateState upgrades the schema version of the state file, and then its
+// legacy provider configs, writing the state file if either changes.
+func migrateState() error {
+	version, err := stateutil.VersionFromFile(stateFilename)
+	if err != nil {
+		return fmt.Errorf("error determining version of state file: %v", err)
+	}
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	clusterClient := clusterclientfake.NewSimpleClientset()
+	spClient := spclientfake.NewSimpleClientset()
+	var stateV2 *cctlstate.State
+	switch version {
+	case 0:
+		log.Println("Migrating from v0")
+		stateV0 := v0.NewWithFile(stateFilename, kubeClient, clusterClient, spClient)
+		if err := stateV0.PushToAPIs(); err != nil {
+			return fmt.Errorf("error reading from state: %v", err)
+		}
+		stateV1 := stateutil.StateV1FromStateV0(stateV0)
+		stateV2 = stateutil.StateV2FromStateV1(stateV1)
+	case 1:
+		log.Println("Migrating from v1")
+		stateV1 := v1.NewWithFile(stateFilename, kubeClient, clusterClient, spClient)
+		if err := stateV1.PushToAPIs(); err != nil {
+			return fmt.Errorf("error reading from state: %v", err)
+		}
+		stateV2 = stateutil.StateV2FromStateV1(stateV1)
+	case int(cctlstate.Version):
+		stateV2 = cctlstate.NewWithFile(stateFilename, kubeClient, clusterClient, spClient)
+	default:
+		return fmt.Errorf("state file version %d is newer than %d, the version this cctl supports", version, cctlstate.Version)
+	}
+	if err := configureStateSigning(stateV2); err != nil {
+		return fmt.Errorf("unable to read signing key: %v", err)
+	}
+	configureStateBackup(stateV2)
+	if err := configureSecretStore(stateV2); err != nil {
+		return fmt.Errorf("unable to configure Vault: %v", err)
+	}
+	if version == int(cctlstate.Version) {
+		if err := stateV2.PushToAPIs(); err != nil {
+			return fmt.Errorf("error reading from state: %v", err)
+		}
+	}
+	upgraded, err := stateutil.UpgradeProviderConfigs(stateV2.ClusterClient)
+	if err != nil {
+		return err
+	}
+	for _, name := range upgraded {
+		log.Printf("Upgraded provider config of %s", name)
+	}
+	if version == int(cctlstate.Version) && len(upgraded) == 0 {
+		log.Printf("No migration needed: already at v%d", cctlstate.Version)
+		return nil
+	}
+	if err := stateV2.PullFromAPIs(); err != nil {
+		return fmt.Errorf("error writing to state: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	stateCmd.AddCommand(stateCmdMigrate)
+}
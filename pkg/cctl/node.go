@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/nodestatus"
+)
+
+var nodesCmdGet = &cobra.Command{
+	Use:   "nodes",
+	Short: "Display the cluster node of every machine",
+	Long: `Display the cluster node of every machine, with its Ready condition, kubelet
+version, and internal IP. The nodes are listed from the API server, using the
+admin kubeconfig of the cluster, so the API server must be reachable from this
+host. Machines that have no node are displayed as NoNode, and nodes that match
+no machine are displayed without one. Etcd machines, which have no node, are
+not displayed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse `timeout`: %v", err)
+		}
+		statuses, err := nodeStatuses(timeout)
+		if err != nil {
+			log.Fatalf("Unable to get nodes: %v", err)
+		}
+		if ok, err := printTemplateOutput(map[string]interface{}{"items": statuses}); ok {
+			if err != nil {
+				log.Fatalf("Unable to print nodes: %v", err)
+			}
+			return
+		}
+		switch outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(statuses)
+			if err != nil {
+				log.Fatalf("Unable to marshal nodes to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(statuses)
+			if err != nil {
+				log.Fatalf("Unable to marshal nodes to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("NodeStatusPrintTemplate").Parse(common.NodeStatusPrintTemplate))
+			if err := t.Execute(os.Stdout, statuses); err != nil {
+				log.Fatalf("Could not pretty print nodes: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+		if names := nodestatus.WithoutNode(statuses); len(names) != 0 {
+			log.Warnf("Machines with no node: %s", strings.Join(names, ", "))
+		}
+	},
+}
+
+// nodeStatuses lists the nodes from the API server, with the admin
+// kubeconfig, and matches them to the machines that are expected to have one.
+func nodeStatuses(timeout time.Duration) ([]nodestatus.Status, error) {
+	nodes, err := listClusterNodes(timeout)
+	if err != nil {
+		return nil, err
+	}
+	machines, err := nodeMachines()
+	if err != nil {
+		return nil, err
+	}
+	return nodestatus.Match(machines, nodes), nil
+}
+
+// listClusterNodes lists the nodes from the API server, using the admin
+// kubeconfig.
+func listClusterNodes(timeout time.Duration) ([]corev1.Node, error) {
+	kubeconfig, err := adminKubeconfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get admin kubeconfig: %v", err)
+	}
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse admin kubeconfig: %v", err)
+	}
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read admin kubeconfig: %v", err)
+	}
+	restConfig.Timeout = timeout
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client: %v", err)
+	}
+	nodeList, err := client.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list nodes from %s: %v", restConfig.Host, err)
+	}
+	return nodeList.Items, nil
+}
+
+// nodeMachines returns the machines expected to have a node, with their
+// addresses.
+func nodeMachines() ([]nodestatus.Machine, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	var machines []nodestatus.Machine
+	for i := range machineList.Items {
+		m := &machineList.Items[i]
+		if isEtcdMachine(m) {
+			continue
+		}
+		var roles []string
+		for _, r := range m.Spec.Roles {
+			roles = append(roles, string(r))
+		}
+		addresses := []string{m.Name}
+		machineSpec, err := providerCodec.GetMachineSpec(*m)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode machine %q spec: %v", m.Name, err)
+		}
+		pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+		}
+		addresses = append(addresses, pm.Spec.SSHConfig.Host)
+		machines = append(machines, nodestatus.Machine{Name: m.Name, Roles: strings.Join(roles, ","), Addresses: addresses})
+	}
+	return machines, nil
+}
+
+func init() {
+	getCmd.AddCommand(nodesCmdGet)
+	nodesCmdGet.Flags().Duration("timeout", 30*time.Second, "Time to wait for the API server to list the nodes")
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/objectmeta"
+)
+
+var (
+	// objectLabels and objectAnnotations are stamped on every object cctl
+	// creates, in the state and in the cluster.
+	objectLabels      map[string]string
+	objectAnnotations map[string]string
+)
+
+// reactor is implemented by the fake clientsets that hold the state.
+type reactor interface {
+	PrependReactor(verb, resource string, reaction clienttesting.ReactionFunc)
+}
+
+// stampCreatedObjects stamps the object labels and annotations on every
+// object created in the state from now on.
+func stampCreatedObjects(clients ...reactor) {
+	for _, c := range clients {
+		c.PrependReactor("create", "*", stampReaction)
+	}
+}
+
+// stampReaction stamps the created object, and lets the next reactor store
+// it.
+func stampReaction(action clienttesting.Action) (bool, runtime.Object, error) {
+	createAction, ok := action.(clienttesting.CreateAction)
+	if !ok {
+		return false, nil, nil
+	}
+	if obj, err := meta.Accessor(createAction.GetObject()); err == nil {
+		objectmeta.Stamp(obj, objectLabels, objectAnnotations)
+	}
+	return false, nil, nil
+}
+
+// setObjectMetadataFromCluster uses the object labels and annotations
+// configured for the cluster, if any.
+func setObjectMetadataFromCluster(cluster *clusterv1.Cluster) error {
+	labels, err := objectmeta.Decode(cluster.Annotations[common.ObjectLabelsAnnotationKey])
+	if err != nil {
+		return fmt.Errorf("unable to parse object labels: %v", err)
+	}
+	annotations, err := objectmeta.Decode(cluster.Annotations[common.ObjectAnnotationsAnnotationKey])
+	if err != nil {
+		return fmt.Errorf("unable to parse object annotations: %v", err)
+	}
+	objectLabels, objectAnnotations = labels, annotations
+	return nil
+}
+
+// setClusterObjectMetadata records the object labels and annotations in the
+// cluster, and uses them for the objects created from now on.
+func setClusterObjectMetadata(cluster *clusterv1.Cluster, labels, annotations map[string]string) error {
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	if len(labels) != 0 {
+		v, err := objectmeta.Encode(labels)
+		if err != nil {
+			return err
+		}
+		cluster.Annotations[common.ObjectLabelsAnnotationKey] = v
+	}
+	if len(annotations) != 0 {
+		v, err := objectmeta.Encode(annotations)
+		if err != nil {
+			return err
+		}
+		cluster.Annotations[common.ObjectAnnotationsAnnotationKey] = v
+	}
+	objectLabels, objectAnnotations = labels, annotations
+	return nil
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/gitstate"
+	"github.com/platform9/cctl/pkg/util/lease"
+	"github.com/platform9/cctl/pkg/util/operror"
+)
+
+// operationLeaseTTL is how long the operation lease is held after its last
+// heartbeat.
+var operationLeaseTTL time.Duration
+
+// operationLease is held by a command that can change the cluster while it
+// runs, so that operators sharing the state cannot change the same cluster at
+// once. Unlike the state lock, it identifies the operation, and it expires if
+// its holder, on any host, stops renewing it.
+var operationLease *lease.Handle
+
+// operation is an operation lease, as printed by get operations.
+type operation struct {
+	Namespace string    `json:"namespace"`
+	Holder    string    `json:"holder"`
+	PID       int       `json:"pid"`
+	Operation string    `json:"operation"`
+	Acquired  time.Time `json:"acquired"`
+	Renewed   time.Time `json:"renewed"`
+	Expires   time.Time `json:"expires"`
+	Status    string    `json:"status"`
+}
+
+var operationsCmdGet = &cobra.Command{
+	Use:   "operations",
+	Short: "Display the operations that are changing clusters in the state",
+	Long: `Display the operations that are changing clusters in the state.
+
+Every command that can change a cluster holds the operation lease of the
+cluster while it runs, and refuses to start while another operator holds it.
+The holder renews the lease every third of --operation-lease-ttl. A lease that
+is not renewed, e.g. because its holder crashed, expires, and the next command
+takes it over. The state is not read, so operations are displayed while a
+command holds the state lock.`,
+	// The state is not read, so the state lock is not needed.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		operations, err := listOperations(time.Now())
+		if err != nil {
+			log.Fatalf("Unable to list operations: %v", err)
+		}
+		if ok, err := printTemplateOutput(map[string]interface{}{"items": operations}); ok {
+			if err != nil {
+				log.Fatalf("Unable to print operations: %v", err)
+			}
+			return
+		}
+		switch outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(operations)
+			if err != nil {
+				log.Fatalf("Unable to marshal operations to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(operations)
+			if err != nil {
+				log.Fatalf("Unable to marshal operations to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("OperationPrintTemplate").Parse(common.OperationPrintTemplate))
+			if err := t.Execute(os.Stdout, operations); err != nil {
+				log.Fatalf("Could not pretty print operations: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+	},
+}
+
+// operationLeaseFilename returns the file of the operation lease of the
+// cluster in the namespace. Clusters in different namespaces share the state
+// file, but not the lease.
+func operationLeaseFilename(ns string) string {
+	return stateFilename + "." + ns + common.OperationLeaseFileSuffix
+}
+
+// listOperations returns the operation lease of every namespace of the state,
+// ordered by namespace.
+func listOperations(now time.Time) ([]operation, error) {
+	prefix := stateFilename + "."
+	paths, err := filepath.Glob(prefix + "*" + common.OperationLeaseFileSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find operation leases: %v", err)
+	}
+	sort.Strings(paths)
+	operations := []operation{}
+	for _, p := range paths {
+		l, err := lease.Read(p)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			// Released since it was found.
+			continue
+		}
+		status := fmt.Sprintf("Running, expires in %s", l.Expires.Sub(now).Round(time.Second))
+		if l.Expired(now) {
+			status = fmt.Sprintf("Expired %s ago", now.Sub(l.Expires).Round(time.Second))
+		}
+		operations = append(operations, operation{
+			Namespace: strings.TrimSuffix(strings.TrimPrefix(p, prefix), common.OperationLeaseFileSuffix),
+			Holder:    l.Holder,
+			PID:       l.PID,
+			Operation: l.Operation,
+			Acquired:  l.Acquired,
+			Renewed:   l.Renewed,
+			Expires:   l.Expires,
+			Status:    status,
+		})
+	}
+	return operations, nil
+}
+
+// guardOperation makes every command that can change the cluster acquire the
+// operation lease before its persistent pre-run reads the state.
+func guardOperation(cmd *cobra.Command) {
+	if preRun := cmd.PersistentPreRun; preRun != nil {
+		cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+			acquireOperationLease(cmd, args)
+			preRun(cmd, args)
+		}
+	}
+	for _, c := range cmd.Commands() {
+		guardOperation(c)
+	}
+}
+
+func acquireOperationLease(cmd *cobra.Command, args []string) {
+	// serve takes the lease for every job it runs, rather than for as long as
+	// it runs, so that cctl can be used alongside.
+	if cmd == serveCmd {
+		return
+	}
+	if operationLease != nil || readOnly || !canChange(cmd) {
+		return
+	}
+	op := strings.Join(append([]string{cmd.CommandPath()}, args...), " ")
+	if err := takeOperationLease(op); err != nil {
+		if operror.KindOf(err) == operror.Precondition {
+			log.Fatalf("Unable to run %q: %v", cmd.CommandPath(), err)
+		}
+		log.Fatalf("Unable to acquire operation lease: %v", err)
+	}
+	log.RegisterExitHandler(releaseOperationLease)
+}
+
+// withOperationLease runs the operation holding the operation lease, as a
+// command that can change the cluster does. It is used to run operations
+// outside of a command, e.g. the jobs of serve.
+func withOperationLease(op string, f func() error) error {
+	if operationLease == nil && !readOnly {
+		if err := takeOperationLease(op); err != nil {
+			return err
+		}
+		defer releaseOperationLease()
+	}
+	return f()
+}
+
+// takeOperationLease acquires the operation lease for the operation, and
+// renews it until it is released. If another operator holds it, the error is
+// a precondition error.
+func takeOperationLease(op string) error {
+	if operationLeaseTTL <= 0 {
+		return operror.New(operror.Invalid, "--operation-lease-ttl must be positive")
+	}
+	path := operationLeaseFilename(namespace)
+	h, previous, err := lease.Acquire(path, operationHolder(), op, operationLeaseTTL)
+	if err != nil {
+		if err == lease.ErrReadOnly {
+			// The state cannot be changed, so the lease is not needed.
+			log.Debugf("Not acquiring operation lease: %v", err)
+			return nil
+		}
+		if lease.IsHeld(err) {
+			return operror.Wrap(operror.Precondition, err)
+		}
+		return err
+	}
+	// Operators on other hosts see the lease only once it is pushed.
+	if err := publishOperationLease("Acquire"); err != nil {
+		h.Release()
+		if err == gitstate.ErrConflict {
+			if l, readErr := lease.Read(path); readErr == nil && l != nil {
+				return operror.New(operror.Precondition, "the cluster is being changed by %s", l)
+			}
+			return operror.New(operror.Precondition, "another operator changed the operation lease first")
+		}
+		return fmt.Errorf("unable to push the operation lease: %v", err)
+	}
+	h.OnRenew = func() error {
+		if err := publishOperationLease("Renew"); err != gitstate.ErrConflict {
+			return err
+		}
+		return lease.ErrLost
+	}
+	if previous != nil {
+		log.Warnf("Took over the expired operation lease of %s", previous)
+	}
+	operationLease = h
+	h.Heartbeat(operationLeaseTTL/3, func(err error) {
+		if err == lease.ErrLost {
+			log.Errorf("The operation lease %q was taken over by another holder; another operator can change the cluster at the same time", path)
+			return
+		}
+		log.Warnf("Unable to renew the operation lease: %v", err)
+	})
+	return nil
+}
+
+func releaseOperationLease() {
+	if operationLease == nil {
+		return
+	}
+	if err := operationLease.Release(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to release operation lease: %v\n", err)
+	} else if err := publishOperationLease("Release"); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to push the released operation lease: %v\n", err)
+	}
+	operationLease = nil
+}
+
+// operationHolder identifies the operator, as user@host.
+func operationHolder() string {
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return username + "@" + hostname
+}
+
+func init() {
+	getCmd.AddCommand(operationsCmdGet)
+	rootCmd.PersistentFlags().DurationVar(&operationLeaseTTL, "operation-lease-ttl", common.DefaultOperationLeaseTTL, "how long the operation lease of the cluster, held by commands that can change it, is kept after its holder stops renewing it, e.g. because it crashed")
+}
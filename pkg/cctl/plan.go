@@ -0,0 +1,259 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/plan"
+	"github.com/platform9/cctl/pkg/util/schema"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// planCmd represents the plan command
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the changes needed to converge the cluster to a manifest",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		_, actions, err := planFromFile(cmd.Flag("file").Value.String())
+		if err != nil {
+			log.Fatalf("Unable to plan: %v", err)
+		}
+		printPlan(actions)
+	},
+}
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Converge the cluster to a manifest",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		manifest, actions, err := planFromFile(cmd.Flag("file").Value.String())
+		if err != nil {
+			log.Fatalf("Unable to plan: %v", err)
+		}
+		printPlan(actions)
+		if err := applyPlan(manifest, actions); err != nil {
+			log.Fatalf("Unable to apply: %v", err)
+		}
+		log.Println("Apply completed successfully.")
+	},
+}
+
+// planFromFile reads the manifest and computes the actions needed to
+// converge the cluster to it.
+func planFromFile(file string) (*plan.Manifest, []plan.Action, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read manifest: %v", err)
+	}
+	if err := validateFileSchema(schema.Manifest, file, data); err != nil {
+		return nil, nil, err
+	}
+	manifest := &plan.Manifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, nil, fmt.Errorf("unable to decode manifest: %v", err)
+	}
+	// The manifest refers to public key files, but the state stores the
+	// keys, so compare the keys.
+	desired := &plan.Manifest{Cluster: manifest.Cluster}
+	for _, m := range manifest.Machines {
+		if m.PublicKeys != nil {
+			var publicKeys []string
+			for _, file := range m.PublicKeys {
+				publicKey, err := sshutil.PublicKeyFromFile(file)
+				if err != nil {
+					return nil, nil, fmt.Errorf("unable to parse SSH public key from %q: %v", file, err)
+				}
+				publicKeys = append(publicKeys, string(ssh.MarshalAuthorizedKey(publicKey)))
+			}
+			m.PublicKeys = publicKeys
+		}
+		desired.Machines = append(desired.Machines, m)
+	}
+
+	clusterExists := true
+	if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{}); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, nil, fmt.Errorf("unable to get cluster: %v", err)
+		}
+		clusterExists = false
+	}
+	current, err := currentPlanMachines()
+	if err != nil {
+		return nil, nil, err
+	}
+	actions, err := plan.Compute(desired, clusterExists, current)
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, actions, nil
+}
+
+func currentPlanMachines() ([]plan.Machine, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	var machines []plan.Machine
+	for _, machine := range machineList.Items {
+		machineSpec, err := providerCodec.GetMachineSpec(machine)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode machine %q spec: %v", machine.Name, err)
+		}
+		provisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+		}
+		m := plan.Machine{
+			IP:         machine.Name,
+			Port:       provisionedMachine.Spec.SSHConfig.Port,
+			Iface:      provisionedMachine.Spec.VIPNetworkInterface,
+			PublicKeys: provisionedMachine.Spec.SSHConfig.PublicKeys,
+			Labels:     machine.Spec.Labels,
+		}
+		if len(machine.Spec.Roles) != 0 {
+			m.Role = string(machine.Spec.Roles[0])
+		}
+		machines = append(machines, m)
+	}
+	return machines, nil
+}
+
+func printPlan(actions []plan.Action) {
+	if len(actions) == 0 {
+		fmt.Println("No changes. The cluster matches the manifest.")
+		return
+	}
+	fmt.Println("Planned changes:")
+	for _, a := range actions {
+		fmt.Printf("  %s\n", a)
+	}
+}
+
+func applyPlan(manifest *plan.Manifest, actions []plan.Action) error {
+	machineFromManifest := make(map[string]plan.Machine, len(manifest.Machines))
+	for _, m := range manifest.Machines {
+		machineFromManifest[m.IP] = m
+	}
+	var deletes []string
+	for i, a := range actions {
+		// Deletions of machines that are not being replaced are done last,
+		// all together, so that they are ordered safely.
+		if a.Type == plan.DeleteMachine && !replacing(actions[i+1:], a.Machine.IP) {
+			deletes = append(deletes, a.Machine.IP)
+			continue
+		}
+		log.Printf("Applying: %s", a)
+		m := machineFromManifest[a.Machine.IP]
+		switch a.Type {
+		case plan.CreateCluster:
+			if len(manifest.Cluster.Namespace) == 0 {
+				manifest.Cluster.Namespace = namespace
+			}
+			if _, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Create(manifest.Cluster); err != nil {
+				return fmt.Errorf("unable to create cluster %q: %v", common.DefaultClusterName, err)
+			}
+			if err := state.PullFromAPIs(); err != nil {
+				return fmt.Errorf("unable to sync on-disk state: %v", err)
+			}
+		case plan.DeleteMachine:
+			if err := deleteMachine(a.Machine.IP, false, false); err != nil {
+				return fmt.Errorf("unable to delete machine %q: %v", a.Machine.IP, err)
+			}
+		case plan.CreateMachine:
+			port := m.Port
+			if port == 0 {
+				port = common.DefaultSSHPort
+			}
+			iface := m.Iface
+			if len(iface) == 0 {
+				iface = common.DefaultVIPNetworkInterface
+			}
+			if err := createMachine(m.IP, port, iface, m.Role, m.PublicKeys); err != nil {
+				return fmt.Errorf("unable to create machine %q: %v", m.IP, err)
+			}
+			if len(m.Labels) != 0 {
+				if err := updateMachine(m.IP, machineUpdate{labels: m.Labels}); err != nil {
+					return fmt.Errorf("unable to label machine %q: %v", m.IP, err)
+				}
+			}
+		case plan.UpdateMachine:
+			update := machineUpdate{
+				iface:          m.Iface,
+				port:           m.Port,
+				publicKeyFiles: m.PublicKeys,
+				labels:         m.Labels,
+			}
+			if err := updateMachine(m.IP, update); err != nil {
+				return fmt.Errorf("unable to update machine %q: %v", m.IP, err)
+			}
+		}
+	}
+	if len(deletes) != 0 {
+		log.Printf("Applying: delete machines %v", deletes)
+		if err := deleteMachines(deletes, false, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacing returns true if the machine is created by one of the actions.
+func replacing(actions []plan.Action, ip string) bool {
+	for _, a := range actions {
+		if a.Type == plan.CreateMachine && a.Machine.IP == ip {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+	planCmd.Flags().StringP("file", "f", "", "Location of file containing the desired cluster and machines")
+	planCmd.MarkFlagRequired("file")
+
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringP("file", "f", "", "Location of file containing the desired cluster and machines")
+	applyCmd.MarkFlagRequired("file")
+}
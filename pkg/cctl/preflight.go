@@ -0,0 +1,307 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	machineActuator "github.com/platform9/ssh-provider/pkg/clusterapi/machine"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/discover"
+	"github.com/platform9/cctl/pkg/util/hostos"
+	"github.com/platform9/cctl/pkg/util/operror"
+	"github.com/platform9/cctl/pkg/util/preflight"
+)
+
+// ignorePreflightErrors names the preflight checks whose failures do not
+// stop a machine from being created.
+var ignorePreflightErrors []string
+
+// supportedOSPatterns are the operating systems machines can run, as
+// patterns of discover.MatchesOS.
+var supportedOSPatterns = []string{"ubuntu-16.04", "ubuntu-18.04", "centos-7", "rhel-7", "sles-12", "sles-15", "flatcar"}
+
+// defaultKubeletCgroupDriver is the cgroup driver of the kubelet, unless the
+// cluster configures another.
+const defaultKubeletCgroupDriver = "cgroupfs"
+
+// preflightPorts returns the TCP ports that must be free on a machine with
+// the role.
+func preflightPorts(role clustercommon.MachineRole) []int {
+	switch role {
+	case clustercommon.MasterRole:
+		return []int{common.DefaultAPIServerPort, 2379, 2380, 10250, 10251, 10252}
+	case clusterapi.EtcdRole:
+		return []int{2379, 2380}
+	}
+	return []int{10250}
+}
+
+// promotionPreflightPorts returns the TCP ports that must be free on a node
+// before it is promoted to a master. The ports of the node are not, since
+// they are freed when the node is reset.
+func promotionPreflightPorts() []int {
+	inUse := make(map[int]bool)
+	for _, port := range preflightPorts(clustercommon.NodeRole) {
+		inUse[port] = true
+	}
+	var ports []int
+	for _, port := range preflightPorts(clustercommon.MasterRole) {
+		if !inUse[port] {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// runPreflightChecks verifies that the machine meets the requirements of its
+// role before it is provisioned, and that the ports are free. It returns an
+// error that lists every failed check that is not ignored.
+func runPreflightChecks(client sshmachine.Client, role clustercommon.MachineRole, ports []int, cluster *clusterv1.Cluster, cspec *spv1.ClusterSpec) error {
+	results := preflight.Run(preflightChecks(client, role, ports, cluster, cspec), ignorePreflightErrors)
+	for _, r := range results {
+		switch {
+		case r.Passed():
+			log.Printf("[pre-flight] %s: passed", r.Check)
+		case r.Ignored:
+			log.Warnf("[pre-flight] %s: %s. Continuing, because the check is ignored.", r.Check, r.Error)
+		default:
+			log.Errorf("[pre-flight] %s: %s. To fix: %s", r.Check, r.Error, r.Remediation)
+		}
+	}
+	if err := preflight.Error(results); err != nil {
+		return operror.Wrap(operror.Precondition, err)
+	}
+	return nil
+}
+
+func preflightChecks(client sshmachine.Client, role clustercommon.MachineRole, ports []int, cluster *clusterv1.Cluster, cspec *spv1.ClusterSpec) []preflight.Check {
+	var kubelet *spv1.KubeletConfiguration
+	if cspec.ClusterConfig != nil {
+		kubelet = cspec.ClusterConfig.Kubelet
+	}
+	checks := []preflight.Check{
+		{
+			Name:        "ports",
+			Remediation: fmt.Sprintf("find the processes with 'sudo ss -ltnp'; if they are left by a previous installation, run 'sudo %s reset'", machineActuator.NodeadmPath),
+			Run: func() error {
+				out, err := remoteOutput(client, "ss -ltn")
+				if err != nil {
+					return err
+				}
+				listening, err := preflight.ListeningPorts(out)
+				if err != nil {
+					return err
+				}
+				var inUse []string
+				for _, port := range ports {
+					if listening[port] {
+						inUse = append(inUse, strconv.Itoa(port))
+					}
+				}
+				if len(inUse) != 0 {
+					return fmt.Errorf("ports in use: %s", strings.Join(inUse, ", "))
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "swap",
+			Remediation: `run 'sudo swapoff -a', and comment out the swap entries in /etc/fstab`,
+			Run: func() error {
+				if kubelet != nil && kubelet.FailSwapOn != nil && !*kubelet.FailSwapOn {
+					return nil
+				}
+				out, err := remoteOutput(client, "cat /proc/swaps")
+				if err != nil {
+					return err
+				}
+				if devices := preflight.SwapDevices(out); len(devices) != 0 {
+					return fmt.Errorf("swap is enabled on %s", strings.Join(devices, ", "))
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "os",
+			Remediation: fmt.Sprintf("use one of %s, with kernel %d.%d or later", strings.Join(supportedOSPatterns, ", "), common.PreflightMinKernelMajor, common.PreflightMinKernelMinor),
+			Run: func() error {
+				out, err := remoteOutput(client, "cat /etc/os-release")
+				if err != nil {
+					return err
+				}
+				osRelease := discover.ParseOSRelease(out)
+				if !discover.MatchesOS(osRelease, supportedOSPatterns) {
+					return fmt.Errorf("operating system %s is not supported", osRelease)
+				}
+				out, err = remoteOutput(client, "uname -r")
+				if err != nil {
+					return err
+				}
+				ok, err := preflight.KernelAtLeast(string(out), common.PreflightMinKernelMajor, common.PreflightMinKernelMinor)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("kernel %s is not supported", strings.TrimSpace(string(out)))
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "writable-paths",
+			Remediation: "on immutable operating systems, e.g. Flatcar, create the cluster with --remote-bin-dir and --remote-admin-kubeconfig under /opt, /etc, or /var",
+			Run: func() error {
+				machineOS, err := detectHostOS(client)
+				if err != nil {
+					return err
+				}
+				for _, p := range []string{path.Dir(common.KubeadmFile), common.AdminKubeconfig} {
+					if err := machineOS.ValidateWritablePath(p); err != nil {
+						return fmt.Errorf("unable to write %s: %v", p, err)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "cgroup-driver",
+			Remediation: `set "exec-opts": ["native.cgroupdriver=<driver>"] in /etc/docker/daemon.json to the kubelet cgroup driver, and run 'sudo systemctl restart docker'`,
+			Run: func() error {
+				expected := defaultKubeletCgroupDriver
+				if kubelet != nil && len(kubelet.CgroupDriver) != 0 {
+					expected = kubelet.CgroupDriver
+				}
+				out, err := remoteOutput(client, "docker info --format '{{.CgroupDriver}}'")
+				if err != nil {
+					return fmt.Errorf("unable to get the docker cgroup driver (is docker running?): %v", err)
+				}
+				if driver := strings.TrimSpace(string(out)); driver != expected {
+					return fmt.Errorf("docker cgroup driver %q is different from kubelet cgroup driver %q", driver, expected)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "disk-space",
+			Remediation: fmt.Sprintf("free space on the file system of %s", path.Dir(common.EtcdDataDir)),
+			Run: func() error {
+				dir := path.Dir(common.EtcdDataDir)
+				out, err := remoteOutput(client, fmt.Sprintf("df -P -k %s", dir))
+				if err != nil {
+					return err
+				}
+				available, err := preflight.AvailableBytes(out)
+				if err != nil {
+					return err
+				}
+				if min := int64(common.PreflightMinDiskGiB) << 30; available < min {
+					return fmt.Errorf("%s has %d GiB available, less than %d GiB", dir, available>>30, common.PreflightMinDiskGiB)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "time-sync",
+			Remediation: "synchronize the clock with NTP, e.g. enable chrony or systemd-timesyncd, and check it with 'timedatectl'",
+			Run: func() error {
+				out, err := remoteOutput(client, "timedatectl status")
+				if err != nil {
+					return err
+				}
+				synced, err := preflight.ClockSynchronized(out)
+				if err != nil {
+					return err
+				}
+				if !synced {
+					return fmt.Errorf("the clock is not synchronized")
+				}
+				before := time.Now()
+				out, err = remoteOutput(client, "date +%s")
+				if err != nil {
+					return err
+				}
+				after := time.Now()
+				seconds, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+				if err != nil {
+					return fmt.Errorf("unable to parse the time of the machine %q: %v", string(out), err)
+				}
+				skew := time.Unix(seconds, 0).Sub(before.Add(after.Sub(before) / 2))
+				if skew < 0 {
+					skew = -skew
+				}
+				if skew > common.PreflightMaxClockSkew {
+					return fmt.Errorf("the clock differs from the clock of this host by %s, more than %s", skew.Truncate(time.Second), common.PreflightMaxClockSkew)
+				}
+				return nil
+			},
+		},
+	}
+	if role == clusterapi.EtcdRole {
+		// Etcd machines run neither docker nor the kubelet, and do not
+		// connect to the API server.
+		return withoutCheck(checks, "cgroup-driver")
+	}
+	// The first master has no API server to connect to yet.
+	if len(cluster.Status.APIEndpoints) != 0 {
+		endpoint := cluster.Status.APIEndpoints[0]
+		if cspec.VIPConfiguration != nil {
+			endpoint = clusterv1.APIEndpoint{Host: cspec.VIPConfiguration.IP, Port: endpoint.Port}
+		}
+		masterOS := hostos.Default
+		if master, _, err := masterMachineAndProvisionedMachine(); err == nil {
+			if o, err := hostos.Parse(master.Annotations[common.HostOSAnnotationKey]); err == nil {
+				masterOS = o
+			}
+		}
+		checks = append(checks, preflight.Check{
+			Name:        "api-connectivity",
+			Remediation: fmt.Sprintf("allow TCP connections from the machine to %s:%d, e.g. in the security groups, or in the firewall of the masters with '%s'", endpoint.Host, endpoint.Port, masterOS.AllowTCPPortCommand(endpoint.Port)),
+			Run: func() error {
+				cmd := fmt.Sprintf("timeout %d bash -c 'exec 3<>/dev/tcp/%s/%d'", int64(common.PreflightDialTimeout/time.Second), endpoint.Host, endpoint.Port)
+				if _, err := remoteOutput(client, cmd); err != nil {
+					return fmt.Errorf("unable to connect to the API server at %s:%d", endpoint.Host, endpoint.Port)
+				}
+				return nil
+			},
+		})
+	}
+	return checks
+}
+
+// withoutCheck returns the checks, except the one with the name.
+func withoutCheck(checks []preflight.Check, name string) []preflight.Check {
+	var kept []preflight.Check
+	for _, c := range checks {
+		if c.Name != name {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"os"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	"github.com/spf13/cobra"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/profile"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// maxProfiledPrograms is the number of programs listed in the profile of a
+// run, those that took the most time.
+const maxProfiledPrograms = 10
+
+var profileRun bool
+
+// runProfile records the resource usage of the command, if --profile-run is
+// set.
+var runProfile *profile.Profile
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&profileRun, "profile-run", false, "when the command exits, report to stderr how many state reads and writes, SSH connections, and remote commands it executed, and how long each took")
+	cobra.OnInitialize(startRunProfile)
+}
+
+// startRunProfile starts recording the resource usage of the command, if
+// --profile-run is set. The profile is written when the command exits, even
+// with a fatal error.
+func startRunProfile() {
+	if !profileRun || runProfile != nil {
+		return
+	}
+	runProfile = profile.New()
+	log.RegisterExitHandler(writeRunProfile)
+}
+
+// writeRunProfile writes the profile of the command to stderr, if it was
+// started and not already written.
+func writeRunProfile() {
+	p := runProfile
+	if p == nil {
+		return
+	}
+	runProfile = nil
+	command := "cctl"
+	if cmd, _, err := rootCmd.Find(os.Args[1:]); err == nil {
+		command = cmd.CommandPath()
+	}
+	if err := p.Write(os.Stderr, command, maxProfiledPrograms); err != nil {
+		log.Errorf("Unable to write profile: %v", err)
+	}
+}
+
+// profileSSHConnections records the connections of the builder to machines,
+// and the commands its clients run, in the profile of the command.
+func profileSSHConnections(builder sshutil.ClientBuilder) sshutil.ClientBuilder {
+	return func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		p := runProfile
+		if p == nil {
+			return builder(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+		}
+		started := time.Now()
+		client, err := builder(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+		p.RecordSSHConnection(time.Since(started), err)
+		if err != nil {
+			return nil, err
+		}
+		return &profilingClient{Client: client, profile: p}, nil
+	}
+}
+
+// profilingClient records the commands run on the machine in the profile of
+// the command.
+type profilingClient struct {
+	sshmachine.Client
+	profile *profile.Profile
+}
+
+func (c *profilingClient) Close() error {
+	return sshutil.Close(c.Client)
+}
+
+func (c *profilingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	started := time.Now()
+	stdOut, stdErr, err := c.Client.RunCommand(cmd)
+	c.profile.RecordRemoteCommand(cmd, time.Since(started), err)
+	return stdOut, stdErr, err
+}
@@ -14,35 +14,33 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
+package cctl
 
 import (
-	log "github.com/platform9/cctl/pkg/logrus"
+	"fmt"
 
+	log "github.com/platform9/cctl/pkg/logrus"
 	"github.com/spf13/cobra"
 )
 
-var outputFmt string
-
-// getCmd represents the get command
-var getCmd = &cobra.Command{
-	Use:   "get",
-	Short: "Display one or more resources",
+// promoteCmd represents the promote command
+var promoteCmd = &cobra.Command{
+	Use:   "promote",
+	Short: "Used to change the role of a resource",
 	Args:  cobra.MinimumNArgs(1),
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		InitState()
+		initState()
 		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
-		// Therefore LogLevel must be set in all the PersistentPreRuns
-		if err := log.SetLogLevelUsingString(LogLevel); err != nil {
-			log.Fatalf("Unable to parse log level %s", LogLevel)
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Printf("Unknown resource %q. Use --help to print available options", args[0])
+		fmt.Println("Promote called")
 	},
 }
 
 func init() {
-	rootCmd.AddCommand(getCmd)
-	getCmd.PersistentFlags().StringVar(&outputFmt, "o", "", "Output format yaml|json")
+	rootCmd.AddCommand(promoteCmd)
 }
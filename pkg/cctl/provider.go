@@ -14,24 +14,16 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
+package cctl
 
 import (
-	"fmt"
-
-	"github.com/spf13/cobra"
+	"github.com/platform9/cctl/pkg/util/provider"
 )
 
-var kubeconfigCmdGet = &cobra.Command{
-	Use:   "kubeconfig",
-	Short: "Get kubeconfig for cluster",
-	Run: func(cmd *cobra.Command, args []string) {
-		// Stub code
-		fmt.Println("Running get kubeconfig")
-	},
-}
+// providerCodec reads and writes the provider spec and status of the cluster
+// and machines.
+var providerCodec = provider.SSHCodec
 
-func init() {
-	getCmd.AddCommand(kubeconfigCmdGet)
-	kubeconfigCmdGet.Flags().String("file", "", "Specify the file to write kubeconfig to. If not specified, output on stdout")
-}
+// newActuator returns the actuator that provisions, upgrades, and
+// deprovisions machines.
+var newActuator provider.ActuatorBuilder = provider.NewSSHActuator
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/prune"
+)
+
+const (
+	secretKind             = "Secret"
+	provisionedMachineKind = "ProvisionedMachine"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Used to remove unused resources",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Prune called")
+	},
+}
+
+var stateCmdPrune = &cobra.Command{
+	Use:   "state",
+	Short: "Remove unused secrets and provisioned machines from the state",
+	Long: `Remove the objects in the state that nothing uses, and that are older than
+--older-than, so that the state does not grow over the life of the cluster.
+
+A secret is used if the cluster references it, a provisioned machine uses it
+as its SSH credential, or cctl uses it by name, e.g. the SSH credential and
+the admin kubeconfig. A provisioned machine is used if a machine is bound to
+it; an unused one is usually left by a machine that failed to be created.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		olderThan, err := prune.ParseAge(cmd.Flag("older-than").Value.String())
+		if err != nil {
+			log.Fatalf("Unable to parse `older-than`: %v", err)
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Fatalf("Unable to parse `dry-run`: %v", err)
+		}
+		objects, refs, err := stateObjectReferences()
+		if err != nil {
+			log.Fatalf("Unable to find the objects in use: %v", err)
+		}
+		unused := prune.Unused(objects, refs, time.Now().Add(-olderThan))
+		if len(unused) == 0 {
+			log.Println("Nothing to prune.")
+			return
+		}
+		for _, o := range unused {
+			if dryRun {
+				log.Printf("Would prune %s %q, created %s", o.Kind, o.Name, o.Created.Format(time.RFC3339))
+				continue
+			}
+			log.Printf("Pruning %s %q, created %s", o.Kind, o.Name, o.Created.Format(time.RFC3339))
+			switch o.Kind {
+			case secretKind:
+				err = state.KubeClient.CoreV1().Secrets(namespace).Delete(o.Name, &metav1.DeleteOptions{})
+			case provisionedMachineKind:
+				err = state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Delete(o.Name, &metav1.DeleteOptions{})
+			}
+			if err != nil {
+				log.Fatalf("Unable to delete %s %q: %v", o.Kind, o.Name, err)
+			}
+		}
+		if dryRun {
+			return
+		}
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		log.Printf("Pruned %d objects.", len(unused))
+	},
+}
+
+// stateObjectReferences returns the secrets and provisioned machines in the
+// state, and those that are in use.
+func stateObjectReferences() ([]prune.Object, prune.References, error) {
+	refs := prune.References{}
+	for _, name := range []string{
+		common.DefaultSSHCredentialSecretName,
+		common.DefaultBastionSSHCredentialSecretName,
+		common.DefaultAdminConfigSecretName,
+		common.DefaultBootstrapTokenSecretName,
+		common.DefaultCommonCASecretName,
+		common.DefaultEncryptionKeysSecretName,
+	} {
+		refs.Add(secretKind, name)
+	}
+	clusterList, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list clusters: %v", err)
+	}
+	for _, cluster := range clusterList.Items {
+		cspec, err := providerCodec.GetClusterSpec(cluster)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode cluster %q spec: %v", cluster.Name, err)
+		}
+		for _, ref := range []*corev1.LocalObjectReference{
+			cspec.EtcdCASecret,
+			cspec.APIServerCASecret,
+			cspec.FrontProxyCASecret,
+			cspec.ServiceAccountKeySecret,
+			cspec.BootstrapTokenSecret,
+		} {
+			if ref != nil {
+				refs.Add(secretKind, ref.Name)
+			}
+		}
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	for _, machine := range machineList.Items {
+		machineSpec, err := providerCodec.GetMachineSpec(machine)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode machine %q spec: %v", machine.Name, err)
+		}
+		refs.Add(provisionedMachineKind, machineSpec.ProvisionedMachineName)
+	}
+
+	var objects []prune.Object
+	pmList, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list provisioned machines: %v", err)
+	}
+	for _, pm := range pmList.Items {
+		objects = append(objects, prune.Object{Kind: provisionedMachineKind, Name: pm.Name, Created: pm.CreationTimestamp.Time})
+		// The SSH credential of a provisioned machine that is pruned now is
+		// pruned the next time, if nothing else uses it.
+		if pm.Spec.SSHConfig != nil {
+			refs.Add(secretKind, pm.Spec.SSHConfig.CredentialSecret.Name)
+		}
+	}
+	secretList, err := state.KubeClient.CoreV1().Secrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to list secrets: %v", err)
+	}
+	for _, secret := range secretList.Items {
+		objects = append(objects, prune.Object{Kind: secretKind, Name: secret.Name, Created: secret.CreationTimestamp.Time})
+	}
+	return objects, refs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+	pruneCmd.AddCommand(stateCmdPrune)
+	stateCmdPrune.Flags().String("older-than", "90d", "Only prune objects created longer ago than this, e.g. 90d or 36h")
+	stateCmdPrune.Flags().Bool("dry-run", false, "Show the objects that would be pruned, without removing them")
+}
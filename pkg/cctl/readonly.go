@@ -0,0 +1,151 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+)
+
+// readOnlyEnvVar enables read-only mode when set to true, e.g. in the shell
+// profile of auditors.
+const readOnlyEnvVar = "CCTL_READ_ONLY"
+
+// readOnly prevents any command that can change the cluster, the machines, or
+// the state from running.
+var readOnly bool
+
+// readOnlyCommands are the commands that change neither the cluster, the
+// machines, nor the state. Every other command is refused in read-only mode.
+var readOnlyCommands = map[string]bool{
+	"cctl":                          true,
+	"cctl help":                     true,
+	"cctl version":                  true,
+	"cctl completion":               true,
+	"cctl __complete-machine-ips":   true,
+	"cctl get":                      true,
+	"cctl get cluster":              true,
+	"cctl get machine":              true,
+	"cctl get kubeconfig":           true,
+	"cctl get nodes":                true,
+	"cctl bundle download":          true,
+	"cctl status":                   true,
+	"cctl status certificates":      true,
+	"cctl status machine":           true,
+	"cctl status vip":               true,
+	"cctl plan":                     true,
+	"cctl diagnose":                 true,
+	"cctl discover":                 true,
+	"cctl discover machines":        true,
+	"cctl render":                   true,
+	"cctl render cronjobs":          true,
+	"cctl render command-allowlist": true,
+	"cctl wait":                     true,
+	"cctl wait cluster":             true,
+	"cctl wait machine":             true,
+	"cctl schema":                   true,
+	"cctl validate":                 true,
+	"cctl get operations":           true,
+	"cctl state":                    true,
+	"cctl state diff":               true,
+	"cctl doctor":                   true,
+	"cctl export":                   true,
+	"cctl state verify":             true,
+	"cctl state list-backups":       true,
+}
+
+// recordingCommands are read-only commands that record what they observe in
+// the state, e.g. the reachability of the machines. In read-only mode they
+// record nothing; otherwise they change the state, and hold the operation
+// lease like any command that can change it.
+var recordingCommands = map[string]bool{
+	"cctl status":         true,
+	"cctl status machine": true,
+}
+
+// mutatingFlags are flags that make a read-only command change something.
+var mutatingFlags = map[string][]string{
+	"cctl status vip":   {"reconcile"},
+	"cctl state verify": {"repair"},
+}
+
+// defaultReadOnly returns the value of the read-only environment variable.
+func defaultReadOnly() bool {
+	v, err := strconv.ParseBool(os.Getenv(readOnlyEnvVar))
+	return err == nil && v
+}
+
+// guardReadOnly makes every command verify, before it runs, that it is
+// allowed in read-only mode. The check runs in the persistent pre-run, which
+// reads the state, and again in the run, for commands without one.
+func guardReadOnly(cmd *cobra.Command) {
+	if preRun := cmd.PersistentPreRun; preRun != nil {
+		cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+			mustBeAllowedInReadOnlyMode(cmd)
+			preRun(cmd, args)
+		}
+	}
+	if run := cmd.Run; run != nil {
+		cmd.Run = func(cmd *cobra.Command, args []string) {
+			mustBeAllowedInReadOnlyMode(cmd)
+			run(cmd, args)
+		}
+	}
+	for _, c := range cmd.Commands() {
+		guardReadOnly(c)
+	}
+}
+
+func mustBeAllowedInReadOnlyMode(cmd *cobra.Command) {
+	if !readOnly {
+		return
+	}
+	path := cmd.CommandPath()
+	if !readOnlyCommands[path] {
+		log.Fatalf("%q can change the cluster or the state, and is not allowed in read-only mode", path)
+	}
+	for _, name := range mutatingFlags[path] {
+		if f := cmd.Flags().Lookup(name); f != nil && changedToTrue(f) {
+			log.Fatalf("%q with --%s can change the cluster or the state, and is not allowed in read-only mode", path, name)
+		}
+	}
+}
+
+// canChange returns true if the command, with its flags, can change the
+// cluster, the machines, or the state outside read-only mode.
+func canChange(cmd *cobra.Command) bool {
+	path := cmd.CommandPath()
+	if !readOnlyCommands[path] || recordingCommands[path] {
+		return true
+	}
+	for _, name := range mutatingFlags[path] {
+		if f := cmd.Flags().Lookup(name); f != nil && changedToTrue(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func changedToTrue(f *pflag.Flag) bool {
+	v, err := strconv.ParseBool(f.Value.String())
+	return f.Changed && (err != nil || v)
+}
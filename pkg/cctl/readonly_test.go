@@ -0,0 +1,47 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCanChange(t *testing.T) {
+	for _, tc := range []struct {
+		cmd       *cobra.Command
+		readOnly  bool
+		canChange bool
+	}{
+		{getCmd, true, false},
+		{machineCmdGet, true, false},
+		{certificatesCmdStatus, true, false},
+		// The status commands record the reachability of the machines.
+		{statusCmd, true, true},
+		{machineCmdStatus, true, true},
+		{rotateCmd, false, true},
+	} {
+		path := tc.cmd.CommandPath()
+		if readOnlyCommands[path] != tc.readOnly {
+			t.Errorf("expected %q to be allowed in read-only mode: %v", path, tc.readOnly)
+		}
+		if actual := canChange(tc.cmd); actual != tc.canChange {
+			t.Errorf("expected canChange(%q) to be %v, found %v", path, tc.canChange, actual)
+		}
+	}
+}
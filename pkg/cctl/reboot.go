@@ -0,0 +1,256 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/operror"
+)
+
+// bootIDFile changes on every boot, so that a reboot is told apart from a
+// machine that was still reachable.
+const bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+// rebootCmd represents the reboot command
+var rebootCmd = &cobra.Command{
+	Use:   "reboot",
+	Short: "Used to reboot a resource safely",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Reboot called")
+	},
+}
+
+var machineCmdReboot = &cobra.Command{
+	Use:   "machine",
+	Short: "Drain a machine, reboot it, and return it to service",
+	Long: `Reboot a machine safely: drain its node, reboot it, wait for it to boot and be
+reachable over SSH, wait for its node to be Ready, and uncordon it.
+
+Before a master or etcd machine is rebooted, its etcd cluster must keep quorum
+without its member, and the member must be healthy again after the reboot.
+Before a master is rebooted, keepalived must be active on another master, so
+that the VIP fails over to it; after the reboot, its API server must be
+healthy. The machine is not rebooted if a check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse `timeout`: %v", err)
+		}
+		machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get machine %q: %v", ip, err)
+		}
+		if err := rebootMachine(machine, timeout); err != nil {
+			log.Fatalf("Unable to reboot machine %q: %v", ip, err)
+		}
+		log.Printf("Machine %q rebooted successfully.", ip)
+	},
+}
+
+// rebootMachine drains the node of the machine, reboots it, waits for it and
+// its components to return, and uncordons the node.
+func rebootMachine(machine *clusterv1.Machine, timeout time.Duration) error {
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	isMaster := clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles)
+	if clusterapi.RunsEtcd(*machine) {
+		log.Println("Checking etcd cluster health")
+		health, err := etcdEndpointHealth(client)
+		if err != nil {
+			return fmt.Errorf("unable to check etcd cluster health: %v", err)
+		}
+		machineStatus, err := providerCodec.GetMachineStatus(*machine)
+		if err != nil {
+			return fmt.Errorf("unable to get machine %q status: %v", machine.Name, err)
+		}
+		var clientURLs []string
+		if machineStatus.EtcdMember != nil {
+			clientURLs = machineStatus.EtcdMember.ClientURLs
+		}
+		if !health.SafeToRemoveMember(clientURLs) {
+			return operror.New(operror.Precondition, "not rebooting machine %q: the etcd cluster would lose quorum while it reboots. Healthy members: %v, unhealthy members: %v", machine.Name, health.Healthy, health.Unhealthy)
+		}
+	}
+	if isMaster {
+		if err := rebootMustKeepVIP(machine, client); err != nil {
+			return err
+		}
+	}
+	var nodeName string
+	if clusterapi.HasNode(*machine) {
+		if nodeName, err = nodeNameForMachine(machine.Name, client); err != nil {
+			return fmt.Errorf("unable to identify node: %v", err)
+		}
+		if len(nodeName) == 0 {
+			return fmt.Errorf("no node found for machine %q", machine.Name)
+		}
+		log.Printf("Draining node %q", nodeName)
+		if err := drainNode(nodeName, client); err != nil {
+			return fmt.Errorf("unable to drain node %q: %v", nodeName, err)
+		}
+	}
+	bootID, err := readBootID(client)
+	if err != nil {
+		return err
+	}
+	machineOS, err := hostOSForMachine(machine, client)
+	if err != nil {
+		return fmt.Errorf("unable to detect operating system: %v", err)
+	}
+	cmd := machineOS.RebootCommand()
+	log.Printf("Running %q", cmd)
+	if stdOut, stdErr, err := client.RunCommand(cmd); err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	deadline := time.Now().Add(timeout)
+	log.Printf("Waiting for machine %q to boot", machine.Name)
+	if client, err = waitForReboot(machine, bootID, deadline); err != nil {
+		return err
+	}
+	if isMaster {
+		log.Printf("Waiting for the API server of machine %q to be healthy", machine.Name)
+		if err := waitForAPIServerHealthy(client, deadline.Sub(time.Now())); err != nil {
+			return err
+		}
+	}
+	if clusterapi.RunsEtcd(*machine) {
+		log.Printf("Waiting for the etcd cluster to be healthy")
+		if err := waitForEtcdHealthy(client, deadline.Sub(time.Now())); err != nil {
+			return err
+		}
+	}
+	if len(nodeName) == 0 {
+		return nil
+	}
+	log.Printf("Waiting for the node of machine %q to be Ready", machine.Name)
+	if err := waitForNodeReady(machine.Name, client, deadline); err != nil {
+		return err
+	}
+	if err := uncordonNode(nodeName, client); err != nil {
+		return fmt.Errorf("unable to uncordon node %q: %v", nodeName, err)
+	}
+	return nil
+}
+
+// rebootMustKeepVIP verifies that keepalived is active on another master, so
+// that the VIP, if the cluster has one, fails over while the master reboots.
+func rebootMustKeepVIP(machine *clusterv1.Machine, client sshmachine.Client) error {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if clusterSpec.VIPConfiguration == nil {
+		log.Warnf("The cluster has no VIP; the API server is unavailable while master %q reboots", machine.Name)
+		return nil
+	}
+	masters, err := masterMachines()
+	if err != nil {
+		return err
+	}
+	var standbys []string
+	for i := range masters {
+		if masters[i].Name == machine.Name {
+			continue
+		}
+		masterClient, err := machineClientForMachine(&masters[i])
+		if err != nil {
+			log.Warnf("Unable to create machine client for machine %q: %v", masters[i].Name, err)
+			continue
+		}
+		if serviceState(common.KeepalivedService, masterClient) == "active" {
+			standbys = append(standbys, masters[i].Name)
+		}
+	}
+	if len(standbys) == 0 {
+		return operror.New(operror.Precondition, "not rebooting master %q: keepalived is not active on any other master, so VIP %s would be unavailable", machine.Name, clusterSpec.VIPConfiguration.IP)
+	}
+	if ownsIP(clusterSpec.VIPConfiguration.IP, client) {
+		log.Printf("VIP %s will fail over from master %q to one of %s", clusterSpec.VIPConfiguration.IP, machine.Name, strings.Join(standbys, ", "))
+	}
+	return nil
+}
+
+func readBootID(client sshmachine.Client) (string, error) {
+	cmd := "cat " + bootIDFile
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return strings.TrimSpace(string(stdOut)), nil
+}
+
+// waitForReboot waits until the machine is reachable with a boot ID other than
+// bootID, and returns a client connected after the reboot.
+func waitForReboot(machine *clusterv1.Machine, bootID string, deadline time.Time) (sshmachine.Client, error) {
+	for {
+		client, err := machineClientForMachine(machine)
+		if err == nil {
+			var id string
+			if id, err = readBootID(client); err == nil && id != bootID {
+				return client, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("machine is not reachable: %v", err)
+			}
+			return nil, fmt.Errorf("machine did not reboot")
+		}
+		time.Sleep(rotatePollInterval)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(rebootCmd)
+	rebootCmd.AddCommand(machineCmdReboot)
+	machineCmdReboot.Flags().String("ip", "", "IP of the machine")
+	machineCmdReboot.MarkFlagRequired("ip")
+	machineCmdReboot.Flags().Duration("timeout", 15*time.Minute, "How long to wait for the machine to boot, and for its node and components to be healthy")
+	machineCmdReboot.Flags().DurationVar(&drainTimeout, "drain-timeout", common.DrainTimeout, "The length of time to wait before giving up, zero means infinite")
+	machineCmdReboot.Flags().IntVar(&drainGracePeriodSeconds, "drain-grace-period", common.DrainGracePeriodSeconds, "Period of time in seconds given to each pod to terminate gracefully. If negative, the default value specified in the pod will be used.")
+	machineCmdReboot.Flags().BoolVar(&drainDeleteLocalData, "drain-delete-local-data", common.DrainDeleteLocalData, "Continue even if there are pods using emptyDir (local data that will be deleted when the node is drained).")
+	machineCmdReboot.Flags().BoolVar(&drainForce, "drain-force", common.DrainForce, "Continue even if there are pods not managed by a ReplicationController, ReplicaSet, Job, DaemonSet or StatefulSet.")
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/kubelet"
+	"github.com/platform9/cctl/pkg/util/reconcile"
+)
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile",
+	Short: "Re-apply the configuration in the state to the cluster",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+}
+
+var machineCmdReconcile = &cobra.Command{
+	Use:   "machine",
+	Short: "Re-apply the configuration of machines that does not require a drain",
+	Long: `Re-apply the configuration of machines in the state that can be applied
+without draining their nodes, and report the changes that cannot.
+
+Applied without a drain:
+  labels          the labels of the machine missing from its node are added.
+  kubelet-config  the kubelet configuration overrides of the machine are
+                  merged into the kubelet configuration, and the kubelet is
+                  restarted; running pods are not affected.
+
+Reported as pending, because they require a disruptive rollout:
+  kubelet-config      overrides that change how the kubelet manages the
+                      containers of running pods, e.g. cpuManagerPolicy or
+                      cgroupDriver. No overrides are applied until the
+                      machine is replaced.
+  taints              taints of the machine missing from its node; the node
+                      is registered with its taints, so the machine must be
+                      replaced.
+  component-versions  versions that differ from those of this cctl; use
+                      upgrade machine, which drains the node.
+
+Use --dry-run to report the changes without applying any. The report is
+printed as text, or as JSON or YAML with -o.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ips, err := cmd.Flags().GetStringSlice("ip")
+		if err != nil {
+			log.Fatalf("Unable to parse `ip` flag: %v", err)
+		}
+		if len(ips) == 0 {
+			log.Fatalf("Must use --ip.")
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Fatalf("Unable to parse `dry-run` flag: %v", err)
+		}
+		format := cmd.Flag("output").Value.String()
+		if format != "" && format != "json" && format != "yaml" {
+			log.Fatalf("Unsupported output format %q", format)
+		}
+		changes := []reconcile.Change{}
+		for _, ip := range ips {
+			machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+			if err != nil {
+				log.Fatalf("Unable to get machine %q: %v", ip, err)
+			}
+			machineChanges, err := reconcileMachine(machine, dryRun)
+			if err != nil {
+				log.Fatalf("Unable to reconcile machine %q: %v", ip, err)
+			}
+			changes = append(changes, machineChanges...)
+		}
+		switch format {
+		case "yaml":
+			bytes, err := yaml.Marshal(changes)
+			if err != nil {
+				log.Fatalf("Unable to marshal changes to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(changes)
+			if err != nil {
+				log.Fatalf("Unable to marshal changes to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		default:
+			t := template.Must(template.New("ReconcilePrintTemplate").Parse(common.ReconcilePrintTemplate))
+			if err := t.Execute(os.Stdout, changes); err != nil {
+				log.Fatalf("Could not pretty print changes: %s", err)
+			}
+		}
+	},
+}
+
+// reconcileMachine applies the changes to the configuration of the machine
+// that do not require its node to be drained, unless dryRun is true, and
+// returns every change, including those it does not apply.
+func reconcileMachine(machine *clusterv1.Machine, dryRun bool) ([]reconcile.Change, error) {
+	var changes []reconcile.Change
+	nonDisruptive := func(kind, detail string) {
+		status := reconcile.StatusApplied
+		if dryRun {
+			status = reconcile.StatusPlanned
+		}
+		changes = append(changes, reconcile.Change{Machine: machine.Name, Kind: kind, Detail: detail, Status: status})
+	}
+	pending := func(kind, detail, remedy string) {
+		changes = append(changes, reconcile.Change{Machine: machine.Name, Kind: kind, Detail: detail, Disruptive: true, Remedy: remedy, Status: reconcile.StatusPending})
+	}
+	replaceRemedy := fmt.Sprintf("replace machine --old-ip %s --new-ip <ip>", machine.Name)
+
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	if required, upgrade := isUpgradeRequired(machineSpec.ComponentVersions, getGoalComponentVersions()); required {
+		pending(reconcile.KindComponentVersions, strings.Join(upgradedComponents(upgrade), ", ")+" differ from the versions of this cctl", fmt.Sprintf("upgrade machine --ip %s", machine.Name))
+	}
+	// Etcd machines have no node, and no kubelet.
+	if isEtcdMachine(machine) {
+		return changes, nil
+	}
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create machine client: %v", err)
+	}
+
+	node, err := nodeOfMachine(machine, client)
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		log.Printf("No cluster node found for machine %q. Skipping its labels and taints.", machine.Name)
+	} else {
+		if missing := reconcile.MissingLabels(machine.Spec.Labels, node.Labels); len(missing) != 0 {
+			nonDisruptive(reconcile.KindLabels, strings.Join(missing, ","))
+			if !dryRun {
+				if err := labelNodeForMachine(machine, machine.Spec.Labels, client); err != nil {
+					return nil, fmt.Errorf("unable to label the node: %v", err)
+				}
+			}
+		}
+		if missing := reconcile.MissingTaints(machine.Spec.Taints, node.Spec.Taints); len(missing) != 0 {
+			pending(reconcile.KindTaints, strings.Join(missing, ","), replaceRemedy)
+		}
+	}
+
+	o, err := kubeletConfigOverrides(machine)
+	if err != nil {
+		return nil, err
+	}
+	if o != nil {
+		config, err := client.ReadFile(common.KubeletConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %q: %v", common.KubeletConfigFile, err)
+		}
+		changed, disruptive, err := kubelet.ChangedFields(config, o)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(disruptive) != 0:
+			pending(reconcile.KindKubeletConfig, strings.Join(disruptive, ",")+" cannot be changed by restarting the kubelet", replaceRemedy)
+		case len(changed) != 0:
+			nonDisruptive(reconcile.KindKubeletConfig, strings.Join(changed, ","))
+			if !dryRun {
+				if err := applyKubeletConfigOverrides(machine, client); err != nil {
+					return nil, fmt.Errorf("unable to apply kubelet configuration overrides: %v", err)
+				}
+			}
+		}
+	}
+	return changes, nil
+}
+
+// nodeOfMachine returns the cluster node of the machine, or nil if it has
+// none.
+func nodeOfMachine(machine *clusterv1.Machine, client sshmachine.Client) (*corev1.Node, error) {
+	nodeName, err := nodeNameForMachine(machine.Name, client)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get node name: %v", err)
+	}
+	if len(nodeName) == 0 {
+		return nil, nil
+	}
+	// The kubelet kubeconfig can get the node of the kubelet.
+	cmd := fmt.Sprintf("%s --kubeconfig=%s get node %s -ojson", common.KubectlFile, common.KubeletKubeconfig, nodeName)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	var node corev1.Node
+	if err := json.Unmarshal(stdOut, &node); err != nil {
+		return nil, fmt.Errorf("unable to decode node %q: %v", nodeName, err)
+	}
+	return &node, nil
+}
+
+// upgradedComponents returns the names of the components that the upgrade
+// changes.
+func upgradedComponents(upgrade UpgradeRequired) []string {
+	var names []string
+	for _, c := range []struct {
+		name     string
+		upgraded bool
+	}{
+		{"nodeadm", upgrade.NodeadmVersion},
+		{"etcdadm", upgrade.EtcdadmVersion},
+		{"kubernetes", upgrade.KubernetesVersion},
+		{"cni", upgrade.CNIVersion},
+		{"flannel", upgrade.FlannelVersion},
+		{"keepalived", upgrade.KeepalivedVersion},
+		{"etcd", upgrade.EtcdVersion},
+	} {
+		if c.upgraded {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+func init() {
+	rootCmd.AddCommand(reconcileCmd)
+	reconcileCmd.AddCommand(machineCmdReconcile)
+	machineCmdReconcile.Flags().StringSlice("ip", []string{}, "IPs of the machines. Provide a comma-separated list, or define multiple flags.")
+	machineCmdReconcile.Flags().Bool("dry-run", false, "Report the changes without applying any")
+	machineCmdReconcile.Flags().StringP("output", "o", "", "Output format yaml|json. Defaults to text")
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/objectmeta"
+)
+
+const (
+	cronJobStateVolume  = "state"
+	cronJobBackupVolume = "backups"
+	cronJobStateDir     = "/etc/cctl"
+	cronJobBackupDir    = "/var/lib/cctl/backups"
+)
+
+// cronJobOptions are used to render the CronJobs.
+type cronJobOptions struct {
+	image                string
+	jobNamespace         string
+	stateSecret          string
+	backupClaim          string
+	snapshotSchedule     string
+	certificatesSchedule string
+	backupSchedule       string
+}
+
+// renderCmd represents the render command
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Used to render manifests for the cluster",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Render called")
+	},
+}
+
+var cronJobsCmdRender = &cobra.Command{
+	Use:   "cronjobs",
+	Short: "Render CronJobs that periodically snapshot etcd, check certificate expiry, and back up the state",
+	Long: `Render Kubernetes CronJob manifests that run cctl in a container against this
+cluster. The jobs:
+
+  cctl-etcd-snapshot       Save an etcd snapshot to the backup volume.
+  cctl-certificate-expiry  Fail if a control plane certificate expires soon.
+  cctl-state-backup        Save an archive of the state and an etcd snapshot
+                           to the backup volume.
+
+The jobs read the state from a Secret, which must be created, and updated
+whenever the state changes, with:
+
+  kubectl -n <job-namespace> create secret generic <state-secret> --from-file=cctl-state.yaml=<state file>
+
+Snapshots and archives are written to a PersistentVolumeClaim, which must
+exist. The machines must be reachable over SSH from the pods.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts cronJobOptions
+		var err error
+		flags := map[string]*string{
+			"image":                 &opts.image,
+			"job-namespace":         &opts.jobNamespace,
+			"state-secret":          &opts.stateSecret,
+			"backup-claim":          &opts.backupClaim,
+			"snapshot-schedule":     &opts.snapshotSchedule,
+			"certificates-schedule": &opts.certificatesSchedule,
+			"backup-schedule":       &opts.backupSchedule,
+		}
+		for name, value := range flags {
+			if *value, err = cmd.Flags().GetString(name); err != nil {
+				log.Fatalf("Unable to parse --%s: %v", name, err)
+			}
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatalf("Unable to parse --output: %v", err)
+		}
+		masterIP, err := firstMasterIP()
+		if err != nil {
+			log.Fatalf("Unable to render cronjobs: %v", err)
+		}
+		manifests, err := renderCronJobs(opts, masterIP)
+		if err != nil {
+			log.Fatalf("Unable to render cronjobs: %v", err)
+		}
+		if len(output) == 0 {
+			os.Stdout.Write(manifests)
+			return
+		}
+		if err := ioutil.WriteFile(output, manifests, 0644); err != nil {
+			log.Fatalf("Unable to write %q: %v", output, err)
+		}
+		log.Printf("[render] Wrote cronjobs to %q", output)
+	},
+}
+
+// firstMasterIP returns the IP of the first master in the state. Snapshots
+// are taken from this master.
+func firstMasterIP() (string, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("unable to list machines: %v", err)
+	}
+	for _, m := range machineList.Items {
+		if clusterutil.RoleContains(clustercommon.MasterRole, m.Spec.Roles) {
+			return m.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no masters found")
+}
+
+// renderCronJobs returns the CronJob manifests as a multi-document YAML.
+func renderCronJobs(opts cronJobOptions, masterIP string) ([]byte, error) {
+	statePath := path.Join(cronJobStateDir, common.CronJobStateSecretKey)
+	cctl := fmt.Sprintf("cctl --state %s --namespace %s", statePath, namespace)
+	snapshotPath := path.Join(cronJobBackupDir, "etcd-snapshot-$(date +%Y%m%d%H%M%S).db")
+	archivePath := path.Join(cronJobBackupDir, "cctl-backup-$(date +%Y%m%d%H%M%S).tgz")
+	tmpSnapshotPath := "/tmp/etcd-snapshot.db"
+
+	cronJobs := []*batchv1beta1.CronJob{
+		newCronJob(opts, "cctl-etcd-snapshot", opts.snapshotSchedule,
+			fmt.Sprintf("%s snapshot etcd --ip %s --snapshot %s", cctl, masterIP, snapshotPath)),
+		newCronJob(opts, "cctl-certificate-expiry", opts.certificatesSchedule,
+			fmt.Sprintf("%s status certificates", cctl)),
+		newCronJob(opts, "cctl-state-backup", opts.backupSchedule,
+			fmt.Sprintf("%s snapshot etcd --ip %s --snapshot %s && %s backup --snapshot %s --archive %s", cctl, masterIP, tmpSnapshotPath, cctl, tmpSnapshotPath, archivePath)),
+	}
+	var manifests [][]byte
+	for _, cronJob := range cronJobs {
+		objectmeta.Stamp(cronJob, objectLabels, objectAnnotations)
+		b, err := yaml.Marshal(cronJob)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal cronjob %q: %v", cronJob.Name, err)
+		}
+		manifests = append(manifests, b)
+	}
+	return bytes.Join(manifests, []byte("---\n")), nil
+}
+
+// newCronJob returns a CronJob that runs the shell command in the cctl image,
+// with the state and backup volumes mounted.
+func newCronJob(opts cronJobOptions, name, schedule, command string) *batchv1beta1.CronJob {
+	var backoffLimit int32
+	return &batchv1beta1.CronJob{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "CronJob",
+			APIVersion: "batch/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opts.jobNamespace,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:          schedule,
+			ConcurrencyPolicy: batchv1beta1.ForbidConcurrent,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					BackoffLimit: &backoffLimit,
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							RestartPolicy: corev1.RestartPolicyNever,
+							Containers: []corev1.Container{
+								{
+									Name:    "cctl",
+									Image:   opts.image,
+									Command: []string{"/bin/sh", "-c", command},
+									VolumeMounts: []corev1.VolumeMount{
+										{Name: cronJobStateVolume, MountPath: cronJobStateDir, ReadOnly: true},
+										{Name: cronJobBackupVolume, MountPath: cronJobBackupDir},
+									},
+								},
+							},
+							Volumes: []corev1.Volume{
+								{
+									Name: cronJobStateVolume,
+									VolumeSource: corev1.VolumeSource{
+										Secret: &corev1.SecretVolumeSource{SecretName: opts.stateSecret},
+									},
+								},
+								{
+									Name: cronJobBackupVolume,
+									VolumeSource: corev1.VolumeSource{
+										PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: opts.backupClaim},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+	renderCmd.AddCommand(cronJobsCmdRender)
+	cronJobsCmdRender.Flags().String("image", "", "Image that contains cctl and a shell")
+	cronJobsCmdRender.MarkFlagRequired("image")
+	cronJobsCmdRender.Flags().String("job-namespace", common.DefaultCronJobNamespace, "Namespace of the cronjobs")
+	cronJobsCmdRender.Flags().String("state-secret", common.DefaultCronJobStateSecretName, fmt.Sprintf("Secret that holds the state file in the key %q", common.CronJobStateSecretKey))
+	cronJobsCmdRender.Flags().String("backup-claim", common.DefaultCronJobBackupClaimName, "PersistentVolumeClaim that snapshots and archives are written to")
+	cronJobsCmdRender.Flags().String("snapshot-schedule", "0 */6 * * *", "Cron schedule of the etcd snapshot job")
+	cronJobsCmdRender.Flags().String("certificates-schedule", "0 8 * * *", "Cron schedule of the certificate expiry job")
+	cronJobsCmdRender.Flags().String("backup-schedule", "0 2 * * *", "Cron schedule of the state backup job")
+	cronJobsCmdRender.Flags().StringP("output", "o", "", "File to write the manifests to. Defaults to stdout")
+}
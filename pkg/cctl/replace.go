@@ -0,0 +1,219 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+// replaceCmd represents the replace command
+var replaceCmd = &cobra.Command{
+	Use:   "replace",
+	Short: "Used to replace a resource with a new one",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Replace called")
+	},
+}
+
+var machineCmdReplace = &cobra.Command{
+	Use:   "machine",
+	Short: "Replace a machine with a new one that has the same role",
+	Long: `Replace a machine with a new one that has the same role. The new machine is
+created, and once its node is Ready, and, for a master, its etcd member has
+joined the cluster and is healthy, the old machine is drained and deleted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		oldIP := cmd.Flag("old-ip").Value.String()
+		newIP := cmd.Flag("new-ip").Value.String()
+		if len(oldIP) == 0 || len(newIP) == 0 {
+			log.Fatalf("Must give both --old-ip and --new-ip.")
+		}
+		if oldIP == newIP {
+			log.Fatalf("The old and new machine must be different.")
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Unable to parse `port` flag: %v", err)
+		}
+		iface := cmd.Flag("iface").Value.String()
+		publicKeyFiles, err := cmd.Flags().GetStringSlice("public-keys")
+		if err != nil {
+			log.Fatalf("Unable to parse `public-keys` flag: %v", err)
+		}
+		timeout, err := cmd.Flags().GetDuration("ready-timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse `ready-timeout` flag: %v", err)
+		}
+
+		oldMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(oldIP, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get machine %q: %v", oldIP, err)
+		}
+		if len(oldMachine.Spec.Roles) != 1 {
+			log.Fatalf("Machine %q has roles %v; only a machine with exactly one role can be replaced.", oldIP, oldMachine.Spec.Roles)
+		}
+		role := oldMachine.Spec.Roles[0]
+		if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(newIP, metav1.GetOptions{}); err == nil {
+			log.Fatalf("Machine %q already exists.", newIP)
+		} else if !apierrors.IsNotFound(err) {
+			log.Fatalf("Unable to get machine %q: %v", newIP, err)
+		}
+		oldMachineSpec, err := providerCodec.GetMachineSpec(*oldMachine)
+		if err != nil {
+			log.Fatalf("Unable to decode machine %q spec: %v", oldIP, err)
+		}
+		oldProvisionedMachine, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(oldMachineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get provisioned machine %q: %v", oldMachineSpec.ProvisionedMachineName, err)
+		}
+		// By default, the new machine is reached, and binds keepalived, the
+		// same way as the old one.
+		if port == 0 {
+			port = oldProvisionedMachine.Spec.SSHConfig.Port
+		}
+		if len(iface) == 0 {
+			iface = oldProvisionedMachine.Spec.VIPNetworkInterface
+		}
+		if role == clustercommon.MasterRole {
+			if err := replaceMasterMustHaveVIP(); err != nil {
+				log.Fatalf("Unable to replace machine %q: %v", oldIP, err)
+			}
+		}
+
+		log.Printf("Creating machine %q to replace machine %q", newIP, oldIP)
+		if err := createMachine(newIP, port, iface, string(role), publicKeyFiles); err != nil {
+			log.Fatalf("Unable to create machine %q: %v", newIP, err)
+		}
+
+		newMachine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(newIP, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get machine %q: %v", newIP, err)
+		}
+		if err := waitForReplacementReady(newMachine, timeout); err != nil {
+			log.Fatalf("Not deleting machine %q: new machine %q is not ready: %v", oldIP, newIP, err)
+		}
+
+		log.Printf("Deleting machine %q", oldIP)
+		if err := deleteMachine(oldIP, false, false); err != nil {
+			log.Fatalf("Unable to delete machine %q: %v", oldIP, err)
+		}
+		log.Printf("Machine %q replaced by machine %q successfully.", oldIP, newIP)
+	},
+}
+
+// replaceMasterMustHaveVIP verifies that the cluster has a VIP. Without one,
+// the cluster can have only one master, and it cannot be replaced in place.
+func replaceMasterMustHaveVIP() error {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	cspec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if cspec.VIPConfiguration == nil {
+		return fmt.Errorf("the cluster has no VIP configured, so it cannot have a second master")
+	}
+	return nil
+}
+
+// waitForReplacementReady waits until the node of the machine, if it has one,
+// is Ready and, if the machine runs an etcd member, the member is in the
+// cluster and every member is healthy.
+func waitForReplacementReady(machine *clusterv1.Machine, timeout time.Duration) error {
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client for machine %q: %v", machine.Name, err)
+	}
+	deadline := time.Now().Add(timeout)
+	if !isEtcdMachine(machine) {
+		log.Printf("Waiting for the node of machine %q to be Ready", machine.Name)
+		if err := waitForNodeReady(machine.Name, client, deadline); err != nil {
+			return err
+		}
+	}
+	if !clusterapi.RunsEtcd(*machine) {
+		return nil
+	}
+	log.Printf("Waiting for the etcd member of machine %q to be healthy", machine.Name)
+	machineStatus, err := providerCodec.GetMachineStatus(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to get machine %q status: %v", machine.Name, err)
+	}
+	if machineStatus.EtcdMember == nil {
+		return fmt.Errorf("machine %q has no etcd member", machine.Name)
+	}
+	remaining := time.Until(deadline)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return waitForEtcdHealthy(client, remaining)
+}
+
+// waitForNodeReady waits until the node of the machine reports that it is
+// Ready, or the deadline passes.
+func waitForNodeReady(machineName string, client sshmachine.Client, deadline time.Time) error {
+	for {
+		nodeName, err := nodeNameForMachine(machineName, client)
+		if err == nil && len(nodeName) != 0 && nodeReadyCondition(nodeName, client) == "True" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("unable to identify node: %v", err)
+			}
+			if len(nodeName) == 0 {
+				return fmt.Errorf("no node found for machine %q", machineName)
+			}
+			return fmt.Errorf("node %q is not Ready", nodeName)
+		}
+		time.Sleep(rotatePollInterval)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(replaceCmd)
+	replaceCmd.AddCommand(machineCmdReplace)
+	machineCmdReplace.Flags().String("old-ip", "", "IP of the machine to replace")
+	machineCmdReplace.Flags().String("new-ip", "", "IP of the new machine")
+	machineCmdReplace.Flags().Int("port", 0, "SSH port of the new machine (default: the port of the old machine)")
+	machineCmdReplace.Flags().String("iface", "", ifaceFlagUsage+" (default: the interface of the old machine)")
+	machineCmdReplace.Flags().StringSlice("public-keys", []string{}, "The new machine's SSH public keys. Provide a comma-separated list, or define multiple flags.")
+	machineCmdReplace.Flags().Duration("ready-timeout", common.DefaultReplaceReadyTimeout, "How long to wait for the new machine to be ready before giving up, without deleting the old machine")
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/events"
+	"github.com/platform9/cctl/pkg/util/report"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+const reportFlagUsage = `Write a JSON report of the operation when it completes. Use "-" for stdout, an http(s) URL to POST the report, or a file path`
+
+const eventsFlagUsage = `Stream the progress of the operation, as each phase starts and ends, in JSON Lines format. Use "-" for stdout, or a file path to append to`
+
+var (
+	// operationReport records the operation run by the command, if the user
+	// asked for a report.
+	operationReport     *report.Report
+	operationReportSink report.Sink
+	// operationEvents streams the progress of the operation, if the user
+	// asked for events.
+	operationEvents     *events.Stream
+	operationEventsFile *os.File
+)
+
+// startOperationReport starts recording the operation on the machines, if the
+// --report flag is set, and streaming its events, if the --events flag is set.
+// Progress messages become phases, and error messages fail the current phase.
+// The report is written, and the event stream ends, when
+// finishOperationReport is called, or when the command exits with a fatal
+// error.
+func startOperationReport(cmd *cobra.Command, operation string, machines []string) {
+	target, err := cmd.Flags().GetString("report")
+	if err != nil {
+		log.Fatalf("Unable to parse `report` flag: %v", err)
+	}
+	eventsTarget, err := cmd.Flags().GetString("events")
+	if err != nil {
+		log.Fatalf("Unable to parse `events` flag: %v", err)
+	}
+	if len(target) == 0 && len(eventsTarget) == 0 {
+		return
+	}
+	if len(target) != 0 {
+		operationReportSink, err = report.NewSink(target, os.Stdout)
+		if err != nil {
+			log.Fatalf("Unable to create report sink: %v", err)
+		}
+		operationReport = report.New(operation, machines)
+	}
+	if len(eventsTarget) != 0 {
+		w := os.Stdout
+		if eventsTarget != "-" {
+			operationEventsFile, err = os.OpenFile(eventsTarget, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				log.Fatalf("Unable to open events file: %v", err)
+			}
+			w = operationEventsFile
+		}
+		operationEvents = events.New(w, operation, machines)
+	}
+	log.AddHook(reportHook{})
+	log.RegisterExitHandler(func() {
+		finishOperationReport(nil)
+	})
+}
+
+// finishOperationReport records the final state of the machines and writes
+// the report, and ends the event stream. It does nothing if no report or
+// event stream was started, or they were already finished.
+func finishOperationReport(err error) {
+	finishOperationEvents(err)
+	r := operationReport
+	if r == nil {
+		return
+	}
+	operationReport = nil
+	for _, name := range r.Machines {
+		for _, obj := range machineObjects(name) {
+			r.AddObject(obj)
+		}
+	}
+	r.Finish(err)
+	if err := operationReportSink.Write(r); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write operation report: %v\n", err)
+	}
+}
+
+func finishOperationEvents(err error) {
+	s := operationEvents
+	if s == nil {
+		return
+	}
+	operationEvents = nil
+	s.Finish(err)
+	if err := s.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to stream operation events: %v\n", err)
+	}
+	if operationEventsFile != nil {
+		if err := operationEventsFile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to close events file: %v\n", err)
+		}
+		operationEventsFile = nil
+	}
+}
+
+// machineObjects returns the machine and provisioned machine, if they exist
+// in the state.
+func machineObjects(name string) []interface{} {
+	var objs []interface{}
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return objs
+	}
+	objs = append(objs, machine)
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return objs
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return objs
+	}
+	return append(objs, pm)
+}
+
+// reportHook records log entries in the operation report and event stream.
+type reportHook struct{}
+
+func (reportHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.InfoLevel, logrus.ErrorLevel, logrus.FatalLevel}
+}
+
+func (reportHook) Fire(entry *logrus.Entry) error {
+	if r := operationReport; r != nil {
+		if entry.Level == logrus.InfoLevel {
+			r.StartPhase(entry.Message)
+		} else {
+			r.Fail(entry.Message)
+		}
+	}
+	if s := operationEvents; s != nil {
+		if entry.Level == logrus.InfoLevel {
+			s.StartPhase(entry.Message)
+		} else {
+			s.Fail(entry.Message)
+		}
+	}
+	return nil
+}
+
+// recordingClient records the commands run on the machine in the operation
+// report.
+type recordingClient struct {
+	sshmachine.Client
+	host   string
+	report *report.Report
+}
+
+func (c *recordingClient) Close() error {
+	return sshutil.Close(c.Client)
+}
+
+func (c *recordingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	started := time.Now()
+	stdOut, stdErr, err := c.Client.RunCommand(cmd)
+	c.report.RecordCommand(c.host, cmd, started, err)
+	return stdOut, stdErr, err
+}
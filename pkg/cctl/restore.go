@@ -14,10 +14,11 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
+package cctl
 
 import (
 	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
 	"github.com/platform9/cctl/pkg/util/archive"
 	"github.com/spf13/cobra"
 )
@@ -26,11 +27,11 @@ var restoreCmd = &cobra.Command{
 	Use:   "restore",
 	Short: "Restore the cctl state and etcd snapshot from an archive.",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		InitState()
+		initState()
 		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
-		// Therefore LogLevel must be set in all the PersistentPreRuns
-		if err := log.SetLogLevelUsingString(LogLevel); err != nil {
-			log.Fatalf("Unable to parse log level %s", LogLevel)
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -47,6 +48,16 @@ var restoreCmd = &cobra.Command{
 		}
 		log.Printf("[restore] Extracted etcd snapshot to %q", snapshotPath)
 		log.Printf("[restore] Extracted cctl state to %q", stateFilename)
+		if len(signingKeyFile) != 0 {
+			s := cctlstate.NewWithFile(stateFilename, nil, nil, nil)
+			if err := configureStateSigning(s); err != nil {
+				log.Fatalf("Unable to read signing key: %v", err)
+			}
+			if err := s.Sign(); err != nil {
+				log.Fatalf("Unable to sign cctl state: %v", err)
+			}
+			log.Printf("[restore] Signed cctl state")
+		}
 	},
 }
 
@@ -0,0 +1,224 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	stateutil "github.com/platform9/cctl/pkg/state/util"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/filelock"
+	"github.com/platform9/cctl/pkg/util/secretstore"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+	"github.com/platform9/cctl/pkg/util/transfer"
+
+	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+)
+
+var stateFilename string
+var state *cctlstate.State
+var logLevel string
+var logFormat string
+var verbosity int
+var bwLimit int
+
+// remoteTimeout bounds the time of kubeadm, etcdadm, nodeadm, and kubectl
+// invocations on machines.
+var remoteTimeout time.Duration
+var transferRetries int
+
+// sshRetries and sshRetryInterval configure the retries of SSH operations that
+// fail because of the connection.
+var sshRetries int
+var sshRetryInterval time.Duration
+var namespace string
+var lockTimeout time.Duration
+var stateLock *filelock.Lock
+
+var rootCmd = &cobra.Command{
+	Use: "cctl",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+	},
+	Long: `CLI tool for Kubernetes cluster management.
+This tool lets you create, scale, backup and restore
+your air-gapped, on-premise Kubernetes cluster.`,
+}
+
+// Execute runs the command given by the arguments of the process, as the
+// cctl binary does, and exits with a non-zero status if it fails.
+func Execute() {
+	guardOperation(rootCmd)
+	guardReadOnly(rootCmd)
+	err := rootCmd.Execute()
+	writeRunProfile()
+	gitErr := commitGitState(err != nil)
+	releaseOperationLease()
+	unlockState()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if gitErr != nil {
+		fmt.Fprintf(os.Stderr, "Unable to push the state: %v\n", gitErr)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	cobra.OnInitialize(configureLogging, configureGitState)
+	rootCmd.PersistentFlags().StringVar(&stateFilename, "state", common.DefaultStateFilename, "state file, or a state file in a git repository, given as <repository>//<path>, e.g. git@github.com:org/clusters.git//prod.yaml, which is cloned, and to which every change of the state is committed and pushed")
+	rootCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "l", "info", "set log level for output, permitted values debug, info, warn, error, fatal and panic")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", log.TextFormat, "format of log output, permitted values text and json")
+	rootCmd.PersistentFlags().IntVar(&verbosity, "v", 0, "verbosity of log output. 1 or more sets the log level to debug, unless --log-level is given; 2 or more also logs every command run on machines, and how long it took")
+	rootCmd.PersistentFlags().StringVar(&namespace, "namespace", common.DefaultNamespace, "namespace of the cluster objects in the state. Clusters in different namespaces can share a state file")
+	rootCmd.PersistentFlags().IntVar(&bwLimit, "bwlimit", 0, "limit the bandwidth of file transfers to and from machines, in KiB per second. Zero means unlimited")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", common.DefaultStateLockTimeout, "how long to wait for another cctl invocation to release its lock on the state file")
+	rootCmd.PersistentFlags().DurationVar(&remoteTimeout, "remote-timeout", common.DefaultRemoteCommandTimeout, "how long a kubeadm, etcdadm, nodeadm, or kubectl invocation on a machine may run before it is stopped, and its partial output saved. Zero means unlimited")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", defaultReadOnly(), "refuse to run any command that can change the cluster, the machines, or the state. Defaults to the value of "+readOnlyEnvVar)
+	rootCmd.PersistentFlags().StringVar(&commandAllowlistFile, "command-allowlist", "", "file of command patterns, as rendered by 'render command-allowlist'. Commands on machines that match none of them are refused before they are run")
+	rootCmd.PersistentFlags().IntVar(&sshRetries, "ssh-retries", sshutil.DefaultRetries, "number of times an SSH connection, command, or file operation that fails because of the network is retried, reconnecting each time. Commands that started are never retried")
+	rootCmd.PersistentFlags().DurationVar(&sshRetryInterval, "ssh-retry-interval", sshutil.DefaultRetryInterval, "time before the first SSH retry. It doubles after every retry")
+	rootCmd.PersistentFlags().IntVar(&transferRetries, "transfer-retries", transfer.DefaultRetries, "number of times a file transfer chunk is retried, reconnecting each time, before the transfer fails")
+}
+
+// configureLogging applies the log flags. It runs before any command.
+func configureLogging() {
+	if err := log.SetFormat(logFormat); err != nil {
+		log.Fatalf("Unable to set log format: %v", err)
+	}
+	log.SetVerbosity(verbosity)
+	if verbosity > 0 && !rootCmd.PersistentFlags().Changed("log-level") {
+		logLevel = "debug"
+	}
+	if err := log.SetLogLevelUsingString(logLevel); err != nil {
+		log.Fatalf("Unable to parse log level %s", logLevel)
+	}
+}
+
+func initState() {
+	if err := openState(); err != nil {
+		log.Fatalf("Unable to open state: %v", err)
+	}
+}
+
+// openState locks and reads the state file, and configures the cluster, if
+// any, for use by commands.
+func openState() error {
+	kubeClient := kubeclientfake.NewSimpleClientset()
+	clusterClient := clusterclientfake.NewSimpleClientset()
+	spClient := spclientfake.NewSimpleClientset()
+	if err := lockState(); err != nil {
+		return err
+	}
+	state = cctlstate.NewWithFile(stateFilename, kubeClient, clusterClient, spClient)
+	state.ReadOnly = readOnly
+	state.Profile = runProfile
+	configureStateBackup(state)
+	if err := configureStateSigning(state); err != nil {
+		return fmt.Errorf("unable to read signing key: %v", err)
+	}
+	if err := configureSecretStore(state); err != nil {
+		return fmt.Errorf("unable to configure Vault: %v", err)
+	}
+
+	if err := state.PushToAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	if refs := secretstore.References(state.SecretList.Items); state.SecretStore == nil && len(refs) != 0 {
+		return fmt.Errorf("secrets %s are kept in Vault; set --vault-addr, or VAULT_ADDR, and VAULT_TOKEN", strings.Join(refs, ", "))
+	}
+	if err := signIgnoredSignature(state); err != nil {
+		return err
+	}
+	legacy, err := stateutil.LegacyProviderConfigs(clusterClient)
+	if err != nil {
+		return err
+	}
+	if len(legacy) != 0 {
+		return fmt.Errorf("the provider configs of %s were written by an older version of the ssh-provider; run cctl state migrate to upgrade them", strings.Join(legacy, ", "))
+	}
+	if err := applyRemotePaths(); err != nil {
+		return fmt.Errorf("unable to configure remote paths: %v", err)
+	}
+	// Objects read from the state file are not stamped, only the ones
+	// created by the command.
+	stampCreatedObjects(kubeClient, clusterClient, spClient)
+	return nil
+}
+
+// applyRemotePaths uses the locations of binaries and files on machines, and
+// the object labels and annotations, configured for the cluster, if any.
+func applyRemotePaths() error {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	if err := setObjectMetadataFromCluster(cluster); err != nil {
+		return err
+	}
+	return common.SetRemotePaths(cluster.Annotations[common.RemoteBinDirAnnotationKey], cluster.Annotations[common.RemoteAdminKubeconfigAnnotationKey])
+}
+
+// lockState acquires the advisory lock on the state file, so that concurrent
+// invocations cannot interleave their changes to it. The lock is held until
+// cctl exits.
+func lockState() error {
+	if stateLock != nil {
+		return nil
+	}
+	lockFilename := stateFilename + common.StateLockFileSuffix
+	l, err := filelock.Acquire(lockFilename, 0)
+	if filelock.IsLocked(err) && lockTimeout > 0 {
+		log.Printf("Waiting up to %s for the state lock: %v", lockTimeout, err)
+		l, err = filelock.Acquire(lockFilename, lockTimeout)
+	}
+	if err != nil {
+		if err == filelock.ErrReadOnly {
+			// The state cannot be changed, so it need not be locked.
+			log.Debugf("Not locking state: %v", err)
+			return nil
+		}
+		return fmt.Errorf("unable to lock state: %v", err)
+	}
+	stateLock = l
+	log.RegisterExitHandler(unlockState)
+	return nil
+}
+
+func unlockState() {
+	if stateLock == nil {
+		return
+	}
+	if err := stateLock.Release(); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to unlock state: %v\n", err)
+	}
+	stateLock = nil
+}
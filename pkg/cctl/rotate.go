@@ -0,0 +1,602 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/pki"
+)
+
+const rotatePollInterval = 5 * time.Second
+
+var rotateTimeout time.Duration
+
+// clusterCAs are the certificate authorities that sign the control plane
+// certificates.
+type clusterCAs struct {
+	etcd       *pki.CA
+	apiServer  *pki.CA
+	frontProxy *pki.CA
+}
+
+// renewedFile is a certificate, or a kubeconfig with embedded client
+// certificates, that is renewed on every master or etcd machine.
+type renewedFile struct {
+	// path is the path of the certificate without its extension, or the path
+	// of the kubeconfig.
+	path       string
+	kubeconfig bool
+	ca         func(cas *clusterCAs) *pki.CA
+}
+
+var (
+	// etcdCertificates are renewed on every machine that runs an etcd member.
+	etcdCertificates = []renewedFile{
+		{path: path.Join(common.EtcdPKIDir, "server"), ca: etcdCA},
+		{path: path.Join(common.EtcdPKIDir, "peer"), ca: etcdCA},
+		{path: path.Join(common.EtcdPKIDir, "etcdctl-etcd-client"), ca: etcdCA},
+		{path: path.Join(common.EtcdPKIDir, "apiserver-etcd-client"), ca: etcdCA},
+	}
+	// kubernetesCertificates are renewed on masters only.
+	kubernetesCertificates = []renewedFile{
+		{path: path.Join(common.KubernetesPKIDir, "apiserver"), ca: apiServerCA},
+		{path: path.Join(common.KubernetesPKIDir, "apiserver-kubelet-client"), ca: apiServerCA},
+		{path: path.Join(common.KubernetesPKIDir, "front-proxy-client"), ca: frontProxyCA},
+		{path: common.AdminKubeconfig, kubeconfig: true, ca: apiServerCA},
+		{path: path.Join(common.KubernetesDir, "controller-manager.conf"), kubeconfig: true, ca: apiServerCA},
+		{path: path.Join(common.KubernetesDir, "scheduler.conf"), kubeconfig: true, ca: apiServerCA},
+		{path: common.KubeletKubeconfig, kubeconfig: true, ca: apiServerCA},
+	}
+)
+
+func etcdCA(cas *clusterCAs) *pki.CA       { return cas.etcd }
+func apiServerCA(cas *clusterCAs) *pki.CA  { return cas.apiServer }
+func frontProxyCA(cas *clusterCAs) *pki.CA { return cas.frontProxy }
+
+// rotateCmd represents the rotate command
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Used to rotate cluster credentials",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+}
+
+var certificatesCmdRotate = &cobra.Command{
+	Use:   "certificates",
+	Short: "Renew the control plane certificates on all masters and etcd machines",
+	Long: `Renew the etcd certificates on all masters and etcd machines, and the API
+server, front proxy, and kubeconfig client certificates on all masters. Each
+renewed certificate keeps the subject and alternative names of the certificate
+it replaces, and is signed by the cluster CA.
+
+Machines are rotated one at a time. On each machine, etcd is restarted and must
+be healthy before, on a master, the Kubernetes control plane is restarted, and
+the API server must be healthy before the next machine is rotated. The replaced
+files are kept with a .old suffix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get cluster: %v", err)
+		}
+		cas, err := clusterCAsFromState(cluster)
+		if err != nil {
+			log.Fatalf("Unable to read cluster CAs: %v", err)
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		var machines []*clusterv1.Machine
+		for i := range machineList.Items {
+			if clusterapi.RunsEtcd(machineList.Items[i]) {
+				machines = append(machines, &machineList.Items[i])
+			}
+		}
+		if len(machines) == 0 {
+			log.Fatalf("No masters or etcd machines found.")
+		}
+		clients := make([]sshmachine.Client, len(machines))
+		for i, machine := range machines {
+			client, err := machineClientForMachine(machine)
+			if err != nil {
+				log.Fatalf("Unable to create machine client for machine %q: %v", machine.Name, err)
+			}
+			clients[i] = client
+		}
+		// Rotation restarts etcd on every machine that runs a member; make
+		// sure the cluster can tolerate that before starting.
+		if err := waitForEtcdHealthy(clients[0], 0); err != nil {
+			log.Fatalf("Etcd cluster is not healthy, not rotating certificates: %v", err)
+		}
+
+		var adminKubeconfig []byte
+		for i, machine := range machines {
+			log.Printf("[rotate] [%d/%d] Rotating certificates on machine %q", i+1, len(machines), machine.Name)
+			master := clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles)
+			if err := rotateMachineCertificates(clients[i], cas, master); err != nil {
+				log.Fatalf("Unable to rotate certificates on machine %q: %v", machine.Name, err)
+			}
+			if !master {
+				continue
+			}
+			if adminKubeconfig, err = clients[i].ReadFile(common.AdminKubeconfig); err != nil {
+				log.Fatalf("Unable to read admin kubeconfig from machine %q: %v", machine.Name, err)
+			}
+		}
+		if adminKubeconfig != nil {
+			if err := updateAdminKubeconfigSecret(adminKubeconfig); err != nil {
+				log.Fatalf("Unable to update admin kubeconfig secret: %v", err)
+			}
+		}
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		log.Println("[rotate] Rotated certificates on all masters and etcd machines")
+	},
+}
+
+// certificateExpiry is the expiry of a certificate, or kubeconfig client
+// certificate, on a master or etcd machine.
+type certificateExpiry struct {
+	Machine   string
+	Path      string
+	Expires   string
+	Remaining string
+	expires   time.Time
+}
+
+var certificatesCmdStatus = &cobra.Command{
+	Use:   "certificates",
+	Short: "Show when the control plane certificates on all masters and etcd machines expire",
+	Long: `Show when the etcd certificates on all masters and etcd machines, and the
+API server, front proxy, and kubeconfig client certificates on all masters
+expire. The command fails if a certificate cannot
+be read, or expires within --warn-within, so that it can be run periodically to
+alert before the certificates must be rotated.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		warnWithin, err := cmd.Flags().GetDuration("warn-within")
+		if err != nil {
+			log.Fatalf("Unable to parse --warn-within: %v", err)
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		var expiries []certificateExpiry
+		var failed bool
+		for i := range machineList.Items {
+			machine := &machineList.Items[i]
+			if !clusterapi.RunsEtcd(*machine) {
+				continue
+			}
+			client, err := machineClientForMachine(machine)
+			if err != nil {
+				log.Errorf("Unable to create machine client for machine %q: %v", machine.Name, err)
+				failed = true
+				continue
+			}
+			master := clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles)
+			e, err := machineCertificateExpiries(machine.Name, client, master)
+			if err != nil {
+				log.Errorf("Unable to read certificates on machine %q: %v", machine.Name, err)
+				failed = true
+			}
+			expiries = append(expiries, e...)
+		}
+		now := time.Now()
+		for i := range expiries {
+			remaining := expiries[i].expires.Sub(now)
+			expiries[i].Remaining = remaining.Truncate(time.Hour).String()
+			if remaining < warnWithin {
+				log.Warnf("Certificate %q on machine %q expires in %s", expiries[i].Path, expiries[i].Machine, expiries[i].Remaining)
+				failed = true
+			}
+		}
+		t := template.Must(template.New("CertificateExpiryPrintTemplate").Parse(common.CertificateExpiryPrintTemplate))
+		if err := t.Execute(os.Stdout, expiries); err != nil {
+			log.Fatalf("Could not pretty print certificate expiry: %s", err)
+		}
+		if failed {
+			log.Fatalf("Some certificates expire within %s, or could not be read. Use 'cctl rotate certificates' to renew them.", warnWithin)
+		}
+	},
+}
+
+// machineCertificateExpiries returns the expiry of every certificate and
+// kubeconfig, renewed by rotate certificates, that exists on the machine. The
+// Kubernetes certificates are read only if the machine is a master.
+func machineCertificateExpiries(machineName string, client sshmachine.Client, master bool) ([]certificateExpiry, error) {
+	var expiries []certificateExpiry
+	files := etcdCertificates
+	if master {
+		files = append(append([]renewedFile{}, etcdCertificates...), kubernetesCertificates...)
+	}
+	for _, f := range files {
+		filePath := f.path
+		if !f.kubeconfig {
+			filePath += ".crt"
+		}
+		data, err := readFileIfExists(client, filePath)
+		if err != nil {
+			return expiries, err
+		}
+		if data == nil {
+			continue
+		}
+		var expires time.Time
+		if f.kubeconfig {
+			expires, err = pki.KubeconfigExpiry(data)
+		} else {
+			expires, err = pki.Expiry(data)
+		}
+		if err != nil {
+			return expiries, fmt.Errorf("unable to read expiry of %q: %v", filePath, err)
+		}
+		expiries = append(expiries, certificateExpiry{
+			Machine: machineName,
+			Path:    filePath,
+			Expires: expires.UTC().Format(time.RFC3339),
+			expires: expires,
+		})
+	}
+	return expiries, nil
+}
+
+func clusterCAsFromState(cluster *clusterv1.Cluster) (*clusterCAs, error) {
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	caFromSecret := func(secretRef string) (*pki.CA, error) {
+		secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(secretRef, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get secret %q: %v", secretRef, err)
+		}
+		ca, err := pki.ParseCA(secret.Data["tls.crt"], secret.Data["tls.key"])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse secret %q: %v", secretRef, err)
+		}
+		return ca, nil
+	}
+	if clusterSpec.EtcdCASecret == nil || clusterSpec.APIServerCASecret == nil || clusterSpec.FrontProxyCASecret == nil {
+		return nil, fmt.Errorf("cluster spec does not reference all CA secrets")
+	}
+	cas := &clusterCAs{}
+	if cas.etcd, err = caFromSecret(clusterSpec.EtcdCASecret.Name); err != nil {
+		return nil, err
+	}
+	if cas.apiServer, err = caFromSecret(clusterSpec.APIServerCASecret.Name); err != nil {
+		return nil, err
+	}
+	if cas.frontProxy, err = caFromSecret(clusterSpec.FrontProxyCASecret.Name); err != nil {
+		return nil, err
+	}
+	return cas, nil
+}
+
+// rotateMachineCertificates renews the etcd certificates and restarts etcd,
+// then, if the machine is a master, renews the Kubernetes certificates and
+// restarts the control plane.
+func rotateMachineCertificates(client sshmachine.Client, cas *clusterCAs, master bool) error {
+	log.Println("[rotate] Renewing etcd certificates")
+	if err := renewFiles(client, etcdCertificates, cas); err != nil {
+		return err
+	}
+	log.Println("[rotate] Restarting etcd")
+	if err := restartService(common.EtcdService, client); err != nil {
+		return err
+	}
+	if err := waitForEtcdHealthy(client, rotateTimeout); err != nil {
+		return err
+	}
+	if !master {
+		return nil
+	}
+
+	log.Println("[rotate] Renewing Kubernetes certificates")
+	if err := renewFiles(client, kubernetesCertificates, cas); err != nil {
+		return err
+	}
+	log.Println("[rotate] Restarting Kubernetes control plane")
+	for _, filter := range []string{common.DockerKubeAPIServerNameFilter, common.DockerKubeControllerMgrNameFilter, common.DockerKubeSchedulerNameFilter} {
+		// The kubelet recreates the static pod containers.
+		containerID, err := identifyDockerContainer([]string{filter, common.DockerRunningStatusFilter}, client)
+		if err != nil {
+			log.Debugf("Not restarting container: %v", err)
+			continue
+		}
+		if err := stopDockerContainer(containerID, client); err != nil {
+			return err
+		}
+		if err := removeDockerContainer(containerID, client); err != nil {
+			return err
+		}
+	}
+	if err := restartService(common.KubeletService, client); err != nil {
+		return err
+	}
+	return waitForAPIServerHealthy(client, rotateTimeout)
+}
+
+// renewFiles renews every certificate or kubeconfig that exists on the
+// machine. The replaced files are kept with a .old suffix.
+func renewFiles(client sshmachine.Client, files []renewedFile, cas *clusterCAs) error {
+	for _, f := range files {
+		ca := f.ca(cas)
+		if f.kubeconfig {
+			kubeconfig, err := readFileIfExists(client, f.path)
+			if err != nil {
+				return err
+			}
+			if kubeconfig == nil {
+				continue
+			}
+			renewed, err := ca.RenewKubeconfig(kubeconfig)
+			if err != nil {
+				return fmt.Errorf("unable to renew %q: %v", f.path, err)
+			}
+			if err := replaceFile(client, f.path, 0600, renewed); err != nil {
+				return err
+			}
+			log.Printf("[rotate] Renewed %q", f.path)
+			continue
+		}
+		certPath, keyPath := f.path+".crt", f.path+".key"
+		certPEM, err := readFileIfExists(client, certPath)
+		if err != nil {
+			return err
+		}
+		if certPEM == nil {
+			continue
+		}
+		newCertPEM, newKeyPEM, err := ca.Renew(certPEM)
+		if err != nil {
+			return fmt.Errorf("unable to renew %q: %v", certPath, err)
+		}
+		if err := replaceFile(client, keyPath, 0600, newKeyPEM); err != nil {
+			return err
+		}
+		if err := replaceFile(client, certPath, 0644, newCertPEM); err != nil {
+			return err
+		}
+		log.Printf("[rotate] Renewed %q", certPath)
+	}
+	return nil
+}
+
+// readFileIfExists returns the contents of the file, or nil if it does not
+// exist.
+func readFileIfExists(client sshmachine.Client, path string) ([]byte, error) {
+	exists, err := client.Exists(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check if %q exists: %v", path, err)
+	}
+	if !exists {
+		log.Debugf("Skipping %q: file does not exist", path)
+		return nil, nil
+	}
+	// Kubeconfigs and keys are readable only by root, so the file is read with
+	// a command, which runs with sudo, rather than over SFTP.
+	cmd := fmt.Sprintf("cat %s", path)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %q: error running %q: %v (stderr: %q)", path, cmd, err, string(stdErr))
+	}
+	return stdOut, nil
+}
+
+// replaceFile keeps a copy of the file with a .old suffix, then replaces it.
+func replaceFile(client sshmachine.Client, filePath string, mode os.FileMode, data []byte) error {
+	if err := client.CopyFile(filePath, filePath+".old"); err != nil {
+		return fmt.Errorf("unable to back up %q: %v", filePath, err)
+	}
+	return writeFileAsRoot(client, filePath, mode, data)
+}
+
+func restartService(service string, client sshmachine.Client) error {
+	cmd := hostOS(client).ServiceCommand("restart", service)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return nil
+}
+
+// waitForEtcdHealthy waits until every member of the etcd cluster is healthy.
+// If timeout is zero, the health is checked once.
+func waitForEtcdHealthy(client sshmachine.Client, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		health, err := etcdEndpointHealth(client)
+		if err == nil && len(health.Unhealthy) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("unable to check etcd health: %v", err)
+			}
+			return fmt.Errorf("etcd members %v are not healthy", health.Unhealthy)
+		}
+		time.Sleep(rotatePollInterval)
+	}
+}
+
+// waitForAPIServerHealthy waits until the API server on the machine reports
+// that it is healthy.
+func waitForAPIServerHealthy(client sshmachine.Client, timeout time.Duration) error {
+	cmd := fmt.Sprintf("%s --kubeconfig=%s get --raw /healthz", common.KubectlFile, common.AdminKubeconfig)
+	deadline := time.Now().Add(timeout)
+	for {
+		stdOut, stdErr, err := client.RunCommand(cmd)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("API server is not healthy: error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		}
+		time.Sleep(rotatePollInterval)
+	}
+}
+
+var apiServerManifestFile = path.Join(common.StaticPodManifestsDir, "kube-apiserver.yaml")
+
+// apiServerManifestBackupFile is outside the static pod manifests directory,
+// because the kubelet runs every manifest in that directory.
+var apiServerManifestBackupFile = path.Join(common.KubernetesDir, "kube-apiserver.yaml.old")
+
+// reloadAPIServer makes the API server of the master read its configuration
+// files again, and waits until it is healthy. If the manifest changed, it is
+// written, and the kubelet recreates the API server; otherwise the API server
+// container is restarted.
+func reloadAPIServer(client sshmachine.Client, manifest []byte, manifestChanged bool) error {
+	if manifestChanged {
+		if err := client.CopyFile(apiServerManifestFile, apiServerManifestBackupFile); err != nil {
+			return fmt.Errorf("unable to back up %q: %v", apiServerManifestFile, err)
+		}
+		if err := writeFileAsRoot(client, apiServerManifestFile, 0600, manifest); err != nil {
+			return err
+		}
+	} else {
+		containerID, err := identifyDockerContainer([]string{common.DockerKubeAPIServerNameFilter, common.DockerRunningStatusFilter}, client)
+		if err != nil {
+			log.Debugf("Not restarting API server container: %v", err)
+		} else {
+			if err := stopDockerContainer(containerID, client); err != nil {
+				return err
+			}
+			if err := removeDockerContainer(containerID, client); err != nil {
+				return err
+			}
+		}
+	}
+	return waitForAPIServerHealthy(client, common.APIServerRestartTimeout)
+}
+
+// apiServerCertSANs returns the extra subject alternative names of the API
+// server certificate recorded in the cluster.
+func apiServerCertSANs(cluster *clusterv1.Cluster) []string {
+	value := cluster.Annotations[common.APIServerCertSANsAnnotationKey]
+	if len(value) == 0 {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// ensureAPIServerCertSANs reissues the API server certificate on the master if
+// it does not have all the extra subject alternative names of the cluster,
+// then restarts the API server and waits until it is healthy.
+func ensureAPIServerCertSANs(cluster *clusterv1.Cluster, machineName string, client sshmachine.Client) error {
+	sans := apiServerCertSANs(cluster)
+	if len(sans) == 0 {
+		return nil
+	}
+	extra, err := pki.ParseAltNames(sans)
+	if err != nil {
+		return fmt.Errorf("unable to parse API server certificate alternative names: %v", err)
+	}
+	certPath := path.Join(common.KubernetesPKIDir, "apiserver") + ".crt"
+	keyPath := path.Join(common.KubernetesPKIDir, "apiserver") + ".key"
+	certPEM, err := client.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", certPath, err)
+	}
+	missing, err := pki.MissingAltNames(certPEM, extra)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", certPath, err)
+	}
+	if len(missing.DNSNames) == 0 && len(missing.IPs) == 0 {
+		log.Printf("API server certificate of machine %q already has its alternative names", machineName)
+		return nil
+	}
+	cas, err := clusterCAsFromState(cluster)
+	if err != nil {
+		return fmt.Errorf("unable to read cluster CAs: %v", err)
+	}
+	newCertPEM, newKeyPEM, err := cas.apiServer.RenewWithAltNames(certPEM, extra)
+	if err != nil {
+		return fmt.Errorf("unable to reissue %q: %v", certPath, err)
+	}
+	if err := replaceFile(client, keyPath, 0600, newKeyPEM); err != nil {
+		return err
+	}
+	if err := replaceFile(client, certPath, 0644, newCertPEM); err != nil {
+		return err
+	}
+	log.Printf("Reissued the API server certificate of machine %q with alternative names %v %v", machineName, missing.DNSNames, missing.IPs)
+	// The kubelet recreates the static pod container with the new
+	// certificate.
+	containerID, err := identifyDockerContainer([]string{common.DockerKubeAPIServerNameFilter, common.DockerRunningStatusFilter}, client)
+	if err != nil {
+		log.Debugf("Not restarting API server container: %v", err)
+	} else {
+		if err := stopDockerContainer(containerID, client); err != nil {
+			return err
+		}
+		if err := removeDockerContainer(containerID, client); err != nil {
+			return err
+		}
+	}
+	return waitForAPIServerHealthy(client, common.APIServerRestartTimeout)
+}
+
+// updateAdminKubeconfigSecret replaces the admin kubeconfig kept in the state.
+func updateAdminKubeconfigSecret(kubeconfig []byte) error {
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultAdminConfigSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get secret %q: %v", common.DefaultAdminConfigSecretName, err)
+	}
+	secret.Data[common.DefaultAdminConfigSecretKey] = kubeconfig
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Update(secret); err != nil {
+		return fmt.Errorf("unable to update secret %q: %v", common.DefaultAdminConfigSecretName, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(rotateCmd)
+	rotateCmd.AddCommand(certificatesCmdRotate)
+	statusCmd.AddCommand(certificatesCmdStatus)
+	certificatesCmdStatus.Flags().Duration("warn-within", common.DefaultCertificateExpiryWarning, "Fail if a certificate expires within this duration")
+	certificatesCmdRotate.Flags().DurationVar(&rotateTimeout, "timeout", 5*time.Minute, "Time to wait for etcd and the API server to become healthy after they are restarted on a machine")
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/discover"
+	"github.com/platform9/cctl/pkg/util/hostos"
+)
+
+// runtimeUpgrade describes the container runtime to install.
+type runtimeUpgrade struct {
+	version     string
+	packageName string
+	service     string
+	// packageFile is a local .deb or .rpm file, or a systemd-sysext image
+	// for immutable operating systems. If empty, the package is installed
+	// from the machine's package repositories.
+	packageFile string
+}
+
+var runtimeCmdUpgrade = &cobra.Command{
+	Use:   "runtime",
+	Short: "Upgrade the container runtime of machines",
+	Long: `Upgrade the container runtime of machines, independently of Kubernetes.
+Machines are upgraded one at a time: each is drained, its runtime package is
+installed, the runtime and kubelet are restarted, and it is uncordoned. If a
+machine fails to upgrade, the upgrade stops and the machine is left
+cordoned.
+
+Immutable operating systems, e.g. Flatcar, have no package manager. On them,
+--package-file must be a systemd-sysext image, whose extension name is
+--package; it is installed in /etc/extensions and merged into /usr.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ips, err := cmd.Flags().GetStringSlice("ip")
+		if err != nil {
+			log.Fatalf("Unable to parse --ip: %v", err)
+		}
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			log.Fatalf("Unable to parse --all: %v", err)
+		}
+		if all == (len(ips) != 0) {
+			log.Fatalf("Exactly one of --ip and --all must be given.")
+		}
+		upgrade := runtimeUpgrade{
+			version:     cmd.Flag("version").Value.String(),
+			packageName: cmd.Flag("package").Value.String(),
+			service:     cmd.Flag("service").Value.String(),
+			packageFile: cmd.Flag("package-file").Value.String(),
+		}
+		var machines []clusterv1.Machine
+		if all {
+			machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				log.Fatalf("Unable to list machines: %v", err)
+			}
+			machines = machineList.Items
+		} else {
+			for _, ip := range ips {
+				machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+				if err != nil {
+					log.Fatalf("Unable to get machine %q: %v", ip, err)
+				}
+				machines = append(machines, *machine)
+			}
+		}
+		for i := range machines {
+			machine := &machines[i]
+			log.Printf("[%d/%d] Upgrading container runtime of machine %q to %s", i+1, len(machines), machine.Name, upgrade.version)
+			if err := upgradeMachineRuntime(machine, upgrade); err != nil {
+				log.Fatalf("Unable to upgrade container runtime of machine %q: %v", machine.Name, err)
+			}
+		}
+		log.Printf("Upgraded container runtime of %d machines to %s", len(machines), upgrade.version)
+	},
+}
+
+func upgradeMachineRuntime(machine *clusterv1.Machine, upgrade runtimeUpgrade) error {
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	machineClient, err := sshMachineClientFromSSHConfig(pm.Spec.SSHConfig)
+	if err != nil {
+		return fmt.Errorf("unable to create machine client: %v", err)
+	}
+	machineOS, err := hostOSForMachine(machine, machineClient)
+	if err != nil {
+		return fmt.Errorf("unable to detect operating system: %v", err)
+	}
+	// The install command is built before the node is drained, so that a
+	// machine without a package manager is left as it is.
+	remotePath := path.Join("/tmp", filepath.Base(upgrade.packageFile))
+	var installCmd string
+	switch {
+	case machineOS.Immutable():
+		// The runtime of an immutable operating system is a systemd-sysext
+		// image, merged into the read-only /usr.
+		if len(upgrade.packageFile) == 0 {
+			return fmt.Errorf("operating system %s has no package manager; use --package-file to install a systemd-sysext image", machineOS)
+		}
+		installCmd = hostos.SysextRefreshCommand
+	case len(upgrade.packageFile) != 0:
+		installCmd, err = machineOS.InstallPackageFileCommand(remotePath)
+	default:
+		installCmd, err = machineOS.InstallPackageVersionCommand(upgrade.packageName, upgrade.version)
+	}
+	if err != nil {
+		return err
+	}
+
+	nodeName, err := nodeNameForMachine(machine.Name, machineClient)
+	if err != nil {
+		return fmt.Errorf("unable to get node name: %v", err)
+	}
+	if err := drainNode(nodeName, machineClient); err != nil {
+		return fmt.Errorf("unable to drain the node %s: %v", nodeName, err)
+	}
+
+	if len(upgrade.packageFile) != 0 {
+		log.Printf("Uploading %q", upgrade.packageFile)
+		if err := writeRemoteFile(upgrade.packageFile, remotePath, machineClient, pm.Spec.SSHConfig); err != nil {
+			return fmt.Errorf("unable to upload %q: %v", upgrade.packageFile, err)
+		}
+		defer machineClient.RemoveFile(remotePath)
+	}
+	if machineOS.Immutable() {
+		if err := machineClient.MkdirAll(hostos.SysextDir, 0755); err != nil {
+			return fmt.Errorf("unable to create %q: %v", hostos.SysextDir, err)
+		}
+		if err := machineClient.MoveFile(remotePath, hostos.SysextImagePath(upgrade.packageName)); err != nil {
+			return fmt.Errorf("unable to install systemd-sysext image: %v", err)
+		}
+	}
+	log.Printf("Installing %s %s", upgrade.packageName, upgrade.version)
+	if stdOut, stdErr, err := machineClient.RunCommand(installCmd); err != nil {
+		return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", installCmd, err, string(stdOut), string(stdErr))
+	}
+	installed, err := installedPackageVersion(upgrade.packageName, machineOS, machineClient)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(installed, upgrade.version) {
+		return fmt.Errorf("installed version of %s is %q, expected %q", upgrade.packageName, installed, upgrade.version)
+	}
+
+	for _, service := range []string{upgrade.service, common.KubeletService} {
+		if err := restartService(service, machineClient); err != nil {
+			return err
+		}
+		if s := serviceState(service, machineClient); s != "active" {
+			return fmt.Errorf("service %s is %s after restart", service, s)
+		}
+	}
+	if err := uncordonNode(nodeName, machineClient); err != nil {
+		return fmt.Errorf("unable to uncordon the node %s: %v", nodeName, err)
+	}
+
+	if machine.Annotations == nil {
+		machine.Annotations = make(map[string]string)
+	}
+	machine.Annotations[common.RuntimeVersionAnnotationKey] = installed
+	if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine); err != nil {
+		return fmt.Errorf("unable to update machine: %v", err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	return nil
+}
+
+func installedPackageVersion(packageName string, machineOS hostos.OS, machineClient sshmachine.Client) (string, error) {
+	if machineOS.Immutable() {
+		release, err := machineClient.ReadFile(hostos.SysextReleaseFile(packageName))
+		if err != nil {
+			return "", fmt.Errorf("unable to read the release of systemd-sysext image %q: %v", packageName, err)
+		}
+		return discover.ParseOSRelease(release).VersionID, nil
+	}
+	cmd, err := machineOS.QueryPackageVersionCommand(packageName)
+	if err != nil {
+		return "", err
+	}
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return strings.TrimSpace(string(stdOut)), nil
+}
+
+func init() {
+	upgradeCmd.AddCommand(runtimeCmdUpgrade)
+	runtimeCmdUpgrade.Flags().StringSlice("ip", []string{}, "IPs of the machines. Provide a comma-separated list, or define multiple flags.")
+	runtimeCmdUpgrade.Flags().Bool("all", false, "Upgrade all machines")
+	runtimeCmdUpgrade.Flags().String("version", "", "Version of the container runtime package")
+	runtimeCmdUpgrade.MarkFlagRequired("version")
+	runtimeCmdUpgrade.Flags().String("package", common.DefaultRuntimePackage, "Name of the container runtime package")
+	runtimeCmdUpgrade.Flags().String("service", common.DefaultRuntimeService, "Name of the container runtime systemd service")
+	runtimeCmdUpgrade.Flags().String("package-file", "", "Location of a .deb or .rpm package, or, for immutable operating systems, a systemd-sysext image, to install. If not specified, the package is installed from the machine's package repositories")
+	runtimeCmdUpgrade.Flags().DurationVar(&drainTimeout, "drain-timeout", common.DrainTimeout, "The length of time to wait before giving up, zero means infinite")
+	runtimeCmdUpgrade.Flags().IntVar(&drainGracePeriodSeconds, "drain-grace-period", common.DrainGracePeriodSeconds, "Period of time in seconds given to each pod to terminate gracefully. If negative, the default value specified in the pod will be used.")
+	runtimeCmdUpgrade.Flags().BoolVar(&drainDeleteLocalData, "drain-delete-local-data", common.DrainDeleteLocalData, "Continue even if there are pods using emptyDir (local data that will be deleted when the node is drained).")
+	runtimeCmdUpgrade.Flags().BoolVar(&drainForce, "drain-force", common.DrainForce, "Continue even if there are pods not managed by a ReplicationController, ReplicaSet, Job, DaemonSet or StatefulSet.")
+}
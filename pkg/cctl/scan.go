@@ -0,0 +1,261 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// scanCmd represents the scan command
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Used to collect information from machines",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Scan called")
+	},
+}
+
+var hostKeysCmdScan = &cobra.Command{
+	Use:   "host-keys",
+	Short: "Retrieve the SSH host keys of a machine and store them in the state",
+	Long: `Connect to the machine, retrieve its SSH host public keys, and print their
+fingerprints. Once the fingerprints are confirmed, the keys are stored in the
+SSH configuration of the machine, and are used to verify the identity of the
+machine from then on.
+
+If the machine is not in the state yet, the confirmed keys are written to
+--output-dir, one file per key, to be given to 'cctl create machine
+--public-keys', so that the identity of the machine is verified from its first
+connection on.
+
+If the machine is in the state, and its stored keys differ from the keys it
+presents, the keys are replaced only with --replace.
+
+Compare the fingerprints with the output of 'ssh-keygen -lf <key>' for each
+key in /etc/ssh on the machine before confirming them. If the cluster has a
+bastion, the machine is contacted through it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ip := cmd.Flag("ip").Value.String()
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Fatalf("Unable to parse --yes: %v", err)
+		}
+		replace, err := cmd.Flags().GetBool("replace")
+		if err != nil {
+			log.Fatalf("Unable to parse --replace: %v", err)
+		}
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			log.Fatalf("Unable to parse --port: %v", err)
+		}
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Fatalf("Unable to parse --timeout: %v", err)
+		}
+		outputDir := cmd.Flag("output-dir").Value.String()
+		if err := scanMachineHostKeys(ip, port, outputDir, yes, replace, timeout); err != nil {
+			log.Fatalf("Unable to scan host keys of machine %q: %v", ip, err)
+		}
+	},
+}
+
+// scanMachineHostKeys retrieves the host keys of the machine and, once they
+// are confirmed, stores them in the machine's SSH configuration, or, if the
+// machine is not in the state, writes them to outputDir. Keys that differ from
+// the stored keys are stored only if replace is true.
+func scanMachineHostKeys(ip string, port int, outputDir string, yes, replace bool, timeout time.Duration) error {
+	machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return scanNewMachineHostKeys(ip, port, outputDir, yes, timeout)
+		}
+		return fmt.Errorf("unable to get machine: %v", err)
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	sshConfig := pm.Spec.SSHConfig.DeepCopy()
+
+	keys, err := scanAndPrintHostKeys(sshConfig.Host, sshConfig.Port, timeout)
+	if err != nil {
+		return err
+	}
+	var publicKeys []string
+	for _, key := range keys {
+		publicKeys = append(publicKeys, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+	}
+	if len(sshConfig.PublicKeys) != 0 {
+		if cmp.Equal(trimmedKeys(sshConfig.PublicKeys), publicKeys) {
+			log.Println("The host keys are already stored in the state")
+			return nil
+		}
+		if !replace {
+			return fmt.Errorf("the host keys differ from the keys stored in the state. The machine may have been reinstalled, or its identity may be forged. Once the fingerprints are verified on the machine, give --replace to replace the stored keys")
+		}
+		log.Warnf("Replacing the host keys stored in the state")
+	}
+	if err := confirmHostKeys(yes, "Store these host keys? [y/N]: "); err != nil {
+		return err
+	}
+
+	sshConfig.PublicKeys = publicKeys
+	// Verify the keys before they are saved, so that the machine does not
+	// become unreachable.
+	if _, err := sshMachineClientFromSSHConfig(sshConfig); err != nil {
+		return fmt.Errorf("unable to connect to machine using the scanned host keys: %v", err)
+	}
+	pm.Spec.SSHConfig = sshConfig
+	if _, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Update(pm); err != nil {
+		return fmt.Errorf("unable to update provisioned machine %q: %v", pm.Name, err)
+	}
+	if err := state.PullFromAPIs(); err != nil {
+		return fmt.Errorf("unable to sync on-disk state: %v", err)
+	}
+	log.Printf("Stored %d host keys for machine %q", len(publicKeys), ip)
+	return nil
+}
+
+// scanNewMachineHostKeys retrieves the host keys of a machine that is not in
+// the state and, once they are confirmed, writes each to a file in outputDir,
+// to be given to create machine.
+func scanNewMachineHostKeys(ip string, port int, outputDir string, yes bool, timeout time.Duration) error {
+	keys, err := scanAndPrintHostKeys(ip, port, timeout)
+	if err != nil {
+		return err
+	}
+	if err := confirmHostKeys(yes, fmt.Sprintf("Write these host keys to %q? [y/N]: ", outputDir)); err != nil {
+		return err
+	}
+	var files []string
+	for _, key := range keys {
+		file := filepath.Join(outputDir, fmt.Sprintf("%s-%s.pub", ip, key.Type()))
+		if err := ioutil.WriteFile(file, ssh.MarshalAuthorizedKey(key), 0644); err != nil {
+			return fmt.Errorf("unable to write host key: %v", err)
+		}
+		files = append(files, file)
+	}
+	log.Printf("Machine %q is not in the state. Wrote its host keys to %s. Create the machine with: cctl create machine --ip %s --port %d --public-keys %s ...", ip, strings.Join(files, ", "), ip, port, strings.Join(files, ","))
+	return nil
+}
+
+// scanAndPrintHostKeys retrieves the host keys of the machine, through the
+// bastion of the cluster, if any, and prints their fingerprints.
+func scanAndPrintHostKeys(host string, port int, timeout time.Duration) ([]ssh.PublicKey, error) {
+	dial := sshutil.TCPDialer(timeout)
+	bastion, err := clusterBastion()
+	if err != nil {
+		return nil, err
+	}
+	if bastion != nil {
+		var bastionConn io.Closer
+		if dial, bastionConn, err = bastion.Dialer(timeout); err != nil {
+			return nil, err
+		}
+		defer bastionConn.Close()
+	}
+	keys, err := sshutil.ScanHostKeys(dial, host, port)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Host keys of %s:%d\n", host, port)
+	for _, key := range keys {
+		fmt.Printf("  %s %s\n", key.Type(), ssh.FingerprintSHA256(key))
+	}
+	return keys, nil
+}
+
+// confirmHostKeys asks the user to confirm the host keys, unless yes is true.
+func confirmHostKeys(yes bool, prompt string) error {
+	if yes {
+		return nil
+	}
+	ok, err := confirm(prompt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("host keys not confirmed")
+	}
+	return nil
+}
+
+func trimmedKeys(keys []string) []string {
+	trimmed := make([]string, len(keys))
+	for i, key := range keys {
+		trimmed[i] = strings.TrimSpace(key)
+	}
+	return trimmed
+}
+
+// confirm asks the user a yes or no question on the terminal. It fails if
+// stdin is not a terminal.
+func confirm(prompt string) (bool, error) {
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("unable to ask for confirmation: stdin is not a terminal, use --yes to confirm")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("unable to read answer: %v", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	scanCmd.AddCommand(hostKeysCmdScan)
+	hostKeysCmdScan.Flags().String("ip", "", "IP of the machine")
+	hostKeysCmdScan.MarkFlagRequired("ip")
+	hostKeysCmdScan.Flags().Bool("yes", false, "Store the host keys without asking for confirmation")
+	hostKeysCmdScan.Flags().Bool("replace", false, "Replace the host keys stored in the state if the machine presents other keys")
+	hostKeysCmdScan.Flags().Int("port", common.DefaultSSHPort, "SSH port of a machine that is not in the state yet. The port of a machine in the state is read from the state")
+	hostKeysCmdScan.Flags().String("output-dir", ".", "Directory to which the host keys of a machine that is not in the state yet are written")
+	hostKeysCmdScan.Flags().Duration("timeout", 10*time.Second, "Timeout for connecting to the machine")
+}
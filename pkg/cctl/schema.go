@@ -0,0 +1,108 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/schema"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema KIND",
+	Short: "Print the JSON Schema of a file cctl reads",
+	Long: `Print the JSON Schema of a kind of file cctl reads, for editors and CI to
+validate files before they are given to cctl. The kinds are:
+
+  manifest          the file of plan and apply
+  cluster           the file of create cluster --file
+  cluster-config    the file of create cluster --cluster-config
+  machine-defaults  the file of create cluster --machine-defaults
+
+cctl validates these files against their schema before it uses them. The
+state is not read.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		s, err := schema.ForKind(args[0])
+		if err != nil {
+			log.Fatalf("Unable to get schema: %v", err)
+		}
+		b, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			log.Fatalf("Unable to encode schema: %v", err)
+		}
+		b = append(b, '\n')
+		if file := cmd.Flag("output").Value.String(); len(file) != 0 {
+			if err := ioutil.WriteFile(file, b, 0644); err != nil {
+				log.Fatalf("Unable to write schema to %q: %v", file, err)
+			}
+			return
+		}
+		os.Stdout.Write(b)
+	},
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate KIND",
+	Short: "Validate a file against its JSON Schema",
+	Long: `Validate a file against the JSON Schema of its kind, as printed by schema.
+Every violation is reported with the JSON Pointer of the value, e.g.
+/machines/1/role. The command fails if the file is not valid. The state is not
+read.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file := cmd.Flag("file").Value.String()
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Unable to read %q: %v", file, err)
+		}
+		err = schema.ValidateKind(args[0], data)
+		if errs, ok := err.(schema.Errors); ok {
+			for _, e := range errs {
+				log.Errorf("%s: %v", file, e)
+			}
+			log.Fatalf("%s is not a valid %s: %d errors", file, args[0], len(errs))
+		}
+		if err != nil {
+			log.Fatalf("Unable to validate %q: %v", file, err)
+		}
+		log.Printf("%s is a valid %s", file, args[0])
+	},
+}
+
+// validateFileSchema validates the data, read from the file, against the
+// schema of the kind of file.
+func validateFileSchema(kind, file string, data []byte) error {
+	if err := schema.ValidateKind(kind, data); err != nil {
+		return fmt.Errorf("%s is not a valid %s: %v", file, kind, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+	schemaCmd.Flags().StringP("output", "o", "", "File to write the schema to. Defaults to stdout")
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringP("file", "f", "", "Location of the file to validate")
+	validateCmd.MarkFlagRequired("file")
+}
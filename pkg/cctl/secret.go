@@ -14,7 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
+package cctl
 
 import (
 	"fmt"
@@ -41,41 +41,41 @@ var secretCmdCreate = &cobra.Command{
 }
 
 func createSecretDefaults() error {
-	newAPIServerCASecret, err := secret.CreateCASecretDefault(common.DefaultAPIServerCASecretName)
+	newAPIServerCASecret, err := secret.CreateCASecretDefault(namespace, common.DefaultAPIServerCASecretName)
 	if err != nil {
 		return fmt.Errorf("unable to generate API server CA secret: %v", err)
 	}
-	newEtcdCASecret, err := secret.CreateCASecretDefault(common.DefaultEtcdCASecretName)
+	newEtcdCASecret, err := secret.CreateCASecretDefault(namespace, common.DefaultEtcdCASecretName)
 	if err != nil {
 		return fmt.Errorf("unable to generate etcd CA secret: %v", err)
 	}
-	newFrontProxyCASecret, err := secret.CreateCASecretDefault(common.DefaultFrontProxyCASecretName)
+	newFrontProxyCASecret, err := secret.CreateCASecretDefault(namespace, common.DefaultFrontProxyCASecretName)
 	if err != nil {
 		return fmt.Errorf("unable to generate front proxy CA secret: %v", err)
 	}
 
-	newServiceAccountKeySecret, err := secret.CreateSAKeySecretDefault(common.DefaultServiceAccountKeySecretName)
+	newServiceAccountKeySecret, err := secret.CreateSAKeySecretDefault(namespace, common.DefaultServiceAccountKeySecretName)
 	if err != nil {
 		return fmt.Errorf("unable to generate service account CA secret: %v", err)
 	}
-	newBootstrapTokenSecret, err := secret.CreateBootstrapTokenSecret(common.DefaultBootstrapTokenSecretName)
+	newBootstrapTokenSecret, err := secret.CreateBootstrapTokenSecret(namespace, common.DefaultBootstrapTokenSecretName)
 	if err != nil {
 		return fmt.Errorf("unable to generate bootstrap token CA secret: %v", err)
 	}
 
-	if _, err := state.KubeClient.CoreV1().Secrets(common.DefaultNamespace).Create(newAPIServerCASecret); err != nil {
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newAPIServerCASecret); err != nil {
 		return fmt.Errorf("unable to create API server CA secret: %v", err)
 	}
-	if _, err := state.KubeClient.CoreV1().Secrets(common.DefaultNamespace).Create(newEtcdCASecret); err != nil {
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newEtcdCASecret); err != nil {
 		return fmt.Errorf("unable to create etcd CA secret: %v", err)
 	}
-	if _, err := state.KubeClient.CoreV1().Secrets(common.DefaultNamespace).Create(newFrontProxyCASecret); err != nil {
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newFrontProxyCASecret); err != nil {
 		return fmt.Errorf("unable to create front proxy CA secret: %v", err)
 	}
-	if _, err := state.KubeClient.CoreV1().Secrets(common.DefaultNamespace).Create(newServiceAccountKeySecret); err != nil {
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newServiceAccountKeySecret); err != nil {
 		return fmt.Errorf("unable to create service account secret: %v", err)
 	}
-	if _, err := state.KubeClient.CoreV1().Secrets(common.DefaultNamespace).Create(newBootstrapTokenSecret); err != nil {
+	if _, err := state.KubeClient.CoreV1().Secrets(namespace).Create(newBootstrapTokenSecret); err != nil {
 		return fmt.Errorf("unable to create bootstrap token secret: %v", err)
 	}
 	return nil
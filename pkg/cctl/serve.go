@@ -0,0 +1,399 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/jobs"
+	"github.com/platform9/cctl/pkg/util/operror"
+	"github.com/platform9/cctl/pkg/util/serveauth"
+)
+
+// serveShutdownTimeout is how long requests in progress may take to complete
+// after serve is asked to stop.
+const serveShutdownTimeout = 10 * time.Second
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API that runs cluster operations as jobs",
+	Long: `Serve a REST API that runs cluster operations as asynchronous jobs, so that a
+web UI or an orchestrator can change the cluster without running cctl for
+every operation. Jobs run one at a time, in the order they are submitted. The
+state is locked, and the operation lease of the cluster held, only while a job
+runs, so cctl can be used alongside.
+
+  POST   /v1/machines          create a machine, e.g. {"ip": "10.0.0.10", "role": "node"}
+  DELETE /v1/machines/<ip>     delete a machine; query parameters force and skip-drain-delete
+  POST   /v1/etcd/recover      recover etcd from a snapshot, e.g. {"snapshot": "/var/backups/etcd.db"}
+  GET    /v1/jobs              list jobs
+  GET    /v1/jobs/<id>         get a job
+  GET    /v1/cluster           get the cluster
+  GET    /v1/machines          list machines
+  GET    /metrics              Prometheus metrics
+
+The metrics count machine creates and deletes, and SSH failures, and record
+their durations, the number of etcd members, and when the certificates on
+the masters and etcd machines expire. The certificates are checked by a job
+that runs every --certificate-check-interval.
+
+Operations respond with 202 Accepted and the job. Every request must have
+the header "Authorization: Bearer <token>", with the token in --token-file,
+which is created with a random token, readable only by its owner, if it does
+not exist. Requests with a body must have "Content-Type: application/json",
+and requests for a host other than --listen are refused, so that web pages
+cannot send requests to the API. By default, it is served only on the
+loopback interface.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// The state is opened by every job, not for the life of the server.
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		// The running job is let to complete when serve is interrupted.
+		interruptStopsCommands = false
+		listen := cmd.Flag("listen").Value.String()
+		maxPending, err := cmd.Flags().GetInt("max-pending-jobs")
+		if err != nil {
+			log.Fatalf("Unable to parse `max-pending-jobs`: %v", err)
+		}
+		if host, _, err := net.SplitHostPort(listen); err == nil {
+			if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+				log.Warnf("Serving the API on %q, which is not a loopback address. The API is served over plain HTTP, so the token can be read by anyone on the network.", listen)
+			}
+		}
+		tokenFile := cmd.Flag("token-file").Value.String()
+		if len(tokenFile) == 0 {
+			tokenFile = stateFilename + common.ServeTokenFileSuffix
+		}
+		token, created, err := serveauth.LoadOrCreateToken(tokenFile)
+		if err != nil {
+			log.Fatalf("Unable to read the API token: %v", err)
+		}
+		if created {
+			log.Printf("Created the API token in %q", tokenFile)
+		}
+
+		checkInterval, err := cmd.Flags().GetDuration("certificate-check-interval")
+		if err != nil {
+			log.Fatalf("Unable to parse `certificate-check-interval`: %v", err)
+		}
+
+		queue := jobs.NewQueue(maxPending)
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			queue.Run(stop)
+			close(stopped)
+		}()
+		if checkInterval > 0 {
+			go checkCertificatesPeriodically(queue, checkInterval, stop)
+		}
+		server := &http.Server{Addr: listen, Handler: serveauth.Handler(newServeHandler(queue), token, listen)}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-signals
+			log.Println("Stopping. Waiting for the running job, if any, to complete.")
+			ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+			defer cancel()
+			server.Shutdown(ctx)
+		}()
+
+		log.Printf("Serving the API on %q", listen)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatalf("Unable to serve the API: %v", err)
+		}
+		close(stop)
+		<-stopped
+	},
+}
+
+// runWithState opens the state, runs the operation, and closes the state, as
+// one invocation of cctl would. If the state file is in a repository, the
+// state is pulled before the operation, and pushed after it, even if it
+// fails, with the subject as the commit subject.
+func runWithState(subject string, operation func() error) error {
+	if err := pullGitState(); err != nil {
+		return err
+	}
+	if err := openState(); err != nil {
+		return err
+	}
+	defer closeState()
+	defer closeMachineClients()
+	err := operation()
+	if pushErr := pushGitState(operationCommitMessage(subject, nil, err != nil)); pushErr != nil {
+		if err != nil {
+			log.Errorf("Unable to push the state: %v", pushErr)
+			return err
+		}
+		return fmt.Errorf("unable to push the state: %v", pushErr)
+	}
+	return err
+}
+
+// readStateObjects reads the objects in the state file, without locking it,
+// and without changing the state used by jobs.
+func readStateObjects() (*cctlstate.State, error) {
+	s := cctlstate.NewWithFile(stateFilename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+	s.ReadOnly = true
+	s.Profile = runProfile
+	if err := configureStateSigning(s); err != nil {
+		return nil, err
+	}
+	if err := s.PushToAPIs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type createMachineRequest struct {
+	IP             string   `json:"ip"`
+	Port           int      `json:"port,omitempty"`
+	Role           string   `json:"role"`
+	Iface          string   `json:"iface,omitempty"`
+	PublicKeyFiles []string `json:"publicKeyFiles,omitempty"`
+}
+
+type recoverEtcdRequest struct {
+	Snapshot string `json:"snapshot"`
+}
+
+type serveError struct {
+	Error     string       `json:"error"`
+	ErrorKind operror.Kind `json:"errorKind"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnf("Unable to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	kind := operror.KindOf(err)
+	status := http.StatusInternalServerError
+	switch kind {
+	case operror.NotFound:
+		status = http.StatusNotFound
+	case operror.Invalid:
+		status = http.StatusBadRequest
+	case operror.Precondition:
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, serveError{Error: err.Error(), ErrorKind: kind})
+}
+
+// submit submits the operation as a job, and responds with the job.
+func submit(w http.ResponseWriter, queue *jobs.Queue, operation, target string, run func() error) {
+	job, err := queue.Submit(operation, target, func() error {
+		log.Printf("Running %s %s", operation, target)
+		failureHints.Reset()
+		subject := "cctl serve: " + operation + " " + target
+		return withFailureHints(withOperationLease(subject, func() error {
+			return runWithState(subject, run)
+		}))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusMethodNotAllowed, serveError{
+		Error:     fmt.Sprintf("method %s not allowed on %s", r.Method, r.URL.Path),
+		ErrorKind: operror.Invalid,
+	})
+}
+
+func newServeHandler(queue *jobs.Queue) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, queue.List())
+	})
+	mux.HandleFunc("/v1/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/v1/jobs/")
+		job, ok := queue.Get(id)
+		if !ok {
+			writeError(w, operror.New(operror.NotFound, "job %q not found", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("/v1/cluster", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		s, err := readStateObjects()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		for _, cluster := range s.ClusterList.Items {
+			if cluster.Namespace == namespace && cluster.Name == common.DefaultClusterName {
+				writeJSON(w, http.StatusOK, cluster)
+				return
+			}
+		}
+		writeError(w, operror.New(operror.NotFound, "no cluster found"))
+	})
+	mux.HandleFunc("/v1/machines", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s, err := readStateObjects()
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			machines := []clusterv1.Machine{}
+			for _, machine := range s.MachineList.Items {
+				if machine.Namespace == namespace {
+					machines = append(machines, machine)
+				}
+			}
+			writeJSON(w, http.StatusOK, machines)
+		case http.MethodPost:
+			var req createMachineRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, operror.New(operror.Invalid, "unable to decode request: %v", err))
+				return
+			}
+			if len(req.IP) == 0 {
+				writeError(w, operror.New(operror.Invalid, "no IP given"))
+				return
+			}
+			if req.Port == 0 {
+				req.Port = common.DefaultSSHPort
+			}
+			if len(req.Iface) == 0 {
+				req.Iface = common.DefaultVIPNetworkInterface
+			}
+			submit(w, queue, "create machine", req.IP, func() error {
+				return observeMachineOperation("create", func() error {
+					return createMachine(req.IP, req.Port, req.Iface, strings.Title(req.Role), req.PublicKeyFiles)
+				})
+			})
+		default:
+			methodNotAllowed(w, r)
+		}
+	})
+	mux.HandleFunc("/v1/machines/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			methodNotAllowed(w, r)
+			return
+		}
+		ip := strings.TrimPrefix(r.URL.Path, "/v1/machines/")
+		var flags [2]bool
+		for i, name := range []string{"force", "skip-drain-delete"} {
+			v := r.URL.Query().Get(name)
+			if len(v) == 0 {
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				writeError(w, operror.New(operror.Invalid, "unable to parse %s: %v", name, err))
+				return
+			}
+			flags[i] = b
+		}
+		submit(w, queue, "delete machine", ip, func() error {
+			return observeMachineOperation("delete", func() error {
+				return deleteMachine(ip, flags[0], flags[1])
+			})
+		})
+	})
+	mux.HandleFunc("/v1/etcd/recover", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		var req recoverEtcdRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, operror.New(operror.Invalid, "unable to decode request: %v", err))
+			return
+		}
+		submit(w, queue, "recover etcd", req.Snapshot, func() error {
+			return recoverEtcdFromSnapshot(req.Snapshot)
+		})
+	})
+	mux.Handle("/metrics", prometheus.UninstrumentedHandler())
+	return mux
+}
+
+// checkCertificatesPeriodically submits a job that checks the certificates on
+// the masters, at once, and then every interval, until stopped.
+func checkCertificatesPeriodically(queue *jobs.Queue, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := queue.Submit("check certificates", "", func() error {
+			return runWithState("cctl serve: check certificates", checkCertificateExpiries)
+		})
+		if err != nil {
+			log.Warnf("Unable to submit certificate check: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("listen", "127.0.0.1:7070", "Address to serve the API on")
+	serveCmd.Flags().String("token-file", "", "File with the bearer token of the API, created if it does not exist. Defaults to the state file with the suffix "+common.ServeTokenFileSuffix)
+	serveCmd.Flags().Int("max-pending-jobs", 100, "Maximum number of jobs waiting to run. Further jobs are refused")
+	serveCmd.Flags().Duration("certificate-check-interval", time.Hour, "How often to check when the certificates on the masters and etcd machines expire, for the metrics. Zero disables the check")
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/signature"
+)
+
+// signingKeyEnvVar is the default SSH private key file that signs the state,
+// e.g. set in the shell profile of operators in regulated environments.
+const signingKeyEnvVar = "CCTL_SIGNING_KEY"
+
+var signingKeyFile string
+var ignoreSignature bool
+
+// stateSigner is read from signingKeyFile the first time it is needed.
+var stateSigner ssh.Signer
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&signingKeyFile, "signing-key", os.Getenv(signingKeyEnvVar), "SSH private key that signs the state file every time it is written. The signature, kept next to the state file with suffix "+cctlstate.SignatureFileSuffix+", is verified every time the state file is read, and cctl refuses to use a state file changed without the key. Defaults to the value of "+signingKeyEnvVar)
+	rootCmd.PersistentFlags().BoolVar(&ignoreSignature, "ignore-signature", false, "use the state file even if its signature is missing or invalid, and sign it again, as it is, e.g. to sign an existing state file for the first time")
+}
+
+// configureStateSigning makes the state sign the state file, and verify its
+// signature, if a signing key is given.
+func configureStateSigning(s *cctlstate.State) error {
+	if len(signingKeyFile) == 0 {
+		return nil
+	}
+	if stateSigner == nil {
+		signer, err := signature.SignerFromFile(signingKeyFile)
+		if err != nil {
+			return err
+		}
+		stateSigner = signer
+	}
+	s.Signer = stateSigner
+	s.IgnoreSignature = ignoreSignature
+	return nil
+}
+
+// signIgnoredSignature logs the signature error that --ignore-signature
+// ignored, if any, and signs the state file as it is, unless the state is
+// read-only.
+func signIgnoredSignature(s *cctlstate.State) error {
+	if s.SignatureError == nil {
+		return nil
+	}
+	log.Warnf("Ignoring state signature: %v", s.SignatureError)
+	if s.ReadOnly {
+		return nil
+	}
+	if err := s.Sign(); err != nil {
+		return err
+	}
+	log.Printf("Signed state file %q", s.Filename)
+	return nil
+}
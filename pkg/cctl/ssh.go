@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// sshCmd represents the ssh command
+var sshCmd = &cobra.Command{
+	Use:   "ssh",
+	Short: "Used to open a shell on a resource",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("SSH called")
+	},
+}
+
+var machineCmdSSH = &cobra.Command{
+	Use:   "machine",
+	Short: "Open an interactive shell on a machine",
+	Long: `Open an interactive shell on a machine, or run a command, using the SSH
+credential and host keys in the state, and the bastion of the cluster, if it
+has one. The exit status of the command is the exit status of cctl.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		mustNotEnforceCommandAllowlist(cmd)
+		ip := cmd.Flag("ip").Value.String()
+		if len(ip) == 0 {
+			log.Fatalf("Must give --ip.")
+		}
+		command := cmd.Flag("command").Value.String()
+		machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				log.Fatalf("Machine %q not found.", ip)
+			}
+			log.Fatalf("Unable to get machine %q: %v", ip, err)
+		}
+		machineSpec, err := providerCodec.GetMachineSpec(*machine)
+		if err != nil {
+			log.Fatalf("Unable to decode machine spec: %v", err)
+		}
+		pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+		}
+		sshClient, err := dialMachine(pm.Spec.SSHConfig)
+		if err != nil {
+			log.Fatalf("Unable to connect to machine %q: %v", ip, err)
+		}
+		defer sshClient.Close()
+		err = sshutil.Shell(sshClient, command, os.Stdin, os.Stdout, os.Stderr)
+		if exitErr, ok := err.(*ssh.ExitError); ok {
+			sshClient.Close()
+			releaseOperationLease()
+			unlockState()
+			os.Exit(exitErr.ExitStatus())
+		}
+		if err != nil {
+			log.Fatalf("Unable to run shell on machine %q: %v", ip, err)
+		}
+	},
+}
+
+// dialMachine opens an SSH connection to the machine, using the SSH
+// credential and the bastion of the cluster, if it has one.
+func dialMachine(sshConfig *spv1.SSHConfig) (*ssh.Client, error) {
+	sshCredentialSecret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(sshConfig.CredentialSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("unable to find SSH credential %q", sshConfig.CredentialSecret.Name)
+		}
+		return nil, fmt.Errorf("unable to get SSH credential secret: %v", err)
+	}
+	username, privateKey, err := providerCodec.UsernameAndKeyFromSecret(sshCredentialSecret)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH credential from secret: %v", err)
+	}
+	privateKey, err = decryptSSHPrivateKey(privateKey, sshConfig.CredentialSecret.Name)
+	if err != nil {
+		return nil, err
+	}
+	var insecureIgnoreHostKey bool
+	if len(sshConfig.PublicKeys) == 0 {
+		insecureIgnoreHostKey = true
+		log.Printf("Not able to verify machine SSH identity: No public keys given. Continuing...")
+	}
+	bastion, err := clusterBastion()
+	if err != nil {
+		return nil, err
+	}
+	if bastion != nil {
+		return bastion.Dial(sshConfig.Host, sshConfig.Port, username, privateKey, sshConfig.PublicKeys, insecureIgnoreHostKey)
+	}
+	return sshutil.Dial(sshConfig.Host, sshConfig.Port, username, privateKey, sshConfig.PublicKeys, insecureIgnoreHostKey)
+}
+
+func init() {
+	rootCmd.AddCommand(sshCmd)
+	sshCmd.AddCommand(machineCmdSSH)
+	machineCmdSSH.Flags().String("ip", "", "IP of the machine")
+	machineCmdSSH.Flags().String("command", "", "Command to run instead of the login shell")
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/statebackup"
+)
+
+var (
+	// stateBackupDir receives a copy of the state file before every command
+	// changes it.
+	stateBackupDir string
+	// stateBackups is the number of copies kept.
+	stateBackups int
+)
+
+var stateCmdListBackups = &cobra.Command{
+	Use:   "list-backups",
+	Short: "Display the copies of the state made before it was changed",
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := statebackup.List(stateFilename, stateBackupDirectory())
+		if err != nil {
+			log.Fatalf("Unable to list state backups: %v", err)
+		}
+		switch outputFmt := cmd.Flag("output").Value.String(); outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(backups)
+			if err != nil {
+				log.Fatalf("Unable to marshal state backups to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(backups)
+			if err != nil {
+				log.Fatalf("Unable to marshal state backups to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("StateBackupPrintTemplate").Parse(common.StateBackupPrintTemplate))
+			if err := t.Execute(os.Stdout, backups); err != nil {
+				log.Fatalf("Could not pretty print state backups: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+	},
+}
+
+var stateCmdRestoreBackup = &cobra.Command{
+	Use:   "restore-backup [BACKUP]",
+	Short: "Revert the state to a copy made before it was changed",
+	Long: `Revert the state to a copy made before it was changed.
+
+Before a command first changes the state file, it copies the state file, and
+its signature, to --state-backup-dir, as <state file>.bak-<time>. The newest
+--state-backups copies are kept.
+
+The given copy, by default the newest, replaces the state file. The state file
+is itself copied first, so the restore can be reverted too. Only the state is
+reverted, not the machines or the cluster; use state diff --against-live to
+compare the restored state to them.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := lockState(); err != nil {
+			log.Fatalf("Unable to restore state backup: %v", err)
+		}
+		dir := stateBackupDirectory()
+		backups, err := statebackup.List(stateFilename, dir)
+		if err != nil {
+			log.Fatalf("Unable to list state backups: %v", err)
+		}
+		var backup string
+		switch {
+		case len(args) == 1:
+			backup = args[0]
+			if _, err := os.Stat(backup); os.IsNotExist(err) && !filepath.IsAbs(backup) {
+				backup = filepath.Join(dir, backup)
+			}
+			if _, err := os.Stat(backup); err != nil {
+				log.Fatalf("Unable to read state backup: %v", err)
+			}
+		case len(backups) == 0:
+			log.Fatalf("No state backups found in %q", dir)
+		default:
+			backup = backups[0].Path
+		}
+		// The copy is made even if backups are disabled, since the state
+		// file is replaced.
+		retain := stateBackups
+		if retain < len(backups)+1 {
+			retain = len(backups) + 1
+		}
+		previous, err := statebackup.Snapshot(stateFilename, cctlstate.SignatureFileSuffix, dir, retain, time.Now())
+		if err != nil {
+			log.Fatalf("Unable to back up state: %v", err)
+		}
+		if len(previous) != 0 {
+			log.Printf("[restore-backup] Copied the state to %q", previous)
+		}
+		if err := statebackup.Restore(backup, stateFilename, cctlstate.SignatureFileSuffix); err != nil {
+			log.Fatalf("Unable to restore state backup: %v", err)
+		}
+		log.Printf("[restore-backup] Restored %q to %q", backup, stateFilename)
+		if _, err := os.Stat(backup + cctlstate.SignatureFileSuffix); os.IsNotExist(err) && len(signingKeyFile) != 0 {
+			s := cctlstate.NewWithFile(stateFilename, nil, nil, nil)
+			if err := configureStateSigning(s); err != nil {
+				log.Fatalf("Unable to read signing key: %v", err)
+			}
+			if err := s.Sign(); err != nil {
+				log.Fatalf("Unable to sign cctl state: %v", err)
+			}
+			log.Printf("[restore-backup] Signed cctl state")
+		}
+	},
+}
+
+// stateBackupDirectory returns --state-backup-dir, by default the state
+// filename with a suffix, so that state files in one directory keep their
+// copies apart.
+func stateBackupDirectory() string {
+	if len(stateBackupDir) != 0 {
+		return stateBackupDir
+	}
+	return stateFilename + common.StateBackupDirSuffix
+}
+
+// configureStateBackup makes the state copy the state file before it is
+// first written, unless backups are disabled.
+func configureStateBackup(s *cctlstate.State) {
+	if stateBackups <= 0 {
+		return
+	}
+	s.BackupDir = stateBackupDirectory()
+	s.BackupRetain = stateBackups
+}
+
+func init() {
+	stateCmd.AddCommand(stateCmdListBackups)
+	stateCmd.AddCommand(stateCmdRestoreBackup)
+	stateCmdListBackups.Flags().StringP("output", "o", "", "Output format yaml|json. Defaults to text")
+	rootCmd.PersistentFlags().StringVar(&stateBackupDir, "state-backup-dir", "", "directory that receives a copy of the state file before every command changes it. Defaults to the state file with the suffix "+common.StateBackupDirSuffix)
+	rootCmd.PersistentFlags().IntVar(&stateBackups, "state-backups", common.DefaultStateBackups, "number of copies of the state file kept in --state-backup-dir. Zero disables the copies")
+}
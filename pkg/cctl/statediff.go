@@ -0,0 +1,314 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeclientfake "k8s.io/client-go/kubernetes/fake"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/archive"
+	etcdutil "github.com/platform9/cctl/pkg/util/etcd"
+	"github.com/platform9/cctl/pkg/util/nodestatus"
+	"github.com/platform9/cctl/pkg/util/statediff"
+)
+
+const (
+	// currentStateVersion names the state file given by --state.
+	currentStateVersion = "current"
+	// liveStateVersion names what runs on the machines and the cluster.
+	liveStateVersion = "live"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect versions of the state",
+	// The state files are read as they are, so the state lock is not needed.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+}
+
+var stateCmdDiff = &cobra.Command{
+	Use:   "diff [STATE_FILE]",
+	Short: "Report the changes between two versions of the state",
+	Long: `Report the changes between two versions of the state, for change audits:
+machines added and removed, etcd members added and removed, certificates
+rotated, secrets added, removed, or changed, and fields of the spec, labels,
+and annotations of the cluster, machines, and provisioned machines changed.
+Secret values are never reported.
+
+--from and --to are each a state file, an archive created by backup, or
+"current", the state file given by --state, whose signature is verified if
+--signing-key is given. The last contact annotations of machines are ignored.
+A state file given as an argument is compared to the current state, e.g.
+before restoring it:
+
+  cctl state diff state.yaml.backup
+
+With --against-live, the state given by --from, by default the current state,
+is compared to what runs on the machines and the cluster: the nodes of the
+cluster, their roles and kubelet versions, the members of the etcd cluster,
+and the CA certificates on a master.
+
+The report is printed as text, or as JSON or YAML with -o, for submission to
+change audits.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		from := cmd.Flag("from").Value.String()
+		to := cmd.Flag("to").Value.String()
+		againstLive, err := cmd.Flags().GetBool("against-live")
+		if err != nil {
+			log.Fatalf("Unable to parse --against-live: %v", err)
+		}
+		if len(args) == 1 {
+			if cmd.Flags().Changed("from") {
+				log.Fatalf("Give either a state file or --from, not both")
+			}
+			from = args[0]
+		}
+		if againstLive {
+			if cmd.Flags().Changed("to") {
+				log.Fatalf("--to cannot be used with --against-live")
+			}
+			if from == "" {
+				from = currentStateVersion
+			}
+			to = liveStateVersion
+		}
+		if from == "" {
+			log.Fatalf("Give a state file to compare to the current state, --from, or --against-live")
+		}
+		fromState, err := readStateVersion(from)
+		if err != nil {
+			log.Fatalf("Unable to read %q: %v", from, err)
+		}
+		var report *statediff.Report
+		if againstLive {
+			timeout, err := cmd.Flags().GetDuration("timeout")
+			if err != nil {
+				log.Fatalf("Unable to parse --timeout: %v", err)
+			}
+			initState()
+			live, err := liveState(timeout)
+			if err != nil {
+				log.Fatalf("Unable to read the machines and the cluster: %v", err)
+			}
+			report, err = statediff.CompareLive(from, fromState, to, live)
+			if err != nil {
+				log.Fatalf("Unable to compare %q to %q: %v", from, to, err)
+			}
+		} else {
+			toState, err := readStateVersion(to)
+			if err != nil {
+				log.Fatalf("Unable to read %q: %v", to, err)
+			}
+			report, err = statediff.Compare(from, fromState, to, toState)
+			if err != nil {
+				log.Fatalf("Unable to compare %q to %q: %v", from, to, err)
+			}
+		}
+		switch outputFmt := cmd.Flag("output").Value.String(); outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(report)
+			if err != nil {
+				log.Fatalf("Unable to marshal report to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(report)
+			if err != nil {
+				log.Fatalf("Unable to marshal report to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("StateDiffPrintTemplate").Parse(common.StateDiffPrintTemplate))
+			if err := t.Execute(os.Stdout, report); err != nil {
+				log.Fatalf("Could not pretty print report: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+	},
+}
+
+// readStateVersion reads the objects of a state file, the state file of an
+// archive created by backup, or, if the version is current, the state file
+// given by --state. No file is changed.
+func readStateVersion(version string) (*cctlstate.State, error) {
+	filename := version
+	if version == currentStateVersion {
+		filename = stateFilename
+	}
+	isArchive, err := isGzipFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isArchive {
+		tempDir, err := ioutil.TempDir(os.TempDir(), "cctl")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create temporary directory: %v", err)
+		}
+		defer os.RemoveAll(tempDir)
+		filename = filepath.Join(tempDir, "state.yaml")
+		if err := archive.ExtractState(version, filename); err != nil {
+			return nil, fmt.Errorf("unable to extract state from archive: %v", err)
+		}
+	}
+	s := cctlstate.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+	s.ReadOnly = true
+	if version == currentStateVersion {
+		if err := configureStateSigning(s); err != nil {
+			return nil, err
+		}
+		if err := configureSecretStore(s); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.PushToAPIs(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// liveState returns what runs on the machines and the cluster of the
+// namespace. Nodes are named by the machines they run on. The etcd members
+// and the CA certificates are read from the first master.
+func liveState(timeout time.Duration) (statediff.Live, error) {
+	live := statediff.Live{Namespace: namespace, Certificates: map[string][]byte{}}
+	nodes, err := listClusterNodes(timeout)
+	if err != nil {
+		return live, err
+	}
+	machines, err := nodeMachines()
+	if err != nil {
+		return live, err
+	}
+	machineOfNode := make(map[string]string)
+	for _, s := range nodestatus.Match(machines, nodes) {
+		if s.Machine != "" && s.Node != "" {
+			machineOfNode[s.Node] = s.Machine
+		}
+	}
+	for _, n := range nodes {
+		name, ok := machineOfNode[n.Name]
+		if !ok {
+			name = n.Name
+		}
+		role := clustercommon.NodeRole
+		if _, ok := n.Labels[common.LabelNodeRoleMaster]; ok {
+			role = clustercommon.MasterRole
+		}
+		live.Nodes = append(live.Nodes, statediff.Machine{Name: name, Roles: []string{string(role)}, Kubelet: n.Status.NodeInfo.KubeletVersion})
+	}
+
+	masters, err := masterMachines()
+	if err != nil {
+		return live, err
+	}
+	if len(masters) == 0 {
+		return live, fmt.Errorf("cluster has no masters")
+	}
+	client, err := machineClientForMachine(&masters[0])
+	if err != nil {
+		return live, fmt.Errorf("unable to create machine client for machine %q: %v", masters[0].Name, err)
+	}
+	cmd := fmt.Sprintf("%s member list -w json", common.EtcdctlFile)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return live, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	if live.EtcdMembers, err = etcdutil.ParseMemberList(stdOut); err != nil {
+		return live, err
+	}
+
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return live, fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return live, fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	certificates := []struct {
+		secret *corev1.LocalObjectReference
+		path   string
+	}{
+		{clusterSpec.APIServerCASecret, path.Join(common.KubernetesPKIDir, "ca.crt")},
+		{clusterSpec.FrontProxyCASecret, path.Join(common.KubernetesPKIDir, "front-proxy-ca.crt")},
+		{clusterSpec.EtcdCASecret, path.Join(common.EtcdPKIDir, "ca.crt")},
+	}
+	for _, c := range certificates {
+		if c.secret == nil {
+			continue
+		}
+		data, err := client.ReadFile(c.path)
+		if err != nil {
+			return live, fmt.Errorf("unable to read %q from machine %q: %v", c.path, masters[0].Name, err)
+		}
+		live.Certificates[c.secret.Name] = data
+	}
+	return live, nil
+}
+
+// isGzipFile returns true if the file starts with the gzip magic number, as
+// archives created by backup do.
+func isGzipFile(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	n, err := f.Read(magic)
+	if err != nil && n == 0 {
+		// An empty state file is not an archive.
+		return false, nil
+	}
+	return bytes.Equal(magic[:n], []byte{0x1f, 0x8b}), nil
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateCmdDiff)
+	stateCmdDiff.Flags().String("from", "", "Version of the state to compare from: a state file, an archive created by backup, or \"current\"")
+	stateCmdDiff.Flags().String("to", currentStateVersion, "Version of the state to compare to: a state file, an archive created by backup, or \"current\"")
+	stateCmdDiff.Flags().Bool("against-live", false, "Compare the state given by --from, by default the current state, to what runs on the machines and the cluster")
+	stateCmdDiff.Flags().Duration("timeout", 30*time.Second, "Time to wait for the API server to list the nodes, with --against-live")
+	stateCmdDiff.Flags().StringP("output", "o", "", "Output format yaml|json. Defaults to text")
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	capiutil "github.com/platform9/cctl/pkg/util/clusterapi"
+	"github.com/platform9/cctl/pkg/util/stateverify"
+)
+
+var stateCmdVerify = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the consistency of the objects in the state",
+	Long: `Check the referential integrity of the objects in the state:
+
+  - every machine references an existing provisioned machine, bound to it;
+  - every provisioned machine references an existing SSH credential, and is
+    referenced by a machine;
+  - the cluster references existing CA, service account key, and bootstrap
+    token secrets;
+  - the etcd members of the cluster status match the etcd members of the
+    statuses of the machines that run etcd;
+  - every secret is referenced, or created by cctl.
+
+Errors make commands that use the objects fail; warnings do not. With
+--repair, the problems that can be repaired from the state alone are
+repaired: provisioned machines are bound to the machines that reference them,
+the etcd members of the cluster status are replaced with the members of the
+machine statuses, and provisioned machines and secrets that nothing references
+are deleted. Back up the state file first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initState()
+		repair, err := cmd.Flags().GetBool("repair")
+		if err != nil {
+			log.Fatalf("Unable to parse --repair: %v", err)
+		}
+		o, err := stateVerifyObjects()
+		if err != nil {
+			log.Fatalf("Unable to read the state: %v", err)
+		}
+		problems := stateverify.Verify(o)
+		if repair {
+			repaired, err := repairState(o, problems)
+			if err != nil {
+				log.Fatalf("Unable to repair the state: %v", err)
+			}
+			if repaired != 0 {
+				if err := state.PullFromAPIs(); err != nil {
+					log.Fatalf("Unable to sync on-disk state: %v", err)
+				}
+				log.Printf("[verify] Repaired %d problems", repaired)
+				if o, err = stateVerifyObjects(); err != nil {
+					log.Fatalf("Unable to read the state: %v", err)
+				}
+				problems = stateverify.Verify(o)
+			}
+		}
+		switch outputFmt := cmd.Flag("output").Value.String(); outputFmt {
+		case "yaml":
+			bytes, err := yaml.Marshal(problems)
+			if err != nil {
+				log.Fatalf("Unable to marshal problems to yaml: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "json":
+			bytes, err := json.Marshal(problems)
+			if err != nil {
+				log.Fatalf("Unable to marshal problems to json: %s", err)
+			}
+			os.Stdout.Write(bytes)
+		case "":
+			t := template.Must(template.New("StateVerifyPrintTemplate").Parse(common.StateVerifyPrintTemplate))
+			if err := t.Execute(os.Stdout, problems); err != nil {
+				log.Fatalf("Could not pretty print problems: %s", err)
+			}
+		default:
+			log.Fatalf("Unsupported output format %q", outputFmt)
+		}
+		if n := stateverify.Errors(problems); n != 0 {
+			log.Fatalf("The state has %d errors", n)
+		}
+	},
+}
+
+// stateVerifyObjects returns the objects of the namespace, with the provider
+// specs and statuses of the cluster and machines decoded. A machine whose
+// provider spec cannot be decoded has a nil spec.
+func stateVerifyObjects() (stateverify.Objects, error) {
+	var o stateverify.Objects
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return o, fmt.Errorf("unable to get cluster: %v", err)
+	default:
+		o.Cluster = cluster
+		if o.ClusterSpec, err = providerCodec.GetClusterSpec(*cluster); err != nil {
+			return o, fmt.Errorf("unable to decode cluster spec: %v", err)
+		}
+		if o.ClusterStatus, err = providerCodec.GetClusterStatus(*cluster); err != nil {
+			return o, fmt.Errorf("unable to decode cluster status: %v", err)
+		}
+	}
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return o, fmt.Errorf("unable to list machines: %v", err)
+	}
+	for _, m := range machineList.Items {
+		vm := stateverify.Machine{Machine: m}
+		if vm.Spec, err = providerCodec.GetMachineSpec(m); err != nil {
+			log.Debugf("Unable to decode spec of machine %q: %v", m.Name, err)
+			vm.Spec = nil
+		}
+		if vm.Status, err = providerCodec.GetMachineStatus(m); err != nil {
+			log.Debugf("Unable to decode status of machine %q: %v", m.Name, err)
+			vm.Status = nil
+		}
+		o.Machines = append(o.Machines, vm)
+	}
+	pmList, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return o, fmt.Errorf("unable to list provisioned machines: %v", err)
+	}
+	o.ProvisionedMachines = pmList.Items
+	secretList, err := state.KubeClient.CoreV1().Secrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return o, fmt.Errorf("unable to list secrets: %v", err)
+	}
+	o.Secrets = secretList.Items
+	return o, nil
+}
+
+// repairState repairs the problems that can be repaired, and returns how many
+// were repaired.
+func repairState(o stateverify.Objects, problems []stateverify.Problem) (int, error) {
+	repaired := 0
+	for _, p := range problems {
+		if p.Repair == stateverify.RepairNone {
+			continue
+		}
+		name := p.Object[strings.Index(p.Object, "/")+1:]
+		var err error
+		switch p.Repair {
+		case stateverify.RepairBind:
+			err = rebindProvisionedMachine(o, name)
+		case stateverify.RepairEtcdMembers:
+			_, err = capiutil.UpdateClusterStatus(state.ClusterClient, namespace, name, func(c *clusterv1.Cluster) error {
+				clusterStatus, err := providerCodec.GetClusterStatus(*c)
+				if err != nil {
+					return fmt.Errorf("unable to decode cluster status: %v", err)
+				}
+				clusterStatus.EtcdMembers = stateverify.EtcdMembers(o)
+				return providerCodec.PutClusterStatus(*clusterStatus, c)
+			})
+		case stateverify.RepairDeleteProvisionedMachine:
+			err = state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Delete(name, &metav1.DeleteOptions{})
+		case stateverify.RepairDeleteSecret:
+			err = state.KubeClient.CoreV1().Secrets(namespace).Delete(name, &metav1.DeleteOptions{})
+		default:
+			err = fmt.Errorf("unknown repair %q", p.Repair)
+		}
+		if err != nil {
+			return repaired, fmt.Errorf("unable to repair %s: %v", p.Object, err)
+		}
+		log.Printf("[verify] Repaired %s: %s", p.Object, p.Message)
+		repaired++
+	}
+	return repaired, nil
+}
+
+// rebindProvisionedMachine binds the provisioned machine to the machine that
+// references it.
+func rebindProvisionedMachine(o stateverify.Objects, pmName string) error {
+	for _, m := range o.Machines {
+		if m.Spec == nil || m.Spec.ProvisionedMachineName != pmName {
+			continue
+		}
+		machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(m.Machine.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get machine %q: %v", m.Machine.Name, err)
+		}
+		pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(pmName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get provisioned machine %q: %v", pmName, err)
+		}
+		if err := providerCodec.BindMachineAndProvisionedMachine(machine, pm); err != nil {
+			return fmt.Errorf("unable to bind machine %q to provisioned machine %q: %v", machine.Name, pmName, err)
+		}
+		if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine); err != nil {
+			return fmt.Errorf("unable to update machine %q: %v", machine.Name, err)
+		}
+		if _, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Update(pm); err != nil {
+			return fmt.Errorf("unable to update provisioned machine %q: %v", pmName, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no machine references provisioned machine %q", pmName)
+}
+
+func init() {
+	stateCmd.AddCommand(stateCmdVerify)
+	stateCmdVerify.Flags().Bool("repair", false, "Repair the problems that can be repaired from the state alone")
+	stateCmdVerify.Flags().StringP("output", "o", "", "Output format yaml|json. Defaults to text")
+}
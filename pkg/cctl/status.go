@@ -0,0 +1,416 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+	etcdutil "github.com/platform9/cctl/pkg/util/etcd"
+	"github.com/platform9/cctl/pkg/util/usage"
+)
+
+const (
+	statusUnknown       = "Unknown"
+	statusNotApplicable = "-"
+)
+
+var (
+	showUsage    bool
+	topPodsCount int
+)
+
+// machineHealth is the health of a machine and the cluster components it
+// runs.
+type machineHealth struct {
+	Name       string
+	Roles      []clustercommon.MachineRole
+	Reachable  bool
+	Kubelet    string
+	APIServer  string
+	Etcd       string
+	NodeReady  string
+	EtcdMember string
+	VIPOwner   string
+}
+
+// machineUsage is a point-in-time snapshot of the resources used on a
+// machine, and the pods on its node that use the most CPU.
+type machineUsage struct {
+	Name         string
+	CPU          string
+	Memory       string
+	Disk         string
+	TopPods      []usage.PodUsage
+	TopPodsError string
+}
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Used to get status of the cluster",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get cluster: %v", err)
+		}
+		clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+		if err != nil {
+			log.Fatalf("Unable to decode cluster spec: %v", err)
+		}
+		var vip string
+		if clusterSpec.VIPConfiguration != nil {
+			vip = clusterSpec.VIPConfiguration.IP
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+
+		results := checkMachinesHealth(machineList.Items, vip, make(map[string]sshmachine.Client))
+		// Every machine was contacted, so its reachability is recorded, as by
+		// status machine.
+		for i := range machineList.Items {
+			machine := &machineList.Items[i]
+			recordReachability(machine, results[i].Reachable)
+			if _, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Update(machine); err != nil {
+				log.Fatalf("Unable to update machine %q: %v", machine.Name, err)
+			}
+		}
+		// In read-only mode, the reachability is reported, but not recorded.
+		if err := state.PullFromAPIs(); err != nil && err != cctlstate.ErrReadOnly {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		t := template.Must(template.New("ClusterStatusPrintTemplate").Parse(common.ClusterStatusPrintTemplate))
+		if err := t.Execute(os.Stdout, results); err != nil {
+			log.Fatalf("Could not pretty print cluster status: %s", err)
+		}
+	},
+}
+
+// checkMachinesHealth checks the health of every machine, and of the etcd
+// member of every machine as reported by the etcd cluster. The clients, keyed
+// by machine name, are used to reach the machines; the clients of machines
+// that are reached for the first time are added to them.
+func checkMachinesHealth(machines []clusterv1.Machine, vip string, clients map[string]sshmachine.Client) []machineHealth {
+	var etcdHealth *etcdutil.EndpointHealth
+	results := make([]machineHealth, 0, len(machines))
+	for i := range machines {
+		machine := &machines[i]
+		health, machineClient := checkMachineHealth(machine, vip, clients[machine.Name])
+		if machineClient != nil {
+			clients[machine.Name] = machineClient
+		}
+		if machineClient != nil && etcdHealth == nil && clusterapi.RunsEtcd(*machine) {
+			if h, err := etcdEndpointHealth(machineClient); err != nil {
+				log.Debugf("Unable to check etcd cluster health from machine %q: %v", machine.Name, err)
+			} else {
+				etcdHealth = &h
+			}
+		}
+		results = append(results, health)
+	}
+	for i := range machines {
+		results[i].EtcdMember = etcdMemberHealth(&machines[i], etcdHealth)
+	}
+	return results
+}
+
+// checkMachineHealth checks the state of the cluster components on the
+// machine, using the client, or a new client if it is nil. If the machine is
+// reachable, the client used to reach it is returned.
+func checkMachineHealth(machine *clusterv1.Machine, vip string, machineClient sshmachine.Client) (machineHealth, sshmachine.Client) {
+	health := machineHealth{
+		Name:      machine.Name,
+		Roles:     machine.Spec.Roles,
+		Kubelet:   statusUnknown,
+		APIServer: statusNotApplicable,
+		Etcd:      statusNotApplicable,
+		NodeReady: statusUnknown,
+		VIPOwner:  statusNotApplicable,
+	}
+	isMaster := clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles)
+	if isMaster {
+		health.APIServer = statusUnknown
+		health.Etcd = statusUnknown
+		if len(vip) != 0 {
+			health.VIPOwner = statusUnknown
+		}
+	}
+	// Etcd machines have no node.
+	etcdOnly := isEtcdMachine(machine)
+	if etcdOnly {
+		health.Kubelet = statusNotApplicable
+		health.NodeReady = statusNotApplicable
+		health.Etcd = statusUnknown
+	}
+
+	if machineClient == nil {
+		var err error
+		machineClient, err = machineClientForMachine(machine)
+		if err != nil {
+			log.Debugf("Unable to create machine client for machine %q: %v", machine.Name, err)
+			return health, nil
+		}
+	}
+	health.Reachable = true
+
+	if etcdOnly {
+		health.Etcd = serviceState("etcd", machineClient)
+		return health, machineClient
+	}
+	health.Kubelet = serviceState("kubelet", machineClient)
+	if nodeName, err := nodeNameForMachine(machine.Name, machineClient); err == nil && len(nodeName) != 0 {
+		health.NodeReady = nodeReadyCondition(nodeName, machineClient)
+	}
+	if isMaster {
+		health.Etcd = serviceState("etcd", machineClient)
+		if _, err := identifyDockerContainer([]string{common.DockerKubeAPIServerNameFilter, common.DockerRunningStatusFilter}, machineClient); err != nil {
+			health.APIServer = "not running"
+		} else {
+			health.APIServer = "running"
+		}
+		if len(vip) != 0 {
+			health.VIPOwner = fmt.Sprintf("%v", ownsIP(vip, machineClient))
+		}
+	}
+	return health, machineClient
+}
+
+// serviceState returns the state of the service, e.g. active or inactive.
+func serviceState(service string, machineClient sshmachine.Client) string {
+	// systemctl exits with a non-zero status if the service is not active, but
+	// still reports its state.
+	stdOut, _, _ := machineClient.RunCommand(hostOS(machineClient).ServiceStateCommand(service))
+	if out := strings.TrimSpace(string(stdOut)); len(out) != 0 {
+		return out
+	}
+	return statusUnknown
+}
+
+func nodeReadyCondition(nodeName string, machineClient sshmachine.Client) string {
+	cmd := fmt.Sprintf(`%s --kubeconfig=%s get node %s -ojsonpath='{.status.conditions[?(@.type=="Ready")].status}'`, common.KubectlFile, common.KubeletKubeconfig, nodeName)
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		log.Debugf("Error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		return statusUnknown
+	}
+	return strings.TrimSpace(string(stdOut))
+}
+
+func ownsIP(ip string, machineClient sshmachine.Client) bool {
+	stdOut, _, err := machineClient.RunCommand("ip -o addr show")
+	if err != nil {
+		return false
+	}
+	for _, field := range strings.Fields(string(stdOut)) {
+		if strings.SplitN(field, "/", 2)[0] == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// etcdMemberHealth returns the health of the etcd member on the machine, as
+// reported by the etcd cluster.
+func etcdMemberHealth(machine *clusterv1.Machine, etcdHealth *etcdutil.EndpointHealth) string {
+	machineStatus, err := providerCodec.GetMachineStatus(*machine)
+	if err != nil || machineStatus.EtcdMember == nil {
+		return statusNotApplicable
+	}
+	if etcdHealth == nil {
+		return statusUnknown
+	}
+	for _, url := range machineStatus.EtcdMember.ClientURLs {
+		for _, healthy := range etcdHealth.Healthy {
+			if url == healthy {
+				return "healthy"
+			}
+		}
+		for _, unhealthy := range etcdHealth.Unhealthy {
+			if url == unhealthy {
+				return "unhealthy"
+			}
+		}
+	}
+	return statusUnknown
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
+
+// machineUsages returns the usage of every reachable machine. Pod usage is
+// read from a master, and requires the metrics API.
+func machineUsages(machines []clusterv1.Machine, reachability []machineReachability, n int) []machineUsage {
+	var masterClient sshmachine.Client
+	var podUsages []usage.PodUsage
+	var podUsagesErr error
+	if _, pm, err := masterMachineAndProvisionedMachine(); err != nil {
+		podUsagesErr = fmt.Errorf("unable to find a master: %v", err)
+	} else if masterClient, err = sshMachineClientFromSSHConfig(pm.Spec.SSHConfig); err != nil {
+		podUsagesErr = fmt.Errorf("unable to create master client: %v", err)
+	} else {
+		podUsages, podUsagesErr = topPods(masterClient)
+	}
+
+	var usages []machineUsage
+	for i := range machines {
+		if !reachability[i].Reachable {
+			continue
+		}
+		machine := &machines[i]
+		u := machineUsage{
+			Name:   machine.Name,
+			CPU:    statusUnknown,
+			Memory: statusUnknown,
+			Disk:   statusUnknown,
+		}
+		machineClient, err := machineClientForMachine(machine)
+		if err != nil {
+			log.Debugf("Unable to create machine client for machine %q: %v", machine.Name, err)
+			usages = append(usages, u)
+			continue
+		}
+		if cpu, err := cpuPercent(machineClient); err != nil {
+			log.Debugf("Unable to read CPU usage of machine %q: %v", machine.Name, err)
+		} else {
+			u.CPU = fmt.Sprintf("%.1f%%", cpu)
+		}
+		if m, err := memoryUsage(machineClient); err != nil {
+			log.Debugf("Unable to read memory usage of machine %q: %v", machine.Name, err)
+		} else {
+			u.Memory = formatUsage(m.Used(), m.Total)
+		}
+		if d, err := diskUsage(machineClient); err != nil {
+			log.Debugf("Unable to read disk usage of machine %q: %v", machine.Name, err)
+		} else {
+			u.Disk = formatUsage(d.Used, d.Total)
+		}
+		// Etcd machines have no node, so no pods.
+		if isEtcdMachine(machine) {
+			usages = append(usages, u)
+			continue
+		}
+		if podUsagesErr != nil {
+			u.TopPodsError = podUsagesErr.Error()
+		} else if nodeName, err := nodeNameForMachine(machine.Name, machineClient); err != nil || len(nodeName) == 0 {
+			u.TopPodsError = fmt.Sprintf("unable to find the node of machine %q", machine.Name)
+		} else if names, err := podsOnNode(nodeName, masterClient); err != nil {
+			u.TopPodsError = err.Error()
+		} else {
+			u.TopPods = usage.TopPods(podUsages, names, n)
+		}
+		usages = append(usages, u)
+	}
+	return usages
+}
+
+func formatUsage(used, total uint64) string {
+	var percent float64
+	if total != 0 {
+		percent = 100 * float64(used) / float64(total)
+	}
+	return fmt.Sprintf("%s/%s (%.0f%%)", usage.FormatBytes(used), usage.FormatBytes(total), percent)
+}
+
+// cpuPercent samples the CPU times of the machine one second apart.
+func cpuPercent(machineClient sshmachine.Client) (float64, error) {
+	cmd := "head -n1 /proc/stat; sleep 1; head -n1 /proc/stat"
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return 0, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	lines := strings.Split(strings.TrimSpace(string(stdOut)), "\n")
+	if len(lines) != 2 {
+		return 0, fmt.Errorf("unexpected output of %q: %q", cmd, string(stdOut))
+	}
+	before, err := usage.ParseCPUTimes(lines[0])
+	if err != nil {
+		return 0, err
+	}
+	after, err := usage.ParseCPUTimes(lines[1])
+	if err != nil {
+		return 0, err
+	}
+	return usage.CPUPercent(before, after), nil
+}
+
+func memoryUsage(machineClient sshmachine.Client) (usage.Memory, error) {
+	cmd := "cat /proc/meminfo"
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return usage.Memory{}, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return usage.ParseMemInfo(stdOut)
+}
+
+func diskUsage(machineClient sshmachine.Client) (usage.Disk, error) {
+	cmd := "df -P -k /"
+	stdOut, stdErr, err := machineClient.RunCommand(cmd)
+	if err != nil {
+		return usage.Disk{}, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return usage.ParseDF(stdOut)
+}
+
+// topPods returns the usage of all pods in the cluster, as reported by the
+// metrics API.
+func topPods(masterClient sshmachine.Client) ([]usage.PodUsage, error) {
+	cmd := fmt.Sprintf("%s --kubeconfig=%s top pod --all-namespaces", common.KubectlFile, common.AdminKubeconfig)
+	stdOut, stdErr, err := masterClient.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read pod usage, the metrics API may not be available: %s", strings.TrimSpace(string(stdErr)))
+	}
+	return usage.ParseTopPods(stdOut)
+}
+
+// podsOnNode returns the namespace/name of every pod scheduled to the node.
+func podsOnNode(nodeName string, masterClient sshmachine.Client) (map[string]bool, error) {
+	cmd := fmt.Sprintf(`%s --kubeconfig=%s get pods --all-namespaces --field-selector spec.nodeName=%s -ojsonpath='{range .items[*]}{.metadata.namespace}/{.metadata.name}{"\n"}{end}'`, common.KubectlFile, common.AdminKubeconfig, nodeName)
+	stdOut, stdErr, err := masterClient.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	names := make(map[string]bool)
+	for _, name := range strings.Fields(string(stdOut)) {
+		names[name] = true
+	}
+	return names, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+)
+
+// BootstrapToken is the output of create token.
+type BootstrapToken struct {
+	Token             string `json:"token"`
+	CACertHash        string `json:"caCertHash"`
+	APIServerEndpoint string `json:"apiServerEndpoint"`
+	JoinCommand       string `json:"joinCommand"`
+}
+
+var tokenCmdCreate = &cobra.Command{
+	Use:   "token",
+	Short: "Create a bootstrap token that joins nodes to the cluster",
+	Long: `Create a bootstrap token on a master, and print it, with the kubeadm join
+command that uses it. The token is printed to stdout, and written to a file
+only if --file is given. The state is not changed. Log messages are written to
+stderr, so that stdout can be consumed by other programs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetInfoOutput(os.Stderr)
+		output := cmd.Flag("output").Value.String()
+		file := cmd.Flag("file").Value.String()
+		ttl := cmd.Flag("ttl").Value.String()
+		masterMachine, masterProvisionedMachine, err := masterMachineAndProvisionedMachine()
+		if err != nil {
+			log.Fatalf("Unable to get a master machine and provisioned machine: %v", err)
+		}
+		log.Printf("Creating a bootstrap token on master %q", masterMachine.Name)
+		printed, joinCommand, err := joinCommandFromMachine(masterMachine, masterProvisionedMachine, ttl)
+		if err != nil {
+			log.Fatalf("Unable to create bootstrap token: %v", err)
+		}
+		b, err := formatBootstrapToken(BootstrapToken{
+			Token:             joinCommand.Token,
+			CACertHash:        joinCommand.CACertHashes[0],
+			APIServerEndpoint: joinCommand.APIServerEndpoint,
+			JoinCommand:       printed,
+		}, output)
+		if err != nil {
+			log.Fatalf("Unable to format bootstrap token: %v", err)
+		}
+		if err := writeSecretOutput(file, b); err != nil {
+			log.Fatalf("Unable to write bootstrap token: %v", err)
+		}
+	},
+}
+
+func formatBootstrapToken(t BootstrapToken, output string) ([]byte, error) {
+	switch output {
+	case "text":
+		return []byte(t.JoinCommand + "\n"), nil
+	case "json":
+		b, err := json.MarshalIndent(t, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	case "yaml":
+		return yaml.Marshal(t)
+	default:
+		return nil, fmt.Errorf("unknown output format %q, must be text, json, or yaml", output)
+	}
+}
+
+// writeSecretOutput writes b, which holds credentials, to stdout, or to the
+// file, if it is not empty, readable only by the user.
+func writeSecretOutput(file string, b []byte) error {
+	if len(file) == 0 {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0600)
+}
+
+func init() {
+	createCmd.AddCommand(tokenCmdCreate)
+	tokenCmdCreate.Flags().StringP("output", "o", "text", "Output format text|json|yaml. text prints only the join command")
+	tokenCmdCreate.Flags().String("file", "", "File to write the token to, readable only by the user. If not specified, output on stdout")
+	tokenCmdCreate.Flags().String("ttl", "", "Lifetime of the token, e.g. 1h. Defaults to the kubeadm default")
+}
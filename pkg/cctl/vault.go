@@ -0,0 +1,249 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/secretstore"
+)
+
+// vaultAddress is the address of the Vault server that keeps the data of
+// secrets, if any.
+var vaultAddress string
+
+var stateCmdVaultSecrets = &cobra.Command{
+	Use:   "vault-secrets",
+	Short: "Move the data of secrets from the state file to Vault",
+	Long: `Move the data of the SSH credential, CA, service account key, and bootstrap
+token secrets from the state file to Vault, at --prefix/<secret name>, e.g.
+secret/cctl/prod/ssh-credential. The prefix starts with the mount of a KV
+version 2 secrets engine. With --secret, only the given secrets are moved.
+
+Each moved secret is annotated with its path in Vault, and has no data in the
+state file, so that state backups, and state kept in a git repository, no
+longer contain it. Commands read the data from Vault when they read the state,
+so that they, and the actuator, use the secrets as before, and write it to
+Vault when it changes. Vault is given by --vault-addr, or VAULT_ADDR, and the
+token by VAULT_TOKEN, or ~/.vault-token. VAULT_CACERT is the CA certificate of
+the server, if it is not trusted by the system.
+
+With --inline, the data of the secrets is moved back to the state file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		prefix := strings.Trim(cmd.Flag("prefix").Value.String(), "/")
+		inline, err := cmd.Flags().GetBool("inline")
+		if err != nil {
+			log.Fatalf("Unable to parse --inline: %v", err)
+		}
+		names, err := cmd.Flags().GetStringSlice("secret")
+		if err != nil {
+			log.Fatalf("Unable to parse --secret: %v", err)
+		}
+		if !inline && len(prefix) == 0 {
+			log.Fatalf("--prefix is required, unless --inline is given")
+		}
+		initState()
+		if state.SecretStore == nil {
+			log.Fatalf("Vault is not configured; set --vault-addr, or VAULT_ADDR, and VAULT_TOKEN")
+		}
+		if len(names) == 0 {
+			if names, err = vaultSecretNames(); err != nil {
+				log.Fatalf("Unable to find secrets: %v", err)
+			}
+		}
+		secrets := state.KubeClient.CoreV1().Secrets(namespace)
+		changed := 0
+		for _, name := range names {
+			secret, err := secrets.Get(name, metav1.GetOptions{})
+			if err != nil {
+				log.Fatalf("Unable to get secret %q: %v", name, err)
+			}
+			current, ok := secretstore.Path(secret)
+			p := path.Join(prefix, name)
+			switch {
+			case inline && !ok:
+				continue
+			case inline:
+				delete(secret.Annotations, common.VaultPathAnnotationKey)
+				log.Printf("[vault-secrets] Moving secret %q from %q to the state file", name, current)
+			case ok && current == p:
+				continue
+			case len(secret.Data) == 0:
+				log.Printf("[vault-secrets] Not moving secret %q: it has no data", name)
+				continue
+			default:
+				if secret.Annotations == nil {
+					secret.Annotations = make(map[string]string)
+				}
+				secret.Annotations[common.VaultPathAnnotationKey] = p
+				log.Printf("[vault-secrets] Moving secret %q to %q", name, p)
+			}
+			if _, err := secrets.Update(secret); err != nil {
+				log.Fatalf("Unable to update secret %q: %v", name, err)
+			}
+			changed++
+		}
+		if changed == 0 {
+			log.Println("[vault-secrets] No secrets to move")
+			return
+		}
+		if err := state.PullFromAPIs(); err != nil {
+			log.Fatalf("Unable to sync on-disk state: %v", err)
+		}
+		log.Printf("[vault-secrets] Moved %d secrets", changed)
+	},
+}
+
+// vaultSecretNames returns the secrets whose data can be kept in Vault: the
+// CA, service account key, and bootstrap token secrets of the cluster, and the
+// SSH credentials of the provisioned machines and the bastion.
+func vaultSecretNames() ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if len(name) != 0 && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("unable to get cluster: %v", err)
+	default:
+		clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode cluster spec: %v", err)
+		}
+		for _, ref := range []*corev1.LocalObjectReference{
+			clusterSpec.EtcdCASecret,
+			clusterSpec.APIServerCASecret,
+			clusterSpec.FrontProxyCASecret,
+			clusterSpec.ServiceAccountKeySecret,
+			clusterSpec.BootstrapTokenSecret,
+		} {
+			if ref != nil {
+				add(ref.Name)
+			}
+		}
+	}
+	pmList, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list provisioned machines: %v", err)
+	}
+	for _, pm := range pmList.Items {
+		if pm.Spec.SSHConfig != nil {
+			add(pm.Spec.SSHConfig.CredentialSecret.Name)
+		}
+	}
+	for _, name := range []string{common.DefaultSSHCredentialSecretName, common.DefaultBastionSSHCredentialSecretName} {
+		_, err := state.KubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return nil, fmt.Errorf("unable to get secret %q: %v", name, err)
+		default:
+			add(name)
+		}
+	}
+	return names, nil
+}
+
+// configureSecretStore makes the state keep the data of secrets in Vault, if
+// --vault-addr, or VAULT_ADDR, is given.
+func configureSecretStore(s *cctlstate.State) error {
+	address := vaultAddress
+	if len(address) == 0 {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if len(address) == 0 {
+		return nil
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return err
+	}
+	if len(token) == 0 {
+		// Only a state that keeps secrets in Vault needs the token.
+		log.Debugf("Not using Vault at %q: no token", address)
+		return nil
+	}
+	tlsConfig := &tls.Config{}
+	if caFile := os.Getenv("VAULT_CACERT"); len(caFile) != 0 {
+		b, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("unable to read VAULT_CACERT: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("no certificates found in VAULT_CACERT %q", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	s.SecretStore = secretstore.NewVault(address, token, client)
+	return nil
+}
+
+// vaultToken returns VAULT_TOKEN, or the token saved by vault login, if any.
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); len(token) != 0 {
+		return token, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("unable to find home directory for the Vault token: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(u.HomeDir, ".vault-token"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to read Vault token: %v", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func init() {
+	stateCmd.AddCommand(stateCmdVaultSecrets)
+	stateCmdVaultSecrets.Flags().String("prefix", "", "Path in Vault, starting with the mount of a KV version 2 secrets engine, under which the secrets are kept, e.g. secret/cctl/prod")
+	stateCmdVaultSecrets.Flags().Bool("inline", false, "Move the data of the secrets from Vault back to the state file")
+	stateCmdVaultSecrets.Flags().StringSlice("secret", nil, "Name of a secret to move. Defaults to the SSH credential, CA, service account key, and bootstrap token secrets")
+	rootCmd.PersistentFlags().StringVar(&vaultAddress, "vault-addr", "", "address of the Vault server that keeps the data of secrets moved by state vault-secrets. Defaults to VAULT_ADDR")
+}
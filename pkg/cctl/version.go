@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+
+	"github.com/ghodss/yaml"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+	"github.com/spf13/cobra"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachineryversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/kubernetes/pkg/version"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/cliparse"
+	"github.com/platform9/cctl/pkg/util/discover"
+	"github.com/platform9/cctl/pkg/util/versionmatrix"
+)
+
+type Version struct {
+	ClientVersion *apimachineryversion.Info `json:"clientVersion,omitempty"`
+	// RemoteVersions are the versions of the components of every machine,
+	// given --remote.
+	RemoteVersions *RemoteVersions `json:"remoteVersions,omitempty"`
+}
+
+// RemoteVersions are the versions of the components of every machine, and
+// the components that machines run at more than one version.
+type RemoteVersions struct {
+	Machines     []versionmatrix.Machine `json:"machines"`
+	Inconsistent []string                `json:"inconsistent,omitempty"`
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print version information",
+	Long: `Print version information.
+
+With --remote, the state is read, and every machine is queried for the
+versions of kubelet, kubeadm, etcdadm, etcd, and its operating system. The
+versions are printed as a matrix, followed by the components that machines run
+at more than one version. Components a machine does not run are printed as
+"-", and versions that could not be detected as "unknown".`,
+	Run: func(cmd *cobra.Command, args []string) {
+		short, err := cmd.Flags().GetBool("short")
+		if err != nil {
+			log.Fatalf("Error parsing option value for short")
+		}
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Fatalf("Error parsing option value for output")
+		}
+
+		remote, err := cmd.Flags().GetBool("remote")
+		if err != nil {
+			log.Fatalf("Error parsing option value for remote")
+		}
+
+		var versionInfo Version
+		clientVersion := version.Get()
+		versionInfo.ClientVersion = &clientVersion
+		if remote {
+			initState()
+			remoteVersions, err := collectRemoteVersions()
+			if err != nil {
+				log.Fatalf("Unable to collect remote versions: %v", err)
+			}
+			versionInfo.RemoteVersions = remoteVersions
+		}
+
+		switch output {
+		case "":
+			if short {
+				fmt.Println(clientVersion.GitVersion)
+			} else {
+				fmt.Println(fmt.Sprintf("%#v", clientVersion))
+			}
+			if remote {
+				t := template.Must(template.New("RemoteVersionPrintTemplate").Parse(common.RemoteVersionPrintTemplate))
+				if err := t.Execute(os.Stdout, versionInfo.RemoteVersions); err != nil {
+					log.Fatalf("Could not pretty print remote versions: %s", err)
+				}
+			}
+		case "yaml":
+			marshalled, err := yaml.Marshal(&versionInfo)
+			if err != nil {
+				log.Fatalf("Error encoding version information as yaml")
+			}
+			fmt.Println(string(marshalled))
+		case "json":
+			marshalled, err := json.MarshalIndent(&versionInfo, "", "  ")
+			if err != nil {
+				log.Fatalf("Error encoding version information as json")
+			}
+			fmt.Println(string(marshalled))
+		default:
+			log.Fatalf("Invalid output format. Use yaml/json")
+		}
+	},
+}
+
+// collectRemoteVersions queries every machine for the versions of its
+// components. A machine that cannot be reached has unknown versions.
+func collectRemoteVersions() (*RemoteVersions, error) {
+	machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	machines := make([]versionmatrix.Machine, 0, len(machineList.Items))
+	for i := range machineList.Items {
+		m := machineVersions(&machineList.Items[i])
+		for _, c := range versionmatrix.Components {
+			if e, ok := m.Errors[c]; ok {
+				log.Warnf("Unable to detect %s version of machine %q: %s", c, m.Name, e)
+			}
+		}
+		machines = append(machines, m)
+	}
+	return &RemoteVersions{
+		Machines:     machines,
+		Inconsistent: versionmatrix.Inconsistent(machines),
+	}, nil
+}
+
+// machineVersions returns the versions of the components the machine runs:
+// etcd machines run etcdadm and etcd; masters run all of them; nodes run
+// kubelet and kubeadm.
+func machineVersions(machine *clusterv1.Machine) versionmatrix.Machine {
+	roles := make([]string, len(machine.Spec.Roles))
+	for i, r := range machine.Spec.Roles {
+		roles[i] = string(r)
+	}
+	m := versionmatrix.NewMachine(machine.Name, roles)
+	etcdOnly := isEtcdMachine(machine)
+	runsEtcd := etcdOnly || clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles)
+	var components []string
+	if !etcdOnly {
+		components = append(components, versionmatrix.Kubelet, versionmatrix.Kubeadm)
+	}
+	if runsEtcd {
+		components = append(components, versionmatrix.Etcdadm, versionmatrix.Etcd)
+	}
+	components = append(components, versionmatrix.OS)
+
+	client, err := machineClientForMachine(machine)
+	if err != nil {
+		err = fmt.Errorf("unable to create machine client: %v", err)
+		for _, c := range components {
+			m.Set(c, "", err)
+		}
+		return m
+	}
+	for _, c := range components {
+		v, err := remoteComponentVersion(client, c)
+		m.Set(c, v, err)
+	}
+	return m
+}
+
+// remoteComponentVersion returns the version of the component on the machine.
+func remoteComponentVersion(client sshmachine.Client, component string) (string, error) {
+	switch component {
+	case versionmatrix.Kubelet:
+		return remoteProgramVersion(client, fmt.Sprintf("%s --version", common.KubeletFile))
+	case versionmatrix.Kubeadm:
+		return remoteProgramVersion(client, kubeadmVersionCmd())
+	case versionmatrix.Etcdadm:
+		return remoteProgramVersion(client, etcdadmVersionCmd())
+	case versionmatrix.Etcd:
+		status, err := etcdLocalEndpointStatus(client)
+		if err != nil {
+			return "", err
+		}
+		if len(status.Version) == 0 {
+			return "", fmt.Errorf("no version in etcd endpoint status")
+		}
+		return status.Version, nil
+	case versionmatrix.OS:
+		out, err := remoteOutput(client, "cat /etc/os-release")
+		if err != nil {
+			return "", err
+		}
+		return discover.ParseOSRelease(out).String(), nil
+	}
+	return "", fmt.Errorf("unknown component %q", component)
+}
+
+func remoteProgramVersion(client sshmachine.Client, cmd string) (string, error) {
+	out, err := remoteOutput(client, cmd)
+	if err != nil {
+		return "", err
+	}
+	v, err := cliparse.ParseVersion(out)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().Bool("short", false, "Set true for short format")
+	versionCmd.Flags().String("output", "", "Specify output format yaml/json")
+	versionCmd.Flags().Bool("remote", false, "Also query every machine for the versions of kubelet, kubeadm, etcdadm, etcd, and its operating system")
+}
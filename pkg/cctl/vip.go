@@ -0,0 +1,374 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/keepalived"
+)
+
+// vipStatus is the state of keepalived on a master.
+type vipStatus struct {
+	Name       string
+	Keepalived string
+	VIPOwner   string
+	State      string
+	Priority   string
+	Interface  string
+	RouterID   string
+	Drift      string
+}
+
+var vipCmdStatus = &cobra.Command{
+	Use:   "vip",
+	Short: "Show which master holds the VIP, and the state of keepalived on every master",
+	Long: `Show which master holds the VIP, whether keepalived is active on every master,
+and the VRRP state, priority, interface, and virtual router ID in its
+configuration. The configuration is drifted if its interface, virtual router
+ID, or VIP differ from the state, or its priority, password, or unicast peers
+differ from the VRRP settings of the cluster, as set by create or update
+cluster --vrrp-priority, --vrrp-auth-pass, and --vrrp-unicast-peers.
+
+With --reconcile, the configuration of drifted masters is corrected, and
+keepalived is restarted on them, and on masters where it is not active. The
+replaced configuration is kept with a .old suffix.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		reconcile, err := cmd.Flags().GetBool("reconcile")
+		if err != nil {
+			log.Fatalf("Unable to parse --reconcile: %v", err)
+		}
+		cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Unable to get cluster: %v", err)
+		}
+		clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+		if err != nil {
+			log.Fatalf("Unable to decode cluster spec: %v", err)
+		}
+		if clusterSpec.VIPConfiguration == nil {
+			log.Fatalf("The cluster has no VIP.")
+		}
+		settings, err := keepalivedSettings(cluster)
+		if err != nil {
+			log.Fatalf("Unable to read VRRP settings: %v", err)
+		}
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		var statuses []vipStatus
+		var owners []string
+		var unknown bool
+		for i := range machineList.Items {
+			machine := &machineList.Items[i]
+			if !clusterutil.RoleContains(clustercommon.MasterRole, machine.Spec.Roles) {
+				continue
+			}
+			s := checkMachineVIP(machine, clusterSpec.VIPConfiguration, settings, reconcile)
+			switch s.VIPOwner {
+			case "true":
+				owners = append(owners, s.Name)
+			case statusUnknown:
+				unknown = true
+			}
+			statuses = append(statuses, s)
+		}
+		t := template.Must(template.New("VIPStatusPrintTemplate").Parse(common.VIPStatusPrintTemplate))
+		if err := t.Execute(os.Stdout, statuses); err != nil {
+			log.Fatalf("Could not pretty print VIP status: %s", err)
+		}
+		switch {
+		case len(owners) == 0 && unknown:
+			log.Warnf("Unable to determine which master holds VIP %s: some masters could not be checked", clusterSpec.VIPConfiguration.IP)
+		case len(owners) == 0:
+			log.Warnf("No master holds VIP %s", clusterSpec.VIPConfiguration.IP)
+		case len(owners) == 1:
+			log.Printf("VIP %s is held by %s", clusterSpec.VIPConfiguration.IP, owners[0])
+		default:
+			log.Warnf("VIP %s is held by more than one master: %s", clusterSpec.VIPConfiguration.IP, strings.Join(owners, ", "))
+		}
+	},
+}
+
+// checkMachineVIP returns the state of keepalived on the master. If reconcile
+// is true, drifted configuration is corrected, and keepalived is restarted if
+// it was changed or is not active.
+func checkMachineVIP(machine *clusterv1.Machine, vipConfig *spv1.VIPConfiguration, settings keepalived.Settings, reconcile bool) vipStatus {
+	s := vipStatus{
+		Name:       machine.Name,
+		Keepalived: statusUnknown,
+		VIPOwner:   statusUnknown,
+		State:      statusUnknown,
+		Priority:   statusUnknown,
+		Interface:  statusUnknown,
+		RouterID:   statusUnknown,
+		Drift:      statusUnknown,
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		log.Errorf("Unable to decode machine %q spec: %v", machine.Name, err)
+		return s
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("Unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+		return s
+	}
+	client, err := sshMachineClientFromSSHConfig(pm.Spec.SSHConfig)
+	if err != nil {
+		log.Errorf("Unable to create machine client for machine %q: %v", machine.Name, err)
+		return s
+	}
+	expected := expectedKeepalived(pm, vipConfig, settings)
+	if reconcile {
+		if err := reconcileKeepalived(machine.Name, client, expected); err != nil {
+			log.Errorf("Unable to reconcile keepalived on machine %q: %v", machine.Name, err)
+		}
+	}
+
+	s.Keepalived = serviceState(common.KeepalivedService, client)
+	s.VIPOwner = fmt.Sprintf("%v", ownsIP(vipConfig.IP, client))
+	data, err := client.ReadFile(common.KeepalivedConfigFile)
+	if err != nil {
+		log.Errorf("Unable to read %q on machine %q: %v", common.KeepalivedConfigFile, machine.Name, err)
+		return s
+	}
+	config, err := keepalived.Parse(data)
+	if err != nil {
+		log.Errorf("Unable to parse %q on machine %q: %v", common.KeepalivedConfigFile, machine.Name, err)
+		return s
+	}
+	s.State = config.State
+	s.Priority = strconv.Itoa(config.Priority)
+	s.Interface = config.Interface
+	s.RouterID = strconv.Itoa(config.RouterID)
+	s.Drift = "none"
+	if drift := keepalived.Drift(config, expected); len(drift) != 0 {
+		s.Drift = strings.Join(drift, "; ")
+	}
+	return s
+}
+
+// reconcileKeepalived corrects drifted keepalived configuration on the
+// machine, and restarts keepalived if the configuration changed or it is not
+// active.
+func reconcileKeepalived(machineName string, client sshmachine.Client, expected keepalived.Expected) error {
+	data, err := client.ReadFile(common.KeepalivedConfigFile)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", common.KeepalivedConfigFile, err)
+	}
+	config, err := keepalived.Parse(data)
+	if err != nil {
+		return fmt.Errorf("unable to parse %q: %v", common.KeepalivedConfigFile, err)
+	}
+	drift := keepalived.Drift(config, expected)
+	if len(drift) != 0 {
+		log.Printf("[reconcile] Correcting keepalived configuration on machine %q: %s", machineName, strings.Join(drift, "; "))
+		if err := replaceFile(client, common.KeepalivedConfigFile, 0644, keepalived.Reconcile(data, expected)); err != nil {
+			return err
+		}
+	} else if serviceState(common.KeepalivedService, client) == "active" {
+		return nil
+	}
+	log.Printf("[reconcile] Restarting keepalived on machine %q", machineName)
+	return restartService(common.KeepalivedService, client)
+}
+
+// expectedKeepalived returns the expected configuration of the VRRP instance
+// of the master: the VIP of the cluster, on the VIP interface of the master,
+// with the VRRP settings of the cluster.
+func expectedKeepalived(pm *spv1.ProvisionedMachine, vipConfig *spv1.VIPConfiguration, settings keepalived.Settings) keepalived.Expected {
+	expected := settings.ExpectedFor(pm.Spec.SSHConfig.Host)
+	expected.Interface = pm.Spec.VIPNetworkInterface
+	expected.RouterID = vipConfig.RouterID
+	expected.VIP = vipConfig.IP
+	return expected
+}
+
+// ensureKeepalivedConfig corrects the keepalived configuration of the master
+// to match the VIP and VRRP settings of the cluster, and restarts keepalived
+// if it changed or is not active.
+func ensureKeepalivedConfig(cluster *clusterv1.Cluster, machine *clusterv1.Machine, client sshmachine.Client) error {
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if clusterSpec.VIPConfiguration == nil {
+		return nil
+	}
+	settings, err := keepalivedSettings(cluster)
+	if err != nil {
+		return err
+	}
+	machineSpec, err := providerCodec.GetMachineSpec(*machine)
+	if err != nil {
+		return fmt.Errorf("unable to decode machine spec: %v", err)
+	}
+	pm, err := state.SPClient.SshproviderV1alpha1().ProvisionedMachines(namespace).Get(machineSpec.ProvisionedMachineName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get provisioned machine %q: %v", machineSpec.ProvisionedMachineName, err)
+	}
+	return reconcileKeepalived(machine.Name, client, expectedKeepalived(pm, clusterSpec.VIPConfiguration, settings))
+}
+
+// vrrpFlags are the flags of create and update cluster that set the VRRP
+// settings of the cluster.
+var vrrpFlags = []string{"vrrp-priority", "vrrp-auth-pass", "vrrp-unicast-peers"}
+
+// setKeepalivedSettings records the VRRP settings given by the flags that are
+// set, and keeps the others. An empty value removes a setting. The password is
+// kept in a secret, so that it is not reported by state diff.
+func setKeepalivedSettings(cmd *cobra.Command, cluster *clusterv1.Cluster) error {
+	settings, err := keepalivedSettings(cluster)
+	if err != nil {
+		return err
+	}
+	if cmd.Flag("vrrp-priority").Changed {
+		if settings.Priority, err = cmd.Flags().GetInt("vrrp-priority"); err != nil {
+			return fmt.Errorf("unable to parse `vrrp-priority`: %v", err)
+		}
+	}
+	if cmd.Flag("vrrp-auth-pass").Changed {
+		settings.AuthPass = cmd.Flag("vrrp-auth-pass").Value.String()
+	}
+	if cmd.Flag("vrrp-unicast-peers").Changed {
+		if settings.UnicastPeers, err = cmd.Flags().GetStringSlice("vrrp-unicast-peers"); err != nil {
+			return fmt.Errorf("unable to parse `vrrp-unicast-peers`: %v", err)
+		}
+	}
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	if settings.Priority == 0 && len(settings.AuthPass) == 0 && len(settings.UnicastPeers) == 0 {
+		delete(cluster.Annotations, common.KeepalivedAnnotationKey)
+	} else {
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return fmt.Errorf("unable to encode VRRP settings: %v", err)
+		}
+		if cluster.Annotations == nil {
+			cluster.Annotations = make(map[string]string)
+		}
+		cluster.Annotations[common.KeepalivedAnnotationKey] = string(data)
+	}
+	return saveKeepalivedAuthPass(settings.AuthPass)
+}
+
+// setVRRPSettings records the virtual router ID and the VRRP settings given
+// by the flags of update cluster.
+func setVRRPSettings(cmd *cobra.Command, cluster *clusterv1.Cluster) error {
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	if clusterSpec.VIPConfiguration == nil {
+		return fmt.Errorf("the cluster has no VIP")
+	}
+	if cmd.Flag("router-id").Changed {
+		routerID, err := cmd.Flags().GetInt("router-id")
+		if err != nil {
+			return fmt.Errorf("unable to parse `router-id`: %v", err)
+		}
+		if routerID > 255 || routerID < 0 {
+			return fmt.Errorf("the --router-id %d must be between [0,255]", routerID)
+		}
+		clusterSpec.VIPConfiguration.RouterID = routerID
+		if err := providerCodec.PutClusterSpec(*clusterSpec, cluster); err != nil {
+			return fmt.Errorf("unable to encode cluster spec: %v", err)
+		}
+	}
+	return setKeepalivedSettings(cmd, cluster)
+}
+
+// addVRRPFlags adds the flags that set the VRRP settings of the cluster.
+func addVRRPFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("vrrp-priority", 0, "VRRP priority of every master, in the range [1, 254]. Defaults to the priority rendered by nodeadm")
+	cmd.Flags().String("vrrp-auth-pass", "", fmt.Sprintf("Password, of at most %d characters, that authenticates VRRP advertisements between masters. Kept in a secret", keepalived.MaxAuthPassLength))
+	cmd.Flags().StringSlice("vrrp-unicast-peers", []string{}, "IPs of the masters, to which VRRP advertisements are sent by unicast instead of multicast. Provide a comma-separated list, or define multiple flags.")
+}
+
+// keepalivedSettings returns the VRRP settings of the cluster.
+func keepalivedSettings(cluster *clusterv1.Cluster) (keepalived.Settings, error) {
+	var settings keepalived.Settings
+	if value, ok := cluster.Annotations[common.KeepalivedAnnotationKey]; ok {
+		if err := json.Unmarshal([]byte(value), &settings); err != nil {
+			return settings, fmt.Errorf("unable to decode VRRP settings: %v", err)
+		}
+	}
+	secret, err := state.KubeClient.CoreV1().Secrets(namespace).Get(common.DefaultKeepalivedSecretName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return settings, fmt.Errorf("unable to get secret %q: %v", common.DefaultKeepalivedSecretName, err)
+	default:
+		settings.AuthPass = string(secret.Data[keepalivedAuthPassSecretKey])
+	}
+	return settings, nil
+}
+
+// keepalivedAuthPassSecretKey is the key of the VRRP password in its secret.
+const keepalivedAuthPassSecretKey = "authPass"
+
+// saveKeepalivedAuthPass records the VRRP password in its secret, or removes
+// the secret if the password is empty. The caller syncs the on-disk state.
+func saveKeepalivedAuthPass(authPass string) error {
+	secrets := state.KubeClient.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(common.DefaultKeepalivedSecretName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err) && len(authPass) == 0:
+		return nil
+	case apierrors.IsNotFound(err):
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: common.DefaultKeepalivedSecretName},
+			Data:       map[string][]byte{keepalivedAuthPassSecretKey: []byte(authPass)},
+		}
+		_, err = secrets.Create(secret)
+	case err == nil && len(authPass) == 0:
+		err = secrets.Delete(common.DefaultKeepalivedSecretName, &metav1.DeleteOptions{})
+	case err == nil:
+		secret.Data = map[string][]byte{keepalivedAuthPassSecretKey: []byte(authPass)}
+		_, err = secrets.Update(secret)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save secret %q: %v", common.DefaultKeepalivedSecretName, err)
+	}
+	return nil
+}
+
+func init() {
+	statusCmd.AddCommand(vipCmdStatus)
+	vipCmdStatus.Flags().Bool("reconcile", false, "Correct drifted keepalived configuration, and restart keepalived where it is not active")
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	"github.com/platform9/cctl/common"
+	log "github.com/platform9/cctl/pkg/logrus"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+// waitConditionReady is the only condition the wait commands support.
+const waitConditionReady = "ready"
+
+var (
+	waitFor      string
+	waitTimeout  time.Duration
+	waitInterval time.Duration
+)
+
+// waitCmd represents the wait command
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Used to wait for a resource to meet a condition",
+	Args:  cobra.MinimumNArgs(1),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initState()
+		// PersistentPreRuns are not chained https://github.com/spf13/cobra/issues/216
+		// Therefore logLevel must be set in all the PersistentPreRuns
+		if err := log.SetLogLevelUsingString(logLevel); err != nil {
+			log.Fatalf("Unable to parse log level %s", logLevel)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Wait called")
+	},
+}
+
+var clusterCmdWait = &cobra.Command{
+	Use:   "cluster",
+	Short: "Wait until the cluster is ready",
+	Long: `Wait until the cluster is ready: the cluster has a master, and every machine
+is ready, as described in 'cctl wait machine --help'. The machines are checked
+every --interval. If the cluster is not ready after --timeout, the machines
+that are not ready are listed, and the command exits with a non-zero status.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		mustBeWaitingForReady()
+		machineList, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			log.Fatalf("Unable to list machines: %v", err)
+		}
+		if len(clusterapi.MachinesWithRole(machineList.Items, clustercommon.MasterRole)) == 0 {
+			log.Fatalf("Unable to wait for the cluster: the cluster has no master. Create a master first.")
+		}
+		if err := waitUntilReady(machineList.Items); err != nil {
+			log.Fatalf("Cluster is not ready: %v", err)
+		}
+		log.Printf("Cluster is ready")
+	},
+}
+
+var machineCmdWait = &cobra.Command{
+	Use:   "machine",
+	Short: "Wait until one or more machines are ready",
+	Long: `Wait until one or more machines are ready. A machine is ready when it is
+reachable, was created completely, its kubelet is active, and its node is
+Ready. A master must also run etcd, the API server, the controller manager,
+and the scheduler, and its etcd member must be healthy. The machines are checked every --interval. If a machine is
+not ready after --timeout, the reasons are listed, and the command exits with
+a non-zero status.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		mustBeWaitingForReady()
+		ips, err := cmd.Flags().GetStringSlice("ip")
+		if err != nil {
+			log.Fatalf("Unable to parse `ip` flag: %v", err)
+		}
+		if len(ips) == 0 {
+			log.Fatalf("Must give at least one --ip.")
+		}
+		var machines []clusterv1.Machine
+		for _, ip := range ips {
+			machine, err := state.ClusterClient.ClusterV1alpha1().Machines(namespace).Get(ip, metav1.GetOptions{})
+			if err != nil {
+				log.Fatalf("Unable to get machine %q: %v", ip, err)
+			}
+			machines = append(machines, *machine)
+		}
+		if err := waitUntilReady(machines); err != nil {
+			log.Fatalf("Machines are not ready: %v", err)
+		}
+		log.Printf("Machines %v are ready", ips)
+	},
+}
+
+func mustBeWaitingForReady() {
+	if waitFor != waitConditionReady {
+		log.Fatalf("Unable to wait for %q: the only supported condition is %q", waitFor, waitConditionReady)
+	}
+}
+
+// waitUntilReady checks the machines every waitInterval until all of them
+// are ready, or returns an error with the reasons the machines are not ready
+// after waitTimeout.
+func waitUntilReady(machines []clusterv1.Machine) error {
+	cluster, err := state.ClusterClient.ClusterV1alpha1().Clusters(namespace).Get(common.DefaultClusterName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get cluster: %v", err)
+	}
+	clusterSpec, err := providerCodec.GetClusterSpec(*cluster)
+	if err != nil {
+		return fmt.Errorf("unable to decode cluster spec: %v", err)
+	}
+	var vip string
+	if clusterSpec.VIPConfiguration != nil {
+		vip = clusterSpec.VIPConfiguration.IP
+	}
+	// The clients are kept between checks, so that every check does not
+	// open new connections.
+	clients := make(map[string]sshmachine.Client)
+	deadline := time.Now().Add(waitTimeout)
+	for attempt := 1; ; attempt++ {
+		notReady := notReadyMachines(machines, checkMachinesHealth(machines, vip, clients), clients)
+		if len(notReady) == 0 {
+			return nil
+		}
+		if !time.Now().Add(waitInterval).Before(deadline) {
+			return fmt.Errorf("timed out after %s: %s", waitTimeout, strings.Join(notReady, "; "))
+		}
+		log.Printf("[wait] Check %d: %d of %d machines not ready: %s", attempt, len(notReady), len(machines), strings.Join(notReady, "; "))
+		select {
+		case <-commandContext.Done():
+			return fmt.Errorf("interrupted: %s", strings.Join(notReady, "; "))
+		case <-time.After(waitInterval):
+		}
+	}
+}
+
+// notReadyMachines returns, for every machine that is not ready, its name
+// and the reasons. The clients are used to check the controller manager and
+// scheduler of masters.
+func notReadyMachines(machines []clusterv1.Machine, results []machineHealth, clients map[string]sshmachine.Client) []string {
+	var notReady []string
+	for i, h := range results {
+		var reasons []string
+		if phase := clusterapi.Phase(&machines[i]); phase != clusterapi.MachinePhaseReady && phase != clusterapi.MachinePhaseUnknown {
+			reasons = append(reasons, fmt.Sprintf("phase is %s", phase))
+		}
+		if !h.Reachable {
+			reasons = append(reasons, "unreachable")
+		} else if !clusterapi.HasNode(machines[i]) {
+			// Etcd machines have no kubelet and no node.
+			if h.Etcd != "active" {
+				reasons = append(reasons, fmt.Sprintf("etcd is %s", h.Etcd))
+			}
+			if h.EtcdMember != "healthy" {
+				reasons = append(reasons, fmt.Sprintf("etcd member is %s", h.EtcdMember))
+			}
+		} else {
+			if h.Kubelet != "active" {
+				reasons = append(reasons, fmt.Sprintf("kubelet is %s", h.Kubelet))
+			}
+			if h.NodeReady != "True" {
+				reasons = append(reasons, fmt.Sprintf("node Ready condition is %s", h.NodeReady))
+			}
+			if clusterutil.RoleContains(clustercommon.MasterRole, h.Roles) {
+				if h.Etcd != "active" {
+					reasons = append(reasons, fmt.Sprintf("etcd is %s", h.Etcd))
+				}
+				if h.APIServer != "running" {
+					reasons = append(reasons, fmt.Sprintf("API server is %s", h.APIServer))
+				}
+				if client, ok := clients[h.Name]; ok {
+					for _, c := range []struct{ component, filter string }{
+						{"controller manager", common.DockerKubeControllerMgrNameFilter},
+						{"scheduler", common.DockerKubeSchedulerNameFilter},
+					} {
+						if _, err := identifyDockerContainer([]string{c.filter, common.DockerRunningStatusFilter}, client); err != nil {
+							reasons = append(reasons, fmt.Sprintf("%s is not running", c.component))
+						}
+					}
+				}
+				if h.EtcdMember != "healthy" && h.EtcdMember != statusNotApplicable {
+					reasons = append(reasons, fmt.Sprintf("etcd member is %s", h.EtcdMember))
+				}
+			}
+		}
+		if len(reasons) != 0 {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", h.Name, strings.Join(reasons, ", ")))
+		}
+	}
+	return notReady
+}
+
+func init() {
+	rootCmd.AddCommand(waitCmd)
+	waitCmd.PersistentFlags().StringVar(&waitFor, "for", waitConditionReady, "The condition to wait for. Only ready is supported")
+	waitCmd.PersistentFlags().DurationVar(&waitTimeout, "timeout", common.DefaultWaitTimeout, "How long to wait before giving up")
+	waitCmd.PersistentFlags().DurationVar(&waitInterval, "interval", common.DefaultWaitInterval, "How long to wait between checks")
+	waitCmd.AddCommand(clusterCmdWait)
+	waitCmd.AddCommand(machineCmdWait)
+	machineCmdWait.Flags().StringSlice("ip", []string{}, "IPs of the machines. Provide a comma-separated list, or define multiple flags.")
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cctl
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestNotReadyEtcdMachines(t *testing.T) {
+	machine := func(name string, role clustercommon.MachineRole) clusterv1.Machine {
+		return clusterv1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       clusterv1.MachineSpec{Roles: []clustercommon.MachineRole{role}},
+		}
+	}
+	machines := []clusterv1.Machine{
+		machine("10.0.0.1", clusterapi.EtcdRole),
+		machine("10.0.0.2", clusterapi.EtcdRole),
+		machine("10.0.0.3", clustercommon.NodeRole),
+	}
+	results := []machineHealth{
+		{Name: "10.0.0.1", Roles: machines[0].Spec.Roles, Reachable: true, Kubelet: statusNotApplicable, NodeReady: statusNotApplicable, Etcd: "active", EtcdMember: "healthy"},
+		{Name: "10.0.0.2", Roles: machines[1].Spec.Roles, Reachable: true, Kubelet: statusNotApplicable, NodeReady: statusNotApplicable, Etcd: "active", EtcdMember: "unhealthy"},
+		{Name: "10.0.0.3", Roles: machines[2].Spec.Roles, Reachable: true, Kubelet: "active", NodeReady: "True"},
+	}
+	notReady := notReadyMachines(machines, results, nil)
+	if len(notReady) != 1 || !strings.HasPrefix(notReady[0], "10.0.0.2 (etcd member is unhealthy)") {
+		t.Errorf("expected only the etcd machine with an unhealthy member not to be ready, found %v", notReady)
+	}
+}
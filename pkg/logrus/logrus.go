@@ -17,6 +17,8 @@ limitations under the License.
 package logrus
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -27,10 +29,57 @@ var (
 	// used for debug, info, warn
 	stdOut = log.New()
 	// used for error, fatal, panic
-	stdError = log.New()
-	level    log.Level
+	stdError  = log.New()
+	level     log.Level
+	verbosity int
+	// infoOutput receives debug, info, and warn entries
+	infoOutput io.Writer = os.Stdout
 )
 
+// Fields is a set of fields added to a structured log entry.
+type Fields = log.Fields
+
+// Log formats.
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// SetFormat sets the output format of both loggers to text or json.
+func SetFormat(format string) error {
+	var formatter log.Formatter
+	switch format {
+	case TextFormat:
+		formatter = &log.TextFormatter{}
+	case JSONFormat:
+		formatter = &log.JSONFormatter{}
+	default:
+		return fmt.Errorf("unknown log format %q, must be %q or %q", format, TextFormat, JSONFormat)
+	}
+	stdOut.Formatter = formatter
+	stdError.Formatter = formatter
+	return nil
+}
+
+// SetVerbosity sets the verbosity of debug output. Higher values enable more
+// detail, e.g. the commands run on machines.
+func SetVerbosity(v int) {
+	verbosity = v
+}
+
+// V returns true if the verbosity is at least v.
+func V(v int) bool {
+	return verbosity >= v
+}
+
+// SetInfoOutput sends debug, info, and warn entries to w. Commands whose
+// output is consumed by other programs send them to stderr, so that stdout
+// carries only the output.
+func SetInfoOutput(w io.Writer) {
+	infoOutput = w
+	stdOut.Out = w
+}
+
 // LogLevel returns the current log level
 func LogLevel() log.Level {
 	return level
@@ -49,7 +98,7 @@ func SetLogLevelUsingString(inputLevel string) error {
 // SetLogLevel sets level for both loggers
 func SetLogLevel(inputLevel log.Level) {
 	level = inputLevel
-	stdOut.Out = os.Stdout
+	stdOut.Out = infoOutput
 	stdError.Out = os.Stderr
 	// used only for levels >= log.InfoLevel
 	stdOut.SetLevel(level)
@@ -200,3 +249,15 @@ func Panicln(args ...interface{}) {
 func Fatalln(args ...interface{}) {
 	stdError.Fatalln(args...)
 }
+
+// RegisterExitHandler adds a handler that is run before the program exits
+// because of a Fatal log entry.
+func RegisterExitHandler(handler func()) {
+	log.RegisterExitHandler(handler)
+}
+
+// AddHook adds a hook that is fired for entries logged at its levels.
+func AddHook(hook log.Hook) {
+	stdOut.AddHook(hook)
+	stdError.AddHook(hook)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logrus
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSetFormat(t *testing.T) {
+	defer SetFormat(TextFormat)
+	if err := SetFormat("xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+	if err := SetFormat(JSONFormat); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	SetLogLevel(log.InfoLevel)
+	var out bytes.Buffer
+	stdOut.Out = &out
+	WithFields(Fields{"host": "10.0.0.1"}).Info("Creating machine")
+	entry := map[string]string{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("unable to parse %q: %v", out.String(), err)
+	}
+	if entry["msg"] != "Creating machine" || entry["host"] != "10.0.0.1" || entry["level"] != "info" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	defer SetVerbosity(0)
+	SetVerbosity(2)
+	if !V(1) || !V(2) || V(3) {
+		t.Errorf("unexpected verbosity checks at verbosity 2")
+	}
+}
+
+func TestSetInfoOutput(t *testing.T) {
+	defer SetInfoOutput(os.Stdout)
+	var out bytes.Buffer
+	SetInfoOutput(&out)
+	SetLogLevel(log.InfoLevel)
+	Info("Getting a bootstrap token from a master")
+	if out.Len() == 0 {
+		t.Errorf("expected the entry to be written to the info output")
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterclient "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset"
+)
+
+// legacyProviderAPIVersions are the API versions of provider configs and
+// statuses written by older versions of the ssh-provider. The vendored
+// ssh-provider cannot decode them.
+var legacyProviderAPIVersions = map[string]bool{
+	"sshproviderconfig/v1alpha1":               true,
+	"sshproviderconfig.platform9.com/v1alpha1": true,
+}
+
+// legacyProviderKinds maps the kinds of legacy provider configs and statuses
+// to their current kinds.
+var legacyProviderKinds = map[string]string{
+	"SSHClusterProviderConfig": "ClusterSpec",
+	"SSHClusterProviderStatus": "ClusterStatus",
+	"SSHMachineProviderConfig": "MachineSpec",
+	"SSHMachineProviderStatus": "MachineStatus",
+}
+
+// upgradeProviderConfig rewrites the API version and kind of a legacy
+// provider config or status to the ones the vendored ssh-provider decodes.
+// The fields are the same. It returns false if the config is not legacy.
+func upgradeProviderConfig(raw *runtime.RawExtension) (bool, error) {
+	if raw == nil || len(raw.Raw) == 0 {
+		return false, nil
+	}
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw.Raw, &obj); err != nil {
+		return false, fmt.Errorf("unable to parse provider config: %v", err)
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	if !legacyProviderAPIVersions[apiVersion] {
+		return false, nil
+	}
+	obj["apiVersion"] = spv1.SchemeGroupVersion.String()
+	if kind, ok := legacyProviderKinds[fmt.Sprint(obj["kind"])]; ok {
+		obj["kind"] = kind
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return false, fmt.Errorf("unable to encode provider config: %v", err)
+	}
+	raw.Raw = b
+	raw.Object = nil
+	return true, nil
+}
+
+// UpgradeProviderConfigs upgrades the legacy provider configs and statuses of
+// the clusters and machines of every namespace, and returns the names of the
+// objects changed, as <namespace>/<kind>/<name>.
+func UpgradeProviderConfigs(clusterClient clusterclient.Interface) ([]string, error) {
+	var upgraded []string
+	clusterList, err := clusterClient.ClusterV1alpha1().Clusters(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list clusters: %v", err)
+	}
+	for i := range clusterList.Items {
+		c := &clusterList.Items[i]
+		changed, err := upgradeProviderConfigs(c.Spec.ProviderConfig.Value, c.Status.ProviderStatus)
+		if err != nil {
+			return nil, fmt.Errorf("unable to upgrade cluster %q: %v", c.Name, err)
+		}
+		if !changed {
+			continue
+		}
+		if _, err := clusterClient.ClusterV1alpha1().Clusters(c.Namespace).Update(c); err != nil {
+			return nil, fmt.Errorf("unable to update cluster %q: %v", c.Name, err)
+		}
+		upgraded = append(upgraded, c.Namespace+"/cluster/"+c.Name)
+	}
+	machineList, err := clusterClient.ClusterV1alpha1().Machines(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	for i := range machineList.Items {
+		m := &machineList.Items[i]
+		changed, err := upgradeProviderConfigs(m.Spec.ProviderConfig.Value, m.Status.ProviderStatus)
+		if err != nil {
+			return nil, fmt.Errorf("unable to upgrade machine %q: %v", m.Name, err)
+		}
+		if !changed {
+			continue
+		}
+		if _, err := clusterClient.ClusterV1alpha1().Machines(m.Namespace).Update(m); err != nil {
+			return nil, fmt.Errorf("unable to update machine %q: %v", m.Name, err)
+		}
+		upgraded = append(upgraded, m.Namespace+"/machine/"+m.Name)
+	}
+	return upgraded, nil
+}
+
+// LegacyProviderConfigs returns the names of the clusters and machines of
+// every namespace with legacy provider configs or statuses, as
+// <namespace>/<kind>/<name>, without changing them.
+func LegacyProviderConfigs(clusterClient clusterclient.Interface) ([]string, error) {
+	var legacy []string
+	clusterList, err := clusterClient.ClusterV1alpha1().Clusters(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list clusters: %v", err)
+	}
+	for _, c := range clusterList.Items {
+		if isLegacy(c.Spec.ProviderConfig.Value, c.Status.ProviderStatus) {
+			legacy = append(legacy, c.Namespace+"/cluster/"+c.Name)
+		}
+	}
+	machineList, err := clusterClient.ClusterV1alpha1().Machines(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list machines: %v", err)
+	}
+	for _, m := range machineList.Items {
+		if isLegacy(m.Spec.ProviderConfig.Value, m.Status.ProviderStatus) {
+			legacy = append(legacy, m.Namespace+"/machine/"+m.Name)
+		}
+	}
+	return legacy, nil
+}
+
+func upgradeProviderConfigs(raws ...*runtime.RawExtension) (bool, error) {
+	changed := false
+	for _, raw := range raws {
+		c, err := upgradeProviderConfig(raw)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+func isLegacy(raws ...*runtime.RawExtension) bool {
+	for _, raw := range raws {
+		if raw == nil || len(raw.Raw) == 0 {
+			continue
+		}
+		var tm metav1.TypeMeta
+		if err := json.Unmarshal(raw.Raw, &tm); err == nil && legacyProviderAPIVersions[tm.APIVersion] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util_test
+
+import (
+	"reflect"
+	"testing"
+
+	sputil "github.com/platform9/ssh-provider/pkg/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	stateutil "github.com/platform9/cctl/pkg/state/util"
+)
+
+func TestUpgradeProviderConfigs(t *testing.T) {
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cctl-cluster", Namespace: "default"}}
+	cluster.Spec.ProviderConfig.Value = &runtime.RawExtension{Raw: []byte(`{"apiVersion":"sshproviderconfig/v1alpha1","kind":"SSHClusterProviderConfig","vipConfiguration":{"ip":"10.0.0.100","routerID":51}}`)}
+	legacyMachine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "10.0.0.1", Namespace: "default"}}
+	legacyMachine.Spec.ProviderConfig.Value = &runtime.RawExtension{Raw: []byte(`{"apiVersion":"sshproviderconfig/v1alpha1","kind":"SSHMachineProviderConfig","roles":["Master"],"provisionedMachineName":"10.0.0.1"}`)}
+	currentMachine := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "10.0.0.2", Namespace: "other"}}
+	currentMachine.Spec.ProviderConfig.Value = &runtime.RawExtension{Raw: []byte(`{"apiVersion":"sshprovider.platform9.com/v1alpha1","kind":"MachineSpec","roles":["Node"]}`)}
+	clusterClient := clusterclientfake.NewSimpleClientset(cluster, legacyMachine, currentMachine)
+
+	expected := []string{"default/cluster/cctl-cluster", "default/machine/10.0.0.1"}
+	legacy, err := stateutil.LegacyProviderConfigs(clusterClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, legacy) {
+		t.Fatalf("expected legacy %v, found %v", expected, legacy)
+	}
+	upgraded, err := stateutil.UpgradeProviderConfigs(clusterClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, upgraded) {
+		t.Fatalf("expected upgraded %v, found %v", expected, upgraded)
+	}
+
+	c, err := clusterClient.ClusterV1alpha1().Clusters("default").Get("cctl-cluster", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clusterSpec, err := sputil.GetClusterSpec(*c)
+	if err != nil {
+		t.Fatalf("unable to decode upgraded cluster spec: %v", err)
+	}
+	if clusterSpec.VIPConfiguration == nil || clusterSpec.VIPConfiguration.IP != "10.0.0.100" {
+		t.Errorf("expected VIP configuration to be kept, found %+v", clusterSpec.VIPConfiguration)
+	}
+	m, err := clusterClient.ClusterV1alpha1().Machines("default").Get("10.0.0.1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	machineSpec, err := sputil.GetMachineSpec(*m)
+	if err != nil {
+		t.Fatalf("unable to decode upgraded machine spec: %v", err)
+	}
+	if machineSpec.ProvisionedMachineName != "10.0.0.1" {
+		t.Errorf("expected provisioned machine name to be kept, found %q", machineSpec.ProvisionedMachineName)
+	}
+
+	if again, err := stateutil.UpgradeProviderConfigs(clusterClient); err != nil || len(again) != 0 {
+		t.Errorf("expected upgrade to be idempotent, found %v, %v", again, err)
+	}
+}
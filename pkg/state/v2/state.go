@@ -17,11 +17,19 @@ limitations under the License.
 package v2
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/ghodss/yaml"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/platform9/cctl/pkg/util/profile"
+	"github.com/platform9/cctl/pkg/util/secretstore"
+	"github.com/platform9/cctl/pkg/util/signature"
+	"github.com/platform9/cctl/pkg/util/statebackup"
 
 	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -36,10 +44,16 @@ import (
 const (
 	// FileMode defines the file mode used to create the state file.
 	FileMode = 0600
+	// SignatureFileSuffix is appended to the state filename to name the file
+	// that holds its signature.
+	SignatureFileSuffix = ".sig"
 )
 
 type SchemaVersion int
 
+// ErrReadOnly is returned when the state is changed in read-only mode.
+var ErrReadOnly = errors.New("the state is read-only")
+
 const Version = SchemaVersion(2)
 
 // State holds all the objects that make up cctl state.State Contains unexported
@@ -50,6 +64,31 @@ type State struct {
 	KubeClient    kubernetes.Interface    `json:"-"`
 	ClusterClient clusterclient.Interface `json:"-"`
 	SPClient      spclient.Interface      `json:"-"`
+	// ReadOnly prevents the state file from being created or written.
+	ReadOnly bool `json:"-"`
+	// Signer, if set, signs the state file every time it is written, and its
+	// signature is verified every time it is read.
+	Signer ssh.Signer `json:"-"`
+	// IgnoreSignature reads the state file even if its signature is missing
+	// or invalid. The verification error is kept in SignatureError.
+	IgnoreSignature bool  `json:"-"`
+	SignatureError  error `json:"-"`
+	// Profile, if set, records every read and write of the state file.
+	Profile *profile.Profile `json:"-"`
+	// BackupDir, if set, receives a copy of the state file, and its
+	// signature, before the state file is first written, so that the change
+	// can be reverted. Only the BackupRetain newest copies are kept.
+	BackupDir    string `json:"-"`
+	BackupRetain int    `json:"-"`
+	// Backup is the path of the copy, once it is made.
+	Backup   string `json:"-"`
+	backedUp bool
+	// SecretStore, if set, holds the data of the secrets annotated with
+	// its path, which is kept out of the state file. Their data is read
+	// from it when the state file is read, and written to it when it
+	// changes.
+	SecretStore   secretstore.Store `json:"-"`
+	storedSecrets map[string]map[string][]byte
 
 	SecretList             corev1.SecretList           `json:"secretList,omitempty"`
 	ClusterList            clusterv1.ClusterList       `json:"clusterList,omitempty"`
@@ -75,13 +114,41 @@ func NewWithFile(filename string, kubeClient kubernetes.Interface, clusterClient
 	return &s
 }
 
-func (s *State) read() error {
-	file, err := os.OpenFile(s.Filename, os.O_RDONLY|os.O_CREATE, FileMode)
+// SignatureFilename returns the name of the file that holds the signature of
+// the state file.
+func (s *State) SignatureFilename() string {
+	return s.Filename + SignatureFileSuffix
+}
+
+func (s *State) read() (err error) {
+	defer func(started time.Time) {
+		s.Profile.RecordStateRead(time.Since(started), err)
+	}(time.Now())
+	_, err = os.Stat(s.Filename)
+	created := os.IsNotExist(err)
+	flag := os.O_RDONLY | os.O_CREATE
+	if s.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(s.Filename, flag, FileMode)
+	if s.ReadOnly && os.IsNotExist(err) {
+		// A missing state file is the same as an empty one.
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("unable to open %q: %v", s.Filename, err)
 	}
 	defer file.Close()
 	stateBytes, err := ioutil.ReadAll(file)
+	// A state file created by this read has no signature yet.
+	if s.Signer != nil && !created {
+		if err := s.verify(stateBytes); err != nil {
+			if !s.IgnoreSignature {
+				return err
+			}
+			s.SignatureError = err
+		}
+	}
 	if err := yaml.Unmarshal(stateBytes, s); err != nil {
 		return fmt.Errorf("unable to unmarshal state from YAML: %v", err)
 	}
@@ -92,13 +159,32 @@ func (s *State) read() error {
 	return nil
 }
 
-func (s *State) write() error {
+func (s *State) write() (err error) {
+	defer func(started time.Time) {
+		s.Profile.RecordStateWrite(time.Since(started), err)
+	}(time.Now())
+	if s.ReadOnly {
+		return ErrReadOnly
+	}
+	if len(s.BackupDir) != 0 && !s.backedUp {
+		if s.Backup, err = statebackup.Snapshot(s.Filename, SignatureFileSuffix, s.BackupDir, s.BackupRetain, time.Now()); err != nil {
+			return fmt.Errorf("unable to back up state: %v", err)
+		}
+		s.backedUp = true
+	}
+	if s.storedSecrets == nil {
+		s.storedSecrets = make(map[string]map[string][]byte)
+	}
+	out := *s
+	if out.SecretList.Items, err = secretstore.Strip(s.SecretStore, s.SecretList.Items, s.storedSecrets); err != nil {
+		return err
+	}
 	file, err := os.OpenFile(s.Filename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, FileMode)
 	if err != nil {
 		return fmt.Errorf("unable to open %q: %v", s.Filename, err)
 	}
 	defer file.Close()
-	stateBytes, err := yaml.Marshal(s)
+	stateBytes, err := yaml.Marshal(&out)
 	if err != nil {
 		return fmt.Errorf("unable to marshal state to YAML: %v", err)
 	}
@@ -106,15 +192,66 @@ func (s *State) write() error {
 	if err != nil {
 		return fmt.Errorf("unable to write to %q: %v", s.Filename, err)
 	}
+	if s.Signer != nil {
+		return s.sign(stateBytes)
+	}
+	return nil
+}
+
+// verify returns an error unless the signature file holds a signature of the
+// state by the signer.
+func (s *State) verify(stateBytes []byte) error {
+	sigBytes, err := ioutil.ReadFile(s.SignatureFilename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("state file %q is not signed: %q not found", s.Filename, s.SignatureFilename())
+		}
+		return fmt.Errorf("unable to read state signature: %v", err)
+	}
+	if err := signature.Verify(s.Signer.PublicKey(), stateBytes, sigBytes); err != nil {
+		return fmt.Errorf("state file %q may have been tampered with: %v", s.Filename, err)
+	}
+	return nil
+}
+
+// Sign signs the state file as it is, e.g. after it is restored from a backup.
+func (s *State) Sign() error {
+	if s.Signer == nil {
+		return errors.New("no signer")
+	}
+	stateBytes, err := ioutil.ReadFile(s.Filename)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", s.Filename, err)
+	}
+	return s.sign(stateBytes)
+}
+
+// sign writes the signature of the state to the signature file.
+func (s *State) sign(stateBytes []byte) error {
+	sigBytes, err := signature.Sign(s.Signer, stateBytes)
+	if err != nil {
+		return fmt.Errorf("unable to sign state: %v", err)
+	}
+	if err := ioutil.WriteFile(s.SignatureFilename(), sigBytes, FileMode); err != nil {
+		return fmt.Errorf("unable to write state signature: %v", err)
+	}
 	return nil
 }
 
 // PushToAPIs reads objects in the state file and creates them using the APIs.
-// If the file does not exist, it will be created.
+// If the file does not exist, it will be created, unless the state is
+// read-only.
 func (s *State) PushToAPIs() error {
 	if err := s.read(); err != nil {
 		return err
 	}
+	if s.SecretStore != nil {
+		stored, err := secretstore.Resolve(s.SecretStore, s.SecretList.Items)
+		if err != nil {
+			return err
+		}
+		s.storedSecrets = stored
+	}
 	for _, secret := range s.SecretList.Items {
 		if _, err := s.KubeClient.CoreV1().Secrets(secret.Namespace).Create(&secret); err != nil {
 			return err
@@ -139,7 +276,8 @@ func (s *State) PushToAPIs() error {
 }
 
 // PullFromAPIs stores API objects in the state file. If the file does not
-// exist, it will be created.
+// exist, it will be created. If the state is read-only, ErrReadOnly is
+// returned.
 func (s *State) PullFromAPIs() error {
 	secretList, err := s.KubeClient.CoreV1().Secrets(corev1.NamespaceAll).List(metav1.ListOptions{})
 	if err != nil {
@@ -17,17 +17,27 @@ limitations under the License.
 package v2_test
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
 	spclientfake "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset/fake"
+	"golang.org/x/crypto/ssh"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeclientfake "k8s.io/client-go/kubernetes/fake"
 	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
 	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
 
+	"github.com/platform9/cctl/common"
 	state "github.com/platform9/cctl/pkg/state/v1"
+	v2 "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/secretstore"
 )
 
 const (
@@ -134,3 +144,258 @@ func TestPullFromAPIs(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.yaml")
+
+	s := v2.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+	s.ReadOnly = true
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unexpected error reading missing state file: %v", err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected state file not to be created, found %v", err)
+	}
+	if err := s.PullFromAPIs(); err != v2.ErrReadOnly {
+		t.Errorf("expected %v, found %v", v2.ErrReadOnly, err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("expected state file not to be written, found %v", err)
+	}
+}
+
+func TestSigned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.yaml")
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	newState := func() *v2.State {
+		s := v2.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+		s.Signer = signer
+		return s
+	}
+
+	s := newState()
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unexpected error reading new state file: %v", err)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	if err := newState().PushToAPIs(); err != nil {
+		t.Fatalf("expected signed state to be read, found %v", err)
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, v2.FileMode)
+	if err != nil {
+		t.Fatalf("unable to open state file: %v", err)
+	}
+	f.WriteString("# changed\n")
+	f.Close()
+	if err := newState().PushToAPIs(); err == nil {
+		t.Fatalf("expected tampered state not to be read")
+	}
+	s = newState()
+	s.IgnoreSignature = true
+	if err := s.PushToAPIs(); err != nil || s.SignatureError == nil {
+		t.Fatalf("expected tampered state to be read with signature error, found %v, %v", err, s.SignatureError)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	if err := newState().PushToAPIs(); err != nil {
+		t.Fatalf("expected state signed again to be read, found %v", err)
+	}
+
+	if err := os.Remove(s.SignatureFilename()); err != nil {
+		t.Fatalf("unable to remove signature: %v", err)
+	}
+	if err := newState().PushToAPIs(); err == nil {
+		t.Errorf("expected unsigned state not to be read")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.yaml")
+	backupDir := filepath.Join(dir, "backups")
+	newState := func() *v2.State {
+		s := v2.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+		s.BackupDir = backupDir
+		s.BackupRetain = 5
+		return s
+	}
+
+	s := newState()
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unexpected error reading new state file: %v", err)
+	}
+	if len(s.Backup) != 0 {
+		t.Errorf("expected no copy of a new state file, found %q", s.Backup)
+	}
+	original, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unable to read state file: %v", err)
+	}
+
+	s = newState()
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unable to read state: %v", err)
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: testNamespace}}
+	if _, err := s.KubeClient.CoreV1().Secrets(testNamespace).Create(secret); err != nil {
+		t.Fatalf("unable to create secret: %v", err)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	if len(s.Backup) == 0 {
+		t.Fatalf("expected the state file to be copied")
+	}
+	backup, err := ioutil.ReadFile(s.Backup)
+	if err != nil {
+		t.Fatalf("unable to read copy: %v", err)
+	}
+	if string(backup) != string(original) {
+		t.Errorf("expected the copy to hold the state before it was written, found %q", backup)
+	}
+	files, err := filepath.Glob(filepath.Join(backupDir, "*"))
+	if err != nil || len(files) != 1 {
+		t.Errorf("expected one copy for every state opened, found %v, %v", files, err)
+	}
+}
+
+// memoryStore is a secret store in memory.
+type memoryStore map[string]map[string][]byte
+
+func (m memoryStore) Read(path string) (map[string][]byte, error) {
+	data, ok := m[path]
+	if !ok {
+		return nil, secretstore.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m memoryStore) Write(path string, data map[string][]byte) error {
+	m[path] = data
+	return nil
+}
+
+func TestSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.yaml")
+	store := memoryStore{}
+	newState := func() *v2.State {
+		s := v2.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+		s.SecretStore = store
+		return s
+	}
+
+	s := newState()
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unexpected error reading new state file: %v", err)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ssh-credential",
+			Namespace:   testNamespace,
+			Annotations: map[string]string{common.VaultPathAnnotationKey: "secret/test/ssh-credential"},
+		},
+		Data: map[string][]byte{"ssh-privatekey": []byte("private key")},
+	}
+	if _, err := s.KubeClient.CoreV1().Secrets(testNamespace).Create(secret); err != nil {
+		t.Fatalf("unable to create secret: %v", err)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("unable to read state file: %v", err)
+	}
+	if strings.Contains(string(b), "ssh-privatekey") {
+		t.Errorf("expected the data of the secret not to be written to the state file:\n%s", b)
+	}
+	if string(store["secret/test/ssh-credential"]["ssh-privatekey"]) != "private key" {
+		t.Errorf("expected the data of the secret to be written to the store, found %v", store)
+	}
+
+	s = newState()
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unable to read state: %v", err)
+	}
+	read, err := s.KubeClient.CoreV1().Secrets(testNamespace).Get("ssh-credential", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get secret: %v", err)
+	}
+	if string(read.Data["ssh-privatekey"]) != "private key" {
+		t.Errorf("expected the data of the secret to be read from the store, found %v", read.Data)
+	}
+
+	// A secret kept in the store that is updated, or replaced by a new secret
+	// with the path of the existing one, is written to the store.
+	read.Data["ssh-privatekey"] = []byte("updated key")
+	if _, err := s.KubeClient.CoreV1().Secrets(testNamespace).Update(read); err != nil {
+		t.Fatalf("unable to update secret: %v", err)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	if string(store["secret/test/ssh-credential"]["ssh-privatekey"]) != "updated key" {
+		t.Errorf("expected the updated data of the secret to be written to the store, found %v", store)
+	}
+	replacement := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ssh-credential", Namespace: testNamespace},
+		Data:       map[string][]byte{"ssh-privatekey": []byte("replaced key")},
+	}
+	secretstore.KeepPath(replacement, read)
+	if _, err := s.KubeClient.CoreV1().Secrets(testNamespace).Update(replacement); err != nil {
+		t.Fatalf("unable to update secret: %v", err)
+	}
+	if err := s.PullFromAPIs(); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	if string(store["secret/test/ssh-credential"]["ssh-privatekey"]) != "replaced key" {
+		t.Errorf("expected the replaced data of the secret to be written to the store, found %v", store)
+	}
+	if b, err = ioutil.ReadFile(filename); err != nil {
+		t.Fatalf("unable to read state file: %v", err)
+	}
+	if strings.Contains(string(b), "ssh-privatekey") {
+		t.Errorf("expected the data of the updated secret not to be written to the state file:\n%s", b)
+	}
+
+	s = v2.NewWithFile(filename, kubeclientfake.NewSimpleClientset(), clusterclientfake.NewSimpleClientset(), spclientfake.NewSimpleClientset())
+	if err := s.PushToAPIs(); err != nil {
+		t.Fatalf("unable to read state without a store: %v", err)
+	}
+	if len(s.SecretList.Items) != 1 || len(s.SecretList.Items[0].Data) != 0 {
+		t.Errorf("expected the secret without its data, found %v", s.SecretList.Items)
+	}
+}
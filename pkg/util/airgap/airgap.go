@@ -0,0 +1,322 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package airgap downloads the artifacts that machines otherwise download when
+// they are provisioned, into a bundle directory, so that they can be pushed
+// to machines without internet access.
+package airgap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestFile is the file, in the bundle directory, that lists the
+	// artifacts.
+	ManifestFile = "manifest.json"
+	// HTTPTimeout bounds every request of HTTPGetter, including reading the
+	// body, so that a stalled download fails rather than hangs.
+	HTTPTimeout = 10 * time.Minute
+)
+
+// Versions are the versions of the components whose artifacts are bundled.
+type Versions struct {
+	Nodeadm    string `json:"nodeadm"`
+	Etcdadm    string `json:"etcdadm"`
+	Kubernetes string `json:"kubernetes"`
+	CNI        string `json:"cni"`
+	Arch       string `json:"arch"`
+}
+
+// Artifact is a file that a machine needs to be provisioned.
+type Artifact struct {
+	Component string `json:"component"`
+	URL       string `json:"url"`
+	// File is the path of the artifact, relative to the bundle directory, and
+	// to the cache on machines. It is <component>/<version>/<name>, the
+	// layout from which the provider installs nodeadm and etcdadm.
+	File   string `json:"file"`
+	SHA256 string `json:"sha256,omitempty"`
+	// ChecksumURL is the URL of the SHA-256 checksum published with the
+	// artifact, if any. The downloaded artifact must match it.
+	ChecksumURL string `json:"checksumURL,omitempty"`
+	// Executable artifacts are pushed with mode 0755.
+	Executable bool `json:"executable"`
+}
+
+// Manifest lists the artifacts of a bundle.
+type Manifest struct {
+	Versions  Versions   `json:"versions"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Artifacts returns the artifacts of the versions.
+func Artifacts(v Versions) ([]Artifact, error) {
+	for name, value := range map[string]string{"nodeadm": v.Nodeadm, "etcdadm": v.Etcdadm, "kubernetes": v.Kubernetes, "cni": v.CNI, "arch": v.Arch} {
+		if len(value) == 0 {
+			return nil, fmt.Errorf("no %s version", name)
+		}
+		if strings.ContainsAny(value, "/ ") {
+			return nil, fmt.Errorf("invalid %s version %q", name, value)
+		}
+	}
+	k8s := "v" + strings.TrimPrefix(v.Kubernetes, "v")
+	artifacts := []Artifact{
+		{
+			Component:  "nodeadm",
+			URL:        fmt.Sprintf("https://github.com/platform9/nodeadm/releases/download/%s/nodeadm", v.Nodeadm),
+			File:       CacheFile("nodeadm", v.Nodeadm),
+			Executable: true,
+		},
+		{
+			Component:  "etcdadm",
+			URL:        fmt.Sprintf("https://github.com/platform9/etcdadm/releases/download/%s/etcdadm", v.Etcdadm),
+			File:       CacheFile("etcdadm", v.Etcdadm),
+			Executable: true,
+		},
+	}
+	for _, bin := range []string{"kubelet", "kubeadm", "kubectl"} {
+		url := fmt.Sprintf("https://dl.k8s.io/release/%s/bin/linux/%s/%s", k8s, v.Arch, bin)
+		artifacts = append(artifacts, Artifact{
+			Component:   bin,
+			URL:         url,
+			File:        path.Join(bin, k8s, bin),
+			ChecksumURL: url + ".sha256",
+			Executable:  true,
+		})
+	}
+	cniFile := fmt.Sprintf("cni-plugins-%s-%s.tgz", v.Arch, v.CNI)
+	cniURL := fmt.Sprintf("https://github.com/containernetworking/plugins/releases/download/%s/%s", v.CNI, cniFile)
+	artifacts = append(artifacts, Artifact{
+		Component:   "cni",
+		URL:         cniURL,
+		File:        path.Join("cni", v.CNI, cniFile),
+		ChecksumURL: cniURL + ".sha256",
+	})
+	return artifacts, nil
+}
+
+// CacheFile returns the path, relative to the bundle directory and to the
+// cache on machines, of the binary of the component, named after it.
+func CacheFile(component, version string) string {
+	return path.Join(component, version, component)
+}
+
+// Getter returns the body of the URL.
+type Getter func(url string) (io.ReadCloser, error)
+
+var httpClient = &http.Client{Timeout: HTTPTimeout}
+
+// HTTPGetter gets URLs with an HTTP client whose requests time out after
+// HTTPTimeout.
+func HTTPGetter(url string) (io.ReadCloser, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %q", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// Download gets every artifact of the versions into the directory, and writes
+// the manifest, with their checksums. An artifact with a published checksum
+// must match it. Artifacts already in the directory, with the checksum of the
+// existing manifest, are not downloaded again.
+func Download(dir string, v Versions, get Getter, logf func(format string, args ...interface{})) (Manifest, error) {
+	artifacts, err := Artifacts(v)
+	if err != nil {
+		return Manifest{}, err
+	}
+	previous := make(map[string]string)
+	if m, err := ReadManifest(dir); err == nil {
+		for _, a := range m.Artifacts {
+			previous[a.File] = a.SHA256
+		}
+	}
+	for i := range artifacts {
+		a := &artifacts[i]
+		local := filepath.Join(dir, filepath.FromSlash(a.File))
+		if sum, ok := previous[a.File]; ok {
+			if existing, err := fileChecksum(local); err == nil && existing == sum {
+				logf("Already downloaded %s", a.File)
+				a.SHA256 = sum
+				continue
+			}
+		}
+		var published string
+		if len(a.ChecksumURL) != 0 {
+			if published, err = publishedChecksum(get, a.ChecksumURL); err != nil {
+				return Manifest{}, fmt.Errorf("unable to get checksum %q: %v", a.ChecksumURL, err)
+			}
+		}
+		logf("Downloading %s", a.URL)
+		if a.SHA256, err = download(get, a.URL, local); err != nil {
+			return Manifest{}, fmt.Errorf("unable to download %q: %v", a.URL, err)
+		}
+		if len(published) != 0 && a.SHA256 != published {
+			os.Remove(local)
+			return Manifest{}, fmt.Errorf("checksum of %q is %s, but %q publishes %s", a.URL, a.SHA256, a.ChecksumURL, published)
+		}
+	}
+	m := Manifest{Versions: v, Artifacts: artifacts}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("unable to encode manifest: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestFile), b, 0644); err != nil {
+		return Manifest{}, fmt.Errorf("unable to write manifest: %v", err)
+	}
+	return m, nil
+}
+
+// download writes the body of the URL to the file, through a temporary file,
+// and returns its checksum.
+func download(get Getter, url, file string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+	body, err := get(url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	tmp := file + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), body); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// publishedChecksum returns the checksum in the body of the URL. The body is
+// the checksum, optionally followed by the name of the file, as written by
+// sha256sum.
+func publishedChecksum(get Getter, url string) (string, error) {
+	body, err := get(url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	// The body is a line, but is read only up to a bound, in case the URL
+	// is not a checksum.
+	b, err := ioutil.ReadAll(io.LimitReader(body, 4096))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no checksum")
+	}
+	sum := strings.ToLower(fields[0])
+	if _, err := hex.DecodeString(sum); err != nil || len(sum) != hex.EncodedLen(sha256.Size) {
+		return "", fmt.Errorf("invalid checksum %q", fields[0])
+	}
+	return sum, nil
+}
+
+// ReadManifest reads the manifest of the bundle directory.
+func ReadManifest(dir string) (Manifest, error) {
+	var m Manifest
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return m, fmt.Errorf("unable to read manifest: %v", err)
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("unable to decode manifest: %v", err)
+	}
+	return m, nil
+}
+
+// Verify checks that every artifact of the manifest is in the directory, with
+// its checksum.
+func Verify(dir string, m Manifest) error {
+	for _, a := range m.Artifacts {
+		sum, err := fileChecksum(filepath.Join(dir, filepath.FromSlash(a.File)))
+		if err != nil {
+			return fmt.Errorf("unable to read artifact %q: %v", a.File, err)
+		}
+		if sum != a.SHA256 {
+			return fmt.Errorf("checksum of artifact %q is %s, expected %s", a.File, sum, a.SHA256)
+		}
+	}
+	return nil
+}
+
+// VerifyFile checks that the file, relative to the directory, has the checksum
+// of the manifest of the directory. A directory without a manifest, e.g. one
+// filled by hand, or a file not in the manifest, is not checked.
+func VerifyFile(dir, file string) error {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, ManifestFile)); os.IsNotExist(statErr) {
+			return nil
+		}
+		return err
+	}
+	for _, a := range m.Artifacts {
+		if a.File != file {
+			continue
+		}
+		sum, err := fileChecksum(filepath.Join(dir, filepath.FromSlash(a.File)))
+		if err != nil {
+			return fmt.Errorf("unable to read artifact %q: %v", a.File, err)
+		}
+		if sum != a.SHA256 {
+			return fmt.Errorf("checksum of artifact %q is %s, expected %s", a.File, sum, a.SHA256)
+		}
+	}
+	return nil
+}
+
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package airgap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testVersions = Versions{Nodeadm: "v0.3.0", Etcdadm: "v0.1.1", Kubernetes: "1.12.8", CNI: "v0.6.0", Arch: "amd64"}
+
+func TestArtifacts(t *testing.T) {
+	artifacts, err := Artifacts(testVersions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, a := range artifacts {
+		files[a.File] = a.URL
+	}
+	want := map[string]string{
+		"nodeadm/v0.3.0/nodeadm":                  "https://github.com/platform9/nodeadm/releases/download/v0.3.0/nodeadm",
+		"etcdadm/v0.1.1/etcdadm":                  "https://github.com/platform9/etcdadm/releases/download/v0.1.1/etcdadm",
+		"kubelet/v1.12.8/kubelet":                 "https://dl.k8s.io/release/v1.12.8/bin/linux/amd64/kubelet",
+		"kubeadm/v1.12.8/kubeadm":                 "https://dl.k8s.io/release/v1.12.8/bin/linux/amd64/kubeadm",
+		"kubectl/v1.12.8/kubectl":                 "https://dl.k8s.io/release/v1.12.8/bin/linux/amd64/kubectl",
+		"cni/v0.6.0/cni-plugins-amd64-v0.6.0.tgz": "https://github.com/containernetworking/plugins/releases/download/v0.6.0/cni-plugins-amd64-v0.6.0.tgz",
+	}
+	for _, a := range artifacts {
+		switch a.Component {
+		case "nodeadm", "etcdadm":
+			if len(a.ChecksumURL) != 0 {
+				t.Errorf("artifact %q: got checksum URL %q, want none", a.File, a.ChecksumURL)
+			}
+		default:
+			if a.ChecksumURL != a.URL+".sha256" {
+				t.Errorf("artifact %q: got checksum URL %q, want %q", a.File, a.ChecksumURL, a.URL+".sha256")
+			}
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("got %d artifacts, want %d", len(files), len(want))
+	}
+	for file, url := range want {
+		if files[file] != url {
+			t.Errorf("artifact %q: got URL %q, want %q", file, files[file], url)
+		}
+	}
+	bad := testVersions
+	bad.Kubernetes = "../1.12.8"
+	if _, err := Artifacts(bad); err == nil {
+		t.Errorf("expected an error for a version with a path separator")
+	}
+}
+
+// testGetter returns a getter that serves "content of <url>" for every URL,
+// and its checksum, followed by the file name, for the checksum URL. The
+// getter counts the artifacts it serves.
+func testGetter(gets *int) Getter {
+	return func(url string) (io.ReadCloser, error) {
+		if strings.HasSuffix(url, ".sha256") {
+			artifact := strings.TrimSuffix(url, ".sha256")
+			sum := sha256.Sum256([]byte("content of " + artifact))
+			return ioutil.NopCloser(strings.NewReader(hex.EncodeToString(sum[:]) + "  " + filepath.Base(artifact) + "\n")), nil
+		}
+		*gets++
+		return ioutil.NopCloser(strings.NewReader("content of " + url)), nil
+	}
+}
+
+func TestDownloadAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airgap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var gets int
+	get := testGetter(&gets)
+	logf := func(format string, args ...interface{}) {}
+	m, err := Download(dir, testVersions, get, logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gets != len(m.Artifacts) {
+		t.Errorf("got %d downloads, want %d", gets, len(m.Artifacts))
+	}
+	read, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(dir, read); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := VerifyFile(dir, CacheFile("nodeadm", "v0.3.0")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Artifacts already downloaded are not downloaded again.
+	gets = 0
+	if _, err := Download(dir, testVersions, get, logf); err != nil {
+		t.Fatal(err)
+	}
+	if gets != 0 {
+		t.Errorf("got %d downloads of downloaded artifacts", gets)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "nodeadm", "v0.3.0", "nodeadm"), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(dir, read); err == nil {
+		t.Errorf("expected an error for a corrupt artifact")
+	}
+	if err := VerifyFile(dir, CacheFile("nodeadm", "v0.3.0")); err == nil {
+		t.Errorf("expected an error for a corrupt artifact")
+	}
+	if err := VerifyFile(dir, CacheFile("etcdadm", "v0.1.1")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, ManifestFile)); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(dir, CacheFile("nodeadm", "v0.3.0")); err != nil {
+		t.Errorf("expected a directory without a manifest not to be checked, got %v", err)
+	}
+}
+
+func TestDownloadError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airgap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	get := func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("unreachable")
+	}
+	if _, err := Download(dir, testVersions, get, func(string, ...interface{}) {}); err == nil {
+		t.Errorf("expected an error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, ManifestFile)); !os.IsNotExist(err) {
+		t.Errorf("expected no manifest after a failed download")
+	}
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "airgap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var gets int
+	valid := testGetter(&gets)
+	get := func(url string) (io.ReadCloser, error) {
+		if strings.HasSuffix(url, "/kubeadm") {
+			return ioutil.NopCloser(strings.NewReader("tampered")), nil
+		}
+		return valid(url)
+	}
+	_, err = Download(dir, testVersions, get, func(string, ...interface{}) {})
+	if err == nil || !strings.Contains(err.Error(), "kubeadm.sha256") {
+		t.Errorf("expected a checksum mismatch of kubeadm, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "kubeadm", "v1.12.8", "kubeadm")); !os.IsNotExist(err) {
+		t.Errorf("expected the mismatched artifact to be removed")
+	}
+
+	get = func(url string) (io.ReadCloser, error) {
+		if strings.HasSuffix(url, ".sha256") {
+			return ioutil.NopCloser(strings.NewReader("<html>Not Found</html>")), nil
+		}
+		return valid(url)
+	}
+	if _, err := Download(dir, testVersions, get, func(string, ...interface{}) {}); err == nil || !strings.Contains(err.Error(), "invalid checksum") {
+		t.Errorf("expected an invalid checksum, got %v", err)
+	}
+}
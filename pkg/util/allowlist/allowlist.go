@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package allowlist describes the commands cctl runs on machines as patterns,
+// so that they can be allowed in sudoers or a restricted shell, and checks
+// commands against them.
+package allowlist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Entry is a pattern of commands cctl runs on machines, and why it runs them.
+type Entry struct {
+	Pattern string `json:"pattern"`
+	Purpose string `json:"purpose"`
+}
+
+// Match returns true if the command matches the pattern. As in sudoers, an
+// asterisk matches any sequence of characters, including spaces, and every
+// other character matches itself.
+func Match(pattern, command string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == '*' {
+			pattern = strings.TrimLeft(pattern, "*")
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(command); i++ {
+				if Match(pattern, command[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(command) == 0 || pattern[0] != command[0] {
+			return false
+		}
+		pattern, command = pattern[1:], command[1:]
+	}
+	return len(command) == 0
+}
+
+// List is a list of command patterns.
+type List []string
+
+// Allows returns true if the command matches any of the patterns.
+func (l List) Allows(command string) bool {
+	for _, pattern := range l {
+		if Match(pattern, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads one pattern per line. Blank lines, and lines that start with #,
+// are ignored.
+func Parse(r io.Reader) (List, error) {
+	var l List
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l = append(l, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read patterns: %v", err)
+	}
+	return l, nil
+}
+
+// Write writes the entries in the format read by Parse, with the purpose of
+// each pattern as a comment.
+func Write(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "# %s\n%s\n", e.Purpose, e.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSudoers writes the entries as sudoers rules that let the user run them
+// as root without a password. sudoers requires the absolute path of every
+// program, so programs given by name are assumed to be in binDir.
+func WriteSudoers(w io.Writer, user, binDir string, entries []Entry) error {
+	for _, e := range entries {
+		pattern := e.Pattern
+		if !path.IsAbs(pattern) {
+			pattern = strings.TrimRight(binDir, "/") + "/" + pattern
+		}
+		if _, err := fmt.Fprintf(w, "# %s\n%s ALL=(root) NOPASSWD: %s\n", e.Purpose, user, escapeSudoers(pattern)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeSudoers escapes the characters that are special in the arguments of a
+// sudoers command.
+func escapeSudoers(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ":", `\:`, "=", `\=`).Replace(s)
+}
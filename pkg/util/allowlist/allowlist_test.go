@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package allowlist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		command string
+		match   bool
+	}{
+		{"nproc", "nproc", true},
+		{"nproc", "nproc --all", false},
+		{"cat /proc/meminfo", "cat /proc/meminfo", true},
+		{"mkdir -p *", "mkdir -p /var/cache/ssh-provider", true},
+		{"mkdir -p *", "mkdir -p", false},
+		{"mkdir -p*", "mkdir -p", true},
+		{"timeout --kill-after=30s *s /opt/bin/kubeadm *", "timeout --kill-after=30s 900s /opt/bin/kubeadm config view", true},
+		{"timeout --kill-after=30s *s /opt/bin/kubeadm *", "timeout --kill-after=30s 900s /opt/bin/etcdadm info", false},
+		{"/opt/bin/etcdadm *", "/opt/bin/etcdadmx info", false},
+		{"*", "", true},
+		{"a**b", "ab", true},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, test.command); got != test.match {
+			t.Errorf("Match(%q, %q) = %v, expected %v", test.pattern, test.command, got, test.match)
+		}
+	}
+}
+
+func TestParseAndAllows(t *testing.T) {
+	l, err := Parse(strings.NewReader("# file helpers\nmkdir -p *\n\n  rm -f *  \n"))
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	if len(l) != 2 || l[1] != "rm -f *" {
+		t.Fatalf("unexpected list %q", l)
+	}
+	if !l.Allows("rm -f /tmp/x") || l.Allows("rm -rf /") {
+		t.Errorf("unexpected result of Allows")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	entries := []Entry{
+		{Pattern: "nproc", Purpose: "Count CPUs"},
+		{Pattern: "/opt/bin/kubectl --kubeconfig=* get *", Purpose: "Get nodes"},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, entries); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	l, err := Parse(&b)
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	if len(l) != 2 || l[0] != "nproc" {
+		t.Errorf("unexpected list %q", l)
+	}
+
+	b.Reset()
+	if err := WriteSudoers(&b, "cctl", "/usr/bin/", entries); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	expected := "# Count CPUs\ncctl ALL=(root) NOPASSWD: /usr/bin/nproc\n" +
+		"# Get nodes\ncctl ALL=(root) NOPASSWD: /opt/bin/kubectl --kubeconfig\\=* get *\n"
+	if b.String() != expected {
+		t.Errorf("unexpected sudoers rules:\n%s", b.String())
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apiendpoint keeps the API endpoint of the control plane current
+// outside of the masters: it runs the hook that updates the backends of an
+// external load balancer, and points kubeconfigs at the endpoint.
+package apiendpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Actions of the events given to the hook.
+const (
+	ActionAdded   = "added"
+	ActionRemoved = "removed"
+	ActionSync    = "sync"
+)
+
+// Hook is run when masters are added or removed. The event is POSTed as JSON
+// to the URL, and given to the command on its standard input.
+type Hook struct {
+	URL     string `json:"url,omitempty"`
+	Command string `json:"command,omitempty"`
+	// Endpoint is the address, as host:port, of the external load balancer.
+	// If set, the kubelet and kube-proxy of nodes are pointed at it.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Validate returns an error if the URL is not an http or https URL, or the
+// endpoint is not a host:port address.
+func (h Hook) Validate() error {
+	if len(h.URL) != 0 {
+		u, err := url.Parse(h.URL)
+		if err != nil {
+			return fmt.Errorf("unable to parse URL %q: %v", h.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("URL %q must be http or https", h.URL)
+		}
+	}
+	if len(h.Endpoint) != 0 {
+		if _, _, err := net.SplitHostPort(h.Endpoint); err != nil {
+			return fmt.Errorf("endpoint %q must be host:port: %v", h.Endpoint, err)
+		}
+	}
+	return nil
+}
+
+// Runs returns true if the hook has a URL or a command.
+func (h Hook) Runs() bool {
+	return len(h.URL) != 0 || len(h.Command) != 0
+}
+
+// Event describes a change of the masters.
+type Event struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	// Action is added, removed, or sync, if the masters did not change.
+	Action  string `json:"action"`
+	Machine string `json:"machine,omitempty"`
+	// Backends are the API server addresses, as host:port, of every master
+	// after the change.
+	Backends []string `json:"backends"`
+}
+
+// Run gives the event to the URL, then to the command, of the hook. It
+// returns an error if either does not complete successfully before the
+// timeout.
+func Run(h Hook, e Event, timeout time.Duration) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if len(h.URL) != 0 {
+		if err := post(ctx, h.URL, body); err != nil {
+			return err
+		}
+	}
+	if len(h.Command) != 0 {
+		cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+		cmd.Stdin = bytes.NewReader(body)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("error running %q: %v (output: %q)", h.Command, err, string(out))
+		}
+	}
+	return nil
+}
+
+func post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("unable to post to %q: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%q responded %s: %q", url, resp.Status, string(msg))
+	}
+	return nil
+}
+
+// serverLine matches the server of a cluster in a kubeconfig.
+var serverLine = regexp.MustCompile(`(?m)^([ \t]*server:[ \t]*)\S+[ \t]*$`)
+
+// SetServer returns the kubeconfig with the server of every cluster set to
+// https://endpoint. The rest of the kubeconfig is kept as it is. It returns
+// false if every server already is the endpoint.
+func SetServer(kubeconfig []byte, endpoint string) ([]byte, bool, error) {
+	if !serverLine.Match(kubeconfig) {
+		return nil, false, fmt.Errorf("kubeconfig has no server")
+	}
+	server := []byte("${1}https://" + endpoint)
+	updated := serverLine.ReplaceAll(kubeconfig, server)
+	return updated, !bytes.Equal(updated, kubeconfig), nil
+}
+
+// Endpoints of the admin kubeconfig copied to machines.
+const (
+	// EndpointVIP is the VIP of the cluster.
+	EndpointVIP = "vip"
+	// EndpointDNS is the DNS name of the API endpoint of the cluster.
+	EndpointDNS = "dns"
+	// EndpointMaster is the master the kubeconfig is copied from.
+	EndpointMaster = "master"
+)
+
+// KubeconfigPolicy chooses the server of the admin kubeconfig copied to each
+// machine, for machines that cannot reach the server in the kubeconfig of the
+// masters, e.g. workers behind NAT.
+type KubeconfigPolicy struct {
+	// Default is the endpoint of machines that are not at one of the sites:
+	// vip, dns, master, or empty to keep the server of the kubeconfig.
+	Default string `json:"default,omitempty"`
+	// SiteLabel is the node label whose value is the site of a machine.
+	SiteLabel string `json:"siteLabel,omitempty"`
+	// Sites are the addresses, as host:port, at which machines at each site
+	// reach the API server, e.g. a NAT address.
+	Sites map[string]string `json:"sites,omitempty"`
+}
+
+// Validate returns an error if the default is not known, or a site address
+// is not a host:port address.
+func (p KubeconfigPolicy) Validate() error {
+	switch p.Default {
+	case "", EndpointVIP, EndpointDNS, EndpointMaster:
+	default:
+		return fmt.Errorf("default endpoint %q must be %s, %s, or %s", p.Default, EndpointVIP, EndpointDNS, EndpointMaster)
+	}
+	if len(p.Sites) != 0 && len(p.SiteLabel) == 0 {
+		return fmt.Errorf("site addresses require a site label")
+	}
+	for site, endpoint := range p.Sites {
+		if _, _, err := net.SplitHostPort(endpoint); err != nil {
+			return fmt.Errorf("address %q of site %q must be host:port: %v", endpoint, site, err)
+		}
+	}
+	return nil
+}
+
+// ParseSites returns the site addresses given as site=host:port.
+func ParseSites(pairs []string) (map[string]string, error) {
+	sites := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, fmt.Errorf("%q must be site=host:port", pair)
+		}
+		sites[kv[0]] = kv[1]
+	}
+	return sites, nil
+}
+
+// Endpoint returns the server, as host:port, of the admin kubeconfig of the
+// machine with the node labels. vip is the VIP endpoint, empty if the cluster
+// has no VIP, dns the endpoint by the DNS name of the cluster, empty if it has
+// none, and master the endpoint of the master the kubeconfig is copied from.
+// It returns an empty endpoint if the server is kept.
+func (p KubeconfigPolicy) Endpoint(labels map[string]string, vip, dns, master string) (string, error) {
+	if len(p.SiteLabel) != 0 {
+		if site, ok := labels[p.SiteLabel]; ok {
+			if endpoint, ok := p.Sites[site]; ok {
+				return endpoint, nil
+			}
+		}
+	}
+	switch p.Default {
+	case EndpointVIP:
+		if len(vip) == 0 {
+			return "", fmt.Errorf("the cluster has no VIP")
+		}
+		return vip, nil
+	case EndpointDNS:
+		if len(dns) == 0 {
+			return "", fmt.Errorf("the cluster has no DNS name")
+		}
+		return dns, nil
+	case EndpointMaster:
+		return master, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiendpoint
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const kubeletKubeconfig = `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: Y2E=
+    server: https://10.0.0.1:6443
+  name: default-cluster
+contexts:
+- context:
+    cluster: default-cluster
+    user: default-auth
+  name: default-context
+current-context: default-context
+kind: Config
+`
+
+func TestSetServer(t *testing.T) {
+	updated, changed, err := SetServer([]byte(kubeletKubeconfig), "lb.example.com:443")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected kubeconfig to change")
+	}
+	expected := `apiVersion: v1
+clusters:
+- cluster:
+    certificate-authority-data: Y2E=
+    server: https://lb.example.com:443
+  name: default-cluster
+contexts:
+- context:
+    cluster: default-cluster
+    user: default-auth
+  name: default-context
+current-context: default-context
+kind: Config
+`
+	if diff := cmp.Diff(expected, string(updated)); diff != "" {
+		t.Errorf("unexpected kubeconfig (-want +got):\n%s", diff)
+	}
+	if _, changed, err := SetServer(updated, "lb.example.com:443"); err != nil || changed {
+		t.Errorf("expected no change, got changed %t, error %v", changed, err)
+	}
+	if _, _, err := SetServer([]byte("kind: Config\n"), "lb.example.com:443"); err == nil {
+		t.Errorf("expected error for kubeconfig without server")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, h := range []Hook{
+		{URL: "ftp://lb.example.com"},
+		{Endpoint: "lb.example.com"},
+	} {
+		if err := h.Validate(); err == nil {
+			t.Errorf("expected error for %+v", h)
+		}
+	}
+	h := Hook{URL: "https://lb.example.com/backends", Command: "true", Endpoint: "lb.example.com:443"}
+	if err := h.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	event := Event{
+		Cluster:   "cctl-cluster",
+		Namespace: "default",
+		Action:    ActionAdded,
+		Machine:   "10.0.0.2",
+		Backends:  []string{"10.0.0.1:6443", "10.0.0.2:6443"},
+	}
+	var posted Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "apiendpoint")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "event.json")
+	h := Hook{URL: server.URL, Command: "cat > " + out}
+	if err := Run(h, event, 10*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff(event, posted); diff != "" {
+		t.Errorf("unexpected posted event (-want +got):\n%s", diff)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("unable to read event given to command: %v", err)
+	}
+	var given Event
+	if err := json.Unmarshal(b, &given); err != nil {
+		t.Fatalf("unable to decode event given to command: %v", err)
+	}
+	if diff := cmp.Diff(event, given); diff != "" {
+		t.Errorf("unexpected event given to command (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such pool", http.StatusNotFound)
+	}))
+	defer server.Close()
+	if err := Run(Hook{URL: server.URL}, Event{}, 10*time.Second); err == nil {
+		t.Errorf("expected error for failed request")
+	}
+	if err := Run(Hook{Command: "exit 1"}, Event{}, 10*time.Second); err == nil {
+		t.Errorf("expected error for failed command")
+	}
+	if err := Run(Hook{Command: "exec sleep 5"}, Event{}, 100*time.Millisecond); err == nil {
+		t.Errorf("expected error for command that times out")
+	}
+}
+
+func TestKubeconfigPolicy(t *testing.T) {
+	sites, err := ParseSites([]string{"branch=203.0.113.10:6443"})
+	if err != nil {
+		t.Fatalf("unable to parse sites: %v", err)
+	}
+	p := KubeconfigPolicy{Default: EndpointVIP, SiteLabel: "site", Sites: sites}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tc := range []struct {
+		labels   map[string]string
+		expected string
+	}{
+		{labels: map[string]string{"site": "branch"}, expected: "203.0.113.10:6443"},
+		{labels: map[string]string{"site": "datacenter"}, expected: "10.0.0.100:6443"},
+		{labels: nil, expected: "10.0.0.100:6443"},
+	} {
+		endpoint, err := p.Endpoint(tc.labels, "10.0.0.100:6443", "", "10.0.0.1:6443")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if endpoint != tc.expected {
+			t.Errorf("expected endpoint %q for labels %v, found %q", tc.expected, tc.labels, endpoint)
+		}
+	}
+	if _, err := p.Endpoint(nil, "", "", "10.0.0.1:6443"); err == nil {
+		t.Errorf("expected error for the VIP of a cluster without a VIP")
+	}
+	if endpoint, _ := (KubeconfigPolicy{Default: EndpointMaster}).Endpoint(nil, "", "", "10.0.0.1:6443"); endpoint != "10.0.0.1:6443" {
+		t.Errorf("expected the master endpoint, found %q", endpoint)
+	}
+	if endpoint, _ := (KubeconfigPolicy{Default: EndpointDNS}).Endpoint(nil, "10.0.0.100:6443", "api.example.com:6443", "10.0.0.1:6443"); endpoint != "api.example.com:6443" {
+		t.Errorf("expected the DNS endpoint, found %q", endpoint)
+	}
+	if _, err := (KubeconfigPolicy{Default: EndpointDNS}).Endpoint(nil, "10.0.0.100:6443", "", "10.0.0.1:6443"); err == nil {
+		t.Errorf("expected error for the DNS name of a cluster without a DNS name")
+	}
+	if endpoint, _ := (KubeconfigPolicy{}).Endpoint(nil, "10.0.0.100:6443", "", "10.0.0.1:6443"); len(endpoint) != 0 {
+		t.Errorf("expected the server to be kept, found %q", endpoint)
+	}
+	for _, p := range []KubeconfigPolicy{
+		{Default: "nat"},
+		{Sites: map[string]string{"branch": "203.0.113.10:6443"}},
+		{SiteLabel: "site", Sites: map[string]string{"branch": "203.0.113.10"}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+	if _, err := ParseSites([]string{"branch"}); err == nil {
+		t.Errorf("expected error for a site without an address")
+	}
+}
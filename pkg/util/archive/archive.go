@@ -76,6 +76,24 @@ func Extract(archivePath, statePath, etcdSnapshotPath string) error {
 	})
 }
 
+// ExtractState extracts only the state file of the archive.
+func ExtractState(archivePath, statePath string) error {
+	tempDir, err := ioutil.TempDir(os.TempDir(), "cctl")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory to extract archive: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	tempStatePath := filepath.Join(tempDir, internalStateFile)
+
+	cmdExtractState := exec.Command("tar", "--file", archivePath, "--directory", tempDir, "--extract", "--gzip", internalStateFile)
+	cmdMoveState := exec.Command("mv", tempStatePath, statePath)
+
+	return runAllCommands([]*exec.Cmd{
+		cmdExtractState,
+		cmdMoveState,
+	})
+}
+
 func runAllCommands(commands []*exec.Cmd) error {
 	for _, c := range commands {
 		err := c.Run()
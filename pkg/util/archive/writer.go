@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Writer writes files to a gzip-compressed tar archive.
+type Writer struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+// NewWriter returns a Writer that writes the archive to w.
+func NewWriter(w io.Writer) *Writer {
+	gw := gzip.NewWriter(w)
+	return &Writer{
+		gw: gw,
+		tw: tar.NewWriter(gw),
+	}
+}
+
+// WriteFile adds a file with the given name and contents to the archive.
+func (w *Writer) WriteFile(name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("unable to write header for %q: %v", name, err)
+	}
+	if _, err := w.tw.Write(data); err != nil {
+		return fmt.Errorf("unable to write %q: %v", name, err)
+	}
+	return nil
+}
+
+// Close finishes writing the archive. It does not close the underlying
+// writer.
+func (w *Writer) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.gw.Close()
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriter(t *testing.T) {
+	files := map[string]string{
+		"10.0.0.1/kubelet.log": "kubelet log",
+		"state/machines.yaml":  "",
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for name, data := range files {
+		if err := w.WriteFile(name, []byte(data)); err != nil {
+			t.Fatalf("unable to write file: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unable to close writer: %v", err)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("unable to read gzip: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	actual := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unable to read tar: %v", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("unable to read %q: %v", hdr.Name, err)
+		}
+		actual[hdr.Name] = string(data)
+	}
+	if !cmp.Equal(files, actual) {
+		t.Fatalf("expected %v, found %v", files, actual)
+	}
+}
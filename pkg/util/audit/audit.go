@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit configures the audit logging of the API server.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/platform9/cctl/pkg/util/staticpod"
+)
+
+const (
+	// PolicyDir is the directory of the audit policy on masters.
+	PolicyDir = "/etc/kubernetes/audit"
+	// LogDir is the directory of the audit log on masters.
+	LogDir = "/var/log/kubernetes/audit"
+
+	policyVolume = "audit-policy"
+	logVolume    = "audit-log"
+	flagPrefix   = "--audit-"
+)
+
+// PolicyFile is the path of the audit policy on masters.
+var PolicyFile = path.Join(PolicyDir, "policy.yaml")
+
+// LogFile is the path of the audit log on masters.
+var LogFile = path.Join(LogDir, "audit.log")
+
+// policyAPIVersions are the API versions of the audit policy accepted by the
+// supported API servers.
+var policyAPIVersions = map[string]bool{
+	"audit.k8s.io/v1":       true,
+	"audit.k8s.io/v1beta1":  true,
+	"audit.k8s.io/v1alpha1": true,
+}
+
+// ValidatePolicy returns an error if the YAML or JSON document is not an
+// audit policy with at least one rule.
+func ValidatePolicy(data []byte) error {
+	var policy struct {
+		APIVersion string            `json:"apiVersion"`
+		Kind       string            `json:"kind"`
+		Rules      []json.RawMessage `json:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("unable to decode audit policy: %v", err)
+	}
+	if policy.Kind != "Policy" {
+		return fmt.Errorf("kind is %q, must be Policy", policy.Kind)
+	}
+	if !policyAPIVersions[policy.APIVersion] {
+		return fmt.Errorf("apiVersion is %q, must be audit.k8s.io/v1, v1beta1, or v1alpha1", policy.APIVersion)
+	}
+	if len(policy.Rules) == 0 {
+		return fmt.Errorf("policy has no rules")
+	}
+	return nil
+}
+
+// LogRotation configures how the API server rotates the audit log.
+type LogRotation struct {
+	// MaxAge is the number of days old logs are kept.
+	MaxAge int `json:"maxAge"`
+	// MaxBackup is the number of old logs kept.
+	MaxBackup int `json:"maxBackup"`
+	// MaxSize is the size, in megabytes, at which the log is rotated.
+	MaxSize int `json:"maxSize"`
+}
+
+// Validate returns an error if a setting is negative.
+func (r LogRotation) Validate() error {
+	if r.MaxAge < 0 || r.MaxBackup < 0 || r.MaxSize < 0 {
+		return fmt.Errorf("audit log rotation settings must not be negative")
+	}
+	return nil
+}
+
+// Args returns the API server arguments that enable audit logging.
+func (r LogRotation) Args() map[string]string {
+	return map[string]string{
+		"audit-policy-file":   PolicyFile,
+		"audit-log-path":      LogFile,
+		"audit-log-maxage":    fmt.Sprint(r.MaxAge),
+		"audit-log-maxbackup": fmt.Sprint(r.MaxBackup),
+		"audit-log-maxsize":   fmt.Sprint(r.MaxSize),
+	}
+}
+
+// ConfigureManifest returns the static pod manifest of the API server with
+// audit logging enabled: the audit arguments replace any the API server has,
+// and the policy and log directories are mounted from the host. It returns
+// false if the manifest already has the configuration.
+func ConfigureManifest(manifest []byte, r LogRotation) ([]byte, bool, error) {
+	return staticpod.Configure(manifest, "kube-apiserver", []string{flagPrefix}, r.Args(), []staticpod.Mount{
+		{Name: policyVolume, Path: PolicyDir, ReadOnly: true},
+		{Name: logVolume, Path: LogDir},
+	})
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const apiServerManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - command:
+    - kube-apiserver
+    - --authorization-mode=Node,RBAC
+    - --audit-log-maxage=7
+    image: k8s.gcr.io/kube-apiserver:v1.11.3
+    name: kube-apiserver
+    volumeMounts:
+    - mountPath: /etc/kubernetes/pki
+      name: k8s-certs
+      readOnly: true
+  hostNetwork: true
+  volumes:
+  - hostPath:
+      path: /etc/kubernetes/pki
+      type: DirectoryOrCreate
+    name: k8s-certs
+`
+
+func TestValidatePolicy(t *testing.T) {
+	valid := `
+apiVersion: audit.k8s.io/v1beta1
+kind: Policy
+rules:
+- level: Metadata
+`
+	if err := ValidatePolicy([]byte(valid)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, invalid := range []string{
+		"apiVersion: audit.k8s.io/v1beta1\nkind: Policy\nrules: []\n",
+		"apiVersion: audit.k8s.io/v1beta1\nkind: Pod\nrules:\n- level: None\n",
+		"apiVersion: v1\nkind: Policy\nrules:\n- level: None\n",
+		"- not a policy\n",
+	} {
+		if err := ValidatePolicy([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestConfigureManifest(t *testing.T) {
+	r := LogRotation{MaxAge: 30, MaxBackup: 10, MaxSize: 100}
+	configured, changed, err := ConfigureManifest([]byte(apiServerManifest), r)
+	if err != nil {
+		t.Fatalf("unable to configure manifest: %v", err)
+	}
+	if !changed {
+		t.Fatalf("expected manifest to change")
+	}
+	pod := corev1.Pod{}
+	if err := yaml.Unmarshal(configured, &pod); err != nil {
+		t.Fatalf("unable to decode configured manifest: %v", err)
+	}
+	c := pod.Spec.Containers[0]
+	expected := []string{
+		"kube-apiserver",
+		"--authorization-mode=Node,RBAC",
+		"--audit-log-maxage=30",
+		"--audit-log-maxbackup=10",
+		"--audit-log-maxsize=100",
+		"--audit-log-path=/var/log/kubernetes/audit/audit.log",
+		"--audit-policy-file=/etc/kubernetes/audit/policy.yaml",
+	}
+	if diff := cmp.Diff(expected, c.Command); diff != "" {
+		t.Errorf("unexpected command (-expected +found):\n%s", diff)
+	}
+	if len(pod.Spec.Volumes) != 3 || len(c.VolumeMounts) != 3 {
+		t.Errorf("expected the policy and log volumes to be added, found %v and %v", pod.Spec.Volumes, c.VolumeMounts)
+	}
+	if !c.VolumeMounts[1].ReadOnly || c.VolumeMounts[2].ReadOnly {
+		t.Errorf("expected only the policy to be mounted read-only, found %v", c.VolumeMounts)
+	}
+
+	if _, changed, err := ConfigureManifest(configured, r); err != nil || changed {
+		t.Errorf("expected configured manifest not to change (%v)", err)
+	}
+	r.MaxSize = 200
+	if _, changed, err := ConfigureManifest(configured, r); err != nil || !changed {
+		t.Errorf("expected manifest to change with new rotation settings (%v)", err)
+	}
+	if _, _, err := ConfigureManifest([]byte("apiVersion: v1\nkind: Pod\n"), r); err == nil {
+		t.Errorf("expected an error for a manifest without a kube-apiserver container")
+	}
+}
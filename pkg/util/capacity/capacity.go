@@ -0,0 +1,125 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package capacity checks that the pod network of a cluster has room for more
+// nodes. The controller manager gives every node a range of the pod CIDR, of
+// the node CIDR mask size; once the ranges run out, new nodes get none, and
+// pods on them fail to get an address from the CNI plugin.
+package capacity
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+)
+
+const (
+	// NodeCIDRMaskSizeArg is the controller manager argument that sets the
+	// size of the range of every node.
+	NodeCIDRMaskSizeArg = "node-cidr-mask-size"
+	// DefaultNodeCIDRMaskSizeIPv4 and DefaultNodeCIDRMaskSizeIPv6 are the
+	// controller manager defaults.
+	DefaultNodeCIDRMaskSizeIPv4 = 24
+	DefaultNodeCIDRMaskSizeIPv6 = 64
+
+	// lowFraction is the fraction of node ranges left below which a warning
+	// is given.
+	lowFraction = 0.1
+)
+
+// Network is the pod network of the cluster.
+type Network struct {
+	PodCIDR string
+	// NodeCIDRMaskSize is the size of the range of every node. If zero, the
+	// controller manager default is used.
+	NodeCIDRMaskSize int
+	// MaxPods is the most pods the kubelet runs. If zero, it is not checked.
+	MaxPods int
+}
+
+// Report is the capacity of the pod network after nodes are added.
+type Report struct {
+	// NodeRanges is the number of node ranges in the pod CIDR.
+	NodeRanges int
+	// Nodes is the number of nodes after the new nodes are added.
+	Nodes int
+	// PodAddresses is the number of pod addresses in a node range.
+	PodAddresses int
+	// Exhausted is true if some of the new nodes get no range.
+	Exhausted bool
+	Warnings  []string
+}
+
+// Check returns the capacity of the network if nodes are added to the
+// existing ones.
+func Check(n Network, existing, adding int) (Report, error) {
+	_, podNet, err := net.ParseCIDR(n.PodCIDR)
+	if err != nil {
+		return Report{}, fmt.Errorf("unable to parse pod CIDR %q: %v", n.PodCIDR, err)
+	}
+	prefix, bits := podNet.Mask.Size()
+	maskSize := n.NodeCIDRMaskSize
+	if maskSize == 0 {
+		maskSize = DefaultNodeCIDRMaskSizeIPv4
+		if bits == 128 {
+			maskSize = DefaultNodeCIDRMaskSizeIPv6
+		}
+	}
+	if maskSize < prefix || maskSize > bits {
+		return Report{}, fmt.Errorf("node CIDR mask size %d must be between the pod CIDR prefix length %d and %d", maskSize, prefix, bits)
+	}
+	r := Report{
+		NodeRanges: pow2(maskSize - prefix),
+		Nodes:      existing + adding,
+		// The network and broadcast addresses of a range are not given to
+		// pods.
+		PodAddresses: pow2(bits-maskSize) - 2,
+	}
+	left := r.NodeRanges - r.Nodes
+	switch {
+	case left < 0:
+		r.Exhausted = true
+		r.Warnings = append(r.Warnings, fmt.Sprintf("pod CIDR %s has room for %d nodes, with a /%d range each, but the cluster would have %d; nodes beyond %d get no pod range, and their pods fail to get an address", n.PodCIDR, r.NodeRanges, maskSize, r.Nodes, r.NodeRanges))
+	case float64(left) < lowFraction*float64(r.NodeRanges):
+		r.Warnings = append(r.Warnings, fmt.Sprintf("pod CIDR %s has room for %d more nodes, with a /%d range each", n.PodCIDR, left, maskSize))
+	}
+	if n.MaxPods > r.PodAddresses {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("kubelet maxPods %d is more than the %d pod addresses of a /%d node range; pods beyond them fail to get an address", n.MaxPods, r.PodAddresses, maskSize))
+	}
+	return r, nil
+}
+
+// ParseNodeCIDRMaskSize parses the value of the controller manager argument.
+// An empty value is zero, the default.
+func ParseNodeCIDRMaskSize(value string) (int, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", NodeCIDRMaskSizeArg, value)
+	}
+	return size, nil
+}
+
+// pow2 returns 2 to the power of n, or the largest int if it is larger.
+func pow2(n int) int {
+	if n >= 31 {
+		return math.MaxInt32
+	}
+	return 1 << uint(n)
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacity
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		network       Network
+		existing      int
+		adding        int
+		wantRanges    int
+		wantAddresses int
+		wantExhausted bool
+		wantWarnings  int
+		wantErr       bool
+	}{
+		{name: "room", network: Network{PodCIDR: "10.20.0.0/16"}, existing: 3, adding: 1, wantRanges: 256, wantAddresses: 254},
+		{name: "low", network: Network{PodCIDR: "10.20.0.0/20"}, existing: 14, adding: 1, wantRanges: 16, wantAddresses: 254, wantWarnings: 1},
+		{name: "last range", network: Network{PodCIDR: "10.20.0.0/20"}, existing: 15, adding: 1, wantRanges: 16, wantAddresses: 254, wantWarnings: 1},
+		{name: "exhausted", network: Network{PodCIDR: "10.20.0.0/20"}, existing: 16, adding: 1, wantRanges: 16, wantAddresses: 254, wantExhausted: true, wantWarnings: 1},
+		{name: "mask size", network: Network{PodCIDR: "10.20.0.0/16", NodeCIDRMaskSize: 26}, existing: 3, adding: 1, wantRanges: 1024, wantAddresses: 62},
+		{name: "max pods", network: Network{PodCIDR: "10.20.0.0/16", MaxPods: 500}, existing: 3, adding: 1, wantRanges: 256, wantAddresses: 254, wantWarnings: 1},
+		{name: "ipv6", network: Network{PodCIDR: "fd00::/48"}, existing: 3, adding: 1, wantRanges: 65536, wantAddresses: 1<<31 - 1 - 2},
+		{name: "mask size too small", network: Network{PodCIDR: "10.20.0.0/16", NodeCIDRMaskSize: 8}, wantErr: true},
+		{name: "invalid CIDR", network: Network{PodCIDR: "10.20.0.0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		r, err := Check(tt.network, tt.existing, tt.adding)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if r.NodeRanges != tt.wantRanges || r.PodAddresses != tt.wantAddresses || r.Exhausted != tt.wantExhausted || len(r.Warnings) != tt.wantWarnings {
+			t.Errorf("%s: got %+v", tt.name, r)
+		}
+	}
+}
+
+func TestParseNodeCIDRMaskSize(t *testing.T) {
+	for value, want := range map[string]int{"": 0, "24": 24} {
+		got, err := ParseNodeCIDRMaskSize(value)
+		if err != nil || got != want {
+			t.Errorf("ParseNodeCIDRMaskSize(%q) = %d, %v, want %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"x", "-1", "0"} {
+		if _, err := ParseNodeCIDRMaskSize(value); err == nil {
+			t.Errorf("ParseNodeCIDRMaskSize(%q): expected an error", value)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package capiexport converts the objects of the state to manifests of a
+// management cluster running Cluster API v1alpha3, so that a cluster can be
+// moved off the state file.
+package capiexport
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+)
+
+const (
+	// ClusterAPIVersion is the API version of the exported clusters and
+	// machines.
+	ClusterAPIVersion = "cluster.x-k8s.io/v1alpha3"
+	// InfrastructureAPIVersion is the API version of the exported SSH
+	// infrastructure of clusters and machines.
+	InfrastructureAPIVersion = "infrastructure.cluster.x-k8s.io/v1alpha3"
+
+	// ClusterNameLabel associates objects with their cluster.
+	ClusterNameLabel = "cluster.x-k8s.io/cluster-name"
+	// ControlPlaneLabel marks the machines of the control plane.
+	ControlPlaneLabel = "cluster.x-k8s.io/control-plane"
+	// PausedAnnotation stops the controllers from reconciling the cluster
+	// until it is removed.
+	PausedAnnotation = "cluster.x-k8s.io/paused"
+	// SecretType is the type of the secrets of clusters.
+	SecretType corev1.SecretType = "cluster.x-k8s.io/secret"
+
+	// ProviderIDPrefix prefixes the provider IDs of the exported machines.
+	ProviderIDPrefix = "ssh://"
+)
+
+// Machine is a machine of the state, with its decoded provider spec, and its
+// provisioned machine.
+type Machine struct {
+	Machine            clusterv1.Machine
+	Spec               spv1.MachineSpec
+	ProvisionedMachine spv1.ProvisionedMachine
+}
+
+// Objects are the objects of a cluster in the state.
+type Objects struct {
+	Cluster     clusterv1.Cluster
+	ClusterSpec spv1.ClusterSpec
+	Machines    []Machine
+	Secrets     []corev1.Secret
+}
+
+// objectReference refers to an object in the same namespace.
+type objectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+}
+
+type apiEndpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+type networkRanges struct {
+	CIDRBlocks []string `json:"cidrBlocks"`
+}
+
+type clusterNetwork struct {
+	Pods          *networkRanges `json:"pods,omitempty"`
+	Services      *networkRanges `json:"services,omitempty"`
+	ServiceDomain string         `json:"serviceDomain,omitempty"`
+}
+
+type cluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ClusterNetwork       *clusterNetwork  `json:"clusterNetwork,omitempty"`
+		ControlPlaneEndpoint *apiEndpoint     `json:"controlPlaneEndpoint,omitempty"`
+		InfrastructureRef    *objectReference `json:"infrastructureRef"`
+	} `json:"spec"`
+}
+
+type sshCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ControlPlaneEndpoint *apiEndpoint           `json:"controlPlaneEndpoint,omitempty"`
+		VIP                  *spv1.VIPConfiguration `json:"vip,omitempty"`
+		Bastion              string                 `json:"bastion,omitempty"`
+	} `json:"spec"`
+}
+
+type machine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ClusterName string `json:"clusterName"`
+		Bootstrap   struct {
+			DataSecretName string `json:"dataSecretName"`
+		} `json:"bootstrap"`
+		InfrastructureRef objectReference `json:"infrastructureRef"`
+		Version           string          `json:"version,omitempty"`
+		ProviderID        string          `json:"providerID"`
+	} `json:"spec"`
+}
+
+type sshMachine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              struct {
+		ProviderID          string                      `json:"providerID"`
+		Host                string                      `json:"host"`
+		Port                int                         `json:"port"`
+		PublicKeys          []string                    `json:"publicKeys,omitempty"`
+		CredentialSecret    corev1.LocalObjectReference `json:"credentialSecret"`
+		VIPNetworkInterface string                      `json:"vipNetworkInterface,omitempty"`
+		Roles               []string                    `json:"roles"`
+	} `json:"spec"`
+}
+
+// secretRenames maps the secrets of the state to the names and keys Cluster
+// API expects, as suffixes of the cluster name, and the keys of their data.
+var secretRenames = map[string]struct {
+	suffix string
+	keys   map[string]string
+}{
+	common.DefaultAPIServerCASecretName:       {"-ca", map[string]string{"tls.crt": "tls.crt", "tls.key": "tls.key"}},
+	common.DefaultEtcdCASecretName:            {"-etcd", map[string]string{"tls.crt": "tls.crt", "tls.key": "tls.key"}},
+	common.DefaultFrontProxyCASecretName:      {"-proxy", map[string]string{"tls.crt": "tls.crt", "tls.key": "tls.key"}},
+	common.DefaultServiceAccountKeySecretName: {"-sa", map[string]string{"publickey": "tls.crt", "privatekey": "tls.key"}},
+	common.DefaultAdminConfigSecretName:       {"-kubeconfig", map[string]string{common.DefaultAdminConfigSecretKey: "value"}},
+}
+
+// skippedSecrets are not exported, because Cluster API creates them in the
+// workload cluster.
+var skippedSecrets = map[string]bool{
+	common.DefaultBootstrapTokenSecretName: true,
+}
+
+// Export returns the manifests of the cluster, its machines, and its secrets,
+// in the namespace. The cluster is paused, so that the controllers adopt the
+// machines only when the operator removes the paused annotation. The machines
+// are already provisioned, so their bootstrap data is empty.
+func Export(o Objects, namespace string) ([]interface{}, error) {
+	name := o.Cluster.Name
+	var objects []interface{}
+
+	var endpoint *apiEndpoint
+	if len(o.Cluster.Status.APIEndpoints) != 0 {
+		e := o.Cluster.Status.APIEndpoints[0]
+		endpoint = &apiEndpoint{Host: e.Host, Port: e.Port}
+	}
+
+	c := cluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: ClusterAPIVersion, Kind: "Cluster"},
+		ObjectMeta: objectMeta(name, namespace, name),
+	}
+	c.Annotations = map[string]string{PausedAnnotation: "true"}
+	network := o.Cluster.Spec.ClusterNetwork
+	c.Spec.ClusterNetwork = &clusterNetwork{ServiceDomain: network.ServiceDomain}
+	if len(network.Pods.CIDRBlocks) != 0 {
+		c.Spec.ClusterNetwork.Pods = &networkRanges{CIDRBlocks: network.Pods.CIDRBlocks}
+	}
+	if len(network.Services.CIDRBlocks) != 0 {
+		c.Spec.ClusterNetwork.Services = &networkRanges{CIDRBlocks: network.Services.CIDRBlocks}
+	}
+	c.Spec.ControlPlaneEndpoint = endpoint
+	c.Spec.InfrastructureRef = &objectReference{APIVersion: InfrastructureAPIVersion, Kind: "SSHCluster", Name: name, Namespace: namespace}
+	objects = append(objects, c)
+
+	sc := sshCluster{
+		TypeMeta:   metav1.TypeMeta{APIVersion: InfrastructureAPIVersion, Kind: "SSHCluster"},
+		ObjectMeta: objectMeta(name, namespace, name),
+	}
+	sc.Spec.ControlPlaneEndpoint = endpoint
+	sc.Spec.VIP = o.ClusterSpec.VIPConfiguration
+	sc.Spec.Bastion = o.Cluster.Annotations[common.BastionAnnotationKey]
+	objects = append(objects, sc)
+
+	for _, m := range o.Machines {
+		ms, sm, bootstrap, err := exportMachine(m, name, namespace)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, ms, sm, bootstrap)
+	}
+
+	secrets := append([]corev1.Secret(nil), o.Secrets...)
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	for _, s := range secrets {
+		if skippedSecrets[s.Name] {
+			continue
+		}
+		secret, err := exportSecret(s, name, namespace)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, secret)
+	}
+	return objects, nil
+}
+
+func exportMachine(m Machine, clusterName, namespace string) (machine, sshMachine, corev1.Secret, error) {
+	sshConfig := m.ProvisionedMachine.Spec.SSHConfig
+	if sshConfig == nil {
+		return machine{}, sshMachine{}, corev1.Secret{}, fmt.Errorf("provisioned machine %q of machine %q has no SSH configuration", m.ProvisionedMachine.Name, m.Machine.Name)
+	}
+	providerID := ProviderIDPrefix + sshConfig.Host
+	bootstrapName := m.Machine.Name + "-bootstrap"
+
+	ms := machine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: ClusterAPIVersion, Kind: "Machine"},
+		ObjectMeta: objectMeta(m.Machine.Name, namespace, clusterName),
+	}
+	roles := make([]string, len(m.Spec.Roles))
+	for i, r := range m.Spec.Roles {
+		roles[i] = string(r)
+		if r == spv1.MasterRole {
+			ms.Labels[ControlPlaneLabel] = ""
+		}
+	}
+	ms.Spec.ClusterName = clusterName
+	ms.Spec.Bootstrap.DataSecretName = bootstrapName
+	ms.Spec.InfrastructureRef = objectReference{APIVersion: InfrastructureAPIVersion, Kind: "SSHMachine", Name: m.Machine.Name, Namespace: namespace}
+	if m.Spec.ComponentVersions != nil && len(m.Spec.ComponentVersions.KubernetesVersion) != 0 {
+		ms.Spec.Version = "v" + m.Spec.ComponentVersions.KubernetesVersion
+	}
+	ms.Spec.ProviderID = providerID
+
+	sm := sshMachine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: InfrastructureAPIVersion, Kind: "SSHMachine"},
+		ObjectMeta: objectMeta(m.Machine.Name, namespace, clusterName),
+	}
+	sm.Spec.ProviderID = providerID
+	sm.Spec.Host = sshConfig.Host
+	sm.Spec.Port = sshConfig.Port
+	sm.Spec.PublicKeys = sshConfig.PublicKeys
+	sm.Spec.CredentialSecret = sshConfig.CredentialSecret
+	sm.Spec.VIPNetworkInterface = m.ProvisionedMachine.Spec.VIPNetworkInterface
+	sm.Spec.Roles = roles
+
+	bootstrap := corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: objectMeta(bootstrapName, namespace, clusterName),
+		Type:       SecretType,
+		Data:       map[string][]byte{"value": {}},
+	}
+	return ms, sm, bootstrap, nil
+}
+
+// exportSecret returns the secret with the name and keys Cluster API expects,
+// if it has one, or else with its own name and keys.
+func exportSecret(s corev1.Secret, clusterName, namespace string) (corev1.Secret, error) {
+	exported := corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: objectMeta(s.Name, namespace, clusterName),
+		Type:       SecretType,
+		Data:       s.Data,
+	}
+	rename, ok := secretRenames[s.Name]
+	if !ok {
+		return exported, nil
+	}
+	exported.Name = clusterName + rename.suffix
+	exported.Data = map[string][]byte{}
+	for from, to := range rename.keys {
+		v, ok := s.Data[from]
+		if !ok {
+			return corev1.Secret{}, fmt.Errorf("secret %q has no key %q", s.Name, from)
+		}
+		exported.Data[to] = v
+	}
+	return exported, nil
+}
+
+func objectMeta(name, namespace, clusterName string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		Labels:    map[string]string{ClusterNameLabel: clusterName},
+	}
+}
+
+// Marshal returns the objects as a multi-document YAML stream.
+func Marshal(objects []interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	for _, o := range objects {
+		y, err := yaml.Marshal(o)
+		if err != nil {
+			return nil, fmt.Errorf("unable to marshal object to yaml: %v", err)
+		}
+		b.WriteString("---\n")
+		b.Write(y)
+	}
+	return b.Bytes(), nil
+}
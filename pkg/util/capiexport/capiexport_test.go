@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capiexport
+
+import (
+	"strings"
+	"testing"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+)
+
+func testObjects() Objects {
+	c := clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+	c.Spec.ClusterNetwork.Pods.CIDRBlocks = []string{"10.0.0.0/16"}
+	c.Spec.ClusterNetwork.Services.CIDRBlocks = []string{"10.1.0.0/16"}
+	c.Spec.ClusterNetwork.ServiceDomain = "cluster.local"
+	c.Status.APIEndpoints = []clusterv1.APIEndpoint{{Host: "192.168.0.10", Port: 6443}}
+	return Objects{
+		Cluster:     c,
+		ClusterSpec: spv1.ClusterSpec{VIPConfiguration: &spv1.VIPConfiguration{IP: "192.168.0.10", RouterID: 42}},
+		Machines: []Machine{
+			{
+				Machine: clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: "192.168.0.1"}},
+				Spec: spv1.MachineSpec{
+					Roles:             []spv1.MachineRole{spv1.MasterRole},
+					ComponentVersions: &spv1.MachineComponentVersions{KubernetesVersion: "1.12.8"},
+				},
+				ProvisionedMachine: spv1.ProvisionedMachine{
+					ObjectMeta: metav1.ObjectMeta{Name: "192.168.0.1"},
+					Spec: spv1.ProvisionedMachineSpec{SSHConfig: &spv1.SSHConfig{
+						Host:             "192.168.0.1",
+						Port:             22,
+						CredentialSecret: corev1.LocalObjectReference{Name: common.DefaultSSHCredentialSecretName},
+					}},
+				},
+			},
+		},
+		Secrets: []corev1.Secret{
+			{ObjectMeta: metav1.ObjectMeta{Name: common.DefaultServiceAccountKeySecretName}, Data: map[string][]byte{"publickey": []byte("pub"), "privatekey": []byte("priv")}},
+			{ObjectMeta: metav1.ObjectMeta{Name: common.DefaultAPIServerCASecretName}, Data: map[string][]byte{"tls.crt": []byte("crt"), "tls.key": []byte("key")}},
+			{ObjectMeta: metav1.ObjectMeta{Name: common.DefaultBootstrapTokenSecretName}, Data: map[string][]byte{"token": []byte("abc")}},
+			{ObjectMeta: metav1.ObjectMeta{Name: common.DefaultSSHCredentialSecretName}, Data: map[string][]byte{"username": []byte("root")}},
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	objects, err := Export(testObjects(), "capi")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Cluster, SSHCluster, Machine, SSHMachine, bootstrap data, and three
+	// secrets; the bootstrap token is not exported.
+	if len(objects) != 8 {
+		t.Fatalf("expected 8 objects, found %d", len(objects))
+	}
+	c := objects[0].(cluster)
+	if c.Annotations[PausedAnnotation] != "true" {
+		t.Errorf("expected cluster to be paused")
+	}
+	if c.Namespace != "capi" || c.Spec.ControlPlaneEndpoint.Host != "192.168.0.10" || c.Spec.InfrastructureRef.Kind != "SSHCluster" {
+		t.Errorf("unexpected cluster: %+v", c)
+	}
+	m := objects[2].(machine)
+	if _, ok := m.Labels[ControlPlaneLabel]; !ok {
+		t.Errorf("expected master to be labeled as control plane")
+	}
+	if m.Spec.Version != "v1.12.8" || m.Spec.ProviderID != "ssh://192.168.0.1" || m.Spec.Bootstrap.DataSecretName != "192.168.0.1-bootstrap" {
+		t.Errorf("unexpected machine: %+v", m.Spec)
+	}
+	sm := objects[3].(sshMachine)
+	if sm.Spec.Host != "192.168.0.1" || sm.Spec.CredentialSecret.Name != common.DefaultSSHCredentialSecretName {
+		t.Errorf("unexpected SSH machine: %+v", sm.Spec)
+	}
+	ca := objects[5].(corev1.Secret)
+	if ca.Name != "test-ca" || string(ca.Data["tls.key"]) != "key" || ca.Labels[ClusterNameLabel] != "test" {
+		t.Errorf("unexpected CA secret: %+v", ca)
+	}
+	sa := objects[6].(corev1.Secret)
+	if sa.Name != "test-sa" || string(sa.Data["tls.crt"]) != "pub" || string(sa.Data["tls.key"]) != "priv" {
+		t.Errorf("unexpected service account key secret: %+v", sa)
+	}
+	credential := objects[7].(corev1.Secret)
+	if credential.Name != common.DefaultSSHCredentialSecretName {
+		t.Errorf("expected SSH credential to keep its name, found %q", credential.Name)
+	}
+
+	b, err := Marshal(objects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := strings.Count(string(b), "---\n"); n != 8 {
+		t.Errorf("expected 8 documents, found %d", n)
+	}
+}
+
+func TestExportMissingKey(t *testing.T) {
+	o := testObjects()
+	o.Secrets[1].Data = map[string][]byte{"tls.crt": []byte("crt")}
+	if _, err := Export(o, "capi"); err == nil {
+		t.Errorf("expected error exporting CA without a private key")
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cliparse parses the output of the programs that cctl runs on
+// machines. The output of each program is parsed by the parser of the version
+// of the program that printed it, so that a change to the output of a newer
+// version is handled by adding a parser, not by changing the parsers of the
+// versions already in use.
+package cliparse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+)
+
+// versionPattern matches the first version in the output of a version
+// command, e.g. "v1.12.8", "Client Version: v1.12.8", or
+// `kubeadm version: &version.Info{Major:"1", ..., GitVersion:"v1.12.8", ...}`.
+var versionPattern = regexp.MustCompile(`v?(\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?)`)
+
+// ParseVersion returns the version printed by a version command.
+func ParseVersion(out []byte) (*semver.Version, error) {
+	m := versionPattern.FindSubmatch(out)
+	if m == nil {
+		return nil, fmt.Errorf("no version found in %q", strings.TrimSpace(string(out)))
+	}
+	return semver.NewVersion(string(m[1]))
+}
+
+// selectParser returns the index of the parser of the version. Parsers are
+// ordered by their minimum version. If the version is unknown, the parser of
+// the newest version is used, since it is the most tolerant.
+func selectParser(mins []*semver.Version, version *semver.Version) int {
+	if version == nil {
+		return len(mins) - 1
+	}
+	// Ignore pre-releases, so that e.g. 1.13.0-beta.1 is parsed as 1.13.0.
+	v := semver.Version{Major: version.Major, Minor: version.Minor, Patch: version.Patch}
+	i := 0
+	for j, min := range mins {
+		if !v.LessThan(*min) {
+			i = j
+		}
+	}
+	return i
+}
+
+// JoinCommand is the kubeadm join command printed by kubeadm token create
+// --print-join-command.
+type JoinCommand struct {
+	// APIServerEndpoint is the host:port of the API server.
+	APIServerEndpoint string
+	Token             string
+	// CACertHashes are the hashes of the cluster CA public key.
+	CACertHashes []string
+}
+
+type joinParser struct {
+	min   *semver.Version
+	parse func(fields []string) (JoinCommand, error)
+}
+
+var joinParsers = []joinParser{
+	// Before 1.13, the command is
+	//   kubeadm join <endpoint> --token <token> --discovery-token-ca-cert-hash <hash>
+	{min: semver.New("0.0.0"), parse: parseJoinFieldsByPosition},
+	// Since 1.13, the flags may be given in any order, may be split by line
+	// continuations, and may be followed by others, e.g. --control-plane.
+	{min: semver.New("1.13.0"), parse: parseJoinFieldsByFlag},
+}
+
+// ParseJoinCommand parses the join command printed by the kubeadm version.
+func ParseJoinCommand(out string, kubeadmVersion *semver.Version) (JoinCommand, error) {
+	var mins []*semver.Version
+	for _, p := range joinParsers {
+		mins = append(mins, p.min)
+	}
+	var fields []string
+	for _, f := range strings.Fields(out) {
+		if f != `\` {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) < 3 || fields[0] != "kubeadm" || fields[1] != "join" {
+		return JoinCommand{}, fmt.Errorf("not a kubeadm join command")
+	}
+	jc, err := joinParsers[selectParser(mins, kubeadmVersion)].parse(fields)
+	if err != nil {
+		return JoinCommand{}, err
+	}
+	if len(jc.Token) == 0 {
+		return JoinCommand{}, fmt.Errorf("no token found")
+	}
+	if len(jc.CACertHashes) == 0 {
+		return JoinCommand{}, fmt.Errorf("no CA cert hash found")
+	}
+	return jc, nil
+}
+
+func parseJoinFieldsByPosition(fields []string) (JoinCommand, error) {
+	if len(fields) != 7 {
+		return JoinCommand{}, fmt.Errorf("expected 7 fields, found %d", len(fields))
+	}
+	if fields[3] != "--token" || fields[5] != "--discovery-token-ca-cert-hash" {
+		return JoinCommand{}, fmt.Errorf("unexpected flags %q and %q", fields[3], fields[5])
+	}
+	return JoinCommand{
+		APIServerEndpoint: fields[2],
+		Token:             fields[4],
+		CACertHashes:      []string{fields[6]},
+	}, nil
+}
+
+func parseJoinFieldsByFlag(fields []string) (JoinCommand, error) {
+	var jc JoinCommand
+	for i := 2; i < len(fields); i++ {
+		f := fields[i]
+		if !strings.HasPrefix(f, "-") {
+			if len(jc.APIServerEndpoint) != 0 {
+				return JoinCommand{}, fmt.Errorf("unexpected argument %q", f)
+			}
+			jc.APIServerEndpoint = f
+			continue
+		}
+		name, value := f, ""
+		hasValue := false
+		if eq := strings.Index(f, "="); eq != -1 {
+			name, value, hasValue = f[:eq], f[eq+1:], true
+		}
+		switch name {
+		case "--token", "--discovery-token-ca-cert-hash":
+			if !hasValue {
+				if i+1 == len(fields) {
+					return JoinCommand{}, fmt.Errorf("flag %q has no value", name)
+				}
+				i++
+				value = fields[i]
+			}
+			if name == "--token" {
+				jc.Token = value
+			} else {
+				jc.CACertHashes = append(jc.CACertHashes, value)
+			}
+		case "--certificate-key":
+			if !hasValue {
+				i++
+			}
+		}
+		// Other flags, e.g. --control-plane, are not needed by cctl. The
+		// value of an unknown flag, given separately, is taken for a second
+		// endpoint, and so is reported.
+	}
+	if len(jc.APIServerEndpoint) == 0 {
+		return JoinCommand{}, fmt.Errorf("no API server endpoint found")
+	}
+	return jc, nil
+}
+
+type etcdadmInfoParser struct {
+	min   *semver.Version
+	parse func(out []byte) (spv1.EtcdMember, error)
+}
+
+var etcdadmInfoParsers = []etcdadmInfoParser{
+	// Up to 0.1.x, the output is the member as JSON.
+	{min: semver.New("0.0.0"), parse: parseEtcdadmInfoJSON},
+	// Later versions may log before and after the member.
+	{min: semver.New("0.2.0"), parse: parseEtcdadmInfoEmbeddedJSON},
+}
+
+// ParseEtcdadmInfo parses the etcd member printed by etcdadm info of the
+// etcdadm version.
+func ParseEtcdadmInfo(out []byte, etcdadmVersion *semver.Version) (spv1.EtcdMember, error) {
+	var mins []*semver.Version
+	for _, p := range etcdadmInfoParsers {
+		mins = append(mins, p.min)
+	}
+	return etcdadmInfoParsers[selectParser(mins, etcdadmVersion)].parse(out)
+}
+
+func parseEtcdadmInfoJSON(out []byte) (spv1.EtcdMember, error) {
+	var member spv1.EtcdMember
+	if err := json.Unmarshal(out, &member); err != nil {
+		return member, fmt.Errorf("unable to unmarshal etcd member: %v", err)
+	}
+	return member, nil
+}
+
+func parseEtcdadmInfoEmbeddedJSON(out []byte) (spv1.EtcdMember, error) {
+	start := bytes.IndexByte(out, '{')
+	end := bytes.LastIndexByte(out, '}')
+	if start == -1 || end < start {
+		return spv1.EtcdMember{}, fmt.Errorf("no etcd member found")
+	}
+	return parseEtcdadmInfoJSON(out[start : end+1])
+}
+
+type namesParser struct {
+	min    *semver.Version
+	plural bool
+}
+
+var namesParsers = []namesParser{
+	// Before 1.11, -oname prefixes names with the plural resource, e.g.
+	// nodes/a.
+	{min: semver.New("0.0.0"), plural: true},
+	// Since 1.11, it prefixes them with the kind, e.g. node/a.
+	{min: semver.New("1.11.0")},
+}
+
+// ParseNames returns the names of the objects of the resource printed by
+// kubectl get, of the kubectl version, either with -oname, or separated by
+// whitespace with a jsonpath template. The resource is the singular, lower
+// case kind, e.g. node.
+func ParseNames(out []byte, resource string, kubectlVersion *semver.Version) ([]string, error) {
+	var mins []*semver.Version
+	for _, p := range namesParsers {
+		mins = append(mins, p.min)
+	}
+	prefix := resource + "/"
+	if namesParsers[selectParser(mins, kubectlVersion)].plural {
+		prefix = resource + "s/"
+	}
+	var names []string
+	for _, f := range strings.Fields(string(out)) {
+		f = strings.TrimPrefix(f, prefix)
+		if strings.Contains(f, "/") {
+			return nil, fmt.Errorf("unexpected name %q", f)
+		}
+		names = append(names, f)
+	}
+	return names, nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cliparse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{out: "v1.12.8\n", want: "1.12.8"},
+		{out: "Client Version: v1.14.1\n", want: "1.14.1"},
+		{out: `kubeadm version: &version.Info{Major:"1", Minor:"13", GitVersion:"v1.13.5", GoVersion:"go1.11.5"}`, want: "1.13.5"},
+		{out: "0.1.1", want: "0.1.1"},
+		{out: "v1.15.0-beta.2", want: "1.15.0-beta.2"},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion([]byte(tt.out))
+		if err != nil {
+			t.Errorf("ParseVersion(%q): %v", tt.out, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseVersion(%q) = %s, want %s", tt.out, got, tt.want)
+		}
+	}
+	if _, err := ParseVersion([]byte("command not found")); err == nil {
+		t.Errorf("expected an error for output without a version")
+	}
+}
+
+func TestParseJoinCommand(t *testing.T) {
+	want := JoinCommand{
+		APIServerEndpoint: "10.0.0.1:6443",
+		Token:             "abcdef.0123456789abcdef",
+		CACertHashes:      []string{"sha256:1234"},
+	}
+	tests := []struct {
+		name    string
+		version *semver.Version
+		out     string
+		want    JoinCommand
+		wantErr bool
+	}{
+		{
+			name:    "1.11",
+			version: semver.New("1.11.10"),
+			out:     "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234\n",
+			want:    want,
+		},
+		{
+			name:    "1.12, flags out of order",
+			version: semver.New("1.12.8"),
+			out:     "kubeadm join 10.0.0.1:6443 --discovery-token-ca-cert-hash sha256:1234 --token abcdef.0123456789abcdef",
+			wantErr: true,
+		},
+		{
+			name:    "1.13",
+			version: semver.New("1.13.5"),
+			out:     "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234",
+			want:    want,
+		},
+		{
+			name:    "1.14, with extra spaces and a pre-release",
+			version: semver.New("1.14.0-rc.1"),
+			out:     "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef     --discovery-token-ca-cert-hash sha256:1234 \n",
+			want:    want,
+		},
+		{
+			name:    "1.15, with line continuations and control plane flags",
+			version: semver.New("1.15.0"),
+			out: `kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef \
+    --discovery-token-ca-cert-hash sha256:1234 \
+    --control-plane --certificate-key 5678`,
+			want: want,
+		},
+		{
+			name:    "1.15, with flag values after =",
+			version: semver.New("1.15.0"),
+			out:     "kubeadm join 10.0.0.1:6443 --token=abcdef.0123456789abcdef --discovery-token-ca-cert-hash=sha256:1234 --discovery-token-ca-cert-hash=sha256:9999",
+			want: JoinCommand{
+				APIServerEndpoint: "10.0.0.1:6443",
+				Token:             "abcdef.0123456789abcdef",
+				CACertHashes:      []string{"sha256:1234", "sha256:9999"},
+			},
+		},
+		{
+			name: "unknown version",
+			out:  "kubeadm join 10.0.0.1:6443 --discovery-token-ca-cert-hash sha256:1234 --token abcdef.0123456789abcdef",
+			want: want,
+		},
+		{
+			name:    "no token",
+			version: semver.New("1.15.0"),
+			out:     "kubeadm join 10.0.0.1:6443 --discovery-token-ca-cert-hash sha256:1234",
+			wantErr: true,
+		},
+		{
+			name:    "unknown flag with a value",
+			version: semver.New("1.15.0"),
+			out:     "kubeadm join 10.0.0.1:6443 --token abcdef.0123456789abcdef --discovery-token-ca-cert-hash sha256:1234 --node-name a",
+			wantErr: true,
+		},
+		{
+			name:    "not a join command",
+			version: semver.New("1.15.0"),
+			out:     "Error: unable to create bootstrap token",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		got, err := ParseJoinCommand(tt.out, tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseEtcdadmInfo(t *testing.T) {
+	member := `{"ID":1234,"name":"m1","peerURLs":["https://10.0.0.1:2380"],"clientURLs":["https://10.0.0.1:2379"]}`
+	tests := []struct {
+		name    string
+		version *semver.Version
+		out     string
+		wantErr bool
+	}{
+		{name: "0.1.1", version: semver.New("0.1.1"), out: member + "\n"},
+		{name: "0.1.1, with logs", version: semver.New("0.1.1"), out: "INFO reading member\n" + member, wantErr: true},
+		{name: "0.2.0, with logs", version: semver.New("0.2.0"), out: "INFO reading member\n" + member + "\nINFO done\n"},
+		{name: "unknown version", out: member},
+		{name: "0.2.0, no member", version: semver.New("0.2.0"), out: "ERROR etcd is not running\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEtcdadmInfo([]byte(tt.out), tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got.ID != 1234 || got.Name != "m1" || !reflect.DeepEqual(got.ClientURLs, []string{"https://10.0.0.1:2379"}) {
+			t.Errorf("%s: got %+v", tt.name, got)
+		}
+	}
+}
+
+func TestParseNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		version *semver.Version
+		out     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "1.10 -oname", version: semver.New("1.10.13"), out: "nodes/a\nnodes/b\n", want: []string{"a", "b"}},
+		{name: "1.12 -oname", version: semver.New("1.12.8"), out: "node/a\nnode/b\n", want: []string{"a", "b"}},
+		{name: "1.10 -oname read as 1.12", version: semver.New("1.12.8"), out: "nodes/a\n", wantErr: true},
+		{name: "jsonpath", version: semver.New("1.12.8"), out: "a b", want: []string{"a", "b"}},
+		{name: "unknown version", out: "node/a", want: []string{"a"}},
+		{name: "empty", version: semver.New("1.12.8"), out: "\n"},
+	}
+	for _, tt := range tests {
+		got, err := ParseNames([]byte(tt.out), "node", tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
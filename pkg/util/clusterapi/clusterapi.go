@@ -19,8 +19,36 @@ package clusterapi
 import (
 	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
 	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
 )
 
+// EtcdRole is the role of a machine that runs only an etcd member, managed by
+// etcdadm, and neither the kubelet nor the control plane.
+const EtcdRole clustercommon.MachineRole = "Etcd"
+
+// RunsEtcd returns true if the machine runs an etcd member, i.e. it is a
+// master or an etcd machine.
+func RunsEtcd(m clusterv1.Machine) bool {
+	return clusterutil.RoleContains(clustercommon.MasterRole, m.Spec.Roles) || clusterutil.RoleContains(EtcdRole, m.Spec.Roles)
+}
+
+// HasNode returns true if the machine runs the kubelet, and so is a cluster
+// node, i.e. it is a master or a node.
+func HasNode(m clusterv1.Machine) bool {
+	return clusterutil.RoleContains(clustercommon.MasterRole, m.Spec.Roles) || clusterutil.RoleContains(clustercommon.NodeRole, m.Spec.Roles)
+}
+
+// EtcdMachines returns every machine in the list that runs an etcd member.
+func EtcdMachines(machines []clusterv1.Machine) []clusterv1.Machine {
+	em := make([]clusterv1.Machine, 0)
+	for _, m := range machines {
+		if RunsEtcd(m) {
+			em = append(em, m)
+		}
+	}
+	return em
+}
+
 // MachinesWithRole returns every machine in the list that has the role.
 func MachinesWithRole(machines []clusterv1.Machine, role clustercommon.MachineRole) []clusterv1.Machine {
 	mwr := make([]clusterv1.Machine, 0)
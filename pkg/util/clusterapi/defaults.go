@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/kubelet"
+	"github.com/platform9/cctl/pkg/util/objectmeta"
+)
+
+// RoleDefaults are the defaults that create machine uses for a machine with
+// some role, unless they are overridden by flags.
+type RoleDefaults struct {
+	Port          int               `json:"port,omitempty"`
+	Iface         string            `json:"iface,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Taints        []corev1.Taint    `json:"taints,omitempty"`
+	KubeletConfig kubelet.Overrides `json:"kubeletConfig,omitempty"`
+}
+
+// MachineDefaults are the defaults of each role, e.g.
+//
+//	master:
+//	  iface: bond0
+//	  kubeletConfig:
+//	    kubeReserved:
+//	      memory: 2Gi
+//	node:
+//	  labels:
+//	    tier: worker
+type MachineDefaults map[clustercommon.MachineRole]RoleDefaults
+
+// ParseMachineDefaults parses YAML or JSON machine defaults. The roles are
+// case-insensitive. Unknown roles and fields, invalid taints, and kubelet
+// configurations that are not valid are rejected.
+func ParseMachineDefaults(data []byte) (MachineDefaults, error) {
+	b, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode machine defaults: %v", err)
+	}
+	var byRole map[string]RoleDefaults
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&byRole); err != nil {
+		return nil, fmt.Errorf("unable to decode machine defaults: %v", err)
+	}
+	defaults := make(MachineDefaults, len(byRole))
+	for r, rd := range byRole {
+		role := clustercommon.MachineRole(strings.Title(strings.ToLower(r)))
+		if role != clustercommon.MasterRole && role != clustercommon.NodeRole && role != EtcdRole {
+			return nil, fmt.Errorf("role %q is not valid; must be master, node, or etcd", r)
+		}
+		if role == EtcdRole && (len(rd.Labels) != 0 || len(rd.Taints) != 0 || rd.KubeletConfig != nil) {
+			return nil, fmt.Errorf("etcd machines have no node; only port and iface can be given")
+		}
+		if _, ok := defaults[role]; ok {
+			return nil, fmt.Errorf("role %q is given more than once", r)
+		}
+		if rd.Port < 0 || rd.Port > 65535 {
+			return nil, fmt.Errorf("%s port %d is not valid", r, rd.Port)
+		}
+		if err := objectmeta.ValidateLabels(rd.Labels); err != nil {
+			return nil, fmt.Errorf("%s %v", r, err)
+		}
+		for _, taint := range rd.Taints {
+			if len(taint.Key) == 0 {
+				return nil, fmt.Errorf("%s taint %+v must have a key", r, taint)
+			}
+			switch taint.Effect {
+			case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			default:
+				return nil, fmt.Errorf("%s taint %q has effect %q; must be one of %s, %s, or %s", r, taint.Key, taint.Effect, corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+			}
+		}
+		if rd.KubeletConfig != nil {
+			b, err := json.Marshal(rd.KubeletConfig)
+			if err != nil {
+				return nil, fmt.Errorf("unable to encode %s kubelet configuration: %v", r, err)
+			}
+			if rd.KubeletConfig, err = kubelet.ParseOverrides(b); err != nil {
+				return nil, fmt.Errorf("%s kubelet configuration: %v", r, err)
+			}
+		}
+		defaults[role] = rd
+	}
+	return defaults, nil
+}
+
+// MachineDefaultsFromCluster returns the machine defaults of the cluster, or
+// nil if it has none.
+func MachineDefaultsFromCluster(cluster *clusterv1.Cluster) (MachineDefaults, error) {
+	value, ok := cluster.Annotations[common.MachineDefaultsAnnotationKey]
+	if !ok {
+		return nil, nil
+	}
+	return ParseMachineDefaults([]byte(value))
+}
+
+// SetMachineDefaults records the machine defaults in the cluster. Empty
+// defaults are removed from the cluster.
+func SetMachineDefaults(cluster *clusterv1.Cluster, defaults MachineDefaults) error {
+	if len(defaults) == 0 {
+		delete(cluster.Annotations, common.MachineDefaultsAnnotationKey)
+		return nil
+	}
+	b, err := json.Marshal(defaults)
+	if err != nil {
+		return fmt.Errorf("unable to encode machine defaults: %v", err)
+	}
+	if cluster.Annotations == nil {
+		cluster.Annotations = make(map[string]string)
+	}
+	cluster.Annotations[common.MachineDefaultsAnnotationKey] = string(b)
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestParseMachineDefaults(t *testing.T) {
+	defaults, err := clusterapi.ParseMachineDefaults([]byte(`
+master:
+  iface: bond0
+  kubeletConfig:
+    kubeReserved:
+      memory: 2Gi
+Node:
+  port: 2222
+  labels:
+    tier: worker
+  taints:
+  - key: dedicated
+    value: batch
+    effect: NoSchedule
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	master := defaults[clustercommon.MasterRole]
+	if master.Iface != "bond0" || master.KubeletConfig == nil {
+		t.Errorf("unexpected master defaults: %+v", master)
+	}
+	node := defaults[clustercommon.NodeRole]
+	if node.Port != 2222 || node.Labels["tier"] != "worker" || len(node.Taints) != 1 || node.Taints[0].Effect != corev1.TaintEffectNoSchedule {
+		t.Errorf("unexpected node defaults: %+v", node)
+	}
+
+	for _, data := range []string{
+		"worker:\n  iface: eth0\n",
+		"master:\n  interface: eth0\n",
+		"master:\n  iface: eth0\nMaster:\n  iface: bond0\n",
+		"node:\n  port: 70000\n",
+		"node:\n  taints:\n  - key: a\n    effect: Never\n",
+		"node:\n  taints:\n  - effect: NoSchedule\n",
+		"node:\n  kubeletConfig:\n    maxPodz: 10\n",
+		"node:\n  labels:\n    tier: worker; reboot\n",
+		"etcd:\n  labels:\n    tier: etcd\n",
+	} {
+		if _, err := clusterapi.ParseMachineDefaults([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestMachineDefaultsRoundTrip(t *testing.T) {
+	cluster := &clusterv1.Cluster{}
+	if defaults, err := clusterapi.MachineDefaultsFromCluster(cluster); err != nil || defaults != nil {
+		t.Fatalf("expected no defaults, got %v, %v", defaults, err)
+	}
+	want := clusterapi.MachineDefaults{
+		clustercommon.NodeRole: {Iface: "bond0", Labels: map[string]string{"tier": "worker"}},
+	}
+	if err := clusterapi.SetMachineDefaults(cluster, want); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := clusterapi.MachineDefaultsFromCluster(cluster)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if err := clusterapi.SetMachineDefaults(cluster, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cluster.Annotations["cctl.platform9.com/machine-defaults"]; ok {
+		t.Errorf("expected the defaults to be removed")
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidateClusterNetwork returns an error if the pod or service network is
+// not a valid CIDR, the networks overlap, or the DNS domain is not a valid
+// DNS subdomain.
+func ValidateClusterNetwork(podsCIDR, servicesCIDR, dnsDomain string) error {
+	_, pods, err := net.ParseCIDR(podsCIDR)
+	if err != nil {
+		return fmt.Errorf("pod network %q is not a valid CIDR: %v", podsCIDR, err)
+	}
+	_, services, err := net.ParseCIDR(servicesCIDR)
+	if err != nil {
+		return fmt.Errorf("service network %q is not a valid CIDR: %v", servicesCIDR, err)
+	}
+	if pods.Contains(services.IP) || services.Contains(pods.IP) {
+		return fmt.Errorf("pod network %s and service network %s overlap", pods, services)
+	}
+	if errs := validation.IsDNS1123Subdomain(dnsDomain); len(errs) != 0 {
+		return fmt.Errorf("cluster DNS domain %q is not valid: %s", dnsDomain, strings.Join(errs, "; "))
+	}
+	return nil
+}
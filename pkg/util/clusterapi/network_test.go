@@ -0,0 +1,41 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"testing"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestValidateClusterNetwork(t *testing.T) {
+	if err := clusterapi.ValidateClusterNetwork("10.2.0.0/16", "10.1.0.0/16", "cluster.local"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, tc := range []struct{ pods, services, domain string }{
+		{"10.2.0.0", "10.1.0.0/16", "cluster.local"},
+		{"10.2.0.0/16", "10.1.0.0/33", "cluster.local"},
+		{"10.0.0.0/8", "10.1.0.0/16", "cluster.local"},
+		{"10.2.0.0/16", "10.2.128.0/24", "cluster.local"},
+		{"10.2.0.0/16", "10.1.0.0/16", "Cluster_Local"},
+		{"10.2.0.0/16", "10.1.0.0/16", ""},
+	} {
+		if err := clusterapi.ValidateClusterNetwork(tc.pods, tc.services, tc.domain); err == nil {
+			t.Errorf("expected an error for %+v", tc)
+		}
+	}
+}
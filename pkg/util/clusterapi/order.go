@@ -0,0 +1,80 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	"fmt"
+	"sort"
+
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterutil "sigs.k8s.io/cluster-api/pkg/util"
+)
+
+// OrderForDeletion returns the machines in the order they can be safely
+// deleted: nodes first, then masters, then etcd machines, whose members the
+// masters may use. Within each group, the order of the input is preserved.
+func OrderForDeletion(machines []clusterv1.Machine) []clusterv1.Machine {
+	ordered := make([]clusterv1.Machine, len(machines))
+	copy(ordered, machines)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return deletionRank(ordered[i]) < deletionRank(ordered[j])
+	})
+	return ordered
+}
+
+func deletionRank(m clusterv1.Machine) int {
+	switch {
+	case isMaster(m):
+		return 1
+	case clusterutil.RoleContains(EtcdRole, m.Spec.Roles):
+		return 2
+	default:
+		return 0
+	}
+}
+
+// ValidateDeletion returns an error if deleting the machines in toDelete from
+// the cluster made up of all would leave nodes in the cluster without a
+// master.
+func ValidateDeletion(all, toDelete []clusterv1.Machine) error {
+	deleting := make(map[string]bool, len(toDelete))
+	for _, m := range toDelete {
+		deleting[m.Name] = true
+	}
+	remainingMasters := 0
+	remainingNodes := 0
+	for _, m := range all {
+		if deleting[m.Name] {
+			continue
+		}
+		if isMaster(m) {
+			remainingMasters++
+		}
+		if clusterutil.RoleContains(clustercommon.NodeRole, m.Spec.Roles) {
+			remainingNodes++
+		}
+	}
+	if remainingMasters == 0 && remainingNodes > 0 {
+		return fmt.Errorf("deleting all masters while %d nodes remain in the cluster. Delete the nodes first", remainingNodes)
+	}
+	return nil
+}
+
+func isMaster(m clusterv1.Machine) bool {
+	return clusterutil.RoleContains(clustercommon.MasterRole, m.Spec.Roles)
+}
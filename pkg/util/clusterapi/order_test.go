@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func newMachine(name string, role clustercommon.MachineRole) clusterv1.Machine {
+	return clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: clusterv1.MachineSpec{
+			Roles: []clustercommon.MachineRole{role},
+		},
+	}
+}
+
+func names(machines []clusterv1.Machine) []string {
+	var names []string
+	for _, m := range machines {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+func TestOrderForDeletion(t *testing.T) {
+	machines := []clusterv1.Machine{
+		newMachine("m1", clustercommon.MasterRole),
+		newMachine("e1", clusterapi.EtcdRole),
+		newMachine("n1", clustercommon.NodeRole),
+		newMachine("m2", clustercommon.MasterRole),
+		newMachine("n2", clustercommon.NodeRole),
+	}
+	expected := []string{"n1", "n2", "m1", "m2", "e1"}
+	actual := names(clusterapi.OrderForDeletion(machines))
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+	if machines[0].Name != "m1" {
+		t.Fatalf("input was modified")
+	}
+}
+
+func TestValidateDeletion(t *testing.T) {
+	all := []clusterv1.Machine{
+		newMachine("m1", clustercommon.MasterRole),
+		newMachine("m2", clustercommon.MasterRole),
+		newMachine("n1", clustercommon.NodeRole),
+	}
+	tcs := []struct {
+		name      string
+		toDelete  []clusterv1.Machine
+		expectErr bool
+	}{
+		{"one master", []clusterv1.Machine{all[0]}, false},
+		{"all masters", []clusterv1.Machine{all[0], all[1]}, true},
+		{"node", []clusterv1.Machine{all[2]}, false},
+		{"everything", all, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := clusterapi.ValidateDeletion(all, tc.toDelete)
+			if (err != nil) != tc.expectErr {
+				t.Fatalf("expected error: %v, found: %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestEtcdMachines(t *testing.T) {
+	machines := []clusterv1.Machine{
+		newMachine("m1", clustercommon.MasterRole),
+		newMachine("e1", clusterapi.EtcdRole),
+		newMachine("n1", clustercommon.NodeRole),
+	}
+	expected := []string{"m1", "e1"}
+	actual := names(clusterapi.EtcdMachines(machines))
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+}
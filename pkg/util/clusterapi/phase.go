@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+)
+
+// MachinePhase is the phase of a machine in its lifecycle.
+type MachinePhase string
+
+const (
+	// MachinePhaseProvisioning means the machine is being created or
+	// upgraded.
+	MachinePhaseProvisioning MachinePhase = "Provisioning"
+	// MachinePhaseReady means the machine was provisioned successfully.
+	MachinePhaseReady MachinePhase = "Ready"
+	// MachinePhaseDeleting means the machine is being deleted.
+	MachinePhaseDeleting MachinePhase = "Deleting"
+	// MachinePhaseFailed means the last operation on the machine failed.
+	MachinePhaseFailed MachinePhase = "Failed"
+	// MachinePhaseUnreachable means the machine could not be contacted over
+	// SSH the last time it was checked.
+	MachinePhaseUnreachable MachinePhase = "Unreachable"
+	// MachinePhaseHibernated means the node of the machine was drained, and
+	// the kubelet stopped or the machine powered off, until it is resumed.
+	MachinePhaseHibernated MachinePhase = "Hibernated"
+	// MachinePhaseUnknown is the phase of machines created before phases
+	// were recorded.
+	MachinePhaseUnknown MachinePhase = "Unknown"
+)
+
+// Phase returns the phase of the machine.
+func Phase(m *clusterv1.Machine) MachinePhase {
+	phase, ok := m.Annotations[common.PhaseAnnotationKey]
+	if !ok {
+		return MachinePhaseUnknown
+	}
+	return MachinePhase(phase)
+}
+
+// SetPhase sets the phase of the machine.
+func SetPhase(m *clusterv1.Machine, phase MachinePhase) {
+	setAnnotation(m, common.PhaseAnnotationKey, string(phase))
+}
+
+// IsTerminal returns true if no operation on the machine is in progress.
+func (p MachinePhase) IsTerminal() bool {
+	return p != MachinePhaseProvisioning && p != MachinePhaseDeleting
+}
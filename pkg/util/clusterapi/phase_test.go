@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"testing"
+
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestPhase(t *testing.T) {
+	m := &clusterv1.Machine{}
+	if phase := clusterapi.Phase(m); phase != clusterapi.MachinePhaseUnknown {
+		t.Fatalf("expected phase %s of a machine without a phase, found %s", clusterapi.MachinePhaseUnknown, phase)
+	}
+	for _, phase := range []clusterapi.MachinePhase{clusterapi.MachinePhaseProvisioning, clusterapi.MachinePhaseFailed, clusterapi.MachinePhaseReady} {
+		clusterapi.SetPhase(m, phase)
+		if actual := clusterapi.Phase(m); actual != phase {
+			t.Fatalf("expected phase %s, found %s", phase, actual)
+		}
+	}
+}
+
+func TestPhaseIsTerminal(t *testing.T) {
+	tcs := []struct {
+		phase    clusterapi.MachinePhase
+		terminal bool
+	}{
+		{clusterapi.MachinePhaseProvisioning, false},
+		{clusterapi.MachinePhaseDeleting, false},
+		{clusterapi.MachinePhaseReady, true},
+		{clusterapi.MachinePhaseFailed, true},
+		{clusterapi.MachinePhaseUnreachable, true},
+		{clusterapi.MachinePhaseHibernated, true},
+		{clusterapi.MachinePhaseUnknown, true},
+	}
+	for _, tc := range tcs {
+		if actual := tc.phase.IsTerminal(); actual != tc.terminal {
+			t.Errorf("phase %s: expected terminal %t, found %t", tc.phase, tc.terminal, actual)
+		}
+	}
+}
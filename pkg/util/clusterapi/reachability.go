@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	"time"
+
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+)
+
+// RecordReachable records that the machine was contacted over SSH at time t.
+func RecordReachable(m *clusterv1.Machine, t time.Time) {
+	setAnnotation(m, common.LastContactAnnotationKey, t.UTC().Format(time.RFC3339))
+	delete(m.Annotations, common.UnreachableSinceAnnotationKey)
+}
+
+// RecordUnreachable records that the machine could not be contacted over SSH
+// at time t. If the machine was already unreachable, the time it first became
+// unreachable is kept.
+func RecordUnreachable(m *clusterv1.Machine, t time.Time) {
+	if _, ok := m.Annotations[common.UnreachableSinceAnnotationKey]; ok {
+		return
+	}
+	setAnnotation(m, common.UnreachableSinceAnnotationKey, t.UTC().Format(time.RFC3339))
+}
+
+// RecordProbe records whether the machine was reachable over SSH at time t. A
+// machine that is Ready, or has no phase, becomes Unreachable when it cannot be
+// contacted, and becomes Ready again once it is contacted. The phases of
+// machines that are being changed, that failed, or that are hibernated are
+// kept.
+func RecordProbe(m *clusterv1.Machine, reachable bool, t time.Time) {
+	phase := Phase(m)
+	if !reachable {
+		RecordUnreachable(m, t)
+		if phase == MachinePhaseReady || phase == MachinePhaseUnknown {
+			SetPhase(m, MachinePhaseUnreachable)
+		}
+		return
+	}
+	RecordReachable(m, t)
+	if phase == MachinePhaseUnreachable {
+		SetPhase(m, MachinePhaseReady)
+	}
+}
+
+// LastContact returns the last time the machine was contacted over SSH, or nil
+// if it has never been contacted.
+func LastContact(m *clusterv1.Machine) *time.Time {
+	return annotationTime(m, common.LastContactAnnotationKey)
+}
+
+// UnreachableSince returns the time the machine was first found unreachable,
+// or nil if it was reachable the last time it was contacted.
+func UnreachableSince(m *clusterv1.Machine) *time.Time {
+	return annotationTime(m, common.UnreachableSinceAnnotationKey)
+}
+
+func setAnnotation(m *clusterv1.Machine, key, value string) {
+	if m.Annotations == nil {
+		m.Annotations = make(map[string]string)
+	}
+	m.Annotations[key] = value
+}
+
+func annotationTime(m *clusterv1.Machine, key string) *time.Time {
+	value, ok := m.Annotations[key]
+	if !ok {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
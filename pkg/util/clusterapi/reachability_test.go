@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestRecordReachability(t *testing.T) {
+	m := &clusterv1.Machine{}
+	if clusterapi.LastContact(m) != nil || clusterapi.UnreachableSince(m) != nil {
+		t.Fatalf("expected a new machine to have no contact times")
+	}
+	t1 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Minute)
+	t3 := t2.Add(time.Minute)
+
+	clusterapi.RecordReachable(m, t1)
+	if lc := clusterapi.LastContact(m); lc == nil || !lc.Equal(t1) {
+		t.Fatalf("expected last contact %v, found %v", t1, lc)
+	}
+	clusterapi.RecordUnreachable(m, t2)
+	clusterapi.RecordUnreachable(m, t3)
+	if us := clusterapi.UnreachableSince(m); us == nil || !us.Equal(t2) {
+		t.Fatalf("expected unreachable since %v, found %v", t2, us)
+	}
+	if lc := clusterapi.LastContact(m); lc == nil || !lc.Equal(t1) {
+		t.Fatalf("expected last contact %v to be kept, found %v", t1, lc)
+	}
+	clusterapi.RecordReachable(m, t3)
+	if us := clusterapi.UnreachableSince(m); us != nil {
+		t.Fatalf("expected no unreachable since once reachable, found %v", us)
+	}
+	if lc := clusterapi.LastContact(m); lc == nil || !lc.Equal(t3) {
+		t.Fatalf("expected last contact %v, found %v", t3, lc)
+	}
+}
+
+func TestInvalidContactTime(t *testing.T) {
+	m := &clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	clusterapi.RecordReachable(m, time.Now())
+	for k := range m.Annotations {
+		m.Annotations[k] = "yesterday"
+	}
+	if lc := clusterapi.LastContact(m); lc != nil {
+		t.Fatalf("expected no last contact for an invalid time, found %v", lc)
+	}
+}
+
+func TestRecordProbe(t *testing.T) {
+	tcs := []struct {
+		name      string
+		phase     clusterapi.MachinePhase
+		reachable bool
+		expected  clusterapi.MachinePhase
+	}{
+		{"ready unreachable", clusterapi.MachinePhaseReady, false, clusterapi.MachinePhaseUnreachable},
+		{"unknown unreachable", clusterapi.MachinePhaseUnknown, false, clusterapi.MachinePhaseUnreachable},
+		{"unreachable reachable", clusterapi.MachinePhaseUnreachable, true, clusterapi.MachinePhaseReady},
+		{"ready reachable", clusterapi.MachinePhaseReady, true, clusterapi.MachinePhaseReady},
+		{"failed unreachable", clusterapi.MachinePhaseFailed, false, clusterapi.MachinePhaseFailed},
+		{"failed reachable", clusterapi.MachinePhaseFailed, true, clusterapi.MachinePhaseFailed},
+		{"provisioning unreachable", clusterapi.MachinePhaseProvisioning, false, clusterapi.MachinePhaseProvisioning},
+		{"deleting unreachable", clusterapi.MachinePhaseDeleting, false, clusterapi.MachinePhaseDeleting},
+		{"hibernated unreachable", clusterapi.MachinePhaseHibernated, false, clusterapi.MachinePhaseHibernated},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &clusterv1.Machine{}
+			if tc.phase != clusterapi.MachinePhaseUnknown {
+				clusterapi.SetPhase(m, tc.phase)
+			}
+			now := time.Now()
+			clusterapi.RecordProbe(m, tc.reachable, now)
+			if actual := clusterapi.Phase(m); actual != tc.expected {
+				t.Fatalf("expected phase %s, found %s", tc.expected, actual)
+			}
+			if tc.reachable && clusterapi.LastContact(m) == nil {
+				t.Fatalf("expected last contact to be recorded")
+			}
+			if !tc.reachable && clusterapi.UnreachableSince(m) == nil {
+				t.Fatalf("expected unreachable since to be recorded")
+			}
+		})
+	}
+}
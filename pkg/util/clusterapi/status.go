@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	"fmt"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterclient "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset"
+)
+
+// MaxStatusUpdateAttempts is the number of times a status update is attempted
+// before a conflict is returned.
+const MaxStatusUpdateAttempts = 5
+
+// statusMu serializes status updates made by this process, so that the
+// changes of concurrent operations are applied one after the other.
+var statusMu sync.Mutex
+
+// UpdateClusterStatus applies the change to the status of the latest version
+// of the cluster, and updates it. Unlike an update of a copy read earlier, it
+// does not overwrite changes made since, e.g. the etcd members added by
+// another operation. If the update conflicts with a concurrent change, it is
+// attempted again with the latest version.
+func UpdateClusterStatus(client clusterclient.Interface, namespace, name string, change func(*clusterv1.Cluster) error) (*clusterv1.Cluster, error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	var err error
+	for attempt := 0; attempt < MaxStatusUpdateAttempts; attempt++ {
+		var cluster *clusterv1.Cluster
+		cluster, err = client.ClusterV1alpha1().Clusters(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get cluster %q: %v", name, err)
+		}
+		if err := change(cluster); err != nil {
+			return nil, err
+		}
+		var updated *clusterv1.Cluster
+		updated, err = client.ClusterV1alpha1().Clusters(namespace).UpdateStatus(cluster)
+		if err == nil {
+			return updated, nil
+		}
+		if !apierrors.IsConflict(err) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("unable to update cluster %q status: %v", name, err)
+}
+
+// UpdateMachineStatus applies the change to the status of the latest version
+// of the machine, and updates it, in the same way as UpdateClusterStatus.
+func UpdateMachineStatus(client clusterclient.Interface, namespace, name string, change func(*clusterv1.Machine) error) (*clusterv1.Machine, error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	var err error
+	for attempt := 0; attempt < MaxStatusUpdateAttempts; attempt++ {
+		var machine *clusterv1.Machine
+		machine, err = client.ClusterV1alpha1().Machines(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get machine %q: %v", name, err)
+		}
+		if err := change(machine); err != nil {
+			return nil, err
+		}
+		var updated *clusterv1.Machine
+		updated, err = client.ClusterV1alpha1().Machines(namespace).UpdateStatus(machine)
+		if err == nil {
+			return updated, nil
+		}
+		if !apierrors.IsConflict(err) {
+			break
+		}
+	}
+	return nil, fmt.Errorf("unable to update machine %q status: %v", name, err)
+}
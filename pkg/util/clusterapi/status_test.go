@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clienttesting "k8s.io/client-go/testing"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterclientfake "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset/fake"
+
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func addEndpoint(host string) func(*clusterv1.Cluster) error {
+	return func(c *clusterv1.Cluster) error {
+		c.Status.APIEndpoints = append(c.Status.APIEndpoints, clusterv1.APIEndpoint{Host: host, Port: 6443})
+		return nil
+	}
+}
+
+func TestUpdateClusterStatus(t *testing.T) {
+	client := clusterclientfake.NewSimpleClientset(&clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}})
+	// Both changes are applied to the latest version, so neither overwrites
+	// the other.
+	for _, host := range []string{"10.0.0.1", "10.0.0.2"} {
+		if _, err := clusterapi.UpdateClusterStatus(client, "default", "c", addEndpoint(host)); err != nil {
+			t.Fatalf("unable to update cluster status: %v", err)
+		}
+	}
+	cluster, err := client.ClusterV1alpha1().Clusters("default").Get("c", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unable to get cluster: %v", err)
+	}
+	if len(cluster.Status.APIEndpoints) != 2 {
+		t.Errorf("expected 2 endpoints, found %v", cluster.Status.APIEndpoints)
+	}
+
+	if _, err := clusterapi.UpdateClusterStatus(client, "default", "c", func(*clusterv1.Cluster) error {
+		return fmt.Errorf("invalid")
+	}); err == nil || err.Error() != "invalid" {
+		t.Errorf("expected the error of the change, found %v", err)
+	}
+	if _, err := clusterapi.UpdateClusterStatus(client, "default", "missing", addEndpoint("10.0.0.3")); err == nil {
+		t.Errorf("expected an error for a missing cluster")
+	}
+}
+
+func TestUpdateClusterStatusConflict(t *testing.T) {
+	client := clusterclientfake.NewSimpleClientset(&clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}})
+	conflicts := 2
+	client.PrependReactor("update", "clusters", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Resource: "clusters"}, "c", fmt.Errorf("modified"))
+	})
+	attempts := 0
+	updated, err := clusterapi.UpdateClusterStatus(client, "default", "c", func(c *clusterv1.Cluster) error {
+		attempts++
+		return addEndpoint("10.0.0.1")(c)
+	})
+	if err != nil {
+		t.Fatalf("unable to update cluster status: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected the change to be applied 3 times, found %d", attempts)
+	}
+	if len(updated.Status.APIEndpoints) != 1 {
+		t.Errorf("expected the change to be applied to the latest version, found %v", updated.Status.APIEndpoints)
+	}
+
+	conflicts = clusterapi.MaxStatusUpdateAttempts
+	if _, err := clusterapi.UpdateClusterStatus(client, "default", "c", addEndpoint("10.0.0.2")); err == nil {
+		t.Errorf("expected a conflict after %d attempts", clusterapi.MaxStatusUpdateAttempts)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi
+
+import (
+	"sort"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+)
+
+// CreateStep is a step of creating a machine. Completed steps are recorded,
+// so that creating the machine again resumes from the first incomplete step.
+type CreateStep string
+
+const (
+	// CreateStepProvisioned means the machine was provisioned by the
+	// actuator.
+	CreateStepProvisioned CreateStep = "Provisioned"
+	// CreateStepAdminKubeconfig means the admin kubeconfig was written to
+	// the node.
+	CreateStepAdminKubeconfig CreateStep = "AdminKubeconfig"
+	// CreateStepClusterStatus means the etcd member and API endpoint of the
+	// master were added to the cluster status.
+	CreateStepClusterStatus CreateStep = "ClusterStatus"
+	// CreateStepCNI means the pod network of the cluster was deployed from
+	// the master, and the CNI configuration of flannel was removed from the
+	// machine if the cluster does not use flannel.
+	CreateStepCNI CreateStep = "CNI"
+	// CreateStepNodeLabels means the labels of the machine were applied to
+	// its cluster node.
+	CreateStepNodeLabels CreateStep = "NodeLabels"
+	// CreateStepKubeletConfig means the kubelet configuration overrides of
+	// the machine were merged into the kubelet configuration on the machine.
+	CreateStepKubeletConfig CreateStep = "KubeletConfig"
+	// CreateStepAPIServerCertSANs means the API server certificate of the
+	// master was reissued with the extra alternative names of the cluster.
+	CreateStepAPIServerCertSANs CreateStep = "APIServerCertSANs"
+	// CreateStepAuditConfig means audit logging was configured on the API
+	// server of the master.
+	CreateStepAuditConfig CreateStep = "AuditConfig"
+	// CreateStepEncryptionConfig means the API server of the master was
+	// configured to encrypt secrets at rest.
+	CreateStepEncryptionConfig CreateStep = "EncryptionConfig"
+	// CreateStepControlPlaneHook means the control plane hook was run for
+	// the master, and nodes were pointed at the API endpoint; or, for a
+	// node, that the node was pointed at the API endpoint.
+	CreateStepControlPlaneHook CreateStep = "ControlPlaneHook"
+	// CreateStepKeepalivedConfig means the VRRP settings of the cluster were
+	// applied to the keepalived configuration of the master.
+	CreateStepKeepalivedConfig CreateStep = "KeepalivedConfig"
+)
+
+// CompletedCreateSteps returns the create steps completed for the machine,
+// sorted by name.
+func CompletedCreateSteps(m *clusterv1.Machine) []CreateStep {
+	value := m.Annotations[common.CompletedCreateStepsAnnotationKey]
+	if len(value) == 0 {
+		return nil
+	}
+	var steps []CreateStep
+	for _, s := range strings.Split(value, ",") {
+		steps = append(steps, CreateStep(s))
+	}
+	return steps
+}
+
+// CreateStepCompleted returns true if the create step was completed for the
+// machine.
+func CreateStepCompleted(m *clusterv1.Machine, step CreateStep) bool {
+	for _, s := range CompletedCreateSteps(m) {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCreateStepCompleted records that the create step was completed for the
+// machine.
+func SetCreateStepCompleted(m *clusterv1.Machine, step CreateStep) {
+	if CreateStepCompleted(m, step) {
+		return
+	}
+	var names []string
+	for _, s := range append(CompletedCreateSteps(m), step) {
+		names = append(names, string(s))
+	}
+	sort.Strings(names)
+	setAnnotation(m, common.CompletedCreateStepsAnnotationKey, strings.Join(names, ","))
+}
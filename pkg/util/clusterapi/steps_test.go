@@ -0,0 +1,47 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clusterapi_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestCreateSteps(t *testing.T) {
+	m := &clusterv1.Machine{}
+	if clusterapi.CreateStepCompleted(m, clusterapi.CreateStepProvisioned) {
+		t.Errorf("expected no step to be completed")
+	}
+	clusterapi.SetCreateStepCompleted(m, clusterapi.CreateStepProvisioned)
+	clusterapi.SetCreateStepCompleted(m, clusterapi.CreateStepClusterStatus)
+	clusterapi.SetCreateStepCompleted(m, clusterapi.CreateStepProvisioned)
+	if value := m.Annotations[common.CompletedCreateStepsAnnotationKey]; value != "ClusterStatus,Provisioned" {
+		t.Errorf("unexpected annotation %q", value)
+	}
+	expected := []clusterapi.CreateStep{clusterapi.CreateStepClusterStatus, clusterapi.CreateStepProvisioned}
+	if actual := clusterapi.CompletedCreateSteps(m); !cmp.Equal(expected, actual) {
+		t.Errorf("expected %v, found %v", expected, actual)
+	}
+	if !clusterapi.CreateStepCompleted(m, clusterapi.CreateStepClusterStatus) || clusterapi.CreateStepCompleted(m, clusterapi.CreateStepAdminKubeconfig) {
+		t.Errorf("unexpected completed steps %v", clusterapi.CompletedCreateSteps(m))
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cni selects the pod network of the cluster, and renders the
+// manifests that deploy it.
+package cni
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// Plugin is a pod network.
+type Plugin string
+
+const (
+	// Flannel is deployed by nodeadm on every master.
+	Flannel Plugin = "flannel"
+	// Calico is deployed by cctl on every master.
+	Calico Plugin = "calico"
+	// None means no pod network is deployed; nodes are NotReady until one
+	// is.
+	None Plugin = "none"
+
+	// CalicoVersion is the version of the built-in Calico manifest.
+	CalicoVersion = "v3.8.2"
+)
+
+// Plugins are the supported pod networks.
+var Plugins = []Plugin{Flannel, Calico, None}
+
+// FlannelDaemonSets are the daemonsets, in kube-system, of the flannel that
+// nodeadm deploys.
+var FlannelDaemonSets = []string{"kube-flannel-ds"}
+
+// FlannelConfigFiles are the CNI configuration files written by flannel on
+// every machine.
+var FlannelConfigFiles = []string{"/etc/cni/net.d/10-flannel.conf", "/etc/cni/net.d/10-flannel.conflist"}
+
+// ParsePlugin returns the plugin with the name.
+func ParsePlugin(name string) (Plugin, error) {
+	var names []string
+	for _, p := range Plugins {
+		if string(p) == name {
+			return p, nil
+		}
+		names = append(names, string(p))
+	}
+	return "", fmt.Errorf("unsupported CNI %q, must be one of %s", name, strings.Join(names, ", "))
+}
+
+// ValidateManifest returns an error if the data is not a sequence of YAML
+// documents of Kubernetes objects.
+func ValidateManifest(data []byte) error {
+	docs := splitDocuments(data)
+	if len(docs) == 0 {
+		return fmt.Errorf("manifest has no objects")
+	}
+	for i, doc := range docs {
+		var object struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := yaml.Unmarshal(doc, &object); err != nil {
+			return fmt.Errorf("unable to decode object %d: %v", i+1, err)
+		}
+		if len(object.APIVersion) == 0 || len(object.Kind) == 0 {
+			return fmt.Errorf("object %d has no apiVersion or kind", i+1)
+		}
+	}
+	return nil
+}
+
+// splitDocuments returns the YAML documents of the data that are not empty.
+func splitDocuments(data []byte) [][]byte {
+	var docs [][]byte
+	for _, doc := range bytes.Split(data, []byte("\n---")) {
+		var content bool
+		for _, line := range strings.Split(string(doc), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) != 0 && !strings.HasPrefix(line, "#") && line != "---" {
+				content = true
+				break
+			}
+		}
+		if content {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// Manifest returns the built-in manifest of the plugin, for the pod CIDR of
+// the cluster. Flannel and None have no built-in manifest.
+func Manifest(plugin Plugin, podCIDR string) ([]byte, error) {
+	if plugin != Calico {
+		return nil, nil
+	}
+	t, err := template.New("calico").Parse(calicoManifest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse calico manifest: %v", err)
+	}
+	var b bytes.Buffer
+	data := struct {
+		PodCIDR, Version string
+		CRDs             []calicoCRD
+	}{podCIDR, CalicoVersion, calicoCRDs}
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("unable to render calico manifest: %v", err)
+	}
+	return b.Bytes(), nil
+}
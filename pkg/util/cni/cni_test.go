@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cni
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePlugin(t *testing.T) {
+	for _, p := range Plugins {
+		parsed, err := ParsePlugin(string(p))
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", p, err)
+		}
+		if parsed != p {
+			t.Errorf("expected %q, got %q", p, parsed)
+		}
+	}
+	if _, err := ParsePlugin("weave"); err == nil {
+		t.Errorf("expected error for unsupported plugin")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	manifest, err := Manifest(Calico, "10.2.0.0/16")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidateManifest(manifest); err != nil {
+		t.Errorf("invalid calico manifest: %v", err)
+	}
+	for _, s := range []string{
+		`value: "10.2.0.0/16"`,
+		"image: calico/node:" + CalicoVersion,
+		"name: ippools.crd.projectcalico.org",
+	} {
+		if !strings.Contains(string(manifest), s) {
+			t.Errorf("expected calico manifest to contain %q", s)
+		}
+	}
+	for _, p := range []Plugin{Flannel, None} {
+		if manifest, err := Manifest(p, "10.2.0.0/16"); err != nil || manifest != nil {
+			t.Errorf("expected no manifest for %q, got %q, error %v", p, manifest, err)
+		}
+	}
+}
+
+func TestValidateManifest(t *testing.T) {
+	valid := `# A comment
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: a
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: b
+`
+	if err := ValidateManifest([]byte(valid)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, invalid := range []string{
+		"",
+		"# only a comment\n",
+		"metadata:\n  name: a\n",
+		"apiVersion: v1\nkind: [\n",
+	} {
+		if err := ValidateManifest([]byte(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
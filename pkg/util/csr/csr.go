@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csr
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+const (
+	nodeUserPrefix = "system:node:"
+	usageServer    = "server auth"
+	usageClient    = "client auth"
+)
+
+// CSR is a certificate signing request, as returned by `kubectl get csr -o
+// json`.
+type CSR struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		// Request is the PEM encoded request.
+		Request  []byte   `json:"request"`
+		Username string   `json:"username"`
+		Usages   []string `json:"usages"`
+	} `json:"spec"`
+	Status struct {
+		Conditions []struct {
+			Type string `json:"type"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// ParseList parses the output of `kubectl get csr -o json`.
+func ParseList(out []byte) ([]CSR, error) {
+	var list struct {
+		Items []CSR `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse CSR list: %v", err)
+	}
+	return list.Items, nil
+}
+
+// Name returns the name of the CSR.
+func (c *CSR) Name() string {
+	return c.Metadata.Name
+}
+
+// IsPending returns true if the CSR has been neither approved nor denied.
+func (c *CSR) IsPending() bool {
+	return len(c.Status.Conditions) == 0
+}
+
+// IsKubeletServing returns true if the CSR was created by a node and
+// requests a serving certificate, and not a client certificate.
+func (c *CSR) IsKubeletServing() bool {
+	if !strings.HasPrefix(c.Spec.Username, nodeUserPrefix) {
+		return false
+	}
+	var server bool
+	for _, u := range c.Spec.Usages {
+		switch u {
+		case usageServer:
+			server = true
+		case usageClient:
+			return false
+		}
+	}
+	return server
+}
+
+// NodeName returns the name of the node that created the CSR.
+func (c *CSR) NodeName() string {
+	return strings.TrimPrefix(c.Spec.Username, nodeUserPrefix)
+}
+
+// Validate checks that the request is for the node that created the CSR,
+// and that every DNS and IP subject alternative name is one of the node's
+// addresses.
+func (c *CSR) Validate(nodeAddresses []string) error {
+	block, _ := pem.Decode(c.Spec.Request)
+	if block == nil {
+		return fmt.Errorf("no PEM encoded request found")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("unable to parse request: %v", err)
+	}
+	if req.Subject.CommonName != c.Spec.Username {
+		return fmt.Errorf("request common name %q does not match requesting user %q", req.Subject.CommonName, c.Spec.Username)
+	}
+	allowed := make(map[string]bool)
+	for _, a := range nodeAddresses {
+		allowed[a] = true
+	}
+	for _, name := range req.DNSNames {
+		if !allowed[name] {
+			return fmt.Errorf("DNS name %q is not an address of node %q", name, c.NodeName())
+		}
+	}
+	for _, ip := range req.IPAddresses {
+		if !allowed[ip.String()] {
+			return fmt.Errorf("IP %q is not an address of node %q", ip, c.NodeName())
+		}
+	}
+	if len(req.EmailAddresses) != 0 || len(req.URIs) != 0 {
+		return fmt.Errorf("request has email or URI subject alternative names")
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csr
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"testing"
+)
+
+func newRequest(t *testing.T, commonName string, dnsNames []string, ips []string) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	tmpl := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName, Organization: []string{"system:nodes"}},
+		DNSNames: dnsNames,
+	}
+	for _, ip := range ips {
+		tmpl.IPAddresses = append(tmpl.IPAddresses, net.ParseIP(ip))
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		t.Fatalf("unable to create request: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func newCSR(username string, usages []string, request []byte, conditions ...string) CSR {
+	c := CSR{}
+	c.Metadata.Name = "csr-" + username
+	c.Spec.Username = username
+	c.Spec.Usages = usages
+	c.Spec.Request = request
+	for _, cond := range conditions {
+		c.Status.Conditions = append(c.Status.Conditions, struct {
+			Type string `json:"type"`
+		}{cond})
+	}
+	return c
+}
+
+func TestParseList(t *testing.T) {
+	request := newRequest(t, "system:node:worker1", []string{"worker1"}, []string{"10.0.0.2"})
+	items := []CSR{
+		newCSR("system:node:worker1", []string{"digital signature", "key encipherment", "server auth"}, request),
+		newCSR("system:node:worker2", []string{"digital signature", "key encipherment", "server auth"}, request, "Approved"),
+	}
+	out, err := json.Marshal(map[string]interface{}{"items": items})
+	if err != nil {
+		t.Fatalf("unable to marshal list: %v", err)
+	}
+	csrs, err := ParseList(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(csrs) != 2 {
+		t.Fatalf("expected 2 CSRs, found %d", len(csrs))
+	}
+	if !csrs[0].IsPending() || csrs[1].IsPending() {
+		t.Errorf("unexpected pending state")
+	}
+	if csrs[0].NodeName() != "worker1" || csrs[0].Name() != "csr-system:node:worker1" {
+		t.Errorf("unexpected node name %q or name %q", csrs[0].NodeName(), csrs[0].Name())
+	}
+	if string(csrs[0].Spec.Request) != string(request) {
+		t.Errorf("request not preserved")
+	}
+}
+
+func TestIsKubeletServing(t *testing.T) {
+	tcs := []struct {
+		name     string
+		username string
+		usages   []string
+		expected bool
+	}{
+		{"serving", "system:node:worker1", []string{"digital signature", "key encipherment", "server auth"}, true},
+		{"client", "system:node:worker1", []string{"digital signature", "key encipherment", "client auth"}, false},
+		{"both", "system:node:worker1", []string{"server auth", "client auth"}, false},
+		{"not a node", "system:bootstrap:abcdef", []string{"server auth"}, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCSR(tc.username, tc.usages, nil)
+			if actual := c.IsKubeletServing(); actual != tc.expected {
+				t.Errorf("expected %v, found %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	addresses := []string{"10.0.0.2", "worker1"}
+	tcs := []struct {
+		name       string
+		commonName string
+		dnsNames   []string
+		ips        []string
+		valid      bool
+	}{
+		{"matching", "system:node:worker1", []string{"worker1"}, []string{"10.0.0.2"}, true},
+		{"other IP", "system:node:worker1", []string{"worker1"}, []string{"10.0.0.3"}, false},
+		{"other DNS name", "system:node:worker1", []string{"evil.example.com"}, []string{"10.0.0.2"}, false},
+		{"other node", "system:node:worker2", []string{"worker1"}, []string{"10.0.0.2"}, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newCSR("system:node:worker1", []string{"server auth"}, newRequest(t, tc.commonName, tc.dnsNames, tc.ips))
+			err := c.Validate(addresses)
+			if tc.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dataloss finds the data on a node that is lost when the node is
+// drained and deleted.
+package dataloss
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodImpact is a pod on the node whose data is lost.
+type PodImpact struct {
+	// Pod is the namespace/name of the pod.
+	Pod string
+	// EmptyDirs are the emptyDir volumes of the pod. Their data is deleted
+	// when the pod is evicted.
+	EmptyDirs []string
+	// LocalVolumes are the local and hostPath persistent volumes of the pod.
+	// Their data stays on the machine, and the pod cannot be scheduled to
+	// another node.
+	LocalVolumes []string
+}
+
+// Assess returns the pods, from the JSON output of 'kubectl get pods', whose
+// data is lost when the node is drained and deleted, sorted by name. The
+// persistent volumes, from the JSON output of 'kubectl get pv', are used to
+// find the local volumes claimed by the pods. Pods of DaemonSets, and mirror
+// pods, are not evicted by a drain, and are ignored.
+func Assess(podsJSON, pvsJSON []byte) ([]PodImpact, error) {
+	var pods corev1.PodList
+	if err := json.Unmarshal(podsJSON, &pods); err != nil {
+		return nil, fmt.Errorf("unable to decode pods: %v", err)
+	}
+	var pvs corev1.PersistentVolumeList
+	if err := json.Unmarshal(pvsJSON, &pvs); err != nil {
+		return nil, fmt.Errorf("unable to decode persistent volumes: %v", err)
+	}
+	// localClaims maps the namespace/name of a claim to the local volume
+	// bound to it.
+	localClaims := make(map[string]string)
+	for _, pv := range pvs.Items {
+		if pv.Spec.ClaimRef == nil || (pv.Spec.Local == nil && pv.Spec.HostPath == nil) {
+			continue
+		}
+		localClaims[pv.Spec.ClaimRef.Namespace+"/"+pv.Spec.ClaimRef.Name] = pv.Name
+	}
+	var impacts []PodImpact
+	for _, pod := range pods.Items {
+		if !evicted(pod) {
+			continue
+		}
+		impact := PodImpact{Pod: pod.Namespace + "/" + pod.Name}
+		for _, v := range pod.Spec.Volumes {
+			switch {
+			case v.EmptyDir != nil:
+				impact.EmptyDirs = append(impact.EmptyDirs, v.Name)
+			case v.PersistentVolumeClaim != nil:
+				if pv, ok := localClaims[pod.Namespace+"/"+v.PersistentVolumeClaim.ClaimName]; ok {
+					impact.LocalVolumes = append(impact.LocalVolumes, pv)
+				}
+			}
+		}
+		if len(impact.EmptyDirs) != 0 || len(impact.LocalVolumes) != 0 {
+			impacts = append(impacts, impact)
+		}
+	}
+	sort.Slice(impacts, func(i, j int) bool { return impacts[i].Pod < impacts[j].Pod })
+	return impacts, nil
+}
+
+// evicted returns true if draining the node evicts the pod.
+func evicted(pod corev1.Pod) bool {
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		return false
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return false
+		}
+	}
+	return pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed
+}
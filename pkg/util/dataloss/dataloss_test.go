@@ -0,0 +1,57 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dataloss_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/platform9/cctl/pkg/util/dataloss"
+)
+
+const pods = `{"items": [
+{"metadata": {"namespace": "default", "name": "web"}, "spec": {"volumes": [{"name": "cache", "emptyDir": {}}, {"name": "token", "secret": {"secretName": "t"}}]}, "status": {"phase": "Running"}},
+{"metadata": {"namespace": "db", "name": "postgres-0"}, "spec": {"volumes": [{"name": "data", "persistentVolumeClaim": {"claimName": "data-postgres-0"}}]}, "status": {"phase": "Running"}},
+{"metadata": {"namespace": "db", "name": "remote"}, "spec": {"volumes": [{"name": "data", "persistentVolumeClaim": {"claimName": "nfs"}}]}, "status": {"phase": "Running"}},
+{"metadata": {"namespace": "kube-system", "name": "flannel", "ownerReferences": [{"kind": "DaemonSet", "name": "flannel"}]}, "spec": {"volumes": [{"name": "run", "emptyDir": {}}]}, "status": {"phase": "Running"}},
+{"metadata": {"namespace": "kube-system", "name": "etcd", "annotations": {"kubernetes.io/config.mirror": "x"}}, "spec": {"volumes": [{"name": "tmp", "emptyDir": {}}]}, "status": {"phase": "Running"}},
+{"metadata": {"namespace": "default", "name": "done"}, "spec": {"volumes": [{"name": "tmp", "emptyDir": {}}]}, "status": {"phase": "Succeeded"}}
+]}`
+
+const pvs = `{"items": [
+{"metadata": {"name": "local-pv-1"}, "spec": {"local": {"path": "/mnt/disks/1"}, "claimRef": {"namespace": "db", "name": "data-postgres-0"}}},
+{"metadata": {"name": "nfs-pv"}, "spec": {"nfs": {"server": "nfs", "path": "/"}, "claimRef": {"namespace": "db", "name": "nfs"}}},
+{"metadata": {"name": "local-pv-2"}, "spec": {"hostPath": {"path": "/data"}}}
+]}`
+
+func TestAssess(t *testing.T) {
+	impacts, err := dataloss.Assess([]byte(pods), []byte(pvs))
+	if err != nil {
+		t.Fatalf("unable to assess: %v", err)
+	}
+	expected := []dataloss.PodImpact{
+		{Pod: "db/postgres-0", LocalVolumes: []string{"local-pv-1"}},
+		{Pod: "default/web", EmptyDirs: []string{"cache"}},
+	}
+	if diff := cmp.Diff(expected, impacts); diff != "" {
+		t.Errorf("unexpected impacts (-expected +found):\n%s", diff)
+	}
+	if _, err := dataloss.Assess([]byte("not json"), []byte(pvs)); err == nil {
+		t.Errorf("expected an error for invalid pods")
+	}
+}
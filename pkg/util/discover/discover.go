@@ -0,0 +1,177 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package discover finds hosts on a network that can be adopted as machines.
+package discover
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MaxHosts is the largest number of hosts that can be scanned at once.
+const MaxHosts = 65536
+
+// Hosts returns the addresses of the hosts in the CIDR. The network and
+// broadcast addresses of an IPv4 subnet larger than /31 are omitted.
+func Hosts(cidr string) ([]string, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CIDR %q: %v", cidr, err)
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("CIDR %q is not an IPv4 CIDR", cidr)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits-ones > 16 {
+		return nil, fmt.Errorf("CIDR %q has more than %d addresses", cidr, MaxHosts)
+	}
+	var hosts []string
+	for ip := ipNet.IP.To4(); ipNet.Contains(ip); ip = next(ip) {
+		hosts = append(hosts, ip.String())
+	}
+	if bits-ones > 1 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// next returns the address after ip. The address after the last one wraps
+// around to the first.
+func next(ip net.IP) net.IP {
+	n := make(net.IP, len(ip))
+	copy(n, ip)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// OSRelease identifies the operating system of a host.
+type OSRelease struct {
+	ID        string
+	VersionID string
+	// IDLike are the IDs of the operating systems this one is derived from,
+	// e.g. rhel and fedora for centos.
+	IDLike []string
+}
+
+func (o OSRelease) String() string {
+	if len(o.VersionID) == 0 {
+		return o.ID
+	}
+	return fmt.Sprintf("%s-%s", o.ID, o.VersionID)
+}
+
+// ParseOSRelease parses the contents of /etc/os-release.
+func ParseOSRelease(b []byte) OSRelease {
+	var o OSRelease
+	for _, line := range strings.Split(string(b), "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(kv[1], `"'`)
+		switch kv[0] {
+		case "ID":
+			o.ID = value
+		case "VERSION_ID":
+			o.VersionID = value
+		case "ID_LIKE":
+			o.IDLike = strings.Fields(value)
+		}
+	}
+	return o
+}
+
+// MatchesOS returns true if the OS release matches one of the patterns. A
+// pattern is an ID, e.g. "ubuntu", or an ID and version prefix, e.g.
+// "ubuntu-16". An empty list matches every OS.
+func MatchesOS(o OSRelease, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		id := strings.ToLower(o.ID)
+		if p == id || (strings.HasPrefix(p, id+"-") && strings.HasPrefix(o.VersionID, strings.TrimPrefix(p, id+"-"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Candidate is the result of probing a host.
+type Candidate struct {
+	IP     string
+	OS     string
+	Usable bool
+	Reason string
+}
+
+// Probe checks whether the host can be adopted. It returns false if nothing
+// answers at the host, in which case the host is not reported.
+type Probe func(host string) (Candidate, bool)
+
+// Scan probes the hosts, at most concurrency at a time, and returns the
+// candidates sorted by IP.
+func Scan(hosts []string, concurrency int, probe Probe) []Candidate {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		candidates []Candidate
+	)
+	work := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range work {
+				if c, ok := probe(host); ok {
+					mu.Lock()
+					candidates = append(candidates, c)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, host := range hosts {
+		work <- host
+	}
+	close(work)
+	wg.Wait()
+	sort.Slice(candidates, func(i, j int) bool {
+		return lessIP(candidates[i].IP, candidates[j].IP)
+	})
+	return candidates
+}
+
+func lessIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a).To16(), net.ParseIP(b).To16()
+	if ipA == nil || ipB == nil {
+		return a < b
+	}
+	return string(ipA) < string(ipB)
+}
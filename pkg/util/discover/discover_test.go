@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discover
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHosts(t *testing.T) {
+	tests := []struct {
+		cidr     string
+		expected []string
+	}{
+		{"10.0.0.0/30", []string{"10.0.0.1", "10.0.0.2"}},
+		{"10.0.0.5/30", []string{"10.0.0.5", "10.0.0.6"}},
+		{"10.0.0.4/31", []string{"10.0.0.4", "10.0.0.5"}},
+		{"10.0.0.9/32", []string{"10.0.0.9"}},
+		{"10.0.0.254/29", []string{"10.0.0.249", "10.0.0.250", "10.0.0.251", "10.0.0.252", "10.0.0.253", "10.0.0.254"}},
+	}
+	for _, test := range tests {
+		hosts, err := Hosts(test.cidr)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", test.cidr, err)
+		}
+		if !reflect.DeepEqual(hosts, test.expected) {
+			t.Errorf("expected %v for %q, found %v", test.expected, test.cidr, hosts)
+		}
+	}
+	hosts, err := Hosts("10.0.0.0/16")
+	if err != nil || len(hosts) != MaxHosts-2 {
+		t.Errorf("expected %d hosts, found %d (%v)", MaxHosts-2, len(hosts), err)
+	}
+	for _, cidr := range []string{"10.0.0.0/15", "fd00::/120", "10.0.0.0"} {
+		if _, err := Hosts(cidr); err == nil {
+			t.Errorf("expected error for %q", cidr)
+		}
+	}
+}
+
+func TestParseOSRelease(t *testing.T) {
+	o := ParseOSRelease([]byte(`NAME="Ubuntu"
+VERSION="16.04.5 LTS (Xenial Xerus)"
+ID=ubuntu
+VERSION_ID="16.04"
+`))
+	if o.ID != "ubuntu" || o.VersionID != "16.04" || o.String() != "ubuntu-16.04" {
+		t.Errorf("unexpected OS release %+v", o)
+	}
+	for pattern, expected := range map[string]bool{
+		"ubuntu":       true,
+		"Ubuntu-16":    true,
+		"ubuntu-16.04": true,
+		"ubuntu-18":    false,
+		"centos":       false,
+	} {
+		if MatchesOS(o, []string{pattern}) != expected {
+			t.Errorf("expected pattern %q to match %v", pattern, expected)
+		}
+	}
+	o = ParseOSRelease([]byte(`ID="centos"
+ID_LIKE="rhel fedora"
+VERSION_ID="7"
+`))
+	if len(o.IDLike) != 2 || o.IDLike[0] != "rhel" || o.IDLike[1] != "fedora" {
+		t.Errorf("unexpected OS release %+v", o)
+	}
+	if !MatchesOS(o, nil) {
+		t.Errorf("expected empty patterns to match")
+	}
+}
+
+func TestScan(t *testing.T) {
+	hosts, _ := Hosts("10.0.0.0/28")
+	candidates := Scan(hosts, 4, func(host string) (Candidate, bool) {
+		if !strings.HasSuffix(host, "0.2") && !strings.HasSuffix(host, ".10") && !strings.HasSuffix(host, ".9") {
+			return Candidate{}, false
+		}
+		return Candidate{IP: host, Usable: host != "10.0.0.9"}, true
+	})
+	var ips []string
+	for _, c := range candidates {
+		ips = append(ips, c.IP)
+	}
+	if expected := []string{"10.0.0.2", "10.0.0.9", "10.0.0.10"}; !reflect.DeepEqual(ips, expected) {
+		t.Errorf("expected %v, found %v", expected, ips)
+	}
+}
@@ -0,0 +1,497 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dnsrecord registers the DNS record of the API endpoint of the
+// control plane with a DNS provider, so that kubeconfigs can reach the API
+// server by name when its address changes.
+package dnsrecord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultTTL is the TTL, in seconds, of records of configs without one.
+const DefaultTTL = 60
+
+// Record is the DNS record of the API endpoint.
+type Record struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	// Name is the fully qualified name of the record.
+	Name string `json:"name"`
+	// Addresses are the IPv4 and IPv6 addresses of the API endpoint, in A
+	// and AAAA records.
+	Addresses []string `json:"addresses"`
+	TTL       int      `json:"ttl"`
+}
+
+// Provider registers records with a DNS service. Register replaces the
+// addresses of the record, and must be safe to run again.
+type Provider interface {
+	Register(ctx context.Context, r Record) error
+}
+
+// Factory returns a provider configured by the options.
+type Factory func(options map[string]string) (Provider, error)
+
+var providers = map[string]Factory{}
+
+// RegisterProvider makes a provider available by name.
+func RegisterProvider(name string, f Factory) {
+	providers[name] = f
+}
+
+// Providers returns the names of the available providers, sorted.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Config is the DNS record of a cluster, and the provider that registers it.
+type Config struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	TTL      int    `json:"ttl,omitempty"`
+	// Options configure the provider, e.g. the hosted zone of route53.
+	// Credentials are not kept in the options, but read by the provider from
+	// its environment.
+	Options map[string]string `json:"options,omitempty"`
+	// Addresses were last registered, so that the record is only updated
+	// when they change.
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Validate returns an error if the provider is not available or rejects the
+// options, or the name is not a DNS name.
+func (c Config) Validate() error {
+	if _, err := c.provider(); err != nil {
+		return err
+	}
+	if errs := validation.IsDNS1123Subdomain(strings.TrimSuffix(c.Name, ".")); len(errs) != 0 {
+		return fmt.Errorf("name %q is not a DNS name: %s", c.Name, strings.Join(errs, ", "))
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("TTL %d must not be negative", c.TTL)
+	}
+	return nil
+}
+
+func (c Config) provider() (Provider, error) {
+	f, ok := providers[c.Provider]
+	if !ok {
+		return nil, fmt.Errorf("DNS provider %q must be one of %s", c.Provider, strings.Join(Providers(), ", "))
+	}
+	p, err := f(c.Options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options of DNS provider %q: %v", c.Provider, err)
+	}
+	return p, nil
+}
+
+// ParseOptions returns the provider options given as key=value.
+func ParseOptions(pairs []string) (map[string]string, error) {
+	options := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, fmt.Errorf("%q must be key=value", pair)
+		}
+		options[kv[0]] = kv[1]
+	}
+	return options, nil
+}
+
+// Register registers the record of the config with the addresses, and
+// returns the config with the addresses recorded. It does nothing if the
+// addresses were already registered, unless force is true.
+func Register(c Config, cluster, namespace string, addresses []string, force bool, timeout time.Duration) (Config, bool, error) {
+	addresses = sortedAddresses(addresses)
+	if !force && equal(c.Addresses, addresses) {
+		return c, false, nil
+	}
+	if len(addresses) == 0 {
+		return c, false, fmt.Errorf("the API endpoint has no addresses")
+	}
+	p, err := c.provider()
+	if err != nil {
+		return c, false, err
+	}
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	r := Record{
+		Cluster:   cluster,
+		Namespace: namespace,
+		Name:      strings.TrimSuffix(c.Name, "."),
+		Addresses: addresses,
+		TTL:       ttl,
+	}
+	if err := p.Register(ctx, r); err != nil {
+		return c, false, fmt.Errorf("unable to register %q with DNS provider %q: %v", r.Name, c.Provider, err)
+	}
+	c.Addresses = addresses
+	return c, true, nil
+}
+
+func sortedAddresses(addresses []string) []string {
+	sorted := append([]string{}, addresses...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// split returns the IPv4 and IPv6 addresses, for A and AAAA records.
+func split(addresses []string) ([]string, []string, error) {
+	var v4, v6 []string
+	for _, a := range addresses {
+		ip := net.ParseIP(a)
+		switch {
+		case ip == nil:
+			return nil, nil, fmt.Errorf("%q is not an IP address", a)
+		case ip.To4() != nil:
+			v4 = append(v4, a)
+		default:
+			v6 = append(v6, a)
+		}
+	}
+	return v4, v6, nil
+}
+
+func init() {
+	RegisterProvider("script", newScript)
+	RegisterProvider("webhook", newWebhook)
+	RegisterProvider("route53", newRoute53)
+	RegisterProvider("infoblox", newInfoblox)
+}
+
+// script gives the record, as JSON, to a command on its standard input.
+type script struct {
+	command string
+}
+
+func newScript(options map[string]string) (Provider, error) {
+	if err := knownOptions(options, "command"); err != nil {
+		return nil, err
+	}
+	if len(options["command"]) == 0 {
+		return nil, fmt.Errorf("command is required")
+	}
+	return script{command: options["command"]}, nil
+}
+
+func (s script) Register(ctx context.Context, r Record) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("unable to encode record: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.Stdin = bytes.NewReader(body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running %q: %v (output: %q)", s.command, err, string(out))
+	}
+	return nil
+}
+
+// webhook POSTs the record, as JSON, to a URL.
+type webhook struct {
+	url string
+}
+
+func newWebhook(options map[string]string) (Provider, error) {
+	if err := knownOptions(options, "url"); err != nil {
+		return nil, err
+	}
+	if err := validateURL(options["url"]); err != nil {
+		return nil, err
+	}
+	return webhook{url: options["url"]}, nil
+}
+
+func (w webhook) Register(ctx context.Context, r Record) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("unable to encode record: %v", err)
+	}
+	_, err = do(ctx, http.MethodPost, w.url, "", "", body)
+	return err
+}
+
+// route53 upserts the record in a hosted zone with the AWS CLI, which reads
+// its credentials from its environment.
+type route53 struct {
+	hostedZoneID string
+	aws          string
+}
+
+func newRoute53(options map[string]string) (Provider, error) {
+	if err := knownOptions(options, "hosted-zone-id", "aws"); err != nil {
+		return nil, err
+	}
+	if len(options["hosted-zone-id"]) == 0 {
+		return nil, fmt.Errorf("hosted-zone-id is required")
+	}
+	aws := options["aws"]
+	if len(aws) == 0 {
+		aws = "aws"
+	}
+	return route53{hostedZoneID: options["hosted-zone-id"], aws: aws}, nil
+}
+
+type route53ChangeBatch struct {
+	Comment string          `json:"Comment"`
+	Changes []route53Change `json:"Changes"`
+}
+
+type route53Change struct {
+	Action            string                   `json:"Action"`
+	ResourceRecordSet route53ResourceRecordSet `json:"ResourceRecordSet"`
+}
+
+type route53ResourceRecordSet struct {
+	Name            string                  `json:"Name"`
+	Type            string                  `json:"Type"`
+	TTL             int                     `json:"TTL"`
+	ResourceRecords []route53ResourceRecord `json:"ResourceRecords"`
+}
+
+type route53ResourceRecord struct {
+	Value string `json:"Value"`
+}
+
+// route53Changes returns the change batch that upserts the A and AAAA
+// records of the addresses.
+func route53Changes(r Record) (route53ChangeBatch, error) {
+	v4, v6, err := split(r.Addresses)
+	if err != nil {
+		return route53ChangeBatch{}, err
+	}
+	batch := route53ChangeBatch{Comment: fmt.Sprintf("API endpoint of cluster %s/%s", r.Namespace, r.Cluster)}
+	for _, records := range []struct {
+		recordType string
+		addresses  []string
+	}{{"A", v4}, {"AAAA", v6}} {
+		if len(records.addresses) == 0 {
+			continue
+		}
+		set := route53ResourceRecordSet{Name: r.Name + ".", Type: records.recordType, TTL: r.TTL}
+		for _, a := range records.addresses {
+			set.ResourceRecords = append(set.ResourceRecords, route53ResourceRecord{Value: a})
+		}
+		batch.Changes = append(batch.Changes, route53Change{Action: "UPSERT", ResourceRecordSet: set})
+	}
+	return batch, nil
+}
+
+func (p route53) Register(ctx context.Context, r Record) error {
+	batch, err := route53Changes(r)
+	if err != nil {
+		return err
+	}
+	batchJSON, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("unable to encode change batch: %v", err)
+	}
+	cmd := exec.CommandContext(ctx, p.aws, "route53", "change-resource-record-sets", "--hosted-zone-id", p.hostedZoneID, "--change-batch", string(batchJSON))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running %s route53 change-resource-record-sets: %v (output: %q)", p.aws, err, string(out))
+	}
+	return nil
+}
+
+// Environment variables of the infoblox credentials.
+const (
+	InfobloxUsernameEnv = "INFOBLOX_USERNAME"
+	InfobloxPasswordEnv = "INFOBLOX_PASSWORD"
+)
+
+// getenv is replaced in tests.
+var getenv = os.Getenv
+
+// infoblox replaces the A and AAAA records of the name through the WAPI of a
+// grid master.
+type infoblox struct {
+	wapi     string
+	view     string
+	username string
+	password string
+}
+
+func newInfoblox(options map[string]string) (Provider, error) {
+	if err := knownOptions(options, "wapi-url", "view"); err != nil {
+		return nil, err
+	}
+	if err := validateURL(options["wapi-url"]); err != nil {
+		return nil, fmt.Errorf("wapi-url: %v", err)
+	}
+	return infoblox{
+		wapi:     strings.TrimSuffix(options["wapi-url"], "/"),
+		view:     options["view"],
+		username: getenv(InfobloxUsernameEnv),
+		password: getenv(InfobloxPasswordEnv),
+	}, nil
+}
+
+type infobloxRecord struct {
+	Ref      string `json:"_ref,omitempty"`
+	Name     string `json:"name,omitempty"`
+	IPv4Addr string `json:"ipv4addr,omitempty"`
+	IPv6Addr string `json:"ipv6addr,omitempty"`
+	View     string `json:"view,omitempty"`
+	TTL      int    `json:"ttl,omitempty"`
+	UseTTL   bool   `json:"use_ttl,omitempty"`
+}
+
+func (p infoblox) Register(ctx context.Context, r Record) error {
+	v4, v6, err := split(r.Addresses)
+	if err != nil {
+		return err
+	}
+	for _, records := range []struct {
+		object    string
+		addresses []string
+		address   func(infobloxRecord) string
+		record    func(string) infobloxRecord
+	}{
+		{"record:a", v4, func(rec infobloxRecord) string { return rec.IPv4Addr }, func(a string) infobloxRecord { return infobloxRecord{IPv4Addr: a} }},
+		{"record:aaaa", v6, func(rec infobloxRecord) string { return rec.IPv6Addr }, func(a string) infobloxRecord { return infobloxRecord{IPv6Addr: a} }},
+	} {
+		query := url.Values{"name": {r.Name}}
+		if len(p.view) != 0 {
+			query.Set("view", p.view)
+		}
+		body, err := do(ctx, http.MethodGet, p.wapi+"/"+records.object+"?"+query.Encode(), p.username, p.password, nil)
+		if err != nil {
+			return err
+		}
+		var current []infobloxRecord
+		if err := json.Unmarshal(body, &current); err != nil {
+			return fmt.Errorf("unable to decode %s records of %q: %v", records.object, r.Name, err)
+		}
+		wanted := make(map[string]bool, len(records.addresses))
+		for _, a := range records.addresses {
+			wanted[a] = true
+		}
+		for _, rec := range current {
+			if wanted[records.address(rec)] {
+				delete(wanted, records.address(rec))
+				continue
+			}
+			if _, err := do(ctx, http.MethodDelete, p.wapi+"/"+rec.Ref, p.username, p.password, nil); err != nil {
+				return err
+			}
+		}
+		for _, a := range records.addresses {
+			if !wanted[a] {
+				continue
+			}
+			rec := records.record(a)
+			rec.Name, rec.View, rec.TTL, rec.UseTTL = r.Name, p.view, r.TTL, true
+			recJSON, err := json.Marshal(rec)
+			if err != nil {
+				return fmt.Errorf("unable to encode record: %v", err)
+			}
+			if _, err := do(ctx, http.MethodPost, p.wapi+"/"+records.object, p.username, p.password, recJSON); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func knownOptions(options map[string]string, known ...string) error {
+	for key := range options {
+		var ok bool
+		for _, k := range known {
+			ok = ok || key == k
+		}
+		if !ok {
+			return fmt.Errorf("unknown option %q, must be one of %s", key, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+func validateURL(s string) error {
+	if len(s) == 0 {
+		return fmt.Errorf("url is required")
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("unable to parse URL %q: %v", s, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("URL %q must be http or https", s)
+	}
+	return nil
+}
+
+func do(ctx context.Context, method, url, username, password string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if len(username) != 0 {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to %s %q: %v", strings.ToLower(method), url, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read response of %q: %v", url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%q responded %s: %q", url, resp.Status, string(respBody))
+	}
+	return respBody, nil
+}
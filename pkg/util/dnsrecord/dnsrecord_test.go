@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dnsrecord
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []Config{
+		{Provider: "bind", Name: "api.example.com"},
+		{Provider: "script", Name: "api.example.com"},
+		{Provider: "script", Name: "api_example", Options: map[string]string{"command": "true"}},
+		{Provider: "route53", Name: "api.example.com", Options: map[string]string{"zone": "Z1"}},
+		{Provider: "webhook", Name: "api.example.com", Options: map[string]string{"url": "ftp://dns.example.com"}},
+		{Provider: "script", Name: "api.example.com", TTL: -1, Options: map[string]string{"command": "true"}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+	for _, c := range []Config{
+		{Provider: "script", Name: "api.example.com.", Options: map[string]string{"command": "true"}},
+		{Provider: "webhook", Name: "api.example.com", Options: map[string]string{"url": "https://dns.example.com/records"}},
+		{Provider: "route53", Name: "api.example.com", Options: map[string]string{"hosted-zone-id": "Z1"}},
+		{Provider: "infoblox", Name: "api.example.com", Options: map[string]string{"wapi-url": "https://gm.example.com/wapi/v2.7"}},
+	} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("unexpected error for %+v: %v", c, err)
+		}
+	}
+	if _, err := ParseOptions([]string{"command"}); err == nil {
+		t.Errorf("expected error for an option without a value")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnsrecord")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "record.json")
+	c := Config{Provider: "script", Name: "api.example.com.", Options: map[string]string{"command": "cat > " + out}}
+	c, registered, err := Register(c, "cctl-cluster", "default", []string{"10.0.0.2", "10.0.0.1"}, false, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !registered {
+		t.Errorf("expected the record to be registered")
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("unable to read record given to command: %v", err)
+	}
+	var given Record
+	if err := json.Unmarshal(b, &given); err != nil {
+		t.Fatalf("unable to decode record given to command: %v", err)
+	}
+	expected := Record{Cluster: "cctl-cluster", Namespace: "default", Name: "api.example.com", Addresses: []string{"10.0.0.1", "10.0.0.2"}, TTL: DefaultTTL}
+	if diff := cmp.Diff(expected, given); diff != "" {
+		t.Errorf("unexpected record given to command (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(expected.Addresses, c.Addresses); diff != "" {
+		t.Errorf("unexpected recorded addresses (-want +got):\n%s", diff)
+	}
+	os.Remove(out)
+	if _, registered, err := Register(c, "cctl-cluster", "default", []string{"10.0.0.1", "10.0.0.2"}, false, 10*time.Second); err != nil || registered {
+		t.Errorf("expected the unchanged record not to be registered, got registered %t, error %v", registered, err)
+	}
+	if _, registered, err := Register(c, "cctl-cluster", "default", []string{"10.0.0.1", "10.0.0.2"}, true, 10*time.Second); err != nil || !registered {
+		t.Errorf("expected the forced record to be registered, got registered %t, error %v", registered, err)
+	}
+	if _, _, err := Register(c, "cctl-cluster", "default", nil, false, 10*time.Second); err == nil {
+		t.Errorf("expected error for a record without addresses")
+	}
+	c.Options["command"] = "exit 1"
+	if _, _, err := Register(c, "cctl-cluster", "default", []string{"10.0.0.3"}, false, 10*time.Second); err == nil {
+		t.Errorf("expected error for failed command")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var posted Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	c := Config{Provider: "webhook", Name: "api.example.com", TTL: 30, Options: map[string]string{"url": server.URL}}
+	if _, _, err := Register(c, "cctl-cluster", "default", []string{"10.0.0.100"}, false, 10*time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Record{Cluster: "cctl-cluster", Namespace: "default", Name: "api.example.com", Addresses: []string{"10.0.0.100"}, TTL: 30}
+	if diff := cmp.Diff(expected, posted); diff != "" {
+		t.Errorf("unexpected posted record (-want +got):\n%s", diff)
+	}
+}
+
+func TestRoute53Changes(t *testing.T) {
+	batch, err := route53Changes(Record{Cluster: "cctl-cluster", Namespace: "default", Name: "api.example.com", Addresses: []string{"10.0.0.100", "fd00::100"}, TTL: 60})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := route53ChangeBatch{
+		Comment: "API endpoint of cluster default/cctl-cluster",
+		Changes: []route53Change{
+			{Action: "UPSERT", ResourceRecordSet: route53ResourceRecordSet{Name: "api.example.com.", Type: "A", TTL: 60, ResourceRecords: []route53ResourceRecord{{Value: "10.0.0.100"}}}},
+			{Action: "UPSERT", ResourceRecordSet: route53ResourceRecordSet{Name: "api.example.com.", Type: "AAAA", TTL: 60, ResourceRecords: []route53ResourceRecord{{Value: "fd00::100"}}}},
+		},
+	}
+	if diff := cmp.Diff(expected, batch); diff != "" {
+		t.Errorf("unexpected change batch (-want +got):\n%s", diff)
+	}
+	if _, err := route53Changes(Record{Name: "api.example.com", Addresses: []string{"api.example.com"}}); err == nil {
+		t.Errorf("expected error for an address that is not an IP")
+	}
+}
+
+func TestInfoblox(t *testing.T) {
+	getenv = func(key string) string {
+		return map[string]string{InfobloxUsernameEnv: "admin", InfobloxPasswordEnv: "secret"}[key]
+	}
+	defer func() { getenv = os.Getenv }()
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if username, password, ok := r.BasicAuth(); !ok || username != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+		if r.Method == http.MethodGet && r.URL.Path == "/wapi/v2.7/record:a" {
+			w.Write([]byte(`[{"_ref":"record:a/old:api.example.com/default","ipv4addr":"10.0.0.1"},{"_ref":"record:a/kept:api.example.com/default","ipv4addr":"10.0.0.100"}]`))
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+	p, err := newInfoblox(map[string]string{"wapi-url": server.URL + "/wapi/v2.7/", "view": "default"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := p.Register(context.Background(), Record{Name: "api.example.com", Addresses: []string{"10.0.0.100", "10.0.0.101"}, TTL: 60}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"GET /wapi/v2.7/record:a?name=api.example.com&view=default",
+		"DELETE /wapi/v2.7/record:a/old:api.example.com/default",
+		`POST /wapi/v2.7/record:a {"name":"api.example.com","ipv4addr":"10.0.0.101","view":"default","ttl":60,"use_ttl":true}`,
+		"GET /wapi/v2.7/record:aaaa?name=api.example.com&view=default",
+	}
+	if diff := cmp.Diff(expected, requests); diff != "" {
+		t.Errorf("unexpected requests (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package doctor reports whether the local environment of the operator is
+// ready for cctl to change the cluster.
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// Statuses of the results of checks.
+const (
+	StatusOK      = "ok"
+	StatusWarning = "warning"
+	StatusFailed  = "failed"
+	// StatusSkipped means the check could not run, because a check it
+	// depends on failed.
+	StatusSkipped = "skipped"
+)
+
+// Result is the outcome of a check of the local environment.
+type Result struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// Remediation describes how to fix a warning or failure.
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// OK returns a passed result.
+func OK(check, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusOK, Message: fmt.Sprintf(format, args...)}
+}
+
+// Warning returns a result that does not stop risky operations.
+func Warning(check, remediation, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusWarning, Message: fmt.Sprintf(format, args...), Remediation: remediation}
+}
+
+// Failed returns a result that stops risky operations.
+func Failed(check, remediation, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf(format, args...), Remediation: remediation}
+}
+
+// Skipped returns the result of a check that could not run.
+func Skipped(check, format string, args ...interface{}) Result {
+	return Result{Check: check, Status: StatusSkipped, Message: fmt.Sprintf(format, args...)}
+}
+
+// Go returns true if no check failed.
+func Go(results []Result) bool {
+	for _, r := range results {
+		if r.Status == StatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// PrivateFileMode returns an error if the mode of a file that holds private
+// keys lets users other than its owner read or write it, as ssh requires of
+// private keys.
+func PrivateFileMode(mode os.FileMode) error {
+	if perm := mode.Perm(); perm&0077 != 0 {
+		return fmt.Errorf("mode %04o lets other users access it; it must be at most 0600", perm)
+	}
+	return nil
+}
+
+// KubernetesVersionSupported returns an error if the Kubernetes version is
+// older than the minimum, or newer, by minor version, than the newest
+// version cctl supports.
+func KubernetesVersionSupported(version, minimum, newest string) error {
+	v, err := parseVersion(version)
+	if err != nil {
+		return err
+	}
+	min, err := parseVersion(minimum)
+	if err != nil {
+		return err
+	}
+	max, err := parseVersion(newest)
+	if err != nil {
+		return err
+	}
+	if v.LessThan(*min) {
+		return fmt.Errorf("Kubernetes %s is older than %s, the oldest version cctl supports", v, min)
+	}
+	if v.Major > max.Major || (v.Major == max.Major && v.Minor > max.Minor) {
+		return fmt.Errorf("Kubernetes %s is newer than %d.%d, the newest minor version cctl supports", v, max.Major, max.Minor)
+	}
+	return nil
+}
+
+func parseVersion(version string) (*semver.Version, error) {
+	v, err := semver.NewVersion(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse version %q: %v", version, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package doctor
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGo(t *testing.T) {
+	results := []Result{
+		OK("state-file", "readable"),
+		Warning("state-lock", "remove the lock file", "stale"),
+		Skipped("master-connectivity", "no masters"),
+	}
+	if !Go(results) {
+		t.Errorf("expected go without failures")
+	}
+	results = append(results, Failed("state-migration", "run cctl migrate", "state file version is 1"))
+	if Go(results) {
+		t.Errorf("expected no-go with a failure")
+	}
+}
+
+func TestPrivateFileMode(t *testing.T) {
+	for _, mode := range []os.FileMode{0600, 0400, 0700} {
+		if err := PrivateFileMode(mode); err != nil {
+			t.Errorf("unexpected error for mode %04o: %v", mode, err)
+		}
+	}
+	for _, mode := range []os.FileMode{0644, 0640, 0606, 0777} {
+		if err := PrivateFileMode(mode); err == nil {
+			t.Errorf("expected error for mode %04o", mode)
+		}
+	}
+}
+
+func TestKubernetesVersionSupported(t *testing.T) {
+	for _, version := range []string{"1.11.0", "v1.12.8", "1.12.10"} {
+		if err := KubernetesVersionSupported(version, "v1.11.0", "1.12.8"); err != nil {
+			t.Errorf("unexpected error for version %q: %v", version, err)
+		}
+	}
+	for _, version := range []string{"1.10.13", "1.13.0", "2.0.0", "latest"} {
+		if err := KubernetesVersionSupported(version, "v1.11.0", "1.12.8"); err == nil {
+			t.Errorf("expected error for version %q", version)
+		}
+	}
+}
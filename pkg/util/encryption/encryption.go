@@ -0,0 +1,190 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryption configures the encryption of secrets at rest by the API
+// server.
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ghodss/yaml"
+
+	"github.com/platform9/cctl/pkg/util/staticpod"
+)
+
+const (
+	// ConfigDir is the directory of the encryption configuration on masters.
+	ConfigDir = "/etc/kubernetes/encryption"
+
+	volume = "encryption-config"
+	// keySize is the size of AES-256 keys.
+	keySize = 32
+)
+
+// ConfigFile is the path of the encryption configuration on masters.
+var ConfigFile = path.Join(ConfigDir, "config.yaml")
+
+// configVersion is the first Kubernetes version that reads the
+// EncryptionConfiguration kind, and the --encryption-provider-config flag.
+var configVersion = semver.New("1.13.0")
+
+// flagPrefixes are the flags of the encryption configuration of all the
+// supported versions.
+var flagPrefixes = []string{"--encryption-provider-config=", "--experimental-encryption-provider-config="}
+
+// Key is an aescbc key.
+type Key struct {
+	// Name identifies the key. Keys are named by the time they are created,
+	// so that the newer of two keys has the greater name.
+	Name string `json:"name"`
+	// Secret is the base64 encoded key.
+	Secret string `json:"secret"`
+}
+
+// NewKey returns a random AES-256 key, named by the time.
+func NewKey(now time.Time) (Key, error) {
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, fmt.Errorf("unable to generate key: %v", err)
+	}
+	return Key{
+		Name:   "key-" + now.UTC().Format("20060102150405.000000000"),
+		Secret: base64.StdEncoding.EncodeToString(b),
+	}, nil
+}
+
+// EncodeKeys returns the keys as JSON, to be kept in the state.
+func EncodeKeys(keys []Key) ([]byte, error) {
+	return json.Marshal(keys)
+}
+
+// DecodeKeys returns the keys kept in the state, and validates them.
+func DecodeKeys(data []byte) ([]Key, error) {
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("unable to decode keys: %v", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys")
+	}
+	for _, k := range keys {
+		b, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not base64 encoded: %v", k.Name, err)
+		}
+		if len(b) != keySize {
+			return nil, fmt.Errorf("key %q is %d bytes, must be %d", k.Name, len(b), keySize)
+		}
+	}
+	return keys, nil
+}
+
+type config struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Resources  []resource `json:"resources"`
+}
+
+type resource struct {
+	Resources []string   `json:"resources"`
+	Providers []provider `json:"providers"`
+}
+
+type provider struct {
+	AESCBC   *aescbc   `json:"aescbc,omitempty"`
+	Identity *struct{} `json:"identity,omitempty"`
+}
+
+type aescbc struct {
+	Keys []Key `json:"keys"`
+}
+
+// Config returns the encryption configuration, in the kind read by the API
+// server version, that encrypts secrets with the first key. Secrets are
+// decrypted with any of the keys, and secrets not yet encrypted are read as
+// they are.
+func Config(keys []Key, version *semver.Version) ([]byte, error) {
+	c := config{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "EncryptionConfiguration",
+		Resources: []resource{
+			{
+				Resources: []string{"secrets"},
+				Providers: []provider{
+					{AESCBC: &aescbc{Keys: keys}},
+					{Identity: &struct{}{}},
+				},
+			},
+		},
+	}
+	if version.LessThan(*configVersion) {
+		c.APIVersion = "v1"
+		c.Kind = "EncryptionConfig"
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode encryption configuration: %v", err)
+	}
+	return b, nil
+}
+
+// ConfigureManifest returns the static pod manifest of the API server with
+// the encryption configuration, mounted from the host, given to the flag read
+// by the API server version. It returns false if the manifest already has the
+// configuration.
+func ConfigureManifest(manifest []byte, version *semver.Version) ([]byte, bool, error) {
+	flag := "encryption-provider-config"
+	if version.LessThan(*configVersion) {
+		flag = "experimental-encryption-provider-config"
+	}
+	return staticpod.Configure(manifest, "kube-apiserver", flagPrefixes, map[string]string{flag: ConfigFile}, []staticpod.Mount{
+		{Name: volume, Path: ConfigDir, ReadOnly: true},
+	})
+}
+
+// Rotation is a step of the rotation of the encryption key.
+type Rotation int
+
+const (
+	// RotationNone means a single key is used.
+	RotationNone Rotation = iota
+	// RotationNewKeyAdded means the new key was added, as the second key, so
+	// that every API server can decrypt secrets encrypted with it before any
+	// API server encrypts with it.
+	RotationNewKeyAdded
+	// RotationNewKeyFirst means the new key encrypts secrets, and the old key
+	// still decrypts them until they are re-encrypted.
+	RotationNewKeyFirst
+)
+
+// RotationOf returns the step of the rotation that the keys are at.
+func RotationOf(keys []Key) Rotation {
+	switch {
+	case len(keys) < 2:
+		return RotationNone
+	case keys[1].Name > keys[0].Name:
+		return RotationNewKeyAdded
+	default:
+		return RotationNewKeyFirst
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const apiServerManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - command:
+    - kube-apiserver
+    - --experimental-encryption-provider-config=/etc/old.yaml
+    image: k8s.gcr.io/kube-apiserver:v1.12.8
+    name: kube-apiserver
+`
+
+func TestKeys(t *testing.T) {
+	now := time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)
+	old, err := NewKey(now)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	newKey, err := NewKey(now.Add(time.Millisecond))
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	if old.Secret == newKey.Secret {
+		t.Errorf("expected random keys")
+	}
+	b, err := EncodeKeys([]Key{old, newKey})
+	if err != nil {
+		t.Fatalf("unable to encode keys: %v", err)
+	}
+	keys, err := DecodeKeys(b)
+	if err != nil {
+		t.Fatalf("unable to decode keys: %v", err)
+	}
+	if diff := cmp.Diff([]Key{old, newKey}, keys); diff != "" {
+		t.Errorf("unexpected keys (-expected +found):\n%s", diff)
+	}
+	if _, err := DecodeKeys([]byte(`[{"name":"a","secret":"c2hvcnQ="}]`)); err == nil {
+		t.Errorf("expected an error for a short key")
+	}
+
+	for _, tc := range []struct {
+		keys     []Key
+		expected Rotation
+	}{
+		{[]Key{old}, RotationNone},
+		{[]Key{old, newKey}, RotationNewKeyAdded},
+		{[]Key{newKey, old}, RotationNewKeyFirst},
+	} {
+		if r := RotationOf(tc.keys); r != tc.expected {
+			t.Errorf("expected rotation %v, found %v", tc.expected, r)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	keys := []Key{{Name: "key-1", Secret: "secret"}}
+	for version, expected := range map[string]string{
+		"1.12.8": "kind: EncryptionConfig\n",
+		"1.13.0": "kind: EncryptionConfiguration\n",
+	} {
+		b, err := Config(keys, semver.New(version))
+		if err != nil {
+			t.Fatalf("unable to create config: %v", err)
+		}
+		if !strings.Contains(string(b), expected) || !strings.Contains(string(b), "- identity: {}") {
+			t.Errorf("unexpected config for version %s:\n%s", version, b)
+		}
+	}
+}
+
+func TestConfigureManifest(t *testing.T) {
+	configured, changed, err := ConfigureManifest([]byte(apiServerManifest), semver.New("1.13.0"))
+	if err != nil || !changed {
+		t.Fatalf("expected manifest to change (%v)", err)
+	}
+	pod := corev1.Pod{}
+	if err := yaml.Unmarshal(configured, &pod); err != nil {
+		t.Fatalf("unable to decode configured manifest: %v", err)
+	}
+	c := pod.Spec.Containers[0]
+	expected := []string{"kube-apiserver", "--encryption-provider-config=/etc/kubernetes/encryption/config.yaml"}
+	if diff := cmp.Diff(expected, c.Command); diff != "" {
+		t.Errorf("unexpected command (-expected +found):\n%s", diff)
+	}
+	if len(c.VolumeMounts) != 1 || !c.VolumeMounts[0].ReadOnly || len(pod.Spec.Volumes) != 1 {
+		t.Errorf("expected the configuration to be mounted read-only, found %v and %v", pod.Spec.Volumes, c.VolumeMounts)
+	}
+	if _, changed, err := ConfigureManifest(configured, semver.New("1.13.0")); err != nil || changed {
+		t.Errorf("expected configured manifest not to change (%v)", err)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// EndpointHealth is the health of the endpoints of an etcd cluster.
+type EndpointHealth struct {
+	Healthy   []string
+	Unhealthy []string
+}
+
+// ParseEndpointHealth parses the output of `etcdctl endpoint health`. The
+// command writes healthy endpoints to stdout and unhealthy endpoints to
+// stderr, so the caller should pass both.
+func ParseEndpointHealth(out []byte) EndpointHealth {
+	var h EndpointHealth
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "is" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(fields[2], "healthy"):
+			h.Healthy = append(h.Healthy, fields[0])
+		case strings.HasPrefix(fields[2], "unhealthy"):
+			h.Unhealthy = append(h.Unhealthy, fields[0])
+		}
+	}
+	return h
+}
+
+// Quorum returns the number of members that must be healthy for a cluster of
+// the given size to make progress.
+func Quorum(members int) int {
+	return members/2 + 1
+}
+
+// SafeToRemoveMember returns true if the cluster keeps quorum after the
+// member with the client URLs is removed. An unhealthy member does not count
+// toward quorum before it is removed, so removing it is safe if the healthy
+// members are a quorum of the remaining members. A member that is not
+// reported is assumed to be healthy.
+func (h EndpointHealth) SafeToRemoveMember(clientURLs []string) bool {
+	members := len(h.Healthy) + len(h.Unhealthy)
+	if members <= 1 {
+		// Removing the last member is the same as deleting the cluster.
+		return true
+	}
+	healthy := len(h.Healthy)
+	if !containsAny(h.Unhealthy, clientURLs) {
+		healthy--
+	}
+	return healthy >= Quorum(members-1)
+}
+
+func containsAny(endpoints, urls []string) bool {
+	for _, e := range endpoints {
+		for _, u := range urls {
+			if strings.TrimSuffix(e, "/") == strings.TrimSuffix(u, "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
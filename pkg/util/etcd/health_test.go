@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/platform9/cctl/pkg/util/etcd"
+)
+
+func TestParseEndpointHealth(t *testing.T) {
+	out := []byte(`https://10.0.0.1:2379 is healthy: successfully committed proposal: took = 1.9ms
+https://10.0.0.2:2379 is healthy: successfully committed proposal: took = 2.1ms
+https://10.0.0.3:2379 is unhealthy: failed to connect: context deadline exceeded
+Error: unhealthy cluster
+`)
+	expected := etcd.EndpointHealth{
+		Healthy:   []string{"https://10.0.0.1:2379", "https://10.0.0.2:2379"},
+		Unhealthy: []string{"https://10.0.0.3:2379"},
+	}
+	actual := etcd.ParseEndpointHealth(out)
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+}
+
+func TestSafeToRemoveMember(t *testing.T) {
+	tcs := []struct {
+		name      string
+		healthy   int
+		unhealthy int
+		// targetUnhealthy means the removed member is one of the unhealthy
+		// members; otherwise, it is one of the healthy members.
+		targetUnhealthy bool
+		expected        bool
+	}{
+		{"last member", 1, 0, false, true},
+		{"three healthy", 3, 0, false, true},
+		{"two healthy of three", 2, 1, false, false},
+		{"three healthy of four", 3, 1, false, true},
+		{"one healthy of three", 1, 2, false, false},
+		{"two healthy of two", 2, 0, false, true},
+		{"three healthy of five", 3, 2, false, false},
+		{"unhealthy of three, two healthy", 2, 1, true, true},
+		{"unhealthy of three, one healthy", 1, 2, true, false},
+		{"unhealthy of five, three healthy", 3, 2, true, true},
+		{"unhealthy of two", 1, 1, true, true},
+		{"last member, unhealthy", 0, 1, true, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var h etcd.EndpointHealth
+			for i := 0; i < tc.healthy; i++ {
+				h.Healthy = append(h.Healthy, fmt.Sprintf("https://10.0.0.%d:2379", i+1))
+			}
+			for i := 0; i < tc.unhealthy; i++ {
+				h.Unhealthy = append(h.Unhealthy, fmt.Sprintf("https://10.0.1.%d:2379", i+1))
+			}
+			target := []string{"https://10.0.0.1:2379"}
+			if tc.targetUnhealthy {
+				target = []string{"https://10.0.1.1:2379/"}
+			}
+			if actual := h.SafeToRemoveMember(target); actual != tc.expected {
+				t.Fatalf("expected %v, found %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSafeToRemoveMemberNotReported(t *testing.T) {
+	h := etcd.EndpointHealth{
+		Healthy:   []string{"https://10.0.0.1:2379", "https://10.0.0.2:2379"},
+		Unhealthy: []string{"https://10.0.0.3:2379"},
+	}
+	// A member that is not reported is assumed to be healthy.
+	if h.SafeToRemoveMember([]string{"https://10.0.0.4:2379"}) {
+		t.Fatalf("expected removal of a member that is not reported to be unsafe")
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/etcd"
+)
+
+func TestParseMemberList(t *testing.T) {
+	out := []byte(`{"header":{"cluster_id":17237436991929493444,"member_id":9372538179322589801,"raft_term":2},"members":[{"ID":9372538179322589801,"name":"10.0.0.1","peerURLs":["https://10.0.0.1:2380"],"clientURLs":["https://10.0.0.1:2379"]}]}`)
+	expected := []spv1.EtcdMember{
+		{ID: 9372538179322589801, Name: "10.0.0.1", PeerURLs: []string{"https://10.0.0.1:2380"}, ClientURLs: []string{"https://10.0.0.1:2379"}},
+	}
+	actual, err := etcd.ParseMemberList(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+	if _, err := etcd.ParseMemberList([]byte("Error: context deadline exceeded")); err == nil {
+		t.Errorf("expected error parsing invalid output")
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EndpointStatus is the status of an etcd endpoint.
+type EndpointStatus struct {
+	Endpoint string
+	DBSize   int64
+	Leader   bool
+	// Version is the version of etcd serving the endpoint.
+	Version string
+}
+
+// endpointStatusJSON is an element of the output of
+// `etcdctl endpoint status -w json`.
+type endpointStatusJSON struct {
+	Endpoint string `json:"Endpoint"`
+	Status   struct {
+		Header struct {
+			MemberID uint64 `json:"member_id"`
+		} `json:"header"`
+		Version string `json:"version"`
+		DBSize  int64  `json:"dbSize"`
+		Leader  uint64 `json:"leader"`
+	} `json:"Status"`
+}
+
+// ParseEndpointStatus parses the output of `etcdctl endpoint status -w json`.
+func ParseEndpointStatus(out []byte) ([]EndpointStatus, error) {
+	var raw []endpointStatusJSON
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("unable to parse endpoint status: %v", err)
+	}
+	statuses := make([]EndpointStatus, len(raw))
+	for i, r := range raw {
+		statuses[i] = EndpointStatus{
+			Endpoint: r.Endpoint,
+			DBSize:   r.Status.DBSize,
+			Leader:   r.Status.Leader != 0 && r.Status.Leader == r.Status.Header.MemberID,
+			Version:  r.Status.Version,
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcd_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/platform9/cctl/pkg/util/etcd"
+)
+
+func TestParseEndpointStatus(t *testing.T) {
+	out := []byte(`[{"Endpoint":"https://10.0.0.1:2379","Status":{"header":{"cluster_id":17237436991929493444,"member_id":9372538179322589801,"revision":1020,"raft_term":2},"version":"3.3.10","dbSize":24576000,"leader":9372538179322589801,"raftIndex":1050,"raftTerm":2}}]`)
+	expected := []etcd.EndpointStatus{
+		{Endpoint: "https://10.0.0.1:2379", DBSize: 24576000, Leader: true, Version: "3.3.10"},
+	}
+	actual, err := etcd.ParseEndpointStatus(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+	if _, err := etcd.ParseEndpointStatus([]byte("Error: context deadline exceeded")); err == nil {
+		t.Errorf("expected error parsing invalid output")
+	}
+}
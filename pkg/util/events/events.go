@@ -0,0 +1,173 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events streams the progress of an operation on machines as JSON
+// Lines, one event per line, as it happens.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	OperationStarted   = "OperationStarted"
+	OperationCompleted = "OperationCompleted"
+	OperationFailed    = "OperationFailed"
+	PhaseStarted       = "PhaseStarted"
+	PhaseCompleted     = "PhaseCompleted"
+	PhaseFailed        = "PhaseFailed"
+)
+
+// Event is a change in the progress of an operation.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Operation string    `json:"operation"`
+	Machines  []string  `json:"machines"`
+	Phase     string    `json:"phase,omitempty"`
+	// DurationSeconds is the duration of the phase or operation, for events
+	// that end one.
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// Stream writes the events of an operation. Phases are the progress messages
+// of the operation; each lasts until the next one starts.
+type Stream struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+	err error
+
+	operation    string
+	machines     []string
+	started      time.Time
+	phase        string
+	phaseStarted time.Time
+	phaseError   string
+	failed       string
+}
+
+// New starts the stream of an operation on the machines, and writes the
+// OperationStarted event.
+func New(w io.Writer, operation string, machines []string) *Stream {
+	return newWithClock(w, operation, machines, time.Now)
+}
+
+func newWithClock(w io.Writer, operation string, machines []string, now func() time.Time) *Stream {
+	s := &Stream{
+		w:         w,
+		now:       now,
+		operation: operation,
+		machines:  machines,
+		started:   now().UTC(),
+	}
+	s.emit(Event{Time: s.started, Type: OperationStarted})
+	return s
+}
+
+// StartPhase ends the current phase, and starts a new one.
+func (s *Stream) StartPhase(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now().UTC()
+	s.endPhase(now)
+	s.phase = name
+	s.phaseStarted = now
+	s.emit(Event{Time: now, Type: PhaseStarted, Phase: name})
+}
+
+// Fail records the error in the current phase, which fails when it ends. The
+// operation fails with the last error recorded.
+func (s *Stream) Fail(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phaseError = message
+	s.failed = message
+}
+
+// Finish ends the current phase and the operation. The operation succeeded if
+// err is nil and no error was recorded.
+func (s *Stream) Finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed = err.Error()
+		if len(s.phaseError) == 0 {
+			s.phaseError = s.failed
+		}
+	}
+	now := s.now().UTC()
+	s.endPhase(now)
+	e := Event{
+		Time:            now,
+		Type:            OperationCompleted,
+		DurationSeconds: now.Sub(s.started).Seconds(),
+	}
+	if len(s.failed) != 0 {
+		e.Type = OperationFailed
+		e.Error = s.failed
+	}
+	s.emit(e)
+}
+
+// Err returns the first error writing an event, if any.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Stream) endPhase(now time.Time) {
+	if len(s.phase) == 0 {
+		return
+	}
+	e := Event{
+		Time:            now,
+		Type:            PhaseCompleted,
+		Phase:           s.phase,
+		DurationSeconds: now.Sub(s.phaseStarted).Seconds(),
+	}
+	if len(s.phaseError) != 0 {
+		e.Type = PhaseFailed
+		e.Error = s.phaseError
+	}
+	s.emit(e)
+	s.phase = ""
+	s.phaseError = ""
+}
+
+// emit writes the event as one line. The stream stops at the first error.
+func (s *Stream) emit(e Event) {
+	if s.err != nil {
+		return
+	}
+	e.Operation = s.operation
+	e.Machines = s.machines
+	b, err := json.Marshal(e)
+	if err != nil {
+		s.err = fmt.Errorf("unable to marshal event: %v", err)
+		return
+	}
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		s.err = fmt.Errorf("unable to write event: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock advances by one second every time it is read.
+func fakeClock() func() time.Time {
+	t := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	}
+}
+
+func decode(t *testing.T, b []byte) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("unable to decode line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestStream(t *testing.T) {
+	var buf bytes.Buffer
+	s := newWithClock(&buf, "create machine", []string{"10.0.0.1"}, fakeClock())
+	s.StartPhase("Fetching bootstrap token")
+	s.StartPhase("Creating machine")
+	s.Fail("Unable to create machine")
+	s.Finish(nil)
+	if err := s.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := decode(t, buf.Bytes())
+	types := []string{OperationStarted, PhaseStarted, PhaseCompleted, PhaseStarted, PhaseFailed, OperationFailed}
+	if len(events) != len(types) {
+		t.Fatalf("expected %d events, found %d: %s", len(types), len(events), buf.String())
+	}
+	for i, e := range events {
+		if e.Type != types[i] {
+			t.Errorf("event %d: expected type %q, found %q", i, types[i], e.Type)
+		}
+		if e.Operation != "create machine" || len(e.Machines) != 1 {
+			t.Errorf("event %d: unexpected operation %q or machines %v", i, e.Operation, e.Machines)
+		}
+	}
+	if events[2].Phase != "Fetching bootstrap token" || events[2].DurationSeconds != 1 {
+		t.Errorf("unexpected completed phase %+v", events[2])
+	}
+	if events[4].Error != "Unable to create machine" {
+		t.Errorf("unexpected failed phase %+v", events[4])
+	}
+	if events[5].Error != "Unable to create machine" || events[5].DurationSeconds != 3 {
+		t.Errorf("unexpected failed operation %+v", events[5])
+	}
+}
+
+func TestStreamFinishWithError(t *testing.T) {
+	var buf bytes.Buffer
+	s := newWithClock(&buf, "delete machine", []string{"10.0.0.1"}, fakeClock())
+	s.StartPhase("Draining node")
+	s.Finish(errors.New("drain timed out"))
+
+	events := decode(t, buf.Bytes())
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, found %d: %s", len(events), buf.String())
+	}
+	if events[2].Type != PhaseFailed || events[2].Error != "drain timed out" {
+		t.Errorf("unexpected phase event %+v", events[2])
+	}
+	if events[3].Type != OperationFailed {
+		t.Errorf("unexpected operation event %+v", events[3])
+	}
+}
+
+func TestStreamSucceeds(t *testing.T) {
+	var buf bytes.Buffer
+	s := newWithClock(&buf, "upgrade machine", []string{"10.0.0.1"}, fakeClock())
+	s.Finish(nil)
+
+	events := decode(t, buf.Bytes())
+	if len(events) != 2 || events[1].Type != OperationCompleted || len(events[1].Error) != 0 {
+		t.Errorf("unexpected events %s", buf.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestStreamWriteError(t *testing.T) {
+	s := New(failingWriter{}, "create machine", nil)
+	s.StartPhase("Creating machine")
+	if s.Err() == nil {
+		t.Errorf("expected an error")
+	}
+}
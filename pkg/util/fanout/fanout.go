@@ -0,0 +1,141 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fanout runs a command on many machines in parallel, and aggregates
+// the output of each machine.
+package fanout
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of the command on a machine.
+type Result struct {
+	Host            string  `json:"host"`
+	StdOut          string  `json:"stdout"`
+	StdErr          string  `json:"stderr"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// Succeeded returns true if the command succeeded.
+func (r Result) Succeeded() bool {
+	return len(r.Error) == 0
+}
+
+// RunFunc runs the command on the host, and returns its stdout and stderr.
+type RunFunc func(host string) (stdOut, stdErr []byte, err error)
+
+// Run runs the command on the hosts, at most concurrency at a time, and
+// returns the results in the order of the hosts.
+func Run(hosts []string, concurrency int, run RunFunc) []Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]Result, len(hosts))
+	var wg sync.WaitGroup
+	work := make(chan int)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				started := time.Now()
+				stdOut, stdErr, err := run(hosts[j])
+				r := Result{
+					Host:            hosts[j],
+					StdOut:          string(stdOut),
+					StdErr:          string(stdErr),
+					DurationSeconds: time.Since(started).Seconds(),
+				}
+				if err != nil {
+					r.Error = err.Error()
+				}
+				results[j] = r
+			}
+		}()
+	}
+	for j := range hosts {
+		work <- j
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// Failed returns the number of results whose command failed.
+func Failed(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if !r.Succeeded() {
+			n++
+		}
+	}
+	return n
+}
+
+// Print writes the output of each machine under a header with its host, and
+// the error, if the command failed.
+func Print(w io.Writer, results []Result) error {
+	for i, r := range results {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		status := "ok"
+		if !r.Succeeded() {
+			status = "failed: " + r.Error
+		}
+		if _, err := fmt.Fprintf(w, "==> %s (%s) <==\n", r.Host, status); err != nil {
+			return err
+		}
+		if err := printStream(w, "", r.StdOut); err != nil {
+			return err
+		}
+		if err := printStream(w, "stderr: ", r.StdErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printStream(w io.Writer, prefix, s string) error {
+	if len(s) == 0 {
+		return nil
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if _, err := fmt.Fprintf(w, "%s%s\n", prefix, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShellCommand returns a command that runs the arguments in sh, so that the
+// whole command, including pipes and redirections, runs with the privileges
+// of the machine client.
+func ShellCommand(args []string) string {
+	return "sh -c " + shellQuote(strings.Join(args, " "))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
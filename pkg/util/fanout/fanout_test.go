@@ -0,0 +1,93 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fanout
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	hosts := []string{"10.0.0.3", "10.0.0.1", "10.0.0.2"}
+	var running, maxRunning int32
+	results := Run(hosts, 2, func(host string) ([]byte, []byte, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		if host == "10.0.0.1" {
+			return nil, []byte("kubelet: not found\n"), fmt.Errorf("exit status 127")
+		}
+		return []byte("v1.12.8\n"), nil, nil
+	})
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent runs, found %d", maxRunning)
+	}
+	for i, r := range results {
+		if r.Host != hosts[i] {
+			t.Errorf("result %d: expected host %q, found %q", i, hosts[i], r.Host)
+		}
+	}
+	if Failed(results) != 1 || results[1].Succeeded() {
+		t.Errorf("expected only the second host to fail: %+v", results)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	results := []Result{
+		{Host: "10.0.0.1", StdOut: "v1.12.8\n"},
+		{Host: "10.0.0.2", StdOut: "partial\n", StdErr: "line 1\nline 2\n", Error: "exit status 1"},
+	}
+	var buf bytes.Buffer
+	if err := Print(&buf, results); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `==> 10.0.0.1 (ok) <==
+v1.12.8
+
+==> 10.0.0.2 (failed: exit status 1) <==
+partial
+stderr: line 1
+stderr: line 2
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\nfound:\n%s", expected, buf.String())
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"kubelet", "--version"}, `sh -c 'kubelet --version'`},
+		{[]string{"echo 'hi' | wc -c"}, `sh -c 'echo '\''hi'\'' | wc -c'`},
+	}
+	for _, c := range cases {
+		if actual := ShellCommand(c.args); actual != c.expected {
+			t.Errorf("expected %q, found %q", c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package filelock implements an advisory lock, held by creating a lock file,
+// that prevents concurrent cctl invocations from changing the same state file.
+package filelock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+// breakerSuffix is appended to the lock file to name the file that is held
+// while a stale lock is removed.
+const breakerSuffix = ".break"
+
+// PollInterval is how often a held lock is checked while waiting for it.
+var PollInterval = 500 * time.Millisecond
+
+// ErrReadOnly is returned when the lock file cannot be created because the
+// file system is read-only.
+var ErrReadOnly = errors.New("lock file cannot be created on a read-only file system")
+
+// Holder identifies the process holding the lock.
+type Holder struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Acquired time.Time `json:"acquired"`
+}
+
+func (h Holder) String() string {
+	return fmt.Sprintf("process %d on host %q since %s", h.PID, h.Hostname, h.Acquired.Format(time.RFC3339))
+}
+
+// lockedError is returned when the lock is held by another process.
+type lockedError struct {
+	path   string
+	holder Holder
+}
+
+func (e *lockedError) Error() string {
+	return fmt.Sprintf("lock file %q is held by %s. If that process is no longer running, remove the lock file", e.path, e.holder)
+}
+
+// IsLocked returns true if the error was returned because the lock is held by
+// another process.
+func IsLocked(err error) bool {
+	_, ok := err.(*lockedError)
+	return ok
+}
+
+// Lock is an acquired lock.
+type Lock struct {
+	path   string
+	holder Holder
+}
+
+// Acquire creates the lock file. If the lock is held by another process, it is
+// retried until the timeout expires. A lock whose holder is a process on this
+// host that no longer exists is stale, and is removed.
+func Acquire(path string, timeout time.Duration) (*Lock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hostname: %v", err)
+	}
+	l := &Lock{
+		path: path,
+		holder: Holder{
+			PID:      os.Getpid(),
+			Hostname: hostname,
+		},
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		l.holder.Acquired = time.Now().UTC()
+		err := l.create()
+		if err == nil {
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			if isReadOnly(err) {
+				return nil, ErrReadOnly
+			}
+			return nil, fmt.Errorf("unable to create lock file %q: %v", path, err)
+		}
+		holder, err := readHolder(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Released since it was checked.
+				continue
+			}
+			return nil, fmt.Errorf("unable to read lock file %q: %v", path, err)
+		}
+		if holder.isStale(hostname) {
+			if err := removeStale(path, holder); err != nil {
+				return nil, fmt.Errorf("unable to remove stale lock file %q held by %s: %v", path, holder, err)
+			}
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, &lockedError{path: path, holder: holder}
+		}
+		time.Sleep(PollInterval)
+	}
+}
+
+// Check returns the holder of the lock, without acquiring it, or nil if the
+// lock is not held. It returns true if the holder is stale, so that the next
+// Acquire removes the lock.
+func Check(path string) (*Holder, bool, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to get hostname: %v", err)
+	}
+	holder, err := readHolder(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("unable to read lock file %q: %v", path, err)
+	}
+	return &holder, holder.isStale(hostname), nil
+}
+
+// Release removes the lock file, if it is still held by this lock.
+func (l *Lock) Release() error {
+	holder, err := readHolder(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to read lock file %q: %v", l.path, err)
+	}
+	if holder.PID != l.holder.PID || holder.Hostname != l.holder.Hostname {
+		return fmt.Errorf("lock file %q is held by %s", l.path, holder)
+	}
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove lock file %q: %v", l.path, err)
+	}
+	return nil
+}
+
+// removeStale removes the lock file if it is still held by the stale holder.
+// Processes that find the same stale lock take turns, through a second lock
+// file, and each reads the holder again before it removes the lock, so that a
+// lock acquired in the meantime by one of them is not removed by another.
+func removeStale(path string, stale Holder) error {
+	breaker := path + breakerSuffix
+	f, err := os.OpenFile(breaker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if !os.IsExist(err) {
+			return err
+		}
+		// Another process is removing the stale lock. Its lock file is
+		// removed if that process exited before it was done.
+		if info, err := os.Stat(breaker); err == nil && time.Since(info.ModTime()) > time.Minute {
+			os.Remove(breaker)
+		}
+		time.Sleep(PollInterval / 10)
+		return nil
+	}
+	f.Close()
+	defer os.Remove(breaker)
+	holder, err := readHolder(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !holder.equal(stale) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Lock) create() error {
+	b, err := json.Marshal(l.holder)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(l.path)
+		return err
+	}
+	return f.Close()
+}
+
+// readHolder reads the holder of the lock. A lock file that cannot be parsed
+// is reported as held by an unknown process with PID zero since it was last
+// modified.
+func readHolder(path string) (Holder, error) {
+	var holder Holder
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return holder, err
+	}
+	if err := json.Unmarshal(b, &holder); err != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return holder, err
+		}
+		return Holder{Hostname: "unknown", Acquired: info.ModTime()}, nil
+	}
+	return holder, nil
+}
+
+// isStale returns true if the holder is a process on this host that no longer
+// exists. The liveness of processes on other hosts cannot be checked. A lock
+// file that cannot be parsed is stale once it is older than a minute, because
+// the holder writes it as soon as it is created.
+func (h Holder) isStale(hostname string) bool {
+	if h.PID == 0 {
+		return time.Since(h.Acquired) > time.Minute
+	}
+	if h.Hostname != hostname {
+		return false
+	}
+	return !processExists(h.PID)
+}
+
+func (h Holder) equal(other Holder) bool {
+	return h.PID == other.PID && h.Hostname == other.Hostname && h.Acquired.Equal(other.Acquired)
+}
+
+func isReadOnly(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err == syscall.EROFS
+	}
+	return false
+}
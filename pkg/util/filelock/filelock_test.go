@@ -0,0 +1,213 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempLockPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "filelock")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	return filepath.Join(dir, "state.yaml.lock"), func() { os.RemoveAll(dir) }
+}
+
+func writeHolder(t *testing.T, path string, holder Holder) {
+	b, err := json.Marshal(holder)
+	if err != nil {
+		t.Fatalf("unable to marshal holder: %v", err)
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatalf("unable to write lock file: %v", err)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+	l, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("unable to acquire lock: %v", err)
+	}
+	if _, err := Acquire(path, 2*PollInterval); !IsLocked(err) {
+		t.Fatalf("expected locked error acquiring a held lock, found %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatalf("unable to release lock: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected lock file to be removed")
+	}
+	l, err = Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("unable to acquire released lock: %v", err)
+	}
+	l.Release()
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+	l, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("unable to acquire lock: %v", err)
+	}
+	go func() {
+		time.Sleep(PollInterval)
+		l.Release()
+	}()
+	l2, err := Acquire(path, 10*PollInterval)
+	if err != nil {
+		t.Fatalf("expected lock to be acquired once released: %v", err)
+	}
+	l2.Release()
+}
+
+func TestAcquireStale(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("unable to get hostname: %v", err)
+	}
+	// A process that has exited.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("unable to run process: %v", err)
+	}
+	writeHolder(t, path, Holder{PID: cmd.Process.Pid, Hostname: hostname, Acquired: time.Now()})
+	l, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("expected stale lock to be removed: %v", err)
+	}
+	l.Release()
+
+	// A process on another host is never stale.
+	writeHolder(t, path, Holder{PID: cmd.Process.Pid, Hostname: hostname + "-other", Acquired: time.Now()})
+	if _, err := Acquire(path, 0); err == nil {
+		t.Fatalf("expected error acquiring a lock held on another host")
+	}
+}
+
+func TestRemoveStaleKeepsNewLock(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+	stale := Holder{PID: 1, Hostname: "host", Acquired: time.Now().UTC()}
+	// Another process removed the stale lock, and acquired the lock, since
+	// the stale holder was read.
+	fresh := Holder{PID: 2, Hostname: "host", Acquired: stale.Acquired.Add(time.Second)}
+	writeHolder(t, path, fresh)
+	if err := removeStale(path, stale); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	holder, err := readHolder(path)
+	if err != nil {
+		t.Fatalf("expected lock acquired by another process to be kept: %v", err)
+	}
+	if !holder.equal(fresh) {
+		t.Fatalf("expected holder %s, found %s", fresh, holder)
+	}
+
+	// Another process is removing the stale lock.
+	writeHolder(t, path, stale)
+	if err := ioutil.WriteFile(path+breakerSuffix, nil, 0600); err != nil {
+		t.Fatalf("unable to write breaker: %v", err)
+	}
+	if err := removeStale(path, stale); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected lock to be left to the other process: %v", err)
+	}
+	if err := os.Remove(path + breakerSuffix); err != nil {
+		t.Fatalf("unable to remove breaker: %v", err)
+	}
+
+	if err := removeStale(path, stale); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected stale lock to be removed, found %v", err)
+	}
+	if _, err := os.Stat(path + breakerSuffix); !os.IsNotExist(err) {
+		t.Fatalf("expected breaker to be removed, found %v", err)
+	}
+}
+
+func TestAcquireUnparsable(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatalf("unable to write lock file: %v", err)
+	}
+	if _, err := Acquire(path, 0); err == nil {
+		t.Fatalf("expected error acquiring a recently created lock")
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("unable to change lock file times: %v", err)
+	}
+	l, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("expected old unparsable lock to be removed: %v", err)
+	}
+	l.Release()
+}
+
+func TestCheck(t *testing.T) {
+	path, cleanup := tempLockPath(t)
+	defer cleanup()
+	if holder, _, err := Check(path); err != nil || holder != nil {
+		t.Fatalf("expected lock not to be held, found holder %v, error %v", holder, err)
+	}
+	l, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("unable to acquire lock: %v", err)
+	}
+	holder, stale, err := Check(path)
+	if err != nil {
+		t.Fatalf("unable to check lock: %v", err)
+	}
+	if holder == nil || holder.PID != os.Getpid() || stale {
+		t.Errorf("expected lock to be held by this process, found holder %v, stale %t", holder, stale)
+	}
+	l.Release()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("unable to get hostname: %v", err)
+	}
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("unable to run process: %v", err)
+	}
+	writeHolder(t, path, Holder{PID: cmd.Process.Pid, Hostname: hostname, Acquired: time.Now()})
+	if holder, stale, err := Check(path); err != nil || holder == nil || !stale {
+		t.Errorf("expected stale lock, found holder %v, stale %t, error %v", holder, stale, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected check not to remove the stale lock: %v", err)
+	}
+}
@@ -1,3 +1,6 @@
+//go:build !windows
+// +build !windows
+
 /*
 Copyright 2019 The cctl authors.
 
@@ -14,23 +17,11 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package cmd
-
-import (
-	"fmt"
+package filelock
 
-	"github.com/spf13/cobra"
-)
-
-// statusCmd represents the status command
-var statusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "Used to get status of the cluster",
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Status called")
-	},
-}
+import "syscall"
 
-func init() {
-	rootCmd.AddCommand(statusCmd)
+// processExists returns false if no process with the PID exists on this host.
+func processExists(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
 }
@@ -0,0 +1,296 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gitstate keeps the state file in a git repository: it clones the
+// repository, and commits and pushes every change of the state file, so that
+// operators share the state, and its history is an audit trail. It uses the
+// git command line tool, with the SSH keys and credentials configured for it.
+package gitstate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultPath is the path of the state file in the repository if none is
+// given.
+const DefaultPath = "cctl-state.yaml"
+
+// ErrConflict is returned by CommitExclusive when another operator pushed a
+// change of the same file first.
+var ErrConflict = errors.New("the file was changed by another operator")
+
+// scpLike matches repositories given as user@host:path, as git does.
+var scpLike = regexp.MustCompile(`^[A-Za-z0-9._-]+@[^:/]+:`)
+
+// Remote is a state file in a git repository.
+type Remote struct {
+	// Repository is the URL of the repository, as given to git clone.
+	Repository string
+	// Path is the path of the state file in the repository.
+	Path string
+}
+
+// Parse returns the repository and the path of the state file, given as
+// <repository>//<path>, e.g. git@github.com:org/clusters.git//prod/state.yaml.
+// The repository is an SSH, HTTPS, git, or file URL, or user@host:path. It
+// returns false if the state is not in a repository.
+func Parse(s string) (Remote, bool, error) {
+	start := 0
+	if i := strings.Index(s, "://"); i != -1 {
+		switch s[:i] {
+		case "ssh", "git", "http", "https", "file":
+		default:
+			return Remote{}, false, nil
+		}
+		start = i + len("://")
+	} else if !scpLike.MatchString(s) {
+		return Remote{}, false, nil
+	}
+	r := Remote{Repository: s, Path: DefaultPath}
+	if i := strings.Index(s[start:], "//"); i != -1 {
+		r.Repository, r.Path = s[:start+i], s[start+i+len("//"):]
+	}
+	clean := path.Clean(r.Path)
+	if len(r.Path) == 0 || path.IsAbs(r.Path) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return Remote{}, true, fmt.Errorf("the path of the state file in the repository %q must be relative, and inside the repository", r.Repository)
+	}
+	r.Path = clean
+	return r, true, nil
+}
+
+// String returns the state as given to Parse.
+func (r Remote) String() string {
+	return r.Repository + "//" + r.Path
+}
+
+// Dir returns the directory, under the parent, that the repository is cloned
+// to. Every repository has its own directory.
+func (r Remote) Dir(parent string) string {
+	sum := sha256.Sum256([]byte(r.Repository))
+	return filepath.Join(parent, hex.EncodeToString(sum[:8]))
+}
+
+// Sync clones the repository to the directory, or, if it is already cloned,
+// pulls the changes pushed since, and pushes any local commits that a
+// previous run failed to push. Uncommitted changes, e.g. of a state that was
+// not pushed, are kept. It fails, instead of discarding them, if the changes
+// conflict.
+func Sync(r Remote, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+			return fmt.Errorf("unable to create %q: %v", filepath.Dir(dir), err)
+		}
+		if _, err := git("", "clone", "--quiet", r.Repository, dir); err != nil {
+			return fmt.Errorf("unable to clone %q: %v", r.Repository, err)
+		}
+		return nil
+	}
+	empty, err := isEmpty(dir)
+	if err != nil {
+		return err
+	}
+	if empty {
+		heads, err := git(dir, "ls-remote", "--heads", "origin")
+		if err != nil {
+			return fmt.Errorf("unable to list the branches of %q: %v", r.Repository, err)
+		}
+		if len(heads) == 0 {
+			// The repository is still empty, so there is nothing to pull.
+			return nil
+		}
+	}
+	if err := pull(r, dir); err != nil {
+		return fmt.Errorf("unable to pull %q to %q; commit or discard the changes in %q, and run again: %v", r.Repository, dir, dir, err)
+	}
+	return push(r, dir)
+}
+
+// Commit commits the files, relative to the directory, with the message, and
+// pushes the commit. If another operator pushed first, the commit is rebased
+// on their changes, unless they conflict. It returns false if the files did
+// not change.
+func Commit(r Remote, dir string, files []string, message string) (bool, error) {
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	if len(existing) == 0 {
+		return false, nil
+	}
+	if _, err := git(dir, append([]string{"add", "--"}, existing...)...); err != nil {
+		return false, fmt.Errorf("unable to add the state to %q: %v", dir, err)
+	}
+	if _, err := git(dir, "diff", "--cached", "--quiet"); err == nil {
+		return false, nil
+	}
+	if _, err := git(dir, "commit", "--quiet", "-m", message); err != nil {
+		return false, fmt.Errorf("unable to commit the state in %q: %v", dir, err)
+	}
+	return true, push(r, dir)
+}
+
+// CommitExclusive commits the file, relative to the directory, with the
+// message, and pushes the commit, unless another operator pushed a change of
+// the file since the repository was synced. Then, the commit is undone, the
+// changes of the other operator are pulled, so that the file is theirs, and
+// it returns ErrConflict. The commit is undone if it fails to be pushed for
+// any other reason too. The file can be deleted. Pushing the file is how an
+// operator claims it, e.g. the operation lease, for every clone.
+func CommitExclusive(r Remote, dir, file, message string) error {
+	if _, err := git(dir, "add", "--all", "--", file); err != nil {
+		return fmt.Errorf("unable to add %q to %q: %v", file, dir, err)
+	}
+	if _, err := git(dir, "diff", "--cached", "--quiet", "--", file); err == nil {
+		return nil
+	}
+	if _, err := git(dir, "commit", "--quiet", "-m", message, "--", file); err != nil {
+		return fmt.Errorf("unable to commit %q in %q: %v", file, dir, err)
+	}
+	err := push(r, dir)
+	if err == nil {
+		return nil
+	}
+	if undoErr := undoCommit(dir, file); undoErr != nil {
+		return fmt.Errorf("%v; unable to undo the commit: %v", err, undoErr)
+	}
+	if _, ok := err.(*conflictError); ok {
+		if err := pull(r, dir); err != nil {
+			return fmt.Errorf("unable to pull %q to %q: %v", r.Repository, dir, err)
+		}
+		return ErrConflict
+	}
+	return err
+}
+
+// undoCommit removes the last commit, of the file, and restores the file as
+// it was before it.
+func undoCommit(dir, file string) error {
+	if _, err := git(dir, "reset", "--quiet", "--soft", "HEAD~1"); err != nil {
+		return err
+	}
+	if _, err := git(dir, "reset", "--quiet", "--", file); err != nil {
+		return err
+	}
+	if _, err := git(dir, "cat-file", "-e", "HEAD:"+file); err != nil {
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(file))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	_, err := git(dir, "checkout", "--quiet", "HEAD", "--", file)
+	return err
+}
+
+// conflictError is returned by push when the local commits conflict with the
+// changes pushed by others.
+type conflictError struct {
+	err error
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+// push pushes the local commits, rebasing them on the changes pushed by
+// others if the push is rejected.
+func push(r Remote, dir string) error {
+	if _, err := git(dir, "push", "--quiet", "origin", "HEAD"); err == nil {
+		return nil
+	}
+	if err := pull(r, dir); err != nil {
+		err = fmt.Errorf("unable to rebase the state in %q on the changes pushed to %q; resolve them in %q, and run again: %v", dir, r.Repository, dir, err)
+		// The rebase is in progress, and aborted, only if the changes
+		// conflict; otherwise, e.g., the changes could not be fetched.
+		if _, abortErr := git(dir, "rebase", "--abort"); abortErr == nil {
+			return &conflictError{err: err}
+		}
+		return err
+	}
+	if _, err := git(dir, "push", "--quiet", "origin", "HEAD"); err != nil {
+		return fmt.Errorf("unable to push the state in %q to %q: %v", dir, r.Repository, err)
+	}
+	return nil
+}
+
+// pull rebases the local commits on the changes pushed to the repository.
+// Uncommitted changes are kept. If they conflict with the pulled changes,
+// they are left in the stash, instead of being merged with conflict markers.
+func pull(r Remote, dir string) error {
+	if _, err := git(dir, "pull", "--quiet", "--rebase", "--autostash"); err != nil {
+		return err
+	}
+	unmerged, err := git(dir, "ls-files", "--unmerged")
+	if err != nil {
+		return err
+	}
+	if len(unmerged) == 0 {
+		return nil
+	}
+	if _, err := git(dir, "reset", "--quiet", "--hard", "HEAD"); err != nil {
+		return err
+	}
+	return fmt.Errorf("the uncommitted changes in %q conflict with the changes pushed to %q, and were moved to the stash; apply them with 'git stash pop' in %q", dir, r.Repository, dir)
+}
+
+// isEmpty returns true if the repository has no commits.
+func isEmpty(dir string) (bool, error) {
+	_, err := git(dir, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err == nil {
+		return false, nil
+	}
+	if _, ok := err.(*commandError); ok {
+		return true, nil
+	}
+	return false, err
+}
+
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdOut, stdErr bytes.Buffer
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return stdOut.String(), &commandError{args: args, stdErr: strings.TrimSpace(stdErr.String()), err: err}
+		}
+		return "", fmt.Errorf("unable to run git: %v", err)
+	}
+	return stdOut.String(), nil
+}
+
+// commandError is a git command that failed.
+type commandError struct {
+	args   []string
+	stdErr string
+	err    error
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("git %s: %v (stderr: %q)", strings.Join(e.args, " "), e.err, e.stdErr)
+}
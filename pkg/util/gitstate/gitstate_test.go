@@ -0,0 +1,224 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitstate_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/platform9/cctl/pkg/util/gitstate"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		state    string
+		expected gitstate.Remote
+		ok       bool
+		err      bool
+	}{
+		{state: "/etc/cctl-state.yaml"},
+		{state: "state.yaml"},
+		{state: "s3://bucket/state.yaml"},
+		{state: "git@github.com:org/clusters.git//prod/state.yaml", expected: gitstate.Remote{Repository: "git@github.com:org/clusters.git", Path: "prod/state.yaml"}, ok: true},
+		{state: "git@github.com:org/clusters.git", expected: gitstate.Remote{Repository: "git@github.com:org/clusters.git", Path: gitstate.DefaultPath}, ok: true},
+		{state: "ssh://git@example.com:2222/clusters.git//state.yaml", expected: gitstate.Remote{Repository: "ssh://git@example.com:2222/clusters.git", Path: "state.yaml"}, ok: true},
+		{state: "file:///srv/clusters.git//a/../state.yaml", expected: gitstate.Remote{Repository: "file:///srv/clusters.git", Path: "state.yaml"}, ok: true},
+		{state: "git@github.com:org/clusters.git//../state.yaml", ok: true, err: true},
+		{state: "git@github.com:org/clusters.git//", ok: true, err: true},
+	}
+	for _, test := range tests {
+		r, ok, err := gitstate.Parse(test.state)
+		if ok != test.ok || (err != nil) != test.err {
+			t.Errorf("%q: expected ok %v and error %v, found %v and %v", test.state, test.ok, test.err, ok, err)
+			continue
+		}
+		if err == nil && r != test.expected {
+			t.Errorf("%q: expected %+v, found %+v", test.state, test.expected, r)
+		}
+	}
+}
+
+func run(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+func TestSyncAndCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for k, v := range map[string]string{"GIT_AUTHOR_NAME": "test", "GIT_AUTHOR_EMAIL": "test@example.com", "GIT_COMMITTER_NAME": "test", "GIT_COMMITTER_EMAIL": "test@example.com"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+	dir, err := ioutil.TempDir("", "gitstate")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bare := filepath.Join(dir, "clusters.git")
+	run(t, dir, "init", "--quiet", "--bare", bare)
+	r, _, err := gitstate.Parse("file://" + bare + "//prod/state.yaml")
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+
+	// Two operators clone the empty repository.
+	first, second := r.Dir(filepath.Join(dir, "first")), r.Dir(filepath.Join(dir, "second"))
+	for _, d := range []string{first, second} {
+		if err := gitstate.Sync(r, d); err != nil {
+			t.Fatalf("unable to clone: %v", err)
+		}
+		if err := gitstate.Sync(r, d); err != nil {
+			t.Fatalf("unable to sync empty repository: %v", err)
+		}
+	}
+
+	os.MkdirAll(filepath.Join(first, "prod"), 0700)
+	if err := ioutil.WriteFile(filepath.Join(first, r.Path), []byte("v1"), 0600); err != nil {
+		t.Fatalf("unable to write state: %v", err)
+	}
+	files := []string{r.Path, r.Path + ".sig"}
+	committed, err := gitstate.Commit(r, first, files, "cctl create cluster")
+	if err != nil || !committed {
+		t.Fatalf("expected the state to be committed, found %v, %v", committed, err)
+	}
+	if committed, err := gitstate.Commit(r, first, files, "cctl get cluster"); err != nil || committed {
+		t.Fatalf("expected an unchanged state not to be committed, found %v, %v", committed, err)
+	}
+
+	if err := gitstate.Sync(r, second); err != nil {
+		t.Fatalf("unable to sync: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(second, r.Path))
+	if err != nil || string(b) != "v1" {
+		t.Fatalf("expected the pushed state, found %q, %v", b, err)
+	}
+
+	// The second operator pushes first; the first operator's commit, of
+	// another file, is rebased on it.
+	ioutil.WriteFile(filepath.Join(second, r.Path), []byte("v2"), 0600)
+	if _, err := gitstate.Commit(r, second, files, "cctl create machine"); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(first, r.Path+".sig"), []byte("sig"), 0600)
+	if _, err := gitstate.Commit(r, first, files, "cctl sign"); err != nil {
+		t.Fatalf("expected the commit to be rebased and pushed, found %v", err)
+	}
+	log := run(t, bare, "log", "--format=%s")
+	if log != "cctl sign\ncctl create machine\ncctl create cluster\n" {
+		t.Errorf("unexpected history:\n%s", log)
+	}
+
+	// Uncommitted changes, e.g. of a state that was not pushed, are kept.
+	ioutil.WriteFile(filepath.Join(second, r.Path), []byte("v3"), 0600)
+	if err := gitstate.Sync(r, second); err != nil {
+		t.Fatalf("unable to sync with uncommitted changes: %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(second, r.Path)); err != nil || string(b) != "v3" {
+		t.Errorf("expected the uncommitted state to be kept, found %q, %v", b, err)
+	}
+
+	// Conflicting changes are not discarded.
+	ioutil.WriteFile(filepath.Join(first, r.Path), []byte("v4"), 0600)
+	if _, err := gitstate.Commit(r, first, files, "cctl delete machine"); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+	if err := gitstate.Sync(r, second); err == nil {
+		t.Errorf("expected sync to fail with conflicting uncommitted changes")
+	}
+	if out := run(t, second, "stash", "show", "-p"); !strings.Contains(out, "+v3") {
+		t.Errorf("expected the conflicting uncommitted state to be kept in the stash, found:\n%s", out)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(second, r.Path)); err != nil || string(b) != "v4" {
+		t.Errorf("expected the pushed state, found %q, %v", b, err)
+	}
+}
+
+func TestCommitExclusive(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for k, v := range map[string]string{"GIT_AUTHOR_NAME": "test", "GIT_AUTHOR_EMAIL": "test@example.com", "GIT_COMMITTER_NAME": "test", "GIT_COMMITTER_EMAIL": "test@example.com"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Setenv(k, v)
+	}
+	dir, err := ioutil.TempDir("", "gitstate")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	bare := filepath.Join(dir, "clusters.git")
+	run(t, dir, "init", "--quiet", "--bare", bare)
+	r, _, err := gitstate.Parse("file://" + bare + "//state.yaml")
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	first, second := r.Dir(filepath.Join(dir, "first")), r.Dir(filepath.Join(dir, "second"))
+	if err := gitstate.Sync(r, first); err != nil {
+		t.Fatalf("unable to clone: %v", err)
+	}
+	ioutil.WriteFile(filepath.Join(first, r.Path), []byte("v1"), 0600)
+	if _, err := gitstate.Commit(r, first, []string{r.Path}, "cctl create cluster"); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+	if err := gitstate.Sync(r, second); err != nil {
+		t.Fatalf("unable to clone: %v", err)
+	}
+
+	// Both operators claim the lease; the first to push holds it.
+	lease := "state.yaml.default.lease"
+	ioutil.WriteFile(filepath.Join(first, lease), []byte("first"), 0600)
+	ioutil.WriteFile(filepath.Join(second, lease), []byte("second"), 0600)
+	if err := gitstate.CommitExclusive(r, first, lease, "Acquire operation lease"); err != nil {
+		t.Fatalf("unable to push the lease: %v", err)
+	}
+	if err := gitstate.CommitExclusive(r, second, lease, "Acquire operation lease"); err != gitstate.ErrConflict {
+		t.Fatalf("expected a conflict, found %v", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(second, lease)); err != nil || string(b) != "first" {
+		t.Errorf("expected the lease of the first operator, found %q, %v", b, err)
+	}
+	if out := run(t, second, "status", "--porcelain"); len(out) != 0 {
+		t.Errorf("expected the commit to be undone, found changes:\n%s", out)
+	}
+
+	// A change of another file does not conflict.
+	ioutil.WriteFile(filepath.Join(second, r.Path), []byte("v2"), 0600)
+	if _, err := gitstate.Commit(r, second, []string{r.Path}, "cctl create machine"); err != nil {
+		t.Fatalf("unable to commit: %v", err)
+	}
+	if err := os.Remove(filepath.Join(first, lease)); err != nil {
+		t.Fatalf("unable to remove lease: %v", err)
+	}
+	if err := gitstate.CommitExclusive(r, first, lease, "Release operation lease"); err != nil {
+		t.Fatalf("unable to push the released lease: %v", err)
+	}
+	log := run(t, bare, "log", "--format=%s")
+	if log != "Release operation lease\ncctl create machine\nAcquire operation lease\ncctl create cluster\n" {
+		t.Errorf("unexpected history:\n%s", log)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hardware parses the output of benchmarks run on machines, and
+// compares the results against thresholds.
+package hardware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FioSyncP99 returns the 99th percentile fdatasync latency reported by
+// `fio --output-format=json`. Since fio 3.5, latencies are reported in
+// nanoseconds; earlier versions report them in microseconds.
+func FioSyncP99(out []byte) (time.Duration, error) {
+	var report struct {
+		Jobs []struct {
+			Sync struct {
+				LatNS *struct {
+					Percentile map[string]float64 `json:"percentile"`
+				} `json:"lat_ns"`
+				Lat *struct {
+					Percentile map[string]float64 `json:"percentile"`
+				} `json:"lat"`
+			} `json:"sync"`
+		} `json:"jobs"`
+	}
+	if err := json.Unmarshal(out, &report); err != nil {
+		return 0, fmt.Errorf("unable to parse fio output: %v", err)
+	}
+	if len(report.Jobs) == 0 {
+		return 0, fmt.Errorf("fio output has no jobs")
+	}
+	sync := report.Jobs[0].Sync
+	switch {
+	case sync.LatNS != nil:
+		if p, ok := sync.LatNS.Percentile["99.000000"]; ok {
+			return time.Duration(p), nil
+		}
+	case sync.Lat != nil:
+		if p, ok := sync.Lat.Percentile["99.000000"]; ok {
+			return time.Duration(p) * time.Microsecond, nil
+		}
+	}
+	return 0, fmt.Errorf("fio output has no 99th percentile fdatasync latency")
+}
+
+// MemTotal returns the total memory, in bytes, reported by /proc/meminfo.
+func MemTotal(meminfo []byte) (int64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse MemTotal %q: %v", fields[1], err)
+		}
+		return kb * 1024, nil
+	}
+	return 0, fmt.Errorf("MemTotal not found")
+}
+
+// PingAverage returns the average round-trip time reported by `ping -q`.
+func PingAverage(out []byte) (time.Duration, error) {
+	for _, line := range strings.Split(string(out), "\n") {
+		// e.g. rtt min/avg/max/mdev = 0.045/0.061/0.079/0.012 ms
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[0], "min/avg/max") {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) != 2 || fields[1] != "ms" {
+			return 0, fmt.Errorf("unexpected round-trip times %q", parts[1])
+		}
+		values := strings.Split(fields[0], "/")
+		if len(values) < 2 {
+			return 0, fmt.Errorf("unexpected round-trip times %q", parts[1])
+		}
+		avg, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse average round-trip time %q: %v", values[1], err)
+		}
+		return time.Duration(avg * float64(time.Millisecond)), nil
+	}
+	return 0, fmt.Errorf("round-trip times not found")
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Check     string
+	Value     string
+	Threshold string
+	Passed    bool
+	Error     string
+}
+
+// Status returns PASS, FAIL, or ERROR.
+func (r Result) Status() string {
+	switch {
+	case len(r.Error) != 0:
+		return "ERROR"
+	case r.Passed:
+		return "PASS"
+	default:
+		return "FAIL"
+	}
+}
+
+// MaxDuration checks that the measured duration does not exceed the maximum.
+func MaxDuration(check string, measured, max time.Duration, err error) Result {
+	r := Result{Check: check, Threshold: fmt.Sprintf("<= %v", max)}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Value = measured.String()
+	r.Passed = measured <= max
+	return r
+}
+
+// MinInt checks that the measured value is at least the minimum.
+func MinInt(check string, measured, min int64, unit string, err error) Result {
+	r := Result{Check: check, Threshold: fmt.Sprintf(">= %d%s", min, unit)}
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.Value = fmt.Sprintf("%d%s", measured, unit)
+	r.Passed = measured >= min
+	return r
+}
+
+// Passed returns true if every check passed.
+func Passed(results []Result) bool {
+	for _, r := range results {
+		if r.Status() != "PASS" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hardware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFioSyncP99(t *testing.T) {
+	tests := []struct {
+		out      string
+		expected time.Duration
+	}{
+		{`{"fio version":"fio-3.16","jobs":[{"jobname":"etcd","sync":{"lat_ns":{"min":100,"percentile":{"90.000000":1500000,"99.000000":2300000}}}}]}`, 2300 * time.Microsecond},
+		{`{"fio version":"fio-3.1","jobs":[{"jobname":"etcd","sync":{"lat":{"percentile":{"99.000000":8160}}}}]}`, 8160 * time.Microsecond},
+	}
+	for _, test := range tests {
+		p99, err := FioSyncP99([]byte(test.out))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p99 != test.expected {
+			t.Errorf("expected %v, found %v", test.expected, p99)
+		}
+	}
+	for _, out := range []string{`fio: command not found`, `{"jobs":[]}`, `{"jobs":[{"sync":{}}]}`} {
+		if _, err := FioSyncP99([]byte(out)); err == nil {
+			t.Errorf("expected error parsing %q", out)
+		}
+	}
+}
+
+func TestMemTotal(t *testing.T) {
+	total, err := MemTotal([]byte("MemTotal:        8167848 kB\nMemFree:         1234 kB\n"))
+	if err != nil || total != 8167848*1024 {
+		t.Errorf("unexpected total %d, %v", total, err)
+	}
+	if _, err := MemTotal([]byte("MemFree: 1 kB\n")); err == nil {
+		t.Errorf("expected error when MemTotal is missing")
+	}
+}
+
+func TestPingAverage(t *testing.T) {
+	out := []byte(`PING 10.0.0.2 (10.0.0.2) 56(84) bytes of data.
+
+--- 10.0.0.2 ping statistics ---
+5 packets transmitted, 5 received, 0% packet loss, time 4004ms
+rtt min/avg/max/mdev = 0.045/0.500/0.079/0.012 ms
+`)
+	avg, err := PingAverage(out)
+	if err != nil || avg != 500*time.Microsecond {
+		t.Errorf("unexpected average %v, %v", avg, err)
+	}
+	if _, err := PingAverage([]byte("5 packets transmitted, 0 received, 100% packet loss")); err == nil {
+		t.Errorf("expected error when no replies are received")
+	}
+}
+
+func TestResults(t *testing.T) {
+	results := []Result{
+		MaxDuration("fsync", 2*time.Millisecond, 10*time.Millisecond, nil),
+		MinInt("cpus", 4, 2, "", nil),
+	}
+	if !Passed(results) {
+		t.Errorf("expected checks to pass: %+v", results)
+	}
+	results = append(results, MaxDuration("rtt", 0, time.Millisecond, fmt.Errorf("unreachable")))
+	if Passed(results) || results[2].Status() != "ERROR" {
+		t.Errorf("expected checks to fail: %+v", results)
+	}
+	if r := MinInt("memory", 1, 2, "GiB", nil); r.Status() != "FAIL" || r.Value != "1GiB" {
+		t.Errorf("unexpected result %+v", r)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hints recognizes common failures in errors and in the output of
+// commands run on machines, and describes how to remedy them.
+package hints
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/platform9/cctl/common"
+)
+
+// Hint describes a common failure, and how to remedy it.
+type Hint struct {
+	ID          string   `json:"id"`
+	Problem     string   `json:"problem"`
+	Remediation []string `json:"remediation"`
+	patterns    []*regexp.Regexp
+}
+
+func newHint(id, problem string, remediation []string, patterns ...string) Hint {
+	h := Hint{ID: id, Problem: problem, Remediation: remediation}
+	for _, p := range patterns {
+		h.patterns = append(h.patterns, regexp.MustCompile(p))
+	}
+	return h
+}
+
+// Catalog holds the hints for the failures that are known.
+var Catalog = []Hint{
+	newHint("port-6443-in-use",
+		"Port 6443, used by the Kubernetes API server, is in use on the machine, usually by a previous installation.",
+		[]string{
+			"sudo ss -ltnp 'sport = :6443'   # find the process using the port",
+			"sudo " + common.NodeadmFile + " reset     # remove a previous installation",
+		},
+		`(?i)port 6443 is in use`,
+		`(?i):6443: bind: address already in use`,
+	),
+	newHint("swap-enabled",
+		"Swap is enabled on the machine. The kubelet does not run with swap on.",
+		[]string{
+			"sudo swapoff -a",
+			`sudo sed -i '/\sswap\s/ s/^#*/#/' /etc/fstab   # keep swap off after reboot`,
+		},
+		`(?i)running with swap on is not supported`,
+		`\[ERROR Swap\]`,
+	),
+	newHint("cgroup-driver-mismatch",
+		"The kubelet and docker use different cgroup drivers.",
+		[]string{
+			"docker info --format '{{.CgroupDriver}}'   # show the docker cgroup driver",
+			`set "exec-opts": ["native.cgroupdriver=<driver>"] in /etc/docker/daemon.json to match the kubelet, then: sudo systemctl restart docker`,
+		},
+		`(?i)cgroup driver: "?\w+"? is different from docker cgroup driver`,
+	),
+	newHint("etcd-data-dir-exists",
+		"The etcd data directory on the machine holds data from a previous etcd member.",
+		[]string{
+			"sudo mv /var/lib/etcd /var/lib/etcd.$(date +%s)   # keep the data, in case it is needed",
+			"sudo " + common.EtcdadmFile + " reset                        # if the member is no longer in the cluster",
+		},
+		`(?i)/var/lib/etcd is not empty`,
+		`DirAvailable--var-lib-etcd`,
+		`(?i)member [0-9a-f]+ has already been bootstrapped`,
+	),
+	newHint("bootstrap-token-expired",
+		"The bootstrap token used to join the machine is invalid or has expired.",
+		[]string{
+			"cctl create machine ...   # retry; cctl creates a new bootstrap token for every node",
+			"timedatectl               # on the machine and a master; the token expires early if clocks are skewed",
+		},
+		`(?i)token id "?\w+"? is invalid for this cluster or it has expired`,
+		`(?i)bootstrap token .*expired`,
+	),
+}
+
+// Matches returns true if the text shows the failure of the hint.
+func (h Hint) Matches(text string) bool {
+	for _, p := range h.patterns {
+		if p.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the hints in the catalog for the failures the texts show.
+func Find(texts ...string) []Hint {
+	var found []Hint
+	for _, h := range Catalog {
+		for _, text := range texts {
+			if h.Matches(text) {
+				found = append(found, h)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// Collector accumulates the hints for the failures it observes. It is safe
+// for concurrent use.
+type Collector struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	hints []Hint
+}
+
+// Observe records the hints for the failures the texts show.
+func (c *Collector) Observe(texts ...string) {
+	found := Find(texts...)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	for _, h := range found {
+		if !c.seen[h.ID] {
+			c.seen[h.ID] = true
+			c.hints = append(c.hints, h)
+		}
+	}
+}
+
+// Hints returns the hints recorded, in the order they were first observed.
+func (c *Collector) Hints() []Hint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Hint(nil), c.hints...)
+}
+
+// Reset forgets the hints recorded.
+func (c *Collector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen = nil
+	c.hints = nil
+}
+
+// Write writes the hints for people to read.
+func Write(w io.Writer, hints []Hint) error {
+	for _, h := range hints {
+		if _, err := fmt.Fprintf(w, "Hint (%s): %s\n", h.ID, h.Problem); err != nil {
+			return err
+		}
+		for _, r := range h.Remediation {
+			if _, err := fmt.Fprintf(w, "  Try: %s\n", r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hints
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		text string
+		ids  []string
+	}{
+		{"[ERROR Port-6443]: Port 6443 is in use", []string{"port-6443-in-use"}},
+		{"listen tcp 0.0.0.0:6443: bind: address already in use", []string{"port-6443-in-use"}},
+		{"[ERROR Swap]: running with swap on is not supported. Please disable swap", []string{"swap-enabled"}},
+		{`failed to run Kubelet: misconfiguration: kubelet cgroup driver: "cgroupfs" is different from docker cgroup driver: "systemd"`, []string{"cgroup-driver-mismatch"}},
+		{"[ERROR DirAvailable--var-lib-etcd]: /var/lib/etcd is not empty", []string{"etcd-data-dir-exists"}},
+		{"etcdmain: member 8e9e05c52164694d has already been bootstrapped", []string{"etcd-data-dir-exists"}},
+		{`error: token id "abcdef" is invalid for this cluster or it has expired`, []string{"bootstrap-token-expired"}},
+		{"[ERROR Swap]: swap\n[ERROR Port-6443]: Port 6443 is in use", []string{"port-6443-in-use", "swap-enabled"}},
+		{"connection refused", nil},
+	}
+	for _, test := range tests {
+		found := Find(test.text)
+		var ids []string
+		for _, h := range found {
+			ids = append(ids, h.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(test.ids, ",") {
+			t.Errorf("Find(%q) = %v, expected %v", test.text, ids, test.ids)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	var c Collector
+	c.Observe("ok", "running with swap on is not supported")
+	c.Observe("Port 6443 is in use")
+	c.Observe("[ERROR Swap]")
+	hints := c.Hints()
+	if len(hints) != 2 || hints[0].ID != "swap-enabled" || hints[1].ID != "port-6443-in-use" {
+		t.Fatalf("unexpected hints %+v", hints)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, hints[:1]); err != nil {
+		t.Fatalf("unable to write hints: %v", err)
+	}
+	if !strings.HasPrefix(b.String(), "Hint (swap-enabled): Swap is enabled") || !strings.Contains(b.String(), "  Try: sudo swapoff -a\n") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+
+	c.Reset()
+	if len(c.Hints()) != 0 {
+		t.Errorf("expected no hints after reset")
+	}
+}
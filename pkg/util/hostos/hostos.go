@@ -0,0 +1,337 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package hostos builds the commands that manage services, packages, and the
+// firewall of a machine, for the operating system of the machine.
+package hostos
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/platform9/cctl/pkg/util/discover"
+)
+
+// Family is a family of operating systems that manage packages and the
+// firewall the same way.
+type Family string
+
+const (
+	// Debian is Debian, Ubuntu, and their derivatives.
+	Debian Family = "debian"
+	// RHEL is Red Hat Enterprise Linux, CentOS, and their derivatives.
+	RHEL Family = "rhel"
+	// SUSE is SUSE Linux Enterprise Server and openSUSE.
+	SUSE Family = "suse"
+	// Flatcar is Flatcar Container Linux and CoreOS, which have no package
+	// manager.
+	Flatcar Family = "flatcar"
+)
+
+// Families are the supported families.
+var Families = []Family{Debian, RHEL, SUSE, Flatcar}
+
+// familyIDs maps the IDs of /etc/os-release to their family.
+var familyIDs = map[string]Family{
+	"debian":        Debian,
+	"ubuntu":        Debian,
+	"rhel":          RHEL,
+	"centos":        RHEL,
+	"fedora":        RHEL,
+	"ol":            RHEL,
+	"rocky":         RHEL,
+	"almalinux":     RHEL,
+	"sles":          SUSE,
+	"suse":          SUSE,
+	"opensuse":      SUSE,
+	"opensuse-leap": SUSE,
+	"flatcar":       Flatcar,
+	"coreos":        Flatcar,
+}
+
+// FamilyOf returns the family of the operating system, by its ID or, failing
+// that, by the IDs it is like.
+func FamilyOf(o discover.OSRelease) (Family, error) {
+	for _, id := range append([]string{o.ID}, o.IDLike...) {
+		if f, ok := familyIDs[strings.ToLower(id)]; ok {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("operating system %s is not of a supported family", o)
+}
+
+// InitSystem manages the services of a machine.
+type InitSystem string
+
+const (
+	Systemd InitSystem = "systemd"
+	OpenRC  InitSystem = "openrc"
+)
+
+// InitSystems are the supported init systems.
+var InitSystems = []InitSystem{Systemd, OpenRC}
+
+// InitSystemProbes are the commands that succeed on a machine only if it uses
+// the init system.
+var InitSystemProbes = map[InitSystem]string{
+	Systemd: "command -v systemctl",
+	OpenRC:  "command -v rc-service",
+}
+
+// OS is the operating system of a machine.
+type OS struct {
+	Family Family
+	Init   InitSystem
+}
+
+// Default is the operating system assumed for machines whose operating
+// system was not detected.
+var Default = OS{Family: Debian, Init: Systemd}
+
+// String returns the operating system as family/init, e.g. debian/systemd.
+func (o OS) String() string {
+	return fmt.Sprintf("%s/%s", o.Family, o.Init)
+}
+
+// Parse parses an operating system of the form family/init.
+func Parse(s string) (OS, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return OS{}, fmt.Errorf("operating system %q must be of the form family/init", s)
+	}
+	o := OS{Family: Family(parts[0]), Init: InitSystem(parts[1])}
+	if !knownFamily(o.Family) {
+		return OS{}, fmt.Errorf("operating system family %q is not supported", o.Family)
+	}
+	if !knownInitSystem(o.Init) {
+		return OS{}, fmt.Errorf("init system %q is not supported", o.Init)
+	}
+	return o, nil
+}
+
+func knownFamily(f Family) bool {
+	for _, known := range Families {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+func knownInitSystem(i InitSystem) bool {
+	for _, known := range InitSystems {
+		if i == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceCommand returns the command that starts, stops, or restarts the
+// service.
+func (o OS) ServiceCommand(action, service string) string {
+	if o.Init == OpenRC {
+		return fmt.Sprintf("rc-service %s %s", service, action)
+	}
+	return fmt.Sprintf("systemctl %s %s", action, service)
+}
+
+// ServiceStateCommand returns the command that prints the state of the
+// service, e.g. active or inactive.
+func (o OS) ServiceStateCommand(service string) string {
+	if o.Init == OpenRC {
+		return fmt.Sprintf("rc-service %s status >/dev/null 2>&1 && echo active || echo inactive", service)
+	}
+	return fmt.Sprintf("systemctl is-active %s", service)
+}
+
+// PowerOffCommand returns the command that powers off the machine. The
+// command returns before the machine powers off.
+func (o OS) PowerOffCommand() string {
+	if o.Init == OpenRC {
+		// poweroff signals init, and returns, before the machine powers off.
+		return "poweroff"
+	}
+	return "systemctl --no-block poweroff"
+}
+
+// RebootCommand returns the command that reboots the machine. The command
+// returns before the machine reboots.
+func (o OS) RebootCommand() string {
+	if o.Init == OpenRC {
+		return "reboot"
+	}
+	return "systemctl --no-block reboot"
+}
+
+// packageManager formats the commands that install and query packages.
+type packageManager struct {
+	installFile    string
+	installVersion string
+	queryVersion   string
+}
+
+var packageManagers = map[Family]packageManager{
+	Debian: {
+		installFile:    "dpkg -i %s",
+		installVersion: "apt-get install -y --allow-downgrades %s=%s",
+		queryVersion:   "dpkg-query -W -f='${Version}' %s",
+	},
+	RHEL: {
+		installFile:    "rpm -U --oldpackage --replacepkgs %s",
+		installVersion: "yum install -y %s-%s",
+		queryVersion:   "rpm -q --qf '%%{VERSION}-%%{RELEASE}' %s",
+	},
+	SUSE: {
+		installFile:    "rpm -U --oldpackage --replacepkgs %s",
+		installVersion: "zypper --non-interactive install --oldpackage %s-%s",
+		queryVersion:   "rpm -q --qf '%%{VERSION}-%%{RELEASE}' %s",
+	},
+}
+
+func (o OS) packageManager() (packageManager, error) {
+	pm, ok := packageManagers[o.Family]
+	if !ok {
+		if o.Immutable() {
+			return packageManager{}, fmt.Errorf("operating system family %s has no package manager; install a systemd-sysext image instead", o.Family)
+		}
+		return packageManager{}, fmt.Errorf("operating system family %s has no package manager", o.Family)
+	}
+	return pm, nil
+}
+
+// Immutable returns true if /usr is read-only on the operating system.
+// Binaries are then installed as systemd-sysext images, and files are
+// written only under /etc, /opt, and /var, where Ignition writes them.
+func (o OS) Immutable() bool {
+	return o.Family == Flatcar
+}
+
+// HasPackageManager returns true if packages can be installed on the
+// operating system.
+func (o OS) HasPackageManager() bool {
+	_, ok := packageManagers[o.Family]
+	return ok
+}
+
+// ValidateWritablePath returns an error if the path is under a directory
+// that is read-only on the operating system.
+func (o OS) ValidateWritablePath(p string) error {
+	if !o.Immutable() {
+		return nil
+	}
+	for _, dir := range readOnlyDirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return fmt.Errorf("%s is read-only on %s; use a path under /opt, /etc, or /var", dir, o.Family)
+		}
+	}
+	return nil
+}
+
+// readOnlyDirs are the directories that are read-only on immutable operating
+// systems.
+var readOnlyDirs = []string{"/usr"}
+
+const (
+	// SysextDir is the directory of systemd-sysext images on immutable
+	// operating systems.
+	SysextDir = "/etc/extensions"
+	// SysextRefreshCommand merges the systemd-sysext images into /usr.
+	SysextRefreshCommand = "systemd-sysext refresh"
+	// sysextReleaseDir is the directory, in the merged /usr, of the release
+	// file of every systemd-sysext image.
+	sysextReleaseDir = "/usr/lib/extension-release.d"
+)
+
+// SysextImagePath returns the path of the systemd-sysext image of the
+// extension.
+func SysextImagePath(name string) string {
+	return path.Join(SysextDir, name+".raw")
+}
+
+// SysextReleaseFile returns the path of the release file of the extension,
+// which exists once its image is merged. It has the format of
+// /etc/os-release; VERSION_ID is the version of the extension.
+func SysextReleaseFile(name string) string {
+	return path.Join(sysextReleaseDir, "extension-release."+name)
+}
+
+// InstallPackageFileCommand returns the command that installs the package
+// file, a .deb or .rpm, on the machine.
+func (o OS) InstallPackageFileCommand(file string) (string, error) {
+	pm, err := o.packageManager()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(pm.installFile, file), nil
+}
+
+// InstallPackageVersionCommand returns the command that installs the version
+// of the package from the package repositories of the machine.
+func (o OS) InstallPackageVersionCommand(name, version string) (string, error) {
+	pm, err := o.packageManager()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(pm.installVersion, name, version), nil
+}
+
+// QueryPackageVersionCommand returns the command that prints the installed
+// version of the package.
+func (o OS) QueryPackageVersionCommand(name string) (string, error) {
+	pm, err := o.packageManager()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(pm.queryVersion, name), nil
+}
+
+// AllowTCPPortCommand returns the command that allows incoming TCP
+// connections to the port in the firewall of the machine.
+func (o OS) AllowTCPPortCommand(port int) string {
+	switch o.Family {
+	case Debian:
+		return fmt.Sprintf("ufw allow %d/tcp", port)
+	case RHEL, SUSE:
+		return fmt.Sprintf("firewall-cmd --permanent --add-port=%d/tcp && firewall-cmd --reload", port)
+	default:
+		return fmt.Sprintf("iptables -I INPUT -p tcp --dport %d -j ACCEPT", port)
+	}
+}
+
+// PackageCommandPatterns returns patterns, for a command allowlist, that
+// match the package commands of every operating system.
+func PackageCommandPatterns() []string {
+	pattern := func(format string) string {
+		return strings.Replace(strings.Replace(format, "%s", "*", -1), "%%", "%", -1)
+	}
+	seen := make(map[string]bool)
+	var patterns []string
+	for _, f := range Families {
+		pm, ok := packageManagers[f]
+		if !ok {
+			continue
+		}
+		for _, format := range []string{pm.installFile, pm.installVersion, pm.queryVersion} {
+			if p := pattern(format); !seen[p] {
+				seen[p] = true
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	return patterns
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostos
+
+import (
+	"testing"
+
+	"github.com/platform9/cctl/pkg/util/discover"
+)
+
+func TestFamilyOf(t *testing.T) {
+	for _, tc := range []struct {
+		release discover.OSRelease
+		family  Family
+	}{
+		{discover.OSRelease{ID: "ubuntu", VersionID: "18.04"}, Debian},
+		{discover.OSRelease{ID: "centos", VersionID: "7"}, RHEL},
+		{discover.OSRelease{ID: "sles", VersionID: "15"}, SUSE},
+		{discover.OSRelease{ID: "flatcar"}, Flatcar},
+		{discover.OSRelease{ID: "linuxmint", IDLike: []string{"ubuntu", "debian"}}, Debian},
+	} {
+		f, err := FamilyOf(tc.release)
+		if err != nil || f != tc.family {
+			t.Errorf("expected %s to be of family %s, found %s (%v)", tc.release, tc.family, f, err)
+		}
+	}
+	if _, err := FamilyOf(discover.OSRelease{ID: "arch"}); err == nil {
+		t.Errorf("expected an error for an unsupported operating system")
+	}
+}
+
+func TestParse(t *testing.T) {
+	o := OS{Family: SUSE, Init: OpenRC}
+	parsed, err := Parse(o.String())
+	if err != nil || parsed != o {
+		t.Errorf("expected %v, found %v (%v)", o, parsed, err)
+	}
+	for _, s := range []string{"", "debian", "debian/upstart", "arch/systemd", "debian/systemd/x"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	systemd := OS{Family: RHEL, Init: Systemd}
+	openrc := OS{Family: Debian, Init: OpenRC}
+	if cmd := systemd.ServiceCommand("restart", "kubelet"); cmd != "systemctl restart kubelet" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if cmd := openrc.ServiceCommand("restart", "kubelet"); cmd != "rc-service kubelet restart" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if cmd, err := systemd.InstallPackageVersionCommand("docker-ce", "18.06.1.ce"); err != nil || cmd != "yum install -y docker-ce-18.06.1.ce" {
+		t.Errorf("unexpected command %q (%v)", cmd, err)
+	}
+	if cmd, err := systemd.QueryPackageVersionCommand("docker-ce"); err != nil || cmd != "rpm -q --qf '%{VERSION}-%{RELEASE}' docker-ce" {
+		t.Errorf("unexpected command %q (%v)", cmd, err)
+	}
+	flatcar := OS{Family: Flatcar, Init: Systemd}
+	if _, err := flatcar.InstallPackageFileCommand("/tmp/docker.rpm"); err == nil {
+		t.Errorf("expected an error installing a package on %s", flatcar)
+	}
+	if cmd := openrc.AllowTCPPortCommand(6443); cmd != "ufw allow 6443/tcp" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if cmd := systemd.RebootCommand(); cmd != "systemctl --no-block reboot" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+	if cmd := openrc.RebootCommand(); cmd != "reboot" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+}
+
+func TestPackageCommandPatterns(t *testing.T) {
+	patterns := PackageCommandPatterns()
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		if seen[p] {
+			t.Errorf("duplicate pattern %q", p)
+		}
+		seen[p] = true
+	}
+	for _, p := range []string{"dpkg -i *", "yum install -y *-*", "zypper --non-interactive install --oldpackage *-*", "rpm -q --qf '%{VERSION}-%{RELEASE}' *"} {
+		if !seen[p] {
+			t.Errorf("expected pattern %q in %v", p, patterns)
+		}
+	}
+}
+
+func TestImmutable(t *testing.T) {
+	flatcar := OS{Family: Flatcar, Init: Systemd}
+	debian := OS{Family: Debian, Init: Systemd}
+	if !flatcar.Immutable() || flatcar.HasPackageManager() {
+		t.Errorf("expected %s to be immutable, without a package manager", flatcar)
+	}
+	if debian.Immutable() || !debian.HasPackageManager() {
+		t.Errorf("expected %s to be mutable, with a package manager", debian)
+	}
+	for _, p := range []string{"/usr", "/usr/bin", "/usr/local/bin"} {
+		if err := flatcar.ValidateWritablePath(p); err == nil {
+			t.Errorf("expected %q to be read-only on %s", p, flatcar)
+		}
+		if err := debian.ValidateWritablePath(p); err != nil {
+			t.Errorf("expected %q to be writable on %s: %v", p, debian, err)
+		}
+	}
+	for _, p := range []string{"/opt/bin", "/etc/kubernetes/admin.conf", "/usrlocal"} {
+		if err := flatcar.ValidateWritablePath(p); err != nil {
+			t.Errorf("expected %q to be writable on %s: %v", p, flatcar, err)
+		}
+	}
+	if p := SysextImagePath("docker"); p != "/etc/extensions/docker.raw" {
+		t.Errorf("unexpected image path %q", p)
+	}
+	if p := SysextReleaseFile("docker"); p != "/usr/lib/extension-release.d/extension-release.docker" {
+		t.Errorf("unexpected release file %q", p)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jobs runs operations one at a time in the background, and records
+// their progress, so that they can be started and followed asynchronously.
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/platform9/cctl/pkg/util/hints"
+	"github.com/platform9/cctl/pkg/util/operror"
+)
+
+// Status is the progress of a job.
+type Status string
+
+const (
+	Pending   Status = "Pending"
+	Running   Status = "Running"
+	Succeeded Status = "Succeeded"
+	Failed    Status = "Failed"
+)
+
+// Job is an operation submitted to a queue.
+type Job struct {
+	ID        string `json:"id"`
+	Operation string `json:"operation"`
+	// Target is what the operation changes, e.g. the IP of a machine.
+	Target string `json:"target,omitempty"`
+	Status Status `json:"status"`
+	// Error is the error of a failed job, and ErrorKind why it failed.
+	Error     string       `json:"error,omitempty"`
+	ErrorKind operror.Kind `json:"errorKind,omitempty"`
+	// Hints describe how to remedy the failure, if it is a known one.
+	Hints     []hints.Hint `json:"hints,omitempty"`
+	Submitted time.Time    `json:"submitted"`
+	Started   *time.Time   `json:"started,omitempty"`
+	Finished  *time.Time   `json:"finished,omitempty"`
+	run       func() error
+	seq       int
+}
+
+// HintedError is an error that carries hints for remedying its cause.
+type HintedError interface {
+	error
+	Cause() error
+	Hints() []hints.Hint
+}
+
+// Queue runs the jobs submitted to it in order, one at a time.
+type Queue struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	pending chan *Job
+	seq     int
+	now     func() time.Time
+	newID   func() string
+}
+
+// NewQueue returns a queue that holds up to capacity pending jobs.
+func NewQueue(capacity int) *Queue {
+	return &Queue{
+		jobs:    make(map[string]*Job),
+		pending: make(chan *Job, capacity),
+		now:     time.Now,
+		newID:   func() string { return uuid.NewV4().String() },
+	}
+}
+
+// ErrQueueFull is returned when a job is submitted to a queue with as many
+// pending jobs as its capacity.
+var ErrQueueFull = operror.New(operror.Precondition, "too many pending jobs")
+
+// Submit adds a job that runs the operation, and returns it. The job runs
+// after the jobs submitted before it.
+func (q *Queue) Submit(operation, target string, run func() error) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	job := &Job{
+		ID:        q.newID(),
+		Operation: operation,
+		Target:    target,
+		Status:    Pending,
+		Submitted: q.now(),
+		run:       run,
+		seq:       q.seq,
+	}
+	select {
+	case q.pending <- job:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	q.jobs[job.ID] = job
+	return *job, nil
+}
+
+// Get returns the job with the ID.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns every job, in the order they were submitted.
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].seq < list[j].seq })
+	return list
+}
+
+// Run runs the pending jobs until stop is closed. The job running when stop is
+// closed runs to completion before Run returns.
+func (q *Queue) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case job := <-q.pending:
+			q.runJob(job)
+		}
+	}
+}
+
+func (q *Queue) runJob(job *Job) {
+	q.mu.Lock()
+	started := q.now()
+	job.Started = &started
+	job.Status = Running
+	q.mu.Unlock()
+
+	err := job.run()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	finished := q.now()
+	job.Finished = &finished
+	job.Status = Succeeded
+	if err != nil {
+		job.Status = Failed
+		if herr, ok := err.(HintedError); ok {
+			job.Hints = herr.Hints()
+			err = herr.Cause()
+		}
+		job.Error = err.Error()
+		job.ErrorKind = operror.KindOf(err)
+	}
+}
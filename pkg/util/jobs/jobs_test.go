@@ -0,0 +1,130 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jobs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/platform9/cctl/pkg/util/hints"
+	"github.com/platform9/cctl/pkg/util/operror"
+)
+
+// wait returns the job once it is finished.
+func wait(t *testing.T, q *Queue, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := q.Get(id)
+		if !ok {
+			t.Fatalf("job %q not found", id)
+		}
+		if job.Finished != nil {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %q did not finish", id)
+	return Job{}
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(10)
+	var order []string
+	release := make(chan struct{})
+	first, err := q.Submit("create machine", "10.0.0.1", func() error {
+		<-release
+		order = append(order, "first")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unable to submit job: %v", err)
+	}
+	second, err := q.Submit("delete machine", "10.0.0.2", func() error {
+		order = append(order, "second")
+		return operror.New(operror.NotFound, "machine %q not found", "10.0.0.2")
+	})
+	if err != nil {
+		t.Fatalf("unable to submit job: %v", err)
+	}
+	if first.Status != Pending || first.ID == second.ID {
+		t.Errorf("unexpected jobs %+v, %+v", first, second)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go q.Run(stop)
+	close(release)
+
+	if job := wait(t, q, first.ID); job.Status != Succeeded || job.Started == nil {
+		t.Errorf("unexpected first job %+v", job)
+	}
+	job := wait(t, q, second.ID)
+	if job.Status != Failed || job.ErrorKind != operror.NotFound || job.Error != `machine "10.0.0.2" not found` {
+		t.Errorf("unexpected second job %+v", job)
+	}
+	if len(order) != 2 || order[0] != "first" {
+		t.Errorf("expected jobs to run in order, found %v", order)
+	}
+	list := q.List()
+	if len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+		t.Errorf("unexpected list %+v", list)
+	}
+	if _, ok := q.Get("missing"); ok {
+		t.Errorf("expected missing job not to be found")
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := NewQueue(1)
+	if _, err := q.Submit("a", "", func() error { return nil }); err != nil {
+		t.Fatalf("unable to submit job: %v", err)
+	}
+	_, err := q.Submit("b", "", func() error { return fmt.Errorf("not run") })
+	if err != ErrQueueFull {
+		t.Errorf("expected %v, found %v", ErrQueueFull, err)
+	}
+	if len(q.List()) != 1 {
+		t.Errorf("expected the rejected job not to be recorded")
+	}
+}
+
+type hintedError struct {
+	error
+	hints []hints.Hint
+}
+
+func (e hintedError) Cause() error { return e.error }
+
+func (e hintedError) Hints() []hints.Hint { return e.hints }
+
+func TestQueueHints(t *testing.T) {
+	q := NewQueue(1)
+	job, err := q.Submit("create machine", "10.0.0.1", func() error {
+		return hintedError{operror.New(operror.Precondition, "unable to create machine"), hints.Find("Port 6443 is in use")}
+	})
+	if err != nil {
+		t.Fatalf("unable to submit job: %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go q.Run(stop)
+	job = wait(t, q, job.ID)
+	if job.Status != Failed || job.ErrorKind != operror.Precondition || len(job.Hints) != 1 || job.Hints[0].ID != "port-6443-in-use" {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
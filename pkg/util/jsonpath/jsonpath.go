@@ -0,0 +1,540 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jsonpath implements the subset of the kubectl JSONPath template
+// syntax that is useful for extracting fields from cctl objects:
+//
+//	{.metadata.name}               field access
+//	{.items[0]} {.items[-1]}       index
+//	{.items[*].metadata.name}      wildcard over list elements or map values
+//	{.items[?(@.spec.x=="y")]}     filter, with ==, !=, <, <=, >, >= or existence
+//	{range .items[*]}...{end}      iteration
+//	{"\n"}                         string literal
+//
+// Text outside of braces is printed as is. Missing fields produce no output.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a parsed template.
+type JSONPath struct {
+	nodes []node
+}
+
+type nodeType int
+
+const (
+	textNode nodeType = iota
+	pathNode
+	rangeNode
+)
+
+type node struct {
+	typ   nodeType
+	text  string
+	path  []step
+	nodes []node
+}
+
+type stepType int
+
+const (
+	fieldStep stepType = iota
+	indexStep
+	wildcardStep
+	filterStep
+)
+
+type step struct {
+	typ    stepType
+	field  string
+	index  int
+	filter *filter
+}
+
+type filter struct {
+	path    []step
+	op      string
+	operand interface{}
+}
+
+// Parse parses the template.
+func Parse(template string) (*JSONPath, error) {
+	actions, err := tokenize(template)
+	if err != nil {
+		return nil, err
+	}
+	nodes, rest, err := parseNodes(actions, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("unexpected {end}")
+	}
+	return &JSONPath{nodes: nodes}, nil
+}
+
+// Execute applies the template to the object, which is first converted to its
+// JSON representation, and writes the result to w.
+func (j *JSONPath) Execute(w io.Writer, obj interface{}) error {
+	data, err := toJSONValue(obj)
+	if err != nil {
+		return err
+	}
+	return execute(w, j.nodes, data)
+}
+
+func toJSONValue(obj interface{}) (interface{}, error) {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal object to json: %v", err)
+	}
+	var data interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal object from json: %v", err)
+	}
+	return data, nil
+}
+
+// token is either literal text, or the contents of an action in braces.
+type token struct {
+	action bool
+	text   string
+}
+
+func tokenize(template string) ([]token, error) {
+	var tokens []token
+	for len(template) != 0 {
+		start := strings.Index(template, "{")
+		if start == -1 {
+			tokens = append(tokens, token{text: template})
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, token{text: template[:start]})
+		}
+		end, err := actionEnd(template[start:])
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token{action: true, text: strings.TrimSpace(template[start+1 : start+end])})
+		template = template[start+end+1:]
+	}
+	return tokens, nil
+}
+
+// actionEnd returns the index of the brace closing the action at the start of
+// s. Braces inside quoted strings are ignored.
+func actionEnd(s string) (int, error) {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '}':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unclosed action in %q", s)
+}
+
+func parseNodes(tokens []token, inRange bool) ([]node, []token, error) {
+	var nodes []node
+	for len(tokens) != 0 {
+		t := tokens[0]
+		tokens = tokens[1:]
+		switch {
+		case !t.action:
+			nodes = append(nodes, node{typ: textNode, text: t.text})
+		case t.text == "end":
+			if !inRange {
+				return nil, nil, fmt.Errorf("unexpected {end}")
+			}
+			return nodes, append([]token{t}, tokens...), nil
+		case strings.HasPrefix(t.text, "range "):
+			path, err := parsePath(strings.TrimSpace(strings.TrimPrefix(t.text, "range ")))
+			if err != nil {
+				return nil, nil, err
+			}
+			body, rest, err := parseNodes(tokens, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(rest) == 0 {
+				return nil, nil, fmt.Errorf("{range %s} is missing {end}", t.text)
+			}
+			tokens = rest[1:]
+			nodes = append(nodes, node{typ: rangeNode, path: path, nodes: body})
+		case strings.HasPrefix(t.text, `"`):
+			text, err := strconv.Unquote(t.text)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid string literal %s: %v", t.text, err)
+			}
+			nodes = append(nodes, node{typ: textNode, text: text})
+		default:
+			path, err := parsePath(t.text)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, node{typ: pathNode, path: path})
+		}
+	}
+	return nodes, nil, nil
+}
+
+func parsePath(s string) ([]step, error) {
+	orig := s
+	s = strings.TrimPrefix(s, "$")
+	s = strings.TrimPrefix(s, "@")
+	var steps []step
+	for len(s) != 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			if len(name) == 0 {
+				continue
+			}
+			if name == "*" {
+				steps = append(steps, step{typ: wildcardStep})
+				continue
+			}
+			steps = append(steps, step{typ: fieldStep, field: name})
+		case '[':
+			end, err := bracketEnd(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %v", orig, err)
+			}
+			st, err := parseBracket(strings.TrimSpace(s[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: %v", orig, err)
+			}
+			steps = append(steps, st)
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", orig, s[0])
+		}
+	}
+	return steps, nil
+}
+
+func bracketEnd(s string) (int, error) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unclosed bracket")
+}
+
+func parseBracket(s string) (step, error) {
+	switch {
+	case s == "*":
+		return step{typ: wildcardStep}, nil
+	case strings.HasPrefix(s, "?(") && strings.HasSuffix(s, ")"):
+		f, err := parseFilter(strings.TrimSpace(s[2 : len(s)-1]))
+		if err != nil {
+			return step{}, err
+		}
+		return step{typ: filterStep, filter: f}, nil
+	case strings.HasPrefix(s, "'") || strings.HasPrefix(s, `"`):
+		name, err := unquote(s)
+		if err != nil {
+			return step{}, err
+		}
+		return step{typ: fieldStep, field: name}, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return step{}, fmt.Errorf("unsupported subscript %q", s)
+	}
+	return step{typ: indexStep, index: i}, nil
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func parseFilter(s string) (*filter, error) {
+	for _, op := range operators {
+		if i := strings.Index(s, op); i != -1 {
+			path, err := parsePath(strings.TrimSpace(s[:i]))
+			if err != nil {
+				return nil, err
+			}
+			operand, err := parseOperand(strings.TrimSpace(s[i+len(op):]))
+			if err != nil {
+				return nil, err
+			}
+			return &filter{path: path, op: op, operand: operand}, nil
+		}
+	}
+	path, err := parsePath(s)
+	if err != nil {
+		return nil, err
+	}
+	return &filter{path: path}, nil
+}
+
+func parseOperand(s string) (interface{}, error) {
+	if strings.HasPrefix(s, "'") || strings.HasPrefix(s, `"`) {
+		return unquote(s)
+	}
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid operand %q", s)
+	}
+	return f, nil
+}
+
+func unquote(s string) (string, error) {
+	if strings.HasPrefix(s, "'") && strings.HasSuffix(s, "'") && len(s) >= 2 {
+		return s[1 : len(s)-1], nil
+	}
+	return strconv.Unquote(s)
+}
+
+func execute(w io.Writer, nodes []node, data interface{}) error {
+	for _, n := range nodes {
+		switch n.typ {
+		case textNode:
+			if _, err := io.WriteString(w, n.text); err != nil {
+				return err
+			}
+		case pathNode:
+			values := evaluate(n.path, data)
+			var out []string
+			for _, v := range values {
+				s, err := format(v)
+				if err != nil {
+					return err
+				}
+				out = append(out, s)
+			}
+			if _, err := io.WriteString(w, strings.Join(out, " ")); err != nil {
+				return err
+			}
+		case rangeNode:
+			for _, v := range evaluate(n.path, data) {
+				// Ranging over a single list iterates over its elements.
+				if list, ok := v.([]interface{}); ok && len(n.path) != 0 && n.path[len(n.path)-1].typ != wildcardStep {
+					for _, e := range list {
+						if err := execute(w, n.nodes, e); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				if err := execute(w, n.nodes, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func evaluate(path []step, data interface{}) []interface{} {
+	values := []interface{}{data}
+	for _, st := range path {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, apply(st, v)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func apply(st step, v interface{}) []interface{} {
+	switch st.typ {
+	case fieldStep:
+		if m, ok := v.(map[string]interface{}); ok {
+			if field, ok := m[st.field]; ok {
+				return []interface{}{field}
+			}
+		}
+	case indexStep:
+		if list, ok := v.([]interface{}); ok {
+			i := st.index
+			if i < 0 {
+				i += len(list)
+			}
+			if i >= 0 && i < len(list) {
+				return []interface{}{list[i]}
+			}
+		}
+	case wildcardStep:
+		switch t := v.(type) {
+		case []interface{}:
+			return t
+		case map[string]interface{}:
+			var keys []string
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var values []interface{}
+			for _, k := range keys {
+				values = append(values, t[k])
+			}
+			return values
+		}
+	case filterStep:
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		var values []interface{}
+		for _, e := range list {
+			if st.filter.matches(e) {
+				values = append(values, e)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func (f *filter) matches(v interface{}) bool {
+	results := evaluate(f.path, v)
+	if len(f.op) == 0 {
+		return len(results) != 0
+	}
+	for _, r := range results {
+		if compare(r, f.op, f.operand) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(v interface{}, op string, operand interface{}) bool {
+	switch o := operand.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		return compareOrdered(strings.Compare(s, o), op)
+	case bool:
+		b, ok := v.(bool)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return b == o
+		case "!=":
+			return b != o
+		}
+		return false
+	case float64:
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return false
+		}
+		switch {
+		case f < o:
+			return compareOrdered(-1, op)
+		case f > o:
+			return compareOrdered(1, op)
+		}
+		return compareOrdered(0, op)
+	}
+	return false
+}
+
+func compareOrdered(c int, op string) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func format(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case nil:
+		return "", nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal value to json: %v", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonpath_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/platform9/cctl/pkg/util/jsonpath"
+)
+
+var obj = map[string]interface{}{
+	"items": []interface{}{
+		map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "10.0.0.1"},
+			"spec":     map[string]interface{}{"roles": []interface{}{"master"}, "port": 22},
+		},
+		map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "10.0.0.2"},
+			"spec":     map[string]interface{}{"roles": []interface{}{"node"}, "port": 2222},
+		},
+	},
+}
+
+func TestExecute(t *testing.T) {
+	tcs := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"field", "{.items[0].metadata.name}", "10.0.0.1"},
+		{"negative index", "{.items[-1].metadata.name}", "10.0.0.2"},
+		{"wildcard", "{.items[*].metadata.name}", "10.0.0.1 10.0.0.2"},
+		{"list value", "{.items[0].spec.roles}", `["master"]`},
+		{"number", "{.items[1].spec.port}", "2222"},
+		{"filter string", `{.items[?(@.spec.roles[0]=="node")].metadata.name}`, "10.0.0.2"},
+		{"filter number", `{.items[?(@.spec.port>100)].metadata.name}`, "10.0.0.2"},
+		{"filter existence", `{.items[?(@.spec.port)].metadata.name}`, "10.0.0.1 10.0.0.2"},
+		{"quoted field", "{.items[0]['metadata'].name}", "10.0.0.1"},
+		{"range", `{range .items[*]}{.metadata.name}{"\t"}{.spec.roles[0]}{"\n"}{end}`, "10.0.0.1\tmaster\n10.0.0.2\tnode\n"},
+		{"range list", `{range .items}[{.metadata.name}]{end}`, "[10.0.0.1][10.0.0.2]"},
+		{"text", "name: {.items[0].metadata.name}", "name: 10.0.0.1"},
+		{"missing", "{.items[0].status}", ""},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			j, err := jsonpath.Parse(tc.template)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := j.Execute(&buf, obj); err != nil {
+				t.Fatalf("unexpected execute error: %v", err)
+			}
+			if buf.String() != tc.expected {
+				t.Fatalf("expected %q, found %q", tc.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, template := range []string{"{.items", "{range .items}", "{end}", "{.items[x]}", `{"unterminated}`} {
+		if _, err := jsonpath.Parse(template); err == nil {
+			t.Errorf("expected error parsing %q", template)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keepalived reads and corrects the VRRP instance in the keepalived
+// configuration that holds the VIP of the cluster.
+package keepalived
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxAuthPassLength is the length of the longest VRRP password. keepalived
+// ignores the rest of longer passwords.
+const MaxAuthPassLength = 8
+
+// Config is the configuration of a VRRP instance.
+type Config struct {
+	State        string
+	Interface    string
+	RouterID     int
+	Priority     int
+	VIPs         []string
+	AuthPass     string
+	UnicastPeers []string
+}
+
+// Expected is the configuration of the VRRP instance that is derived from the
+// state. Fields that are empty are not checked. An empty, but not nil, list of
+// unicast peers is checked.
+type Expected struct {
+	Interface    string
+	RouterID     int
+	VIP          string
+	Priority     int
+	AuthPass     string
+	UnicastPeers []string
+}
+
+// Settings are the VRRP settings of the cluster that replace the defaults of
+// the configuration on every master. Settings that are empty keep the
+// defaults.
+type Settings struct {
+	Priority int `json:"priority,omitempty"`
+	// AuthPass is not kept with the other settings, because it is a secret.
+	AuthPass     string   `json:"-"`
+	UnicastPeers []string `json:"unicastPeers,omitempty"`
+}
+
+// Validate returns an error if a setting is not valid.
+func (s Settings) Validate() error {
+	if s.Priority < 0 || s.Priority > 254 {
+		return fmt.Errorf("priority %d must be between [1,254]", s.Priority)
+	}
+	if len(s.AuthPass) > MaxAuthPassLength {
+		return fmt.Errorf("password must be at most %d characters", MaxAuthPassLength)
+	}
+	if strings.ContainsAny(s.AuthPass, " \t\n#!{}") {
+		return fmt.Errorf("password must not contain whitespace, or any of #!{}")
+	}
+	for _, peer := range s.UnicastPeers {
+		if net.ParseIP(peer) == nil {
+			return fmt.Errorf("unicast peer %q is not a valid IP", peer)
+		}
+	}
+	return nil
+}
+
+// ExpectedFor returns the expected configuration of the master with the IP:
+// the settings, with the master removed from the unicast peers.
+func (s Settings) ExpectedFor(ip string) Expected {
+	e := Expected{
+		Priority: s.Priority,
+		AuthPass: s.AuthPass,
+	}
+	if len(s.UnicastPeers) != 0 {
+		e.UnicastPeers = []string{}
+		for _, peer := range s.UnicastPeers {
+			if peer != ip {
+				e.UnicastPeers = append(e.UnicastPeers, peer)
+			}
+		}
+	}
+	return e
+}
+
+// Parse returns the configuration of the first VRRP instance.
+func Parse(data []byte) (Config, error) {
+	var c Config
+	var inInstance, found bool
+	// block is the nested block of the instance being read.
+	var block string
+	depth := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(stripComment(line))
+		if len(fields) == 0 {
+			continue
+		}
+		if !inInstance {
+			if fields[0] == "vrrp_instance" && !found {
+				inInstance, found = true, true
+				depth = braces(line)
+			}
+			continue
+		}
+		switch {
+		case block == "virtual_ipaddress":
+			if fields[0] != "}" {
+				c.VIPs = append(c.VIPs, strings.SplitN(fields[0], "/", 2)[0])
+			}
+		case block == "unicast_peer":
+			if fields[0] != "}" {
+				c.UnicastPeers = append(c.UnicastPeers, fields[0])
+			}
+		case block == "authentication":
+			if fields[0] == "auth_pass" && len(fields) > 1 {
+				c.AuthPass = fields[1]
+			}
+		case len(block) != 0:
+		case fields[0] == "state" && len(fields) > 1:
+			c.State = fields[1]
+		case fields[0] == "interface" && len(fields) > 1:
+			c.Interface = fields[1]
+		case fields[0] == "virtual_router_id" && len(fields) > 1:
+			id, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return c, fmt.Errorf("invalid virtual_router_id %q", fields[1])
+			}
+			c.RouterID = id
+		case fields[0] == "priority" && len(fields) > 1:
+			p, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return c, fmt.Errorf("invalid priority %q", fields[1])
+			}
+			c.Priority = p
+		}
+		depth += braces(line)
+		switch {
+		case depth <= 0:
+			inInstance = false
+		case depth == 1:
+			block = ""
+		case len(block) == 0:
+			block = fields[0]
+		}
+	}
+	if !found {
+		return c, fmt.Errorf("no vrrp_instance found")
+	}
+	return c, nil
+}
+
+// Drift returns a description of every difference between the configuration
+// and the expected configuration.
+func Drift(c Config, expected Expected) []string {
+	var drift []string
+	if len(expected.Interface) != 0 && c.Interface != expected.Interface {
+		drift = append(drift, fmt.Sprintf("interface %q, expected %q", c.Interface, expected.Interface))
+	}
+	if expected.RouterID != 0 && c.RouterID != expected.RouterID {
+		drift = append(drift, fmt.Sprintf("virtual_router_id %d, expected %d", c.RouterID, expected.RouterID))
+	}
+	if len(expected.VIP) != 0 && !containsString(c.VIPs, expected.VIP) {
+		drift = append(drift, fmt.Sprintf("virtual_ipaddress %v, expected %s", c.VIPs, expected.VIP))
+	}
+	if expected.Priority != 0 && c.Priority != expected.Priority {
+		drift = append(drift, fmt.Sprintf("priority %d, expected %d", c.Priority, expected.Priority))
+	}
+	// The password is not described, because it is a secret.
+	if len(expected.AuthPass) != 0 && c.AuthPass != expected.AuthPass {
+		drift = append(drift, "auth_pass differs")
+	}
+	if expected.UnicastPeers != nil && !sameAddresses(c.UnicastPeers, expected.UnicastPeers) {
+		drift = append(drift, fmt.Sprintf("unicast_peer %v, expected %v", c.UnicastPeers, expected.UnicastPeers))
+	}
+	return drift
+}
+
+// Reconcile returns the configuration with the interface, virtual router ID,
+// VIP, priority, password, and unicast peers of the first VRRP instance set
+// to the expected values. The priority, authentication, and unicast_peer
+// settings are added to the instance if it does not have them. Other
+// settings, e.g. the state, are kept.
+func Reconcile(data []byte, expected Expected) []byte {
+	var out []string
+	var inInstance, found, vipReplaced, hasPriority, hasAuth, hasPeers, hasAuthPass bool
+	var block string
+	// peerLines are the lines of the unicast_peer block, kept if the peers
+	// do not change.
+	var peerLines, peers []string
+	indent := "    "
+	depth := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(stripComment(line))
+		if !inInstance {
+			if len(fields) != 0 && fields[0] == "vrrp_instance" && !found {
+				inInstance, found = true, true
+				depth = braces(line)
+			}
+			out = append(out, line)
+			continue
+		}
+		if len(fields) == 0 {
+			if block == "unicast_peer" {
+				peerLines = append(peerLines, line)
+			} else {
+				out = append(out, line)
+			}
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		depth += braces(line)
+		if len(block) != 0 {
+			if depth <= 1 {
+				// The line closes the block.
+				switch block {
+				case "authentication":
+					if !hasAuthPass && len(expected.AuthPass) != 0 {
+						out = append(out, indent+indent+"auth_pass "+expected.AuthPass)
+					}
+				case "unicast_peer":
+					if expected.UnicastPeers != nil && !sameAddresses(peers, expected.UnicastPeers) {
+						peerLines = addressLines(indent+indent, expected.UnicastPeers)
+					}
+					out = append(out, peerLines...)
+				}
+				out = append(out, line)
+				block = ""
+				continue
+			}
+			switch {
+			case block == "virtual_ipaddress" && !vipReplaced:
+				if address, changed := reconcileAddress(fields, expected); changed {
+					line = lineIndent + address
+				}
+				vipReplaced = true
+			case block == "authentication" && fields[0] == "auth_type" && len(expected.AuthPass) != 0:
+				line = lineIndent + "auth_type PASS"
+			case block == "authentication" && fields[0] == "auth_pass" && len(expected.AuthPass) != 0:
+				line = lineIndent + "auth_pass " + expected.AuthPass
+				hasAuthPass = true
+			case block == "unicast_peer":
+				peers = append(peers, fields[0])
+				peerLines = append(peerLines, line)
+				continue
+			}
+			out = append(out, line)
+			continue
+		}
+		if depth <= 0 {
+			// The line closes the instance.
+			if !hasPriority && expected.Priority != 0 {
+				out = append(out, indent+"priority "+strconv.Itoa(expected.Priority))
+			}
+			if !hasAuth && len(expected.AuthPass) != 0 {
+				out = append(out, indent+"authentication {", indent+indent+"auth_type PASS", indent+indent+"auth_pass "+expected.AuthPass, indent+"}")
+			}
+			if !hasPeers && expected.UnicastPeers != nil {
+				out = append(out, indent+"unicast_peer {")
+				out = append(out, addressLines(indent+indent, expected.UnicastPeers)...)
+				out = append(out, indent+"}")
+			}
+			out = append(out, line)
+			inInstance = false
+			continue
+		}
+		indent = lineIndent
+		switch {
+		case fields[0] == "interface" && len(fields) > 1 && len(expected.Interface) != 0 && fields[1] != expected.Interface:
+			line = indent + "interface " + expected.Interface
+		case fields[0] == "virtual_router_id" && len(fields) > 1 && expected.RouterID != 0 && fields[1] != strconv.Itoa(expected.RouterID):
+			line = indent + "virtual_router_id " + strconv.Itoa(expected.RouterID)
+		case fields[0] == "priority":
+			hasPriority = true
+			if len(fields) > 1 && expected.Priority != 0 && fields[1] != strconv.Itoa(expected.Priority) {
+				line = indent + "priority " + strconv.Itoa(expected.Priority)
+			}
+		case fields[0] == "authentication":
+			hasAuth = true
+		case fields[0] == "unicast_peer":
+			hasPeers = true
+		}
+		out = append(out, line)
+		if depth > 1 {
+			block = fields[0]
+		}
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+// addressLines returns a line, with the indent, for every address.
+func addressLines(indent string, addresses []string) []string {
+	lines := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		lines = append(lines, indent+a)
+	}
+	return lines
+}
+
+// braces returns the number of blocks the line opens, less the number it
+// closes.
+func braces(line string) int {
+	line = stripComment(line)
+	return strings.Count(line, "{") - strings.Count(line, "}")
+}
+
+// sameAddresses returns true if the lists have the same addresses, in any
+// order.
+func sameAddresses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reconcileAddress returns the virtual_ipaddress line with the address, and
+// the device it is assigned to, set to the expected values, and whether it
+// changed.
+func reconcileAddress(fields []string, expected Expected) (string, bool) {
+	changed := false
+	address := strings.SplitN(fields[0], "/", 2)
+	if len(expected.VIP) != 0 && address[0] != expected.VIP {
+		address[0] = expected.VIP
+		fields[0] = strings.Join(address, "/")
+		changed = true
+	}
+	for j := 1; j < len(fields)-1; j++ {
+		if fields[j] == "dev" && len(expected.Interface) != 0 && fields[j+1] != expected.Interface {
+			fields[j+1] = expected.Interface
+			changed = true
+		}
+	}
+	return strings.Join(fields, " "), changed
+}
+
+func stripComment(line string) string {
+	if i := strings.IndexAny(line, "#!"); i >= 0 {
+		return line[:i]
+	}
+	return line
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keepalived
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const config = `global_defs {
+  router_id LVS_DEVEL
+}
+
+vrrp_script check_apiserver {
+  script "/etc/keepalived/check_apiserver.sh"
+  interval 3
+}
+
+vrrp_instance VI_1 {
+    state BACKUP
+    interface eth0 # the NIC
+    virtual_router_id 51
+    priority 100
+    virtual_ipaddress {
+        10.0.0.100/32 dev eth0
+    }
+    track_script {
+        check_apiserver
+    }
+}
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	expected := Config{
+		State:     "BACKUP",
+		Interface: "eth0",
+		RouterID:  51,
+		Priority:  100,
+		VIPs:      []string{"10.0.0.100"},
+	}
+	if !cmp.Equal(expected, c) {
+		t.Fatalf("expected %+v, found %+v", expected, c)
+	}
+	if _, err := Parse([]byte("global_defs {\n}\n")); err == nil {
+		t.Fatalf("expected error for a configuration without a vrrp_instance")
+	}
+}
+
+func TestDrift(t *testing.T) {
+	c, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	if drift := Drift(c, Expected{Interface: "eth0", RouterID: 51, VIP: "10.0.0.100"}); len(drift) != 0 {
+		t.Fatalf("expected no drift, found %v", drift)
+	}
+	if drift := Drift(c, Expected{VIP: "10.0.0.100"}); len(drift) != 0 {
+		t.Fatalf("expected unset fields not to be checked, found %v", drift)
+	}
+	drift := Drift(c, Expected{Interface: "ens3", RouterID: 52, VIP: "10.0.0.200"})
+	if len(drift) != 3 {
+		t.Fatalf("expected 3 differences, found %v", drift)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	expected := Expected{Interface: "ens3", RouterID: 52, VIP: "10.0.0.200"}
+	reconciled := Reconcile([]byte(config), expected)
+	c, err := Parse(reconciled)
+	if err != nil {
+		t.Fatalf("unable to parse reconciled configuration: %v", err)
+	}
+	if drift := Drift(c, expected); len(drift) != 0 {
+		t.Fatalf("expected no drift after reconciling, found %v\n%s", drift, reconciled)
+	}
+	if c.Priority != 100 || c.State != "BACKUP" {
+		t.Fatalf("expected priority and state to be kept, found %+v", c)
+	}
+	// The router_id of global_defs is not the virtual router ID.
+	if !cmp.Equal(Reconcile([]byte(config), Expected{Interface: "eth0", RouterID: 51, VIP: "10.0.0.100"}), []byte(config)) {
+		t.Fatalf("expected configuration without drift to be unchanged, found\n%s", Reconcile([]byte(config), Expected{Interface: "eth0", RouterID: 51, VIP: "10.0.0.100"}))
+	}
+}
+
+const unicastConfig = `vrrp_instance VI_1 {
+	state BACKUP
+	interface eth0
+	virtual_router_id 51
+	priority 100
+	authentication {
+		auth_type PASS
+		auth_pass secret
+	}
+	unicast_peer {
+		10.0.0.2
+		10.0.0.3
+	}
+	virtual_ipaddress {
+		10.0.0.100
+	}
+}
+`
+
+func TestParseSettings(t *testing.T) {
+	c, err := Parse([]byte(unicastConfig))
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	expected := Config{
+		State:        "BACKUP",
+		Interface:    "eth0",
+		RouterID:     51,
+		Priority:     100,
+		VIPs:         []string{"10.0.0.100"},
+		AuthPass:     "secret",
+		UnicastPeers: []string{"10.0.0.2", "10.0.0.3"},
+	}
+	if !cmp.Equal(expected, c) {
+		t.Fatalf("expected %+v, found %+v", expected, c)
+	}
+}
+
+func TestReconcileSettings(t *testing.T) {
+	settings := Settings{Priority: 150, AuthPass: "cluster1", UnicastPeers: []string{"10.0.0.1", "10.0.0.3", "10.0.0.4"}}
+	expected := settings.ExpectedFor("10.0.0.1")
+	if !cmp.Equal(expected.UnicastPeers, []string{"10.0.0.3", "10.0.0.4"}) {
+		t.Fatalf("expected the master to be removed from its unicast peers, found %v", expected.UnicastPeers)
+	}
+	for name, data := range map[string]string{"added": config, "replaced": unicastConfig} {
+		reconciled := Reconcile([]byte(data), expected)
+		c, err := Parse(reconciled)
+		if err != nil {
+			t.Fatalf("%s: unable to parse reconciled configuration: %v", name, err)
+		}
+		if drift := Drift(c, expected); len(drift) != 0 {
+			t.Fatalf("%s: expected no drift after reconciling, found %v\n%s", name, drift, reconciled)
+		}
+		if c.State != "BACKUP" || !cmp.Equal(c.VIPs, []string{"10.0.0.100"}) {
+			t.Fatalf("%s: expected state and VIP to be kept, found %+v", name, c)
+		}
+		if !cmp.Equal(Reconcile(reconciled, expected), reconciled) {
+			t.Fatalf("%s: expected reconciled configuration to be unchanged, found\n%s", name, Reconcile(reconciled, expected))
+		}
+	}
+	c, err := Parse([]byte(unicastConfig))
+	if err != nil {
+		t.Fatalf("unable to parse: %v", err)
+	}
+	drift := Drift(c, expected)
+	if len(drift) != 3 {
+		t.Fatalf("expected 3 differences, found %v", drift)
+	}
+	for _, d := range drift {
+		if strings.Contains(d, "secret") || strings.Contains(d, "cluster1") {
+			t.Fatalf("expected drift not to describe the password, found %q", d)
+		}
+	}
+	// Peers are compared in any order.
+	if drift := Drift(c, Expected{UnicastPeers: []string{"10.0.0.3", "10.0.0.2"}}); len(drift) != 0 {
+		t.Fatalf("expected no drift, found %v", drift)
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	valid := Settings{Priority: 100, AuthPass: "12345678", UnicastPeers: []string{"10.0.0.1"}}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid settings, found %v", err)
+	}
+	for _, s := range []Settings{
+		{Priority: 255},
+		{AuthPass: "123456789"},
+		{AuthPass: "a b"},
+		{UnicastPeers: []string{"master-1"}},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Fatalf("expected settings %+v to be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keychain stores and retrieves secrets using the OS keychain: the
+// macOS Keychain, the Secret Service (libsecret) on Linux, or the Windows
+// Credential Manager. It uses the command line tools that ship with each OS,
+// so no OS-specific libraries are required to build cctl.
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// Service is the service under which cctl secrets are stored.
+const Service = "cctl"
+
+// ErrNotFound is returned when the keychain has no secret for the account.
+var ErrNotFound = errors.New("secret not found in keychain")
+
+// Get returns the secret stored for the account.
+func Get(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", Service, "account", account)
+	case "windows":
+		cmd = powershell(fmt.Sprintf(`%s; try { $c = $v.Retrieve('%s', '%s') } catch { exit 44 }; $c.RetrievePassword(); [Console]::Out.Write($c.Password)`, passwordVault, Service, account))
+	default:
+		return "", fmt.Errorf("keychain is not supported on %s", runtime.GOOS)
+	}
+	stdOut, err := run(cmd, "")
+	if err != nil {
+		if cmdErr, ok := err.(*commandError); ok && isNotFound(cmdErr.err) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	secret := strings.TrimSuffix(stdOut, "\n")
+	if len(secret) == 0 {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// Set stores the secret for the account, replacing any existing secret.
+func Set(account, secret string) error {
+	cmd, stdIn, err := setCommand(runtime.GOOS, account, secret)
+	if err != nil {
+		return err
+	}
+	if _, err := run(cmd, stdIn); err != nil {
+		return err
+	}
+	// In interactive mode, security does not exit with an error when one of
+	// its commands fails, so the secret is read back.
+	if runtime.GOOS == "darwin" {
+		stored, err := Get(account)
+		if err != nil {
+			return fmt.Errorf("unable to verify stored secret: %v", err)
+		}
+		if stored != secret {
+			return fmt.Errorf("unable to store secret: keychain returned a different secret")
+		}
+	}
+	return nil
+}
+
+// setCommand returns the command that stores the secret, and its input. The
+// secret is always given on the input, never as an argument, which every user
+// of the host could read from the process list.
+func setCommand(goos, account, secret string) (*exec.Cmd, string, error) {
+	switch goos {
+	case "darwin":
+		// security reads the secret of add-generic-password only from its
+		// arguments, or from the terminal, so the command is given to its
+		// interactive mode on the input instead.
+		if strings.ContainsAny(secret, "\r\n") {
+			return nil, "", fmt.Errorf("secret must not contain line breaks")
+		}
+		return exec.Command("security", "-i"), fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", securityQuote(Service), securityQuote(account), securityQuote(secret)), nil
+	case "linux":
+		return exec.Command("secret-tool", "store", "--label", fmt.Sprintf("%s %s", Service, account), "service", Service, "account", account), secret, nil
+	case "windows":
+		return powershell(fmt.Sprintf(`%s; $p = [Console]::In.ReadToEnd(); $v.Add((New-Object Windows.Security.Credentials.PasswordCredential('%s', '%s', $p)))`, passwordVault, Service, account)), secret, nil
+	default:
+		return nil, "", fmt.Errorf("keychain is not supported on %s", goos)
+	}
+}
+
+// securityQuote quotes s as one argument of a command of security -i.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Delete removes the secret stored for the account.
+func Delete(account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", Service, "-a", account)
+	case "linux":
+		cmd = exec.Command("secret-tool", "clear", "service", Service, "account", account)
+	case "windows":
+		cmd = powershell(fmt.Sprintf(`%s; try { $v.Remove($v.Retrieve('%s', '%s')) } catch { exit 44 }`, passwordVault, Service, account))
+	default:
+		return fmt.Errorf("keychain is not supported on %s", runtime.GOOS)
+	}
+	if _, err := run(cmd, ""); err != nil {
+		if cmdErr, ok := err.(*commandError); ok && isNotFound(cmdErr.err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// passwordVault loads the Windows Credential Manager API into $v.
+const passwordVault = `[void][Windows.Security.Credentials.PasswordVault,Windows.Security.Credentials,ContentType=WindowsRuntime]; $v = New-Object Windows.Security.Credentials.PasswordVault`
+
+func powershell(script string) *exec.Cmd {
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+func run(cmd *exec.Cmd, stdIn string) (string, error) {
+	var stdOut, stdErr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdIn)
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", &commandError{err: exitErr, stdErr: strings.TrimSpace(stdErr.String())}
+		}
+		return "", fmt.Errorf("unable to run %q: %v", cmd.Args[0], err)
+	}
+	return stdOut.String(), nil
+}
+
+// commandError is returned when the keychain tool exits with an error.
+type commandError struct {
+	err    *exec.ExitError
+	stdErr string
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("%v (%s)", e.err, e.stdErr)
+}
+
+// isNotFound returns true if the keychain tool exited because the secret does
+// not exist. The tools use different exit codes: security uses 44 and
+// secret-tool uses 1; the Windows script exits with 44.
+func isNotFound(err *exec.ExitError) bool {
+	status, ok := err.Sys().(syscall.WaitStatus)
+	if !ok {
+		return false
+	}
+	code := status.ExitStatus()
+	switch runtime.GOOS {
+	case "linux":
+		return code == 1
+	default:
+		return code == 44
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keychain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetCommandKeepsSecretOutOfArguments(t *testing.T) {
+	secret := `s3cr3t "quoted" \ with spaces`
+	for _, goos := range []string{"darwin", "linux", "windows"} {
+		t.Run(goos, func(t *testing.T) {
+			cmd, stdIn, err := setCommand(goos, "ssh-key-passphrase", secret)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, arg := range cmd.Args {
+				if strings.Contains(arg, "s3cr3t") {
+					t.Fatalf("secret found in argument %q", arg)
+				}
+			}
+			if !strings.Contains(stdIn, "s3cr3t") {
+				t.Fatalf("secret not found in input %q", stdIn)
+			}
+		})
+	}
+}
+
+func TestSetCommandDarwin(t *testing.T) {
+	_, stdIn, err := setCommand("darwin", "ssh-key-passphrase", `pa"ss\`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `add-generic-password -U -s "cctl" -a "ssh-key-passphrase" -w "pa\"ss\\"` + "\n"
+	if stdIn != expected {
+		t.Fatalf("expected %q, found %q", expected, stdIn)
+	}
+	if _, _, err := setCommand("darwin", "ssh-key-passphrase", "line\nbreak"); err == nil {
+		t.Fatalf("expected error for a secret with a line break")
+	}
+}
+
+func TestSetCommandUnsupported(t *testing.T) {
+	if _, _, err := setCommand("plan9", "ssh-key-passphrase", "secret"); err == nil {
+		t.Fatalf("expected error for an unsupported OS")
+	}
+}
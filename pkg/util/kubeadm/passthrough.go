@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeadm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PassthroughConfiguration is the subset of the kubeadm ClusterConfiguration
+// (v1alpha3), or MasterConfiguration (v1alpha2), that is passed through to
+// the kubeadm configuration generated for masters.
+type PassthroughConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	APIServerExtraArgs         map[string]string `json:"apiServerExtraArgs,omitempty"`
+	ControllerManagerExtraArgs map[string]string `json:"controllerManagerExtraArgs,omitempty"`
+	SchedulerExtraArgs         map[string]string `json:"schedulerExtraArgs,omitempty"`
+}
+
+// passthroughKinds are the kinds of kubeadm configuration that can be passed
+// through.
+var passthroughKinds = map[string]bool{
+	"":                     true,
+	"ClusterConfiguration": true,
+	"MasterConfiguration":  true,
+}
+
+// ParsePassthroughConfiguration parses a YAML or JSON kubeadm configuration.
+// Fields that cannot be passed through are rejected.
+func ParsePassthroughConfiguration(data []byte) (*PassthroughConfiguration, error) {
+	j, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode kubeadm configuration: %v", err)
+	}
+	var c PassthroughConfiguration
+	d := json.NewDecoder(bytes.NewReader(j))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return nil, fmt.Errorf("unable to decode kubeadm configuration: %v. Only apiServerExtraArgs, controllerManagerExtraArgs, and schedulerExtraArgs are supported; set feature gates with the feature-gates extra argument of each component", err)
+	}
+	if !passthroughKinds[c.Kind] {
+		return nil, fmt.Errorf("kind is %s, must be ClusterConfiguration or MasterConfiguration", c.Kind)
+	}
+	return &c, nil
+}
+
+// ApplyTo merges the extra arguments into those of the cluster
+// configuration, replacing arguments with the same name.
+func (c *PassthroughConfiguration) ApplyTo(clusterConfig *spv1.ClusterConfig) {
+	clusterConfig.KubeAPIServer = mergeArgs(clusterConfig.KubeAPIServer, c.APIServerExtraArgs)
+	clusterConfig.KubeControllerManager = mergeArgs(clusterConfig.KubeControllerManager, c.ControllerManagerExtraArgs)
+	clusterConfig.KubeScheduler = mergeArgs(clusterConfig.KubeScheduler, c.SchedulerExtraArgs)
+}
+
+func mergeArgs(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	merged := make(map[string]string, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range src {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubeadm_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/kubeadm"
+)
+
+func TestPassthroughConfiguration(t *testing.T) {
+	c, err := kubeadm.ParsePassthroughConfiguration([]byte(`apiVersion: kubeadm.k8s.io/v1alpha3
+kind: ClusterConfiguration
+apiServerExtraArgs:
+  feature-gates: TTLAfterFinished=true
+  service-node-port-range: 30000-32767
+schedulerExtraArgs:
+  v: "4"
+`))
+	if err != nil {
+		t.Fatalf("unable to parse configuration: %v", err)
+	}
+	// The cluster configuration defaults are shared, so they must not be
+	// changed in place.
+	defaults := map[string]string{"service-node-port-range": "80-32767", "audit-log-maxage": "30"}
+	clusterConfig := &spv1.ClusterConfig{KubeAPIServer: defaults}
+	c.ApplyTo(clusterConfig)
+	expected := &spv1.ClusterConfig{
+		KubeAPIServer: map[string]string{"service-node-port-range": "30000-32767", "audit-log-maxage": "30", "feature-gates": "TTLAfterFinished=true"},
+		KubeScheduler: map[string]string{"v": "4"},
+	}
+	if diff := cmp.Diff(expected, clusterConfig); diff != "" {
+		t.Errorf("unexpected cluster configuration (-expected +found):\n%s", diff)
+	}
+	if defaults["service-node-port-range"] != "80-32767" {
+		t.Errorf("expected the original arguments not to change")
+	}
+
+	for _, invalid := range []string{
+		"kind: JoinConfiguration\n",
+		"featureGates:\n  CoreDNS: true\n",
+		"apiServerExtraArgs: [a]\n",
+	} {
+		if _, err := kubeadm.ParsePassthroughConfiguration([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
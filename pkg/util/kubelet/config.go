@@ -0,0 +1,184 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kubelet merges per-machine overrides into the kubelet configuration
+// that kubeadm writes on a machine.
+package kubelet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/ghodss/yaml"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+)
+
+// Kind is the kind of the kubelet configuration.
+const Kind = "KubeletConfiguration"
+
+// Overrides is a fragment of a kubelet configuration, e.g.
+//
+//	maxPods: 110
+//	evictionHard:
+//	  memory.available: 500Mi
+type Overrides map[string]interface{}
+
+// ParseOverrides parses a YAML or JSON fragment of a kubelet configuration.
+// Fields that the kubelet configuration does not have, or values of the wrong
+// type, are rejected.
+func ParseOverrides(data []byte) (Overrides, error) {
+	var o Overrides
+	if err := yaml.Unmarshal(data, &o); err != nil {
+		return nil, fmt.Errorf("unable to decode kubelet configuration: %v", err)
+	}
+	if len(o) == 0 {
+		return nil, fmt.Errorf("kubelet configuration is empty")
+	}
+	if kind, ok := o["kind"]; ok && kind != Kind {
+		return nil, fmt.Errorf("kind is %v, must be %s", kind, Kind)
+	}
+	delete(o, "kind")
+	delete(o, "apiVersion")
+	if err := validate(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// validate returns an error if the overrides do not decode strictly into a
+// kubelet configuration.
+func validate(o Overrides) error {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return fmt.Errorf("unable to encode kubelet configuration: %v", err)
+	}
+	var c spv1.KubeletConfiguration
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return fmt.Errorf("invalid kubelet configuration: %v", err)
+	}
+	return nil
+}
+
+// Merge returns the YAML kubelet configuration with the overrides merged
+// into it. Nested maps are merged key by key; any other value in the
+// overrides, including a list, replaces the value in the configuration. If
+// nothing changes, changed is false.
+func Merge(config []byte, o Overrides) (merged []byte, changed bool, err error) {
+	original, c, err := merge(config, o)
+	if err != nil {
+		return nil, false, err
+	}
+	if reflect.DeepEqual(original, c) {
+		return config, false, nil
+	}
+	merged, err = yaml.Marshal(c)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to encode kubelet configuration: %v", err)
+	}
+	return merged, true, nil
+}
+
+// disruptiveFields are the fields of the kubelet configuration that change
+// how the kubelet manages the containers of running pods, so that changing
+// them requires the node to be drained, rather than the kubelet restarted.
+var disruptiveFields = map[string]bool{
+	"cgroupDriver":           true,
+	"cgroupRoot":             true,
+	"cgroupsPerQOS":          true,
+	"cpuManagerPolicy":       true,
+	"enforceNodeAllocatable": true,
+	"kubeReservedCgroup":     true,
+	"kubeletCgroups":         true,
+	"staticPodPath":          true,
+	"systemCgroups":          true,
+	"systemReservedCgroup":   true,
+}
+
+// ChangedFields returns the top-level fields of the YAML kubelet
+// configuration that merging the overrides into it changes, and those of them
+// that cannot be changed by restarting the kubelet, each sorted.
+func ChangedFields(config []byte, o Overrides) (changed, disruptive []string, err error) {
+	original, c, err := merge(config, o)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range c {
+		if reflect.DeepEqual(original[k], v) {
+			continue
+		}
+		changed = append(changed, k)
+		if disruptiveFields[k] {
+			disruptive = append(disruptive, k)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(disruptive)
+	return changed, disruptive, nil
+}
+
+// merge decodes the YAML kubelet configuration, and returns it before and
+// after the overrides are merged into it.
+func merge(config []byte, o Overrides) (original, merged map[string]interface{}, err error) {
+	var c map[string]interface{}
+	if err := yaml.Unmarshal(config, &c); err != nil {
+		return nil, nil, fmt.Errorf("unable to decode kubelet configuration: %v", err)
+	}
+	if c == nil {
+		c = make(map[string]interface{})
+	}
+	// The overrides are round-tripped through JSON, so that their values
+	// have the same types as those of the decoded configuration.
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode kubelet configuration overrides: %v", err)
+	}
+	var overrides map[string]interface{}
+	if err := json.Unmarshal(b, &overrides); err != nil {
+		return nil, nil, fmt.Errorf("unable to decode kubelet configuration overrides: %v", err)
+	}
+	original = deepCopy(c)
+	mergeMaps(c, overrides)
+	return original, c, nil
+}
+
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+func deepCopy(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if vm, ok := v.(map[string]interface{}); ok {
+			v = deepCopy(vm)
+		}
+		c[k] = v
+	}
+	return c
+}
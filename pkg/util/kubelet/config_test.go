@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubelet_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/platform9/cctl/pkg/util/kubelet"
+)
+
+const config = `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 500
+evictionHard:
+  imagefs.available: 15%
+  memory.available: 100Mi
+`
+
+func TestParseOverrides(t *testing.T) {
+	o, err := kubelet.ParseOverrides([]byte("kind: KubeletConfiguration\nmaxPods: 110\n"))
+	if err != nil {
+		t.Fatalf("unable to parse overrides: %v", err)
+	}
+	if _, ok := o["kind"]; ok || len(o) != 1 {
+		t.Errorf("unexpected overrides %v", o)
+	}
+	for _, invalid := range []string{
+		"",
+		"kind: Pod\nmaxPods: 110\n",
+		"maxPod: 110\n",
+		"maxPods: many\n",
+		"- maxPods\n",
+	} {
+		if _, err := kubelet.ParseOverrides([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	o, err := kubelet.ParseOverrides([]byte("maxPods: 110\nevictionHard:\n  memory.available: 500Mi\nsystemReserved:\n  cpu: 500m\n"))
+	if err != nil {
+		t.Fatalf("unable to parse overrides: %v", err)
+	}
+	merged, changed, err := kubelet.Merge([]byte(config), o)
+	if err != nil {
+		t.Fatalf("unable to merge: %v", err)
+	}
+	if !changed {
+		t.Errorf("expected the configuration to change")
+	}
+	var c struct {
+		Kind           string            `json:"kind"`
+		MaxPods        int               `json:"maxPods"`
+		EvictionHard   map[string]string `json:"evictionHard"`
+		SystemReserved map[string]string `json:"systemReserved"`
+	}
+	if err := yaml.Unmarshal(merged, &c); err != nil {
+		t.Fatalf("unable to decode merged configuration: %v", err)
+	}
+	if c.Kind != kubelet.Kind || c.MaxPods != 110 || c.EvictionHard["memory.available"] != "500Mi" || c.EvictionHard["imagefs.available"] != "15%" || c.SystemReserved["cpu"] != "500m" {
+		t.Errorf("unexpected merged configuration:\n%s", merged)
+	}
+
+	again, changed, err := kubelet.Merge(merged, o)
+	if err != nil {
+		t.Fatalf("unable to merge: %v", err)
+	}
+	if changed || string(again) != string(merged) {
+		t.Errorf("expected merging again to change nothing")
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	o, err := kubelet.ParseOverrides([]byte("maxPods: 500\nevictionHard:\n  memory.available: 500Mi\ncpuManagerPolicy: static\n"))
+	if err != nil {
+		t.Fatalf("unable to parse overrides: %v", err)
+	}
+	changed, disruptive, err := kubelet.ChangedFields([]byte(config), o)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(changed, ",") != "cpuManagerPolicy,evictionHard" {
+		t.Errorf("unexpected changed fields %v", changed)
+	}
+	if strings.Join(disruptive, ",") != "cpuManagerPolicy" {
+		t.Errorf("unexpected disruptive fields %v", disruptive)
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lease implements an operation lease, held by a file, that a command
+// changing a cluster holds while it runs. The holder renews the lease with
+// heartbeats; a lease that is not renewed before its TTL expires can be taken
+// over, so a holder that crashed, on any host, does not block the cluster.
+package lease
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrReadOnly is returned when the lease file cannot be created because the
+// file system is read-only.
+var ErrReadOnly = errors.New("lease file cannot be created on a read-only file system")
+
+// turnSuffix is appended to the lease file to name the file that is held
+// while the lease file is changed.
+const turnSuffix = ".turn"
+
+// staleTurn is how old a turn file must be to be removed, and turnInterval
+// how often a held turn file is checked.
+const (
+	staleTurn    = time.Minute
+	turnInterval = 10 * time.Millisecond
+)
+
+// ErrLost is returned when the lease was taken over by another holder.
+var ErrLost = errors.New("lease was taken over by another holder")
+
+// Lease describes the holder of the lease and the operation it runs.
+type Lease struct {
+	// ID identifies the acquisition of the lease.
+	ID string `json:"id"`
+	// Holder is the user and host that run the operation.
+	Holder string `json:"holder"`
+	// PID is the process that runs the operation.
+	PID int `json:"pid"`
+	// Operation is the command that holds the lease.
+	Operation string `json:"operation"`
+	// Acquired is when the lease was acquired.
+	Acquired time.Time `json:"acquired"`
+	// Renewed is when the last heartbeat renewed the lease.
+	Renewed time.Time `json:"renewed"`
+	// Expires is when the lease can be taken over, unless it is renewed.
+	Expires time.Time `json:"expires"`
+}
+
+// Expired returns true if the lease can be taken over at the time.
+func (l Lease) Expired(now time.Time) bool {
+	return now.After(l.Expires)
+}
+
+func (l Lease) String() string {
+	return fmt.Sprintf("%s (process %d) running %q since %s", l.Holder, l.PID, l.Operation, l.Acquired.Format(time.RFC3339))
+}
+
+// heldError is returned when the lease is held by another holder.
+type heldError struct {
+	path  string
+	lease Lease
+}
+
+func (e *heldError) Error() string {
+	return fmt.Sprintf("the cluster is being changed by %s. The lease %q expires at %s, unless it is renewed", e.lease, e.path, e.lease.Expires.Format(time.RFC3339))
+}
+
+// IsHeld returns true if the error was returned because the lease is held by
+// another holder.
+func IsHeld(err error) bool {
+	_, ok := err.(*heldError)
+	return ok
+}
+
+// Handle is an acquired lease.
+type Handle struct {
+	// OnRenew, if set, is called after the lease file is renewed, e.g. to
+	// publish it to other hosts. If it fails, the renewal fails.
+	OnRenew func() error
+
+	path string
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	lease Lease
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Acquire creates the lease file. If the lease is held by another holder and
+// has not expired, it returns an error for which IsHeld is true. An expired
+// lease is taken over, and the previous lease is returned with the handle.
+func Acquire(path, holder, operation string, ttl time.Duration) (*Handle, *Lease, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now().UTC()
+	h := &Handle{
+		path: path,
+		ttl:  ttl,
+		lease: Lease{
+			ID:        id,
+			Holder:    holder,
+			PID:       os.Getpid(),
+			Operation: operation,
+			Acquired:  now,
+			Renewed:   now,
+			Expires:   now.Add(ttl),
+		},
+	}
+	b, err := json.Marshal(h.lease)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode lease: %v", err)
+	}
+	for {
+		err := create(path, id, b)
+		if err == nil {
+			return h, nil, nil
+		}
+		if !os.IsExist(err) {
+			if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.EROFS {
+				return nil, nil, ErrReadOnly
+			}
+			return nil, nil, fmt.Errorf("unable to create lease %q: %v", path, err)
+		}
+		current, err := Read(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if current == nil {
+			// Released since it was checked.
+			continue
+		}
+		if !current.Expired(time.Now()) {
+			return nil, nil, &heldError{path: path, lease: *current}
+		}
+		// Processes that find the same expired lease take turns, and each
+		// reads it again before it takes it over, so that only one of them
+		// does.
+		var taken bool
+		err = withTurn(path, func() error {
+			again, err := Read(path)
+			if err != nil || again == nil || again.ID != current.ID {
+				return err
+			}
+			if err := write(path, id, b); err != nil {
+				return err
+			}
+			taken = true
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if taken {
+			return h, current, nil
+		}
+	}
+}
+
+// Read returns the lease in the file, or nil if the file does not exist.
+func Read(path string) (*Lease, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read lease %q: %v", path, err)
+	}
+	l := &Lease{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, fmt.Errorf("unable to decode lease %q: %v", path, err)
+	}
+	return l, nil
+}
+
+// Lease returns the lease as last written by the handle.
+func (h *Handle) Lease() Lease {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lease
+}
+
+// Renew extends the lease by its TTL. It returns ErrLost if the lease was
+// taken over.
+func (h *Handle) Renew() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now().UTC()
+	renewed := h.lease
+	renewed.Renewed = now
+	renewed.Expires = now.Add(h.ttl)
+	b, err := json.Marshal(renewed)
+	if err != nil {
+		return fmt.Errorf("unable to encode lease: %v", err)
+	}
+	err = withTurn(h.path, func() error {
+		if err := h.verify(); err != nil {
+			return err
+		}
+		return write(h.path, h.lease.ID, b)
+	})
+	if err != nil {
+		return err
+	}
+	h.lease = renewed
+	if h.OnRenew != nil {
+		return h.OnRenew()
+	}
+	return nil
+}
+
+// Heartbeat renews the lease at the interval until the lease is released.
+// Errors are reported to the function, and do not stop the heartbeats.
+func (h *Handle) Heartbeat(interval time.Duration, report func(error)) {
+	h.mu.Lock()
+	if h.stop != nil {
+		h.mu.Unlock()
+		return
+	}
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	stop, done := h.stop, h.done
+	h.mu.Unlock()
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := h.Renew(); err != nil {
+					report(err)
+				}
+			}
+		}
+	}()
+}
+
+// Release stops the heartbeats and removes the lease file, if the lease is
+// still held by the handle.
+func (h *Handle) Release() error {
+	h.mu.Lock()
+	stop, done := h.stop, h.done
+	h.stop = nil
+	h.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return withTurn(h.path, func() error {
+		if err := h.verify(); err != nil {
+			if err == ErrLost {
+				return nil
+			}
+			return err
+		}
+		if err := os.Remove(h.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove lease %q: %v", h.path, err)
+		}
+		return nil
+	})
+}
+
+// verify returns ErrLost if the lease file is not the handle's. It must be
+// called with the mutex held.
+func (h *Handle) verify() error {
+	current, err := Read(h.path)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.ID != h.lease.ID {
+		return ErrLost
+	}
+	return nil
+}
+
+// create creates the lease file, if it does not exist, with its content, so
+// that it is never read empty or partially written.
+func create(path, id string, b []byte) error {
+	tmpPath := path + "." + id
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	return os.Link(tmpPath, path)
+}
+
+// withTurn runs the function while holding the turn file of the lease, so
+// that processes changing the same lease file take turns. A turn file older
+// than staleTurn was left by a process that exited, and is removed.
+func withTurn(path string, f func() error) error {
+	turn := path + turnSuffix
+	for {
+		t, err := os.OpenFile(turn, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			t.Close()
+			break
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("unable to change lease %q: %v", path, err)
+		}
+		if info, err := os.Stat(turn); err == nil && time.Since(info.ModTime()) > staleTurn {
+			os.Remove(turn)
+		}
+		time.Sleep(turnInterval)
+	}
+	defer os.Remove(turn)
+	return f()
+}
+
+// write replaces the lease file atomically, so that it is never read
+// partially written.
+func write(path, id string, b []byte) error {
+	tmpPath := path + "." + id
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		return fmt.Errorf("unable to write lease %q: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("unable to replace lease %q: %v", path, err)
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("unable to generate lease ID: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lease
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempLeasePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lease")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	return filepath.Join(dir, "state.yaml.default.lease"), func() { os.RemoveAll(dir) }
+}
+
+func TestAcquireRelease(t *testing.T) {
+	path, cleanup := tempLeasePath(t)
+	defer cleanup()
+	h, previous, err := Acquire(path, "alice@host1", "cctl upgrade cluster", time.Minute)
+	if err != nil {
+		t.Fatalf("unable to acquire lease: %v", err)
+	}
+	if previous != nil {
+		t.Errorf("expected no previous lease, found %v", previous)
+	}
+	if _, _, err := Acquire(path, "bob@host2", "cctl delete machine", time.Minute); !IsHeld(err) {
+		t.Fatalf("expected held error acquiring a held lease, found %v", err)
+	}
+	l, err := Read(path)
+	if err != nil {
+		t.Fatalf("unable to read lease: %v", err)
+	}
+	if l.Holder != "alice@host1" || l.Operation != "cctl upgrade cluster" || l.Expired(time.Now()) {
+		t.Errorf("unexpected lease %+v", l)
+	}
+	if err := h.Release(); err != nil {
+		t.Fatalf("unable to release lease: %v", err)
+	}
+	if l, err := Read(path); err != nil || l != nil {
+		t.Fatalf("expected lease to be removed, found %v (%v)", l, err)
+	}
+}
+
+func TestTakeOverExpired(t *testing.T) {
+	path, cleanup := tempLeasePath(t)
+	defer cleanup()
+	crashed, _, err := Acquire(path, "alice@host1", "cctl upgrade cluster", time.Millisecond)
+	if err != nil {
+		t.Fatalf("unable to acquire lease: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	h, previous, err := Acquire(path, "bob@host2", "cctl delete machine", time.Minute)
+	if err != nil {
+		t.Fatalf("unable to take over expired lease: %v", err)
+	}
+	if previous == nil || previous.Holder != "alice@host1" {
+		t.Errorf("expected the expired lease to be returned, found %v", previous)
+	}
+	if err := crashed.Renew(); err != ErrLost {
+		t.Errorf("expected the previous holder to have lost the lease, found %v", err)
+	}
+	if err := crashed.Release(); err != nil {
+		t.Errorf("unexpected error releasing a lost lease: %v", err)
+	}
+	if l, err := Read(path); err != nil || l == nil || l.Holder != "bob@host2" {
+		t.Fatalf("expected lease to be kept by its holder, found %v (%v)", l, err)
+	}
+	h.Release()
+}
+
+func TestTakeOverExpiredOnce(t *testing.T) {
+	path, cleanup := tempLeasePath(t)
+	defer cleanup()
+	if _, _, err := Acquire(path, "alice@host1", "cctl upgrade cluster", time.Millisecond); err != nil {
+		t.Fatalf("unable to acquire lease: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	const contenders = 8
+	errs := make(chan error, contenders)
+	for i := 0; i < contenders; i++ {
+		go func() {
+			_, _, err := Acquire(path, "bob@host2", "cctl delete machine", time.Minute)
+			errs <- err
+		}()
+	}
+	var acquired int
+	for i := 0; i < contenders; i++ {
+		err := <-errs
+		switch {
+		case err == nil:
+			acquired++
+		case !IsHeld(err):
+			t.Errorf("expected held error, found %v", err)
+		}
+	}
+	if acquired != 1 {
+		t.Errorf("expected exactly one contender to take over the lease, found %d", acquired)
+	}
+}
+
+func TestAcquireConcurrently(t *testing.T) {
+	path, cleanup := tempLeasePath(t)
+	defer cleanup()
+	const contenders = 8
+	errs := make(chan error, contenders)
+	for i := 0; i < contenders; i++ {
+		go func() {
+			_, _, err := Acquire(path, "bob@host2", "cctl delete machine", time.Minute)
+			errs <- err
+		}()
+	}
+	var acquired int
+	for i := 0; i < contenders; i++ {
+		err := <-errs
+		switch {
+		case err == nil:
+			acquired++
+		case !IsHeld(err):
+			// An error decoding the lease means it was read before its
+			// content was written.
+			t.Errorf("expected held error, found %v", err)
+		}
+	}
+	if acquired != 1 {
+		t.Errorf("expected exactly one contender to acquire the lease, found %d", acquired)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	path, cleanup := tempLeasePath(t)
+	defer cleanup()
+	h, _, err := Acquire(path, "alice@host1", "cctl upgrade cluster", time.Second)
+	if err != nil {
+		t.Fatalf("unable to acquire lease: %v", err)
+	}
+	h.Heartbeat(100*time.Millisecond, func(err error) {
+		t.Errorf("unexpected heartbeat error: %v", err)
+	})
+	time.Sleep(1500 * time.Millisecond)
+	if _, _, err := Acquire(path, "bob@host2", "cctl delete machine", time.Minute); !IsHeld(err) {
+		t.Fatalf("expected heartbeats to keep the lease, found %v", err)
+	}
+	if !h.Lease().Renewed.After(h.Lease().Acquired) {
+		t.Errorf("expected the lease to be renewed, found %+v", h.Lease())
+	}
+	if err := h.Release(); err != nil {
+		t.Fatalf("unable to release lease: %v", err)
+	}
+}
+
+func TestOnRenew(t *testing.T) {
+	path, cleanup := tempLeasePath(t)
+	defer cleanup()
+	h, _, err := Acquire(path, "alice@host1", "cctl upgrade cluster", time.Minute)
+	if err != nil {
+		t.Fatalf("unable to acquire lease: %v", err)
+	}
+	defer h.Release()
+	var published *Lease
+	h.OnRenew = func() error {
+		published, err = Read(path)
+		return err
+	}
+	if err := h.Renew(); err != nil {
+		t.Fatalf("unable to renew lease: %v", err)
+	}
+	if published == nil || !published.Renewed.Equal(h.Lease().Renewed) {
+		t.Errorf("expected the renewed lease to be published, found %v", published)
+	}
+	h.OnRenew = func() error { return ErrLost }
+	if err := h.Renew(); err != ErrLost {
+		t.Errorf("expected the error of OnRenew, found %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netif selects the network interface keepalived binds the VIP to.
+package netif
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Auto is a candidate that selects the interface with an address in the
+// subnet of the VIP.
+const Auto = "auto"
+
+// Interface is a network interface and its IPv4 networks.
+type Interface struct {
+	Name string
+	Nets []*net.IPNet
+}
+
+// SplitCandidates splits a comma-separated list of candidate interfaces.
+func SplitCandidates(s string) []string {
+	var candidates []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); len(c) != 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// Matches returns true if the interface could have been selected from the
+// comma-separated list of candidates. Since the interface selected by Auto is
+// only known on the machine, any interface matches a list that includes it.
+func Matches(candidates, iface string) bool {
+	for _, c := range SplitCandidates(candidates) {
+		if c == iface || c == Auto {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAddresses parses the output of `ip -o -4 addr show`. Interfaces are
+// returned in the order they are listed.
+func ParseAddresses(out []byte) []Interface {
+	var ifaces []Interface
+	index := make(map[string]int)
+	for _, line := range strings.Split(string(out), "\n") {
+		// 2: eth0    inet 10.0.0.5/24 brd 10.0.0.255 scope global eth0\       valid_lft forever preferred_lft forever
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[2] != "inet" {
+			continue
+		}
+		name := strings.SplitN(fields[1], "@", 2)[0]
+		ip, ipNet, err := net.ParseCIDR(fields[3])
+		if err != nil {
+			continue
+		}
+		ipNet.IP = ip
+		i, ok := index[name]
+		if !ok {
+			i = len(ifaces)
+			index[name] = i
+			ifaces = append(ifaces, Interface{Name: name})
+		}
+		ifaces[i].Nets = append(ifaces[i].Nets, ipNet)
+	}
+	return ifaces
+}
+
+// Select returns the first candidate that is an interface on the machine. The
+// Auto candidate selects the interface with an address in the subnet of the
+// VIP, other than the VIP itself.
+func Select(candidates []string, ifaces []Interface, vip net.IP) (string, error) {
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no candidate interfaces given")
+	}
+	for _, c := range candidates {
+		if c == Auto {
+			if name, ok := interfaceOnSubnet(ifaces, vip); ok {
+				return name, nil
+			}
+			continue
+		}
+		for _, iface := range ifaces {
+			if iface.Name == c {
+				return c, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("none of the interfaces %s found on the machine", strings.Join(candidates, ", "))
+}
+
+func interfaceOnSubnet(ifaces []Interface, vip net.IP) (string, bool) {
+	if vip == nil {
+		return "", false
+	}
+	for _, iface := range ifaces {
+		for _, ipNet := range iface.Nets {
+			if ipNet.Contains(vip) && !ipNet.IP.Equal(vip) {
+				return iface.Name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netif
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const addrOutput = `1: lo    inet 127.0.0.1/8 scope host lo\       valid_lft forever preferred_lft forever
+2: eno1    inet 192.168.1.10/24 brd 192.168.1.255 scope global eno1\       valid_lft forever preferred_lft forever
+3: ens3    inet 10.0.0.5/24 brd 10.0.0.255 scope global ens3\       valid_lft forever preferred_lft forever
+3: ens3    inet 10.0.0.100/32 scope global ens3\       valid_lft forever preferred_lft forever
+4: vlan10@ens3    inet 172.16.0.5/16 brd 172.16.255.255 scope global vlan10\       valid_lft forever preferred_lft forever
+`
+
+func TestParseAddresses(t *testing.T) {
+	ifaces := ParseAddresses([]byte(addrOutput))
+	var names []string
+	for _, iface := range ifaces {
+		names = append(names, iface.Name)
+	}
+	if expected := []string{"lo", "eno1", "ens3", "vlan10"}; !cmp.Equal(expected, names) {
+		t.Fatalf("expected interfaces %v, found %v", expected, names)
+	}
+	if len(ifaces[2].Nets) != 2 {
+		t.Fatalf("expected 2 networks on ens3, found %d", len(ifaces[2].Nets))
+	}
+}
+
+func TestSelect(t *testing.T) {
+	ifaces := ParseAddresses([]byte(addrOutput))
+	tcs := []struct {
+		name       string
+		candidates []string
+		vip        string
+		expected   string
+		expectErr  bool
+	}{
+		{"first found", []string{"eth0", "ens3", "eno1"}, "", "ens3", false},
+		{"none found", []string{"eth0", "eth1"}, "", "", true},
+		{"auto", []string{Auto}, "10.0.0.100", "ens3", false},
+		{"auto other subnet", []string{Auto}, "192.168.1.200", "eno1", false},
+		{"auto no subnet", []string{Auto}, "10.9.0.1", "", true},
+		{"auto then fallback", []string{Auto, "eno1"}, "10.9.0.1", "eno1", false},
+		{"auto without vip", []string{Auto, "ens3"}, "", "ens3", false},
+		{"no candidates", nil, "10.0.0.100", "", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Select(tc.candidates, ifaces, net.ParseIP(tc.vip))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected error, selected %q", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Fatalf("expected %q, found %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	if !Matches("eth0, ens3", "ens3") {
+		t.Errorf("expected ens3 to match")
+	}
+	if Matches("eth0,ens3", "eno1") {
+		t.Errorf("expected eno1 not to match")
+	}
+	if !Matches("eth0,auto", "eno1") {
+		t.Errorf("expected any interface to match auto")
+	}
+	if !cmp.Equal(SplitCandidates(" eth0, ,ens3 "), []string{"eth0", "ens3"}) {
+		t.Errorf("unexpected candidates %v", SplitCandidates(" eth0, ,ens3 "))
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package nodestatus matches machines to the cluster nodes that run on them,
+// and reports the status of each node.
+package nodestatus
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// NoNode is the readiness of a machine that has no node.
+const NoNode = "NoNode"
+
+// Machine is a machine expected to have a node.
+type Machine struct {
+	Name  string
+	Roles string
+	// Addresses are the addresses of the machine, one of which is an
+	// address of its node.
+	Addresses []string
+}
+
+// Status is the status of the node of a machine. A node that matches no
+// machine has no machine name, and a machine that has no node has no node
+// name.
+type Status struct {
+	Machine        string `json:"machine,omitempty"`
+	Roles          string `json:"roles,omitempty"`
+	Node           string `json:"node,omitempty"`
+	Ready          string `json:"ready"`
+	KubeletVersion string `json:"kubeletVersion,omitempty"`
+	InternalIP     string `json:"internalIP,omitempty"`
+}
+
+// Match returns the status of the node of every machine, in the order of the
+// machines, followed by the nodes that match no machine, ordered by name. A
+// node matches a machine if its name, or one of its addresses, is an address
+// of the machine.
+func Match(machines []Machine, nodes []corev1.Node) []Status {
+	matched := make(map[string]bool, len(nodes))
+	var statuses []Status
+	for _, m := range machines {
+		s := Status{Machine: m.Name, Roles: m.Roles, Ready: NoNode}
+		for i := range nodes {
+			if !matched[nodes[i].Name] && matches(m, &nodes[i]) {
+				matched[nodes[i].Name] = true
+				s = nodeStatus(&nodes[i])
+				s.Machine, s.Roles = m.Name, m.Roles
+				break
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	var unmatched []Status
+	for i := range nodes {
+		if !matched[nodes[i].Name] {
+			unmatched = append(unmatched, nodeStatus(&nodes[i]))
+		}
+	}
+	sort.Slice(unmatched, func(i, j int) bool { return unmatched[i].Node < unmatched[j].Node })
+	return append(statuses, unmatched...)
+}
+
+// WithoutNode returns the names of the machines that have no node.
+func WithoutNode(statuses []Status) []string {
+	var names []string
+	for _, s := range statuses {
+		if len(s.Machine) != 0 && len(s.Node) == 0 {
+			names = append(names, s.Machine)
+		}
+	}
+	return names
+}
+
+func matches(m Machine, node *corev1.Node) bool {
+	for _, a := range m.Addresses {
+		if node.Name == a {
+			return true
+		}
+		for _, na := range node.Status.Addresses {
+			if na.Address == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func nodeStatus(node *corev1.Node) Status {
+	s := Status{
+		Node:           node.Name,
+		Ready:          string(corev1.ConditionUnknown),
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			s.Ready = string(c.Status)
+		}
+	}
+	for _, a := range node.Status.Addresses {
+		if a.Type == corev1.NodeInternalIP {
+			s.InternalIP = a.Address
+			break
+		}
+	}
+	return s
+}
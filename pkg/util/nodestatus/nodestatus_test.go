@@ -0,0 +1,64 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodestatus
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func node(name, ip string, ready corev1.ConditionStatus) corev1.Node {
+	n := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	n.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeHostName, Address: name},
+		{Type: corev1.NodeInternalIP, Address: ip},
+	}
+	n.Status.NodeInfo.KubeletVersion = "v1.11.9"
+	if len(ready) != 0 {
+		n.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}
+	}
+	return n
+}
+
+func TestMatch(t *testing.T) {
+	machines := []Machine{
+		{Name: "10.0.0.1", Roles: "master", Addresses: []string{"10.0.0.1"}},
+		{Name: "10.0.0.2", Roles: "node", Addresses: []string{"10.0.0.2"}},
+		{Name: "10.0.0.3", Roles: "node", Addresses: []string{"10.0.0.3"}},
+	}
+	nodes := []corev1.Node{
+		node("worker-1", "10.0.0.2", corev1.ConditionFalse),
+		node("stray", "10.0.0.9", ""),
+		node("master-1", "10.0.0.1", corev1.ConditionTrue),
+	}
+	expected := []Status{
+		{Machine: "10.0.0.1", Roles: "master", Node: "master-1", Ready: "True", KubeletVersion: "v1.11.9", InternalIP: "10.0.0.1"},
+		{Machine: "10.0.0.2", Roles: "node", Node: "worker-1", Ready: "False", KubeletVersion: "v1.11.9", InternalIP: "10.0.0.2"},
+		{Machine: "10.0.0.3", Roles: "node", Ready: NoNode},
+		{Node: "stray", Ready: "Unknown", KubeletVersion: "v1.11.9", InternalIP: "10.0.0.9"},
+	}
+	statuses := Match(machines, nodes)
+	if !cmp.Equal(expected, statuses) {
+		t.Fatalf("unexpected statuses: %s", cmp.Diff(expected, statuses))
+	}
+	if names := WithoutNode(statuses); !cmp.Equal(names, []string{"10.0.0.3"}) {
+		t.Fatalf("expected machine 10.0.0.3 without a node, found %v", names)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package objectmeta stamps user-defined labels and annotations on the
+// objects cctl creates, so that other tools can select them.
+package objectmeta
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ParseLabels parses labels of the form key=value, and validates them.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	labels, err := parse(pairs)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ValidateLabels returns an error if a key or value is not valid Kubernetes
+// label syntax. Valid labels need no quoting in a shell command.
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return fmt.Errorf("label key %q is invalid: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+			return fmt.Errorf("label value %q is invalid: %s", v, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// ParseAnnotations parses annotations of the form key=value, and validates
+// their keys.
+func ParseAnnotations(pairs []string) (map[string]string, error) {
+	annotations, err := parse(pairs)
+	if err != nil {
+		return nil, err
+	}
+	for k := range annotations {
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return nil, fmt.Errorf("annotation key %q is invalid: %s", k, strings.Join(errs, "; "))
+		}
+	}
+	return annotations, nil
+}
+
+func parse(pairs []string) (map[string]string, error) {
+	m := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, fmt.Errorf("%q must be of the form key=value", pair)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+// Encode returns the map as a JSON object, for use as an annotation value.
+func Encode(m map[string]string) (string, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode %v: %v", m, err)
+	}
+	return string(b), nil
+}
+
+// Decode parses an annotation value written by Encode. An empty value is an
+// empty map.
+func Decode(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if len(s) == 0 {
+		return m, nil
+	}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("unable to decode %q: %v", s, err)
+	}
+	return m, nil
+}
+
+// Stamp adds the labels and annotations to the object. Labels and
+// annotations the object already has are not changed.
+func Stamp(obj metav1.Object, labels, annotations map[string]string) {
+	if merged, changed := merge(obj.GetLabels(), labels); changed {
+		obj.SetLabels(merged)
+	}
+	if merged, changed := merge(obj.GetAnnotations(), annotations); changed {
+		obj.SetAnnotations(merged)
+	}
+}
+
+func merge(existing, added map[string]string) (map[string]string, bool) {
+	changed := false
+	for k, v := range added {
+		if _, ok := existing[k]; ok {
+			continue
+		}
+		if existing == nil {
+			existing = make(map[string]string, len(added))
+		}
+		existing[k] = v
+		changed = true
+	}
+	return existing, changed
+}
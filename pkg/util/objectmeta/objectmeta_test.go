@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package objectmeta
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"team=platform", "example.com/managed-by=cctl"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"team": "platform", "example.com/managed-by": "cctl"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected %v, found %v", expected, labels)
+	}
+	for _, pairs := range [][]string{
+		{"team"},
+		{"=platform"},
+		{"team=two words"},
+		{"bad key=value"},
+		{"team=platform;reboot"},
+		{"team=$(id)"},
+		{"team`id`=platform"},
+		{"team=platform' x"},
+	} {
+		if _, err := ParseLabels(pairs); err == nil {
+			t.Errorf("expected an error for %q", pairs)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(map[string]string{"tier": "worker", "example.com/rack": ""}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateLabels(map[string]string{"tier": "worker && reboot"}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	annotations, err := ParseAnnotations([]string{"example.com/owner=Platform Team, on-call"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if annotations["example.com/owner"] != "Platform Team, on-call" {
+		t.Errorf("unexpected annotations %v", annotations)
+	}
+	if _, err := ParseAnnotations([]string{"bad key=value"}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	m := map[string]string{"team": "platform"}
+	s, err := Encode(m)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded, err := Decode(s)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(m, decoded) {
+		t.Errorf("expected %v, found %v", m, decoded)
+	}
+	if decoded, err := Decode(""); err != nil || len(decoded) != 0 {
+		t.Errorf("expected an empty map, found %v, %v", decoded, err)
+	}
+	if _, err := Decode("team=platform"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestStamp(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "etcd-ca",
+			Labels: map[string]string{"team": "storage"},
+		},
+	}
+	Stamp(secret, map[string]string{"team": "platform", "managed-by": "cctl"}, map[string]string{"owner": "platform"})
+	expectedLabels := map[string]string{"team": "storage", "managed-by": "cctl"}
+	if !reflect.DeepEqual(secret.Labels, expectedLabels) {
+		t.Errorf("expected labels %v, found %v", expectedLabels, secret.Labels)
+	}
+	if secret.Annotations["owner"] != "platform" {
+		t.Errorf("unexpected annotations %v", secret.Annotations)
+	}
+
+	empty := &corev1.Secret{}
+	Stamp(empty, nil, nil)
+	if empty.Labels != nil || empty.Annotations != nil {
+		t.Errorf("expected no labels or annotations, found %v, %v", empty.Labels, empty.Annotations)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operror classifies the errors of cctl operations, so that callers
+// can handle them without parsing messages.
+package operror
+
+import "fmt"
+
+// Kind is why an operation failed.
+type Kind string
+
+const (
+	// Unknown is the kind of errors that are not classified, e.g. a command
+	// failed on a machine.
+	Unknown Kind = "Unknown"
+	// NotFound means an object the operation needs, e.g. the cluster, is not
+	// in the state.
+	NotFound Kind = "NotFound"
+	// Invalid means the options of the operation are not valid.
+	Invalid Kind = "Invalid"
+	// Precondition means the cluster is not in a state that allows the
+	// operation, e.g. deleting a master would lose etcd quorum.
+	Precondition Kind = "Precondition"
+)
+
+// Error is an error of a known kind. Its message is the message of the
+// underlying error.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// New returns an error of the kind, with the formatted message.
+func New(kind Kind, format string, a ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+// Wrap returns an error of the kind that wraps err, or nil if err is nil.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of the error, or Unknown if it is not an Error.
+func KindOf(err error) Kind {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return Unknown
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operror
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	err := New(NotFound, "no cluster found in namespace %q", "default")
+	if KindOf(err) != NotFound {
+		t.Errorf("expected kind %q, found %q", NotFound, KindOf(err))
+	}
+	if err.Error() != `no cluster found in namespace "default"` {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if KindOf(fmt.Errorf("command failed")) != Unknown {
+		t.Errorf("expected unclassified error to be of kind %q", Unknown)
+	}
+	if Wrap(Precondition, nil) != nil {
+		t.Errorf("expected wrapping nil to return nil")
+	}
+	if KindOf(Wrap(Precondition, fmt.Errorf("quorum"))) != Precondition {
+		t.Errorf("expected kind %q", Precondition)
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	certutil "k8s.io/client-go/util/cert"
+)
+
+// oidBasicConstraints is the object identifier of the X.509 basic
+// constraints extension.
+var oidBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+// basicConstraints is the X.509 basic constraints extension.
+type basicConstraints struct {
+	IsCA bool `asn1:"optional"`
+}
+
+// VerifyCA checks that the PEM encoded certificate is a CA certificate that
+// is valid now, and that the PEM encoded key is its private key. The
+// certificate may be followed by the certificates of the CAs that signed it,
+// e.g. when it is an intermediate CA; each certificate in the chain must be
+// signed by the next.
+func VerifyCA(certPEM, keyPEM []byte) error {
+	ca, err := ParseCA(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	if !ca.Cert.IsCA {
+		return fmt.Errorf("certificate %q is not a CA certificate", ca.Cert.Subject.CommonName)
+	}
+	pub, ok := ca.Cert.PublicKey.(*rsa.PublicKey)
+	if !ok || pub.N.Cmp(ca.Key.N) != 0 || pub.E != ca.Key.E {
+		return fmt.Errorf("key does not match certificate %q", ca.Cert.Subject.CommonName)
+	}
+	chain, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("unable to parse CA certificate: %v", err)
+	}
+	now := time.Now()
+	for i, cert := range chain {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("certificate %q is valid only from %s to %s", cert.Subject.CommonName, cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+		if i+1 == len(chain) {
+			break
+		}
+		if err := cert.CheckSignatureFrom(chain[i+1]); err != nil {
+			return fmt.Errorf("certificate %q is not signed by the next certificate in the chain, %q: %v", cert.Subject.CommonName, chain[i+1].Subject.CommonName, err)
+		}
+	}
+	return nil
+}
+
+// NewCARequest creates a private key, and a request for an external CA to
+// sign a CA certificate with the common name. The request and key are
+// returned PEM encoded.
+func NewCARequest(commonName string) ([]byte, []byte, error) {
+	key, err := certutil.NewPrivateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create private key: %v", err)
+	}
+	constraints, err := asn1.Marshal(basicConstraints{IsCA: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode basic constraints: %v", err)
+	}
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidBasicConstraints, Critical: true, Value: constraints},
+		},
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create certificate request: %v", err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	return csrPEM, certutil.EncodePrivateKeyPEM(key), nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/platform9/cctl/common"
+)
+
+// signCARequest signs the PEM encoded request as an intermediate CA of the
+// root CA, as an external signer would.
+func signCARequest(t *testing.T, root *CA, csrPEM []byte) []byte {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		t.Fatalf("no PEM encoded request found")
+	}
+	req, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("unable to parse request: %v", err)
+	}
+	if err := req.CheckSignature(); err != nil {
+		t.Fatalf("request signature is invalid: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               req.Subject,
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root.Cert, req.PublicKey, root.Key)
+	if err != nil {
+		t.Fatalf("unable to sign request: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestVerifyCA(t *testing.T) {
+	root := newTestCA(t)
+	rootPEM := certutil.EncodeCertPEM(root.Cert)
+	if err := VerifyCA(rootPEM, certutil.EncodePrivateKeyPEM(root.Key)); err != nil {
+		t.Errorf("unexpected error for self-signed CA: %v", err)
+	}
+
+	csrPEM, keyPEM, err := NewCARequest("kubernetes")
+	if err != nil {
+		t.Fatalf("unable to create CA request: %v", err)
+	}
+	intermediatePEM := signCARequest(t, root, csrPEM)
+	chain := append(append([]byte(nil), intermediatePEM...), rootPEM...)
+	if err := VerifyCA(chain, keyPEM); err != nil {
+		t.Errorf("unexpected error for intermediate CA with chain: %v", err)
+	}
+	if err := VerifyCA(intermediatePEM, keyPEM); err != nil {
+		t.Errorf("unexpected error for intermediate CA without chain: %v", err)
+	}
+	ca, err := ParseCA(chain, keyPEM)
+	if err != nil {
+		t.Fatalf("unable to parse intermediate CA: %v", err)
+	}
+	if ca.Cert.Subject.CommonName != "kubernetes" {
+		t.Errorf("expected the intermediate CA to sign certificates, found %q", ca.Cert.Subject.CommonName)
+	}
+
+	if err := VerifyCA(chain, certutil.EncodePrivateKeyPEM(root.Key)); err == nil {
+		t.Errorf("expected error for key that does not match the certificate")
+	}
+	otherRoot := newTestCA(t)
+	brokenChain := append(append([]byte(nil), intermediatePEM...), certutil.EncodeCertPEM(otherRoot.Cert)...)
+	if err := VerifyCA(brokenChain, keyPEM); err == nil {
+		t.Errorf("expected error for chain not signed by the next certificate")
+	}
+	leaf, leafKey, err := common.NewCertAndKey(root.Cert, root.Key, certutil.Config{
+		CommonName: "kube-apiserver",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	if err := VerifyCA(certutil.EncodeCertPEM(leaf), certutil.EncodePrivateKeyPEM(leafKey)); err == nil {
+		t.Errorf("expected error for certificate that is not a CA")
+	}
+}
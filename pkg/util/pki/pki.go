@@ -0,0 +1,225 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/platform9/cctl/common"
+)
+
+// CA is a certificate authority used to sign certificates.
+type CA struct {
+	Cert *x509.Certificate
+	Key  *rsa.PrivateKey
+}
+
+// ParseCA parses the PEM encoded certificate and private key of a CA.
+func ParseCA(certPEM, keyPEM []byte) (*CA, error) {
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA certificate: %v", err)
+	}
+	key, err := certutil.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("CA key is not an RSA key")
+	}
+	return &CA{Cert: certs[0], Key: rsaKey}, nil
+}
+
+// Renew issues a certificate, with a new key, that has the same subject,
+// alternative names, and usages as the PEM encoded certificate. The new
+// certificate and key are returned PEM encoded.
+func (ca *CA) Renew(certPEM []byte) ([]byte, []byte, error) {
+	return ca.RenewWithAltNames(certPEM, certutil.AltNames{})
+}
+
+// RenewWithAltNames is like Renew, but the new certificate also has the extra
+// alternative names that the PEM encoded certificate does not have.
+func (ca *CA) RenewWithAltNames(certPEM []byte, extra certutil.AltNames) ([]byte, []byte, error) {
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	old := certs[0]
+	if err := old.CheckSignatureFrom(ca.Cert); err != nil {
+		return nil, nil, fmt.Errorf("certificate %q is not signed by CA %q: %v", old.Subject.CommonName, ca.Cert.Subject.CommonName, err)
+	}
+	config := certutil.Config{
+		CommonName:   old.Subject.CommonName,
+		Organization: old.Subject.Organization,
+		AltNames:     mergeAltNames(certutil.AltNames{DNSNames: old.DNSNames, IPs: old.IPAddresses}, extra),
+		Usages:       old.ExtKeyUsage,
+	}
+	cert, key, err := common.NewCertAndKey(ca.Cert, ca.Key, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certutil.EncodeCertPEM(cert), certutil.EncodePrivateKeyPEM(key), nil
+}
+
+// ParseAltNames parses subject alternative names, each an IP or a DNS name.
+// A DNS name may be a wildcard, e.g. *.example.com.
+func ParseAltNames(names []string) (certutil.AltNames, error) {
+	var altNames certutil.AltNames
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			altNames.IPs = append(altNames.IPs, ip)
+			continue
+		}
+		errs := validation.IsDNS1123Subdomain(name)
+		if strings.HasPrefix(name, "*.") {
+			errs = validation.IsWildcardDNS1123Subdomain(name)
+		}
+		if len(errs) != 0 {
+			return certutil.AltNames{}, fmt.Errorf("%q is neither an IP nor a valid DNS name: %s", name, strings.Join(errs, "; "))
+		}
+		altNames.DNSNames = append(altNames.DNSNames, name)
+	}
+	return altNames, nil
+}
+
+// MissingAltNames returns the alternative names that the PEM encoded
+// certificate does not have.
+func MissingAltNames(certPEM []byte, want certutil.AltNames) (certutil.AltNames, error) {
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return certutil.AltNames{}, fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	var missing certutil.AltNames
+	for _, name := range want.DNSNames {
+		if !containsDNSName(certs[0].DNSNames, name) {
+			missing.DNSNames = append(missing.DNSNames, name)
+		}
+	}
+	for _, ip := range want.IPs {
+		if !containsIP(certs[0].IPAddresses, ip) {
+			missing.IPs = append(missing.IPs, ip)
+		}
+	}
+	return missing, nil
+}
+
+// mergeAltNames returns the alternative names of a, followed by those of b
+// that a does not have.
+func mergeAltNames(a, b certutil.AltNames) certutil.AltNames {
+	merged := certutil.AltNames{
+		DNSNames: append([]string(nil), a.DNSNames...),
+		IPs:      append([]net.IP(nil), a.IPs...),
+	}
+	for _, name := range b.DNSNames {
+		if !containsDNSName(merged.DNSNames, name) {
+			merged.DNSNames = append(merged.DNSNames, name)
+		}
+	}
+	for _, ip := range b.IPs {
+		if !containsIP(merged.IPs, ip) {
+			merged.IPs = append(merged.IPs, ip)
+		}
+	}
+	return merged
+}
+
+// containsDNSName returns true if the names contain the name. DNS names are
+// case-insensitive.
+func containsDNSName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RenewKubeconfig renews the client certificates embedded in the kubeconfig.
+func (ca *CA) RenewKubeconfig(kubeconfig []byte) ([]byte, error) {
+	config := clientcmdv1.Config{}
+	if err := yaml.Unmarshal(kubeconfig, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse kubeconfig: %v", err)
+	}
+	for i := range config.AuthInfos {
+		authInfo := &config.AuthInfos[i].AuthInfo
+		if len(authInfo.ClientCertificateData) == 0 {
+			continue
+		}
+		certPEM, keyPEM, err := ca.Renew(authInfo.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("unable to renew client certificate of user %q: %v", config.AuthInfos[i].Name, err)
+		}
+		authInfo.ClientCertificateData = certPEM
+		authInfo.ClientKeyData = keyPEM
+	}
+	return yaml.Marshal(config)
+}
+
+// Expiry returns the time the PEM encoded certificate expires.
+func Expiry(certPEM []byte) (time.Time, error) {
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse certificate: %v", err)
+	}
+	return certs[0].NotAfter, nil
+}
+
+// KubeconfigExpiry returns the time the first of the client certificates
+// embedded in the kubeconfig expires.
+func KubeconfigExpiry(kubeconfig []byte) (time.Time, error) {
+	config := clientcmdv1.Config{}
+	if err := yaml.Unmarshal(kubeconfig, &config); err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse kubeconfig: %v", err)
+	}
+	var expiry time.Time
+	for _, authInfo := range config.AuthInfos {
+		if len(authInfo.AuthInfo.ClientCertificateData) == 0 {
+			continue
+		}
+		notAfter, err := Expiry(authInfo.AuthInfo.ClientCertificateData)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to read client certificate of user %q: %v", authInfo.Name, err)
+		}
+		if expiry.IsZero() || notAfter.Before(expiry) {
+			expiry = notAfter
+		}
+	}
+	if expiry.IsZero() {
+		return time.Time{}, fmt.Errorf("kubeconfig has no embedded client certificates")
+	}
+	return expiry, nil
+}
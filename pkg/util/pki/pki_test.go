@@ -0,0 +1,237 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/google/go-cmp/cmp"
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	certutil "k8s.io/client-go/util/cert"
+
+	"github.com/platform9/cctl/common"
+)
+
+func newTestCA(t *testing.T) *CA {
+	cert, key, err := common.NewCertificateAuthority()
+	if err != nil {
+		t.Fatalf("unable to create CA: %v", err)
+	}
+	ca, err := ParseCA(certutil.EncodeCertPEM(cert), certutil.EncodePrivateKeyPEM(key))
+	if err != nil {
+		t.Fatalf("unable to parse CA: %v", err)
+	}
+	return ca
+}
+
+func TestRenew(t *testing.T) {
+	ca := newTestCA(t)
+	config := certutil.Config{
+		CommonName:   "kube-apiserver",
+		Organization: []string{"system:masters"},
+		AltNames: certutil.AltNames{
+			DNSNames: []string{"kubernetes", "kubernetes.default"},
+			IPs:      []net.IP{net.ParseIP("10.0.0.1").To4()},
+		},
+		Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	oldCert, _, err := common.NewCertAndKey(ca.Cert, ca.Key, config)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	certPEM, keyPEM, err := ca.Renew(certutil.EncodeCertPEM(oldCert))
+	if err != nil {
+		t.Fatalf("unable to renew certificate: %v", err)
+	}
+	certs, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		t.Fatalf("unable to parse renewed certificate: %v", err)
+	}
+	cert := certs[0]
+	if cert.SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+		t.Errorf("expected a new serial number")
+	}
+	if err := cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("renewed certificate not signed by CA: %v", err)
+	}
+	if cert.Subject.CommonName != oldCert.Subject.CommonName || !cmp.Equal(cert.Subject.Organization, oldCert.Subject.Organization) {
+		t.Errorf("expected subject %v, found %v", oldCert.Subject, cert.Subject)
+	}
+	if !cmp.Equal(cert.DNSNames, oldCert.DNSNames) || len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(oldCert.IPAddresses[0]) {
+		t.Errorf("expected alternative names %v %v, found %v %v", oldCert.DNSNames, oldCert.IPAddresses, cert.DNSNames, cert.IPAddresses)
+	}
+	if !cmp.Equal(cert.ExtKeyUsage, oldCert.ExtKeyUsage) {
+		t.Errorf("expected usages %v, found %v", oldCert.ExtKeyUsage, cert.ExtKeyUsage)
+	}
+	if _, err := certutil.ParsePrivateKeyPEM(keyPEM); err != nil {
+		t.Errorf("unable to parse renewed key: %v", err)
+	}
+
+	otherCA := newTestCA(t)
+	if _, _, err := otherCA.Renew(certutil.EncodeCertPEM(oldCert)); err == nil {
+		t.Errorf("expected error renewing certificate signed by a different CA")
+	}
+}
+
+func TestRenewWithAltNames(t *testing.T) {
+	ca := newTestCA(t)
+	config := certutil.Config{
+		CommonName: "kube-apiserver",
+		AltNames: certutil.AltNames{
+			DNSNames: []string{"kubernetes"},
+			IPs:      []net.IP{net.ParseIP("10.0.0.1")},
+		},
+		Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	oldCert, _, err := common.NewCertAndKey(ca.Cert, ca.Key, config)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	oldPEM := certutil.EncodeCertPEM(oldCert)
+	extra, err := ParseAltNames([]string{"api.example.com", "kubernetes", "203.0.113.10", "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("unable to parse alternative names: %v", err)
+	}
+	missing, err := MissingAltNames(oldPEM, extra)
+	if err != nil {
+		t.Fatalf("unable to check alternative names: %v", err)
+	}
+	if !cmp.Equal(missing.DNSNames, []string{"api.example.com"}) || len(missing.IPs) != 1 || !missing.IPs[0].Equal(net.ParseIP("203.0.113.10")) {
+		t.Errorf("unexpected missing alternative names %v %v", missing.DNSNames, missing.IPs)
+	}
+	certPEM, _, err := ca.RenewWithAltNames(oldPEM, extra)
+	if err != nil {
+		t.Fatalf("unable to renew certificate: %v", err)
+	}
+	cert, err := certutil.ParseCertsPEM(certPEM)
+	if err != nil {
+		t.Fatalf("unable to parse renewed certificate: %v", err)
+	}
+	if !cmp.Equal(cert[0].DNSNames, []string{"kubernetes", "api.example.com"}) || len(cert[0].IPAddresses) != 2 {
+		t.Errorf("unexpected alternative names %v %v", cert[0].DNSNames, cert[0].IPAddresses)
+	}
+	if missing, err := MissingAltNames(certPEM, extra); err != nil || len(missing.DNSNames)+len(missing.IPs) != 0 {
+		t.Errorf("expected no missing alternative names, found %v %v (%v)", missing.DNSNames, missing.IPs, err)
+	}
+}
+
+func TestParseAltNames(t *testing.T) {
+	if _, err := ParseAltNames([]string{"*.example.com", "::1"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"", "not a name", "under_score.example.com", "a.*.example.com"} {
+		if _, err := ParseAltNames([]string{name}); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+}
+
+func TestRenewKubeconfig(t *testing.T) {
+	ca := newTestCA(t)
+	oldCert, oldKey, err := common.NewCertAndKey(ca.Cert, ca.Key, certutil.Config{
+		CommonName:   "kubernetes-admin",
+		Organization: []string{"system:masters"},
+		Usages:       []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	oldKeyPEM := certutil.EncodePrivateKeyPEM(oldKey)
+	config := clientcmdv1.Config{
+		Kind:       "Config",
+		APIVersion: "v1",
+		Clusters: []clientcmdv1.NamedCluster{
+			{Name: "kubernetes", Cluster: clientcmdv1.Cluster{Server: "https://10.0.0.1:6443"}},
+		},
+		AuthInfos: []clientcmdv1.NamedAuthInfo{
+			{Name: "kubernetes-admin", AuthInfo: clientcmdv1.AuthInfo{
+				ClientCertificateData: certutil.EncodeCertPEM(oldCert),
+				ClientKeyData:         oldKeyPEM,
+			}},
+			{Name: "token-user", AuthInfo: clientcmdv1.AuthInfo{Token: "abc"}},
+		},
+	}
+	kubeconfig, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatalf("unable to write kubeconfig: %v", err)
+	}
+
+	renewed, err := ca.RenewKubeconfig(kubeconfig)
+	if err != nil {
+		t.Fatalf("unable to renew kubeconfig: %v", err)
+	}
+	renewedConfig := clientcmdv1.Config{}
+	if err := yaml.Unmarshal(renewed, &renewedConfig); err != nil {
+		t.Fatalf("unable to parse renewed kubeconfig: %v", err)
+	}
+	authInfo := renewedConfig.AuthInfos[0].AuthInfo
+	certs, err := certutil.ParseCertsPEM(authInfo.ClientCertificateData)
+	if err != nil {
+		t.Fatalf("unable to parse renewed client certificate: %v", err)
+	}
+	if certs[0].SerialNumber.Cmp(oldCert.SerialNumber) == 0 {
+		t.Errorf("expected client certificate to be renewed")
+	}
+	if cmp.Equal(authInfo.ClientKeyData, oldKeyPEM) {
+		t.Errorf("expected client key to be renewed")
+	}
+	if renewedConfig.AuthInfos[1].AuthInfo.Token != "abc" {
+		t.Errorf("expected token user to be unchanged")
+	}
+	if renewedConfig.Clusters[0].Cluster.Server != "https://10.0.0.1:6443" {
+		t.Errorf("expected cluster to be unchanged")
+	}
+}
+
+func TestKubeconfigExpiry(t *testing.T) {
+	ca := newTestCA(t)
+	cert, _, err := common.NewCertAndKey(ca.Cert, ca.Key, certutil.Config{
+		CommonName: "kubernetes-admin",
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	config := clientcmdv1.Config{
+		AuthInfos: []clientcmdv1.NamedAuthInfo{
+			{Name: "token-user", AuthInfo: clientcmdv1.AuthInfo{Token: "abc"}},
+			{Name: "kubernetes-admin", AuthInfo: clientcmdv1.AuthInfo{ClientCertificateData: certutil.EncodeCertPEM(cert)}},
+		},
+	}
+	kubeconfig, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatalf("unable to write kubeconfig: %v", err)
+	}
+	expiry, err := KubeconfigExpiry(kubeconfig)
+	if err != nil {
+		t.Fatalf("unable to read kubeconfig expiry: %v", err)
+	}
+	if !expiry.Equal(cert.NotAfter) {
+		t.Errorf("expected expiry %v, found %v", cert.NotAfter, expiry)
+	}
+
+	config.AuthInfos = config.AuthInfos[:1]
+	if kubeconfig, err = yaml.Marshal(config); err != nil {
+		t.Fatalf("unable to write kubeconfig: %v", err)
+	}
+	if _, err := KubeconfigExpiry(kubeconfig); err == nil {
+		t.Errorf("expected error for kubeconfig without client certificates")
+	}
+}
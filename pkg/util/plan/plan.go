@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plan computes the actions needed to converge the cluster to a
+// desired manifest.
+package plan
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/netif"
+)
+
+// Manifest is the desired cluster and machines.
+type Manifest struct {
+	// Cluster is created if it does not exist. It has the format accepted by
+	// `create cluster -f`.
+	// +optional
+	Cluster  *clusterv1.Cluster `json:"cluster,omitempty"`
+	Machines []Machine          `json:"machines"`
+}
+
+// Machine is the desired configuration of a machine. Optional fields that are
+// not set are not reconciled.
+type Machine struct {
+	IP   string `json:"ip"`
+	Role string `json:"role"`
+	// +optional
+	Port int `json:"port,omitempty"`
+	// Iface is the interface keepalived binds the VIP to on a master. In a
+	// manifest, it may be a comma-separated list of candidates.
+	// +optional
+	Iface string `json:"iface,omitempty"`
+	// PublicKeys are the machine's SSH public keys. In a manifest, these are
+	// the names of files containing the keys.
+	// +optional
+	PublicKeys []string `json:"publicKeys,omitempty"`
+	// Labels are added to the machine's cluster node. Labels not in the
+	// manifest are left alone.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ActionType is the type of an action.
+type ActionType string
+
+const (
+	CreateCluster ActionType = "create cluster"
+	CreateMachine ActionType = "create machine"
+	UpdateMachine ActionType = "update machine"
+	DeleteMachine ActionType = "delete machine"
+)
+
+// Action is a change needed to converge the cluster.
+type Action struct {
+	Type    ActionType
+	Machine Machine
+	// Changes describes the changes made by an update.
+	Changes []string
+}
+
+func (a Action) String() string {
+	switch a.Type {
+	case CreateCluster:
+		return string(a.Type)
+	case CreateMachine:
+		return fmt.Sprintf("%s %s (role %s)", a.Type, a.Machine.IP, a.Machine.Role)
+	case UpdateMachine:
+		return fmt.Sprintf("%s %s: %s", a.Type, a.Machine.IP, strings.Join(a.Changes, ", "))
+	}
+	return fmt.Sprintf("%s %s", a.Type, a.Machine.IP)
+}
+
+// Validate returns an error if the manifest is not valid.
+func (m *Manifest) Validate() error {
+	seen := make(map[string]bool, len(m.Machines))
+	for _, machine := range m.Machines {
+		if len(machine.IP) == 0 {
+			return fmt.Errorf("machine without an ip")
+		}
+		if seen[machine.IP] {
+			return fmt.Errorf("machine %q is defined more than once", machine.IP)
+		}
+		seen[machine.IP] = true
+		if machine.Role != common.MasterRole && machine.Role != common.NodeRole {
+			return fmt.Errorf("machine %q role %q is not supported, must be %q or %q", machine.IP, machine.Role, common.MasterRole, common.NodeRole)
+		}
+	}
+	return nil
+}
+
+// Compute returns the actions that converge the current machines to the
+// manifest, in the order they should be applied: the cluster is created,
+// machines whose role changed are deleted, new machines are created (masters
+// first), existing machines are updated, and finally machines not in the
+// manifest are deleted.
+func Compute(desired *Manifest, clusterExists bool, current []Machine) ([]Action, error) {
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+	var actions []Action
+	if !clusterExists {
+		if desired.Cluster == nil {
+			return nil, fmt.Errorf("no cluster found, and the manifest does not define one")
+		}
+		actions = append(actions, Action{Type: CreateCluster})
+	}
+
+	currentByIP := make(map[string]Machine, len(current))
+	for _, m := range current {
+		currentByIP[m.IP] = m
+	}
+	desiredByIP := make(map[string]bool, len(desired.Machines))
+
+	var replaced, created, updated, deleted []Action
+	for _, d := range desired.Machines {
+		desiredByIP[d.IP] = true
+		c, ok := currentByIP[d.IP]
+		if !ok {
+			created = append(created, Action{Type: CreateMachine, Machine: d})
+			continue
+		}
+		if c.Role != d.Role {
+			replaced = append(replaced, Action{Type: DeleteMachine, Machine: c})
+			created = append(created, Action{Type: CreateMachine, Machine: d})
+			continue
+		}
+		if changes := diff(c, d); len(changes) != 0 {
+			updated = append(updated, Action{Type: UpdateMachine, Machine: d, Changes: changes})
+		}
+	}
+	for _, c := range current {
+		if !desiredByIP[c.IP] {
+			deleted = append(deleted, Action{Type: DeleteMachine, Machine: c})
+		}
+	}
+	sort.SliceStable(created, func(i, j int) bool {
+		return created[i].Machine.Role == common.MasterRole && created[j].Machine.Role != common.MasterRole
+	})
+	actions = append(actions, replaced...)
+	actions = append(actions, created...)
+	actions = append(actions, updated...)
+	actions = append(actions, deleted...)
+	return actions, nil
+}
+
+func diff(current, desired Machine) []string {
+	var changes []string
+	if desired.Port != 0 && desired.Port != current.Port {
+		changes = append(changes, fmt.Sprintf("port %d -> %d", current.Port, desired.Port))
+	}
+	if len(desired.Iface) != 0 && !netif.Matches(desired.Iface, current.Iface) {
+		changes = append(changes, fmt.Sprintf("iface %q -> %q", current.Iface, desired.Iface))
+	}
+	if desired.PublicKeys != nil && !equalStrings(current.PublicKeys, desired.PublicKeys) {
+		changes = append(changes, "public keys")
+	}
+	var keys []string
+	for k := range desired.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := current.Labels[k]; !ok || v != desired.Labels[k] {
+			changes = append(changes, fmt.Sprintf("label %s=%s", k, desired.Labels[k]))
+		}
+	}
+	return changes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if strings.TrimSpace(a[i]) != strings.TrimSpace(b[i]) {
+			return false
+		}
+	}
+	return true
+}
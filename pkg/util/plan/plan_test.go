@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plan_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/pkg/util/plan"
+)
+
+func TestCompute(t *testing.T) {
+	current := []plan.Machine{
+		{IP: "10.0.0.1", Role: "master", Port: 22, Iface: "eth0"},
+		{IP: "10.0.0.2", Role: "node", Port: 22, Iface: "eth0"},
+		{IP: "10.0.0.3", Role: "node", Port: 22, Iface: "eth0", Labels: map[string]string{"a": "b"}},
+		{IP: "10.0.0.4", Role: "node", Port: 22, Iface: "eth0"},
+	}
+	desired := &plan.Manifest{
+		Machines: []plan.Machine{
+			{IP: "10.0.0.1", Role: "master", Iface: "ens3,eth0"},
+			{IP: "10.0.0.2", Role: "master"},
+			{IP: "10.0.0.3", Role: "node", Port: 2222, Iface: "ens3,eno1", Labels: map[string]string{"a": "b", "c": "d"}},
+			{IP: "10.0.0.5", Role: "node"},
+			{IP: "10.0.0.6", Role: "master"},
+		},
+	}
+	actions, err := plan.Compute(desired, true, current)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var actual []string
+	for _, a := range actions {
+		actual = append(actual, a.String())
+	}
+	expected := []string{
+		"delete machine 10.0.0.2",
+		"create machine 10.0.0.2 (role master)",
+		"create machine 10.0.0.6 (role master)",
+		"create machine 10.0.0.5 (role node)",
+		`update machine 10.0.0.3: port 22 -> 2222, iface "eth0" -> "ens3,eno1", label c=d`,
+		"delete machine 10.0.0.4",
+	}
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+}
+
+func TestComputeCreatesCluster(t *testing.T) {
+	if _, err := plan.Compute(&plan.Manifest{}, false, nil); err == nil {
+		t.Fatalf("expected error when the cluster does not exist and is not defined")
+	}
+	actions, err := plan.Compute(&plan.Manifest{Cluster: &clusterv1.Cluster{}}, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Type != plan.CreateCluster {
+		t.Fatalf("expected a single create cluster action, found %v", actions)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tcs := []struct {
+		name     string
+		manifest plan.Manifest
+	}{
+		{"duplicate", plan.Manifest{Machines: []plan.Machine{{IP: "a", Role: "node"}, {IP: "a", Role: "node"}}}},
+		{"bad role", plan.Manifest{Machines: []plan.Machine{{IP: "a", Role: "etcd"}}}},
+		{"no ip", plan.Manifest{Machines: []plan.Machine{{Role: "node"}}}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.manifest.Validate(); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package preflight runs checks that a machine meets the requirements of
+// Kubernetes before it is provisioned, and parses the output of the commands
+// the checks run on the machine.
+package preflight
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IgnoreAll is the name that ignores the failures of every check.
+const IgnoreAll = "all"
+
+// Check verifies one requirement of a machine.
+type Check struct {
+	// Name identifies the check, e.g. to ignore its failure.
+	Name string
+	// Remediation describes how to fix a failure of the check.
+	Remediation string
+	Run         func() error
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Check       string
+	Error       string
+	Remediation string
+	Ignored     bool
+}
+
+// Passed returns true if the check passed.
+func (r Result) Passed() bool {
+	return len(r.Error) == 0
+}
+
+// Run runs every check, and marks the failures of the checks named in ignore
+// as ignored.
+func Run(checks []Check, ignore []string) []Result {
+	ignored := make(map[string]bool)
+	for _, name := range ignore {
+		ignored[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		r := Result{Check: c.Name}
+		if err := c.Run(); err != nil {
+			r.Error = err.Error()
+			r.Remediation = c.Remediation
+			r.Ignored = ignored[IgnoreAll] || ignored[c.Name]
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Error returns an error that lists every failure that is not ignored, or
+// nil if there are none.
+func Error(results []Result) error {
+	var failures, names []string
+	for _, r := range results {
+		if r.Passed() || r.Ignored {
+			continue
+		}
+		names = append(names, r.Check)
+		failures = append(failures, fmt.Sprintf("[%s] %s", r.Check, r.Error))
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d preflight checks failed: %s; to continue anyway, use --ignore-preflight-errors=%s", len(names), strings.Join(failures, "; "), strings.Join(names, ","))
+}
+
+// ListeningPorts returns the TCP ports listened on, from the output of
+// "ss -ltn".
+func ListeningPorts(out []byte) (map[int]bool, error) {
+	ports := make(map[int]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] == "State" {
+			continue
+		}
+		local := fields[3]
+		i := strings.LastIndex(local, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("unexpected local address %q", local)
+		}
+		port, err := strconv.Atoi(local[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse port of local address %q: %v", local, err)
+		}
+		ports[port] = true
+	}
+	return ports, nil
+}
+
+// SwapDevices returns the swap devices in use, from the contents of
+// /proc/swaps.
+func SwapDevices(procSwaps []byte) []string {
+	var devices []string
+	scanner := bufio.NewScanner(bytes.NewReader(procSwaps))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] == "Filename" {
+			continue
+		}
+		devices = append(devices, fields[0])
+	}
+	return devices
+}
+
+// KernelAtLeast returns true if the kernel release, e.g. "4.15.0-45-generic",
+// is at least major.minor.
+func KernelAtLeast(release string, major, minor int) (bool, error) {
+	parts := strings.SplitN(strings.TrimSpace(release), ".", 3)
+	if len(parts) < 2 {
+		return false, fmt.Errorf("unexpected kernel release %q", release)
+	}
+	kernelMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false, fmt.Errorf("unable to parse kernel release %q: %v", release, err)
+	}
+	minorDigits := strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+	kernelMinor, err := strconv.Atoi(minorDigits)
+	if err != nil {
+		return false, fmt.Errorf("unable to parse kernel release %q: %v", release, err)
+	}
+	if kernelMajor != major {
+		return kernelMajor > major, nil
+	}
+	return kernelMinor >= minor, nil
+}
+
+// AvailableBytes returns the space available on the file system, from the
+// output of "df -Pk <dir>".
+func AvailableBytes(out []byte) (int64, error) {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 2 {
+		return 0, fmt.Errorf("unexpected df output %q", string(out))
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected df output %q", string(out))
+	}
+	kb, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse available space %q: %v", fields[3], err)
+	}
+	return kb * 1024, nil
+}
+
+// ClockSynchronized returns true if the output of "timedatectl status" shows
+// that the clock is synchronized, e.g. by NTP.
+func ClockSynchronized(out []byte) (bool, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		// Older versions of systemd report "NTP synchronized", newer ones
+		// "System clock synchronized".
+		switch parts[0] {
+		case "NTP synchronized", "System clock synchronized":
+			return strings.TrimSpace(parts[1]) == "yes", nil
+		}
+	}
+	return false, fmt.Errorf("clock synchronization status not found")
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preflight
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRunAndError(t *testing.T) {
+	checks := []Check{
+		{Name: "ports", Remediation: "stop it", Run: func() error { return fmt.Errorf("port 6443 is in use") }},
+		{Name: "swap", Remediation: "sudo swapoff -a", Run: func() error { return fmt.Errorf("swap is on") }},
+		{Name: "os", Run: func() error { return nil }},
+	}
+	results := Run(checks, []string{" Swap "})
+	if len(results) != 3 || results[0].Passed() || !results[1].Ignored || !results[2].Passed() {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	err := Error(results)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	msg := err.Error()
+	if msg != "1 preflight checks failed: [ports] port 6443 is in use; to continue anyway, use --ignore-preflight-errors=ports" {
+		t.Errorf("unexpected error %q", msg)
+	}
+	if err := Error(Run(checks, []string{IgnoreAll})); err != nil {
+		t.Errorf("expected no error when all are ignored, found %v", err)
+	}
+}
+
+func TestListeningPorts(t *testing.T) {
+	out := `State      Recv-Q Send-Q Local Address:Port               Peer Address:Port
+LISTEN     0      128          *:22                       *:*
+LISTEN     0      128    127.0.0.1:10248                    *:*
+LISTEN     0      128         :::6443                    :::*
+LISTEN     0      128    [::]:2379                  [::]:*
+`
+	ports, err := ListeningPorts([]byte(out))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[int]bool{22: true, 10248: true, 6443: true, 2379: true}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected %v, found %v", expected, ports)
+	}
+}
+
+func TestSwapDevices(t *testing.T) {
+	if d := SwapDevices([]byte("Filename\t\t\t\tType\t\tSize\tUsed\tPriority\n")); len(d) != 0 {
+		t.Errorf("expected no swap devices, found %v", d)
+	}
+	d := SwapDevices([]byte("Filename\t\t\t\tType\t\tSize\tUsed\tPriority\n/dev/sda2                               partition\t2097148\t0\t-2\n"))
+	if !reflect.DeepEqual(d, []string{"/dev/sda2"}) {
+		t.Errorf("unexpected swap devices %v", d)
+	}
+}
+
+func TestKernelAtLeast(t *testing.T) {
+	tests := []struct {
+		release  string
+		expected bool
+	}{
+		{"4.15.0-45-generic", true},
+		{"3.10.0-957.el7.x86_64", true},
+		{"3.9.11", false},
+		{"2.6.32-754.el6.x86_64", false},
+		{"5.0", true},
+	}
+	for _, test := range tests {
+		ok, err := KernelAtLeast(test.release, 3, 10)
+		if err != nil || ok != test.expected {
+			t.Errorf("KernelAtLeast(%q) = %v, %v, expected %v", test.release, ok, err, test.expected)
+		}
+	}
+	if _, err := KernelAtLeast("unknown", 3, 10); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestAvailableBytes(t *testing.T) {
+	out := "Filesystem     1024-blocks    Used Available Capacity Mounted on\n/dev/sda1         40593708 2894820  37682504       8% /\n"
+	available, err := AvailableBytes([]byte(out))
+	if err != nil || available != 37682504*1024 {
+		t.Errorf("unexpected available space %d, %v", available, err)
+	}
+}
+
+func TestClockSynchronized(t *testing.T) {
+	synced, err := ClockSynchronized([]byte("      Local time: Tue 2019-03-05 10:00:00 UTC\nSystem clock synchronized: yes\n              NTP service: active\n"))
+	if err != nil || !synced {
+		t.Errorf("expected synchronized, found %v, %v", synced, err)
+	}
+	synced, err = ClockSynchronized([]byte("  Network time on: yes\nNTP synchronized: no\n"))
+	if err != nil || synced {
+		t.Errorf("expected not synchronized, found %v, %v", synced, err)
+	}
+	if _, err := ClockSynchronized([]byte("")); err == nil {
+		t.Errorf("expected an error")
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package profile counts the state reads and writes, SSH connections, and
+// remote commands of a command, and the time spent in each, to report where
+// the time of the command was spent.
+package profile
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile is the resource usage of a command. The methods of a nil Profile do
+// nothing, so that callers need not check whether profiling is enabled.
+type Profile struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	started time.Time
+
+	StateReads     Counter
+	StateWrites    Counter
+	SSHConnections Counter
+	RemoteCommands Counter
+	// Programs are the remote commands by program.
+	Programs map[string]*Counter
+}
+
+// Counter counts operations, the ones that failed, and their total duration.
+type Counter struct {
+	Count    int
+	Failed   int
+	Duration time.Duration
+}
+
+func (c *Counter) add(d time.Duration, err error) {
+	c.Count++
+	c.Duration += d
+	if err != nil {
+		c.Failed++
+	}
+}
+
+// New starts the profile of a command.
+func New() *Profile {
+	return newWithClock(time.Now)
+}
+
+func newWithClock(now func() time.Time) *Profile {
+	return &Profile{
+		now:      now,
+		started:  now(),
+		Programs: make(map[string]*Counter),
+	}
+}
+
+// RecordStateRead records a read of the state file that took d.
+func (p *Profile) RecordStateRead(d time.Duration, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.StateReads.add(d, err)
+}
+
+// RecordStateWrite records a write of the state file that took d.
+func (p *Profile) RecordStateWrite(d time.Duration, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.StateWrites.add(d, err)
+}
+
+// RecordSSHConnection records an SSH connection that took d to establish.
+func (p *Profile) RecordSSHConnection(d time.Duration, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.SSHConnections.add(d, err)
+}
+
+// RecordRemoteCommand records a command run on a machine that took d.
+func (p *Profile) RecordRemoteCommand(cmd string, d time.Duration, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.RemoteCommands.add(d, err)
+	program := Program(cmd)
+	c, ok := p.Programs[program]
+	if !ok {
+		c = &Counter{}
+		p.Programs[program] = c
+	}
+	c.add(d, err)
+}
+
+// Program returns the name of the program the command runs, ignoring sudo,
+// environment variable assignments, and the directory of the program.
+func Program(cmd string) string {
+	for _, field := range strings.Fields(cmd) {
+		if field == "sudo" || strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+			continue
+		}
+		return path.Base(field)
+	}
+	return "unknown"
+}
+
+// Write writes the profile of the command to w. The programs that took the
+// most time are listed first, at most maxPrograms of them.
+func (p *Profile) Write(w io.Writer, command string, maxPrograms int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	elapsed := p.now().Sub(p.started)
+	lines := []string{fmt.Sprintf("Profile of %q, %s:", command, round(elapsed))}
+	lines = append(lines,
+		counterLine("State reads", p.StateReads),
+		counterLine("State writes", p.StateWrites),
+		counterLine("SSH connections", p.SSHConnections),
+		counterLine("Remote commands", p.RemoteCommands),
+	)
+	// Machines can be operated on in parallel, so the time spent elsewhere
+	// is only known when it is positive.
+	accounted := p.StateReads.Duration + p.StateWrites.Duration + p.SSHConnections.Duration + p.RemoteCommands.Duration
+	if other := elapsed - accounted; other > 0 {
+		lines = append(lines, fmt.Sprintf("  %-20s %6s %10s", "Other", "", round(other)))
+	}
+	if len(p.Programs) != 0 {
+		lines = append(lines, "Remote commands by program:")
+	}
+	for i, program := range p.programsByDuration() {
+		if i == maxPrograms {
+			lines = append(lines, fmt.Sprintf("  ... %d more", len(p.Programs)-maxPrograms))
+			break
+		}
+		lines = append(lines, counterLine(program, *p.Programs[program]))
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func counterLine(name string, c Counter) string {
+	line := fmt.Sprintf("  %-20s %6d %10s", name, c.Count, round(c.Duration))
+	if c.Failed != 0 {
+		line += fmt.Sprintf("  %d failed", c.Failed)
+	}
+	return line
+}
+
+// programsByDuration returns the programs, those that took the most time
+// first.
+func (p *Profile) programsByDuration() []string {
+	var programs []string
+	for program := range p.Programs {
+		programs = append(programs, program)
+	}
+	sort.Slice(programs, func(i, j int) bool {
+		a, b := p.Programs[programs[i]], p.Programs[programs[j]]
+		if a.Duration != b.Duration {
+			return a.Duration > b.Duration
+		}
+		return programs[i] < programs[j]
+	})
+	return programs
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestProgram(t *testing.T) {
+	for cmd, expected := range map[string]string{
+		"sudo /opt/bin/nodeadm join --cfg /tmp/nodeadm.yaml":              "nodeadm",
+		"sudo -E KUBECONFIG=/etc/kubernetes/admin.conf kubectl get nodes": "kubectl",
+		"systemctl is-active kubelet":                                     "systemctl",
+		"":                                                                "unknown",
+	} {
+		if program := Program(cmd); program != expected {
+			t.Errorf("expected program of %q to be %q, found %q", cmd, expected, program)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newWithClock(func() time.Time { return now })
+	p.RecordStateRead(time.Millisecond, nil)
+	p.RecordStateWrite(2*time.Millisecond, nil)
+	p.RecordSSHConnection(time.Second, nil)
+	p.RecordSSHConnection(time.Second, fmt.Errorf("unable to dial"))
+	p.RecordRemoteCommand("sudo /opt/bin/nodeadm join", 5*time.Second, nil)
+	p.RecordRemoteCommand("kubectl get nodes", time.Second, nil)
+	p.RecordRemoteCommand("kubectl get pods", time.Second, fmt.Errorf("exit status 1"))
+	p.RecordRemoteCommand("cat /etc/os-release", time.Millisecond, nil)
+	now = now.Add(10 * time.Second)
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf, "cctl create machine", 2); err != nil {
+		t.Fatalf("unable to write profile: %v", err)
+	}
+	expected := `Profile of "cctl create machine", 10s:
+  State reads               1        1ms
+  State writes              1        2ms
+  SSH connections           2         2s  1 failed
+  Remote commands           4     7.001s  1 failed
+  Other                            996ms
+Remote commands by program:
+  nodeadm                   1         5s
+  kubectl                   2         2s  1 failed
+  ... 1 more
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\nfound\n%s", expected, buf.String())
+	}
+}
+
+func TestNil(t *testing.T) {
+	var p *Profile
+	p.RecordStateRead(time.Second, nil)
+	p.RecordRemoteCommand("ls", time.Second, nil)
+}
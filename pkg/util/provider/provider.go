@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package provider defines the parts of the ssh-provider that cctl uses, so
+// that another implementation, e.g. of a newer provider version, or a fake
+// for tests, can replace the vendored one without changing every command.
+package provider
+
+import (
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+	clusterclient "sigs.k8s.io/cluster-api/pkg/client/clientset_generated/clientset"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	spclient "github.com/platform9/ssh-provider/pkg/client/clientset_generated/clientset"
+	machineActuator "github.com/platform9/ssh-provider/pkg/clusterapi/machine"
+	sputil "github.com/platform9/ssh-provider/pkg/controller"
+
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+)
+
+// Actuator provisions, upgrades, and deprovisions machines.
+type Actuator interface {
+	Create(cluster *clusterv1.Cluster, machine *clusterv1.Machine) error
+	Update(cluster *clusterv1.Cluster, machine *clusterv1.Machine) error
+	Delete(cluster *clusterv1.Cluster, machine *clusterv1.Machine) error
+}
+
+// ActuatorBuilder returns an actuator that reads and writes objects with the
+// clients, and connects to machines with clients from the builder.
+type ActuatorBuilder func(kubeClient kubernetes.Interface, clusterClient clusterclient.Interface, spClient spclient.Interface, clientBuilder sshutil.ClientBuilder, insecureIgnoreHostKey bool, logLevel logrus.Level) Actuator
+
+// Codec reads and writes the provider spec and status of clusters and
+// machines, and the other provider data kept in objects.
+type Codec interface {
+	GetClusterSpec(cluster clusterv1.Cluster) (*spv1.ClusterSpec, error)
+	PutClusterSpec(clusterSpec spv1.ClusterSpec, cluster *clusterv1.Cluster) error
+	GetClusterStatus(cluster clusterv1.Cluster) (*spv1.ClusterStatus, error)
+	PutClusterStatus(clusterStatus spv1.ClusterStatus, cluster *clusterv1.Cluster) error
+	GetMachineSpec(machine clusterv1.Machine) (*spv1.MachineSpec, error)
+	PutMachineSpec(machineSpec spv1.MachineSpec, machine *clusterv1.Machine) error
+	GetMachineStatus(machine clusterv1.Machine) (*spv1.MachineStatus, error)
+	PutMachineStatus(machineStatus spv1.MachineStatus, machine *clusterv1.Machine) error
+	// PutMachineInstanceStatus records the status as the last applied
+	// instance of the machine.
+	PutMachineInstanceStatus(machine *clusterv1.Machine, status *clusterv1.Machine) (*clusterv1.Machine, error)
+	// BindMachineAndProvisionedMachine references each machine from the
+	// other.
+	BindMachineAndProvisionedMachine(machine *clusterv1.Machine, pm *spv1.ProvisionedMachine) error
+	// UsernameAndKeyFromSecret returns the username and private key of an
+	// SSH credential.
+	UsernameAndKeyFromSecret(secret *corev1.Secret) (string, string, error)
+}
+
+// NewSSHActuator returns the actuator of the vendored ssh-provider.
+func NewSSHActuator(kubeClient kubernetes.Interface, clusterClient clusterclient.Interface, spClient spclient.Interface, clientBuilder sshutil.ClientBuilder, insecureIgnoreHostKey bool, logLevel logrus.Level) Actuator {
+	return machineActuator.NewActuator(kubeClient, clusterClient, spClient, clientBuilder, insecureIgnoreHostKey, logLevel)
+}
+
+// SSHCodec is the codec of the vendored ssh-provider.
+var SSHCodec Codec = sshCodec{}
+
+type sshCodec struct{}
+
+func (sshCodec) GetClusterSpec(cluster clusterv1.Cluster) (*spv1.ClusterSpec, error) {
+	return sputil.GetClusterSpec(cluster)
+}
+
+func (sshCodec) PutClusterSpec(clusterSpec spv1.ClusterSpec, cluster *clusterv1.Cluster) error {
+	return sputil.PutClusterSpec(clusterSpec, cluster)
+}
+
+func (sshCodec) GetClusterStatus(cluster clusterv1.Cluster) (*spv1.ClusterStatus, error) {
+	return sputil.GetClusterStatus(cluster)
+}
+
+func (sshCodec) PutClusterStatus(clusterStatus spv1.ClusterStatus, cluster *clusterv1.Cluster) error {
+	return sputil.PutClusterStatus(clusterStatus, cluster)
+}
+
+func (sshCodec) GetMachineSpec(machine clusterv1.Machine) (*spv1.MachineSpec, error) {
+	return sputil.GetMachineSpec(machine)
+}
+
+func (sshCodec) PutMachineSpec(machineSpec spv1.MachineSpec, machine *clusterv1.Machine) error {
+	return sputil.PutMachineSpec(machineSpec, machine)
+}
+
+func (sshCodec) GetMachineStatus(machine clusterv1.Machine) (*spv1.MachineStatus, error) {
+	return sputil.GetMachineStatus(machine)
+}
+
+func (sshCodec) PutMachineStatus(machineStatus spv1.MachineStatus, machine *clusterv1.Machine) error {
+	return sputil.PutMachineStatus(machineStatus, machine)
+}
+
+func (sshCodec) PutMachineInstanceStatus(machine *clusterv1.Machine, status *clusterv1.Machine) (*clusterv1.Machine, error) {
+	return sputil.PutMachineInstanceStatus(machine, status)
+}
+
+func (sshCodec) BindMachineAndProvisionedMachine(machine *clusterv1.Machine, pm *spv1.ProvisionedMachine) error {
+	return sputil.BindMachineAndProvisionedMachine(machine, pm)
+}
+
+func (sshCodec) UsernameAndKeyFromSecret(secret *corev1.Secret) (string, string, error) {
+	return sputil.UsernameAndKeyFromSecret(secret)
+}
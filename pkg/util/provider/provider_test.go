@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+)
+
+func TestSSHCodec(t *testing.T) {
+	var cluster clusterv1.Cluster
+	spec := spv1.ClusterSpec{TypeMeta: typeMeta("ClusterSpec"), VIPConfiguration: &spv1.VIPConfiguration{IP: "10.0.0.100", RouterID: 51}}
+	if err := SSHCodec.PutClusterSpec(spec, &cluster); err != nil {
+		t.Fatalf("unable to put cluster spec: %v", err)
+	}
+	decoded, err := SSHCodec.GetClusterSpec(cluster)
+	if err != nil {
+		t.Fatalf("unable to get cluster spec: %v", err)
+	}
+	if decoded.VIPConfiguration == nil || *decoded.VIPConfiguration != *spec.VIPConfiguration {
+		t.Fatalf("expected VIP configuration %+v, found %+v", spec.VIPConfiguration, decoded.VIPConfiguration)
+	}
+
+	var machine clusterv1.Machine
+	if err := SSHCodec.PutMachineSpec(spv1.MachineSpec{TypeMeta: typeMeta("MachineSpec")}, &machine); err != nil {
+		t.Fatalf("unable to put machine spec: %v", err)
+	}
+	if err := SSHCodec.PutMachineStatus(spv1.MachineStatus{TypeMeta: typeMeta("MachineStatus")}, &machine); err != nil {
+		t.Fatalf("unable to put machine status: %v", err)
+	}
+	machine.Name = "machine"
+	pm := spv1.ProvisionedMachine{}
+	pm.Name = "provisioned-machine"
+	if err := SSHCodec.BindMachineAndProvisionedMachine(&machine, &pm); err != nil {
+		t.Fatalf("unable to bind machines: %v", err)
+	}
+	machineSpec, err := SSHCodec.GetMachineSpec(machine)
+	if err != nil {
+		t.Fatalf("unable to get machine spec: %v", err)
+	}
+	if machineSpec.ProvisionedMachineName != pm.Name {
+		t.Fatalf("expected provisioned machine %q, found %q", pm.Name, machineSpec.ProvisionedMachineName)
+	}
+	if pm.Status.MachineRef == nil || pm.Status.MachineRef.Name != machine.Name {
+		t.Fatalf("expected machine reference %q, found %+v", machine.Name, pm.Status.MachineRef)
+	}
+}
+
+func typeMeta(kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{APIVersion: "sshprovider.platform9.com/v1alpha1", Kind: kind}
+}
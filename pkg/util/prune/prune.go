@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package prune finds the objects in the state that are no longer used, so
+// that the state does not grow over the life of the cluster.
+package prune
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Object is an object in the state.
+type Object struct {
+	Kind    string
+	Name    string
+	Created time.Time
+}
+
+// References is the set of objects that are in use, by kind and name.
+type References map[string]bool
+
+// Add records that the object is in use.
+func (r References) Add(kind, name string) {
+	r[kind+"/"+name] = true
+}
+
+// Has returns true if the object is in use.
+func (r References) Has(kind, name string) bool {
+	return r[kind+"/"+name]
+}
+
+// Unused returns the objects that are not in use, and were created before the
+// cutoff, sorted by kind and name. Objects without a creation time are
+// treated as old.
+func Unused(objects []Object, refs References, cutoff time.Time) []Object {
+	var unused []Object
+	for _, o := range objects {
+		if refs.Has(o.Kind, o.Name) || o.Created.After(cutoff) {
+			continue
+		}
+		unused = append(unused, o)
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		if unused[i].Kind != unused[j].Kind {
+			return unused[i].Kind < unused[j].Kind
+		}
+		return unused[i].Name < unused[j].Name
+	})
+	return unused
+}
+
+// ParseAge parses an age, e.g. "90d", or any duration time.ParseDuration
+// accepts, e.g. "36h".
+func ParseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
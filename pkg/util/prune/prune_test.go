@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package prune
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnused(t *testing.T) {
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-100 * 24 * time.Hour)
+	objects := []Object{
+		{Kind: "Secret", Name: "etcd-ca", Created: old},
+		{Kind: "Secret", Name: "old-token", Created: old},
+		{Kind: "Secret", Name: "new-token", Created: now.Add(-time.Hour)},
+		{Kind: "ProvisionedMachine", Name: "10.0.0.2"},
+		{Kind: "ProvisionedMachine", Name: "10.0.0.1", Created: old},
+	}
+	refs := References{}
+	refs.Add("Secret", "etcd-ca")
+	refs.Add("ProvisionedMachine", "10.0.0.1")
+	unused := Unused(objects, refs, now.Add(-90*24*time.Hour))
+	expected := []Object{
+		{Kind: "ProvisionedMachine", Name: "10.0.0.2"},
+		{Kind: "Secret", Name: "old-token", Created: old},
+	}
+	if !reflect.DeepEqual(unused, expected) {
+		t.Errorf("expected %v, found %v", expected, unused)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age      string
+		expected time.Duration
+		valid    bool
+	}{
+		{"90d", 90 * 24 * time.Hour, true},
+		{"0d", 0, true},
+		{"36h", 36 * time.Hour, true},
+		{"-1d", 0, false},
+		{"d", 0, false},
+		{"ninety", 0, false},
+	}
+	for _, test := range tests {
+		d, err := ParseAge(test.age)
+		if (err == nil) != test.valid || d != test.expected {
+			t.Errorf("ParseAge(%q) = %v, %v", test.age, d, err)
+		}
+	}
+}
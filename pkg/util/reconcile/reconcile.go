@@ -0,0 +1,92 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reconcile compares the configuration of machines in the state with
+// the configuration applied to them, and describes the changes.
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Kinds of changes.
+const (
+	KindLabels            = "labels"
+	KindKubeletConfig     = "kubelet-config"
+	KindTaints            = "taints"
+	KindComponentVersions = "component-versions"
+)
+
+// Statuses of changes.
+const (
+	// StatusApplied means the change was applied.
+	StatusApplied = "Applied"
+	// StatusPlanned means the change would be applied, but was not, because
+	// only changes were reported.
+	StatusPlanned = "Planned"
+	// StatusPending means the change is disruptive, so it was not applied.
+	StatusPending = "Pending"
+)
+
+// Change is a difference between the configuration of a machine in the
+// state and the configuration applied to it.
+type Change struct {
+	Machine string `json:"machine"`
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail"`
+	// Disruptive changes require the node to be drained, or the machine to
+	// be replaced, and are never applied by reconcile.
+	Disruptive bool `json:"disruptive"`
+	// Remedy is the command that applies a disruptive change.
+	Remedy string `json:"remedy,omitempty"`
+	Status string `json:"status"`
+}
+
+// MissingLabels returns, as key=value and sorted, the labels that the node
+// does not have, or has with another value.
+func MissingLabels(want, have map[string]string) []string {
+	var missing []string
+	for k, v := range want {
+		if current, ok := have[k]; !ok || current != v {
+			missing = append(missing, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// MissingTaints returns, as key=value:effect, the taints that the node does
+// not have. Taints that the node has in addition, e.g. those added by
+// controllers, are ignored.
+func MissingTaints(want, have []corev1.Taint) []string {
+	var missing []string
+	for _, w := range want {
+		var found bool
+		for _, h := range have {
+			if h.MatchTaint(&w) && h.Value == w.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, w.ToString())
+		}
+	}
+	return missing
+}
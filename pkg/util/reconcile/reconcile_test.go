@@ -0,0 +1,52 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconcile
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMissingLabels(t *testing.T) {
+	want := map[string]string{"zone": "a", "disk": "ssd", "gpu": "true"}
+	have := map[string]string{"zone": "b", "disk": "ssd", "kubernetes.io/hostname": "n1"}
+	missing := MissingLabels(want, have)
+	if expected := []string{"gpu=true", "zone=a"}; !reflect.DeepEqual(missing, expected) {
+		t.Errorf("expected %v, got %v", expected, missing)
+	}
+	if missing := MissingLabels(nil, have); len(missing) != 0 {
+		t.Errorf("expected no missing labels, got %v", missing)
+	}
+}
+
+func TestMissingTaints(t *testing.T) {
+	want := []corev1.Taint{
+		{Key: "dedicated", Value: "db", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "gpu", Effect: corev1.TaintEffectPreferNoSchedule},
+	}
+	have := []corev1.Taint{
+		{Key: "dedicated", Value: "web", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "gpu", Effect: corev1.TaintEffectPreferNoSchedule},
+		{Key: "node.kubernetes.io/unreachable", Effect: corev1.TaintEffectNoExecute},
+	}
+	missing := MissingTaints(want, have)
+	if expected := []string{"dedicated=db:NoSchedule"}; !reflect.DeepEqual(missing, expected) {
+		t.Errorf("expected %v, got %v", expected, missing)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package report records a structured report of an operation on machines,
+// and writes it to a file, stdout, or an HTTP endpoint when the operation
+// completes.
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Report is the record of an operation. Phases are the progress messages of
+// the operation; each lasts until the next one starts.
+type Report struct {
+	mu  sync.Mutex
+	now func() time.Time
+
+	Operation       string        `json:"operation"`
+	Machines        []string      `json:"machines"`
+	Started         time.Time     `json:"started"`
+	Finished        time.Time     `json:"finished"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	Succeeded       bool          `json:"succeeded"`
+	Error           string        `json:"error,omitempty"`
+	Phases          []Phase       `json:"phases"`
+	Commands        []Command     `json:"commands"`
+	Objects         []interface{} `json:"objects,omitempty"`
+}
+
+// Phase is a step of the operation.
+type Phase struct {
+	Name            string    `json:"name"`
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+	ended           bool
+}
+
+// Command is a command run on a machine. Its output is not recorded, because
+// it can contain secrets, e.g. bootstrap tokens.
+type Command struct {
+	Host            string    `json:"host"`
+	Command         string    `json:"command"`
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// New starts the report of an operation on the machines.
+func New(operation string, machines []string) *Report {
+	return newWithClock(operation, machines, time.Now)
+}
+
+func newWithClock(operation string, machines []string, now func() time.Time) *Report {
+	return &Report{
+		now:       now,
+		Operation: operation,
+		Machines:  machines,
+		Started:   now().UTC(),
+		Phases:    []Phase{},
+		Commands:  []Command{},
+	}
+}
+
+// StartPhase ends the current phase, and starts a new one.
+func (r *Report) StartPhase(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now().UTC()
+	r.endPhase(now)
+	r.Phases = append(r.Phases, Phase{Name: name, Started: now})
+}
+
+// Fail records the error in the current phase. The operation fails with the
+// last error recorded.
+func (r *Report) Fail(message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.Phases); n != 0 {
+		r.Phases[n-1].Error = message
+	}
+	r.Error = message
+}
+
+// RecordCommand records a command run on the host.
+func (r *Report) RecordCommand(host, command string, started time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := Command{
+		Host:            host,
+		Command:         command,
+		Started:         started.UTC(),
+		DurationSeconds: r.now().Sub(started).Seconds(),
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	r.Commands = append(r.Commands, c)
+}
+
+// AddObject records the final state of an object.
+func (r *Report) AddObject(obj interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Objects = append(r.Objects, obj)
+}
+
+// Finish ends the operation. It succeeded if err is nil and no error was
+// recorded.
+func (r *Report) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now().UTC()
+	r.endPhase(now)
+	if err != nil {
+		r.Error = err.Error()
+		if n := len(r.Phases); n != 0 && len(r.Phases[n-1].Error) == 0 {
+			r.Phases[n-1].Error = r.Error
+		}
+	}
+	r.Finished = now
+	r.DurationSeconds = now.Sub(r.Started).Seconds()
+	r.Succeeded = len(r.Error) == 0
+}
+
+func (r *Report) endPhase(now time.Time) {
+	if n := len(r.Phases); n != 0 && !r.Phases[n-1].ended {
+		r.Phases[n-1].DurationSeconds = now.Sub(r.Phases[n-1].Started).Seconds()
+		r.Phases[n-1].ended = true
+	}
+}
+
+// Sink receives the report when the operation completes.
+type Sink interface {
+	Write(r *Report) error
+}
+
+// NewSink returns the sink for the target: "-" for stdout, an http:// or
+// https:// URL to POST the report to, or else the path of a file.
+func NewSink(target string, stdout io.Writer) (Sink, error) {
+	switch {
+	case len(target) == 0:
+		return nil, fmt.Errorf("no report target given")
+	case target == "-":
+		return &writerSink{w: stdout}, nil
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		return &httpSink{url: target, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	default:
+		return &fileSink{path: target}, nil
+	}
+}
+
+func marshal(r *Report) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal report: %v", err)
+	}
+	return append(b, '\n'), nil
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s *writerSink) Write(r *Report) error {
+	b, err := marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(b)
+	return err
+}
+
+type fileSink struct {
+	path string
+}
+
+func (s *fileSink) Write(r *Report) error {
+	b, err := marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(s.path, b, 0600); err != nil {
+		return fmt.Errorf("unable to write report to %q: %v", s.path, err)
+	}
+	return nil
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Write(r *Report) error {
+	b, err := marshal(r)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("unable to post report to %q: %v", s.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unable to post report to %q: %s: %s", s.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
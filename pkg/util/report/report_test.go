@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeClock advances by one second every time it is read.
+func fakeClock() func() time.Time {
+	t := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		t = t.Add(time.Second)
+		return t
+	}
+}
+
+func TestReport(t *testing.T) {
+	r := newWithClock("delete machine", []string{"10.0.0.1"}, fakeClock())
+	r.StartPhase("Draining node")
+	r.RecordCommand("10.0.0.1", "kubectl drain", r.Started, nil)
+	r.StartPhase("Deleting machine")
+	r.RecordCommand("10.0.0.1", "etcdadm reset", r.Started, fmt.Errorf("exit status 1"))
+	r.Fail("Unable to delete machine")
+	r.Finish(nil)
+
+	if r.Succeeded {
+		t.Errorf("expected the operation to fail")
+	}
+	if r.Error != "Unable to delete machine" {
+		t.Errorf("unexpected error %q", r.Error)
+	}
+	if len(r.Phases) != 2 {
+		t.Fatalf("expected 2 phases, found %d", len(r.Phases))
+	}
+	if r.Phases[0].DurationSeconds != 2 || len(r.Phases[0].Error) != 0 {
+		t.Errorf("unexpected first phase %+v", r.Phases[0])
+	}
+	if r.Phases[1].Error != "Unable to delete machine" || r.Phases[1].DurationSeconds <= 0 {
+		t.Errorf("unexpected second phase %+v", r.Phases[1])
+	}
+	if len(r.Commands) != 2 || r.Commands[1].Error != "exit status 1" {
+		t.Errorf("unexpected commands %+v", r.Commands)
+	}
+	if r.DurationSeconds != r.Finished.Sub(r.Started).Seconds() {
+		t.Errorf("unexpected duration %v", r.DurationSeconds)
+	}
+}
+
+func TestReportFinishWithError(t *testing.T) {
+	r := newWithClock("create machine", []string{"10.0.0.1"}, fakeClock())
+	r.Finish(nil)
+	if !r.Succeeded {
+		t.Errorf("expected the operation to succeed")
+	}
+	r = newWithClock("create machine", []string{"10.0.0.1"}, fakeClock())
+	r.StartPhase("Provisioning")
+	r.Finish(fmt.Errorf("failed"))
+	if r.Succeeded || r.Phases[0].Error != "failed" {
+		t.Errorf("expected the operation and phase to fail, found %+v", r)
+	}
+}
+
+func decode(t *testing.T, b []byte) *Report {
+	r := &Report{}
+	if err := json.Unmarshal(b, r); err != nil {
+		t.Fatalf("unable to decode report: %v", err)
+	}
+	return r
+}
+
+func TestSinks(t *testing.T) {
+	r := New("upgrade machine", []string{"10.0.0.1"})
+	r.Finish(nil)
+
+	var stdout bytes.Buffer
+	sink, err := NewSink("-", &stdout)
+	if err != nil {
+		t.Fatalf("unable to create sink: %v", err)
+	}
+	if err := sink.Write(r); err != nil {
+		t.Fatalf("unable to write report: %v", err)
+	}
+	if decode(t, stdout.Bytes()).Operation != "upgrade machine" {
+		t.Errorf("unexpected report on stdout: %s", stdout.String())
+	}
+
+	dir, err := ioutil.TempDir("", "report")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.json")
+	if sink, err = NewSink(path, nil); err != nil {
+		t.Fatalf("unable to create sink: %v", err)
+	}
+	if err := sink.Write(r); err != nil {
+		t.Fatalf("unable to write report: %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read report: %v", err)
+	}
+	if !decode(t, b).Succeeded {
+		t.Errorf("unexpected report in file: %s", b)
+	}
+
+	var posted []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		posted, _ = ioutil.ReadAll(req.Body)
+	}))
+	defer server.Close()
+	if sink, err = NewSink(server.URL, nil); err != nil {
+		t.Fatalf("unable to create sink: %v", err)
+	}
+	if err := sink.Write(r); err != nil {
+		t.Fatalf("unable to post report: %v", err)
+	}
+	if decode(t, posted).Machines[0] != "10.0.0.1" {
+		t.Errorf("unexpected posted report: %s", posted)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "no", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	if sink, err = NewSink(failing.URL, nil); err != nil {
+		t.Fatalf("unable to create sink: %v", err)
+	}
+	if err := sink.Write(r); err == nil {
+		t.Errorf("expected error posting to a failing endpoint")
+	}
+}
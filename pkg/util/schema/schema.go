@@ -0,0 +1,226 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema defines the JSON Schemas of the files cctl reads, and
+// validates files against them.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// Draft is the JSON Schema draft the schemas conform to. Only the keywords
+// of Schema are used.
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties is the schema of the properties of an object that
+	// are not in Properties. If it is nil, they are allowed, unless Closed is
+	// set.
+	AdditionalProperties *Schema  `json:"additionalProperties,omitempty"`
+	Items                *Schema  `json:"items,omitempty"`
+	Enum                 []string `json:"enum,omitempty"`
+	Pattern              string   `json:"pattern,omitempty"`
+	// Format is checked only if it is ipv4.
+	Format  string   `json:"format,omitempty"`
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Closed rejects properties of an object that are not in Properties.
+	Closed bool `json:"-"`
+}
+
+// MarshalJSON encodes the schema, with additionalProperties false if it is
+// closed.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type schema Schema
+	if !s.Closed {
+		return json.Marshal((*schema)(s))
+	}
+	return json.Marshal(struct {
+		*schema
+		AdditionalProperties bool `json:"additionalProperties"`
+	}{(*schema)(s), false})
+}
+
+// Error is a violation of a schema.
+type Error struct {
+	// Path is the JSON Pointer of the value that violates the schema, e.g.
+	// /machines/1/role. It is empty for the whole document.
+	Path    string
+	Message string
+}
+
+func (e Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Errors are the violations of a schema by a document.
+type Errors []Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i := range e {
+		messages[i] = e[i].Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate validates the YAML or JSON document against the schema. It
+// returns Errors, with every violation, if the document is not valid.
+func (s *Schema) Validate(data []byte) error {
+	b, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("unable to decode document: %v", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("unable to decode document: %v", err)
+	}
+	var errs Errors
+	s.validate("", doc, &errs)
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}, errs *Errors) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(s.Type) != 0 && !hasType(v, s.Type) {
+		fail("expected %s, found %s", s.Type, typeOf(v))
+		return
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := pointer(path, name)
+			if ps, ok := s.Properties[name]; ok {
+				ps.validate(child, value[name], errs)
+			} else if s.AdditionalProperties != nil {
+				s.AdditionalProperties.validate(child, value[name], errs)
+			} else if s.Closed {
+				*errs = append(*errs, Error{Path: child, Message: "unknown property"})
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				s.Items.validate(pointer(path, fmt.Sprint(i)), item, errs)
+			}
+		}
+	case string:
+		if len(s.Enum) != 0 && !contains(s.Enum, value) {
+			fail("%q is not one of %s", value, strings.Join(s.Enum, ", "))
+		}
+		if len(s.Pattern) != 0 {
+			if re, err := regexp.Compile(s.Pattern); err != nil {
+				fail("invalid pattern %q in schema: %v", s.Pattern, err)
+			} else if !re.MatchString(value) {
+				fail("%q does not match %s", value, s.Pattern)
+			}
+		}
+		if s.Format == "ipv4" {
+			if ip := net.ParseIP(value); ip == nil || ip.To4() == nil {
+				fail("%q is not an IPv4 address", value)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			fail("%v is less than the minimum %v", value, *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			fail("%v is greater than the maximum %v", value, *s.Maximum)
+		}
+	}
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// pointer appends the reference token to the JSON Pointer, escaping it as in
+// RFC 6901.
+func pointer(path, token string) string {
+	token = strings.Replace(token, "~", "~0", -1)
+	token = strings.Replace(token, "/", "~1", -1)
+	return path + "/" + token
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateManifest(t *testing.T) {
+	valid := `
+cluster:
+  apiVersion: cluster.k8s.io/v1alpha1
+  kind: Cluster
+  metadata:
+    name: cctl-cluster
+machines:
+- ip: 10.0.0.1
+  role: master
+  port: 22
+  labels:
+    zone: a
+- ip: 10.0.0.2
+  role: node
+`
+	if err := ValidateKind(Manifest, []byte(valid)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	invalid := `
+machines:
+- ip: 10.0.0.1
+  role: worker
+  port: 70000
+- ip: not-an-ip
+  role: node
+  labels:
+    gpu: true
+- role: node
+  ipaddress: 10.0.0.3
+extra: 1
+`
+	err := ValidateKind(Manifest, []byte(invalid))
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Fatalf("expected Errors, found %v", err)
+	}
+	expected := []string{
+		`/extra: unknown property`,
+		`/machines/0/port: 70000 is greater than the maximum 65535`,
+		`/machines/0/role: "worker" is not one of master, node, etcd`,
+		`/machines/1/ip: "not-an-ip" is not an IPv4 address`,
+		`/machines/1/labels/gpu: expected string, found boolean`,
+		`/machines/2: missing required property "ip"`,
+		`/machines/2/ipaddress: unknown property`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, found %d: %v", len(expected), len(errs), errs)
+	}
+	for i := range expected {
+		if errs[i].Error() != expected[i] {
+			t.Errorf("expected error %q, found %q", expected[i], errs[i].Error())
+		}
+	}
+}
+
+func TestValidateMachineDefaults(t *testing.T) {
+	valid := `
+master:
+  iface: bond0
+  taints:
+  - key: dedicated
+    effect: NoSchedule
+`
+	if err := ValidateKind(MachineDefaults, []byte(valid)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	invalid := `
+node:
+  taints:
+  - key: dedicated
+    effect: Never
+`
+	if err := ValidateKind(MachineDefaults, []byte(invalid)); err == nil || !strings.Contains(err.Error(), "/node/taints/0/effect") {
+		t.Errorf("expected an error at /node/taints/0/effect, found %v", err)
+	}
+}
+
+func TestValidateType(t *testing.T) {
+	if err := ValidateKind(ClusterConfig, []byte("- a\n- b\n")); err == nil || err.Error() != "expected object, found array" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := ValidateKind(ClusterConfig, []byte("kubeAPIServer:\n  a/b: 1\n")); err == nil || err.Error() != "/kubeAPIServer/a~1b: expected string, found number" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := ValidateKind("unknown", []byte("{}")); err == nil {
+		t.Errorf("expected an error for an unknown kind")
+	}
+}
+
+func TestForKind(t *testing.T) {
+	for _, kind := range Kinds() {
+		s, err := ForKind(kind)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", kind, err)
+		}
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatalf("unable to encode schema %q: %v", kind, err)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(b, &doc); err != nil {
+			t.Fatalf("unable to decode schema %q: %v", kind, err)
+		}
+		if doc["$schema"] != Draft || doc["type"] != "object" {
+			t.Errorf("unexpected schema %q: %s", kind, b)
+		}
+	}
+	s, err := ForKind(Manifest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("unable to encode schema: %v", err)
+	}
+	if !strings.Contains(string(b), `"additionalProperties":false`) {
+		t.Errorf("expected closed objects to disallow additional properties: %s", b)
+	}
+	if manifestSchema.Schema != "" {
+		t.Errorf("expected the built-in schema to be unchanged")
+	}
+}
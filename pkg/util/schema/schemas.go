@@ -0,0 +1,201 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/platform9/cctl/common"
+)
+
+// Kinds of files that have a schema.
+const (
+	// Manifest is the file of plan and apply.
+	Manifest = "manifest"
+	// Cluster is the file of create cluster --file.
+	Cluster = "cluster"
+	// ClusterConfig is the file of create cluster --cluster-config.
+	ClusterConfig = "cluster-config"
+	// MachineDefaults is the file of create cluster --machine-defaults.
+	MachineDefaults = "machine-defaults"
+)
+
+// idPrefix is the prefix of the $id of every schema.
+const idPrefix = "https://github.com/platform9/cctl/schemas/"
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func stringMap(description string) *Schema {
+	return &Schema{Type: "object", Description: description, AdditionalProperties: &Schema{Type: "string"}}
+}
+
+var portSchema = &Schema{Type: "integer", Minimum: float(1), Maximum: float(65535)}
+
+var clusterSchema = &Schema{
+	Type:        "object",
+	Description: "A Cluster API cluster object.",
+	Required:    []string{"apiVersion", "kind", "metadata"},
+	Properties: map[string]*Schema{
+		"apiVersion": {Type: "string", Enum: []string{"cluster.k8s.io/v1alpha1"}},
+		"kind":       {Type: "string", Enum: []string{"Cluster"}},
+		"metadata": {
+			Type:     "object",
+			Required: []string{"name"},
+			Properties: map[string]*Schema{
+				"name":        {Type: "string", Enum: []string{common.DefaultClusterName}},
+				"namespace":   {Type: "string"},
+				"labels":      stringMap("Labels of the cluster object."),
+				"annotations": stringMap("Annotations of the cluster object."),
+			},
+		},
+		"spec": {
+			Type: "object",
+			Properties: map[string]*Schema{
+				"clusterNetwork": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"services":      networkRangesSchema,
+						"pods":          networkRangesSchema,
+						"serviceDomain": {Type: "string"},
+					},
+				},
+				"providerSpec": {Type: "object"},
+			},
+		},
+		"status": {Type: "object"},
+	},
+}
+
+var networkRangesSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"cidrBlocks": {Type: "array", Items: &Schema{Type: "string"}},
+	},
+}
+
+var machineSchema = &Schema{
+	Type:     "object",
+	Closed:   true,
+	Required: []string{"ip", "role"},
+	Properties: map[string]*Schema{
+		"ip":         {Type: "string", Format: "ipv4"},
+		"role":       {Type: "string", Enum: []string{common.MasterRole, common.NodeRole, common.EtcdRole}},
+		"port":       portSchema,
+		"iface":      {Type: "string", Description: "Interface keepalived binds the VIP to on a master, or a comma-separated list of candidates."},
+		"publicKeys": {Type: "array", Description: "Files containing the SSH public keys of the machine.", Items: &Schema{Type: "string"}},
+		"labels":     stringMap("Labels added to the node of the machine."),
+	},
+}
+
+var manifestSchema = &Schema{
+	Type:        "object",
+	Description: "The desired cluster and machines, given to plan and apply.",
+	Closed:      true,
+	Properties: map[string]*Schema{
+		"cluster":  clusterSchema,
+		"machines": {Type: "array", Items: machineSchema},
+	},
+}
+
+var clusterConfigSchema = &Schema{
+	Type:        "object",
+	Description: "Configurable parameters of the cluster.",
+	Closed:      true,
+	Properties: map[string]*Schema{
+		"kubeAPIServer":         stringMap("Extra arguments of the API server."),
+		"kubeControllerManager": stringMap("Extra arguments of the controller manager."),
+		"kubeScheduler":         stringMap("Extra arguments of the scheduler."),
+		"kubeProxy":             {Type: "object"},
+		"kubelet":               {Type: "object"},
+		"networkBackend":        stringMap("Configuration of the network backend."),
+		"keepAlived":            stringMap("Configuration of keepalived."),
+	},
+}
+
+var roleDefaultsSchema = &Schema{
+	Type:   "object",
+	Closed: true,
+	Properties: map[string]*Schema{
+		"port":   portSchema,
+		"iface":  {Type: "string"},
+		"labels": stringMap("Labels added to the node of the machine."),
+		"taints": {
+			Type: "array",
+			Items: &Schema{
+				Type:     "object",
+				Closed:   true,
+				Required: []string{"key", "effect"},
+				Properties: map[string]*Schema{
+					"key":    {Type: "string"},
+					"value":  {Type: "string"},
+					"effect": {Type: "string", Enum: []string{"NoSchedule", "PreferNoSchedule", "NoExecute"}},
+				},
+			},
+		},
+		"kubeletConfig": {Type: "object"},
+	},
+}
+
+var machineDefaultsSchema = &Schema{
+	Type:                 "object",
+	Description:          "Defaults of create machine, by role, master or node.",
+	AdditionalProperties: roleDefaultsSchema,
+}
+
+var schemas = map[string]*Schema{
+	Manifest:        manifestSchema,
+	Cluster:         clusterSchema,
+	ClusterConfig:   clusterConfigSchema,
+	MachineDefaults: machineDefaultsSchema,
+}
+
+// Kinds returns the kinds of files that have a schema.
+func Kinds() []string {
+	kinds := make([]string, 0, len(schemas))
+	for kind := range schemas {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// ForKind returns the schema of the kind of file, as a document that can be
+// published.
+func ForKind(kind string) (*Schema, error) {
+	s, ok := schemas[kind]
+	if !ok {
+		return nil, fmt.Errorf("no schema for %q; must be one of %v", kind, Kinds())
+	}
+	doc := *s
+	doc.Schema = Draft
+	doc.ID = idPrefix + kind + ".json"
+	doc.Title = "cctl " + kind
+	return &doc, nil
+}
+
+// ValidateKind validates the YAML or JSON document against the schema of the
+// kind of file.
+func ValidateKind(kind string, data []byte) error {
+	s, ok := schemas[kind]
+	if !ok {
+		return fmt.Errorf("no schema for %q; must be one of %v", kind, Kinds())
+	}
+	return s.Validate(data)
+}
@@ -21,21 +21,22 @@ import (
 	"io/ioutil"
 
 	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/pki"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	certutil "k8s.io/client-go/util/cert"
 )
 
-func CreateCASecretDefault(secretName string) (*corev1.Secret, error) {
-	return CreateCASecret(secretName, "", "")
+func CreateCASecretDefault(namespace, secretName string) (*corev1.Secret, error) {
+	return CreateCASecret(namespace, secretName, "", "")
 }
 
-func CreateSAKeySecretDefault(secretName string) (*corev1.Secret, error) {
-	return CreateSAKeySecret(secretName, "", "")
+func CreateSAKeySecretDefault(namespace, secretName string) (*corev1.Secret, error) {
+	return CreateSAKeySecret(namespace, secretName, "", "")
 }
 
-func CreateCASecret(secretName, certFilename, keyFilename string) (*corev1.Secret, error) {
-	caSecret := createSecret(secretName)
+func CreateCASecret(namespace, secretName, certFilename, keyFilename string) (*corev1.Secret, error) {
+	caSecret := createSecret(namespace, secretName)
 
 	var certBytes []byte
 	var keyBytes []byte
@@ -49,6 +50,9 @@ func CreateCASecret(secretName, certFilename, keyFilename string) (*corev1.Secre
 		if err != nil {
 			return nil, fmt.Errorf("unable to read CA key %q: %v", keyFilename, err)
 		}
+		if err := pki.VerifyCA(certBytes, keyBytes); err != nil {
+			return nil, fmt.Errorf("invalid CA %q: %v", certFilename, err)
+		}
 	} else {
 		var err error
 		certBytes, keyBytes, err = generateCertPair()
@@ -62,8 +66,8 @@ func CreateCASecret(secretName, certFilename, keyFilename string) (*corev1.Secre
 	return caSecret, nil
 }
 
-func CreateSAKeySecret(secretName, saPrivateKeyFile, saPublicKeyFile string) (*corev1.Secret, error) {
-	sakSecret := createSecret(secretName)
+func CreateSAKeySecret(namespace, secretName, saPrivateKeyFile, saPublicKeyFile string) (*corev1.Secret, error) {
+	sakSecret := createSecret(namespace, secretName)
 
 	var privateKeyBytes []byte
 	var publicKeyBytes []byte
@@ -91,8 +95,8 @@ func CreateSAKeySecret(secretName, saPrivateKeyFile, saPublicKeyFile string) (*c
 	return sakSecret, nil
 }
 
-func CreateBootstrapTokenSecret(secretName string) (*corev1.Secret, error) {
-	btSecret := createSecret(secretName)
+func CreateBootstrapTokenSecret(namespace, secretName string) (*corev1.Secret, error) {
+	btSecret := createSecret(namespace, secretName)
 	return btSecret, nil
 }
 
@@ -121,7 +125,7 @@ func generateKeyPair() ([]byte, []byte, error) {
 	return privateKeyBytes, publicKeyBytes, nil
 }
 
-func createSecret(name string) *corev1.Secret {
+func createSecret(namespace, name string) *corev1.Secret {
 	secret := corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Secret",
@@ -129,7 +133,7 @@ func createSecret(name string) *corev1.Secret {
 		},
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              name,
-			Namespace:         common.DefaultNamespace,
+			Namespace:         namespace,
 			CreationTimestamp: metav1.Now(),
 		},
 		Data: make(map[string][]byte),
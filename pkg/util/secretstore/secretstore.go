@@ -0,0 +1,156 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package secretstore keeps the data of secrets outside the state file. A
+// secret whose data is kept in a store is annotated with the path of its data
+// in the store, and has no data in the state file. Its data is read from the
+// store when the state is read, so that commands, and the actuator, use it
+// like any other secret, and is written to the store when it changes.
+package secretstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/platform9/cctl/common"
+)
+
+// ErrNotFound is returned by Read when the store has no data at the path.
+var ErrNotFound = errors.New("secret not found in store")
+
+// Store holds the data of secrets, by path.
+type Store interface {
+	// Read returns the data at the path, or ErrNotFound.
+	Read(path string) (map[string][]byte, error)
+	// Write replaces the data at the path.
+	Write(path string, data map[string][]byte) error
+}
+
+// Path returns the path of the data of the secret in the store, or false if
+// its data is in the state file.
+func Path(secret *corev1.Secret) (string, bool) {
+	p, ok := secret.Annotations[common.VaultPathAnnotationKey]
+	return p, ok && len(p) != 0
+}
+
+// KeepPath keeps the data of a secret that replaces an existing one in the
+// store the existing secret is kept in, if any. Commands that build a new
+// secret, instead of changing the existing one, use it before they update the
+// secret, so that its data is not written to the state file.
+func KeepPath(secret, existing *corev1.Secret) {
+	p, ok := Path(existing)
+	if !ok {
+		return
+	}
+	if _, ok := Path(secret); ok {
+		return
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[common.VaultPathAnnotationKey] = p
+}
+
+// References returns the secrets, as namespace/name, whose data is in a
+// store, in order.
+func References(secrets []corev1.Secret) []string {
+	var names []string
+	for i := range secrets {
+		if _, ok := Path(&secrets[i]); ok {
+			names = append(names, secrets[i].Namespace+"/"+secrets[i].Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Inline returns the secrets, as namespace/name, whose data is in the state
+// file, in order.
+func Inline(secrets []corev1.Secret) []string {
+	var names []string
+	for i := range secrets {
+		if _, ok := Path(&secrets[i]); ok {
+			continue
+		}
+		if len(secrets[i].Data) != 0 || len(secrets[i].StringData) != 0 {
+			names = append(names, secrets[i].Namespace+"/"+secrets[i].Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve reads the data of the secrets whose data is in the store into the
+// secrets, and returns it by path. A secret that has data in the state file
+// too, e.g. because it was just annotated, keeps it, so that it is written to
+// the store.
+func Resolve(store Store, secrets []corev1.Secret) (map[string]map[string][]byte, error) {
+	stored := make(map[string]map[string][]byte)
+	for i := range secrets {
+		p, ok := Path(&secrets[i])
+		if !ok || len(secrets[i].Data) != 0 {
+			continue
+		}
+		data, err := store.Read(p)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret %s/%s from %q: %v", secrets[i].Namespace, secrets[i].Name, p, err)
+		}
+		secrets[i].Data = data
+		stored[p] = data
+	}
+	return stored, nil
+}
+
+// Strip writes the data of the secrets whose data is in the store to the
+// store, unless it is the stored data, and returns copies of the secrets
+// without it. The written data is recorded in stored.
+func Strip(store Store, secrets []corev1.Secret, stored map[string]map[string][]byte) ([]corev1.Secret, error) {
+	stripped := make([]corev1.Secret, len(secrets))
+	for i := range secrets {
+		s := secrets[i].DeepCopy()
+		p, ok := Path(s)
+		if ok && len(s.Data) != 0 {
+			if !equal(s.Data, stored[p]) {
+				if store == nil {
+					return nil, fmt.Errorf("secret %s/%s is kept in a secret store at %q, but no secret store is configured", s.Namespace, s.Name, p)
+				}
+				if err := store.Write(p, s.Data); err != nil {
+					return nil, fmt.Errorf("unable to write secret %s/%s to %q: %v", s.Namespace, s.Name, p, err)
+				}
+				stored[p] = s.Data
+			}
+			s.Data = nil
+		}
+		stripped[i] = *s
+	}
+	return stripped, nil
+}
+
+func equal(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !bytes.Equal(v, w) {
+			return false
+		}
+	}
+	return true
+}
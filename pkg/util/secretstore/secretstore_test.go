@@ -0,0 +1,144 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretstore_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/secretstore"
+)
+
+// memoryStore is a store that counts its writes.
+type memoryStore struct {
+	data   map[string]map[string][]byte
+	writes int
+}
+
+func (m *memoryStore) Read(path string) (map[string][]byte, error) {
+	data, ok := m.data[path]
+	if !ok {
+		return nil, secretstore.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m *memoryStore) Write(path string, data map[string][]byte) error {
+	m.data[path] = data
+	m.writes++
+	return nil
+}
+
+func newSecret(name, path string, data map[string][]byte) corev1.Secret {
+	s := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}, Data: data}
+	if len(path) != 0 {
+		s.Annotations = map[string]string{common.VaultPathAnnotationKey: path}
+	}
+	return s
+}
+
+func TestResolveAndStrip(t *testing.T) {
+	store := &memoryStore{data: map[string]map[string][]byte{
+		"secret/prod/apiserver-ca": {"tls.crt": []byte("cert"), "tls.key": []byte("key")},
+	}}
+	secrets := []corev1.Secret{
+		newSecret("apiserver-ca", "secret/prod/apiserver-ca", nil),
+		newSecret("ssh-credential", "secret/prod/ssh-credential", map[string][]byte{"username": []byte("root")}),
+		newSecret("bootstrap-token", "", map[string][]byte{"token": []byte("abc")}),
+	}
+	if diff := cmp.Diff([]string{"default/apiserver-ca", "default/ssh-credential"}, secretstore.References(secrets)); diff != "" {
+		t.Errorf("unexpected references (-expected +found):\n%s", diff)
+	}
+
+	stored, err := secretstore.Resolve(store, secrets)
+	if err != nil {
+		t.Fatalf("unable to resolve: %v", err)
+	}
+	if string(secrets[0].Data["tls.key"]) != "key" {
+		t.Errorf("expected the data to be read from the store, found %v", secrets[0].Data)
+	}
+
+	stripped, err := secretstore.Strip(store, secrets, stored)
+	if err != nil {
+		t.Fatalf("unable to strip: %v", err)
+	}
+	if stripped[0].Data != nil || stripped[1].Data != nil || string(stripped[2].Data["token"]) != "abc" {
+		t.Errorf("expected only the data of the stored secrets to be stripped, found %v", stripped)
+	}
+	if secrets[1].Data == nil {
+		t.Errorf("expected the secrets not to be changed")
+	}
+	// The inline data of the just annotated secret is written, the
+	// unchanged data is not.
+	if store.writes != 1 || string(store.data["secret/prod/ssh-credential"]["username"]) != "root" {
+		t.Errorf("expected one write of the annotated secret, found %d writes, %v", store.writes, store.data)
+	}
+	if _, err := secretstore.Strip(store, secrets, stored); err != nil || store.writes != 1 {
+		t.Errorf("expected no writes of unchanged data, found %d writes, %v", store.writes, err)
+	}
+	secrets[0].Data = map[string][]byte{"tls.crt": []byte("rotated"), "tls.key": []byte("key")}
+	if _, err := secretstore.Strip(store, secrets, stored); err != nil || store.writes != 2 {
+		t.Errorf("expected the changed data to be written, found %d writes, %v", store.writes, err)
+	}
+	if _, err := secretstore.Strip(nil, secrets, map[string]map[string][]byte{}); err == nil {
+		t.Errorf("expected an error writing without a store")
+	}
+
+	if _, err := secretstore.Resolve(store, []corev1.Secret{newSecret("missing", "secret/prod/missing", nil)}); err == nil {
+		t.Errorf("expected an error resolving a missing secret")
+	}
+}
+
+func TestKeepPath(t *testing.T) {
+	existing := newSecret("bootstrap-token", "secret/prod/bootstrap-token", nil)
+	secret := newSecret("bootstrap-token", "", map[string][]byte{"token": []byte("new")})
+	secretstore.KeepPath(&secret, &existing)
+	if p, ok := secretstore.Path(&secret); !ok || p != "secret/prod/bootstrap-token" {
+		t.Errorf("expected the path of the existing secret, got %q", p)
+	}
+
+	moved := newSecret("bootstrap-token", "secret/other/bootstrap-token", nil)
+	secretstore.KeepPath(&moved, &existing)
+	if p, _ := secretstore.Path(&moved); p != "secret/other/bootstrap-token" {
+		t.Errorf("expected the path of the secret to be kept, got %q", p)
+	}
+
+	inline := newSecret("bootstrap-token", "", nil)
+	secret = newSecret("bootstrap-token", "", nil)
+	secretstore.KeepPath(&secret, &inline)
+	if _, ok := secretstore.Path(&secret); ok {
+		t.Errorf("expected no path for a secret that replaces an inline secret")
+	}
+}
+
+func TestInline(t *testing.T) {
+	secrets := []corev1.Secret{
+		newSecret("ssh-credential", "", map[string][]byte{"ssh-privatekey": []byte("key")}),
+		newSecret("apiserver-ca", "secret/prod/apiserver-ca", map[string][]byte{"tls.key": []byte("key")}),
+		newSecret("etcd-ca", "secret/prod/etcd-ca", nil),
+		newSecret("bootstrap-token", "", nil),
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "admin-kubeconfig"}, StringData: map[string]string{"admin.conf": "config"}},
+	}
+	expected := []string{"default/admin-kubeconfig", "default/ssh-credential"}
+	if actual := secretstore.Inline(secrets); !cmp.Equal(expected, actual) {
+		t.Errorf("expected %v, found %v", expected, actual)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// Vault is a store in a KV version 2 secrets engine of HashiCorp Vault. A
+// path is the mount of the engine followed by the path of the secret in it,
+// e.g. secret/cctl/prod/apiserver-ca. Values are kept as text, so that
+// operators can read them with the vault command line tool.
+type Vault struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// NewVault returns the store of the Vault server at the address, e.g.
+// https://vault.example.com:8200, authenticated by the token.
+func NewVault(address, token string, client *http.Client) *Vault {
+	return &Vault{address: strings.TrimSuffix(address, "/"), token: token, client: client}
+}
+
+// kvResponse is the response of a KV version 2 read.
+type kvResponse struct {
+	Data struct {
+		Data map[string]string `json:"data"`
+	} `json:"data"`
+}
+
+// Read returns the data at the path.
+func (v *Vault) Read(path string) (map[string][]byte, error) {
+	u, err := v.url(path)
+	if err != nil {
+		return nil, err
+	}
+	body, status, err := v.do(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	var r kvResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("unable to parse response of %s: %v", u, err)
+	}
+	if r.Data.Data == nil {
+		// The latest version was deleted.
+		return nil, ErrNotFound
+	}
+	data := make(map[string][]byte, len(r.Data.Data))
+	for k, value := range r.Data.Data {
+		data[k] = []byte(value)
+	}
+	return data, nil
+}
+
+// Write replaces the data at the path with a new version.
+func (v *Vault) Write(path string, data map[string][]byte) error {
+	u, err := v.url(path)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string, len(data))
+	for k, value := range data {
+		if !utf8.Valid(value) {
+			return fmt.Errorf("the value of key %q is not text", k)
+		}
+		values[k] = string(value)
+	}
+	body, err := json.Marshal(map[string]interface{}{"data": values})
+	if err != nil {
+		return err
+	}
+	_, _, err = v.do(http.MethodPost, u, body)
+	return err
+}
+
+// url returns the URL of the data of the path, under the mount that is its
+// first element.
+func (v *Vault) url(path string) (string, error) {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", fmt.Errorf("path %q must be the mount of a KV secrets engine followed by the path of the secret", path)
+	}
+	return fmt.Sprintf("%s/v1/%s/data/%s", v.address, parts[0], parts[1]), nil
+}
+
+// do sends the request, and returns the body of a successful response. A
+// missing secret is not an error.
+func (v *Vault) do(method, u string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to reach Vault: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to read response of %s: %v", u, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return nil, resp.StatusCode, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(respBody, &e)
+		return nil, resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, u, resp.Status, strings.Join(e.Errors, "; "))
+	}
+	return respBody, resp.StatusCode, nil
+}
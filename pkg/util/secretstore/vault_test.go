@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package secretstore_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/platform9/cctl/pkg/util/secretstore"
+)
+
+func TestVault(t *testing.T) {
+	kv := map[string]map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := kv[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case http.MethodPost:
+			b, _ := ioutil.ReadAll(r.Body)
+			var body struct {
+				Data map[string]string `json:"data"`
+			}
+			if err := json.Unmarshal(b, &body); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			kv[r.URL.Path] = body.Data
+			w.Write([]byte(`{"data":{"version":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	v := secretstore.NewVault(server.URL+"/", "token", server.Client())
+	if _, err := v.Read("secret/prod/apiserver-ca"); err != secretstore.ErrNotFound {
+		t.Errorf("expected %v, found %v", secretstore.ErrNotFound, err)
+	}
+	if err := v.Write("secret/prod/apiserver-ca", map[string][]byte{"tls.crt": []byte("cert")}); err != nil {
+		t.Fatalf("unable to write: %v", err)
+	}
+	if _, ok := kv["/v1/secret/data/prod/apiserver-ca"]; !ok {
+		t.Errorf("expected the data to be written to the KV version 2 path, found %v", kv)
+	}
+	data, err := v.Read("secret/prod/apiserver-ca")
+	if err != nil || string(data["tls.crt"]) != "cert" {
+		t.Errorf("expected the written data, found %v, %v", data, err)
+	}
+	if err := v.Write("secret/prod/binary", map[string][]byte{"key": {0xff, 0xfe}}); err == nil {
+		t.Errorf("expected an error writing data that is not text")
+	}
+	if _, err := v.Read("secret"); err == nil {
+		t.Errorf("expected an error reading a path without a mount")
+	}
+	if _, err := secretstore.NewVault(server.URL, "wrong", server.Client()).Read("secret/prod/apiserver-ca"); err == nil {
+		t.Errorf("expected an error reading without permission")
+	}
+}
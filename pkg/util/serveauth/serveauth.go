@@ -0,0 +1,123 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package serveauth guards the API served by cctl serve against requests
+// that do not come from its clients: requests without its token, requests
+// that a web page can send cross-origin, and requests for another host, as
+// sent after DNS rebinding.
+package serveauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// tokenSize is the size of generated tokens, in bytes.
+const tokenSize = 32
+
+// LoadOrCreateToken returns the token in the file. If the file does not
+// exist, it creates it, readable only by its owner, with a random token, and
+// returns true.
+func LoadOrCreateToken(filename string) (string, bool, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err == nil {
+		token := strings.TrimSpace(string(b))
+		if len(token) == 0 {
+			return "", false, fmt.Errorf("token file %q is empty", filename)
+		}
+		return token, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("unable to read token file: %v", err)
+	}
+	raw := make([]byte, tokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", false, fmt.Errorf("unable to generate token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", false, fmt.Errorf("unable to create token file: %v", err)
+	}
+	if _, err := f.WriteString(token + "\n"); err != nil {
+		f.Close()
+		return "", false, fmt.Errorf("unable to write token file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", false, fmt.Errorf("unable to write token file: %v", err)
+	}
+	return token, true, nil
+}
+
+// Handler serves a request with next only if it has the bearer token, is for
+// the address the API is served on, and, if it has a body, the body is JSON.
+// If the API is served on all addresses, requests for any host are served.
+func Handler(next http.Handler, token, addr string) http.Handler {
+	hosts := allowedHosts(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hosts != nil && !hosts[strings.ToLower(r.Host)] {
+			http.Error(w, fmt.Sprintf("host %q not allowed", r.Host), http.StatusForbidden)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHosts returns the Host headers of requests for the address, or nil
+// if it is an address of all interfaces. A loopback address is also reached
+// as localhost.
+func allowedHosts(addr string) map[string]bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return map[string]bool{strings.ToLower(addr): true}
+	}
+	ip := net.ParseIP(host)
+	if len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		return nil
+	}
+	hosts := map[string]bool{strings.ToLower(net.JoinHostPort(host, port)): true}
+	if ip != nil && ip.IsLoopback() {
+		hosts[net.JoinHostPort("localhost", port)] = true
+	}
+	if port == "80" {
+		hosts[strings.ToLower(host)] = true
+		if ip != nil && ip.To4() == nil {
+			hosts["["+strings.ToLower(host)+"]"] = true
+		}
+	}
+	return hosts
+}
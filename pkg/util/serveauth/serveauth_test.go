@@ -0,0 +1,112 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serveauth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name        string
+		addr        string
+		method      string
+		host        string
+		auth        string
+		contentType string
+		want        int
+	}{
+		{"get", "127.0.0.1:7070", http.MethodGet, "127.0.0.1:7070", "Bearer secret", "", http.StatusOK},
+		{"localhost", "127.0.0.1:7070", http.MethodGet, "localhost:7070", "Bearer secret", "", http.StatusOK},
+		{"post json", "127.0.0.1:7070", http.MethodPost, "127.0.0.1:7070", "Bearer secret", "application/json; charset=utf-8", http.StatusOK},
+		{"post text", "127.0.0.1:7070", http.MethodPost, "127.0.0.1:7070", "Bearer secret", "text/plain", http.StatusUnsupportedMediaType},
+		{"post no content type", "127.0.0.1:7070", http.MethodPost, "127.0.0.1:7070", "Bearer secret", "", http.StatusUnsupportedMediaType},
+		{"no token", "127.0.0.1:7070", http.MethodGet, "127.0.0.1:7070", "", "", http.StatusUnauthorized},
+		{"wrong token", "127.0.0.1:7070", http.MethodGet, "127.0.0.1:7070", "Bearer other", "", http.StatusUnauthorized},
+		{"basic auth", "127.0.0.1:7070", http.MethodGet, "127.0.0.1:7070", "Basic secret", "", http.StatusUnauthorized},
+		{"rebound host", "127.0.0.1:7070", http.MethodGet, "attacker.example.com:7070", "Bearer secret", "", http.StatusForbidden},
+		{"other port", "127.0.0.1:7070", http.MethodGet, "127.0.0.1:8080", "Bearer secret", "", http.StatusForbidden},
+		{"all interfaces", "0.0.0.0:7070", http.MethodGet, "cctl.example.com:7070", "Bearer secret", "", http.StatusOK},
+		{"all interfaces no token", ":7070", http.MethodGet, "cctl.example.com:7070", "", "", http.StatusUnauthorized},
+		{"ipv6", "[::1]:7070", http.MethodGet, "[::1]:7070", "Bearer secret", "", http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/v1/machines", strings.NewReader("{}"))
+			r.Host = tc.host
+			if len(tc.auth) != 0 {
+				r.Header.Set("Authorization", tc.auth)
+			}
+			if len(tc.contentType) != 0 {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			Handler(ok, "secret", tc.addr).ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("expected status %d, got %d: %s", tc.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serveauth")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "token")
+
+	token, created, err := LoadOrCreateToken(filename)
+	if err != nil {
+		t.Fatalf("unable to create token: %v", err)
+	}
+	if !created || len(token) != 2*tokenSize {
+		t.Errorf("expected a new token of %d characters, got %q (created: %v)", 2*tokenSize, token, created)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatalf("unable to stat token file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected token file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	again, created, err := LoadOrCreateToken(filename)
+	if err != nil {
+		t.Fatalf("unable to load token: %v", err)
+	}
+	if created || again != token {
+		t.Errorf("expected the existing token %q, got %q (created: %v)", token, again, created)
+	}
+
+	if err := ioutil.WriteFile(filename, []byte("\n"), 0600); err != nil {
+		t.Fatalf("unable to write token file: %v", err)
+	}
+	if _, _, err := LoadOrCreateToken(filename); err == nil {
+		t.Errorf("expected an error for an empty token file")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signature signs files with an SSH private key, and verifies the
+// signatures, to detect changes made without the key.
+package signature
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SignerFromFile returns the signer for the unencrypted SSH private key in the
+// file.
+func SignerFromFile(filename string) (ssh.Signer, error) {
+	keyBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %q: %v", filename, err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key from %q: %v", filename, err)
+	}
+	return signer, nil
+}
+
+// Sign returns the signature of the data, base64-encoded on one line.
+func Sign(signer ssh.Signer, data []byte) ([]byte, error) {
+	sig, err := signer.Sign(rand.Reader, data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign: %v", err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(ssh.Marshal(sig))
+	return []byte(encoded + "\n"), nil
+}
+
+// Verify returns an error unless the encoded signature, as returned by Sign, is
+// a signature of the data by the key.
+func Verify(key ssh.PublicKey, data, encoded []byte) error {
+	sigBytes, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil {
+		return fmt.Errorf("unable to decode signature: %v", err)
+	}
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(sigBytes, sig); err != nil {
+		return fmt.Errorf("unable to decode signature: %v", err)
+	}
+	if err := key.Verify(data, sig); err != nil {
+		return fmt.Errorf("signature does not match the data: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signature
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newSigner(t *testing.T) ssh.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	return signer
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := newSigner(t)
+	data := []byte("schemaVersion: 2\n")
+	encoded, err := Sign(signer, data)
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	if err := Verify(signer.PublicKey(), data, encoded); err != nil {
+		t.Errorf("expected signature to verify, found %v", err)
+	}
+	if err := Verify(signer.PublicKey(), []byte("schemaVersion: 3\n"), encoded); err == nil {
+		t.Errorf("expected changed data not to verify")
+	}
+	if err := Verify(newSigner(t).PublicKey(), data, encoded); err == nil {
+		t.Errorf("expected signature not to verify with another key")
+	}
+	if err := Verify(signer.PublicKey(), data, []byte("not a signature")); err == nil {
+		t.Errorf("expected invalid signature not to verify")
+	}
+}
+
+func TestSignerFromFile(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "signature")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "id_rsa")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(filename, keyPEM, 0600); err != nil {
+		t.Fatalf("unable to write key: %v", err)
+	}
+	signer, err := SignerFromFile(filename)
+	if err != nil {
+		t.Fatalf("unable to read signer: %v", err)
+	}
+	encoded, err := Sign(signer, []byte("data"))
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	if err := Verify(signer.PublicKey(), []byte("data"), encoded); err != nil {
+		t.Errorf("expected signature to verify, found %v", err)
+	}
+	if _, err := SignerFromFile(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("expected missing key file to fail")
+	}
+}
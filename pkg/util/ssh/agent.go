@@ -0,0 +1,198 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AgentSocketEnvVar is the environment variable that holds the path of the
+// ssh-agent socket.
+const AgentSocketEnvVar = "SSH_AUTH_SOCK"
+
+// Message numbers of the ssh-agent protocol.
+// See https://tools.ietf.org/html/draft-miller-ssh-agent-00
+const (
+	agentFailure           = 5
+	agentRequestIdentities = 11
+	agentIdentitiesAnswer  = 12
+	agentSignRequest       = 13
+	agentSignResponse      = 14
+)
+
+// maxAgentResponseBytes limits the size of a response read from the agent.
+const maxAgentResponseBytes = 256 * 1024
+
+// agentClient is a minimal client of the ssh-agent protocol. It supports
+// listing keys and signing data, which is all that is needed to
+// authenticate.
+type agentClient struct {
+	dial func() (net.Conn, error)
+}
+
+// AgentSigners returns a signer for every key held by the ssh-agent whose
+// socket is given by the SSH_AUTH_SOCK environment variable. The private keys
+// never leave the agent.
+func AgentSigners() ([]ssh.Signer, error) {
+	socket := os.Getenv(AgentSocketEnvVar)
+	if len(socket) == 0 {
+		return nil, fmt.Errorf("%s is not set, no ssh-agent available", AgentSocketEnvVar)
+	}
+	a := &agentClient{
+		dial: func() (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}
+	return a.signers()
+}
+
+func (a *agentClient) signers() ([]ssh.Signer, error) {
+	resp, err := a.call([]byte{agentRequestIdentities})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list ssh-agent keys: %v", err)
+	}
+	if resp[0] != agentIdentitiesAnswer {
+		return nil, fmt.Errorf("unable to list ssh-agent keys: unexpected response type %d", resp[0])
+	}
+	rest := resp[1:]
+	n, rest, ok := parseUint32(rest)
+	if !ok {
+		return nil, errors.New("malformed ssh-agent identities answer")
+	}
+	var signers []ssh.Signer
+	for i := uint32(0); i < n; i++ {
+		var blob []byte
+		if blob, rest, ok = parseString(rest); !ok {
+			return nil, errors.New("malformed ssh-agent identities answer")
+		}
+		// The comment is not used.
+		if _, rest, ok = parseString(rest); !ok {
+			return nil, errors.New("malformed ssh-agent identities answer")
+		}
+		key, err := ssh.ParsePublicKey(blob)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse ssh-agent key: %v", err)
+		}
+		signers = append(signers, &agentSigner{agent: a, key: key})
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("ssh-agent has no keys")
+	}
+	return signers, nil
+}
+
+func (a *agentClient) sign(key ssh.PublicKey, data []byte) (*ssh.Signature, error) {
+	req := []byte{agentSignRequest}
+	req = appendString(req, key.Marshal())
+	req = appendString(req, data)
+	req = appendUint32(req, 0)
+	resp, err := a.call(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to sign with ssh-agent: %v", err)
+	}
+	if resp[0] != agentSignResponse {
+		return nil, fmt.Errorf("ssh-agent refused to sign: response type %d", resp[0])
+	}
+	blob, _, ok := parseString(resp[1:])
+	if !ok {
+		return nil, errors.New("malformed ssh-agent sign response")
+	}
+	format, rest, ok := parseString(blob)
+	if !ok {
+		return nil, errors.New("malformed ssh-agent signature")
+	}
+	sig, _, ok := parseString(rest)
+	if !ok {
+		return nil, errors.New("malformed ssh-agent signature")
+	}
+	return &ssh.Signature{Format: string(format), Blob: sig}, nil
+}
+
+// call sends a request to the agent and returns its response. A failure
+// response is returned as an error.
+func (a *agentClient) call(req []byte) ([]byte, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ssh-agent: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(appendString(nil, req)); err != nil {
+		return nil, fmt.Errorf("unable to write to ssh-agent: %v", err)
+	}
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		return nil, fmt.Errorf("unable to read from ssh-agent: %v", err)
+	}
+	length := binary.BigEndian.Uint32(lenBuf[:])
+	if length == 0 || length > maxAgentResponseBytes {
+		return nil, fmt.Errorf("invalid ssh-agent response length %d", length)
+	}
+	resp := make([]byte, length)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, fmt.Errorf("unable to read from ssh-agent: %v", err)
+	}
+	if resp[0] == agentFailure {
+		return nil, errors.New("ssh-agent returned failure")
+	}
+	return resp, nil
+}
+
+// agentSigner signs data with a key held by the ssh-agent.
+type agentSigner struct {
+	agent *agentClient
+	key   ssh.PublicKey
+}
+
+func (s *agentSigner) PublicKey() ssh.PublicKey {
+	return s.key
+}
+
+func (s *agentSigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.agent.sign(s.key, data)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendString(b []byte, s []byte) []byte {
+	return append(appendUint32(b, uint32(len(s))), s...)
+}
+
+func parseUint32(b []byte) (uint32, []byte, bool) {
+	if len(b) < 4 {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint32(b), b[4:], true
+}
+
+func parseString(b []byte) ([]byte, []byte, bool) {
+	n, rest, ok := parseUint32(b)
+	if !ok || uint32(len(rest)) < n {
+		return nil, nil, false
+	}
+	return rest[:n], rest[n:], true
+}
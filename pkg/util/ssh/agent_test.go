@@ -0,0 +1,118 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeAgent answers a single ssh-agent request on the connection, using the
+// signer.
+func fakeAgent(t *testing.T, conn net.Conn, signer ssh.Signer) {
+	defer conn.Close()
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(conn, lenBuf[:]); err != nil {
+		t.Errorf("fake agent: unable to read request: %v", err)
+		return
+	}
+	req := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		t.Errorf("fake agent: unable to read request: %v", err)
+		return
+	}
+	var resp []byte
+	switch req[0] {
+	case agentRequestIdentities:
+		resp = appendUint32([]byte{agentIdentitiesAnswer}, 1)
+		resp = appendString(resp, signer.PublicKey().Marshal())
+		resp = appendString(resp, []byte("test key"))
+	case agentSignRequest:
+		_, rest, _ := parseString(req[1:])
+		data, _, _ := parseString(rest)
+		sig, err := signer.Sign(rand.Reader, data)
+		if err != nil {
+			t.Errorf("fake agent: unable to sign: %v", err)
+			return
+		}
+		resp = appendString([]byte{agentSignResponse}, ssh.Marshal(sig))
+	default:
+		resp = []byte{agentFailure}
+	}
+	conn.Write(appendString(nil, resp))
+}
+
+func TestAgentSigners(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	a := &agentClient{
+		dial: func() (net.Conn, error) {
+			client, server := net.Pipe()
+			go fakeAgent(t, server, signer)
+			return client, nil
+		},
+	}
+	signers, err := a.signers()
+	if err != nil {
+		t.Fatalf("unable to list signers: %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("expected 1 signer, found %d", len(signers))
+	}
+	if string(signers[0].PublicKey().Marshal()) != string(signer.PublicKey().Marshal()) {
+		t.Fatalf("unexpected public key")
+	}
+	data := []byte("session data")
+	sig, err := signers[0].Sign(rand.Reader, data)
+	if err != nil {
+		t.Fatalf("unable to sign: %v", err)
+	}
+	if err := signer.PublicKey().Verify(data, sig); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+}
+
+func TestAgentFailure(t *testing.T) {
+	a := &agentClient{
+		dial: func() (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				var lenBuf [4]byte
+				io.ReadFull(server, lenBuf[:])
+				io.ReadFull(server, make([]byte, binary.BigEndian.Uint32(lenBuf[:])))
+				server.Write(appendString(nil, []byte{agentFailure}))
+			}()
+			return client, nil
+		},
+	}
+	if _, err := a.signers(); err == nil {
+		t.Fatalf("expected error when agent fails")
+	}
+}
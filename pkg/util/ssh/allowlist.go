@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+// CommandNotAllowedError is returned when a command is refused because it is
+// not in the allowlist.
+type CommandNotAllowedError struct {
+	Command string
+}
+
+func (e *CommandNotAllowedError) Error() string {
+	return fmt.Sprintf("command %q is not in the command allowlist", e.Command)
+}
+
+// NewAllowlistClient returns a client that refuses to run commands for which
+// allowed returns false. The file helpers, e.g. MkdirAll, are checked too,
+// because they run commands. Files are read and written over SFTP, which is
+// not checked.
+func NewAllowlistClient(client sshmachine.Client, allowed func(cmd string) bool) sshmachine.Client {
+	return &allowlistClient{Client: client, allowed: allowed}
+}
+
+type allowlistClient struct {
+	sshmachine.Client
+	allowed func(cmd string) bool
+}
+
+func (c *allowlistClient) Close() error {
+	return Close(c.Client)
+}
+
+func (c *allowlistClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	if !c.allowed(cmd) {
+		return nil, nil, &CommandNotAllowedError{Command: cmd}
+	}
+	return c.Client.RunCommand(cmd)
+}
+
+func (c *allowlistClient) MkdirAll(path string, mode os.FileMode) error {
+	return mkdirAll(c, path, mode)
+}
+
+func (c *allowlistClient) MoveFile(srcFilePath, dstFilePath string) error {
+	return moveFile(c, srcFilePath, dstFilePath)
+}
+
+func (c *allowlistClient) CopyFile(srcFilePath, dstFilePath string) error {
+	return copyFile(c, srcFilePath, dstFilePath)
+}
+
+func (c *allowlistClient) Exists(path string) (bool, error) {
+	return exists(c, path)
+}
+
+func (c *allowlistClient) RemoveFile(path string) error {
+	return removeFile(c, path)
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllowlistClient(t *testing.T) {
+	backend := newCountingClient()
+	client := NewAllowlistClient(backend, func(cmd string) bool {
+		return strings.HasPrefix(cmd, "mkdir -p ") || cmd == "nproc"
+	})
+
+	if _, _, err := client.RunCommand("nproc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, err := client.RunCommand("rm -rf /")
+	if _, ok := err.(*CommandNotAllowedError); !ok {
+		t.Fatalf("expected command not to be allowed, found %v", err)
+	}
+	if backend.runs["rm -rf /"] != 0 {
+		t.Errorf("expected command not to be run")
+	}
+
+	// MkdirAll also runs chmod, which is not allowed.
+	if err := client.MkdirAll("/var/cache/cctl", 0700); err == nil || !strings.Contains(err.Error(), "chmod 700") {
+		t.Errorf("expected chmod not to be allowed, found %v", err)
+	}
+	if backend.runs["mkdir -p /var/cache/cctl"] != 1 {
+		t.Errorf("expected mkdir to run once, found %d", backend.runs["mkdir -p /var/cache/cctl"])
+	}
+}
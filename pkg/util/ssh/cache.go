@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+// ReadCache caches the files read from, and the output of read-only commands
+// run on, machines. It is shared by every client of a machine, so that reads
+// repeated by different steps of an operation go to the machine only once.
+//
+// Any write through a client, and any command that is neither cached nor
+// known not to change the machine, invalidates the cache of the machine.
+// Changes made by other means must be followed by an explicit Invalidate.
+type ReadCache struct {
+	mu       sync.Mutex
+	entries  map[string]map[string]cacheEntry
+	commands map[string]bool
+	readOnly []string
+}
+
+type cacheEntry struct {
+	stdOut []byte
+	stdErr []byte
+}
+
+// NewReadCache returns a cache of the output of the commands, which must be
+// read-only. Commands that begin with one of the readOnlyPrefixes are not
+// cached, but do not invalidate the cache either.
+func NewReadCache(commands []string, readOnlyPrefixes []string) *ReadCache {
+	c := &ReadCache{
+		entries:  make(map[string]map[string]cacheEntry),
+		commands: make(map[string]bool),
+		readOnly: readOnlyPrefixes,
+	}
+	for _, cmd := range commands {
+		c.commands[cmd] = true
+	}
+	return c
+}
+
+// Wrap returns a client of the host whose reads use the cache.
+func (c *ReadCache) Wrap(host string, client sshmachine.Client) sshmachine.Client {
+	return &cachingClient{Client: client, host: host, cache: c}
+}
+
+// Invalidate removes the cached reads of the host.
+func (c *ReadCache) Invalidate(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, host)
+}
+
+func (c *ReadCache) get(host, key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[host][key]
+	return e, ok
+}
+
+func (c *ReadCache) put(host, key string, e cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[host]; !ok {
+		c.entries[host] = make(map[string]cacheEntry)
+	}
+	c.entries[host][key] = e
+}
+
+func (c *ReadCache) isReadOnly(cmd string) bool {
+	for _, prefix := range c.readOnly {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// File and command keys cannot collide, because a path is never empty.
+const (
+	fileKeyPrefix    = "file:"
+	commandKeyPrefix = "cmd:"
+)
+
+// cachingClient reads through the cache, and invalidates it when it changes
+// the machine. Failed reads are not cached.
+type cachingClient struct {
+	sshmachine.Client
+	host  string
+	cache *ReadCache
+}
+
+func (c *cachingClient) Close() error {
+	return Close(c.Client)
+}
+
+func (c *cachingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	if !c.cache.commands[cmd] {
+		if !c.cache.isReadOnly(cmd) {
+			defer c.cache.Invalidate(c.host)
+		}
+		return c.Client.RunCommand(cmd)
+	}
+	key := commandKeyPrefix + cmd
+	if e, ok := c.cache.get(c.host, key); ok {
+		return e.stdOut, e.stdErr, nil
+	}
+	stdOut, stdErr, err := c.Client.RunCommand(cmd)
+	if err == nil {
+		c.cache.put(c.host, key, cacheEntry{stdOut: stdOut, stdErr: stdErr})
+	}
+	return stdOut, stdErr, err
+}
+
+func (c *cachingClient) ReadFile(path string) ([]byte, error) {
+	key := fileKeyPrefix + path
+	if e, ok := c.cache.get(c.host, key); ok {
+		return e.stdOut, nil
+	}
+	b, err := c.Client.ReadFile(path)
+	if err == nil {
+		c.cache.put(c.host, key, cacheEntry{stdOut: b})
+	}
+	return b, err
+}
+
+func (c *cachingClient) WriteFile(path string, mode os.FileMode, b []byte) error {
+	defer c.cache.Invalidate(c.host)
+	return c.Client.WriteFile(path, mode, b)
+}
+
+func (c *cachingClient) MkdirAll(path string, mode os.FileMode) error {
+	defer c.cache.Invalidate(c.host)
+	return c.Client.MkdirAll(path, mode)
+}
+
+func (c *cachingClient) MoveFile(srcFilePath, dstFilePath string) error {
+	defer c.cache.Invalidate(c.host)
+	return c.Client.MoveFile(srcFilePath, dstFilePath)
+}
+
+func (c *cachingClient) CopyFile(srcFilePath, dstFilePath string) error {
+	defer c.cache.Invalidate(c.host)
+	return c.Client.CopyFile(srcFilePath, dstFilePath)
+}
+
+func (c *cachingClient) RemoveFile(path string) error {
+	defer c.cache.Invalidate(c.host)
+	return c.Client.RemoveFile(path)
+}
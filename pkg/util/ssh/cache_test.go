@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// countingClient counts the commands run and files read.
+type countingClient struct {
+	runs  map[string]int
+	reads map[string]int
+	files map[string][]byte
+}
+
+func newCountingClient() *countingClient {
+	return &countingClient{
+		runs:  make(map[string]int),
+		reads: make(map[string]int),
+		files: make(map[string][]byte),
+	}
+}
+
+func (c *countingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	c.runs[cmd]++
+	if cmd == "fail" {
+		return nil, nil, fmt.Errorf("command failed")
+	}
+	return []byte(fmt.Sprintf("%s %d", cmd, c.runs[cmd])), nil, nil
+}
+
+func (c *countingClient) WriteFile(path string, mode os.FileMode, b []byte) error {
+	c.files[path] = b
+	return nil
+}
+
+func (c *countingClient) ReadFile(path string) ([]byte, error) {
+	c.reads[path]++
+	b, ok := c.files[path]
+	if !ok {
+		return nil, fmt.Errorf("file %q does not exist", path)
+	}
+	return b, nil
+}
+
+func (c *countingClient) MkdirAll(path string, mode os.FileMode) error   { return nil }
+func (c *countingClient) MoveFile(srcFilePath, dstFilePath string) error { return nil }
+func (c *countingClient) CopyFile(srcFilePath, dstFilePath string) error { return nil }
+func (c *countingClient) Exists(filePath string) (bool, error)           { return true, nil }
+func (c *countingClient) RemoveFile(path string) error                   { return nil }
+
+func TestReadCache(t *testing.T) {
+	cache := NewReadCache([]string{"info", "fail"}, []string{"get "})
+	backend := newCountingClient()
+	backend.files["/admin.conf"] = []byte("v1")
+	first := cache.Wrap("10.0.0.1", backend)
+	second := cache.Wrap("10.0.0.1", backend)
+
+	for _, client := range []interface {
+		ReadFile(string) ([]byte, error)
+	}{first, second} {
+		b, err := client.ReadFile("/admin.conf")
+		if err != nil || string(b) != "v1" {
+			t.Fatalf("unexpected read %q, %v", b, err)
+		}
+	}
+	if backend.reads["/admin.conf"] != 1 {
+		t.Errorf("expected 1 read, found %d", backend.reads["/admin.conf"])
+	}
+
+	first.RunCommand("info")
+	second.RunCommand("info")
+	first.RunCommand("get nodes")
+	if backend.runs["info"] != 1 {
+		t.Errorf("expected cached command to run once, ran %d times", backend.runs["info"])
+	}
+
+	if _, _, err := first.RunCommand("fail"); err == nil {
+		t.Errorf("expected command to fail")
+	}
+	second.RunCommand("fail")
+	if backend.runs["fail"] != 2 {
+		t.Errorf("expected failed command not to be cached, ran %d times", backend.runs["fail"])
+	}
+
+	// A write invalidates the cache of the host.
+	if err := second.WriteFile("/admin.conf", 0600, []byte("v2")); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+	b, _ := first.ReadFile("/admin.conf")
+	if string(b) != "v2" {
+		t.Errorf("expected read after write to return %q, found %q", "v2", b)
+	}
+
+	// A command that may change the machine invalidates the cache.
+	first.RunCommand("reset")
+	stdOut, _, _ := first.RunCommand("info")
+	if string(stdOut) != "info 2" {
+		t.Errorf("expected command to run again after invalidation, found %q", stdOut)
+	}
+
+	// Other hosts are not affected.
+	other := cache.Wrap("10.0.0.2", backend)
+	other.RunCommand("reset")
+	first.RunCommand("info")
+	if backend.runs["info"] != 2 {
+		t.Errorf("expected cache of other host to be unaffected, ran %d times", backend.runs["info"])
+	}
+
+	cache.Invalidate("10.0.0.1")
+	first.RunCommand("info")
+	if backend.runs["info"] != 3 {
+		t.Errorf("expected command to run again after explicit invalidation, ran %d times", backend.runs["info"])
+	}
+}
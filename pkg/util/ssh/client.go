@@ -0,0 +1,383 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+// ClientBuilder creates a client for a machine. It is an alias, rather than a
+// defined type, so that it can be given to the machine actuator.
+type ClientBuilder = func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error)
+
+// Bastion is a jump host used to reach machines that are not directly
+// reachable.
+type Bastion struct {
+	Host                  string
+	Port                  int
+	Username              string
+	PrivateKey            string
+	PublicKeys            []string
+	InsecureIgnoreHostKey bool
+}
+
+// ParseHostPort parses an address of the form host[:port]. An IPv6 address
+// with a port is given in brackets, e.g. [fd00::1]:22. If the port is
+// omitted, defaultPort is used.
+func ParseHostPort(addr string, defaultPort int) (string, int, error) {
+	if net.ParseIP(addr) != nil {
+		return addr, defaultPort, nil
+	}
+	if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+		host := addr[1 : len(addr)-1]
+		if net.ParseIP(host) == nil {
+			return "", 0, fmt.Errorf("invalid IP address %q", host)
+		}
+		return host, defaultPort, nil
+	}
+	if !strings.Contains(addr, ":") {
+		return addr, defaultPort, nil
+	}
+	host, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port %q: %v", portString, err)
+	}
+	return host, port, nil
+}
+
+// NewBastionClientBuilder returns a ClientBuilder whose clients connect to the
+// machine through the bastion.
+func NewBastionClientBuilder(bastion Bastion) ClientBuilder {
+	return func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		sshClient, err := bastion.Dial(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+		if err != nil {
+			return nil, err
+		}
+		return newClient(sshClient)
+	}
+}
+
+// Dial connects to the machine through the bastion.
+func (bastion Bastion) Dial(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (*ssh.Client, error) {
+	bastionConfig, err := clientConfig(bastion.Username, bastion.PrivateKey, bastion.PublicKeys, bastion.InsecureIgnoreHostKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure bastion client: %v", err)
+	}
+	bastionClient, err := ssh.Dial("tcp", net.JoinHostPort(bastion.Host, strconv.Itoa(bastion.Port)), bastionConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial bastion %s:%d: %v", bastion.Host, bastion.Port, err)
+	}
+	machineConfig, err := clientConfig(username, privateKey, publicKeys, insecureIgnoreHostKey)
+	if err != nil {
+		bastionClient.Close()
+		return nil, err
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := bastionClient.Dial("tcp", addr)
+	if err != nil {
+		bastionClient.Close()
+		return nil, fmt.Errorf("unable to dial %s:%d through bastion: %v", host, port, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, machineConfig)
+	if err != nil {
+		bastionClient.Close()
+		return nil, fmt.Errorf("unable to connect to %s:%d through bastion: %v", host, port, err)
+	}
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+	// The connection to the bastion carries only this client, so it is closed
+	// with it.
+	go func() {
+		sshClient.Wait()
+		bastionClient.Close()
+	}()
+	return sshClient, nil
+}
+
+// NewClient connects directly to the machine. If the private key is empty,
+// the keys held by the ssh-agent are used to authenticate.
+func NewClient(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+	sshClient, err := Dial(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(sshClient)
+}
+
+// Dial connects directly to the machine. If the private key is empty, the
+// keys held by the ssh-agent are used to authenticate.
+func Dial(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (*ssh.Client, error) {
+	config, err := clientConfig(username, privateKey, publicKeys, insecureIgnoreHostKey)
+	if err != nil {
+		return nil, err
+	}
+	sshClient, err := ssh.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)), config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial %s:%d: %v", host, port, err)
+	}
+	return sshClient, nil
+}
+
+func newClient(sshClient *ssh.Client) (sshmachine.Client, error) {
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("unable to create sftp client: %v", err)
+	}
+	return &client{
+		sshClient:  sshClient,
+		sftpClient: sftpClient,
+	}, nil
+}
+
+// clientConfig returns the configuration used to connect to a machine. If the
+// private key is empty, the keys held by the ssh-agent are used to
+// authenticate.
+func clientConfig(username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (*ssh.ClientConfig, error) {
+	var auth ssh.AuthMethod
+	if len(privateKey) == 0 {
+		signers, err := AgentSigners()
+		if err != nil {
+			return nil, fmt.Errorf("no private key given, and unable to use ssh-agent: %v", err)
+		}
+		auth = ssh.PublicKeys(signers...)
+	} else {
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing private key: %v", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	}
+	config := &ssh.ClientConfig{
+		User: username,
+		Auth: []ssh.AuthMethod{
+			auth,
+		},
+	}
+	if insecureIgnoreHostKey {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		return config, nil
+	}
+	parsedKeys := make([]ssh.PublicKey, len(publicKeys))
+	for i, key := range publicKeys {
+		parsedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse host public key: %v", err)
+		}
+		parsedKeys[i] = parsedKey
+	}
+	config.HostKeyCallback = sshmachine.FixedHostKeys(parsedKeys)
+	return config, nil
+}
+
+// client implements sshmachine.Client. Like the sshmachine client, it runs
+// commands with sudo.
+type client struct {
+	sshClient  *ssh.Client
+	sftpClient *sftp.Client
+}
+
+func (c *client) RunCommand(cmd string) ([]byte, []byte, error) {
+	return c.RunCommandContext(context.Background(), cmd)
+}
+
+// RunCommandContext runs the command, and stops it when the context is done.
+func (c *client) RunCommandContext(ctx context.Context, cmd string) ([]byte, []byte, error) {
+	var stdOut, stdErr bytes.Buffer
+	ended, err := c.run(ctx, cmd, &stdOut, &stdErr)
+	if !ended {
+		// The session may still write to the buffers.
+		return nil, nil, err
+	}
+	return stdOut.Bytes(), stdErr.Bytes(), err
+}
+
+// StreamCommandContext runs the command, writing its output as it is
+// produced, and stops it when the context is done.
+func (c *client) StreamCommandContext(ctx context.Context, cmd string, stdOut, stdErr io.Writer) error {
+	_, err := c.run(ctx, cmd, stdOut, stdErr)
+	return err
+}
+
+// run runs the command with sudo. When the context is done, the command is
+// killed, and its session closed. It returns false if the session did not end
+// within TimeoutGracePeriod after that, e.g. because the connection hung.
+func (c *client) run(ctx context.Context, cmd string, stdOut, stdErr io.Writer) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return true, fmt.Errorf("command failed: not started: %v", err)
+	}
+	session, err := c.sshClient.NewSession()
+	if err != nil {
+		return true, fmt.Errorf("unable to create session: %v", err)
+	}
+	defer session.Close()
+	session.Stdout = stdOut
+	session.Stderr = stdErr
+	if err := session.Start(fmt.Sprintf("sudo %s", cmd)); err != nil {
+		return true, fmt.Errorf("unable to run command: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return true, fmt.Errorf("command failed: %v", err)
+		}
+		return true, nil
+	case <-ctx.Done():
+	}
+	// Not every SSH server delivers signals, so the session is also closed,
+	// which ends the command unless it ignores SIGHUP.
+	session.Signal(ssh.SIGKILL)
+	session.Close()
+	stopped := fmt.Errorf("command failed: stopped before it completed: %v", ctx.Err())
+	select {
+	case <-done:
+		return true, stopped
+	case <-time.After(TimeoutGracePeriod):
+		return false, stopped
+	}
+}
+
+func (c *client) WriteFile(path string, mode os.FileMode, b []byte) error {
+	f, err := c.sftpClient.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		return fmt.Errorf("write failed: %v", err)
+	}
+	if err := f.Chmod(mode); err != nil {
+		return fmt.Errorf("chmod failed: %v", err)
+	}
+	return nil
+}
+
+func (c *client) ReadFile(path string) ([]byte, error) {
+	f, err := c.sftpClient.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file: %v", err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %v", err)
+	}
+	return b, nil
+}
+
+func (c *client) MkdirAll(path string, mode os.FileMode) error {
+	return mkdirAll(c, path, mode)
+}
+
+func (c *client) MoveFile(srcFilePath, dstFilePath string) error {
+	return moveFile(c, srcFilePath, dstFilePath)
+}
+
+func (c *client) CopyFile(srcFilePath, dstFilePath string) error {
+	return copyFile(c, srcFilePath, dstFilePath)
+}
+
+func (c *client) Exists(path string) (bool, error) {
+	return exists(c, path)
+}
+
+func (c *client) RemoveFile(path string) error {
+	return removeFile(c, path)
+}
+
+// Close closes the connection to the machine, and to the bastion, if the
+// client connects through one.
+func (c *client) Close() error {
+	c.sftpClient.Close()
+	return c.sshClient.Close()
+}
+
+// Close closes the client, if it can be closed. The clients that wrap another
+// client close the client they wrap.
+func Close(client sshmachine.Client) error {
+	if c, ok := client.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// commandRunner runs commands on a machine. The file helpers below are
+// implemented with commands, so that clients wrapping another client can run
+// them through their own RunCommand.
+type commandRunner interface {
+	RunCommand(cmd string) ([]byte, []byte, error)
+}
+
+func mkdirAll(c commandRunner, path string, mode os.FileMode) error {
+	if _, _, err := c.RunCommand(fmt.Sprintf("mkdir -p %s", path)); err != nil {
+		return fmt.Errorf("unable to create directory %q: %v", path, err)
+	}
+	if _, _, err := c.RunCommand(fmt.Sprintf("chmod %s %s", strconv.FormatUint(uint64(mode), 8), path)); err != nil {
+		return fmt.Errorf("unable to set permissions to directory %q: %v", path, err)
+	}
+	return nil
+}
+
+func moveFile(c commandRunner, srcFilePath, dstFilePath string) error {
+	if _, _, err := c.RunCommand(fmt.Sprintf("mv -f %s %s", srcFilePath, dstFilePath)); err != nil {
+		return fmt.Errorf("unable to move file from %q to %q: %v", srcFilePath, dstFilePath, err)
+	}
+	return nil
+}
+
+func copyFile(c commandRunner, srcFilePath, dstFilePath string) error {
+	if _, _, err := c.RunCommand(fmt.Sprintf("cp -f %s %s", srcFilePath, dstFilePath)); err != nil {
+		return fmt.Errorf("unable to copy file from %q to %q: %v", srcFilePath, dstFilePath, err)
+	}
+	return nil
+}
+
+func exists(c commandRunner, path string) (bool, error) {
+	stdOut, _, err := c.RunCommand(fmt.Sprintf("test -e %s && echo true || echo false", path))
+	if err != nil {
+		return false, fmt.Errorf("unable to check if path %q exists: %v", path, err)
+	}
+	return strings.TrimSpace(string(stdOut)) == "true", nil
+}
+
+func removeFile(c commandRunner, path string) error {
+	if _, _, err := c.RunCommand(fmt.Sprintf("rm -f %s", path)); err != nil {
+		return fmt.Errorf("unable to remove file %q: %v", path, err)
+	}
+	return nil
+}
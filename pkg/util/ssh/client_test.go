@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseHostPort(t *testing.T) {
+	tests := []struct {
+		addr string
+		host string
+		port int
+		err  bool
+	}{
+		{addr: "10.0.0.1", host: "10.0.0.1", port: 22},
+		{addr: "10.0.0.1:2222", host: "10.0.0.1", port: 2222},
+		{addr: "bastion.example.com", host: "bastion.example.com", port: 22},
+		{addr: "fd00::1", host: "fd00::1", port: 22},
+		{addr: "[fd00::1]", host: "fd00::1", port: 22},
+		{addr: "[fd00::1]:2222", host: "fd00::1", port: 2222},
+		{addr: "[bastion]", err: true},
+		{addr: "10.0.0.1:ssh", err: true},
+		{addr: "fd00::1:2222:", err: true},
+	}
+	for _, test := range tests {
+		host, port, err := ParseHostPort(test.addr, 22)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error, found %s, %d", test.addr, host, port)
+			}
+			continue
+		}
+		if err != nil || host != test.host || port != test.port {
+			t.Errorf("%q: expected %s, %d, found %s, %d, %v", test.addr, test.host, test.port, host, port, err)
+		}
+	}
+}
+
+// newServerConfig returns the configuration of a test SSH server that
+// accepts any client.
+func newServerConfig(t *testing.T) *ssh.ServerConfig {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	return config
+}
+
+// serveSSH accepts connections on the listener, and serves each channel of a
+// connection with handle. When a connection is closed, it is sent to closed.
+func serveSSH(listener net.Listener, config *ssh.ServerConfig, handle func(ssh.NewChannel), closed chan<- net.Addr) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			serverConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+			if err != nil {
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			for newChannel := range chans {
+				go handle(newChannel)
+			}
+			serverConn.Wait()
+			if closed != nil {
+				closed <- serverConn.RemoteAddr()
+			}
+		}()
+	}
+}
+
+// forward forwards direct-tcpip channels, as a bastion does.
+func forward(newChannel ssh.NewChannel) {
+	if newChannel.ChannelType() != "direct-tcpip" {
+		newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		return
+	}
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+	channel.Close()
+}
+
+// serveSFTP serves the sftp subsystem, as a machine does.
+func serveSFTP(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "subsystem" || string(req.Payload[4:]) != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+		server, err := sftp.NewServer(channel)
+		if err != nil {
+			return
+		}
+		server.Serve()
+		return
+	}
+}
+
+func TestBastionClientBuilder(t *testing.T) {
+	machineListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer machineListener.Close()
+	go serveSSH(machineListener, newServerConfig(t), serveSFTP, nil)
+
+	bastionListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer bastionListener.Close()
+	bastionClosed := make(chan net.Addr, 1)
+	go serveSSH(bastionListener, newServerConfig(t), forward, bastionClosed)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	dir, err := ioutil.TempDir("", "cctl-bastion")
+	if err != nil {
+		t.Fatalf("unable to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("through the bastion"), 0600); err != nil {
+		t.Fatalf("unable to write file: %v", err)
+	}
+
+	bastion := Bastion{
+		Host:                  "127.0.0.1",
+		Port:                  bastionListener.Addr().(*net.TCPAddr).Port,
+		Username:              "bastion",
+		PrivateKey:            privateKey,
+		InsecureIgnoreHostKey: true,
+	}
+	c, err := NewBastionClientBuilder(bastion)("127.0.0.1", machineListener.Addr().(*net.TCPAddr).Port, "machine", privateKey, nil, true)
+	if err != nil {
+		t.Fatalf("unable to connect through bastion: %v", err)
+	}
+	b, err := c.ReadFile(path)
+	if err != nil || string(b) != "through the bastion" {
+		t.Fatalf("unexpected result %q, %v", b, err)
+	}
+	select {
+	case <-bastionClosed:
+		t.Fatalf("expected the bastion connection to stay open while the client is open")
+	default:
+	}
+
+	if closer, ok := c.(io.Closer); !ok {
+		t.Fatalf("expected client to be closeable")
+	} else if err := closer.Close(); err != nil {
+		t.Fatalf("unable to close client: %v", err)
+	}
+	select {
+	case <-bastionClosed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the bastion connection to be closed with the client")
+	}
+}
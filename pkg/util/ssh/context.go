@@ -0,0 +1,138 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+// ContextClient is a machine client whose commands stop when a context is
+// done, e.g. when it is cancelled, or its deadline passes.
+type ContextClient interface {
+	sshmachine.Client
+	// RunCommandContext runs the command, and stops it when the context is
+	// done.
+	RunCommandContext(ctx context.Context, cmd string) ([]byte, []byte, error)
+	// StreamCommandContext runs the command, writing its output as it is
+	// produced, and stops it when the context is done.
+	StreamCommandContext(ctx context.Context, cmd string, stdOut, stdErr io.Writer) error
+}
+
+// WithContext returns the client as a ContextClient. A client that does not
+// stop commands itself is adapted: the call returns when the context is done,
+// but the command runs on the machine until it completes.
+func WithContext(client sshmachine.Client) ContextClient {
+	if c, ok := client.(ContextClient); ok {
+		return c
+	}
+	return &contextAdapter{Client: client}
+}
+
+type contextAdapter struct {
+	sshmachine.Client
+}
+
+func (c *contextAdapter) Close() error {
+	return Close(c.Client)
+}
+
+func (c *contextAdapter) RunCommandContext(ctx context.Context, cmd string) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("command failed: not started: %v", err)
+	}
+	done := make(chan commandResult, 1)
+	go func() {
+		stdOut, stdErr, err := c.Client.RunCommand(cmd)
+		done <- commandResult{stdOut, stdErr, err}
+	}()
+	select {
+	case r := <-done:
+		return r.stdOut, r.stdErr, r.err
+	case <-ctx.Done():
+		return nil, nil, fmt.Errorf("command failed: abandoned before it completed: %v", ctx.Err())
+	}
+}
+
+func (c *contextAdapter) StreamCommandContext(ctx context.Context, cmd string, stdOut, stdErr io.Writer) error {
+	outBytes, errBytes, err := c.RunCommandContext(ctx, cmd)
+	if _, werr := stdOut.Write(outBytes); werr != nil && err == nil {
+		err = werr
+	}
+	if _, werr := stdErr.Write(errBytes); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+// BindContext returns a client whose commands stop when the context is done.
+// File transfers that started when it is done run to completion, but no new
+// operation starts.
+func BindContext(ctx context.Context, client sshmachine.Client) sshmachine.Client {
+	return &boundClient{ContextClient: WithContext(client), ctx: ctx}
+}
+
+type boundClient struct {
+	ContextClient
+	ctx context.Context
+}
+
+func (c *boundClient) Close() error {
+	return Close(c.ContextClient)
+}
+
+func (c *boundClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	return c.RunCommandContext(c.ctx, cmd)
+}
+
+func (c *boundClient) WriteFile(path string, mode os.FileMode, b []byte) error {
+	if err := c.ctx.Err(); err != nil {
+		return fmt.Errorf("unable to create file: not started: %v", err)
+	}
+	return c.ContextClient.WriteFile(path, mode, b)
+}
+
+func (c *boundClient) ReadFile(path string) ([]byte, error) {
+	if err := c.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("unable to open file: not started: %v", err)
+	}
+	return c.ContextClient.ReadFile(path)
+}
+
+func (c *boundClient) MkdirAll(path string, mode os.FileMode) error {
+	return mkdirAll(c, path, mode)
+}
+
+func (c *boundClient) MoveFile(srcFilePath, dstFilePath string) error {
+	return moveFile(c, srcFilePath, dstFilePath)
+}
+
+func (c *boundClient) CopyFile(srcFilePath, dstFilePath string) error {
+	return copyFile(c, srcFilePath, dstFilePath)
+}
+
+func (c *boundClient) Exists(path string) (bool, error) {
+	return exists(c, path)
+}
+
+func (c *boundClient) RemoveFile(path string) error {
+	return removeFile(c, path)
+}
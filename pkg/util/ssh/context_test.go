@@ -0,0 +1,180 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newCommandServer starts an SSH server that answers "sudo echo hi", and
+// runs any other command until it is signalled, or its session is closed. It
+// returns a client connected to it, and the signals it received.
+func newCommandServer(t *testing.T) (*client, chan string, func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(signer)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	signals := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer channel.Close()
+				for req := range requests {
+					switch req.Type {
+					case "exec":
+						req.Reply(true, nil)
+						if cmd := string(req.Payload[4:]); cmd == "sudo echo hi" {
+							channel.Write([]byte("hi\n"))
+							status := make([]byte, 4)
+							binary.BigEndian.PutUint32(status, 0)
+							channel.SendRequest("exit-status", false, status)
+							return
+						}
+					case "signal":
+						signals <- string(req.Payload[4:])
+						return
+					default:
+						req.Reply(false, nil)
+					}
+				}
+			}()
+		}
+	}()
+	sshClient, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		listener.Close()
+		t.Fatalf("unable to dial: %v", err)
+	}
+	return &client{sshClient: sshClient}, signals, func() {
+		sshClient.Close()
+		listener.Close()
+	}
+}
+
+func TestRunCommandContext(t *testing.T) {
+	c, signals, stop := newCommandServer(t)
+	defer stop()
+
+	stdOut, _, err := c.RunCommand("echo hi")
+	if err != nil || string(stdOut) != "hi\n" {
+		t.Fatalf("unexpected result %q, %v", stdOut, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, _, err = c.RunCommandContext(ctx, "sleep 3600")
+	if err == nil || !strings.Contains(err.Error(), "stopped before it completed") {
+		t.Fatalf("expected command to be stopped, found %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected command to stop at the deadline, took %v", elapsed)
+	}
+	select {
+	case signal := <-signals:
+		if signal != "KILL" {
+			t.Errorf("expected KILL, found %q", signal)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the command to be signalled")
+	}
+	if _, _, err := c.RunCommandContext(ctx, "echo hi"); err == nil || !strings.Contains(err.Error(), "not started") {
+		t.Errorf("expected command not to start after the deadline, found %v", err)
+	}
+
+	var streamed, streamedErr bytes.Buffer
+	if err := c.StreamCommandContext(context.Background(), "echo hi", &streamed, &streamedErr); err != nil || streamed.String() != "hi\n" {
+		t.Errorf("unexpected stream %q, %v", streamed.String(), err)
+	}
+}
+
+// blockingClient runs every command until it is released.
+type blockingClient struct {
+	*countingClient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	c.started <- struct{}{}
+	<-c.release
+	return c.countingClient.RunCommand(cmd)
+}
+
+func TestBindContext(t *testing.T) {
+	backend := &blockingClient{countingClient: newCountingClient(), started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(backend.release)
+	if adapted := WithContext(backend); WithContext(adapted) != adapted {
+		t.Errorf("expected a ContextClient to be used as it is")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	bound := BindContext(ctx, backend)
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := bound.RunCommand("sleep 3600")
+		done <- err
+	}()
+	<-backend.started
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "abandoned before it completed") {
+			t.Errorf("expected command to be abandoned, found %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected command to return when the context was cancelled")
+	}
+	if err := bound.MkdirAll("/tmp/x", 0755); err == nil {
+		t.Errorf("expected no operation to start after the context was cancelled")
+	}
+	if _, err := bound.ReadFile("/admin.conf"); err == nil || !strings.Contains(err.Error(), "not started") {
+		t.Errorf("expected read not to start, found %v", err)
+	}
+}
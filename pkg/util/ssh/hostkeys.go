@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKeyAlgorithms are the host key types requested when scanning a machine.
+var HostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSA,
+}
+
+// errHostKeyScanned aborts the handshake once the host key has been received.
+var errHostKeyScanned = errors.New("host key scanned")
+
+// Dialer opens a connection to the address.
+type Dialer func(addr string) (net.Conn, error)
+
+// TCPDialer returns a Dialer that connects over TCP with the timeout.
+func TCPDialer(timeout time.Duration) Dialer {
+	return func(addr string) (net.Conn, error) {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+}
+
+// Dialer connects to the bastion, and returns a Dialer that connects through
+// it with the timeout, and the connection to the bastion, which the caller
+// closes once it no longer dials.
+func (bastion Bastion) Dialer(timeout time.Duration) (Dialer, io.Closer, error) {
+	config, err := clientConfig(bastion.Username, bastion.PrivateKey, bastion.PublicKeys, bastion.InsecureIgnoreHostKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to configure bastion client: %v", err)
+	}
+	config.Timeout = timeout
+	bastionClient, err := ssh.Dial("tcp", net.JoinHostPort(bastion.Host, strconv.Itoa(bastion.Port)), config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to dial bastion %s:%d: %v", bastion.Host, bastion.Port, err)
+	}
+	dial := func(addr string) (net.Conn, error) {
+		type dialResult struct {
+			conn net.Conn
+			err  error
+		}
+		done := make(chan dialResult, 1)
+		go func() {
+			conn, err := bastionClient.Dial("tcp", addr)
+			done <- dialResult{conn, err}
+		}()
+		select {
+		case r := <-done:
+			if r.err != nil {
+				return nil, fmt.Errorf("unable to dial %s through bastion: %v", addr, r.err)
+			}
+			return r.conn, nil
+		case <-time.After(timeout):
+			// The connection, if the bastion makes it, is no longer wanted.
+			go func() {
+				if r := <-done; r.conn != nil {
+					r.conn.Close()
+				}
+			}()
+			return nil, fmt.Errorf("unable to dial %s through bastion: i/o timeout", addr)
+		}
+	}
+	return dial, bastionClient, nil
+}
+
+// ScanHostKeys returns the host public keys offered by the SSH server, one for
+// every algorithm in HostKeyAlgorithms the server supports. The keys are not
+// verified; it is up to the caller to confirm them with the user. No
+// authentication is attempted.
+func ScanHostKeys(dial Dialer, host string, port int) ([]ssh.PublicKey, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	var keys []ssh.PublicKey
+	var lastErr error
+	for _, algorithm := range HostKeyAlgorithms {
+		key, err := scanHostKey(dial, addr, algorithm)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("unable to retrieve host keys from %s: %v", addr, lastErr)
+	}
+	return keys, nil
+}
+
+func scanHostKey(dial Dialer, addr, algorithm string) (ssh.PublicKey, error) {
+	conn, err := dial(addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to dial: %v", err)
+	}
+	defer conn.Close()
+	var key ssh.PublicKey
+	config := &ssh.ClientConfig{
+		HostKeyAlgorithms: []string{algorithm},
+		HostKeyCallback: func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errHostKeyScanned
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	if key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unable to retrieve %s host key: %v", algorithm, err)
+}
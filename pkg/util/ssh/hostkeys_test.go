@@ -0,0 +1,151 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestScanHostKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	ecdsaSigner, err := ssh.NewSignerFromKey(ecdsaKey)
+	if err != nil {
+		t.Fatalf("unable to create signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(rsaSigner)
+	serverConfig.AddHostKey(ecdsaSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ssh.NewServerConn(conn, serverConfig)
+			}()
+		}
+	}()
+
+	dials := 0
+	dial := func(addr string) (net.Conn, error) {
+		dials++
+		return net.Dial("tcp", listener.Addr().String())
+	}
+	keys, err := ScanHostKeys(dial, "10.0.0.1", 22)
+	if err != nil {
+		t.Fatalf("unable to scan host keys: %v", err)
+	}
+	if dials != len(HostKeyAlgorithms) {
+		t.Fatalf("expected %d connections, found %d", len(HostKeyAlgorithms), dials)
+	}
+	expected := []ssh.PublicKey{ecdsaSigner.PublicKey(), rsaSigner.PublicKey()}
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %d keys, found %d", len(expected), len(keys))
+	}
+	for i := range expected {
+		if ssh.FingerprintSHA256(keys[i]) != ssh.FingerprintSHA256(expected[i]) {
+			t.Fatalf("key %d: expected %s, found %s", i, ssh.FingerprintSHA256(expected[i]), ssh.FingerprintSHA256(keys[i]))
+		}
+	}
+}
+
+func TestScanHostKeysUnreachable(t *testing.T) {
+	dial := func(addr string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errHostKeyScanned}
+	}
+	if _, err := ScanHostKeys(dial, "10.0.0.1", 22); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestScanHostKeysThroughBastion(t *testing.T) {
+	machineConfig := newServerConfig(t)
+	machineListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer machineListener.Close()
+	go serveSSH(machineListener, machineConfig, serveSFTP, nil)
+
+	bastionListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer bastionListener.Close()
+	bastionClosed := make(chan net.Addr, 1)
+	go serveSSH(bastionListener, newServerConfig(t), forward, bastionClosed)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	bastion := Bastion{
+		Host:                  "127.0.0.1",
+		Port:                  bastionListener.Addr().(*net.TCPAddr).Port,
+		Username:              "bastion",
+		PrivateKey:            string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		InsecureIgnoreHostKey: true,
+	}
+	dial, bastionConn, err := bastion.Dialer(5 * time.Second)
+	if err != nil {
+		t.Fatalf("unable to connect to bastion: %v", err)
+	}
+	keys, err := ScanHostKeys(dial, "127.0.0.1", machineListener.Addr().(*net.TCPAddr).Port)
+	if err != nil {
+		t.Fatalf("unable to scan host keys through bastion: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Type() != ssh.KeyAlgoRSA {
+		t.Fatalf("expected the RSA host key of the machine, found %d keys", len(keys))
+	}
+	if err := bastionConn.Close(); err != nil {
+		t.Fatalf("unable to close bastion connection: %v", err)
+	}
+	select {
+	case <-bastionClosed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the bastion connection to be closed")
+	}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"os"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+)
+
+// NewLoggingClient returns a client that logs, at debug level, every command
+// it runs and file it transfers on the host, and how long each took.
+func NewLoggingClient(host string, client sshmachine.Client) sshmachine.Client {
+	return &loggingClient{Client: client, host: host}
+}
+
+type loggingClient struct {
+	sshmachine.Client
+	host string
+}
+
+func (c *loggingClient) Close() error {
+	return Close(c.Client)
+}
+
+func (c *loggingClient) log(operation, target string, started time.Time, err error) {
+	fields := log.Fields{
+		"host":     c.host,
+		operation:  target,
+		"duration": time.Since(started).String(),
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	log.WithFields(fields).Debug("Remote operation completed")
+}
+
+func (c *loggingClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	started := time.Now()
+	stdOut, stdErr, err := c.Client.RunCommand(cmd)
+	c.log("command", cmd, started, err)
+	return stdOut, stdErr, err
+}
+
+func (c *loggingClient) ReadFile(path string) ([]byte, error) {
+	started := time.Now()
+	b, err := c.Client.ReadFile(path)
+	c.log("read", path, started, err)
+	return b, err
+}
+
+func (c *loggingClient) WriteFile(path string, mode os.FileMode, b []byte) error {
+	started := time.Now()
+	err := c.Client.WriteFile(path, mode, b)
+	c.log("write", path, started, err)
+	return err
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+)
+
+const (
+	// DefaultRetries is the number of times an SSH operation that fails
+	// because of the connection is retried.
+	DefaultRetries = 2
+	// DefaultRetryInterval is the time before the first retry.
+	DefaultRetryInterval = time.Second
+	// MaxRetryInterval bounds the time between retries.
+	MaxRetryInterval = time.Minute
+)
+
+// RetryOptions configures the retries of SSH operations.
+type RetryOptions struct {
+	// Retries is the number of times an operation is retried. Zero means
+	// operations are not retried.
+	Retries int
+	// Interval is the time before the first retry. It doubles after every
+	// retry, up to MaxRetryInterval.
+	Interval time.Duration
+	// Context, if set, stops the retries when it is done.
+	Context context.Context
+
+	sleep func(time.Duration)
+}
+
+// connectionErrors are the parts of the messages of errors caused by the
+// network or the SSH connection, rather than the operation.
+var connectionErrors = []string{
+	"unable to create session",
+	"unable to pipe",
+	"unable to run command",
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"no route to host",
+	"network is unreachable",
+	"i/o timeout",
+	"use of closed network connection",
+	"connection lost",
+	"EOF",
+}
+
+// IsRetryable returns true if the error was caused by the network or the SSH
+// connection, before any command ran, so that the operation can be retried. A
+// command that started is never retried, because it may not be idempotent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	if strings.Contains(msg, "command failed") {
+		return false
+	}
+	for _, s := range connectionErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRetryClientBuilder returns a builder that retries connecting to the
+// machine, and whose clients retry operations that fail because of the
+// connection, reconnecting before every retry.
+func NewRetryClientBuilder(builder ClientBuilder, opts RetryOptions) ClientBuilder {
+	if opts.Retries <= 0 {
+		return builder
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.sleep == nil {
+		opts.sleep = func(d time.Duration) {
+			select {
+			case <-opts.Context.Done():
+			case <-time.After(d):
+			}
+		}
+	}
+	return func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		c := &retryClient{
+			host: host,
+			opts: opts,
+			connect: func() (sshmachine.Client, error) {
+				return builder(host, port, username, privateKey, publicKeys, insecureIgnoreHostKey)
+			},
+		}
+		if err := c.retry("connection", false, func(sshmachine.Client) error { return nil }); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+type retryClient struct {
+	host    string
+	opts    RetryOptions
+	connect func() (sshmachine.Client, error)
+
+	mu     sync.Mutex
+	client sshmachine.Client
+}
+
+// retry calls fn with the client, connecting first if there is no client, or
+// the last attempt failed. If reuse is true, the first attempt uses the
+// current client.
+func (c *retryClient) retry(operation string, reuse bool, fn func(sshmachine.Client) error) error {
+	var err error
+	interval := c.opts.Interval
+	for attempt := 0; attempt <= c.opts.Retries; attempt++ {
+		if attempt > 0 {
+			if c.opts.Context.Err() != nil {
+				return fmt.Errorf("%v (retries stopped: %v)", err, c.opts.Context.Err())
+			}
+			log.Warnf("[ssh] %s: Retrying %s in %s (retry %d of %d) after error: %v", c.host, operation, interval, attempt, c.opts.Retries, err)
+			c.opts.sleep(interval)
+			if c.opts.Context.Err() != nil {
+				return fmt.Errorf("%v (retries stopped: %v)", err, c.opts.Context.Err())
+			}
+			if interval *= 2; interval > MaxRetryInterval {
+				interval = MaxRetryInterval
+			}
+		}
+		c.mu.Lock()
+		client := c.client
+		c.mu.Unlock()
+		if attempt > 0 || !reuse || client == nil {
+			if client, err = c.connect(); err != nil {
+				if !IsRetryable(err) {
+					return err
+				}
+				continue
+			}
+			c.mu.Lock()
+			previous := c.client
+			c.client = client
+			c.mu.Unlock()
+			if previous != nil {
+				Close(previous)
+			}
+		}
+		if err = fn(client); !IsRetryable(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%v (gave up after %d retries)", err, c.opts.Retries)
+}
+
+// Close closes the current connection. The next operation reconnects.
+func (c *retryClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		return nil
+	}
+	err := Close(c.client)
+	c.client = nil
+	return err
+}
+
+func (c *retryClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	var stdOut, stdErr []byte
+	err := c.retry(fmt.Sprintf("command %q", cmd), true, func(client sshmachine.Client) error {
+		var err error
+		stdOut, stdErr, err = client.RunCommand(cmd)
+		return err
+	})
+	return stdOut, stdErr, err
+}
+
+func (c *retryClient) WriteFile(path string, mode os.FileMode, b []byte) error {
+	return c.retry(fmt.Sprintf("writing %q", path), true, func(client sshmachine.Client) error {
+		return client.WriteFile(path, mode, b)
+	})
+}
+
+func (c *retryClient) ReadFile(path string) ([]byte, error) {
+	var b []byte
+	err := c.retry(fmt.Sprintf("reading %q", path), true, func(client sshmachine.Client) error {
+		var err error
+		b, err = client.ReadFile(path)
+		return err
+	})
+	return b, err
+}
+
+func (c *retryClient) MkdirAll(path string, mode os.FileMode) error {
+	return c.retry(fmt.Sprintf("creating directory %q", path), true, func(client sshmachine.Client) error {
+		return client.MkdirAll(path, mode)
+	})
+}
+
+func (c *retryClient) MoveFile(srcFilePath, dstFilePath string) error {
+	return c.retry(fmt.Sprintf("moving %q", srcFilePath), true, func(client sshmachine.Client) error {
+		return client.MoveFile(srcFilePath, dstFilePath)
+	})
+}
+
+func (c *retryClient) CopyFile(srcFilePath, dstFilePath string) error {
+	return c.retry(fmt.Sprintf("copying %q", srcFilePath), true, func(client sshmachine.Client) error {
+		return client.CopyFile(srcFilePath, dstFilePath)
+	})
+}
+
+func (c *retryClient) Exists(filePath string) (bool, error) {
+	var exists bool
+	err := c.retry(fmt.Sprintf("checking %q", filePath), true, func(client sshmachine.Client) error {
+		var err error
+		exists, err = client.Exists(filePath)
+		return err
+	})
+	return exists, err
+}
+
+func (c *retryClient) RemoveFile(path string) error {
+	return c.retry(fmt.Sprintf("removing %q", path), true, func(client sshmachine.Client) error {
+		return client.RemoveFile(path)
+	})
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+// flakyClient fails every operation because of the connection, until it is
+// replaced.
+type flakyClient struct {
+	*countingClient
+	broken bool
+	closed bool
+}
+
+func (c *flakyClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *flakyClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	if c.broken {
+		return nil, nil, fmt.Errorf("unable to create session: EOF")
+	}
+	return c.countingClient.RunCommand(cmd)
+}
+
+func (c *flakyClient) ReadFile(path string) ([]byte, error) {
+	if c.broken {
+		return nil, fmt.Errorf("read failed: connection reset by peer")
+	}
+	return c.countingClient.ReadFile(path)
+}
+
+func TestIsRetryable(t *testing.T) {
+	for msg, expected := range map[string]bool{
+		"unable to dial 10.0.0.1:22: dial tcp 10.0.0.1:22: connect: connection refused": true,
+		"unable to create session: EOF":                                                                     true,
+		"command failed: Process exited with status 1":                                                      false,
+		"unable to move file from \"a\" to \"b\": command failed: EOF":                                      false,
+		"unable to dial 10.0.0.1:22: ssh: handshake failed: ssh: unable to authenticate, attempted methods": false,
+		"unable to open file: file does not exist":                                                          false,
+	} {
+		if retryable := IsRetryable(fmt.Errorf("%s", msg)); retryable != expected {
+			t.Errorf("expected IsRetryable(%q) to be %v, found %v", msg, expected, retryable)
+		}
+	}
+	if IsRetryable(nil) {
+		t.Errorf("expected nil not to be retryable")
+	}
+}
+
+func TestRetryClient(t *testing.T) {
+	backend := newCountingClient()
+	backend.files["/admin.conf"] = []byte("v1")
+	var connects int
+	var clients []*flakyClient
+	// The first connection is refused, the second breaks after it is made,
+	// and the third works.
+	builder := func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		connects++
+		if connects == 1 {
+			return nil, fmt.Errorf("unable to dial %s:%d: connection refused", host, port)
+		}
+		c := &flakyClient{countingClient: backend, broken: connects == 2}
+		clients = append(clients, c)
+		return c, nil
+	}
+	var sleeps []time.Duration
+	opts := RetryOptions{Retries: 3, Interval: time.Second, sleep: func(d time.Duration) { sleeps = append(sleeps, d) }}
+	client, err := NewRetryClientBuilder(builder, opts)("10.0.0.1", 22, "root", "", nil, true)
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	stdOut, _, err := client.RunCommand("info")
+	if err != nil || string(stdOut) != "info 1" {
+		t.Fatalf("unexpected result %q, %v", stdOut, err)
+	}
+	if connects != 3 || len(clients) != 2 {
+		t.Errorf("expected 3 connection attempts, found %d", connects)
+	}
+	if !clients[0].closed || clients[1].closed {
+		t.Errorf("expected only the broken connection to be closed")
+	}
+	// Every operation starts with the initial interval.
+	if len(sleeps) != 2 || sleeps[0] != time.Second || sleeps[1] != time.Second {
+		t.Errorf("unexpected backoff %v", sleeps)
+	}
+	if b, err := client.ReadFile("/admin.conf"); err != nil || string(b) != "v1" {
+		t.Errorf("unexpected read %q, %v", b, err)
+	}
+	if connects != 3 {
+		t.Errorf("expected the working connection to be reused, found %d connection attempts", connects)
+	}
+
+	// A command that ran and failed is not retried.
+	if _, _, err := client.RunCommand("fail"); err == nil || backend.runs["fail"] != 1 {
+		t.Errorf("expected failed command to run once, found %d runs, %v", backend.runs["fail"], err)
+	}
+
+	// Closing a client that wraps the retrying client closes the connection.
+	if err := Close(NewLoggingClient("10.0.0.1", client)); err != nil || !clients[1].closed {
+		t.Errorf("expected the connection to be closed, %v", err)
+	}
+}
+
+func TestRetryClientGivesUp(t *testing.T) {
+	var connects int
+	builder := func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		connects++
+		return nil, fmt.Errorf("unable to dial %s:%d: i/o timeout", host, port)
+	}
+	var sleeps []time.Duration
+	opts := RetryOptions{Retries: 2, Interval: 40 * time.Second, sleep: func(d time.Duration) { sleeps = append(sleeps, d) }}
+	_, err := NewRetryClientBuilder(builder, opts)("10.0.0.1", 22, "root", "", nil, true)
+	if err == nil || !strings.Contains(err.Error(), "gave up after 2 retries") || connects != 3 {
+		t.Errorf("expected to give up after 3 attempts, found %d attempts, %v", connects, err)
+	}
+	if len(sleeps) != 2 || sleeps[0] != 40*time.Second || sleeps[1] != MaxRetryInterval {
+		t.Errorf("unexpected backoff %v", sleeps)
+	}
+
+	connects = 0
+	builder = func(host string, port int, username string, privateKey string, publicKeys []string, insecureIgnoreHostKey bool) (sshmachine.Client, error) {
+		connects++
+		return nil, fmt.Errorf("unable to dial %s:%d: ssh: handshake failed: ssh: unable to authenticate", host, port)
+	}
+	if _, err := NewRetryClientBuilder(builder, opts)("10.0.0.1", 22, "root", "", nil, true); err == nil || connects != 1 {
+		t.Errorf("expected authentication failure not to be retried, found %d attempts, %v", connects, err)
+	}
+}
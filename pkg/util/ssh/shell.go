@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// defaultTerm is the terminal type requested when TERM is not set.
+const defaultTerm = "xterm"
+
+// Shell runs the login shell of the user on the machine, or the command, if
+// it is not empty, with the standard streams attached to the session. If
+// stdin is a terminal, it is put in raw mode, and a pseudo-terminal of the
+// same size, which follows changes to the size, is requested.
+func Shell(sshClient *ssh.Client, command string, stdin *os.File, stdout, stderr io.Writer) error {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return fmt.Errorf("unable to create session: %v", err)
+	}
+	defer session.Close()
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	fd := int(stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		oldState, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("unable to put terminal in raw mode: %v", err)
+		}
+		defer terminal.Restore(fd, oldState)
+		width, height, err := terminal.GetSize(fd)
+		if err != nil {
+			return fmt.Errorf("unable to get terminal size: %v", err)
+		}
+		term := os.Getenv("TERM")
+		if len(term) == 0 {
+			term = defaultTerm
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(term, height, width, modes); err != nil {
+			return fmt.Errorf("unable to request pseudo-terminal: %v", err)
+		}
+		stop := followTerminalSize(fd, session)
+		defer stop()
+	}
+
+	if len(command) == 0 {
+		if err := session.Shell(); err != nil {
+			return fmt.Errorf("unable to start shell: %v", err)
+		}
+		return session.Wait()
+	}
+	return session.Run(command)
+}
+
+// followTerminalSize changes the size of the pseudo-terminal of the session
+// when the size of the local terminal changes, until the returned function is
+// called.
+func followTerminalSize(fd int, session *ssh.Session) func() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				if width, height, err := terminal.GetSize(fd); err == nil {
+					session.WindowChange(height, width)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
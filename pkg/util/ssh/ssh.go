@@ -17,6 +17,12 @@ limitations under the License.
 package ssh
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 
@@ -34,3 +40,94 @@ func PublicKeyFromFile(file string) (ssh.PublicKey, error) {
 	}
 	return key, nil
 }
+
+// ErrOpenSSHEncryption is returned for private keys protected by a passphrase
+// in the OpenSSH format, the default of ssh-keygen since OpenSSH 7.8, which
+// cannot be decrypted.
+var ErrOpenSSHEncryption = errors.New("private keys protected by a passphrase in the OpenSSH format are not supported. Convert an RSA or ECDSA key to the PEM format with `ssh-keygen -p -m PEM -f <file>`, which changes the key file in place, or add the key to the ssh-agent and create the credential with --ssh-agent")
+
+// openSSHKeyMagic begins the contents of a private key in the OpenSSH format.
+const openSSHKeyMagic = "openssh-key-v1\x00"
+
+// IsEncryptedPrivateKey returns true if the PEM encoded private key is
+// protected by a passphrase, in the PEM or the OpenSSH format.
+func IsEncryptedPrivateKey(privateKey string) bool {
+	block, _ := pem.Decode([]byte(privateKey))
+	return block != nil && (x509.IsEncryptedPEMBlock(block) || isEncryptedOpenSSHBlock(block))
+}
+
+// CheckEncryptedPrivateKey returns ErrOpenSSHEncryption if the private key is
+// protected by a passphrase in the OpenSSH format, so that the passphrase is
+// not asked for in vain.
+func CheckEncryptedPrivateKey(privateKey string) error {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block != nil && isEncryptedOpenSSHBlock(block) {
+		return ErrOpenSSHEncryption
+	}
+	return nil
+}
+
+// isEncryptedOpenSSHBlock returns true if the block holds a private key in the
+// OpenSSH format that is encrypted with a cipher.
+func isEncryptedOpenSSHBlock(block *pem.Block) bool {
+	if block.Type != "OPENSSH PRIVATE KEY" || !bytes.HasPrefix(block.Bytes, []byte(openSSHKeyMagic)) {
+		return false
+	}
+	var header struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}
+	if err := ssh.Unmarshal(block.Bytes[len(openSSHKeyMagic):], &header); err != nil {
+		return false
+	}
+	return header.CipherName != "none"
+}
+
+// PrivateKeyFingerprint returns the SHA256 fingerprint of the PEM encoded
+// private key, as it is stored. It identifies a key protected by a passphrase
+// without the passphrase, which is needed to read the public key of a key
+// encrypted in the PEM format.
+func PrivateKeyFingerprint(privateKey string) string {
+	b := []byte(privateKey)
+	if block, _ := pem.Decode(b); block != nil {
+		b = block.Bytes
+	}
+	sum := sha256.Sum256(b)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// DecryptPrivateKey decrypts a passphrase-protected PEM encoded private key,
+// and returns it PEM encoded. A private key that is not encrypted is returned
+// unchanged. Only keys encrypted in the PEM format (e.g. created with
+// `ssh-keygen -m PEM`) are supported; for keys encrypted in the OpenSSH format
+// it returns ErrOpenSSHEncryption.
+func DecryptPrivateKey(privateKey, passphrase string) (string, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return "", fmt.Errorf("no PEM encoded private key found")
+	}
+	if isEncryptedOpenSSHBlock(block) {
+		return "", ErrOpenSSHEncryption
+	}
+	if !x509.IsEncryptedPEMBlock(block) {
+		return privateKey, nil
+	}
+	der, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+	if err != nil {
+		if err == x509.IncorrectPasswordError {
+			return "", fmt.Errorf("incorrect passphrase")
+		}
+		return "", fmt.Errorf("unable to decrypt private key: %v", err)
+	}
+	decrypted := string(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}))
+	// The padding check done during decryption does not always detect an
+	// incorrect passphrase, so make sure the result is a valid key.
+	if _, err := ssh.ParseRawPrivateKey([]byte(decrypted)); err != nil {
+		return "", fmt.Errorf("incorrect passphrase")
+	}
+	return decrypted, nil
+}
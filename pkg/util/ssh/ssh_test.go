@@ -0,0 +1,113 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDecryptPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	der := x509.MarshalPKCS1PrivateKey(key)
+	plain := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", der, []byte("secret"), x509.PEMCipherAES256)
+	if err != nil {
+		t.Fatalf("unable to encrypt key: %v", err)
+	}
+	encrypted := string(pem.EncodeToMemory(block))
+
+	if IsEncryptedPrivateKey(plain) {
+		t.Errorf("expected plain key to not be encrypted")
+	}
+	if !IsEncryptedPrivateKey(encrypted) {
+		t.Errorf("expected encrypted key to be encrypted")
+	}
+
+	unchanged, err := DecryptPrivateKey(plain, "")
+	if err != nil {
+		t.Fatalf("unexpected error decrypting plain key: %v", err)
+	}
+	if unchanged != plain {
+		t.Errorf("expected plain key to be returned unchanged")
+	}
+
+	decrypted, err := DecryptPrivateKey(encrypted, "secret")
+	if err != nil {
+		t.Fatalf("unexpected error decrypting key: %v", err)
+	}
+	if decrypted != plain {
+		t.Errorf("expected decrypted key to equal plain key")
+	}
+	if _, err := ssh.ParsePrivateKey([]byte(decrypted)); err != nil {
+		t.Errorf("unable to parse decrypted key: %v", err)
+	}
+
+	if _, err := DecryptPrivateKey(encrypted, "wrong"); err == nil {
+		t.Errorf("expected error decrypting with wrong passphrase")
+	}
+	if _, err := DecryptPrivateKey("not a key", ""); err == nil {
+		t.Errorf("expected error decrypting invalid key")
+	}
+}
+
+// openSSHPrivateKey returns a private key in the OpenSSH format, encrypted
+// with the cipher. Only the header is valid, which is all that is read.
+func openSSHPrivateKey(cipher string) string {
+	header := struct {
+		CipherName   string
+		KdfName      string
+		KdfOpts      string
+		NumKeys      uint32
+		PubKey       []byte
+		PrivKeyBlock []byte
+	}{cipher, "bcrypt", "", 1, nil, nil}
+	if cipher == "none" {
+		header.KdfName = "none"
+	}
+	b := append([]byte(openSSHKeyMagic), ssh.Marshal(header)...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "OPENSSH PRIVATE KEY", Bytes: b}))
+}
+
+func TestOpenSSHEncryptedPrivateKey(t *testing.T) {
+	encrypted := openSSHPrivateKey("aes256-ctr")
+	if !IsEncryptedPrivateKey(encrypted) {
+		t.Errorf("expected key in the OpenSSH format to be encrypted")
+	}
+	if err := CheckEncryptedPrivateKey(encrypted); err != ErrOpenSSHEncryption {
+		t.Errorf("expected %v, found %v", ErrOpenSSHEncryption, err)
+	}
+	if _, err := DecryptPrivateKey(encrypted, "secret"); err != ErrOpenSSHEncryption {
+		t.Errorf("expected %v, found %v", ErrOpenSSHEncryption, err)
+	}
+
+	plain := openSSHPrivateKey("none")
+	if IsEncryptedPrivateKey(plain) {
+		t.Errorf("expected plain key in the OpenSSH format to not be encrypted")
+	}
+	if err := CheckEncryptedPrivateKey(plain); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+// TimeoutGracePeriod is how long after the timeout the remote command is
+// killed, if it ignores the termination signal, and how much longer the client
+// waits for the machine to report that the command ended.
+const TimeoutGracePeriod = 30 * time.Second
+
+// TimeoutError is returned when a command does not complete within the
+// timeout. It carries the output written before the command was stopped.
+type TimeoutError struct {
+	Command string
+	Timeout time.Duration
+	StdOut  []byte
+	StdErr  []byte
+	// Bundle is the path of the file the output was saved to, if any.
+	Bundle string
+}
+
+func (e *TimeoutError) Error() string {
+	msg := fmt.Sprintf("command %q did not complete within %v", e.Command, e.Timeout)
+	if len(e.Bundle) != 0 {
+		msg = fmt.Sprintf("%s; partial output saved to %q", msg, e.Bundle)
+	}
+	if tail := lastLine(e.StdErr); len(tail) != 0 {
+		return fmt.Sprintf("%s; last error output: %q", msg, tail)
+	}
+	if tail := lastLine(e.StdOut); len(tail) != 0 {
+		return fmt.Sprintf("%s; last output: %q", msg, tail)
+	}
+	return msg
+}
+
+func lastLine(b []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	return lines[len(lines)-1]
+}
+
+// IsTimeout returns true if the error is a TimeoutError.
+func IsTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
+// TimeoutOptions configures a client that bounds the time of commands.
+type TimeoutOptions struct {
+	// Timeout is how long a command may run. Zero means no limit.
+	Timeout time.Duration
+	// Programs are the names of the programs whose invocations are bounded,
+	// e.g. kubeadm. Other commands run without a limit.
+	Programs []string
+	// SaveOutput, if not nil, saves the output of a command that timed out,
+	// and returns where it was saved.
+	SaveOutput func(err *TimeoutError) (string, error)
+}
+
+// NewTimeoutClient returns a client that stops commands that run longer than
+// the timeout. The command is run under timeout(1), so that it stops on the
+// machine, and its partial output is returned. If the machine does not report
+// that the command ended, e.g. because the connection hung, the client gives
+// up waiting after a grace period.
+func NewTimeoutClient(client sshmachine.Client, opts TimeoutOptions) sshmachine.Client {
+	if opts.Timeout <= 0 {
+		return client
+	}
+	programs := make(map[string]bool)
+	for _, p := range opts.Programs {
+		programs[p] = true
+	}
+	return &timeoutClient{Client: client, opts: opts, programs: programs}
+}
+
+type timeoutClient struct {
+	sshmachine.Client
+	opts     TimeoutOptions
+	programs map[string]bool
+}
+
+func (c *timeoutClient) Close() error {
+	return Close(c.Client)
+}
+
+type commandResult struct {
+	stdOut []byte
+	stdErr []byte
+	err    error
+}
+
+func (c *timeoutClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	if !c.bounded(cmd) {
+		return c.Client.RunCommand(cmd)
+	}
+	seconds := int64(c.opts.Timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	bounded := fmt.Sprintf("timeout --kill-after=%ds %ds %s", int64(TimeoutGracePeriod/time.Second), seconds, cmd)
+	started := time.Now()
+	done := make(chan commandResult, 1)
+	go func() {
+		stdOut, stdErr, err := c.Client.RunCommand(bounded)
+		done <- commandResult{stdOut, stdErr, err}
+	}()
+	var r commandResult
+	select {
+	case r = <-done:
+		if r.err == nil || time.Since(started) < c.opts.Timeout {
+			return r.stdOut, r.stdErr, r.err
+		}
+	case <-time.After(c.opts.Timeout + 2*TimeoutGracePeriod):
+	}
+	timeoutErr := &TimeoutError{
+		Command: cmd,
+		Timeout: c.opts.Timeout,
+		StdOut:  r.stdOut,
+		StdErr:  r.stdErr,
+	}
+	if c.opts.SaveOutput != nil {
+		if bundle, err := c.opts.SaveOutput(timeoutErr); err == nil {
+			timeoutErr.Bundle = bundle
+		}
+	}
+	return r.stdOut, r.stdErr, timeoutErr
+}
+
+// bounded returns true if the command invokes one of the programs.
+func (c *timeoutClient) bounded(cmd string) bool {
+	fields := strings.Fields(cmd)
+	return len(fields) != 0 && c.programs[path.Base(fields[0])]
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ssh
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowClient runs every command for the given duration, and fails if the
+// command runs longer than the limit, as timeout(1) would.
+type slowClient struct {
+	*countingClient
+	duration time.Duration
+	limit    time.Duration
+	commands []string
+}
+
+func (c *slowClient) RunCommand(cmd string) ([]byte, []byte, error) {
+	c.commands = append(c.commands, cmd)
+	if c.duration > c.limit {
+		time.Sleep(c.limit)
+		return []byte("joining\n"), []byte("waiting for member\n"), fmt.Errorf("command failed: Process exited with status 124")
+	}
+	time.Sleep(c.duration)
+	return []byte("ok"), nil, nil
+}
+
+func TestTimeoutClient(t *testing.T) {
+	backend := &slowClient{countingClient: newCountingClient(), duration: time.Millisecond, limit: 50 * time.Millisecond}
+	var saved *TimeoutError
+	client := NewTimeoutClient(backend, TimeoutOptions{
+		Timeout:  50 * time.Millisecond,
+		Programs: []string{"etcdadm"},
+		SaveOutput: func(err *TimeoutError) (string, error) {
+			saved = err
+			return "/tmp/bundle.tar.gz", nil
+		},
+	})
+
+	if _, _, err := client.RunCommand("/opt/bin/etcdadm info"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "timeout --kill-after=30s 1s /opt/bin/etcdadm info"; backend.commands[0] != expected {
+		t.Errorf("expected command %q, found %q", expected, backend.commands[0])
+	}
+	client.RunCommand("/opt/bin/kubectl get nodes")
+	if backend.commands[1] != "/opt/bin/kubectl get nodes" {
+		t.Errorf("expected command not to be bounded, found %q", backend.commands[1])
+	}
+
+	backend.duration = time.Second
+	stdOut, _, err := client.RunCommand("/opt/bin/etcdadm join https://10.0.0.1:2379")
+	if !IsTimeout(err) {
+		t.Fatalf("expected timeout error, found %v", err)
+	}
+	if string(stdOut) != "joining\n" {
+		t.Errorf("expected partial output, found %q", stdOut)
+	}
+	if saved == nil || string(saved.StdErr) != "waiting for member\n" {
+		t.Errorf("expected partial output to be saved, found %+v", saved)
+	}
+	for _, s := range []string{"/opt/bin/etcdadm join", "/tmp/bundle.tar.gz", "waiting for member"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error %q to contain %q", err.Error(), s)
+		}
+	}
+
+	if NewTimeoutClient(backend, TimeoutOptions{}) != backend {
+		t.Errorf("expected a zero timeout to leave the client unchanged")
+	}
+}
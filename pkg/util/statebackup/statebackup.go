@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package statebackup keeps copies of the state file, made before it is
+// changed, so that a change can be reverted.
+package statebackup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Infix separates the name of the state file from the time of the copy
+	// in the name of the copy, e.g. state.yaml.bak-20190102T030405.000Z.
+	Infix = ".bak-"
+
+	timeFormat = "20060102T150405.000Z"
+	fileMode   = 0600
+	dirMode    = 0700
+)
+
+// Backup is a copy of the state file.
+type Backup struct {
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+	Size int64     `json:"size"`
+}
+
+// Snapshot copies the file, and the file named by appending the companion
+// suffix to it, if any, to the directory, and then removes all but the retain
+// newest copies. It returns the path of the copy, or an empty path if the file
+// does not exist.
+func Snapshot(filename, companionSuffix, dir string, retain int, now time.Time) (string, error) {
+	if _, err := os.Stat(filename); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to read %q: %v", filename, err)
+	}
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return "", fmt.Errorf("unable to create %q: %v", dir, err)
+	}
+	path := filepath.Join(dir, filepath.Base(filename)+Infix+now.UTC().Format(timeFormat))
+	if err := copyFile(filename, path); err != nil {
+		return "", err
+	}
+	if err := copyFileIfExists(filename+companionSuffix, path+companionSuffix); err != nil {
+		return "", err
+	}
+	return path, Prune(filename, companionSuffix, dir, retain)
+}
+
+// List returns the copies of the file in the directory, newest first.
+func List(filename, dir string) ([]Backup, error) {
+	prefix := filepath.Base(filename) + Infix
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Backup{}, nil
+		}
+		return nil, fmt.Errorf("unable to read %q: %v", dir, err)
+	}
+	backups := []Backup{}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasPrefix(info.Name(), prefix) {
+			continue
+		}
+		// Companion files do not parse as a time.
+		t, err := time.Parse(timeFormat, strings.TrimPrefix(info.Name(), prefix))
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Path: filepath.Join(dir, info.Name()), Time: t, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// Prune removes all but the retain newest copies of the file, and their
+// companions.
+func Prune(filename, companionSuffix, dir string, retain int) error {
+	backups, err := List(filename, dir)
+	if err != nil {
+		return err
+	}
+	if retain < 0 || len(backups) <= retain {
+		return nil
+	}
+	for _, b := range backups[retain:] {
+		for _, p := range []string{b.Path, b.Path + companionSuffix} {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to remove %q: %v", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore copies the backup, and its companion, to the file. If the backup
+// has no companion, the companion of the file is removed, since it belongs to
+// the replaced file.
+func Restore(backup, filename, companionSuffix string) error {
+	if err := copyFile(backup, filename); err != nil {
+		return err
+	}
+	if _, err := os.Stat(backup + companionSuffix); os.IsNotExist(err) {
+		if err := os.Remove(filename + companionSuffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove %q: %v", filename+companionSuffix, err)
+		}
+		return nil
+	}
+	return copyFile(backup+companionSuffix, filename+companionSuffix)
+}
+
+func copyFileIfExists(src, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return copyFile(src, dst)
+}
+
+// copyFile writes the file through a temporary file, so that the copy is
+// never partial.
+func copyFile(src, dst string) error {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("unable to read %q: %v", src, err)
+	}
+	tmp := dst + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, fileMode); err != nil {
+		return fmt.Errorf("unable to write %q: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("unable to write %q: %v", dst, err)
+	}
+	return nil
+}
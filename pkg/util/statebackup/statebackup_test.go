@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statebackup_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/platform9/cctl/pkg/util/statebackup"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("unable to write %q: %v", path, err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read %q: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statebackup")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "state.yaml")
+	backupDir := filepath.Join(dir, "backups")
+	now := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	path, err := statebackup.Snapshot(filename, ".sig", backupDir, 2, now)
+	if err != nil || path != "" {
+		t.Fatalf("expected no copy of a missing file, found %q, %v", path, err)
+	}
+
+	writeFile(t, filename, "v1")
+	writeFile(t, filename+".sig", "sig1")
+	first, err := statebackup.Snapshot(filename, ".sig", backupDir, 2, now)
+	if err != nil {
+		t.Fatalf("unable to snapshot: %v", err)
+	}
+	if expected := filepath.Join(backupDir, "state.yaml.bak-20190102T030405.000Z"); first != expected {
+		t.Errorf("expected copy %q, found %q", expected, first)
+	}
+	if readFile(t, first+".sig") != "sig1" {
+		t.Errorf("expected the signature to be copied")
+	}
+
+	writeFile(t, filename, "v2")
+	os.Remove(filename + ".sig")
+	second, err := statebackup.Snapshot(filename, ".sig", backupDir, 2, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unable to snapshot: %v", err)
+	}
+	writeFile(t, filename, "v3")
+	if _, err := statebackup.Snapshot(filename, ".sig", backupDir, 2, now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("unable to snapshot: %v", err)
+	}
+	backups, err := statebackup.List(filename, backupDir)
+	if err != nil {
+		t.Fatalf("unable to list: %v", err)
+	}
+	if len(backups) != 2 || backups[1].Path != second || !backups[0].Time.Equal(now.Add(2*time.Minute)) {
+		t.Fatalf("expected the two newest copies, newest first, found %+v", backups)
+	}
+	if _, err := os.Stat(first + ".sig"); !os.IsNotExist(err) {
+		t.Errorf("expected the signature of the pruned copy to be removed")
+	}
+
+	writeFile(t, filename+".sig", "sig3")
+	if err := statebackup.Restore(second, filename, ".sig"); err != nil {
+		t.Fatalf("unable to restore: %v", err)
+	}
+	if readFile(t, filename) != "v2" {
+		t.Errorf("expected the copy to be restored")
+	}
+	if _, err := os.Stat(filename + ".sig"); !os.IsNotExist(err) {
+		t.Errorf("expected the signature of the replaced file to be removed")
+	}
+}
+
+func TestListMissingDir(t *testing.T) {
+	backups, err := statebackup.List("state.yaml", "/nonexistent")
+	if err != nil || len(backups) != 0 {
+		t.Errorf("expected no copies, found %v, %v", backups, err)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statediff
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+// CertificateKey is the key of the certificate in the secrets of CAs.
+const CertificateKey = "tls.crt"
+
+// Live is what runs on the machines and the cluster of a namespace.
+type Live struct {
+	Namespace string
+	// Nodes are the nodes of the cluster, named by the machines they run on,
+	// or by themselves if they run on no machine in the state.
+	Nodes []Machine
+	// EtcdMembers are the members of the etcd cluster.
+	EtcdMembers []spv1.EtcdMember
+	// Certificates are the CA certificates on a master, by the name of the
+	// secret that holds them in the state.
+	Certificates map[string][]byte
+}
+
+// CompareLive returns the changes from the state to what runs on the machines
+// and the cluster: nodes added and removed, roles and kubelet versions
+// changed, etcd members added and removed, and CA certificates rotated.
+// Machines that run only an etcd member have no node, and are compared as
+// etcd members.
+func CompareLive(fromName string, from *cctlstate.State, toName string, live Live) (*Report, error) {
+	r := newReport(fromName, toName)
+
+	fromMachines := make(map[string]Machine)
+	for _, m := range from.MachineList.Items {
+		if m.Namespace != live.Namespace || !clusterapi.HasNode(m) {
+			continue
+		}
+		fromMachines[key(m.Namespace, m.Name)] = newMachine(m.Namespace, m.Name, m.Spec.Roles, m.Spec.Versions.Kubelet)
+	}
+	toMachines := make(map[string]Machine)
+	for _, n := range live.Nodes {
+		n.Namespace = live.Namespace
+		toMachines[key(n.Namespace, n.Name)] = n
+	}
+	for _, k := range sortedKeys(toMachines) {
+		if _, ok := fromMachines[k]; !ok {
+			r.MachinesAdded = append(r.MachinesAdded, toMachines[k])
+		}
+	}
+	for _, k := range sortedKeys(fromMachines) {
+		fromMachine := fromMachines[k]
+		toMachine, ok := toMachines[k]
+		if !ok {
+			r.MachinesRemoved = append(r.MachinesRemoved, fromMachine)
+			continue
+		}
+		fromRoles, toRoles := sortedCopy(fromMachine.Roles), sortedCopy(toMachine.Roles)
+		if strings.Join(fromRoles, ",") != strings.Join(toRoles, ",") {
+			r.FieldsChanged = append(r.FieldsChanged, liveField(fromMachine, "spec.roles", fromRoles, toRoles))
+		}
+		fromKubelet, toKubelet := strings.TrimPrefix(fromMachine.Kubelet, "v"), strings.TrimPrefix(toMachine.Kubelet, "v")
+		if fromKubelet != toKubelet {
+			r.FieldsChanged = append(r.FieldsChanged, liveField(fromMachine, "spec.versions.kubelet", fromKubelet, toKubelet))
+		}
+	}
+
+	fromMembers := make(map[string]EtcdMember)
+	for _, c := range from.ClusterList.Items {
+		if c.Namespace != live.Namespace {
+			continue
+		}
+		status, err := clusterStatus(&c.Status)
+		if err != nil {
+			return nil, err
+		}
+		addEtcdMembers(fromMembers, c.Namespace, status.EtcdMembers)
+	}
+	toMembers := make(map[string]EtcdMember)
+	addEtcdMembers(toMembers, live.Namespace, live.EtcdMembers)
+	r.compareEtcdMembers(fromMembers, toMembers)
+
+	secrets := make(map[string]corev1.Secret)
+	for _, s := range from.SecretList.Items {
+		if s.Namespace == live.Namespace {
+			secrets[s.Name] = s
+		}
+	}
+	for _, name := range sortedKeys(live.Certificates) {
+		toData := live.Certificates[name]
+		s, ok := secrets[name]
+		if !ok {
+			r.SecretsChanged = append(r.SecretsChanged, Secret{Namespace: live.Namespace, Name: name, Change: Added, Keys: []string{CertificateKey}})
+			continue
+		}
+		fromData := s.Data[CertificateKey]
+		if fromCert, toCert := parseCertificate(fromData), parseCertificate(toData); bytes.Equal(fromData, toData) ||
+			fromCert != nil && toCert != nil && fromCert.Equal(toCert) {
+			continue
+		}
+		if c, ok := rotatedCertificate(live.Namespace, name, CertificateKey, fromData, toData); ok {
+			r.CertificatesRotated = append(r.CertificatesRotated, c)
+			continue
+		}
+		r.SecretsChanged = append(r.SecretsChanged, Secret{Namespace: live.Namespace, Name: name, Change: Changed, Keys: []string{CertificateKey}})
+	}
+	return r, nil
+}
+
+func liveField(m Machine, path string, from, to interface{}) Field {
+	fromJSON, _ := json.Marshal(from)
+	toJSON, _ := json.Marshal(to)
+	return Field{Kind: "Machine", Namespace: m.Namespace, Name: m.Name, Path: path, From: string(fromJSON), To: string(toJSON)}
+}
+
+func sortedCopy(s []string) []string {
+	c := append([]string{}, s...)
+	sort.Strings(c)
+	return c
+}
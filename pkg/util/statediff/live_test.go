@@ -0,0 +1,98 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statediff
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+func TestCompareLive(t *testing.T) {
+	caCert, rotatedCACert, etcdCACert := newCertPEM(t, 1), newCertPEM(t, 2), newCertPEM(t, 3)
+	s := cctlstate.NewWithFile("", nil, nil, nil)
+	s.MachineList.Items = []clusterv1.Machine{
+		newMachineObject("10.0.0.1", clustercommon.MasterRole, nil),
+		newMachineObject("10.0.0.2", clustercommon.NodeRole, nil),
+		newMachineObject("10.0.0.3", clustercommon.NodeRole, nil),
+		newMachineObject("10.0.0.4", clusterapi.EtcdRole, nil),
+	}
+	s.ClusterList.Items = []clusterv1.Cluster{newClusterObject(t,
+		spv1.EtcdMember{ID: 10, Name: "10.0.0.1"},
+		spv1.EtcdMember{ID: 11, Name: "10.0.0.4"},
+	)}
+	s.SecretList.Items = []corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "apiserver-ca"}, Data: map[string][]byte{CertificateKey: caCert}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "etcd-ca"}, Data: map[string][]byte{CertificateKey: etcdCACert}},
+	}
+	live := Live{
+		Namespace: "default",
+		Nodes: []Machine{
+			{Name: "10.0.0.1", Roles: []string{"Master"}, Kubelet: "v1.11.3"},
+			{Name: "10.0.0.2", Roles: []string{"Master"}, Kubelet: "v1.12.1"},
+			{Name: "node-5", Roles: []string{"Node"}, Kubelet: "v1.11.3"},
+		},
+		EtcdMembers: []spv1.EtcdMember{
+			{ID: 10, Name: "10.0.0.1"},
+			{ID: 11, Name: "10.0.0.4"},
+			{ID: 12, Name: "10.0.0.2"},
+		},
+		Certificates: map[string][]byte{
+			"apiserver-ca":   rotatedCACert,
+			"etcd-ca":        etcdCACert,
+			"front-proxy-ca": caCert,
+		},
+	}
+
+	r, err := CompareLive("current", s, "live", live)
+	if err != nil {
+		t.Fatalf("unable to compare: %v", err)
+	}
+	if diff := cmp.Diff([]Machine{{Namespace: "default", Name: "node-5", Roles: []string{"Node"}, Kubelet: "v1.11.3"}}, r.MachinesAdded); diff != "" {
+		t.Errorf("unexpected machines added (-expected +found):\n%s", diff)
+	}
+	if diff := cmp.Diff([]Machine{{Namespace: "default", Name: "10.0.0.3", Roles: []string{"Node"}, Kubelet: "1.11.3"}}, r.MachinesRemoved); diff != "" {
+		t.Errorf("unexpected machines removed (-expected +found):\n%s", diff)
+	}
+	expectedFields := []Field{
+		{Kind: "Machine", Namespace: "default", Name: "10.0.0.2", Path: "spec.roles", From: `["Node"]`, To: `["Master"]`},
+		{Kind: "Machine", Namespace: "default", Name: "10.0.0.2", Path: "spec.versions.kubelet", From: `"1.11.3"`, To: `"1.12.1"`},
+	}
+	if diff := cmp.Diff(expectedFields, r.FieldsChanged); diff != "" {
+		t.Errorf("unexpected fields changed (-expected +found):\n%s", diff)
+	}
+	if diff := cmp.Diff([]EtcdMember{{Namespace: "default", Name: "10.0.0.2", ID: "c"}}, r.EtcdMembersAdded); diff != "" {
+		t.Errorf("unexpected etcd members added (-expected +found):\n%s", diff)
+	}
+	if len(r.EtcdMembersRemoved) != 0 {
+		t.Errorf("unexpected etcd members removed: %v", r.EtcdMembersRemoved)
+	}
+	if len(r.CertificatesRotated) != 1 || r.CertificatesRotated[0].Secret != "apiserver-ca" || r.CertificatesRotated[0].ToSerial != "2" {
+		t.Errorf("unexpected certificates rotated: %+v", r.CertificatesRotated)
+	}
+	if diff := cmp.Diff([]Secret{{Namespace: "default", Name: "front-proxy-ca", Change: Added, Keys: []string{CertificateKey}}}, r.SecretsChanged); diff != "" {
+		t.Errorf("unexpected secrets changed (-expected +found):\n%s", diff)
+	}
+}
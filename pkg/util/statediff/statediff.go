@@ -0,0 +1,513 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package statediff reports the changes between two versions of the state,
+// for change audits. Secret values are never reported.
+package statediff
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+)
+
+// volatileAnnotations change whenever machines are contacted, and are not
+// changes to the cluster.
+var volatileAnnotations = map[string]bool{
+	common.LastContactAnnotationKey:      true,
+	common.UnreachableSinceAnnotationKey: true,
+}
+
+// Report is the change report.
+type Report struct {
+	From                string        `json:"from"`
+	To                  string        `json:"to"`
+	MachinesAdded       []Machine     `json:"machinesAdded"`
+	MachinesRemoved     []Machine     `json:"machinesRemoved"`
+	EtcdMembersAdded    []EtcdMember  `json:"etcdMembersAdded"`
+	EtcdMembersRemoved  []EtcdMember  `json:"etcdMembersRemoved"`
+	CertificatesRotated []Certificate `json:"certificatesRotated"`
+	SecretsChanged      []Secret      `json:"secretsChanged"`
+	FieldsChanged       []Field       `json:"fieldsChanged"`
+}
+
+// Empty returns true if the report has no changes.
+func (r *Report) Empty() bool {
+	return len(r.MachinesAdded) == 0 && len(r.MachinesRemoved) == 0 && len(r.EtcdMembersAdded) == 0 &&
+		len(r.EtcdMembersRemoved) == 0 && len(r.CertificatesRotated) == 0 && len(r.SecretsChanged) == 0 &&
+		len(r.FieldsChanged) == 0
+}
+
+// Machine is a machine added or removed.
+type Machine struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Roles     []string `json:"roles"`
+	Kubelet   string   `json:"kubelet,omitempty"`
+}
+
+// EtcdMember is a member added to or removed from the etcd cluster recorded in
+// the status of a cluster.
+type EtcdMember struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// ID is the hexadecimal member ID, as printed by etcdctl.
+	ID       string   `json:"id"`
+	PeerURLs []string `json:"peerURLs"`
+}
+
+// Certificate is a certificate, kept in a secret, that was replaced.
+type Certificate struct {
+	Namespace    string    `json:"namespace"`
+	Secret       string    `json:"secret"`
+	Key          string    `json:"key"`
+	Subject      string    `json:"subject"`
+	FromSerial   string    `json:"fromSerial"`
+	ToSerial     string    `json:"toSerial"`
+	FromNotAfter time.Time `json:"fromNotAfter"`
+	ToNotAfter   time.Time `json:"toNotAfter"`
+}
+
+// Secret is a secret that was added, removed, or changed, other than by a
+// certificate rotation. Only the keys are reported.
+type Secret struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Change    string   `json:"change"`
+	Keys      []string `json:"keys"`
+}
+
+// Field is a field of the spec, labels, or annotations of an object that was
+// changed. From and To are JSON values, and are empty if the field is absent.
+type Field struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+}
+
+// Changes of secrets.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Compare returns the changes from one state to the other.
+func Compare(fromName string, from *cctlstate.State, toName string, to *cctlstate.State) (*Report, error) {
+	r := newReport(fromName, toName)
+	if err := r.compareClusters(from, to); err != nil {
+		return nil, err
+	}
+	if err := r.compareMachines(from, to); err != nil {
+		return nil, err
+	}
+	fromMembers, err := etcdMembers(from)
+	if err != nil {
+		return nil, err
+	}
+	toMembers, err := etcdMembers(to)
+	if err != nil {
+		return nil, err
+	}
+	r.compareEtcdMembers(fromMembers, toMembers)
+	if err := r.compareProvisionedMachines(from, to); err != nil {
+		return nil, err
+	}
+	if err := r.compareSecrets(from, to); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newReport(fromName, toName string) *Report {
+	return &Report{
+		From:                fromName,
+		To:                  toName,
+		MachinesAdded:       []Machine{},
+		MachinesRemoved:     []Machine{},
+		EtcdMembersAdded:    []EtcdMember{},
+		EtcdMembersRemoved:  []EtcdMember{},
+		CertificatesRotated: []Certificate{},
+		SecretsChanged:      []Secret{},
+		FieldsChanged:       []Field{},
+	}
+}
+
+// object is the part of an object compared field by field.
+type object struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Spec        interface{}       `json:"spec"`
+}
+
+func newObject(labels, annotations map[string]string, spec interface{}) object {
+	filtered := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		if !volatileAnnotations[k] {
+			filtered[k] = v
+		}
+	}
+	return object{Labels: labels, Annotations: filtered, Spec: spec}
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func (r *Report) compareClusters(from, to *cctlstate.State) error {
+	objects := func(s *cctlstate.State) map[string]object {
+		m := make(map[string]object)
+		for _, c := range s.ClusterList.Items {
+			m[key(c.Namespace, c.Name)] = newObject(c.Labels, c.Annotations, c.Spec)
+		}
+		return m
+	}
+	return r.compareObjects("Cluster", objects(from), objects(to), true)
+}
+
+func (r *Report) compareMachines(from, to *cctlstate.State) error {
+	fromObjects := make(map[string]object)
+	fromMachines := make(map[string]Machine)
+	for _, m := range from.MachineList.Items {
+		fromObjects[key(m.Namespace, m.Name)] = newObject(m.Labels, m.Annotations, m.Spec)
+		fromMachines[key(m.Namespace, m.Name)] = newMachine(m.Namespace, m.Name, m.Spec.Roles, m.Spec.Versions.Kubelet)
+	}
+	toObjects := make(map[string]object)
+	toMachines := make(map[string]Machine)
+	for _, m := range to.MachineList.Items {
+		toObjects[key(m.Namespace, m.Name)] = newObject(m.Labels, m.Annotations, m.Spec)
+		toMachines[key(m.Namespace, m.Name)] = newMachine(m.Namespace, m.Name, m.Spec.Roles, m.Spec.Versions.Kubelet)
+	}
+	for _, k := range sortedKeys(toMachines) {
+		if _, ok := fromMachines[k]; !ok {
+			r.MachinesAdded = append(r.MachinesAdded, toMachines[k])
+		}
+	}
+	for _, k := range sortedKeys(fromMachines) {
+		if _, ok := toMachines[k]; !ok {
+			r.MachinesRemoved = append(r.MachinesRemoved, fromMachines[k])
+		}
+	}
+	return r.compareObjects("Machine", fromObjects, toObjects, false)
+}
+
+func newMachine(namespace, name string, roles []clustercommon.MachineRole, kubelet string) Machine {
+	m := Machine{Namespace: namespace, Name: name, Roles: []string{}, Kubelet: kubelet}
+	for _, role := range roles {
+		m.Roles = append(m.Roles, string(role))
+	}
+	return m
+}
+
+// etcdMembers returns the etcd members recorded in the status of every
+// cluster, by namespace and member ID.
+func etcdMembers(s *cctlstate.State) (map[string]EtcdMember, error) {
+	m := make(map[string]EtcdMember)
+	for _, c := range s.ClusterList.Items {
+		status, err := clusterStatus(&c.Status)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode status of cluster %q: %v", key(c.Namespace, c.Name), err)
+		}
+		addEtcdMembers(m, c.Namespace, status.EtcdMembers)
+	}
+	return m, nil
+}
+
+func addEtcdMembers(m map[string]EtcdMember, namespace string, members []spv1.EtcdMember) {
+	for _, member := range members {
+		id := fmt.Sprintf("%x", member.ID)
+		m[key(namespace, id)] = EtcdMember{Namespace: namespace, Name: member.Name, ID: id, PeerURLs: member.PeerURLs}
+	}
+}
+
+// clusterStatus decodes the provider status of the cluster. A cluster without
+// a provider status has an empty one.
+func clusterStatus(status *clusterv1.ClusterStatus) (*spv1.ClusterStatus, error) {
+	s := &spv1.ClusterStatus{}
+	if status.ProviderStatus == nil {
+		return s, nil
+	}
+	raw := status.ProviderStatus.Raw
+	if len(raw) == 0 && status.ProviderStatus.Object != nil {
+		var err error
+		if raw, err = json.Marshal(status.ProviderStatus.Object); err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *Report) compareEtcdMembers(from, to map[string]EtcdMember) {
+	for _, k := range sortedKeys(to) {
+		if _, ok := from[k]; !ok {
+			r.EtcdMembersAdded = append(r.EtcdMembersAdded, to[k])
+		}
+	}
+	for _, k := range sortedKeys(from) {
+		if _, ok := to[k]; !ok {
+			r.EtcdMembersRemoved = append(r.EtcdMembersRemoved, from[k])
+		}
+	}
+}
+
+func (r *Report) compareProvisionedMachines(from, to *cctlstate.State) error {
+	objects := func(s *cctlstate.State) map[string]object {
+		m := make(map[string]object)
+		for _, pm := range s.ProvisionedMachineList.Items {
+			m[key(pm.Namespace, pm.Name)] = newObject(pm.Labels, pm.Annotations, pm.Spec)
+		}
+		return m
+	}
+	// Provisioned machines are added and removed with their machines.
+	return r.compareObjects("ProvisionedMachine", objects(from), objects(to), false)
+}
+
+// compareObjects reports the changed fields of the objects in both states. If
+// presence is true, objects in one state only are reported as a single field,
+// the object.
+func (r *Report) compareObjects(kind string, from, to map[string]object, presence bool) error {
+	keys := sortedKeys(from)
+	for _, k := range sortedKeys(to) {
+		if _, ok := from[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		namespace, name := splitKey(k)
+		fromObject, inFrom := from[k]
+		toObject, inTo := to[k]
+		if !inFrom || !inTo {
+			if !presence {
+				continue
+			}
+			field := Field{Kind: kind, Namespace: namespace, Name: name, Path: "."}
+			if inFrom {
+				field.From = "(object)"
+			} else {
+				field.To = "(object)"
+			}
+			r.FieldsChanged = append(r.FieldsChanged, field)
+			continue
+		}
+		fromFields, err := flatten(fromObject)
+		if err != nil {
+			return fmt.Errorf("unable to compare %s %q: %v", kind, k, err)
+		}
+		toFields, err := flatten(toObject)
+		if err != nil {
+			return fmt.Errorf("unable to compare %s %q: %v", kind, k, err)
+		}
+		paths := sortedKeys(fromFields)
+		for _, p := range sortedKeys(toFields) {
+			if _, ok := fromFields[p]; !ok {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			if fromFields[p] != toFields[p] {
+				r.FieldsChanged = append(r.FieldsChanged, Field{
+					Kind:      kind,
+					Namespace: namespace,
+					Name:      name,
+					Path:      p,
+					From:      fromFields[p],
+					To:        toFields[p],
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Report) compareSecrets(from, to *cctlstate.State) error {
+	secrets := func(s *cctlstate.State) map[string]corev1.Secret {
+		m := make(map[string]corev1.Secret)
+		for _, secret := range s.SecretList.Items {
+			m[key(secret.Namespace, secret.Name)] = secret
+		}
+		return m
+	}
+	fromSecrets, toSecrets := secrets(from), secrets(to)
+	for _, k := range sortedKeys(fromSecrets) {
+		if _, ok := toSecrets[k]; !ok {
+			s := fromSecrets[k]
+			r.SecretsChanged = append(r.SecretsChanged, Secret{Namespace: s.Namespace, Name: s.Name, Change: Removed, Keys: sortedKeys(s.Data)})
+		}
+	}
+	for _, k := range sortedKeys(toSecrets) {
+		toSecret := toSecrets[k]
+		fromSecret, ok := fromSecrets[k]
+		if !ok {
+			r.SecretsChanged = append(r.SecretsChanged, Secret{Namespace: toSecret.Namespace, Name: toSecret.Name, Change: Added, Keys: sortedKeys(toSecret.Data)})
+			continue
+		}
+		changed := []string{}
+		dataKeys := sortedKeys(fromSecret.Data)
+		for _, dk := range sortedKeys(toSecret.Data) {
+			if _, ok := fromSecret.Data[dk]; !ok {
+				dataKeys = append(dataKeys, dk)
+			}
+		}
+		sort.Strings(dataKeys)
+		for _, dk := range dataKeys {
+			fromData, toData := fromSecret.Data[dk], toSecret.Data[dk]
+			if bytes.Equal(fromData, toData) {
+				continue
+			}
+			if c, ok := rotatedCertificate(toSecret.Namespace, toSecret.Name, dk, fromData, toData); ok {
+				r.CertificatesRotated = append(r.CertificatesRotated, c)
+				continue
+			}
+			changed = append(changed, dk)
+		}
+		if len(changed) != 0 {
+			r.SecretsChanged = append(r.SecretsChanged, Secret{Namespace: toSecret.Namespace, Name: toSecret.Name, Change: Changed, Keys: changed})
+		}
+	}
+	return nil
+}
+
+// rotatedCertificate returns the rotation of the certificate, if both the
+// data hold a certificate.
+func rotatedCertificate(namespace, secret, dataKey string, fromData, toData []byte) (Certificate, bool) {
+	fromCert, toCert := parseCertificate(fromData), parseCertificate(toData)
+	if fromCert == nil || toCert == nil {
+		return Certificate{}, false
+	}
+	return Certificate{
+		Namespace:    namespace,
+		Secret:       secret,
+		Key:          dataKey,
+		Subject:      toCert.Subject.String(),
+		FromSerial:   fromCert.SerialNumber.String(),
+		ToSerial:     toCert.SerialNumber.String(),
+		FromNotAfter: fromCert.NotAfter.UTC(),
+		ToNotAfter:   toCert.NotAfter.UTC(),
+	}, true
+}
+
+// parseCertificate returns the first certificate of the PEM data, or nil if
+// it has none.
+func parseCertificate(data []byte) *x509.Certificate {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil
+		}
+		return cert
+	}
+}
+
+// flatten returns the JSON value of every leaf of the object, by path, e.g.
+// spec.roles[0]. Empty objects and arrays are leaves.
+func flatten(v interface{}) (map[string]string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	var walk func(path string, v interface{}) error
+	walk = func(path string, v interface{}) error {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if len(t) != 0 {
+				for k, child := range t {
+					childPath := k
+					if strings.ContainsAny(k, ".[]") {
+						childPath = fmt.Sprintf("[%q]", k)
+					} else if len(path) != 0 {
+						childPath = "." + k
+					}
+					if err := walk(path+childPath, child); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		case []interface{}:
+			if len(t) != 0 {
+				for i, child := range t {
+					if err := walk(fmt.Sprintf("%s[%d]", path, i), child); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+		case nil:
+			return nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields[path] = string(b)
+		return nil
+	}
+	return fields, walk("", doc)
+}
+
+func splitKey(k string) (string, string) {
+	i := strings.Index(k, "/")
+	return k[:i], k[i+1:]
+}
+
+// sortedKeys returns the keys of the map, which must have string keys, in
+// order.
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package statediff
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	cctlstate "github.com/platform9/cctl/pkg/state/v2"
+)
+
+func newCertPEM(t *testing.T, serial int64) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "kubernetes"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Duration(serial) * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newMachineObject(name string, role clustercommon.MachineRole, annotations map[string]string) clusterv1.Machine {
+	return clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Annotations: annotations},
+		Spec: clusterv1.MachineSpec{
+			Roles:    []clustercommon.MachineRole{role},
+			Versions: clusterv1.MachineVersionInfo{Kubelet: "1.11.3"},
+		},
+	}
+}
+
+func newClusterObject(t *testing.T, members ...spv1.EtcdMember) clusterv1.Cluster {
+	raw, err := json.Marshal(spv1.ClusterStatus{EtcdMembers: members})
+	if err != nil {
+		t.Fatalf("unable to encode cluster status: %v", err)
+	}
+	return clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cctl-cluster"},
+		Status:     clusterv1.ClusterStatus{ProviderStatus: &runtime.RawExtension{Raw: raw}},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	from := cctlstate.NewWithFile("", nil, nil, nil)
+	to := cctlstate.NewWithFile("", nil, nil, nil)
+	from.MachineList.Items = []clusterv1.Machine{
+		newMachineObject("10.0.0.1", clustercommon.MasterRole, map[string]string{common.LastContactAnnotationKey: "a"}),
+		newMachineObject("10.0.0.2", clustercommon.NodeRole, nil),
+	}
+	to.MachineList.Items = []clusterv1.Machine{
+		newMachineObject("10.0.0.1", clustercommon.MasterRole, map[string]string{common.LastContactAnnotationKey: "b", common.RuntimeVersionAnnotationKey: "18.09"}),
+		newMachineObject("10.0.0.3", clustercommon.NodeRole, nil),
+	}
+	to.MachineList.Items[0].Spec.Versions.Kubelet = "1.12.1"
+	from.ClusterList.Items = []clusterv1.Cluster{newClusterObject(t,
+		spv1.EtcdMember{ID: 10, Name: "10.0.0.1", PeerURLs: []string{"https://10.0.0.1:2380"}},
+		spv1.EtcdMember{ID: 11, Name: "10.0.0.2", PeerURLs: []string{"https://10.0.0.2:2380"}},
+	)}
+	to.ClusterList.Items = []clusterv1.Cluster{newClusterObject(t,
+		spv1.EtcdMember{ID: 10, Name: "10.0.0.1", PeerURLs: []string{"https://10.0.0.1:2380"}},
+		spv1.EtcdMember{ID: 12, Name: "10.0.0.3", PeerURLs: []string{"https://10.0.0.3:2380"}},
+	)}
+	from.SecretList.Items = []corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "apiserver-ca"}, Data: map[string][]byte{"tls.crt": newCertPEM(t, 1), "tls.key": []byte("a")}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sa"}, Data: map[string][]byte{"privatekey": []byte("a")}},
+	}
+	to.SecretList.Items = []corev1.Secret{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "apiserver-ca"}, Data: map[string][]byte{"tls.crt": newCertPEM(t, 2), "tls.key": []byte("b")}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bootstrap"}, Data: map[string][]byte{"token": []byte("a")}},
+	}
+
+	r, err := Compare("backup", from, "current", to)
+	if err != nil {
+		t.Fatalf("unable to compare: %v", err)
+	}
+	if diff := cmp.Diff([]Machine{{Namespace: "default", Name: "10.0.0.3", Roles: []string{"Node"}, Kubelet: "1.11.3"}}, r.MachinesAdded); diff != "" {
+		t.Errorf("unexpected machines added (-expected +found):\n%s", diff)
+	}
+	if len(r.MachinesRemoved) != 1 || r.MachinesRemoved[0].Name != "10.0.0.2" {
+		t.Errorf("unexpected machines removed: %v", r.MachinesRemoved)
+	}
+	if diff := cmp.Diff([]EtcdMember{{Namespace: "default", Name: "10.0.0.3", ID: "c", PeerURLs: []string{"https://10.0.0.3:2380"}}}, r.EtcdMembersAdded); diff != "" {
+		t.Errorf("unexpected etcd members added (-expected +found):\n%s", diff)
+	}
+	if diff := cmp.Diff([]EtcdMember{{Namespace: "default", Name: "10.0.0.2", ID: "b", PeerURLs: []string{"https://10.0.0.2:2380"}}}, r.EtcdMembersRemoved); diff != "" {
+		t.Errorf("unexpected etcd members removed (-expected +found):\n%s", diff)
+	}
+	expectedFields := []Field{
+		{Kind: "Machine", Namespace: "default", Name: "10.0.0.1", Path: `annotations["cctl.platform9.com/runtime-version"]`, To: `"18.09"`},
+		{Kind: "Machine", Namespace: "default", Name: "10.0.0.1", Path: "spec.versions.kubelet", From: `"1.11.3"`, To: `"1.12.1"`},
+	}
+	if diff := cmp.Diff(expectedFields, r.FieldsChanged); diff != "" {
+		t.Errorf("unexpected fields changed (-expected +found):\n%s", diff)
+	}
+	if len(r.CertificatesRotated) != 1 {
+		t.Fatalf("expected one certificate rotated, found %v", r.CertificatesRotated)
+	}
+	c := r.CertificatesRotated[0]
+	if c.Secret != "apiserver-ca" || c.Key != "tls.crt" || c.FromSerial != "1" || c.ToSerial != "2" || !c.ToNotAfter.After(c.FromNotAfter) {
+		t.Errorf("unexpected certificate rotated: %+v", c)
+	}
+	expectedSecrets := []Secret{
+		{Namespace: "default", Name: "sa", Change: Removed, Keys: []string{"privatekey"}},
+		{Namespace: "default", Name: "apiserver-ca", Change: Changed, Keys: []string{"tls.key"}},
+		{Namespace: "default", Name: "bootstrap", Change: Added, Keys: []string{"token"}},
+	}
+	if diff := cmp.Diff(expectedSecrets, r.SecretsChanged); diff != "" {
+		t.Errorf("unexpected secrets changed (-expected +found):\n%s", diff)
+	}
+
+	same, err := Compare("current", to, "current", to)
+	if err != nil {
+		t.Fatalf("unable to compare: %v", err)
+	}
+	if !same.Empty() {
+		t.Errorf("expected no changes comparing a state to itself, found %+v", same)
+	}
+}
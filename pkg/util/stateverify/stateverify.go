@@ -0,0 +1,249 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package stateverify checks the referential integrity of the objects of the
+// state: the references between machines, provisioned machines, and secrets,
+// and the etcd members recorded in the cluster and machine statuses.
+package stateverify
+
+import (
+	"fmt"
+	"sort"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+	"github.com/platform9/cctl/pkg/util/clusterapi"
+)
+
+// Severities of problems.
+const (
+	// SeverityError means commands that use the object will fail.
+	SeverityError = "error"
+	// SeverityWarning means the object is unused, or will be corrected by
+	// the next command that changes it.
+	SeverityWarning = "warning"
+)
+
+// Repair is how a problem is repaired.
+type Repair string
+
+const (
+	// RepairNone means the problem cannot be repaired from the state alone.
+	RepairNone Repair = ""
+	// RepairBind binds the machine and the provisioned machine it references.
+	RepairBind Repair = "bind"
+	// RepairEtcdMembers replaces the etcd members of the cluster status with
+	// the etcd members of the machine statuses.
+	RepairEtcdMembers Repair = "etcd-members"
+	// RepairDeleteProvisionedMachine deletes a provisioned machine that no
+	// machine references.
+	RepairDeleteProvisionedMachine Repair = "delete-provisioned-machine"
+	// RepairDeleteSecret deletes a secret that nothing references.
+	RepairDeleteSecret Repair = "delete-secret"
+)
+
+// Problem is an inconsistency between objects of the state.
+type Problem struct {
+	// Object is the inconsistent object, as <kind>/<name>.
+	Object   string `json:"object"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Repair   Repair `json:"repair,omitempty"`
+}
+
+// Machine is a machine, with its decoded provider spec and status.
+type Machine struct {
+	Machine clusterv1.Machine
+	Spec    *spv1.MachineSpec
+	Status  *spv1.MachineStatus
+}
+
+// Objects are the objects of a namespace of the state. Cluster, and its spec
+// and status, are nil if there is no cluster.
+type Objects struct {
+	Cluster             *clusterv1.Cluster
+	ClusterSpec         *spv1.ClusterSpec
+	ClusterStatus       *spv1.ClusterStatus
+	Machines            []Machine
+	ProvisionedMachines []spv1.ProvisionedMachine
+	Secrets             []corev1.Secret
+}
+
+// ownedSecrets are created by cctl, and used without being referenced by
+// another object.
+var ownedSecrets = []string{
+	common.DefaultSSHCredentialSecretName,
+	common.DefaultBastionSSHCredentialSecretName,
+	common.DefaultCommonCASecretName,
+	common.DefaultEncryptionKeysSecretName,
+	common.DefaultKeepalivedSecretName,
+	common.DefaultAdminConfigSecretName,
+}
+
+// Verify returns the problems of the objects, ordered by object.
+func Verify(o Objects) []Problem {
+	problems := []Problem{}
+	add := func(object, severity string, repair Repair, format string, args ...interface{}) {
+		problems = append(problems, Problem{Object: object, Severity: severity, Message: fmt.Sprintf(format, args...), Repair: repair})
+	}
+
+	secrets := map[string]bool{}
+	for _, s := range o.Secrets {
+		secrets[s.Name] = true
+	}
+	referenced := map[string]bool{}
+	for _, name := range ownedSecrets {
+		referenced[name] = true
+	}
+	requireSecret := func(object, field, name string) {
+		referenced[name] = true
+		if !secrets[name] {
+			add(object, SeverityError, RepairNone, "%s references secret %q, which does not exist", field, name)
+		}
+	}
+
+	if o.Cluster == nil {
+		if len(o.Machines) != 0 {
+			add("cluster/"+common.DefaultClusterName, SeverityError, RepairNone, "%d machines exist, but the cluster does not", len(o.Machines))
+		}
+	} else if o.ClusterSpec != nil {
+		clusterObject := "cluster/" + o.Cluster.Name
+		for _, ref := range []struct {
+			field string
+			ref   *corev1.LocalObjectReference
+		}{
+			{"etcdCASecret", o.ClusterSpec.EtcdCASecret},
+			{"apiServerCASecret", o.ClusterSpec.APIServerCASecret},
+			{"frontProxyCASecret", o.ClusterSpec.FrontProxyCASecret},
+			{"serviceAccountKeySecret", o.ClusterSpec.ServiceAccountKeySecret},
+			{"bootstrapTokenSecret", o.ClusterSpec.BootstrapTokenSecret},
+		} {
+			if ref.ref != nil {
+				requireSecret(clusterObject, ref.field, ref.ref.Name)
+			}
+		}
+	}
+
+	provisionedMachines := map[string]*spv1.ProvisionedMachine{}
+	for i := range o.ProvisionedMachines {
+		pm := &o.ProvisionedMachines[i]
+		provisionedMachines[pm.Name] = pm
+		object := "provisionedmachine/" + pm.Name
+		if pm.Spec.SSHConfig == nil {
+			add(object, SeverityError, RepairNone, "has no SSH configuration")
+			continue
+		}
+		requireSecret(object, "sshConfig.credentialSecret", pm.Spec.SSHConfig.CredentialSecret.Name)
+	}
+
+	bound := map[string]bool{}
+	for _, m := range o.Machines {
+		object := "machine/" + m.Machine.Name
+		if m.Spec == nil {
+			add(object, SeverityError, RepairNone, "provider spec cannot be decoded")
+			continue
+		}
+		pm, ok := provisionedMachines[m.Spec.ProvisionedMachineName]
+		switch {
+		case len(m.Spec.ProvisionedMachineName) == 0:
+			add(object, SeverityError, RepairNone, "references no provisioned machine")
+		case !ok:
+			add(object, SeverityError, RepairNone, "references provisioned machine %q, which does not exist", m.Spec.ProvisionedMachineName)
+		default:
+			bound[pm.Name] = true
+			if pm.Status.MachineRef == nil || pm.Status.MachineRef.Name != m.Machine.Name {
+				add("provisionedmachine/"+pm.Name, SeverityWarning, RepairBind, "is not bound to machine %q, which references it", m.Machine.Name)
+			}
+		}
+		if !clusterapi.RunsEtcd(m.Machine) {
+			continue
+		}
+		if m.Status == nil || m.Status.EtcdMember == nil {
+			add(object, SeverityWarning, RepairNone, "runs etcd, but its status has no etcd member")
+		}
+	}
+
+	for _, pm := range o.ProvisionedMachines {
+		if !bound[pm.Name] {
+			add("provisionedmachine/"+pm.Name, SeverityWarning, RepairDeleteProvisionedMachine, "no machine references it")
+		}
+	}
+
+	if o.Cluster != nil && o.ClusterStatus != nil {
+		if missing, extra := diffEtcdMembers(EtcdMembers(o), o.ClusterStatus.EtcdMembers); len(missing) != 0 || len(extra) != 0 {
+			add("cluster/"+o.Cluster.Name, SeverityError, RepairEtcdMembers, "etcd members of the cluster status do not match the machine statuses: missing %v, extra %v", missing, extra)
+		}
+	}
+
+	for _, s := range o.Secrets {
+		if !referenced[s.Name] {
+			add("secret/"+s.Name, SeverityWarning, RepairDeleteSecret, "nothing references it")
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Object < problems[j].Object })
+	return problems
+}
+
+// diffEtcdMembers returns the names of the etcd members of the machines that
+// the cluster does not have, and of the members of the cluster that no machine
+// has. Members are compared by ID.
+func diffEtcdMembers(machines, cluster []spv1.EtcdMember) ([]string, []string) {
+	inCluster := map[uint64]bool{}
+	for _, m := range cluster {
+		inCluster[m.ID] = true
+	}
+	inMachines := map[uint64]bool{}
+	var missing, extra []string
+	for _, m := range machines {
+		inMachines[m.ID] = true
+		if !inCluster[m.ID] {
+			missing = append(missing, m.Name)
+		}
+	}
+	for _, m := range cluster {
+		if !inMachines[m.ID] {
+			extra = append(extra, m.Name)
+		}
+	}
+	return missing, extra
+}
+
+// EtcdMembers returns the etcd members of the machine statuses, the members
+// the cluster status must have.
+func EtcdMembers(o Objects) []spv1.EtcdMember {
+	var members []spv1.EtcdMember
+	for _, m := range o.Machines {
+		if clusterapi.RunsEtcd(m.Machine) && m.Status != nil && m.Status.EtcdMember != nil {
+			members = append(members, *m.Status.EtcdMember)
+		}
+	}
+	return members
+}
+
+// Errors returns the number of problems with SeverityError.
+func Errors(problems []Problem) int {
+	n := 0
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stateverify
+
+import (
+	"reflect"
+	"testing"
+
+	spv1 "github.com/platform9/ssh-provider/pkg/apis/sshprovider/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clustercommon "sigs.k8s.io/cluster-api/pkg/apis/cluster/common"
+	clusterv1 "sigs.k8s.io/cluster-api/pkg/apis/cluster/v1alpha1"
+
+	"github.com/platform9/cctl/common"
+)
+
+func secret(name string) corev1.Secret {
+	return corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func provisionedMachine(name, machine string) spv1.ProvisionedMachine {
+	pm := spv1.ProvisionedMachine{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	pm.Spec.SSHConfig = &spv1.SSHConfig{Host: name, CredentialSecret: corev1.LocalObjectReference{Name: common.DefaultSSHCredentialSecretName}}
+	if len(machine) != 0 {
+		pm.Status.MachineRef = &corev1.LocalObjectReference{Name: machine}
+	}
+	return pm
+}
+
+func machine(name string, role clustercommon.MachineRole, member *spv1.EtcdMember) Machine {
+	return Machine{
+		Machine: clusterv1.Machine{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: clusterv1.MachineSpec{Roles: []clustercommon.MachineRole{role}}},
+		Spec:    &spv1.MachineSpec{ProvisionedMachineName: name},
+		Status:  &spv1.MachineStatus{EtcdMember: member},
+	}
+}
+
+func consistentObjects() Objects {
+	member := spv1.EtcdMember{ID: 1, Name: "master"}
+	return Objects{
+		Cluster:       &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: common.DefaultClusterName}},
+		ClusterSpec:   &spv1.ClusterSpec{EtcdCASecret: &corev1.LocalObjectReference{Name: common.DefaultEtcdCASecretName}},
+		ClusterStatus: &spv1.ClusterStatus{EtcdMembers: []spv1.EtcdMember{member}},
+		Machines: []Machine{
+			machine("10.0.0.1", clustercommon.MasterRole, &member),
+			machine("10.0.0.2", clustercommon.NodeRole, nil),
+		},
+		ProvisionedMachines: []spv1.ProvisionedMachine{
+			provisionedMachine("10.0.0.1", "10.0.0.1"),
+			provisionedMachine("10.0.0.2", "10.0.0.2"),
+		},
+		Secrets: []corev1.Secret{secret(common.DefaultEtcdCASecretName), secret(common.DefaultSSHCredentialSecretName)},
+	}
+}
+
+func TestVerifyConsistent(t *testing.T) {
+	if problems := Verify(consistentObjects()); len(problems) != 0 {
+		t.Errorf("expected no problems, found %+v", problems)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	o := consistentObjects()
+	// The etcd CA is missing, and an unknown secret is orphaned.
+	o.Secrets = []corev1.Secret{secret(common.DefaultSSHCredentialSecretName), secret("stale")}
+	// The node references a missing provisioned machine, and the master's
+	// provisioned machine is not bound to it.
+	o.Machines[1].Spec.ProvisionedMachineName = "missing"
+	o.ProvisionedMachines[0].Status.MachineRef = nil
+	// The cluster status has a member no machine has.
+	o.ClusterStatus.EtcdMembers = append(o.ClusterStatus.EtcdMembers, spv1.EtcdMember{ID: 2, Name: "removed"})
+
+	expected := []Problem{
+		{Object: "cluster/" + common.DefaultClusterName, Severity: SeverityError, Message: `etcdCASecret references secret "etcd-ca", which does not exist`},
+		{Object: "cluster/" + common.DefaultClusterName, Severity: SeverityError, Message: "etcd members of the cluster status do not match the machine statuses: missing [], extra [removed]", Repair: RepairEtcdMembers},
+		{Object: "machine/10.0.0.2", Severity: SeverityError, Message: `references provisioned machine "missing", which does not exist`},
+		{Object: "provisionedmachine/10.0.0.1", Severity: SeverityWarning, Message: `is not bound to machine "10.0.0.1", which references it`, Repair: RepairBind},
+		{Object: "provisionedmachine/10.0.0.2", Severity: SeverityWarning, Message: "no machine references it", Repair: RepairDeleteProvisionedMachine},
+		{Object: "secret/stale", Severity: SeverityWarning, Message: "nothing references it", Repair: RepairDeleteSecret},
+	}
+	actual := Verify(o)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected problems:\n%+v\nfound:\n%+v", expected, actual)
+	}
+	if n := Errors(actual); n != 3 {
+		t.Errorf("expected 3 errors, found %d", n)
+	}
+	if members := EtcdMembers(o); len(members) != 1 || members[0].ID != 1 {
+		t.Errorf("expected the etcd member of the master, found %+v", members)
+	}
+}
+
+func TestVerifyNoCluster(t *testing.T) {
+	o := consistentObjects()
+	o.Cluster, o.ClusterSpec, o.ClusterStatus = nil, nil, nil
+	o.Secrets = []corev1.Secret{secret(common.DefaultSSHCredentialSecretName)}
+	problems := Verify(o)
+	if len(problems) != 1 || problems[0].Object != "cluster/"+common.DefaultClusterName {
+		t.Errorf("expected the missing cluster, found %+v", problems)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package staticpod changes the manifests of the control plane static pods.
+package staticpod
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Mount is a host directory mounted into the container.
+type Mount struct {
+	// Name is the name of the volume and its mount.
+	Name string
+	// Path is the path of the directory on the host and in the container.
+	Path     string
+	ReadOnly bool
+}
+
+// Configure returns the manifest with the arguments and mounts of the
+// container changed: every argument with one of the flag prefixes, e.g.
+// --audit-, is replaced with the arguments, which are added in order of name,
+// and the host directories are mounted, unless a volume with the same name
+// exists. It returns false if the manifest already has the configuration.
+func Configure(manifest []byte, containerName string, flagPrefixes []string, args map[string]string, mounts []Mount) ([]byte, bool, error) {
+	pod := corev1.Pod{}
+	if err := yaml.Unmarshal(manifest, &pod); err != nil {
+		return nil, false, fmt.Errorf("unable to decode manifest: %v", err)
+	}
+	var container *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			container = &pod.Spec.Containers[i]
+		}
+	}
+	if container == nil {
+		return nil, false, fmt.Errorf("manifest has no %s container", containerName)
+	}
+	changed := setArgs(container, flagPrefixes, args)
+	directoryOrCreate := corev1.HostPathDirectoryOrCreate
+	for _, m := range mounts {
+		if !hasVolume(pod.Spec.Volumes, m.Name) {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+				Name: m.Name,
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: m.Path, Type: &directoryOrCreate},
+				},
+			})
+			changed = true
+		}
+		if !hasVolumeMount(container.VolumeMounts, m.Name) {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: m.Name, MountPath: m.Path, ReadOnly: m.ReadOnly})
+			changed = true
+		}
+	}
+	if !changed {
+		return manifest, false, nil
+	}
+	b, err := yaml.Marshal(pod)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to encode manifest: %v", err)
+	}
+	return b, true, nil
+}
+
+// setArgs replaces the arguments of the container's command that have one of
+// the prefixes with the arguments. It returns false if the command already
+// has exactly the arguments.
+func setArgs(container *corev1.Container, prefixes []string, args map[string]string) bool {
+	var current, others []string
+	for _, a := range container.Command {
+		if hasPrefix(a, prefixes) {
+			current = append(current, a)
+		} else {
+			others = append(others, a)
+		}
+	}
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var wanted []string
+	for _, name := range names {
+		wanted = append(wanted, fmt.Sprintf("--%s=%s", name, args[name]))
+	}
+	sorted := append([]string(nil), current...)
+	sort.Strings(sorted)
+	if strings.Join(sorted, " ") == strings.Join(wanted, " ") {
+		return false
+	}
+	container.Command = append(others, wanted...)
+	return true
+}
+
+func hasPrefix(a string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(a, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, v := range volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVolumeMount(mounts []corev1.VolumeMount, name string) bool {
+	for _, m := range mounts {
+		if m.Name == name {
+			return true
+		}
+	}
+	return false
+}
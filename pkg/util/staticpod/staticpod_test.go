@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticpod
+
+import (
+	"strings"
+	"testing"
+)
+
+const manifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - command:
+    - kube-apiserver
+    - --secure-port=6443
+    - --example-b=old
+    name: kube-apiserver
+`
+
+func TestConfigure(t *testing.T) {
+	prefixes := []string{"--example-"}
+	args := map[string]string{"example-b": "b", "example-a": "a"}
+	mounts := []Mount{{Name: "example", Path: "/etc/example", ReadOnly: true}}
+	configured, changed, err := Configure([]byte(manifest), "kube-apiserver", prefixes, args, mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatalf("expected manifest to change")
+	}
+	s := string(configured)
+	if strings.Contains(s, "--example-b=old") {
+		t.Errorf("expected replaced argument to be removed:\n%s", s)
+	}
+	if !strings.Contains(s, "- --secure-port=6443\n    - --example-a=a\n    - --example-b=b\n") {
+		t.Errorf("expected arguments in order of name, after the other arguments:\n%s", s)
+	}
+	if !strings.Contains(s, "path: /etc/example") || !strings.Contains(s, "mountPath: /etc/example") {
+		t.Errorf("expected directory to be mounted:\n%s", s)
+	}
+	again, changed, err := Configure(configured, "kube-apiserver", prefixes, args, mounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || string(again) != s {
+		t.Errorf("expected configured manifest not to change")
+	}
+}
+
+func TestConfigureMissingContainer(t *testing.T) {
+	if _, _, err := Configure([]byte(manifest), "etcd", nil, nil, nil); err == nil {
+		t.Errorf("expected error for missing container")
+	}
+}
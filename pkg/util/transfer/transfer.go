@@ -0,0 +1,533 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/platform9/cctl/pkg/logrus"
+	sshutil "github.com/platform9/cctl/pkg/util/ssh"
+
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+const (
+	// DefaultChunkSize is the size of the pieces a file is split into. A
+	// dropped connection costs at most one chunk.
+	DefaultChunkSize = 4 * 1024 * 1024
+	// DefaultRetries is the number of times a chunk is retried, reconnecting
+	// each time, before the transfer is abandoned.
+	DefaultRetries = 5
+
+	// stagingDir holds uploaded chunks until they are assembled. Chunks are
+	// written over SFTP as the SSH user, which cannot write to most system
+	// directories, so they are staged in /tmp and assembled with sudo.
+	stagingDir = "/tmp"
+	// stagingPrefix begins the name of the directory that holds the chunks
+	// of one upload.
+	stagingPrefix     = "cctl-upload-"
+	partialFileSuffix = ".cctl-partial"
+
+	// limiterBurst is the most data the bandwidth limit lets through at once.
+	limiterBurst = 32 * 1024
+	// minLimitedChunkSize is the smallest chunk uploaded under a bandwidth
+	// limit.
+	minLimitedChunkSize = 64 * 1024
+)
+
+// retryInterval is the time between attempts of a failed step.
+var retryInterval = 5 * time.Second
+
+// Options configures a chunked transfer.
+type Options struct {
+	// ChunkSize is the size of each chunk, in bytes.
+	ChunkSize int64
+	// BandwidthLimit is the maximum transfer rate, in bytes per second. Zero
+	// means unlimited.
+	BandwidthLimit int64
+	// Retries is the number of times a failed chunk is retried.
+	Retries int
+}
+
+// ClientFactory returns a new connection to the machine. It is used to resume
+// a transfer after the connection drops.
+type ClientFactory func() (sshmachine.Client, error)
+
+type transfer struct {
+	client sshmachine.Client
+	// owned is true if the client was created by reconnect, and so is closed
+	// by the transfer.
+	owned     bool
+	reconnect ClientFactory
+	opts      Options
+	limiter   *limiter
+}
+
+func newTransfer(client sshmachine.Client, reconnect ClientFactory, opts Options) *transfer {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	return &transfer{
+		client:    client,
+		reconnect: reconnect,
+		opts:      opts,
+		limiter:   newLimiter(opts.BandwidthLimit),
+	}
+}
+
+// close closes the client, if the transfer created it.
+func (t *transfer) close() {
+	if !t.owned {
+		return
+	}
+	sshutil.Close(t.client)
+	t.owned = false
+}
+
+// withRetries calls fn, reconnecting and calling it again if it fails. The
+// client of the failed attempt is closed before reconnecting, if the transfer
+// created it; the client passed to the transfer belongs to the caller.
+func (t *transfer) withRetries(description string, fn func(client sshmachine.Client) error) error {
+	var err error
+	for attempt := 0; attempt <= t.opts.Retries; attempt++ {
+		if attempt > 0 {
+			log.Printf("[transfer] Retrying %s (attempt %d of %d) after error: %v", description, attempt, t.opts.Retries, err)
+			time.Sleep(retryInterval)
+			if t.reconnect != nil {
+				t.close()
+				client, rerr := t.reconnect()
+				if rerr != nil {
+					err = fmt.Errorf("unable to reconnect: %v", rerr)
+					continue
+				}
+				t.client, t.owned = client, true
+			}
+		}
+		if err = fn(t.client); err == nil {
+			return nil
+		}
+	}
+	if t.opts.Retries == 0 {
+		return fmt.Errorf("%s failed: %v", description, err)
+	}
+	return fmt.Errorf("%s failed after %d retries: %v", description, t.opts.Retries, err)
+}
+
+// Upload copies the local file to the remote path in chunks. Chunks are
+// staged on the machine, in a directory of their own for every remote path and
+// content, so that an interrupted upload resumes from the first chunk that is
+// missing or corrupt, even across invocations, and concurrent uploads of
+// files with the same name do not mix their chunks. The file is read one
+// chunk at a time, and, under a bandwidth limit, at the limit.
+func Upload(client sshmachine.Client, reconnect ClientFactory, localPath, remotePath string, mode os.FileMode, opts Options) error {
+	t := newTransfer(client, reconnect, opts)
+	defer t.close()
+	// A chunk is sent at once, so under a bandwidth limit it is no larger
+	// than the limit allows in a second.
+	if limit := t.opts.BandwidthLimit; limit > 0 && t.opts.ChunkSize > limit {
+		t.opts.ChunkSize = limit
+		if t.opts.ChunkSize < minLimitedChunkSize {
+			t.opts.ChunkSize = minLimitedChunkSize
+		}
+	}
+
+	f, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("unable to open local file %q: %v", localPath, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("unable to read local file %q: %v", localPath, err)
+	}
+	localSum := hex.EncodeToString(h.Sum(nil))
+	dir := uploadDir(remotePath, localSum)
+
+	var existing map[string]string
+	if err := t.withRetries("listing uploaded chunks", func(c sshmachine.Client) error {
+		cmd := mkdirCommand(dir)
+		if stdOut, stdErr, err := c.RunCommand(cmd); err != nil {
+			return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		}
+		var lerr error
+		existing, lerr = remoteChecksums(c, dir+"/")
+		return lerr
+	}); err != nil {
+		return err
+	}
+
+	total := int(numChunks(size, t.opts.ChunkSize))
+	buf := make([]byte, t.opts.ChunkSize)
+	for i := 0; i < total; i++ {
+		partPath := path.Join(dir, partName(i))
+		if sum, ok := existing[partName(i)]; ok {
+			chunk, err := readLocalChunk(f, buf, t.opts.ChunkSize, int64(i))
+			if err != nil {
+				return fmt.Errorf("unable to read local file %q: %v", localPath, err)
+			}
+			if sum == checksum(chunk) {
+				log.Debugf("[transfer] Chunk %d of %d already uploaded", i+1, total)
+				continue
+			}
+		}
+		// The chunk is read at the bandwidth limit, so that the chunks are
+		// sent no faster than the limit.
+		chunk, err := readLocalChunk(t.limiter.reader(f), buf, t.opts.ChunkSize, int64(i))
+		if err != nil {
+			return fmt.Errorf("unable to read local file %q: %v", localPath, err)
+		}
+		if err := t.withRetries(fmt.Sprintf("uploading chunk %d of %d", i+1, total), func(c sshmachine.Client) error {
+			return c.WriteFile(partPath, 0600, chunk)
+		}); err != nil {
+			return err
+		}
+		log.Debugf("[transfer] Uploaded chunk %d of %d to %q", i+1, total, remotePath)
+	}
+
+	cmd := assembleCommand(dir, total, remotePath, mode)
+	if err := t.withRetries(fmt.Sprintf("assembling %q", remotePath), func(c sshmachine.Client) error {
+		stdOut, stdErr, err := c.RunCommand(cmd)
+		if err != nil {
+			return fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var remoteSum string
+	if err := t.withRetries(fmt.Sprintf("verifying %q", remotePath), func(c sshmachine.Client) error {
+		var verr error
+		remoteSum, verr = remoteChecksum(c, remotePath)
+		return verr
+	}); err != nil {
+		return err
+	}
+	if remoteSum != localSum {
+		return fmt.Errorf("checksum of %q on machine (%s) does not match local file %q (%s)", remotePath, remoteSum, localPath, localSum)
+	}
+	return nil
+}
+
+// Download copies the remote file to the local path in chunks. Data is
+// appended to a partial file next to the local path, so that an interrupted
+// download resumes from the last complete chunk, even across invocations. The
+// partial file is discarded if the remote file has changed since it was
+// started. Under a bandwidth limit, each chunk is read from the machine at
+// the limit.
+func Download(client sshmachine.Client, reconnect ClientFactory, remotePath, localPath string, mode os.FileMode, opts Options) error {
+	t := newTransfer(client, reconnect, opts)
+	defer t.close()
+
+	var size int64
+	var remoteSum string
+	if err := t.withRetries(fmt.Sprintf("reading size and checksum of %q", remotePath), func(c sshmachine.Client) error {
+		var serr error
+		if size, serr = remoteSize(c, remotePath); serr != nil {
+			return serr
+		}
+		remoteSum, serr = remoteChecksum(c, remotePath)
+		return serr
+	}); err != nil {
+		return err
+	}
+
+	partialPath := localPath + partialFileSuffix
+	partialSumPath := partialPath + ".sha256"
+	partial, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to open %q: %v", partialPath, err)
+	}
+	defer partial.Close()
+	info, err := partial.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat %q: %v", partialPath, err)
+	}
+	// Discard any incomplete trailing chunk.
+	offset := (info.Size() / t.opts.ChunkSize) * t.opts.ChunkSize
+	if partialSum, _ := ioutil.ReadFile(partialSumPath); string(partialSum) != remoteSum || offset > size {
+		offset = 0
+	}
+	if offset > 0 {
+		log.Printf("[transfer] Resuming download of %q at byte %d of %d", remotePath, offset, size)
+	}
+	if err := partial.Truncate(offset); err != nil {
+		return fmt.Errorf("unable to truncate %q: %v", partialPath, err)
+	}
+	if _, err := partial.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to seek %q: %v", partialPath, err)
+	}
+	if err := ioutil.WriteFile(partialSumPath, []byte(remoteSum), 0600); err != nil {
+		return fmt.Errorf("unable to write %q: %v", partialSumPath, err)
+	}
+
+	total := numChunks(size, t.opts.ChunkSize)
+	for i := offset / t.opts.ChunkSize; i < total; i++ {
+		var chunk []byte
+		if err := t.withRetries(fmt.Sprintf("downloading chunk %d of %d", i+1, total), func(c sshmachine.Client) error {
+			var cerr error
+			chunk, cerr = readChunk(c, t.limiter, remotePath, t.opts.ChunkSize, i)
+			return cerr
+		}); err != nil {
+			return err
+		}
+		if _, err := partial.Write(chunk); err != nil {
+			return fmt.Errorf("unable to write to %q: %v", partialPath, err)
+		}
+		log.Debugf("[transfer] Downloaded chunk %d of %d from %q", i+1, total, remotePath)
+	}
+
+	if _, err := partial.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to seek %q: %v", partialPath, err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, partial); err != nil {
+		return fmt.Errorf("unable to read %q: %v", partialPath, err)
+	}
+	if localSum := hex.EncodeToString(h.Sum(nil)); localSum != remoteSum {
+		os.Remove(partialPath)
+		os.Remove(partialSumPath)
+		return fmt.Errorf("checksum of downloaded file (%s) does not match %q on machine (%s)", localSum, remotePath, remoteSum)
+	}
+	if err := partial.Chmod(mode); err != nil {
+		return fmt.Errorf("unable to chmod %q: %v", partialPath, err)
+	}
+	os.Remove(partialSumPath)
+	return os.Rename(partialPath, localPath)
+}
+
+// readLocalChunk reads the chunk with the index into buf, and returns the part
+// of buf that holds it. The last chunk of the file may be short.
+func readLocalChunk(r io.ReaderAt, buf []byte, chunkSize, index int64) ([]byte, error) {
+	n, err := r.ReadAt(buf[:chunkSize], index*chunkSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func numChunks(size, chunkSize int64) int64 {
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// uploadDir returns the directory that stages the chunks of the file with
+// checksum sum uploaded to remotePath.
+func uploadDir(remotePath, sum string) string {
+	return path.Join(stagingDir, stagingPrefix+checksum([]byte(remotePath))[:16]+"-"+sum)
+}
+
+// mkdirCommand returns the command that creates dir, owned by the SSH user,
+// who writes the chunks over SFTP, even if commands run with sudo.
+func mkdirCommand(dir string) string {
+	return fmt.Sprintf("sh -c 'mkdir -p -m 0700 %s && chown ${SUDO_UID:-$(id -u)} %s'", dir, dir)
+}
+
+// assembleCommand returns the command that concatenates the n chunks staged
+// in dir into remotePath, and removes dir.
+func assembleCommand(dir string, n int, remotePath string, mode os.FileMode) string {
+	parts := make([]string, 0, n+1)
+	parts = append(parts, "/dev/null")
+	for i := 0; i < n; i++ {
+		parts = append(parts, path.Join(dir, partName(i)))
+	}
+	return fmt.Sprintf("sh -c 'cat %s > %s && chmod %s %s && rm -rf %s'", strings.Join(parts, " "), remotePath, strconv.FormatUint(uint64(mode), 8), remotePath, dir)
+}
+
+func partName(i int) string {
+	return fmt.Sprintf("%08d", i)
+}
+
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// readChunk reads the chunk with the index from the machine. The output of the
+// command is written at the bandwidth limit as it arrives, so that a client
+// that streams it reads from the connection no faster than the limit.
+func readChunk(client sshmachine.Client, l *limiter, remotePath string, chunkSize, index int64) ([]byte, error) {
+	cmd := fmt.Sprintf("dd if=%s bs=%d skip=%d count=1", remotePath, chunkSize, index)
+	var stdOut, stdErr bytes.Buffer
+	if err := sshutil.WithContext(client).StreamCommandContext(context.Background(), cmd, l.writer(&stdOut), &stdErr); err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stderr: %q)", cmd, err, stdErr.String())
+	}
+	return stdOut.Bytes(), nil
+}
+
+func remoteSize(client sshmachine.Client, remotePath string) (int64, error) {
+	cmd := fmt.Sprintf("stat -c %%s %s", remotePath)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return 0, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(stdOut)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unable to parse size of %q from %q: %v", remotePath, string(stdOut), err)
+	}
+	return size, nil
+}
+
+func remoteChecksum(client sshmachine.Client, remotePath string) (string, error) {
+	cmd := fmt.Sprintf("sha256sum %s", remotePath)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return "", fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	fields := strings.Fields(string(stdOut))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("unable to parse checksum of %q from %q", remotePath, string(stdOut))
+	}
+	return fields[0], nil
+}
+
+// remoteChecksums returns the checksum of every file whose path begins with
+// prefix, keyed by file name.
+func remoteChecksums(client sshmachine.Client, prefix string) (map[string]string, error) {
+	cmd := fmt.Sprintf("sh -c 'sha256sum %s* 2>/dev/null || true'", prefix)
+	stdOut, stdErr, err := client.RunCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("error running %q: %v (stdout: %q, stderr: %q)", cmd, err, string(stdOut), string(stdErr))
+	}
+	return parseChecksums(stdOut), nil
+}
+
+// parseChecksums parses the output of sha256sum into a map of file name to
+// checksum.
+func parseChecksums(out []byte) map[string]string {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || len(fields[0]) != hex.EncodedLen(sha256.Size) {
+			continue
+		}
+		sums[path.Base(strings.TrimPrefix(fields[1], "*"))] = fields[0]
+	}
+	return sums
+}
+
+// limiter is a token bucket that limits the rate at which data is read or
+// written to a number of bytes per second, letting through at most
+// limiterBurst bytes at once.
+type limiter struct {
+	bytesPerSecond int64
+	tokens         float64
+	last           time.Time
+}
+
+// newLimiter returns a limiter for the rate. A limiter for a rate of zero or
+// less does not limit.
+func newLimiter(bytesPerSecond int64) *limiter {
+	return &limiter{
+		bytesPerSecond: bytesPerSecond,
+		tokens:         limiterBurst,
+		last:           time.Now(),
+	}
+}
+
+// wait blocks until n bytes, no more than limiterBurst, may pass.
+func (l *limiter) wait(n int) {
+	if l.bytesPerSecond <= 0 {
+		return
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.bytesPerSecond)
+	if l.tokens > limiterBurst {
+		l.tokens = limiterBurst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens < 0 {
+		time.Sleep(time.Duration(-l.tokens / float64(l.bytesPerSecond) * float64(time.Second)))
+	}
+}
+
+// reader returns r limited to the rate.
+func (l *limiter) reader(r io.ReaderAt) io.ReaderAt {
+	if l.bytesPerSecond <= 0 {
+		return r
+	}
+	return &limitedReaderAt{r: r, l: l}
+}
+
+// writer returns w limited to the rate.
+func (l *limiter) writer(w io.Writer) io.Writer {
+	if l.bytesPerSecond <= 0 {
+		return w
+	}
+	return &limitedWriter{w: w, l: l}
+}
+
+type limitedReaderAt struct {
+	r io.ReaderAt
+	l *limiter
+}
+
+func (r *limitedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	var read int
+	for read < len(p) {
+		end := read + limiterBurst
+		if end > len(p) {
+			end = len(p)
+		}
+		r.l.wait(end - read)
+		n, err := r.r.ReadAt(p[read:end], off+int64(read))
+		read += n
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+type limitedWriter struct {
+	w io.Writer
+	l *limiter
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for written < len(p) {
+		end := written + limiterBurst
+		if end > len(p) {
+			end = len(p)
+		}
+		w.l.wait(end - written)
+		n, err := w.w.Write(p[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	sshmachine "github.com/platform9/ssh-provider/pkg/machine"
+)
+
+func TestReadLocalChunk(t *testing.T) {
+	tcs := []struct {
+		name      string
+		data      []byte
+		chunkSize int64
+		expected  [][]byte
+	}{
+		{"empty", []byte{}, 4, [][]byte{}},
+		{"exact", []byte("abcdefgh"), 4, [][]byte{[]byte("abcd"), []byte("efgh")}},
+		{"remainder", []byte("abcdefghi"), 4, [][]byte{[]byte("abcd"), []byte("efgh"), []byte("i")}},
+		{"single", []byte("ab"), 4, [][]byte{[]byte("ab")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			n := numChunks(int64(len(tc.data)), tc.chunkSize)
+			if n != int64(len(tc.expected)) {
+				t.Fatalf("expected %d chunks, found %d", len(tc.expected), n)
+			}
+			buf := make([]byte, tc.chunkSize)
+			for i := int64(0); i < n; i++ {
+				actual, err := readLocalChunk(bytes.NewReader(tc.data), buf, tc.chunkSize, i)
+				if err != nil {
+					t.Fatalf("chunk %d: %v", i, err)
+				}
+				if !bytes.Equal(actual, tc.expected[i]) {
+					t.Fatalf("chunk %d: expected %q, found %q", i, tc.expected[i], actual)
+				}
+			}
+		})
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	out := []byte(`e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  /tmp/cctl-upload-0123456789abcdef-e3b0/00000000
+2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 */tmp/cctl-upload-0123456789abcdef-e3b0/00000001
+malformed line
+`)
+	expected := map[string]string{
+		"00000000": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"00000001": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	actual := parseChecksums(out)
+	if !cmp.Equal(expected, actual) {
+		t.Fatalf("expected %v, found %v", expected, actual)
+	}
+	if checksum([]byte("hello")) != expected["00000001"] {
+		t.Fatalf("unexpected checksum %q", checksum([]byte("hello")))
+	}
+}
+
+func TestAssembleCommand(t *testing.T) {
+	dir := uploadDir("/var/lib/etcd/snapshot.db", checksum([]byte("data")))
+	if !strings.HasPrefix(dir, "/tmp/cctl-upload-") {
+		t.Fatalf("unexpected staging directory %q", dir)
+	}
+	if dir == uploadDir("/root/snapshot.db", checksum([]byte("data"))) {
+		t.Fatalf("uploads to different paths share staging directory %q", dir)
+	}
+	if dir == uploadDir("/var/lib/etcd/snapshot.db", checksum([]byte("other"))) {
+		t.Fatalf("uploads of different files share staging directory %q", dir)
+	}
+	tcs := []struct {
+		name     string
+		n        int
+		expected string
+	}{
+		{"empty", 0, "sh -c 'cat /dev/null > /var/lib/etcd/snapshot.db && chmod 600 /var/lib/etcd/snapshot.db && rm -rf " + dir + "'"},
+		{"chunks", 2, "sh -c 'cat /dev/null " + dir + "/00000000 " + dir + "/00000001 > /var/lib/etcd/snapshot.db && chmod 600 /var/lib/etcd/snapshot.db && rm -rf " + dir + "'"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := assembleCommand(dir, tc.n, "/var/lib/etcd/snapshot.db", 0600); actual != tc.expected {
+				t.Fatalf("expected %q, found %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWithRetriesError(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+	for _, tc := range []struct {
+		retries  int
+		expected string
+	}{
+		{0, "uploading chunk 1 of 1 failed: broken pipe"},
+		{1, "uploading chunk 1 of 1 failed after 1 retries: broken pipe"},
+	} {
+		tr := newTransfer(nil, nil, Options{Retries: tc.retries})
+		calls := 0
+		err := tr.withRetries("uploading chunk 1 of 1", func(sshmachine.Client) error {
+			calls++
+			return errors.New("broken pipe")
+		})
+		if err == nil || err.Error() != tc.expected {
+			t.Fatalf("expected error %q, found %v", tc.expected, err)
+		}
+		if calls != tc.retries+1 {
+			t.Fatalf("expected %d attempts, found %d", tc.retries+1, calls)
+		}
+	}
+}
+
+// closingClient counts how often it is closed.
+type closingClient struct {
+	sshmachine.Client
+	closed int
+}
+
+func (c *closingClient) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestWithRetriesClosesReconnectedClients(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = 0
+	original := &closingClient{}
+	var reconnected []*closingClient
+	reconnect := func() (sshmachine.Client, error) {
+		c := &closingClient{}
+		reconnected = append(reconnected, c)
+		return c, nil
+	}
+	tr := newTransfer(original, reconnect, Options{Retries: 2})
+	if err := tr.withRetries("uploading chunk 1 of 1", func(sshmachine.Client) error {
+		return errors.New("broken pipe")
+	}); err == nil {
+		t.Fatalf("expected error, found none")
+	}
+	tr.close()
+	if original.closed != 0 {
+		t.Fatalf("expected the client of the caller not to be closed, closed %d times", original.closed)
+	}
+	if len(reconnected) != 2 {
+		t.Fatalf("expected 2 reconnections, found %d", len(reconnected))
+	}
+	for i, c := range reconnected {
+		if c.closed != 1 {
+			t.Fatalf("expected reconnected client %d to be closed once, closed %d times", i, c.closed)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	data := make([]byte, 256*1024)
+	var out bytes.Buffer
+	start := time.Now()
+	if _, err := io.Copy(newLimiter(1024*1024).writer(&out), bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	// All but the initial burst wait for the limit.
+	if elapsed, expected := time.Since(start), (len(data)-limiterBurst)*int(time.Second)/(1024*1024); elapsed < time.Duration(expected) {
+		t.Fatalf("expected the copy to take at least %s, took %s", time.Duration(expected), elapsed)
+	}
+	if out.Len() != len(data) {
+		t.Fatalf("expected %d bytes, found %d", len(data), out.Len())
+	}
+	if w := newLimiter(0).writer(&out); w != &out {
+		t.Fatalf("expected no limit for a rate of zero")
+	}
+}
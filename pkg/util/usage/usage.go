@@ -0,0 +1,203 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// CPUTimes are the cumulative CPU times, in jiffies, from the aggregate line
+// of /proc/stat.
+type CPUTimes struct {
+	Idle  uint64
+	Total uint64
+}
+
+// ParseCPUTimes parses the aggregate "cpu" line of /proc/stat.
+func ParseCPUTimes(line string) (CPUTimes, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return CPUTimes{}, fmt.Errorf("unexpected /proc/stat line %q", line)
+	}
+	var t CPUTimes
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return CPUTimes{}, fmt.Errorf("unable to parse %q in /proc/stat line %q: %v", f, line, err)
+		}
+		t.Total += v
+		// The idle and iowait times are the fourth and fifth values.
+		if i == 3 || i == 4 {
+			t.Idle += v
+		}
+	}
+	return t, nil
+}
+
+// CPUPercent returns the percentage of time the CPUs were busy between two
+// samples.
+func CPUPercent(before, after CPUTimes) float64 {
+	if after.Total <= before.Total {
+		return 0
+	}
+	total := after.Total - before.Total
+	idle := after.Idle - before.Idle
+	return 100 * float64(total-idle) / float64(total)
+}
+
+// Memory is the memory of a machine, in bytes.
+type Memory struct {
+	Total     uint64
+	Available uint64
+}
+
+// Used returns the memory that is not available.
+func (m Memory) Used() uint64 {
+	return m.Total - m.Available
+}
+
+// ParseMemInfo parses the contents of /proc/meminfo.
+func ParseMemInfo(out []byte) (Memory, error) {
+	var m Memory
+	var foundTotal, foundAvailable bool
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			m.Total, foundTotal = kb*1024, true
+		case "MemAvailable:":
+			m.Available, foundAvailable = kb*1024, true
+		}
+	}
+	if !foundTotal || !foundAvailable {
+		return Memory{}, fmt.Errorf("unable to find MemTotal and MemAvailable in /proc/meminfo")
+	}
+	return m, nil
+}
+
+// Disk is the size of a filesystem, in bytes.
+type Disk struct {
+	Total uint64
+	Used  uint64
+}
+
+// ParseDF parses the output of `df -P -k` for a single filesystem.
+func ParseDF(out []byte) (Disk, error) {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) < 2 {
+		return Disk{}, fmt.Errorf("unexpected df output %q", string(out))
+	}
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 6 {
+		return Disk{}, fmt.Errorf("unexpected df output %q", string(out))
+	}
+	total, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return Disk{}, fmt.Errorf("unable to parse df size %q: %v", fields[1], err)
+	}
+	used, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return Disk{}, fmt.Errorf("unable to parse df used %q: %v", fields[2], err)
+	}
+	return Disk{Total: total * 1024, Used: used * 1024}, nil
+}
+
+// PodUsage is the CPU and memory used by a pod, as reported by `kubectl top
+// pod`.
+type PodUsage struct {
+	Namespace string
+	Name      string
+	CPU       resource.Quantity
+	Memory    resource.Quantity
+}
+
+// ParseTopPods parses the output of `kubectl top pod --all-namespaces`.
+func ParseTopPods(out []byte) ([]PodUsage, error) {
+	var pods []PodUsage
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] == "NAMESPACE" {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("unexpected kubectl top line %q", scanner.Text())
+		}
+		cpu, err := resource.ParseQuantity(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse CPU %q: %v", fields[2], err)
+		}
+		memory, err := resource.ParseQuantity(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse memory %q: %v", fields[3], err)
+		}
+		pods = append(pods, PodUsage{
+			Namespace: fields[0],
+			Name:      fields[1],
+			CPU:       cpu,
+			Memory:    memory,
+		})
+	}
+	return pods, nil
+}
+
+// TopPods returns at most n of the pods whose namespace/name is in names,
+// ordered by CPU usage, highest first.
+func TopPods(pods []PodUsage, names map[string]bool, n int) []PodUsage {
+	var top []PodUsage
+	for _, p := range pods {
+		if names[p.Namespace+"/"+p.Name] {
+			top = append(top, p)
+		}
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return top[i].CPU.Cmp(top[j].CPU) > 0
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// FormatBytes formats a number of bytes using binary units, e.g. 1.5GiB.
+func FormatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%dB", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
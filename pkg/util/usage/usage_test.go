@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usage
+
+import (
+	"testing"
+)
+
+func TestCPUPercent(t *testing.T) {
+	before, err := ParseCPUTimes("cpu  100 0 100 700 100 0 0 0 0 0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, err := ParseCPUTimes("cpu  150 0 150 750 150 0 0 0 0 0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p := CPUPercent(before, after); p != 50 {
+		t.Errorf("expected 50%%, found %v", p)
+	}
+	if p := CPUPercent(after, after); p != 0 {
+		t.Errorf("expected 0%%, found %v", p)
+	}
+	if _, err := ParseCPUTimes("cpu0 1 2 3 4"); err == nil {
+		t.Errorf("expected error parsing per-CPU line")
+	}
+}
+
+func TestParseMemInfo(t *testing.T) {
+	out := []byte(`MemTotal:        4000000 kB
+MemFree:          100000 kB
+MemAvailable:    1000000 kB
+`)
+	m, err := ParseMemInfo(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Total != 4000000*1024 || m.Available != 1000000*1024 || m.Used() != 3000000*1024 {
+		t.Errorf("unexpected memory %+v", m)
+	}
+	if _, err := ParseMemInfo([]byte("MemTotal: 1 kB\n")); err == nil {
+		t.Errorf("expected error when MemAvailable is missing")
+	}
+}
+
+func TestParseDF(t *testing.T) {
+	out := []byte(`Filesystem     1024-blocks    Used Available Capacity Mounted on
+/dev/sda1         41152736 8388608  30651324      22% /
+`)
+	d, err := ParseDF(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Total != 41152736*1024 || d.Used != 8388608*1024 {
+		t.Errorf("unexpected disk %+v", d)
+	}
+	if _, err := ParseDF([]byte("")); err == nil {
+		t.Errorf("expected error parsing empty output")
+	}
+}
+
+func TestTopPods(t *testing.T) {
+	out := []byte(`NAMESPACE     NAME                      CPU(cores)   MEMORY(bytes)
+kube-system   kube-apiserver-master1    250m         400Mi
+kube-system   etcd-master1              30m          100Mi
+default       web-1                     1            50Mi
+default       web-2                     500m         60Mi
+`)
+	pods, err := ParseTopPods(out)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pods) != 4 {
+		t.Fatalf("expected 4 pods, found %d", len(pods))
+	}
+	names := map[string]bool{
+		"kube-system/kube-apiserver-master1": true,
+		"kube-system/etcd-master1":           true,
+		"default/web-1":                      true,
+	}
+	top := TopPods(pods, names, 2)
+	if len(top) != 2 || top[0].Name != "web-1" || top[1].Name != "kube-apiserver-master1" {
+		t.Errorf("unexpected top pods %+v", top)
+	}
+	if _, err := ParseTopPods([]byte("default web-1 1\n")); err == nil {
+		t.Errorf("expected error parsing malformed line")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tcs := map[uint64]string{
+		512:                    "512B",
+		1536:                   "1.5KiB",
+		3 * 1024 * 1024 * 1024: "3.0GiB",
+	}
+	for b, expected := range tcs {
+		if actual := FormatBytes(b); actual != expected {
+			t.Errorf("FormatBytes(%d): expected %q, found %q", b, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package versionmatrix collects the versions of the components installed on
+// every machine, so that machines running different versions stand out.
+package versionmatrix
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Components whose versions are collected, in the order they are printed.
+const (
+	Kubelet = "kubelet"
+	Kubeadm = "kubeadm"
+	Etcdadm = "etcdadm"
+	Etcd    = "etcd"
+	OS      = "os"
+)
+
+// Components lists every component, in the order they are printed.
+var Components = []string{Kubelet, Kubeadm, Etcdadm, Etcd, OS}
+
+const (
+	// NotApplicable is the version of a component the machine does not run.
+	NotApplicable = "-"
+	// Unknown is the version of a component that could not be detected.
+	Unknown = "unknown"
+)
+
+// Machine is the versions of the components of a machine.
+type Machine struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	// Versions maps every component to its version, NotApplicable, or
+	// Unknown.
+	Versions map[string]string `json:"versions"`
+	// Errors explain the components whose version is Unknown.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// NewMachine returns a machine whose components are all NotApplicable.
+func NewMachine(name string, roles []string) Machine {
+	m := Machine{Name: name, Roles: roles, Versions: map[string]string{}}
+	for _, c := range Components {
+		m.Versions[c] = NotApplicable
+	}
+	return m
+}
+
+// Set records the version of the component, or Unknown and the error if it
+// could not be detected.
+func (m *Machine) Set(component, version string, err error) {
+	if err != nil {
+		m.Versions[component] = Unknown
+		if m.Errors == nil {
+			m.Errors = map[string]string{}
+		}
+		m.Errors[component] = err.Error()
+		return
+	}
+	m.Versions[component] = version
+}
+
+// Version returns the version of the component, so that templates can index
+// the matrix by component.
+func (m Machine) Version(component string) string {
+	if v, ok := m.Versions[component]; ok {
+		return v
+	}
+	return NotApplicable
+}
+
+// Inconsistent returns the components that machines run at more than one
+// version, in the order of Components. NotApplicable and Unknown versions are
+// ignored.
+func Inconsistent(machines []Machine) []string {
+	var inconsistent []string
+	for _, c := range Components {
+		versions := map[string]bool{}
+		for _, m := range machines {
+			v := m.Version(c)
+			if v == NotApplicable || v == Unknown {
+				continue
+			}
+			versions[v] = true
+		}
+		if len(versions) > 1 {
+			inconsistent = append(inconsistent, c)
+		}
+	}
+	return inconsistent
+}
+
+// UnknownVersions returns the machines and components whose version could not be
+// detected, as "machine/component", sorted.
+func UnknownVersions(machines []Machine) []string {
+	var unknown []string
+	for _, m := range machines {
+		for _, c := range Components {
+			if m.Version(c) == Unknown {
+				unknown = append(unknown, fmt.Sprintf("%s/%s", m.Name, c))
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
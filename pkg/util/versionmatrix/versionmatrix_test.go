@@ -0,0 +1,55 @@
+/*
+Copyright 2019 The cctl authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package versionmatrix
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestInconsistent(t *testing.T) {
+	master := NewMachine("10.0.0.1", []string{"Master"})
+	master.Set(Kubelet, "1.12.8", nil)
+	master.Set(Kubeadm, "1.12.8", nil)
+	master.Set(Etcd, "3.3.10", nil)
+	master.Set(OS, "ubuntu-18.04", nil)
+	node := NewMachine("10.0.0.2", []string{"Node"})
+	node.Set(Kubelet, "1.12.7", nil)
+	node.Set(Kubeadm, "", fmt.Errorf("connection refused"))
+	node.Set(OS, "ubuntu-18.04", nil)
+	etcd := NewMachine("10.0.0.3", []string{"Etcd"})
+	etcd.Set(Etcd, "3.3.10", nil)
+	etcd.Set(OS, "centos-7", nil)
+	machines := []Machine{master, node, etcd}
+
+	if expected, actual := []string{Kubelet, OS}, Inconsistent(machines); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected inconsistent %v, found %v", expected, actual)
+	}
+	if expected, actual := []string{"10.0.0.2/kubeadm"}, UnknownVersions(machines); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected unknown %v, found %v", expected, actual)
+	}
+	if v := etcd.Version(Kubelet); v != NotApplicable {
+		t.Errorf("expected kubelet of etcd machine to be %q, found %q", NotApplicable, v)
+	}
+	if e := node.Errors[Kubeadm]; e != "connection refused" {
+		t.Errorf("expected error of unknown version, found %q", e)
+	}
+	if c := Inconsistent(machines[:1]); len(c) != 0 {
+		t.Errorf("expected a single machine to be consistent, found %v", c)
+	}
+}